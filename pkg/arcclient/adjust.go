@@ -0,0 +1,253 @@
+package arcclient
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// What the converters changed. Converting Arc's results to frames isn't
+// always lossless, and the converters say so on the frame rather than
+// deciding what to do about it:
+//
+//   - a ConversionFailure is a column whose values didn't fit the column's
+//     type and became null (JSON only: Arrow values are typed);
+//   - an Adjustment is a column whose values were converted with a guess or
+//     a loss: numeric timestamps whose unit was inferred from their
+//     magnitude, integers past 2^53 rounded into float64, unsigned
+//     integers past 2^53 turned into text to keep them exact, interval
+//     months counted as 30 days, text values cut at a byte limit.
+//
+// Both are read back with ConversionFailures and Adjustments.
+
+// Adjustment kinds.
+const (
+	AdjustEpochUnit       = "epochUnit"
+	AdjustIntegerRounding = "integerRounding"
+	AdjustUint64AsText    = "uint64AsText"
+	AdjustIntervalMonths  = "intervalMonths"
+	AdjustCellTruncated   = "cellTruncated"
+)
+
+// Adjustment is one kind of adjustment to the values of one column.
+type Adjustment struct {
+	Kind   string `json:"kind"`
+	Column string `json:"column"`
+	Count  int    `json:"count"`
+}
+
+// adjustmentsMetaKey is the FrameMeta.Custom key holding a frame's
+// []Adjustment.
+const adjustmentsMetaKey = "adjustments"
+
+// Adjustments returns the adjustments the converters recorded on frame.
+func Adjustments(frame *data.Frame) []Adjustment {
+	if frame == nil || frame.Meta == nil {
+		return nil
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	adjustments, _ := custom[adjustmentsMetaKey].([]Adjustment)
+	return adjustments
+}
+
+// noteAdjustment records an adjustment of count values in column on frame,
+// adding to an earlier record of the same kind and column (one per Arrow
+// batch).
+func noteAdjustment(frame *data.Frame, kind, column string, count int) {
+	if count == 0 {
+		return
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		custom = map[string]interface{}{}
+		frame.Meta.Custom = custom
+	}
+	mods, _ := custom[adjustmentsMetaKey].([]Adjustment)
+	for i := range mods {
+		if mods[i].Kind == kind && mods[i].Column == column {
+			mods[i].Count += count
+			return
+		}
+	}
+	custom[adjustmentsMetaKey] = append(mods, Adjustment{Kind: kind, Column: column, Count: count})
+}
+
+// maxExactFloatInt is 2^53: every integer up to it is exact in a float64.
+const maxExactFloatInt = 1 << 53
+
+// noteArrowAdjustments records what writing col into a float64 field
+// changes: integers past 2^53 and interval months.
+func noteArrowAdjustments(frame *data.Frame, name string, col arrow.Array) {
+	count := 0
+	switch arr := col.(type) {
+	case *array.Int64:
+		for i, v := range arr.Int64Values() {
+			if (v > maxExactFloatInt || v < -maxExactFloatInt) && arr.IsValid(i) && !int64ExactInFloat(v) {
+				count++
+			}
+		}
+		noteAdjustment(frame, AdjustIntegerRounding, name, count)
+	case *array.Uint64:
+		for i, v := range arr.Uint64Values() {
+			if v > maxExactFloatInt && arr.IsValid(i) && !uint64ExactInFloat(v) {
+				count++
+			}
+		}
+		noteAdjustment(frame, AdjustIntegerRounding, name, count)
+	case *array.MonthDayNanoInterval:
+		for i, v := range arr.MonthDayNanoIntervalValues() {
+			if v.Months != 0 && arr.IsValid(i) {
+				count++
+			}
+		}
+		noteAdjustment(frame, AdjustIntervalMonths, name, count)
+	}
+}
+
+func int64ExactInFloat(v int64) bool {
+	f := float64(v)
+	return f < math.MaxInt64 && int64(f) == v
+}
+
+func uint64ExactInFloat(v uint64) bool {
+	f := float64(v)
+	return f < math.MaxUint64 && uint64(f) == v
+}
+
+// jsonIntegerMayBeRounded reports whether a JSON number is an integer past
+// 2^53, which encoding/json already had to round into a float64.
+func jsonIntegerMayBeRounded(v float64) bool {
+	return math.Abs(v) > maxExactFloatInt && v == math.Trunc(v) && !math.IsInf(v, 0)
+}
+
+// intervalMonthsRe matches a non-zero year or month part of DuckDB's
+// INTERVAL text.
+var intervalMonthsRe = regexp.MustCompile(`(?i)(^|\s)-?0*[1-9]\d*\s+(years?|mons?|months?)\b`)
+
+// jsonIntervalHasMonths reports whether a JSON INTERVAL value (text or
+// object form, see parseJSONInterval) has a month part.
+func jsonIntervalHasMonths(v interface{}) bool {
+	switch iv := v.(type) {
+	case string:
+		return intervalMonthsRe.MatchString(iv)
+	case map[string]interface{}:
+		months, _ := iv["months"].(float64)
+		return months != 0
+	}
+	return false
+}
+
+// cellEllipsis ends a value TruncateCell cut.
+const cellEllipsis = "…"
+
+// TruncateCell cuts s to at most maxBytes bytes, on a rune boundary, and
+// appends an ellipsis; ok is false, and s returned as is, when s fits or
+// maxBytes isn't positive. The result is a copy, so it doesn't keep the
+// original's memory alive.
+func TruncateCell(s string, maxBytes int) (truncated string, ok bool) {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s, false
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + cellEllipsis, true
+}
+
+// truncateStringCells applies TruncateCell to rows [from, to) of a string
+// field and records the values it cut.
+func truncateStringCells(frame *data.Frame, field *data.Field, from, to, maxBytes int) {
+	if maxBytes <= 0 || field.Type() != data.FieldTypeNullableString {
+		return
+	}
+	count := 0
+	for i := from; i < to; i++ {
+		p, _ := field.At(i).(*string)
+		if p == nil {
+			continue
+		}
+		if s, ok := TruncateCell(*p, maxBytes); ok {
+			field.Set(i, &s)
+			count++
+		}
+	}
+	noteAdjustment(frame, AdjustCellTruncated, field.Name, count)
+}
+
+// ConversionFailure records the values of one column that could not be
+// represented in the column's inferred type and were replaced with null.
+type ConversionFailure struct {
+	Column        string `json:"column"`
+	Kind          string `json:"kind"` // "timestamps", "numbers" or "booleans"
+	Count         int    `json:"count"`
+	FirstBadValue string `json:"firstBadValue"`
+}
+
+func (f ConversionFailure) String() string {
+	return fmt.Sprintf("column '%s': %d values could not be parsed as %s (first bad value: '%s')",
+		f.Column, f.Count, f.Kind, f.FirstBadValue)
+}
+
+// maxBadValuePreview caps the bad-value sample quoted in a notice so a
+// runaway blob doesn't end up in the panel header.
+const maxBadValuePreview = 64
+
+// previewBadValue renders a rejected value for a ConversionFailure.
+func previewBadValue(v interface{}) string {
+	s := fmt.Sprintf("%v", v)
+	if utf8.RuneCountInString(s) <= maxBadValuePreview {
+		return s
+	}
+	return string([]rune(s)[:maxBadValuePreview]) + "..."
+}
+
+// conversionFailuresMetaKey is the FrameMeta.Custom key holding a frame's
+// []ConversionFailure.
+const conversionFailuresMetaKey = "conversionFailures"
+
+// AttachConversionFailures records failures on frame: one warning notice per
+// column, plus the structured list under Meta.Custom so the counts show up in
+// the query inspector. A no-op for an empty list.
+func AttachConversionFailures(frame *data.Frame, failures []ConversionFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		custom = map[string]interface{}{}
+		frame.Meta.Custom = custom
+	}
+	custom[conversionFailuresMetaKey] = failures
+	for _, f := range failures {
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: f.String()})
+	}
+}
+
+// ConversionFailures returns the failures AttachConversionFailures
+// recorded on frame, if any.
+func ConversionFailures(frame *data.Frame) []ConversionFailure {
+	if frame == nil || frame.Meta == nil {
+		return nil
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	failures, _ := custom[conversionFailuresMetaKey].([]ConversionFailure)
+	return failures
+}
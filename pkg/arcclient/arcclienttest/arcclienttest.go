@@ -0,0 +1,34 @@
+// Package arcclienttest provides test fixtures for code built on arcclient:
+// the answers Arc's query endpoints send, built in memory.
+package arcclienttest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+)
+
+// ArrowStream encodes one record batch of schema, its columns appended by
+// fill, as the Arrow IPC stream Arc's Arrow endpoint answers with.
+func ArrowStream(t testing.TB, schema *arrow.Schema, fill func(*array.RecordBuilder)) []byte {
+	t.Helper()
+	pool := memory.NewGoAllocator()
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(pool))
+	b := array.NewRecordBuilder(pool, schema)
+	defer b.Release()
+	fill(b)
+	rec := b.NewRecord()
+	defer rec.Release()
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("ipc write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ipc close: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,667 @@
+package arcclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// ErrNotArrowStream is returned when a 200 response from the Arrow endpoint
+// doesn't start with an Arrow IPC schema — typically a proxy or an old Arc
+// answering the path with JSON or HTML.
+var ErrNotArrowStream = errors.New("response is not an Arrow stream")
+
+// ReadArrow decodes the Arrow IPC stream Arc answers on
+// /api/v1/query/arrow into one frame. Keep-alive padding between messages
+// is skipped (see keepAliveMessageReader); a body that isn't an Arrow
+// stream at all returns ErrNotArrowStream.
+func ReadArrow(r io.Reader) (*data.Frame, error) {
+	return ReadArrowWithAllocator(r, memory.DefaultAllocator)
+}
+
+// ReadArrowWithAllocator is ReadArrow with the Arrow buffers (message
+// bodies, decoded record batches) allocated from mem. The frame holds Go
+// copies of the values, so every buffer is released before it returns,
+// error or not: a memory.CheckedAllocator passed in ends at zero.
+func ReadArrowWithAllocator(r io.Reader, mem memory.Allocator) (*data.Frame, error) {
+	return ReadArrowWithOptions(r, ArrowOptions{Allocator: mem})
+}
+
+// Uint64Mode selects how the Arrow decoder converts UINT64 columns.
+type Uint64Mode int
+
+const (
+	// Uint64Exact, the default, promotes a UINT64 column to float64 like
+	// the other integers until a value in it exceeds 2^53. From then on the
+	// column is a string field, rows already decoded included, so every
+	// value is shown exactly; recorded as AdjustUint64AsText.
+	Uint64Exact Uint64Mode = iota
+	// Uint64Float keeps UINT64 columns float64 whatever their values;
+	// values past 2^53 are rounded (AdjustIntegerRounding).
+	Uint64Float
+)
+
+// ArrowOptions configure ReadArrowWithOptions. The zero value is what
+// ReadArrow uses.
+type ArrowOptions struct {
+	// Allocator holds the Arrow buffers; nil means memory.DefaultAllocator.
+	Allocator memory.Allocator
+	// Uint64 is how UINT64 columns are converted.
+	Uint64 Uint64Mode
+	// MaxCellBytes cuts text values longer than it with TruncateCell as
+	// each record batch is appended, recorded as AdjustCellTruncated; zero
+	// keeps them whole.
+	MaxCellBytes int
+}
+
+// ReadArrowWithOptions is ReadArrow configured by opts.
+func ReadArrowWithOptions(r io.Reader, opts ArrowOptions) (*data.Frame, error) {
+	mem := opts.Allocator
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	messages := newKeepAliveMessageReader(r, mem)
+	reader, err := ipc.NewReaderFromMessageReader(messages, ipc.WithAllocator(mem))
+	if err != nil {
+		// The Reader only owns the message reader once constructed.
+		messages.Release()
+		return nil, fmt.Errorf("%w: failed to create Arrow reader: %v", ErrNotArrowStream, err)
+	}
+	defer reader.Release()
+	return frameForRecords(reader, opts)
+}
+
+// keepAliveMessageReader is an ipc.MessageReader that tolerates the padding
+// Arc writes into long-running Arrow streams to keep idle proxies from
+// closing the connection:
+//   - zero-length continuation messages (0xFFFFFFFF 0x00000000), which the
+//     stock reader treats as end-of-stream. A zero-length message is only the
+//     real EOS when nothing follows it on the wire; otherwise it is skipped.
+//   - ASCII whitespace between messages. Arc always emits the post-0.15
+//     continuation-prefixed framing, so a message can never legitimately
+//     start with one of these bytes.
+type keepAliveMessageReader struct {
+	ipc.MessageReader
+	br *bufio.Reader
+}
+
+// newKeepAliveMessageReader wraps r in the padding-tolerant message reader,
+// allocating message bodies from mem.
+func newKeepAliveMessageReader(r io.Reader, mem memory.Allocator) *keepAliveMessageReader {
+	br := bufio.NewReader(r)
+	return &keepAliveMessageReader{MessageReader: ipc.NewMessageReader(br, ipc.WithAllocator(mem)), br: br}
+}
+
+// Message returns the next non-padding IPC message, or io.EOF once the
+// stream is exhausted.
+func (r *keepAliveMessageReader) Message() (*ipc.Message, error) {
+	for {
+		if err := r.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		msg, err := r.MessageReader.Message()
+		// The stock reader returns a bare io.EOF (not wrapped) for a
+		// zero-length message; a truncated read comes back wrapped.
+		if err == io.EOF {
+			if _, peekErr := r.br.Peek(1); peekErr == nil {
+				continue // keep-alive — more messages follow
+			}
+		}
+		return msg, err
+	}
+}
+
+// skipWhitespace discards whitespace bytes sitting at a message boundary.
+// EOF is not an error here — the wrapped reader reports it on its own read.
+func (r *keepAliveMessageReader) skipWhitespace() error {
+	for {
+		b, err := r.br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = r.br.Discard(1)
+		default:
+			return nil
+		}
+	}
+}
+
+// frameForRecords creates a data.Frame from a stream of arrow.Records.
+// Empty record batches (Arc flushes them as progress markers on slow
+// queries) are accepted and contribute no rows. A stream that carries a
+// schema but no batches (zero-row result, e.g. a `LIMIT 0` schema probe)
+// yields a typed empty frame rather than a field-less one.
+//
+// Records belong to the reader: each is released by the following Next or
+// by reader.Release, never here.
+func frameForRecords(reader *ipc.Reader, opts ArrowOptions) (*data.Frame, error) {
+	// Wait for first record to get schema
+	if !reader.Next() {
+		if reader.Err() != nil && reader.Err() != io.EOF {
+			return nil, fmt.Errorf("error reading Arrow stream: %w", reader.Err())
+		}
+		if schema := reader.Schema(); schema != nil {
+			return FrameForSchema(schema), nil
+		}
+		return data.NewFrame(""), nil
+	}
+
+	// Create frame from schema
+	record := reader.Record()
+	schema := record.Schema()
+	frame := FrameForSchema(schema)
+
+	// Process first record
+	if err := appendRecord(frame, record, opts); err != nil {
+		return nil, err
+	}
+
+	// Process remaining records
+	for reader.Next() {
+		if err := appendRecord(frame, reader.Record(), opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if reader.Err() != nil && reader.Err() != io.EOF {
+		return nil, fmt.Errorf("error reading Arrow stream: %w", reader.Err())
+	}
+
+	log.DefaultLogger.Debug("Built frame from Arrow records",
+		"fields", len(frame.Fields),
+		"rows", frame.Rows(),
+	)
+
+	return frame, nil
+}
+
+// FrameForSchema creates a data.Frame with empty fields from Arrow schema,
+// recording the column roles in its field metadata (see ColumnRoles).
+func FrameForSchema(schema *arrow.Schema) *data.Frame {
+	fields := make([]*data.Field, schema.NumFields())
+	for i, arrowField := range schema.Fields() {
+		fields[i] = FieldForArrow(arrowField)
+	}
+	frame := data.NewFrame("", fields...)
+	noteColumnRoles(frame, arrowColumnRoles(schema))
+	return frame
+}
+
+// FieldForArrow creates an empty data.Field from an Arrow field.
+//
+// Fields are ALWAYS created as nullable (pointer-element slices), regardless
+// of the Arrow schema's `f.Nullable` flag. Arc's Arrow schemas advertise
+// non-nullable for columns that are nullable in practice (e.g. aggregates
+// with all-null groups), and Arrow's underlying buffer at null positions is
+// undefined. Honoring the schema's non-nullable claim let stale buffer bytes
+// surface as real values in the dashboard — see R2-CR2 in the
+// signing-readiness punch list. Coercing to nullable + emitting nil at null
+// positions is the only safe shape.
+//
+// INT64/UINT64 are promoted to *float64 so Grafana's Stat/TimeSeries panels
+// treat them as numeric value fields (DuckDB aggregates return int64 after
+// Arc's decimal normalization; Grafana auto-detection requires float64).
+// A UINT64 field becomes *string once a value outgrows float64, see
+// Uint64Exact.
+//
+// DURATION and MONTH_DAY_NANO interval columns become float64 seconds with
+// the "s" unit, matching the JSON path's INTERVAL decoding (newDurationField).
+//
+// NULL-typed columns (`SELECT NULL AS x`) carry no values at all and become
+// all-null *string fields.
+//
+// Unknown Arrow types fall back to *string so the column is still rendered
+// even if the writer path can't decode it. The writer path matches this
+// fallback (R2-HI12).
+func FieldForArrow(f arrow.Field) *data.Field {
+	switch f.Type.ID() {
+	case arrow.STRING:
+		return data.NewField(f.Name, nil, []*string{})
+	case arrow.FLOAT32:
+		return data.NewField(f.Name, nil, []*float32{})
+	case arrow.FLOAT64:
+		return data.NewField(f.Name, nil, []*float64{})
+	case arrow.INT8:
+		return data.NewField(f.Name, nil, []*int8{})
+	case arrow.INT16:
+		return data.NewField(f.Name, nil, []*int16{})
+	case arrow.INT32:
+		return data.NewField(f.Name, nil, []*int32{})
+	case arrow.INT64:
+		return data.NewField(f.Name, nil, []*float64{})
+	case arrow.UINT8:
+		return data.NewField(f.Name, nil, []*uint8{})
+	case arrow.UINT16:
+		return data.NewField(f.Name, nil, []*uint16{})
+	case arrow.UINT32:
+		return data.NewField(f.Name, nil, []*uint32{})
+	case arrow.UINT64:
+		return data.NewField(f.Name, nil, []*float64{})
+	case arrow.BOOL:
+		return data.NewField(f.Name, nil, []*bool{})
+	case arrow.TIMESTAMP:
+		return data.NewField(f.Name, nil, []*time.Time{})
+	case arrow.DURATION, arrow.INTERVAL_MONTH_DAY_NANO:
+		return newDurationField(f.Name)
+	case arrow.NULL:
+		return data.NewField(f.Name, nil, []*string{})
+	default:
+		// Fallback to nullable string for unsupported types — the writer
+		// path's default branch must match this (R2-HI12).
+		return data.NewField(f.Name, nil, []*string{})
+	}
+}
+
+// AppendRecord appends every column of an Arrow record to its
+// corresponding data.Frame field. Each field is pre-extended by the record's
+// row count so the per-row writes don't trigger repeated reflective slice
+// reallocations (M21/P2 fix). UINT64 columns are converted as Uint64Exact
+// describes, which can replace a frame field.
+func AppendRecord(frame *data.Frame, record arrow.Record) error {
+	return appendRecord(frame, record, ArrowOptions{})
+}
+
+func appendRecord(frame *data.Frame, record arrow.Record, opts ArrowOptions) error {
+	if record.NumRows() == 0 || len(frame.Fields) == 0 {
+		return nil
+	}
+	rows := int(record.NumRows())
+	startIdx := frame.Fields[0].Len()
+	for i, col := range record.Columns() {
+		field := frame.Fields[i]
+		field.Extend(rows)
+		if arr, ok := col.(*array.Uint64); ok && opts.Uint64 == Uint64Exact {
+			if over := countUint64Over(arr, maxExactFloatInt); over > 0 || field.Type() == data.FieldTypeNullableString {
+				if field.Type() != data.FieldTypeNullableString {
+					field = Uint64AsText(field)
+					frame.Fields[i] = field
+				}
+				writeUint64Text(field, arr, startIdx)
+				noteAdjustment(frame, AdjustUint64AsText, field.Name, over)
+				continue
+			}
+		}
+		if err := writeArrowColumnIntoField(field, col, startIdx); err != nil {
+			return fmt.Errorf("failed to append column %s: %w", field.Name, err)
+		}
+		noteArrowAdjustments(frame, field.Name, col)
+		truncateStringCells(frame, field, startIdx, startIdx+rows, opts.MaxCellBytes)
+	}
+	return nil
+}
+
+// writeArrowColumnIntoField writes every value of an Arrow column into the
+// destination field starting at startIdx. The field is assumed to have been
+// pre-extended by the caller (see AppendRecord).
+//
+// Each type-cast uses comma-ok so a schema-vs-concrete-type drift (extension
+// types, dictionary-encoded strings, lists) routes to the string fallback
+// (matching FieldForArrow's *string default) rather than panicking the
+// goroutine.
+//
+// Numeric and timestamp columns use Arrow's bulk slice accessors
+// (Int64Values/Float64Values/TimestampValues) and short-circuit the null check
+// when col.NullN() == 0 — significantly faster than per-row Value(i) +
+// IsNull(i) on large batches.
+//
+// All destination fields are nullable (R2-CR2): Arc's schemas can advertise
+// non-nullable for columns that contain nulls in practice, and Arrow's
+// underlying buffer at null positions is undefined. Writers ALWAYS check
+// IsNull and emit a typed nil pointer there.
+func writeArrowColumnIntoField(field *data.Field, col arrow.Array, startIdx int) error {
+	allValid := col.NullN() == 0
+	switch col.DataType().ID() {
+	case arrow.NULL:
+		// Every value is null, and the pre-extended rows already are. The
+		// generic fallback can't be used: a Null array has no validity
+		// bitmap, so IsNull reports false and ValueStr renders "(null)".
+		return nil
+	case arrow.TIMESTAMP:
+		arr, ok := col.(*array.Timestamp)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		ts, ok := col.DataType().(*arrow.TimestampType)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeTimestampColumn(field, arr, ts.Unit, timestampZone(ts.TimeZone), startIdx, allValid)
+	case arrow.DURATION:
+		arr, ok := col.(*array.Duration)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		dt, ok := col.DataType().(*arrow.DurationType)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeDurationColumn(field, arr, dt.Unit, startIdx, allValid)
+	case arrow.INTERVAL_MONTH_DAY_NANO:
+		arr, ok := col.(*array.MonthDayNanoInterval)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeMonthDayNanoColumn(field, arr, startIdx, allValid)
+	case arrow.STRING:
+		arr, ok := col.(*array.String)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeStringColumn(field, arr, startIdx, allValid)
+	case arrow.BOOL:
+		arr, ok := col.(*array.Boolean)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeBoolColumn(field, arr, startIdx, allValid)
+	case arrow.FLOAT32:
+		arr, ok := col.(*array.Float32)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[float32](field, arr, arr.Float32Values(), startIdx, allValid)
+	case arrow.FLOAT64:
+		arr, ok := col.(*array.Float64)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[float64](field, arr, arr.Float64Values(), startIdx, allValid)
+	case arrow.INT8:
+		arr, ok := col.(*array.Int8)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[int8](field, arr, arr.Int8Values(), startIdx, allValid)
+	case arrow.INT16:
+		arr, ok := col.(*array.Int16)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[int16](field, arr, arr.Int16Values(), startIdx, allValid)
+	case arrow.INT32:
+		arr, ok := col.(*array.Int32)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[int32](field, arr, arr.Int32Values(), startIdx, allValid)
+	case arrow.INT64:
+		arr, ok := col.(*array.Int64)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writePromotedColumn[int64](field, arr, arr.Int64Values(), startIdx, allValid)
+	case arrow.UINT8:
+		arr, ok := col.(*array.Uint8)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[uint8](field, arr, arr.Uint8Values(), startIdx, allValid)
+	case arrow.UINT16:
+		arr, ok := col.(*array.Uint16)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[uint16](field, arr, arr.Uint16Values(), startIdx, allValid)
+	case arrow.UINT32:
+		arr, ok := col.(*array.Uint32)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writeNumericColumn[uint32](field, arr, arr.Uint32Values(), startIdx, allValid)
+	case arrow.UINT64:
+		arr, ok := col.(*array.Uint64)
+		if !ok {
+			return writeUnsupportedAsString(field, col, startIdx)
+		}
+		return writePromotedColumn[uint64](field, arr, arr.Uint64Values(), startIdx, allValid)
+	default:
+		// Unsupported Arrow type: render via String() so the column is still
+		// visible (matches FieldForArrow's *string fallback — R2-HI12).
+		return writeUnsupportedAsString(field, col, startIdx)
+	}
+}
+
+// writeUnsupportedAsString renders an Arrow column the writer can't decode
+// natively as the column's per-row String() representation. Lets the panel
+// still display data for extension types / dictionary-encoded strings / lists
+// instead of failing the whole query — schema-build path matches via
+// FieldForArrow's *string fallback (R2-HI12).
+func writeUnsupportedAsString(field *data.Field, col arrow.Array, startIdx int) error {
+	n := col.Len()
+	for i := 0; i < n; i++ {
+		if col.IsNull(i) {
+			var s *string
+			field.Set(startIdx+i, s)
+			continue
+		}
+		// arrow.Array's ValueStr renders the i-th element per the type's stringer.
+		v := col.ValueStr(i)
+		field.Set(startIdx+i, &v)
+	}
+	return nil
+}
+
+// nullable is an interface satisfied by every Arrow array. Used to keep the
+// IsNull lookup polymorphic without a per-row type switch.
+type nullableArrow interface {
+	IsNull(int) bool
+	Len() int
+}
+
+// writeNumericColumn copies a bulk Arrow numeric slice into the (nullable)
+// destination field. When allValid is true the null bitmap is skipped.
+// All destination fields are nullable — see FieldForArrow comment.
+func writeNumericColumn[T any](field *data.Field, arr nullableArrow, values []T, startIdx int, allValid bool) error {
+	n := arr.Len()
+	if allValid {
+		for i := 0; i < n; i++ {
+			v := values[i]
+			field.Set(startIdx+i, &v)
+		}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if arr.IsNull(i) {
+			var v *T
+			field.Set(startIdx+i, v)
+			continue
+		}
+		v := values[i]
+		field.Set(startIdx+i, &v)
+	}
+	return nil
+}
+
+// writePromotedColumn copies int64/uint64 Arrow values into a float64 field
+// (the Grafana-compatibility promotion).
+func writePromotedColumn[T int64 | uint64](field *data.Field, arr nullableArrow, values []T, startIdx int, allValid bool) error {
+	n := arr.Len()
+	if allValid {
+		for i := 0; i < n; i++ {
+			v := float64(values[i])
+			field.Set(startIdx+i, &v)
+		}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if arr.IsNull(i) {
+			var v *float64
+			field.Set(startIdx+i, v)
+			continue
+		}
+		v := float64(values[i])
+		field.Set(startIdx+i, &v)
+	}
+	return nil
+}
+
+// countUint64Over counts the valid values of arr greater than limit.
+func countUint64Over(arr *array.Uint64, limit uint64) int {
+	count := 0
+	for i, v := range arr.Uint64Values() {
+		if v > limit && arr.IsValid(i) {
+			count++
+		}
+	}
+	return count
+}
+
+// Uint64AsText returns the string field Uint64Exact turns a UINT64
+// column's float64 field into, with the values decoded so far — all of
+// them at most 2^53 and so exact — written as integers. Merging frames
+// where only some converted the same column uses it to convert the rest.
+func Uint64AsText(field *data.Field) *data.Field {
+	text := data.NewFieldFromFieldType(data.FieldTypeNullableString, field.Len())
+	text.Name, text.Labels, text.Config = field.Name, field.Labels, field.Config
+	for i := 0; i < field.Len(); i++ {
+		if v, ok := field.ConcreteAt(i); ok {
+			s := strconv.FormatUint(uint64(v.(float64)), 10)
+			text.Set(i, &s)
+		}
+	}
+	return text
+}
+
+// writeUint64Text writes a UINT64 column into a string field as decimal
+// integers.
+func writeUint64Text(field *data.Field, arr *array.Uint64, startIdx int) {
+	for i, v := range arr.Uint64Values() {
+		if arr.IsNull(i) {
+			continue
+		}
+		s := strconv.FormatUint(v, 10)
+		field.Set(startIdx+i, &s)
+	}
+}
+
+// writeTimestampColumn uses Arrow's bulk TimestampValues slice and converts
+// to time.Time using the column's declared unit and zone (passed in to
+// avoid an unchecked (*arrow.TimestampType) cast inside the hot loop —
+// R2-CR4).
+func writeTimestampColumn(field *data.Field, col *array.Timestamp, unit arrow.TimeUnit, loc *time.Location, startIdx int, allValid bool) error {
+	values := col.TimestampValues()
+	n := col.Len()
+	if allValid {
+		for i := 0; i < n; i++ {
+			t := values[i].ToTime(unit).In(loc)
+			field.Set(startIdx+i, &t)
+		}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if col.IsNull(i) {
+			var t *time.Time
+			field.Set(startIdx+i, t)
+			continue
+		}
+		t := values[i].ToTime(unit).In(loc)
+		field.Set(startIdx+i, &t)
+	}
+	return nil
+}
+
+// Timestamp zones. An Arrow TIMESTAMP with a time zone (DuckDB's
+// TIMESTAMPTZ) stores UTC instants, and the zone names where they are
+// shown: an IANA name ("America/New_York") or an offset ("+05:30"). The
+// values are read as those instants and expressed in the zone, as
+// time.Parse does for an offset in the JSON path's text, so the instant
+// never shifts with the zone. A zone this host can't resolve is logged
+// once and left at UTC. A TIMESTAMP without a zone is wall-clock time,
+// read as UTC.
+
+// maxTimestampZones caps how many zone names timestampZone remembers; the
+// zones a server sends are few, and a stream inventing new ones shouldn't
+// grow the cache without bound.
+const maxTimestampZones = 256
+
+// timestampZones caches timestampZone's lookups, unresolvable names (as
+// UTC) included, so every record batch reuses one *time.Location.
+var timestampZones = struct {
+	sync.Mutex
+	m map[string]*time.Location
+}{m: map[string]*time.Location{}}
+
+// timestampZone resolves the time zone of an Arrow TIMESTAMP column, UTC
+// when it has none or names one that doesn't resolve.
+func timestampZone(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	timestampZones.Lock()
+	defer timestampZones.Unlock()
+	if loc, ok := timestampZones.m[name]; ok {
+		return loc
+	}
+	loc, err := (&arrow.TimestampType{TimeZone: name}).GetZone()
+	if err != nil {
+		log.DefaultLogger.Warn("Unknown time zone on Arrow timestamp column, reading it as UTC", "timeZone", name, "error", err)
+		loc = time.UTC
+	}
+	if len(timestampZones.m) < maxTimestampZones {
+		timestampZones.m[name] = loc
+	}
+	return loc
+}
+
+// writeStringColumn writes Arrow string column values. Arrow's *array.String
+// has no bulk slice accessor (variable-width data), so per-row Value(i) is
+// the right shape here.
+func writeStringColumn(field *data.Field, col *array.String, startIdx int, allValid bool) error {
+	n := col.Len()
+	if allValid {
+		for i := 0; i < n; i++ {
+			s := col.Value(i)
+			field.Set(startIdx+i, &s)
+		}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if col.IsNull(i) {
+			var s *string
+			field.Set(startIdx+i, s)
+			continue
+		}
+		s := col.Value(i)
+		field.Set(startIdx+i, &s)
+	}
+	return nil
+}
+
+// writeBoolColumn writes Arrow boolean column values. *array.Boolean is
+// bitmap-backed; per-row Value(i) is the public accessor.
+func writeBoolColumn(field *data.Field, col *array.Boolean, startIdx int, allValid bool) error {
+	n := col.Len()
+	if allValid {
+		for i := 0; i < n; i++ {
+			b := col.Value(i)
+			field.Set(startIdx+i, &b)
+		}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if col.IsNull(i) {
+			var b *bool
+			field.Set(startIdx+i, b)
+			continue
+		}
+		b := col.Value(i)
+		field.Set(startIdx+i, &b)
+	}
+	return nil
+}
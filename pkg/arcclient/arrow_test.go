@@ -0,0 +1,380 @@
+package arcclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// multiBatchStream encodes batches record batches of schema {time, host,
+// value}, three rows each with a null value, as an Arrow IPC stream.
+func multiBatchStream(t *testing.T, batches int) []byte {
+	t.Helper()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}},
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "value", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	}, nil)
+	pool := memory.NewGoAllocator()
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(pool))
+	for i := 0; i < batches; i++ {
+		b := array.NewRecordBuilder(pool, schema)
+		base := arrow.Timestamp(int64(i) * 3e9)
+		b.Field(0).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{base, base + 1e9, base + 2e9}, nil)
+		b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b", "c"}, nil)
+		b.Field(2).(*array.Int64Builder).AppendValues([]int64{1, 0, 3}, []bool{true, false, true})
+		rec := b.NewRecord()
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("ipc write: %v", err)
+		}
+		rec.Release()
+		b.Release()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ipc close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// failingReader returns data, then err: a body cut off
+// by a canceled request or a dropped connection.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// TestReadArrowWithAllocator_ReleasesEverything runs conversions that end
+// normally, early and with errors, and checks every Arrow buffer they
+// allocated was released.
+func TestReadArrowWithAllocator_ReleasesEverything(t *testing.T) {
+	stream := multiBatchStream(t, 3)
+	oneBatch := multiBatchStream(t, 1)
+	schemaOnly := func() []byte {
+		var buf bytes.Buffer
+		w := ipc.NewWriter(&buf, ipc.WithSchema(arrow.NewSchema([]arrow.Field{{Name: "v", Type: arrow.PrimitiveTypes.Float64}}, nil)))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}()
+	// One batch is schema + batch + 8-byte EOS and two add another batch, so
+	// the schema message is what is left after taking a batch and the EOS.
+	schemaLen := 2*len(oneBatch) - len(multiBatchStream(t, 2)) - 8
+	padded := append(append(append([]byte{}, stream[:schemaLen]...), "\n \n"...), stream[schemaLen:]...)
+
+	cases := []struct {
+		name    string
+		body    func() io.Reader
+		rows    int
+		wantErr bool
+		errIs   error
+	}{
+		{name: "three batches", body: func() io.Reader { return bytes.NewReader(stream) }, rows: 9},
+		{name: "keep-alive padding", body: func() io.Reader { return bytes.NewReader(padded) }, rows: 9},
+		{name: "schema only", body: func() io.Reader { return bytes.NewReader(schemaOnly) }},
+		{name: "not an arrow stream", body: func() io.Reader { return bytes.NewReader([]byte(`{"error": "proxy"}`)) }, wantErr: true, errIs: ErrNotArrowStream},
+		{name: "truncated inside a batch", body: func() io.Reader { return bytes.NewReader(stream[:len(stream)-40]) }, wantErr: true},
+		{name: "canceled after the first batch", body: func() io.Reader {
+			return &failingReader{data: stream[:len(oneBatch)-8], err: context.Canceled}
+		}, wantErr: true, errIs: context.Canceled},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+			defer mem.AssertSize(t, 0)
+
+			frame, err := ReadArrowWithAllocator(c.body(), mem)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if c.errIs != nil && !errors.Is(err, c.errIs) {
+					t.Fatalf("expected %v, got %v", c.errIs, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadArrowWithAllocator: %v", err)
+			}
+			if frame.Rows() != c.rows {
+				t.Errorf("rows = %d, want %d", frame.Rows(), c.rows)
+			}
+		})
+	}
+}
+
+// uint64Stream encodes one UINT64 column "n", one record batch per slice;
+// a zero value is written as null.
+func uint64Stream(t *testing.T, batches ...[]uint64) []byte {
+	t.Helper()
+	schema := arrow.NewSchema([]arrow.Field{{Name: "n", Type: arrow.PrimitiveTypes.Uint64, Nullable: true}}, nil)
+	pool := memory.NewGoAllocator()
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(pool))
+	for _, values := range batches {
+		b := array.NewUint64Builder(pool)
+		for _, v := range values {
+			if v == 0 {
+				b.AppendNull()
+			} else {
+				b.Append(v)
+			}
+		}
+		col := b.NewArray()
+		rec := array.NewRecord(schema, []arrow.Array{col}, int64(len(values)))
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("ipc write: %v", err)
+		}
+		rec.Release()
+		col.Release()
+		b.Release()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ipc close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// fieldStrings renders every value of field, "null" for nulls; float64s
+// are written out in full, not in their shortest form.
+func fieldStrings(field *data.Field) []string {
+	out := make([]string, field.Len())
+	for i := range out {
+		v, ok := field.ConcreteAt(i)
+		switch {
+		case !ok:
+			out[i] = "null"
+		case field.Type() == data.FieldTypeNullableFloat64:
+			out[i] = strconv.FormatFloat(v.(float64), 'f', 0, 64)
+		default:
+			out[i] = v.(string)
+		}
+	}
+	return out
+}
+
+// TestReadArrow_TimestampZone: a zoned TIMESTAMP column holds UTC instants.
+// They are read unshifted and expressed in the column's zone, an offset or
+// an IANA name; an unknown zone reads as UTC.
+func TestReadArrow_TimestampZone(t *testing.T) {
+	instants := []time.Time{
+		time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 7, 1, 4, 30, 0, 250e6, time.UTC),
+	}
+	for _, c := range []struct {
+		zone    string
+		offsets []int // seconds east of UTC at each instant: New York's change with DST
+	}{
+		{"+05:30", []int{19800, 19800}},
+		{"-03:00", []int{-10800, -10800}},
+		{"America/New_York", []int{-5 * 3600, -4 * 3600}},
+		{"UTC", []int{0, 0}},
+		{"", []int{0, 0}},
+		{"Mars/Olympus_Mons", []int{0, 0}},
+	} {
+		t.Run(c.zone, func(t *testing.T) {
+			schema := arrow.NewSchema([]arrow.Field{
+				{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: c.zone}, Nullable: true},
+			}, nil)
+			pool := memory.NewGoAllocator()
+			var buf bytes.Buffer
+			w := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(pool))
+			b := array.NewRecordBuilder(pool, schema)
+			defer b.Release()
+			tb := b.Field(0).(*array.TimestampBuilder)
+			for _, at := range instants {
+				tb.Append(arrow.Timestamp(at.UnixMilli()))
+			}
+			tb.AppendNull()
+			rec := b.NewRecord()
+			defer rec.Release()
+			if err := w.Write(rec); err != nil {
+				t.Fatalf("ipc write: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("ipc close: %v", err)
+			}
+
+			frame, err := ReadArrow(&buf)
+			if err != nil {
+				t.Fatalf("ReadArrow: %v", err)
+			}
+			field := frame.Fields[0]
+			for i, want := range instants {
+				got, _ := field.ConcreteAt(i)
+				tm := got.(time.Time)
+				if !tm.Equal(want) {
+					t.Errorf("row %d = %v, want the instant %v", i, tm, want)
+				}
+				if _, off := tm.Zone(); off != c.offsets[i] {
+					t.Errorf("row %d in offset %ds, want %ds", i, off, c.offsets[i])
+				}
+			}
+			if _, ok := field.ConcreteAt(len(instants)); ok {
+				t.Error("null row should stay null")
+			}
+		})
+	}
+}
+
+func TestReadArrowWithOptions_Uint64(t *testing.T) {
+	const (
+		exact    = uint64(1) << 53
+		belowMax = exact - 1
+		aboveMax = exact + 1
+		huge     = uint64(1) << 63
+	)
+	cases := []struct {
+		name        string
+		mode        Uint64Mode
+		batches     [][]uint64
+		wantType    data.FieldType
+		want        []string
+		adjustments []Adjustment
+	}{
+		{
+			name:     "2^53 stays numeric",
+			batches:  [][]uint64{{1, belowMax, exact}},
+			wantType: data.FieldTypeNullableFloat64,
+			want:     []string{"1", "9007199254740991", "9007199254740992"},
+		},
+		{
+			name:        "2^53+1 becomes text",
+			batches:     [][]uint64{{belowMax, 0, aboveMax}},
+			wantType:    data.FieldTypeNullableString,
+			want:        []string{"9007199254740991", "null", "9007199254740993"},
+			adjustments: []Adjustment{{Kind: AdjustUint64AsText, Column: "n", Count: 1}},
+		},
+		{
+			name:        "a later batch converts the rows before it",
+			batches:     [][]uint64{{5, 0}, {huge, 7}, {8}},
+			wantType:    data.FieldTypeNullableString,
+			want:        []string{"5", "null", "9223372036854775808", "7", "8"},
+			adjustments: []Adjustment{{Kind: AdjustUint64AsText, Column: "n", Count: 1}},
+		},
+		{
+			// 2^63 is a power of two, exact in float64; only 2^53+1 rounds.
+			name:        "float mode rounds",
+			mode:        Uint64Float,
+			batches:     [][]uint64{{aboveMax, huge}},
+			wantType:    data.FieldTypeNullableFloat64,
+			want:        []string{"9007199254740992", "9223372036854775808"},
+			adjustments: []Adjustment{{Kind: AdjustIntegerRounding, Column: "n", Count: 1}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			frame, err := ReadArrowWithOptions(bytes.NewReader(uint64Stream(t, c.batches...)), ArrowOptions{Uint64: c.mode})
+			if err != nil {
+				t.Fatalf("ReadArrowWithOptions: %v", err)
+			}
+			field := frame.Fields[0]
+			if field.Type() != c.wantType {
+				t.Fatalf("field type = %s, want %s", field.Type(), c.wantType)
+			}
+			if got := fieldStrings(field); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("values = %v, want %v", got, c.want)
+			}
+			if got := Adjustments(frame); !reflect.DeepEqual(got, c.adjustments) {
+				t.Errorf("adjustments = %+v, want %+v", got, c.adjustments)
+			}
+		})
+	}
+}
+
+func TestSyntheticArrowStream(t *testing.T) {
+	stream, err := SyntheticArrowStream(25, 5, 10)
+	if err != nil {
+		t.Fatalf("SyntheticArrowStream: %v", err)
+	}
+	frame, err := ReadArrow(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("ReadArrow: %v", err)
+	}
+	if frame.Rows() != 25 || len(frame.Fields) != 5 {
+		t.Fatalf("frame is %d rows x %d columns, want 25 x 5", frame.Rows(), len(frame.Fields))
+	}
+	var names []string
+	for _, f := range frame.Fields {
+		names = append(names, f.Name+":"+f.Type().ItemTypeString())
+	}
+	if want := []string{"time:*time.Time", "host:*string", "value_2:*float64", "count_3:*float64", "value_4:*float64"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("fields = %v, want %v", names, want)
+	}
+	if v := frame.Fields[2].At(6); v.(*float64) != nil {
+		t.Errorf("value_2[6] = %v, want null", *v.(*float64))
+	}
+
+	if _, err := SyntheticArrowStream(10, 0, 10); err == nil {
+		t.Error("zero columns: no error")
+	}
+}
+
+// BenchmarkReadArrow measures the Arrow converter on a synthetic 100k-row
+// result, the same stream the plugin's /bench resource decodes.
+func BenchmarkReadArrow(b *testing.B) {
+	stream, err := SyntheticArrowStream(100_000, 8, 10_000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadArrow(bytes.NewReader(stream)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReadArrow_ColumnRoles(t *testing.T) {
+	role := func(r string) arrow.Metadata { return arrow.NewMetadata([]string{ColumnRoleMetadataKey}, []string{r}) }
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}, Metadata: role("timestamp")},
+		{Name: "host_id", Type: arrow.PrimitiveTypes.Int64, Metadata: role("dimension")},
+		{Name: "state", Type: arrow.BinaryTypes.String, Metadata: role("MEASURE")},
+		{Name: "note", Type: arrow.BinaryTypes.String, Metadata: role("comment")},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64},
+	}, nil)
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := ReadArrow(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ColumnRole{"time": RoleTimestamp, "host_id": RoleDimension, "state": RoleMeasure}
+	if got := ColumnRoles(frame); !reflect.DeepEqual(got, want) {
+		t.Errorf("ColumnRoles = %v, want %v", got, want)
+	}
+
+	plain, err := ReadArrow(bytes.NewReader(multiBatchStream(t, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ColumnRoles(plain); got != nil {
+		t.Errorf("ColumnRoles without metadata = %v, want nil", got)
+	}
+}
@@ -0,0 +1,217 @@
+package arcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Arc's query endpoints.
+const (
+	QueryPath      = "/api/v1/query"
+	ArrowQueryPath = "/api/v1/query/arrow"
+)
+
+// Protocol selects the query endpoint.
+type Protocol string
+
+// Protocols.
+const (
+	ProtocolArrow Protocol = "arrow"
+	ProtocolJSON  Protocol = "json"
+)
+
+// errorBodyLimit caps how much of an error response is read: enough for
+// any realistic Arc error payload.
+const errorBodyLimit = 16 * 1024
+
+// Client runs queries against one Arc server with the Grafana datasource's
+// macros, endpoints and frame conversion. It is a minimal client for
+// scripts and tests, not the datasource's transport: the datasource sends
+// its requests with its own code, and its authentication modes, retries,
+// concurrency limit, response cap, SSRF-safe dialer and metrics are not
+// part of Client. Pass an HTTPClient that does what the caller needs.
+type Client struct {
+	// URL is Arc's base URL, e.g. http://localhost:8000.
+	URL string
+	// APIKey is sent as a bearer token. A server behind another scheme
+	// needs an HTTPClient whose Transport sets the header instead.
+	APIKey string
+	// Database is sent as X-Arc-Database; empty uses the server's default.
+	Database string
+	// Protocol is the endpoint queries use; empty means ProtocolArrow.
+	Protocol Protocol
+	// HTTPClient sends the requests; nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// QueryOptions describe one query.
+type QueryOptions struct {
+	// SQL is the query, macros included.
+	SQL string
+	// TimeRange is the range the macros expand to.
+	TimeRange TimeRange
+	// Interval and MaxDataPoints size $__interval as Grafana's panel does;
+	// zero Interval sizes it to TimeRange (see ResolveInterval).
+	Interval      time.Duration
+	MaxDataPoints int64
+	// BucketOrigin aligns $__timeGroup buckets: "", "startOfRange", an
+	// RFC3339 timestamp or a zone name (see ResolveBucketOrigin).
+	BucketOrigin string
+	// Database overrides Client.Database for this query.
+	Database string
+}
+
+// ErrMultipleResults is returned by Query when Arc answered with more than
+// one result set (a multi-statement query); QueryFrames returns them all.
+var ErrMultipleResults = errors.New("query returned several result sets")
+
+// Query runs one query and returns its frame. The frame's
+// Meta.ExecutedQueryString is the SQL sent, macros expanded. Values the
+// JSON converter had to null out are attached as warning notices (see
+// AttachConversionFailures); adjustments are recorded (see Adjustments). A
+// non-200 answer is a *StatusError, an error Arc reports in a 200 answer a
+// *ResponseError.
+func (c *Client) Query(ctx context.Context, opts QueryOptions) (*data.Frame, error) {
+	frames, err := c.QueryFrames(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) != 1 {
+		return nil, fmt.Errorf("%w (%d)", ErrMultipleResults, len(frames))
+	}
+	return frames[0], nil
+}
+
+// QueryFrames is Query for queries that may answer with several result
+// sets: one frame each.
+func (c *Client) QueryFrames(ctx context.Context, opts QueryOptions) (data.Frames, error) {
+	origin, err := ResolveBucketOrigin(opts.BucketOrigin, opts.TimeRange)
+	if err != nil {
+		return nil, err
+	}
+	sql := ExpandMacros(opts.SQL, MacroOptions{
+		Range:         opts.TimeRange,
+		BucketOrigin:  origin,
+		Interval:      opts.Interval,
+		MaxDataPoints: opts.MaxDataPoints,
+	})
+	database := opts.Database
+	if database == "" {
+		database = c.Database
+	}
+
+	var frames data.Frames
+	if c.Protocol == ProtocolJSON {
+		frames, err = c.queryJSON(ctx, sql, database)
+	} else {
+		frames, err = c.queryArrow(ctx, sql, database)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.ExecutedQueryString = sql
+	}
+	return frames, nil
+}
+
+func (c *Client) queryArrow(ctx context.Context, sql, database string) (data.Frames, error) {
+	body, err := c.post(ctx, ArrowQueryPath, "application/vnd.apache.arrow.stream", sql, database)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	frame, err := ReadArrow(body)
+	if err != nil {
+		return nil, err
+	}
+	EpochTimeFields(frame, nil)
+	return data.Frames{frame}, nil
+}
+
+func (c *Client) queryJSON(ctx context.Context, sql, database string) (data.Frames, error) {
+	body, err := c.post(ctx, QueryPath, "application/json", sql, database)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	results, err := ReadJSONResultSets(body)
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Arc JSON response: %w", err)
+	}
+	frames := make(data.Frames, 0, len(results))
+	for i, r := range results {
+		frame, failures, err := r.Frame(JSONOptions{})
+		results[i] = nil // its cells are in the frame now
+		if err != nil {
+			if len(results) > 1 {
+				err = fmt.Errorf("result %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		EpochTimeFields(frame, nil)
+		AttachConversionFailures(frame, failures)
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// post sends sql to path and returns the body of a 200 answer.
+func (c *Client) post(ctx context.Context, path, accept, sql, database string) (io.ReadCloser, error) {
+	payload, err := json.Marshal(map[string]string{"sql": sql})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.URL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	if database != "" {
+		req.Header.Set("X-Arc-Database", database)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: ErrorMessage(resp.StatusCode, raw), Body: raw}
+	}
+	if ct := resp.Header.Get("Content-Type"); accept != "application/json" && strings.HasPrefix(ct, "application/json") {
+		// An error payload where the Arrow stream should be.
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit))
+		if respErr := ResponseErrorOf(raw); respErr != nil {
+			return nil, respErr
+		}
+		return nil, fmt.Errorf("%w: got %s from %s", ErrNotArrowStream, ct, path)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,192 @@
+package arcclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+)
+
+// recordingServer answers every query with body and records the last
+// request's path, headers and SQL.
+type recordingServer struct {
+	*httptest.Server
+	path   string
+	header http.Header
+	sql    string
+}
+
+func newRecordingServer(t *testing.T, status int, body []byte) *recordingServer {
+	t.Helper()
+	s := &recordingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.path, s.header, s.sql = r.URL.Path, r.Header.Clone(), req.SQL
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+var testRange = TimeRange{
+	From: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+	To:   time.Date(2026, 3, 1, 1, 0, 0, 0, time.UTC),
+}
+
+func TestClientQuery_Arrow(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1772323200000000, 1772323260000000}, nil)
+		b.Field(1).(*array.Float64Builder).AppendValues([]float64{1, 2}, nil)
+	})
+	// Keep-alive padding after the schema message must be skipped.
+	var schemaOnly bytes.Buffer
+	w := ipc.NewWriter(&schemaOnly, ipc.WithSchema(schema))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	schemaLen := schemaOnly.Len() - 8 // minus the end-of-stream marker
+	padded := append(append(append([]byte{}, stream[:schemaLen]...), "\n\n"...), stream[schemaLen:]...)
+	srv := newRecordingServer(t, http.StatusOK, padded)
+
+	c := &Client{URL: srv.URL + "/", APIKey: "secret", Database: "metrics"}
+	frame, err := c.Query(t.Context(), QueryOptions{
+		SQL:       "SELECT time, value FROM cpu WHERE $__timeFilter(time)",
+		TimeRange: testRange,
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	wantSQL := "SELECT time, value FROM cpu WHERE time >= '2026-03-01T00:00:00Z' AND time < '2026-03-01T01:00:00Z'"
+	if srv.sql != wantSQL {
+		t.Errorf("sent SQL %q, want %q", srv.sql, wantSQL)
+	}
+	if srv.path != ArrowQueryPath {
+		t.Errorf("path = %q, want %q", srv.path, ArrowQueryPath)
+	}
+	if got := srv.header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := srv.header.Get("X-Arc-Database"); got != "metrics" {
+		t.Errorf("X-Arc-Database = %q", got)
+	}
+	if frame.Rows() != 2 || len(frame.Fields) != 2 {
+		t.Fatalf("frame is %d rows x %d fields, want 2 x 2", frame.Rows(), len(frame.Fields))
+	}
+	if got := frame.Meta.ExecutedQueryString; got != wantSQL {
+		t.Errorf("ExecutedQueryString = %q", got)
+	}
+}
+
+func TestClientQuery_JSON(t *testing.T) {
+	srv := newRecordingServer(t, http.StatusOK, []byte(`{"columns": ["host", "n"], "data": [["a", 1], ["b", 2]]}`))
+
+	c := &Client{URL: srv.URL, Database: "metrics", Protocol: ProtocolJSON}
+	frame, err := c.Query(t.Context(), QueryOptions{
+		SQL:       "SELECT host, count(*) AS n FROM cpu WHERE time > $__timeFrom() GROUP BY host",
+		TimeRange: testRange,
+		Database:  "logs",
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if srv.path != QueryPath {
+		t.Errorf("path = %q, want %q", srv.path, QueryPath)
+	}
+	if got := srv.header.Get("X-Arc-Database"); got != "logs" {
+		t.Errorf("X-Arc-Database = %q, want the per-query override", got)
+	}
+	if got := srv.header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization sent without an API key: %q", got)
+	}
+	if !strings.Contains(srv.sql, "time > '2026-03-01T00:00:00Z'") {
+		t.Errorf("macros not expanded: %q", srv.sql)
+	}
+	if frame.Rows() != 2 {
+		t.Errorf("rows = %d, want 2", frame.Rows())
+	}
+}
+
+func TestClientQuery_Errors(t *testing.T) {
+	t.Run("status error", func(t *testing.T) {
+		srv := newRecordingServer(t, http.StatusBadRequest, []byte(`{"error": "Table with name cpu does not exist"}`))
+		c := &Client{URL: srv.URL, Protocol: ProtocolJSON}
+		_, err := c.Query(t.Context(), QueryOptions{SQL: "SELECT * FROM cpu"})
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("expected *StatusError, got %v", err)
+		}
+		if statusErr.StatusCode != http.StatusBadRequest || !strings.Contains(statusErr.Message, "does not exist") {
+			t.Errorf("StatusError = %+v", statusErr)
+		}
+	})
+
+	t.Run("several result sets", func(t *testing.T) {
+		srv := newRecordingServer(t, http.StatusOK, []byte(`{"results": [
+			{"columns": ["a"], "data": [[1]]},
+			{"columns": ["b"], "data": [[2]]}
+		]}`))
+		c := &Client{URL: srv.URL, Protocol: ProtocolJSON}
+		if _, err := c.Query(t.Context(), QueryOptions{SQL: "SELECT 1; SELECT 2"}); !errors.Is(err, ErrMultipleResults) {
+			t.Errorf("Query: expected ErrMultipleResults, got %v", err)
+		}
+		frames, err := c.QueryFrames(t.Context(), QueryOptions{SQL: "SELECT 1; SELECT 2"})
+		if err != nil || len(frames) != 2 {
+			t.Errorf("QueryFrames: %d frames, %v", len(frames), err)
+		}
+	})
+
+	t.Run("not an arrow stream", func(t *testing.T) {
+		srv := newRecordingServer(t, http.StatusOK, []byte("<html>proxy login</html>"))
+		c := &Client{URL: srv.URL}
+		if _, err := c.Query(t.Context(), QueryOptions{SQL: "SELECT 1"}); !errors.Is(err, ErrNotArrowStream) {
+			t.Errorf("expected ErrNotArrowStream, got %v", err)
+		}
+	})
+
+	t.Run("error in a 200 answer", func(t *testing.T) {
+		for _, c := range []struct {
+			protocol    Protocol
+			contentType string
+		}{{ProtocolJSON, "application/json"}, {ProtocolArrow, "application/json; charset=utf-8"}} {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", c.contentType)
+				_, _ = w.Write([]byte(`{"error": "Binder Error: Referenced column \"foo\" not found in FROM clause!"}`))
+			}))
+			client := &Client{URL: srv.URL, Protocol: c.protocol}
+			_, err := client.Query(t.Context(), QueryOptions{SQL: "SELECT foo FROM cpu"})
+			srv.Close()
+			var respErr *ResponseError
+			if !errors.As(err, &respErr) || !respErr.SQLError() {
+				t.Fatalf("%s: expected a SQL *ResponseError, got %v", c.protocol, err)
+			}
+			if want := `Arc error: Binder Error: Referenced column "foo" not found in FROM clause!`; err.Error() != want {
+				t.Errorf("%s: error = %q, want %q", c.protocol, err, want)
+			}
+		}
+	})
+
+	t.Run("invalid bucket origin", func(t *testing.T) {
+		c := &Client{URL: "http://127.0.0.1:1"}
+		if _, err := c.Query(t.Context(), QueryOptions{SQL: "SELECT 1", BucketOrigin: "noon"}); !errors.Is(err, ErrInvalidBucketOrigin) {
+			t.Errorf("expected ErrInvalidBucketOrigin, got %v", err)
+		}
+	})
+}
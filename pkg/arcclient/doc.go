@@ -0,0 +1,31 @@
+// Package arcclient runs SQL against Arc the way the Grafana datasource
+// does, for tools outside Grafana — regression-testing dashboard queries,
+// for one. It holds the parts of the datasource that decide what a query
+// returns:
+//
+//   - the macro engine (ExpandMacros and the single-macro helpers);
+//   - the converters from Arc's Arrow and JSON answers to data.Frames
+//     (ReadArrow, ReadJSONResultSets, FrameFromJSON), with what they
+//     changed, and the column roles Arc sent, recorded on the frame
+//     (ConversionFailures, Adjustments, ColumnRoles);
+//   - a minimal Client that puts them together for scripts and tests:
+//     Client.Query.
+//
+// The datasource (pkg/plugin) expands macros and converts answers with this
+// package, so for the same answer a frame from Client.Query is the frame a
+// panel receives before the datasource's own post-processing (series
+// shaping, row caps, notices). It doesn't send its requests through Client:
+// its HTTP transport — authentication modes, identity headers, retries, the
+// concurrency limit, the response cap — stays in pkg/plugin, and Client is
+// not a replacement for it.
+//
+// The exported API follows the module's semantic versioning. What the
+// functions return is versioned separately by BehaviorVersion: a change
+// that makes the same query or response produce different SQL or frames
+// increments it and is listed in CHANGELOG.md, so stored snapshots can be
+// tied to the behavior that produced them.
+package arcclient
+
+// BehaviorVersion identifies the macro expansion and conversion behavior
+// of this package (see the package documentation).
+const BehaviorVersion = 17
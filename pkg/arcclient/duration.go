@@ -0,0 +1,143 @@
+package arcclient
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Duration columns. Arrow DURATION (any unit) and DuckDB INTERVAL columns are
+// decoded to float64 seconds with the "s" unit, so panels render "1.2 s"
+// instead of raw nanosecond counts or interval strings. Both converters
+// produce the same field: the Arrow path from DURATION and MONTH_DAY_NANO
+// arrays, the JSON path from columns Arc declares as INTERVAL.
+//
+// Months count as 30 days, the convention DuckDB's epoch(interval) uses, so
+// an interval means the same number of seconds in either protocol.
+
+// DurationUnit is the Grafana unit set on decoded duration fields.
+const DurationUnit = "s"
+
+const (
+	secondsPerDay = 86400
+	daysPerMonth  = 30
+)
+
+// newDurationField returns an empty nullable float64 field in seconds.
+func newDurationField(name string) *data.Field {
+	field := data.NewField(name, nil, []*float64{})
+	field.Config = &data.FieldConfig{Unit: DurationUnit}
+	return field
+}
+
+// monthDayNanoSeconds converts DuckDB interval parts to seconds.
+func monthDayNanoSeconds(months, days, nanos int64) float64 {
+	return float64((months*daysPerMonth+days)*secondsPerDay) + float64(nanos)/1e9
+}
+
+// writeDurationColumn writes an Arrow DURATION column as seconds.
+func writeDurationColumn(field *data.Field, col *array.Duration, unit arrow.TimeUnit, startIdx int, allValid bool) error {
+	values := col.DurationValues()
+	perUnit := float64(unit.Multiplier()) / 1e9
+	for i := 0; i < col.Len(); i++ {
+		if !allValid && col.IsNull(i) {
+			var v *float64
+			field.Set(startIdx+i, v)
+			continue
+		}
+		v := float64(values[i]) * perUnit
+		field.Set(startIdx+i, &v)
+	}
+	return nil
+}
+
+// writeMonthDayNanoColumn writes an Arrow MONTH_DAY_NANO interval column
+// (DuckDB's INTERVAL) as seconds.
+func writeMonthDayNanoColumn(field *data.Field, col *array.MonthDayNanoInterval, startIdx int, allValid bool) error {
+	values := col.MonthDayNanoIntervalValues()
+	for i := 0; i < col.Len(); i++ {
+		if !allValid && col.IsNull(i) {
+			var v *float64
+			field.Set(startIdx+i, v)
+			continue
+		}
+		iv := values[i]
+		v := monthDayNanoSeconds(int64(iv.Months), int64(iv.Days), iv.Nanoseconds)
+		field.Set(startIdx+i, &v)
+	}
+	return nil
+}
+
+// isIntervalType reports whether a declared Arc column type is an interval.
+func isIntervalType(t string) bool {
+	return strings.HasPrefix(t, "INTERVAL")
+}
+
+// parseJSONInterval decodes an INTERVAL value from Arc's JSON response to
+// seconds: either DuckDB's text form ("1 day 02:03:04.5", "00:00:01.2",
+// "1 year 2 months") or a {"months", "days", "micros"} object.
+func parseJSONInterval(v interface{}) (float64, bool) {
+	switch iv := v.(type) {
+	case string:
+		return ParseInterval(iv)
+	case map[string]interface{}:
+		var parts [3]int64
+		for i, key := range []string{"months", "days", "micros"} {
+			n, ok := iv[key].(float64)
+			if !ok {
+				return 0, false
+			}
+			parts[i] = int64(n)
+		}
+		return monthDayNanoSeconds(parts[0], parts[1], parts[2]*1000), true
+	}
+	return 0, false
+}
+
+// intervalClockRe matches the trailing [-]HH:MM:SS[.ffffff] of an interval.
+var intervalClockRe = regexp.MustCompile(`^(-)?(\d+):(\d{2}):(\d{2}(?:\.\d+)?)$`)
+
+// ParseInterval parses DuckDB's INTERVAL text output: "<n> <unit>" pairs
+// (years, months, days) optionally followed by a clock part.
+func ParseInterval(s string) (float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	var months, days int64
+	var clock float64
+	if m := intervalClockRe.FindStringSubmatch(fields[len(fields)-1]); m != nil {
+		h, _ := strconv.ParseFloat(m[2], 64)
+		mins, _ := strconv.ParseFloat(m[3], 64)
+		sec, _ := strconv.ParseFloat(m[4], 64)
+		clock = h*3600 + mins*60 + sec
+		if m[1] == "-" {
+			clock = -clock
+		}
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields)%2 != 0 {
+		return 0, false
+	}
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		switch strings.TrimSuffix(strings.ToLower(fields[i+1]), "s") {
+		case "year":
+			months += 12 * n
+		case "mon", "month":
+			months += n
+		case "day":
+			days += n
+		default:
+			return 0, false
+		}
+	}
+	return monthDayNanoSeconds(months, days, 0) + clock, true
+}
@@ -0,0 +1,140 @@
+package arcclient
+
+import (
+	"math"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Numeric timestamps. An epoch carries no unit, so the converters read it
+// from the magnitude: the thresholds below sit at year 2001 in the finer
+// unit and past year 33000 in the coarser one, so any realistic timestamp
+// lands in exactly one unit. Each is the smallest absolute value read in
+// its unit.
+const (
+	epochMillisFrom = 1e12 // below: seconds
+	epochMicrosFrom = 1e15
+	epochNanosFrom  = 1e18
+)
+
+// Plausible range for a numeric epoch in a time-named column. A "time"
+// column of small numbers (a duration, a response time in seconds) lands
+// in 1970 and stays numeric.
+var (
+	minPlausibleEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxPlausibleEpoch = time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// plausibleEpoch reports whether t, read from an epoch, is in the
+// plausible range.
+func plausibleEpoch(t time.Time) bool {
+	return !t.Before(minPlausibleEpoch) && !t.After(maxPlausibleEpoch)
+}
+
+// EpochToTime converts a numeric epoch to time.Time, picking the unit by
+// magnitude: below 1e12 seconds, then milliseconds, microseconds and
+// nanoseconds, each step 1000× the last. Fractions are kept —
+// to_timestamp() floats carry sub-second precision.
+func EpochToTime(x float64) time.Time {
+	abs := math.Abs(x)
+	var nanos float64
+	switch {
+	case abs < epochMillisFrom:
+		nanos = x * 1e9
+	case abs < epochMicrosFrom:
+		nanos = x * 1e6
+	case abs < epochNanosFrom:
+		nanos = x * 1e3
+	default:
+		nanos = x
+	}
+	// Split before converting: seconds × 1e9 overflows float64's exact
+	// integer range, which would cost the sub-microsecond digits.
+	secs := math.Floor(nanos / 1e9)
+	return time.Unix(int64(secs), int64(math.Round(nanos-secs*1e9)))
+}
+
+// epochIntToTime is EpochToTime for an integer epoch, exact to the
+// nanosecond where a float64 past 2^53 would round.
+func epochIntToTime(x int64) time.Time {
+	abs := x
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs < 0: // math.MinInt64, which only fits nanoseconds
+	case abs < epochMillisFrom:
+		return time.Unix(x, 0)
+	case abs < epochMicrosFrom:
+		return time.UnixMilli(x)
+	case abs < epochNanosFrom:
+		return time.UnixMicro(x)
+	}
+	return time.Unix(0, x)
+}
+
+// EpochTimeFields converts the fields of frame named in timeColumns (nil
+// means DefaultTimeColumns) that hold integer epochs into time fields, the
+// unit of each value read from its magnitude, and records AdjustEpochUnit
+// for them. Neither converter types BIGINT as time: Arrow promotes INT64
+// and UINT64 to float64, and JSON reads them as numbers, so without it a
+// query selecting epoch_ns(time) AS time has no time field. A field
+// qualifies when it is int64, uint64, or float64 holding whole numbers
+// only, and every value reads as a plausible timestamp.
+func EpochTimeFields(frame *data.Frame, timeColumns []string) {
+	opts := JSONOptions{TimeColumns: timeColumns}
+	for i, field := range frame.Fields {
+		if !opts.isTimeColumn(field.Name) {
+			continue
+		}
+		values, epochs, ok := epochTimes(field)
+		if !ok {
+			continue
+		}
+		converted := data.NewField(field.Name, field.Labels, values)
+		converted.Config = field.Config
+		frame.Fields[i] = converted
+		noteAdjustment(frame, AdjustEpochUnit, field.Name, epochs)
+	}
+}
+
+// epochTimes reads field's values as epochs for EpochTimeFields; ok is
+// false when the field doesn't qualify. epochs counts the non-null values.
+func epochTimes(field *data.Field) (values []*time.Time, epochs int, ok bool) {
+	switch field.Type().NonNullableType() {
+	case data.FieldTypeInt64, data.FieldTypeUint64, data.FieldTypeFloat64:
+	default:
+		return nil, 0, false
+	}
+	n := field.Len()
+	values, backing := make([]*time.Time, n), make([]time.Time, n)
+	for i := 0; i < n; i++ {
+		v, present := field.ConcreteAt(i)
+		if !present {
+			continue
+		}
+		var t time.Time
+		switch v := v.(type) {
+		case int64:
+			t = epochIntToTime(v)
+		case uint64:
+			if v > math.MaxInt64 {
+				return nil, 0, false
+			}
+			t = epochIntToTime(int64(v))
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) || v != math.Trunc(v) {
+				return nil, 0, false
+			}
+			t = EpochToTime(v)
+		}
+		if !plausibleEpoch(t) {
+			return nil, 0, false
+		}
+		backing[i] = t
+		values[i] = &backing[i]
+		epochs++
+	}
+	return values, epochs, true
+}
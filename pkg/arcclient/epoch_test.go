@@ -0,0 +1,108 @@
+package arcclient
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// TestEpochUnitThresholds: each threshold is the first value read in the
+// finer unit, and the value below it still reads in the coarser one, for
+// float and integer epochs, positive and negative.
+func TestEpochUnitThresholds(t *testing.T) {
+	for _, c := range []struct {
+		x    int64
+		want time.Time
+	}{
+		{epochMillisFrom - 1, time.Unix(epochMillisFrom-1, 0)},
+		{epochMillisFrom, time.UnixMilli(epochMillisFrom)},
+		{epochMicrosFrom - 1, time.UnixMilli(epochMicrosFrom - 1)},
+		{epochMicrosFrom, time.UnixMicro(epochMicrosFrom)},
+		{epochNanosFrom - 1, time.UnixMicro(epochNanosFrom - 1)},
+		{epochNanosFrom, time.Unix(0, epochNanosFrom)},
+		{-(epochMillisFrom - 1), time.Unix(-(epochMillisFrom - 1), 0)},
+		{-epochMillisFrom, time.UnixMilli(-epochMillisFrom)},
+		{-epochNanosFrom, time.Unix(0, -epochNanosFrom)},
+	} {
+		if got := epochIntToTime(c.x); !got.Equal(c.want) {
+			t.Errorf("epochIntToTime(%d) = %v, want %v", c.x, got, c.want)
+		}
+		// Past 2^53 a float64 can't hold the value below a threshold. Below
+		// it, the float arithmetic may cost the last digits of year 33658.
+		if c.x > -maxExactFloatInt && c.x < maxExactFloatInt {
+			if d := EpochToTime(float64(c.x)).Sub(c.want); d < -time.Millisecond || d > time.Millisecond {
+				t.Errorf("EpochToTime(%d) is %v off %v", c.x, d, c.want)
+			}
+		}
+	}
+}
+
+func TestEpochTimeFields(t *testing.T) {
+	ns := int64(1771408800123456789)
+	f64 := func(v float64) *float64 { return &v }
+	i64 := func(v int64) *int64 { return &v }
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []*int64{i64(ns), nil}),
+		data.NewField("timestamp", nil, []uint64{1771408800}),
+		data.NewField("_time", nil, []*float64{f64(1771408800000), f64(1771408860000)}),
+		data.NewField("ts", nil, []*float64{f64(1771408800000)}),
+	)
+	EpochTimeFields(frame, nil)
+	want := []time.Time{time.Unix(0, ns), time.Unix(1771408800, 0), time.UnixMilli(1771408800000)}
+	for i, w := range want {
+		f := frame.Fields[i]
+		if f.Type() != data.FieldTypeNullableTime {
+			t.Errorf("%s typed %s, want time", f.Name, f.Type())
+			continue
+		}
+		if got, _ := f.ConcreteAt(0); !got.(time.Time).Equal(w) {
+			t.Errorf("%s[0] = %v, want %v", f.Name, got, w)
+		}
+	}
+	if _, ok := frame.Fields[0].ConcreteAt(1); ok {
+		t.Error("time[1] should stay null")
+	}
+	if typ := frame.Fields[3].Type(); typ != data.FieldTypeNullableFloat64 {
+		t.Errorf("ts typed %s, want float64: not a time column by default", typ)
+	}
+	wantAdjustments := []Adjustment{
+		{Kind: AdjustEpochUnit, Column: "time", Count: 1},
+		{Kind: AdjustEpochUnit, Column: "timestamp", Count: 1},
+		{Kind: AdjustEpochUnit, Column: "_time", Count: 2},
+	}
+	if got := Adjustments(frame); !reflect.DeepEqual(got, wantAdjustments) {
+		t.Errorf("Adjustments = %+v, want %+v", got, wantAdjustments)
+	}
+
+	EpochTimeFields(frame, []string{"ts"})
+	if typ := frame.Fields[3].Type(); typ != data.FieldTypeNullableTime {
+		t.Errorf("configured ts typed %s, want time", typ)
+	}
+}
+
+// TestEpochTimeFields_Unchanged: fields that aren't whole-number epochs in
+// the plausible range stay as they are.
+func TestEpochTimeFields_Unchanged(t *testing.T) {
+	for name, field := range map[string]*data.Field{
+		"durations":   data.NewField("time", nil, []float64{0.25, 12}),
+		"fraction":    data.NewField("time", nil, []float64{1771408800.5}),
+		"small ints":  data.NewField("time", nil, []int64{1, 2, 3}),
+		"one outlier": data.NewField("time", nil, []int64{1771408800, 42}),
+		"NaN":         data.NewField("time", nil, []float64{math.NaN()}),
+		"huge uint":   data.NewField("time", nil, []uint64{math.MaxUint64}),
+		"int32":       data.NewField("time", nil, []int32{1771408800}),
+		"text":        data.NewField("time", nil, []string{"1771408800"}),
+	} {
+		frame := data.NewFrame("", field)
+		EpochTimeFields(frame, nil)
+		if frame.Fields[0] != field {
+			t.Errorf("%s: converted to %s", name, frame.Fields[0].Type())
+		}
+		if got := Adjustments(frame); got != nil {
+			t.Errorf("%s: Adjustments = %+v", name, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package arcclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// StatusError is a non-200 answer from Arc. Error() is the ErrorMessage
+// text; StatusCode and Body let callers tell the failures apart.
+type StatusError struct {
+	StatusCode int
+	Message    string
+	Body       []byte // the raw error payload, capped
+}
+
+func (e *StatusError) Error() string { return e.Message }
+
+// ResponseError is an error Arc reported in the body of a 200 answer,
+// `{"error": "Binder Error: ..."}`, instead of with an error status.
+// Message is the "error" value, or without one (and without result
+// columns or rows) the "detail" or "message" value.
+type ResponseError struct {
+	Message string
+	Body    []byte // the raw payload, capped; nil when read from a stream
+}
+
+func (e *ResponseError) Error() string { return "Arc error: " + TruncateMessage(e.Message) }
+
+// sqlErrorClasses are the DuckDB error classes that describe the query
+// itself — its syntax, names or values — rather than the server.
+var sqlErrorClasses = []string{
+	"binder", "parser", "syntax", "catalog", "conversion", "invalid input",
+	"out of range", "constraint", "not implemented", "mismatch type",
+}
+
+// SQLError reports whether Message is one of DuckDB's errors about the
+// query ("Binder Error: column foo not found"), which the query's author
+// fixes in the SQL.
+func (e *ResponseError) SQLError() bool {
+	class, _, ok := strings.Cut(e.Message, " Error:")
+	if !ok {
+		return false
+	}
+	class = strings.ToLower(strings.TrimSpace(class))
+	for _, c := range sqlErrorClasses {
+		if class == c {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseErrorOf returns the error an Arc JSON body reports (see
+// ResponseError), or nil when it reports none or isn't JSON.
+func ResponseErrorOf(body []byte) *ResponseError {
+	var payload map[string]interface{}
+	if json.Unmarshal(body, &payload) != nil {
+		return nil
+	}
+	if e := resultSetOf(payload).reportedError(); e != nil {
+		e.Body = body
+		return e
+	}
+	return nil
+}
+
+// ErrorMessage extracts a human-readable error from Arc's JSON error
+// response. Arc returns errors as `{"error": "message"}` or plain text. Body
+// is truncated to MaxErrorMessageBytes, backing off to the previous rune
+// boundary so the result is always valid UTF-8 even if the body byte-cap
+// fell inside a multi-byte sequence (L8 fix).
+func ErrorMessage(statusCode int, body []byte) string {
+	var parsed struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error != "" {
+		return fmt.Sprintf("Arc error (HTTP %d): %s", statusCode, TruncateMessage(parsed.Error))
+	}
+	text := strings.TrimSpace(string(body))
+	text = TruncateMessage(text)
+	if text == "" {
+		return fmt.Sprintf("Arc returned HTTP %d with no error message", statusCode)
+	}
+	return fmt.Sprintf("Arc error (HTTP %d): %s", statusCode, text)
+}
+
+// MaxErrorMessageBytes caps the Arc error text quoted in ErrorMessage.
+const MaxErrorMessageBytes = 500
+
+// TruncateMessage caps s at MaxErrorMessageBytes, backing off to the last
+// complete UTF-8 rune boundary so the returned string is always valid UTF-8.
+func TruncateMessage(s string) string {
+	if len(s) <= MaxErrorMessageBytes {
+		return s
+	}
+	cut := s[:MaxErrorMessageBytes]
+	// Drop any trailing partial rune.
+	for len(cut) > 0 {
+		r, size := utf8.DecodeLastRuneInString(cut)
+		if r != utf8.RuneError || size > 1 {
+			break
+		}
+		cut = cut[:len(cut)-1]
+	}
+	return cut + "..."
+}
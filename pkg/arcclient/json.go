@@ -0,0 +1,642 @@
+package arcclient
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// JSONResultSets splits an Arc JSON response into its result sets. When the
+// submitted SQL held several statements Arc answers
+// `{"results": [{"columns": ..., "data": ...}, ...]}` instead of the usual
+// single `{"columns": ..., "data": ...}`; previously that surfaced as
+// "missing 'columns' field". A single-result response is returned as a
+// one-element slice, unchanged.
+func JSONResultSets(result map[string]interface{}) ([]map[string]interface{}, error) {
+	raw, ok := result["results"]
+	if !ok {
+		return []map[string]interface{}{result}, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid 'results' format: expected array, got %T", raw)
+	}
+	sets := make([]map[string]interface{}, len(list))
+	for i, r := range list {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid result at index %d: expected object, got %T", i, r)
+		}
+		sets[i] = m
+	}
+	return sets, nil
+}
+
+// FrameFromJSON converts one result set of Arc's JSON response
+// (`{"columns": [...], "types": [...], "data": [[...], ...]}`) to a frame.
+// Column types come from Arc's declared types where the values agree with
+// them, else from the values: the first non-null one, unless the column
+// holds more than one JSON type (or strings that only start out as
+// timestamps), which makes it a string field keeping every value. Values
+// that can't be represented in their column's declared type, or a
+// time-named column's, are nulled out and returned as failures; callers
+// decide whether to fail, warn or attach them (see
+// AttachConversionFailures). A result without rows keeps its columns,
+// typed from the declared types (see DeclaredFieldType). Adjustments, and
+// the column roles of a "columnMeta" array, are recorded on the frame (see
+// Adjustments, ColumnRoles).
+func FrameFromJSON(result map[string]interface{}) (*data.Frame, []ConversionFailure, error) {
+	return FrameFromJSONWithOptions(result, JSONOptions{})
+}
+
+// JSONOptions configure FrameFromJSONWithOptions. The zero value is what
+// FrameFromJSON uses.
+type JSONOptions struct {
+	// MaxCellBytes cuts text values longer than it with TruncateCell as
+	// they are copied into the frame, recorded as AdjustCellTruncated; zero
+	// keeps them whole.
+	MaxCellBytes int
+	// Deprecated: a result without rows always gets one empty field per
+	// column (see FrameFromJSON); EmptyColumns is ignored.
+	EmptyColumns bool
+	// TimeColumns names the columns that hold time even when their values
+	// don't say so: strings in any layout the converter knows, or numeric
+	// epochs. Nil means DefaultTimeColumns; empty names none.
+	TimeColumns []string
+}
+
+// DefaultTimeColumns is what JSONOptions.TimeColumns names when nil.
+var DefaultTimeColumns = []string{"time", "timestamp", "_time"}
+
+// isTimeColumn reports whether name is one of opts' time columns.
+func (opts JSONOptions) isTimeColumn(name string) bool {
+	if opts.TimeColumns == nil {
+		return slices.Contains(DefaultTimeColumns, name)
+	}
+	return slices.Contains(opts.TimeColumns, name)
+}
+
+// FrameFromJSONWithOptions is FrameFromJSON configured by opts.
+func FrameFromJSONWithOptions(result map[string]interface{}, opts JSONOptions) (*data.Frame, []ConversionFailure, error) {
+	return resultSetOf(result).Frame(opts)
+}
+
+// Frame converts the result set to a frame, as FrameFromJSONWithOptions
+// does a decoded one. Each field is built from its column in one pass, its
+// values backed by a single array rather than one allocation per row.
+func (rs *JSONResultSet) Frame(opts JSONOptions) (*data.Frame, []ConversionFailure, error) {
+	if err := rs.reportedError(); err != nil {
+		return nil, nil, err
+	}
+	// Extract column names from Arc response
+	// Arc returns: {"columns": ["col1", "col2", ...], "data": [[row1], [row2], ...], "rows": N}
+	if !rs.hasColumns {
+		return nil, nil, fmt.Errorf("missing 'columns' field in response")
+	}
+
+	columnsSlice, ok := rs.columns.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid columns format")
+	}
+
+	columnNames := make([]string, len(columnsSlice))
+	for i, col := range columnsSlice {
+		name, ok := col.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid column name at index %d: expected string, got %T", i, col)
+		}
+		columnNames[i] = name
+	}
+	columnTypes := jsonColumnTypes(rs.types, len(columnNames))
+
+	if !rs.hasData {
+		return nil, nil, fmt.Errorf("missing 'data' field in response")
+	}
+	if rs.dataErr != nil {
+		return nil, nil, rs.dataErr
+	}
+
+	if rs.rows == 0 {
+		// Arc still names the columns: the frame keeps them, as an Arrow
+		// stream's schema does, so a table shows its headers and an alert
+		// rule sees the schema.
+		fields := make([]*data.Field, len(columnNames))
+		for i, name := range columnNames {
+			fieldType := data.FieldTypeNullableString
+			if columnTypes != nil {
+				fieldType = DeclaredFieldType(columnTypes[i])
+			} else if opts.isTimeColumn(name) {
+				fieldType = data.FieldTypeNullableTime
+			}
+			fields[i] = data.NewFieldFromFieldType(fieldType, 0)
+			fields[i].Name = name
+		}
+		frame := data.NewFrame("", fields...)
+		noteColumnRoles(frame, jsonColumnRoles(rs.columnMeta, columnNames))
+		return frame, nil, nil
+	}
+
+	// The first row decides the number of columns.
+	numCols := len(rs.cells)
+	numRows := rs.rows
+	if numCols > len(columnNames) {
+		return nil, nil, fmt.Errorf("rows have %d values, but the response names %d columns", numCols, len(columnNames))
+	}
+
+	log.DefaultLogger.Debug("Parsing JSON response",
+		"numColumns", numCols,
+		"numRows", numRows,
+	)
+
+	// Create fields for each column
+
+	fields := make([]*data.Field, numCols)
+	var failures []ConversionFailure
+	var mods []Adjustment // recorded on the frame, see Adjustments
+
+	for colIdx := 0; colIdx < numCols; colIdx++ {
+		colName := columnNames[colIdx]
+		col := &rs.cells[colIdx]
+
+		// Infer type from first non-null value
+		var fieldType data.FieldType
+		var sample jsonCell
+		for rowIdx := 0; rowIdx < numRows; rowIdx++ {
+			if cell := col.at(rowIdx); cell.kind != jsonNull {
+				sample = cell
+				break
+			}
+		}
+
+		// Determine field type: Arc's declared column type when the response
+		// carries one that agrees with the JSON value, else inferred from it.
+		fieldType, hinted := arcTypeHint(columnTypes, colIdx, sample.value())
+		if sample.kind == jsonNull && columnTypes != nil {
+			// All NULL: nothing to infer from, so the declared type decides
+			// and an empty DOUBLE column stays numeric.
+			fieldType, hinted = DeclaredFieldType(columnTypes[colIdx]), true
+		}
+		if !hinted {
+			// The column's type is that of most of its values, and the
+			// others are conversion failures. Without a majority (numbers
+			// and text alike) every value keeps its string form.
+			if main, ok := majorityCell(col, numRows); !ok {
+				fieldType = data.FieldTypeNullableString
+			} else {
+				sample = main
+			}
+		}
+		if !hinted && fieldType == data.FieldTypeUnknown {
+			switch sample.kind {
+			case jsonNumber:
+				fieldType = data.FieldTypeNullableFloat64
+				// to_timestamp() (the $__timeGroup expansion) comes back as a
+				// float epoch from some Arc versions' JSON endpoint.
+				if opts.isTimeColumn(colName) && plausibleEpochColumn(col, numRows) {
+					fieldType = data.FieldTypeNullableTime
+				}
+			case jsonString:
+				// A time column, or a value in one of timestampLayouts:
+				// Arc sends "2025-10-28T16:03:25.431000".
+				if opts.isTimeColumn(colName) || timestampLayout(sample.str) != "" {
+					fieldType = data.FieldTypeNullableTime
+				} else {
+					fieldType = data.FieldTypeNullableString
+				}
+			case jsonBool:
+				fieldType = data.FieldTypeNullableBool
+			default:
+				fieldType = data.FieldTypeNullableString
+			}
+		}
+
+		// Integers past 2^53 would round in a float64: a column of them
+		// becomes int64 (snowflake IDs), or in a time-named column, epoch
+		// nanoseconds converted exactly.
+		var int64s []*int64
+		if fieldType == data.FieldTypeNullableFloat64 && (columnTypes == nil || !isFloatType(columnTypes[colIdx]) && !isIntervalType(columnTypes[colIdx])) {
+			if values, ok := int64Column(col, numRows); ok {
+				fieldType, int64s = data.FieldTypeNullableInt64, values
+				if opts.isTimeColumn(colName) && plausibleEpochColumn(col, numRows) {
+					fieldType = data.FieldTypeNullableTime
+				}
+			}
+		}
+
+		// Create field based on type
+		switch fieldType {
+		case data.FieldTypeNullableInt64:
+			fields[colIdx] = data.NewField(colName, nil, int64s)
+
+		case data.FieldTypeNullableFloat64:
+			// An INTERVAL column hinted to float64 holds seconds decoded
+			// from its text or object form, as the Arrow path does.
+			interval := hinted && isIntervalType(columnTypes[colIdx])
+			values, backing := make([]*float64, numRows), make([]float64, numRows)
+			failure := ConversionFailure{Column: colName, Kind: "numbers"}
+			rounded, months := 0, 0
+			for rowIdx := 0; rowIdx < numRows; rowIdx++ {
+				cell := col.at(rowIdx)
+				if cell.kind == jsonNull {
+					continue
+				}
+				v, ok := cell.num, cell.kind == jsonNumber
+				if interval {
+					iv := cell.value()
+					if jsonIntervalHasMonths(iv) {
+						months++
+					}
+					v, ok = parseJSONInterval(iv)
+				} else if ok && jsonIntegerMayBeRounded(v) {
+					rounded++
+				}
+				if !ok {
+					if failure.Count == 0 {
+						failure.FirstBadValue = previewBadValue(cell.value())
+					}
+					failure.Count++
+					continue
+				}
+				backing[rowIdx] = v
+				values[rowIdx] = &backing[rowIdx]
+			}
+			if failure.Count > 0 {
+				log.DefaultLogger.Warn("numeric column had non-float64 rows",
+					"col", colName, "mismatches", failure.Count, "total", numRows)
+				failures = append(failures, failure)
+			}
+			mods = append(mods,
+				Adjustment{Kind: AdjustIntegerRounding, Column: colName, Count: rounded},
+				Adjustment{Kind: AdjustIntervalMonths, Column: colName, Count: months})
+			fields[colIdx] = data.NewField(colName, nil, values)
+			if interval {
+				fields[colIdx].Config = &data.FieldConfig{Unit: DurationUnit}
+			}
+
+		case data.FieldTypeNullableTime:
+			// Detect the string format once on the first sample so we don't
+			// retry every layout per row on big result sets.
+			detectedLayout := ""
+			if sample.kind == jsonString {
+				detectedLayout = timestampLayout(sample.str)
+			}
+			values, backing := make([]*time.Time, numRows), make([]time.Time, numRows)
+			failure := ConversionFailure{Column: colName, Kind: "timestamps"}
+			epochs := 0
+			malformed := false // a failing value that still looks like a date
+			for rowIdx := 0; rowIdx < numRows; rowIdx++ {
+				cell := col.at(rowIdx)
+				if cell.kind == jsonNull {
+					continue
+				}
+				t, ok := parseJSONTimestamp(cell, detectedLayout)
+				if !ok {
+					if failure.Count == 0 {
+						failure.FirstBadValue = previewBadValue(cell.value())
+					}
+					failure.Count++
+					malformed = malformed || cell.kind == jsonString && dateShapeRe.MatchString(cell.str)
+					continue
+				}
+				if cell.kind == jsonNumber {
+					epochs++ // unit inferred from magnitude, see EpochToTime
+				}
+				backing[rowIdx] = t
+				values[rowIdx] = &backing[rowIdx]
+			}
+			if failure.Count > 0 && !malformed && !hinted && !opts.isTimeColumn(colName) {
+				// Only some values said time: the column is text that
+				// sometimes looks like a timestamp. A malformed date
+				// ("2025-13-40") keeps the column a time column and is
+				// reported as a failure.
+				var truncated int
+				fields[colIdx], truncated = jsonStringField(colName, col, numRows, opts.MaxCellBytes)
+				mods = append(mods, Adjustment{Kind: AdjustCellTruncated, Column: colName, Count: truncated})
+				break
+			}
+			if failure.Count > 0 {
+				// Summary log (one line per column) instead of one-line-per-row
+				// spam. A 100k-row response with a corrupted column previously
+				// emitted 100k warn lines.
+				log.DefaultLogger.Warn("timestamp column had unparseable rows",
+					"col", colName, "failures", failure.Count, "total", numRows)
+				failures = append(failures, failure)
+			}
+			mods = append(mods, Adjustment{Kind: AdjustEpochUnit, Column: colName, Count: epochs})
+			fields[colIdx] = data.NewField(colName, nil, values)
+
+		case data.FieldTypeNullableString:
+			var truncated int
+			fields[colIdx], truncated = jsonStringField(colName, col, numRows, opts.MaxCellBytes)
+			mods = append(mods, Adjustment{Kind: AdjustCellTruncated, Column: colName, Count: truncated})
+
+		case data.FieldTypeNullableBool:
+			values, backing := make([]*bool, numRows), make([]bool, numRows)
+			failure := ConversionFailure{Column: colName, Kind: "booleans"}
+			for rowIdx := 0; rowIdx < numRows; rowIdx++ {
+				cell := col.at(rowIdx)
+				if cell.kind == jsonNull {
+					continue
+				}
+				if cell.kind != jsonBool {
+					if failure.Count == 0 {
+						failure.FirstBadValue = previewBadValue(cell.value())
+					}
+					failure.Count++
+					continue
+				}
+				backing[rowIdx] = cell.num != 0
+				values[rowIdx] = &backing[rowIdx]
+			}
+			if failure.Count > 0 {
+				log.DefaultLogger.Warn("boolean column had non-bool rows",
+					"col", colName, "mismatches", failure.Count, "total", numRows)
+				failures = append(failures, failure)
+			}
+			fields[colIdx] = data.NewField(colName, nil, values)
+		}
+	}
+
+	frame := data.NewFrame("", fields...)
+	for _, m := range mods {
+		noteAdjustment(frame, m.Kind, m.Column, m.Count)
+	}
+	noteColumnRoles(frame, jsonColumnRoles(rs.columnMeta, columnNames))
+
+	log.DefaultLogger.Debug("Created frame from JSON",
+		"fields", len(frame.Fields),
+		"rows", frame.Rows(),
+	)
+
+	return frame, failures, nil
+}
+
+// jsonStringField builds a string field from col, numbers as JavaScript
+// prints them and other values formatted, and returns it with how many values
+// TruncateCell cut.
+func jsonStringField(name string, col *jsonColumn, rows, maxCellBytes int) (*data.Field, int) {
+	values, backing := make([]*string, rows), make([]string, rows)
+	truncated := 0
+	for i := 0; i < rows; i++ {
+		cell := col.at(i)
+		if cell.kind == jsonNull {
+			continue
+		}
+		// The inferred column type is string, so the common case avoids
+		// formatting.
+		str := cell.str
+		switch {
+		case cell.kind == jsonNumber && str == "": // else the digits of an integer past 2^53
+			// As JavaScript prints it: an ID stays 123456789012, not 1.23456789012e+11.
+			switch {
+			case math.IsInf(cell.num, 1):
+				str = "Infinity"
+			case math.IsInf(cell.num, -1):
+				str = "-Infinity"
+			case math.Abs(cell.num) < 1e21:
+				str = strconv.FormatFloat(cell.num, 'f', -1, 64) // NaN too
+			default:
+				str = strconv.FormatFloat(cell.num, 'g', -1, 64)
+			}
+		case cell.kind != jsonString && cell.kind != jsonNumber:
+			str = fmt.Sprintf("%v", cell.value())
+		}
+		if cut, ok := TruncateCell(str, maxCellBytes); ok {
+			str = cut
+			truncated++
+		}
+		backing[i] = str
+		values[i] = &backing[i]
+	}
+	return data.NewField(name, nil, values), truncated
+}
+
+// majorityCell returns the first non-null cell of the JSON type more than
+// half of col's non-null rows hold; ok is false when no type does.
+func majorityCell(col *jsonColumn, rows int) (cell jsonCell, ok bool) {
+	var counts [jsonOther + 1]int
+	var first [jsonOther + 1]jsonCell
+	nonNull := 0
+	for i := 0; i < rows; i++ {
+		c := col.at(i)
+		if c.kind == jsonNull {
+			continue
+		}
+		if counts[c.kind] == 0 {
+			first[c.kind] = c
+		}
+		counts[c.kind]++
+		nonNull++
+	}
+	if nonNull == 0 {
+		return jsonCell{}, true
+	}
+	for kind, n := range counts {
+		if 2*n > nonNull {
+			return first[kind], true
+		}
+	}
+	return jsonCell{}, false
+}
+
+// timestampLayouts is the ordered list of Go time layouts the JSON decoder
+// will try when inferring a timestamp column's string format. The first
+// matching layout for the first non-null sample is cached and used for
+// every subsequent row — eliminating a time.Parse attempt per layout per
+// row. Fractional seconds parse with any of them. Values without an offset
+// are UTC.
+var timestampLayouts = []string{
+	time.RFC3339,                 // offset or Z
+	"2006-01-02T15:04:05.000000", // Arc-emitted microsecond precision
+	"2006-01-02T15:04:05",        // No timezone
+	"2006-01-02 15:04:05Z07:00",  // SQL style, offset or Z
+	"2006-01-02 15:04:05-07",     // DuckDB's TIMESTAMPTZ text: +00
+	"2006-01-02 15:04:05",        // SQL style, no timezone
+	time.DateOnly,                // DATE
+}
+
+// dateShapeRe matches text that starts like a date, which a timestamp
+// column's malformed values still do.
+var dateShapeRe = regexp.MustCompile(`^\d{4}-\d{1,2}-\d{1,2}`)
+
+// timestampLayout returns the first of timestampLayouts s parses with,
+// "" when none.
+func timestampLayout(s string) string {
+	for _, layout := range timestampLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return layout
+		}
+	}
+	return ""
+}
+
+// parseJSONTimestamp converts a cell to time.Time using the detectedLayout
+// for strings (or trying every layout if detection failed for this
+// column). Numbers are epochs in the unit their magnitude implies (see
+// EpochToTime).
+func parseJSONTimestamp(cell jsonCell, detectedLayout string) (time.Time, bool) {
+	switch cell.kind {
+	case jsonString:
+		if detectedLayout != "" {
+			if t, err := time.Parse(detectedLayout, cell.str); err == nil {
+				return t, true
+			}
+		}
+		// Fallback path when detection didn't latch (mixed-format column).
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, cell.str); err == nil {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	case jsonNumber:
+		if cell.str != "" {
+			if n, ok := cell.int64(); ok {
+				return epochIntToTime(n), true
+			}
+		}
+		if math.IsNaN(cell.num) || math.IsInf(cell.num, 0) {
+			return time.Time{}, false
+		}
+		return EpochToTime(cell.num), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// int64Column returns col's rows as int64s when every non-null value is an
+// exact integer and at least one is past 2^53, so that only an int64 field
+// keeps them; ok is false for any other column, which stays float64.
+func int64Column(col *jsonColumn, rows int) ([]*int64, bool) {
+	big := false
+	for i := 0; i < rows; i++ {
+		cell := col.at(i)
+		if cell.kind == jsonNull {
+			continue
+		}
+		if _, ok := cell.int64(); !ok {
+			return nil, false
+		}
+		big = big || cell.str != ""
+	}
+	if !big {
+		return nil, false
+	}
+	values, backing := make([]*int64, rows), make([]int64, rows)
+	for i := 0; i < rows; i++ {
+		if cell := col.at(i); cell.kind != jsonNull {
+			backing[i], _ = cell.int64()
+			values[i] = &backing[i]
+		}
+	}
+	return values, true
+}
+
+// isFloatType reports whether Arc declared a column as a floating-point or
+// decimal type, which stays float64 whatever its values look like.
+func isFloatType(t string) bool {
+	return t == "DOUBLE" || t == "FLOAT" || t == "REAL" || strings.HasPrefix(t, "DECIMAL")
+}
+
+// plausibleEpochColumn reports whether every non-null value of col's rows
+// is a number that reads as a timestamp in the plausible range.
+func plausibleEpochColumn(col *jsonColumn, rows int) bool {
+	for i := 0; i < rows; i++ {
+		cell := col.at(i)
+		if cell.kind == jsonNull {
+			continue
+		}
+		if cell.kind != jsonNumber || math.IsNaN(cell.num) || math.IsInf(cell.num, 0) {
+			return false
+		}
+		if !plausibleEpoch(EpochToTime(cell.num)) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonColumnTypes returns the column types Arc declares in a JSON result's
+// "types" array (DuckDB type names, parallel to "columns"), or nil when the
+// array is absent or doesn't line up with the columns.
+func jsonColumnTypes(declared interface{}, numCols int) []string {
+	raw, ok := declared.([]interface{})
+	if !ok || len(raw) != numCols {
+		return nil
+	}
+	types := make([]string, numCols)
+	for i, t := range raw {
+		name, ok := t.(string)
+		if !ok {
+			return nil
+		}
+		types[i] = strings.ToUpper(strings.TrimSpace(name))
+	}
+	return types
+}
+
+// arcTypeHint maps Arc's declared type for column colIdx to a field type.
+// The hint only applies when the JSON value agrees with it — a DECIMAL
+// serialized as a string stays a string rather than failing every row —
+// and types the decoder has no better field for (VARCHAR, LIST, ...) fall
+// back to inference. INTERVAL columns become float64 seconds, like the
+// Arrow path's (see parseJSONInterval).
+func arcTypeHint(types []string, colIdx int, sample interface{}) (data.FieldType, bool) {
+	if types == nil || sample == nil {
+		return data.FieldTypeUnknown, false
+	}
+	t := types[colIdx]
+	if isIntervalType(t) {
+		if _, ok := parseJSONInterval(sample); ok {
+			return data.FieldTypeNullableFloat64, true
+		}
+		return data.FieldTypeUnknown, false
+	}
+	switch sample.(type) {
+	case string, float64:
+		if strings.HasPrefix(t, "TIMESTAMP") {
+			return data.FieldTypeNullableTime, true
+		}
+	}
+	switch sample.(type) {
+	case float64:
+		if arcNumericTypes[t] || strings.HasPrefix(t, "DECIMAL") {
+			return data.FieldTypeNullableFloat64, true
+		}
+	case bool:
+		if t == "BOOLEAN" {
+			return data.FieldTypeNullableBool, true
+		}
+	}
+	return data.FieldTypeUnknown, false
+}
+
+// DeclaredFieldType is the field type for a column Arc declared as t, with
+// no values to go by: the type arcTypeHint gives values that agree with t,
+// nullable string for anything else (including an undeclared type).
+func DeclaredFieldType(t string) data.FieldType {
+	t = strings.ToUpper(strings.TrimSpace(t))
+	switch {
+	case strings.HasPrefix(t, "TIMESTAMP"):
+		return data.FieldTypeNullableTime
+	case isIntervalType(t), arcNumericTypes[t], strings.HasPrefix(t, "DECIMAL"):
+		return data.FieldTypeNullableFloat64
+	case t == "BOOLEAN":
+		return data.FieldTypeNullableBool
+	}
+	return data.FieldTypeNullableString
+}
+
+// arcNumericTypes are the DuckDB numeric type names decoded as float64.
+var arcNumericTypes = map[string]bool{
+	"DOUBLE": true, "FLOAT": true, "REAL": true,
+	"TINYINT": true, "SMALLINT": true, "INTEGER": true, "BIGINT": true, "HUGEINT": true,
+	"UTINYINT": true, "USMALLINT": true, "UINTEGER": true, "UBIGINT": true, "UHUGEINT": true,
+}
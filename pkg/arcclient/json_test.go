@@ -0,0 +1,675 @@
+package arcclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func decodeJSON(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestFrameFromJSON_AdjustmentsAndFailures(t *testing.T) {
+	result := decodeJSON(t, `{
+		"columns": ["time", "value"],
+		"types": ["TIMESTAMP", "DOUBLE"],
+		"data": [[1772323200, 1.5], [1772323260, "n/a"], [1772323320, 2]]
+	}`)
+	frame, failures, err := FrameFromJSON(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Rows() != 3 {
+		t.Fatalf("rows = %d, want 3", frame.Rows())
+	}
+	if got := frame.Fields[0].At(0).(*time.Time); !got.Equal(time.Unix(1772323200, 0)) {
+		t.Errorf("time[0] = %v", got)
+	}
+	if v, ok := frame.Fields[1].ConcreteAt(1); ok {
+		t.Errorf("value[1] = %v, want null", v)
+	}
+
+	wantFailures := []ConversionFailure{{Column: "value", Kind: "numbers", Count: 1, FirstBadValue: "n/a"}}
+	if !reflect.DeepEqual(failures, wantFailures) {
+		t.Errorf("failures = %+v, want %+v", failures, wantFailures)
+	}
+	wantAdjustments := []Adjustment{{Kind: AdjustEpochUnit, Column: "time", Count: 3}}
+	if got := Adjustments(frame); !reflect.DeepEqual(got, wantAdjustments) {
+		t.Errorf("Adjustments = %+v, want %+v", got, wantAdjustments)
+	}
+
+	AttachConversionFailures(frame, failures)
+	if got := ConversionFailures(frame); !reflect.DeepEqual(got, wantFailures) {
+		t.Errorf("ConversionFailures = %+v, want %+v", got, wantFailures)
+	}
+	if len(frame.Meta.Notices) != 1 {
+		t.Errorf("notices = %+v, want one", frame.Meta.Notices)
+	}
+}
+
+func TestJSONResultSets(t *testing.T) {
+	single := decodeJSON(t, `{"columns": ["a"], "data": [[1]]}`)
+	sets, err := JSONResultSets(single)
+	if err != nil || len(sets) != 1 || !reflect.DeepEqual(sets[0], single) {
+		t.Errorf("single result: %v, %v", sets, err)
+	}
+
+	multi := decodeJSON(t, `{"results": [
+		{"columns": ["a"], "data": [[1]]},
+		{"columns": ["b"], "data": [[2]]}
+	]}`)
+	sets, err = JSONResultSets(multi)
+	if err != nil || len(sets) != 2 {
+		t.Fatalf("multi result: %v, %v", sets, err)
+	}
+	if cols := sets[1]["columns"].([]interface{}); cols[0] != "b" {
+		t.Errorf("second result columns = %v", cols)
+	}
+}
+
+func TestTruncateCell(t *testing.T) {
+	cases := []struct {
+		s       string
+		max     int
+		want    string
+		wantCut bool
+	}{
+		{"hello", 5, "hello", false},
+		{"hello world", 5, "hello…", true},
+		{"héllo", 2, "h…", true}, // é is two bytes: cut before it, not inside
+		{"héllo", 3, "hé…", true},
+		{"hello", 0, "hello", false},
+	}
+	for _, c := range cases {
+		got, cut := TruncateCell(c.s, c.max)
+		if got != c.want || cut != c.wantCut {
+			t.Errorf("TruncateCell(%q, %d) = %q, %v; want %q, %v", c.s, c.max, got, cut, c.want, c.wantCut)
+		}
+	}
+}
+
+func TestFrameFromJSONWithOptions_MaxCellBytes(t *testing.T) {
+	result := decodeJSON(t, `{
+		"columns": ["host", "payload"],
+		"data": [["a", "0123456789abcdef"], ["b", null], ["c", "short"], ["d", {"k": "0123456789"}]]
+	}`)
+	frame, _, err := FrameFromJSONWithOptions(result, JSONOptions{MaxCellBytes: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for i := 0; i < frame.Rows(); i++ {
+		if v, ok := frame.Fields[1].ConcreteAt(i); ok {
+			got = append(got, v.(string))
+		}
+	}
+	if want := []string{"01234567…", "short", "map[k:01…"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payload = %q, want %q", got, want)
+	}
+	wantAdjustments := []Adjustment{{Kind: AdjustCellTruncated, Column: "payload", Count: 2}}
+	if got := Adjustments(frame); !reflect.DeepEqual(got, wantAdjustments) {
+		t.Errorf("Adjustments = %+v, want %+v", got, wantAdjustments)
+	}
+}
+
+// TestFrameFromJSONWithOptions_TimeColumns: a column named in TimeColumns
+// is a time field whether its values are text or epochs, and the default
+// names stop counting once the list is set.
+func TestFrameFromJSONWithOptions_TimeColumns(t *testing.T) {
+	result := decodeJSON(t, `{
+		"columns": ["created_at", "time", "ts"],
+		"data": [["2026/02/18 10:00", 1771408800, 1771408800000], [null, 1771408860, 1771408860000]]
+	}`)
+	for _, c := range []struct {
+		name    string
+		columns []string
+		want    []data.FieldType
+	}{
+		{"default", nil, []data.FieldType{data.FieldTypeNullableString, data.FieldTypeNullableTime, data.FieldTypeNullableFloat64}},
+		{"configured", []string{"created_at", "ts"}, []data.FieldType{data.FieldTypeNullableTime, data.FieldTypeNullableFloat64, data.FieldTypeNullableTime}},
+		{"none", []string{}, []data.FieldType{data.FieldTypeNullableString, data.FieldTypeNullableFloat64, data.FieldTypeNullableFloat64}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			frame, _, err := FrameFromJSONWithOptions(result, JSONOptions{TimeColumns: c.columns})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, f := range frame.Fields {
+				if f.Type() != c.want[i] {
+					t.Errorf("%s typed %s, want %s", f.Name, f.Type(), c.want[i])
+				}
+			}
+		})
+	}
+
+	// "2026/02/18 10:00" is no layout the converter knows: the configured
+	// time column keeps the field and reports the value.
+	frame, failures, err := FrameFromJSONWithOptions(result, JSONOptions{TimeColumns: []string{"created_at", "ts"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Column != "created_at" || failures[0].Count != 1 {
+		t.Errorf("failures = %+v, want the created_at value", failures)
+	}
+	if got, _ := frame.Fields[2].ConcreteAt(1); !got.(time.Time).Equal(time.UnixMilli(1771408860000)) {
+		t.Errorf("ts[1] = %v, want epoch milliseconds 1771408860000", got)
+	}
+}
+
+// TestFrameFromJSON_TimestampLayouts: each string layout Arc or DuckDB
+// print a timestamp or date in makes a time column, whatever its name.
+func TestFrameFromJSON_TimestampLayouts(t *testing.T) {
+	for _, c := range []struct {
+		value string
+		want  time.Time
+	}{
+		{"2026-02-18T10:00:00Z", time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)},
+		{"2026-02-18T12:00:00.5+02:00", time.Date(2026, 2, 18, 10, 0, 0, 5e8, time.UTC)},
+		{"2026-02-18T10:00:00.431000", time.Date(2026, 2, 18, 10, 0, 0, 431e6, time.UTC)},
+		{"2026-02-18T10:00:00", time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)},
+		{"2026-02-18 05:00:00-05:00", time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)},
+		{"2026-02-18 11:00:00+01", time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)},
+		{"2026-02-18 10:00:00.123456", time.Date(2026, 2, 18, 10, 0, 0, 123456e3, time.UTC)},
+		{"2026-02-18", time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC)},
+	} {
+		result := decodeJSON(t, `{"columns": ["created_at"], "data": [["`+c.value+`"]]}`)
+		frame, failures, err := FrameFromJSON(result)
+		if err != nil || len(failures) > 0 {
+			t.Fatalf("%s: %v, failures %+v", c.value, err, failures)
+		}
+		f := frame.Fields[0]
+		if f.Type() != data.FieldTypeNullableTime {
+			t.Errorf("%s: typed %s, want time", c.value, f.Type())
+			continue
+		}
+		if got, _ := f.ConcreteAt(0); !got.(time.Time).Equal(c.want) {
+			t.Errorf("%s: got %v, want %v", c.value, got, c.want)
+		}
+	}
+}
+
+// TestFrameFromJSON_EmptyResultKeepsColumns: a result without rows is a
+// frame of empty fields named and typed like its columns.
+func TestFrameFromJSON_EmptyResultKeepsColumns(t *testing.T) {
+	result := decodeJSON(t, `{
+		"columns": ["time", "host", "value", "up", "took"],
+		"types": ["TIMESTAMP WITH TIME ZONE", "VARCHAR", "DOUBLE", "BOOLEAN", "INTERVAL"],
+		"data": []
+	}`)
+	frame, _, err := FrameFromJSON(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames := []string{"time", "host", "value", "up", "took"}
+	want := []data.FieldType{data.FieldTypeNullableTime, data.FieldTypeNullableString, data.FieldTypeNullableFloat64, data.FieldTypeNullableBool, data.FieldTypeNullableFloat64}
+	if len(frame.Fields) != len(want) || frame.Rows() != 0 {
+		t.Fatalf("got %d fields, %d rows", len(frame.Fields), frame.Rows())
+	}
+	for i, f := range frame.Fields {
+		if f.Name != wantNames[i] || f.Type() != want[i] {
+			t.Errorf("field %d: %q %s, want %q %s", i, f.Name, f.Type(), wantNames[i], want[i])
+		}
+	}
+
+	undeclared := `{"columns": ["time", "a"], "data": []}`
+	sets, err := ReadJSONResultSets(strings.NewReader(undeclared))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, _, err = sets[0].Frame(JSONOptions{})
+	if err != nil || len(frame.Fields) != 2 || frame.Fields[0].Name != "time" || frame.Fields[1].Name != "a" {
+		t.Fatalf("undeclared columns: %v, %v", frame, err)
+	}
+	if frame.Fields[0].Type() != data.FieldTypeNullableTime || frame.Fields[1].Type() != data.FieldTypeNullableString {
+		t.Errorf("undeclared column types: %s, %s", frame.Fields[0].Type(), frame.Fields[1].Type())
+	}
+}
+
+// TestFrameFromJSON_MixedColumns: an undeclared column whose values are
+// split between JSON types, no type holding most of them, becomes a string
+// field keeping every value, whatever its first value was. A column where
+// one type has the majority takes it and reports the rest as failures.
+func TestFrameFromJSON_MixedColumns(t *testing.T) {
+	body := `{
+		"columns": ["code", "reading", "flag", "when", "time", "count"],
+		"data": [
+			["A1", 2.5, true, "2026-03-01T00:00:00Z", "2026-03-01T00:00:00Z", 1],
+			[404, "n/a", 1, "yesterday", "later", 2],
+			["E42", 123456789012, 0, null, null, "n/a"],
+			[9223372036854775000, "high", false, "2026-03-01T00:02:00Z", "2026-03-01T00:02:00Z", 4]
+		]}`
+	want := map[string][]interface{}{
+		"code":    {"A1", "404", "E42", "9223372036854775000"},
+		"reading": {"2.5", "n/a", "123456789012", "high"},
+		"flag":    {"true", "1", "0", "false"},
+		"when":    {"2026-03-01T00:00:00Z", "yesterday", nil, "2026-03-01T00:02:00Z"},
+	}
+
+	sets, err := ReadJSONResultSets(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, convert := range map[string]func() (*data.Frame, []ConversionFailure, error){
+		"streamed": func() (*data.Frame, []ConversionFailure, error) { return sets[0].Frame(JSONOptions{}) },
+		"map":      func() (*data.Frame, []ConversionFailure, error) { return FrameFromJSON(decodeJSON(t, body)) },
+	} {
+		frame, failures, err := convert()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, f := range frame.Fields[:4] {
+			if f.Type() != data.FieldTypeNullableString {
+				t.Errorf("%s: field %q: type %s, want nullable string", name, f.Name, f.Type())
+				continue
+			}
+			for i, w := range want[f.Name] {
+				var got interface{}
+				if p := f.At(i).(*string); p != nil {
+					got = *p
+				}
+				if got != w {
+					t.Errorf("%s: %s[%d] = %v, want %v", name, f.Name, i, got, w)
+				}
+			}
+		}
+		// A time-named column stays time: its bad values are failures.
+		if frame.Fields[4].Type() != data.FieldTypeNullableTime {
+			t.Errorf("%s: time: type %s, want nullable time", name, frame.Fields[4].Type())
+		}
+		if typ := frame.Fields[5].Type(); typ != data.FieldTypeNullableFloat64 {
+			t.Errorf("%s: count: type %s, want nullable float64", name, typ)
+		}
+		wantFailures := []ConversionFailure{
+			{Column: "time", Kind: "timestamps", Count: 1, FirstBadValue: "later"},
+			{Column: "count", Kind: "numbers", Count: 1, FirstBadValue: "n/a"},
+		}
+		if !reflect.DeepEqual(failures, wantFailures) {
+			t.Errorf("%s: failures = %+v, want %+v", name, failures, wantFailures)
+		}
+	}
+}
+
+func TestFrameFromJSON_AllNullColumnTakesDeclaredType(t *testing.T) {
+	result := decodeJSON(t, `{
+		"columns": ["time", "host", "mem", "up"],
+		"types": ["TIMESTAMP", "VARCHAR", "DOUBLE", "BOOLEAN"],
+		"data": [["2026-03-01T00:00:00Z", "a", null, null], ["2026-03-01T00:01:00Z", "b", null, null]]
+	}`)
+	frame, _, err := FrameFromJSON(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []data.FieldType{data.FieldTypeNullableTime, data.FieldTypeNullableString, data.FieldTypeNullableFloat64, data.FieldTypeNullableBool}
+	for i, f := range frame.Fields {
+		if f.Type() != want[i] {
+			t.Errorf("field %q: type %s, want %s", f.Name, f.Type(), want[i])
+		}
+	}
+
+	undeclared := decodeJSON(t, `{"columns": ["mem"], "data": [[null]]}`)
+	if frame, _, _ := FrameFromJSON(undeclared); frame.Fields[0].Type() != data.FieldTypeNullableString {
+		t.Errorf("undeclared all-null column: type %s", frame.Fields[0].Type())
+	}
+}
+
+func TestFrameFromJSON_ColumnRoles(t *testing.T) {
+	cases := []struct {
+		name string
+		meta string
+		want map[string]ColumnRole
+	}{
+		{"by name", `[{"name": "host", "role": "dimension"}, {"name": "time", "role": "Timestamp"}, {"name": "value", "role": "measure"}]`,
+			map[string]ColumnRole{"time": RoleTimestamp, "host": RoleDimension, "value": RoleMeasure}},
+		{"by position", `["timestamp", {"role": "dimension"}, "measure"]`,
+			map[string]ColumnRole{"time": RoleTimestamp, "host": RoleDimension, "value": RoleMeasure}},
+		{"unknown roles and columns are ignored", `[{"name": "time", "role": "index"}, {"name": "nope", "role": "measure"}, {"name": "value", "role": "measure"}]`,
+			map[string]ColumnRole{"value": RoleMeasure}},
+		{"nothing known", `[{"name": "time", "role": "index"}]`, nil},
+		{"absent", ``, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			meta := ""
+			if c.meta != "" {
+				meta = `"columnMeta": ` + c.meta + `,`
+			}
+			for _, rows := range []string{`[["2026-01-01T00:00:00Z", "a", 1]]`, `[]`} {
+				result := decodeJSON(t, `{"columns": ["time", "host", "value"], `+meta+` "data": `+rows+`}`)
+				frame, _, err := FrameFromJSON(result)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ColumnRoles(frame); !reflect.DeepEqual(got, c.want) {
+					t.Errorf("rows %s: ColumnRoles = %v, want %v", rows, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+// TestReadJSONResultSets_MatchesFrameFromJSON: the streamed decoder gives
+// the frames decoding into a map does, whatever the cells hold.
+func TestReadJSONResultSets_MatchesFrameFromJSON(t *testing.T) {
+	for _, body := range []string{
+		`{"columns": ["time", "host", "value", "up", "note", "extra"],
+		  "types": ["TIMESTAMP", "VARCHAR", "DOUBLE", "BOOLEAN", "VARCHAR", "JSON"],
+		  "columnMeta": [{"name": "host", "role": "dimension"}],
+		  "data": [
+			["2026-03-01T00:00:00.000000", "h\u00e9 \"a\"", 1.5, true, "line\nbreak", {"k": [1, 2]}],
+			["2026-03-01T00:01:00.000000", "b", null, false, null, [1, "x"]],
+			[null, "c", 1e300, null, 42, null]
+		  ], "rows": 3}`,
+		`{"columns": ["time", "v"], "data": [[1772323200, "n/a"], [1772323260.5, 2]]}`,
+		`{"columns": ["age"], "types": ["INTERVAL"], "data": [["1 day 02:03:04.5"], [{"months": 14, "days": 0, "micros": 0}]]}`,
+		`{"columns": ["a"], "data": []}`,
+		`{"results": [{"columns": ["a"], "data": [[1]]}, {"data": [["x"]], "columns": ["b"]}]}`,
+	} {
+		sets, err := ReadJSONResultSets(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("ReadJSONResultSets(%s): %v", body, err)
+		}
+		decoded, err := JSONResultSets(decodeJSON(t, body))
+		if err != nil || len(decoded) != len(sets) {
+			t.Fatalf("JSONResultSets: %d sets, %v; streamed %d", len(decoded), err, len(sets))
+		}
+		for i := range sets {
+			for _, opts := range []JSONOptions{{}, {MaxCellBytes: 4}} {
+				want, wantFailures, wantErr := FrameFromJSONWithOptions(decoded[i], opts)
+				got, gotFailures, gotErr := sets[i].Frame(opts)
+				if (gotErr == nil) != (wantErr == nil) || !reflect.DeepEqual(gotFailures, wantFailures) {
+					t.Errorf("%s: streamed %v, %v; want %v, %v", body, gotFailures, gotErr, wantFailures, wantErr)
+					continue
+				}
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(want)
+				if !bytes.Equal(gotJSON, wantJSON) {
+					t.Errorf("%s:\nstreamed %s\nwant     %s", body, gotJSON, wantJSON)
+				}
+			}
+		}
+	}
+}
+
+// TestReadJSONResultSets_Int64Precision: integers past 2^53 reach the
+// frame exactly, as int64 values or as epoch-nanosecond times.
+func TestReadJSONResultSets_Int64Precision(t *testing.T) {
+	body := `{"columns": ["id", "time", "ratio", "mixed", "small"],
+	  "types": ["BIGINT", "BIGINT", "DOUBLE", "HUGEINT", "BIGINT"],
+	  "data": [
+		[9223372036854775000, 1772323200123456789, 9007199254740995, 9007199254740995, 1],
+		[null, 1772323260987654321, 1, 1.5, 2],
+		[-9223372036854775000, null, null, null, null]
+	  ]}`
+	sets, err := ReadJSONResultSets(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, _, err := sets[0].Frame(JSONOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []data.FieldType{data.FieldTypeNullableInt64, data.FieldTypeNullableTime, data.FieldTypeNullableFloat64, data.FieldTypeNullableFloat64, data.FieldTypeNullableFloat64}
+	for i, f := range frame.Fields {
+		if f.Type() != want[i] {
+			t.Errorf("field %q: type %s, want %s", f.Name, f.Type(), want[i])
+		}
+	}
+	id := frame.Fields[0]
+	if got := *id.At(0).(*int64); got != 9223372036854775000 {
+		t.Errorf("id[0] = %d, want 9223372036854775000", got)
+	}
+	if id.At(1).(*int64) != nil {
+		t.Errorf("id[1] = %d, want null", *id.At(1).(*int64))
+	}
+	if got := *id.At(2).(*int64); got != -9223372036854775000 {
+		t.Errorf("id[2] = %d, want -9223372036854775000", got)
+	}
+	if got := *frame.Fields[1].At(1).(*time.Time); !got.Equal(time.Unix(0, 1772323260987654321)) {
+		t.Errorf("time[1] = %v, want %v", got, time.Unix(0, 1772323260987654321))
+	}
+	wantAdjustments := []Adjustment{
+		{Kind: AdjustEpochUnit, Column: "time", Count: 2},
+		{Kind: AdjustIntegerRounding, Column: "ratio", Count: 1},
+		{Kind: AdjustIntegerRounding, Column: "mixed", Count: 1},
+	}
+	if got := Adjustments(frame); !reflect.DeepEqual(got, wantAdjustments) {
+		t.Errorf("Adjustments = %+v, want %+v", got, wantAdjustments)
+	}
+
+	// A map decoded with UseNumber keeps the digits too.
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := FrameFromJSON(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := decoded.Fields[0].At(0).(*int64); !ok || *got != 9223372036854775000 {
+		t.Errorf("UseNumber: id[0] = %v (%s)", decoded.Fields[0].At(0), decoded.Fields[0].Type())
+	}
+}
+
+func TestEpochIntToTime(t *testing.T) {
+	for _, n := range []int64{1772323200, 1772323200123, 1772323200123456, 1772323200123456789, -1772323200} {
+		if got, want := epochIntToTime(n), EpochToTime(float64(n)); !got.Truncate(time.Microsecond).Equal(want.Truncate(time.Microsecond)) {
+			t.Errorf("epochIntToTime(%d) = %v, EpochToTime = %v", n, got, want)
+		}
+	}
+	if got := epochIntToTime(math.MinInt64); !got.Equal(time.Unix(0, math.MinInt64)) {
+		t.Errorf("epochIntToTime(MinInt64) = %v", got)
+	}
+}
+
+// TestReadJSONResultSets_NonFinite: DuckDB's bare NaN and Infinity tokens
+// become non-finite floats instead of failing the response, in any chunking
+// of the body, and scientific notation keeps its range.
+func TestReadJSONResultSets_NonFinite(t *testing.T) {
+	body := `{"columns": ["v", "label", "time"], "types": ["DOUBLE", "VARCHAR", "TIMESTAMP"],
+	  "data": [
+		[NaN, "NaN", 1772323200],
+		[Infinity, "say \"NaN\" Infinity", NaN],
+		[-Infinity, "-Infinity", 1772323260],
+		[1e-300, "[NaN]", null],
+		[5e-324, "x", null],
+		[1.7976931348623157e308, "y", null],
+		[1e400, "z", null],
+		[-1E+400, "w", null],
+		[-1.5e-10, "\\", null]
+	  ]}`
+	want := []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1e-300, 5e-324, math.MaxFloat64, math.Inf(1), math.Inf(-1), -1.5e-10}
+	wantLabels := []string{"NaN", `say "NaN" Infinity`, "-Infinity", "[NaN]", "x", "y", "z", "w", `\`}
+
+	for name, r := range map[string]io.Reader{
+		"whole":    strings.NewReader(body),
+		"one byte": iotest.OneByteReader(strings.NewReader(body)),
+	} {
+		sets, err := ReadJSONResultSets(r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		frame, failures, err := sets[0].Frame(JSONOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i, w := range want {
+			got := *frame.Fields[0].At(i).(*float64)
+			if got != w && !(math.IsNaN(got) && math.IsNaN(w)) {
+				t.Errorf("%s: v[%d] = %v, want %v", name, i, got, w)
+			}
+			if label := *frame.Fields[1].At(i).(*string); label != wantLabels[i] {
+				t.Errorf("%s: label[%d] = %q, want %q", name, i, label, wantLabels[i])
+			}
+		}
+		// A NaN epoch is no time.
+		wantFailures := []ConversionFailure{{Column: "time", Kind: "timestamps", Count: 1, FirstBadValue: "NaN"}}
+		if !reflect.DeepEqual(failures, wantFailures) {
+			t.Errorf("%s: failures = %+v, want %+v", name, failures, wantFailures)
+		}
+		// MaxFloat64 is a whole number past 2^53: for all the decoder can
+		// tell, a rounded integer. The infinities aren't.
+		wantAdjustments := []Adjustment{
+			{Kind: AdjustIntegerRounding, Column: "v", Count: 1},
+			{Kind: AdjustEpochUnit, Column: "time", Count: 2},
+		}
+		if got := Adjustments(frame); !reflect.DeepEqual(got, wantAdjustments) {
+			t.Errorf("%s: Adjustments = %+v, want %+v", name, got, wantAdjustments)
+		}
+	}
+}
+
+// TestReadJSONResultSets_ReportedErrors: an error Arc puts in a 200
+// answer's body comes back as a *ResponseError before any conversion.
+func TestReadJSONResultSets_ReportedErrors(t *testing.T) {
+	for _, c := range []struct {
+		body     string
+		want     string // the ResponseError message, "" for none
+		sqlError bool
+	}{
+		{`{"error": "Binder Error: column foo not found"}`, "Binder Error: column foo not found", true},
+		{`{"error": "Parser Error: syntax error at or near \"FORM\""}`, `Parser Error: syntax error at or near "FORM"`, true},
+		{`{"error": "out of memory", "detail": "ignored"}`, "out of memory", false},
+		{`{"error": {"code": 7}}`, `{"code":7}`, false},
+		{`{"detail": "Internal Server Error"}`, "Internal Server Error", false},
+		{`{"message": "Catalog Error: Table with name cpu does not exist!"}`, "Catalog Error: Table with name cpu does not exist!", true},
+		{`{"results": [{"columns": ["a"], "data": [[1]]}, {"error": "Conversion Error: Could not convert string 'x' to INT32"}]}`, "Conversion Error: Could not convert string 'x' to INT32", true},
+		{`{"columns": ["a"], "data": [[1]], "error": null}`, "", false},
+		{`{"columns": ["a"], "data": [[1]], "message": "ok", "detail": ""}`, "", false},
+		{`{"columns": ["a"], "data": [[1]], "error": ""}`, "", false},
+	} {
+		_, err := ReadJSONResultSets(strings.NewReader(c.body))
+		var respErr *ResponseError
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", c.body, err)
+			}
+			continue
+		}
+		if !errors.As(err, &respErr) {
+			t.Errorf("%s: expected a *ResponseError, got %v", c.body, err)
+			continue
+		}
+		if respErr.Message != c.want || respErr.SQLError() != c.sqlError {
+			t.Errorf("%s: %q (SQL error %v), want %q (%v)", c.body, respErr.Message, respErr.SQLError(), c.want, c.sqlError)
+		}
+
+		// The map path and ResponseErrorOf agree.
+		if sets, err := JSONResultSets(decodeJSON(t, c.body)); err == nil && len(sets) == 1 {
+			if _, _, err := FrameFromJSON(sets[0]); !errors.As(err, &respErr) || respErr.Message != c.want {
+				t.Errorf("%s: FrameFromJSON error = %v", c.body, err)
+			}
+		}
+		if got := ResponseErrorOf([]byte(c.body)); !strings.HasPrefix(c.body, `{"results"`) && (got == nil || got.Message != c.want || string(got.Body) != c.body) {
+			t.Errorf("%s: ResponseErrorOf = %+v", c.body, got)
+		}
+	}
+	if got := ResponseErrorOf([]byte("<html>bad gateway</html>")); got != nil {
+		t.Errorf("ResponseErrorOf(html) = %+v, want nil", got)
+	}
+}
+
+func TestReadJSONResultSets_Errors(t *testing.T) {
+	for _, c := range []struct {
+		body     string
+		readErr  string // from ReadJSONResultSets
+		frameErr string // else from Frame
+	}{
+		{`{"columns": ["a"], "data": [[1], [2`, "unexpected EOF", ""},
+		{`[1, 2]`, "expected a JSON object, got array", ""},
+		{`{"results": {"columns": []}}`, "invalid 'results' format: expected array, got object", ""},
+		{`{"results": [1]}`, "invalid result at index 0: expected object, got number", ""},
+		{`{"columns": ["a"], "data": [[Nan]]}`, "invalid character 'N'", ""},
+		{`{"data": [[1]]}`, "", "missing 'columns' field"},
+		{`{"columns": ["a"]}`, "", "missing 'data' field"},
+		{`{"columns": "a", "data": []}`, "", "invalid columns format"},
+		{`{"columns": ["a"], "data": {"x": [1]}}`, "", "invalid data format"},
+		{`{"columns": ["a"], "data": [[1], "x", [2]]}`, "", "invalid row at index 1: expected array, got string"},
+		{`{"columns": ["a", "b"], "data": [[1, 2], [3]]}`, "", "row 1 has 1 columns, expected at least 2"},
+		{`{"columns": ["a"], "data": [[1, 2]]}`, "", "rows have 2 values, but the response names 1 columns"},
+	} {
+		sets, err := ReadJSONResultSets(strings.NewReader(c.body))
+		if c.readErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.readErr) {
+				t.Errorf("%s: ReadJSONResultSets error = %v, want %q", c.body, err, c.readErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReadJSONResultSets: %v", c.body, err)
+			continue
+		}
+		if _, _, err := sets[0].Frame(JSONOptions{}); err == nil || !strings.Contains(err.Error(), c.frameErr) {
+			t.Errorf("%s: Frame error = %v, want %q", c.body, err, c.frameErr)
+		}
+	}
+}
+
+// syntheticJSON is a JSON response of rows rows shaped like a typical Arc
+// result: a microsecond timestamp, two dimension strings and five numeric
+// columns, one of them all null.
+func syntheticJSON(rows int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"columns":["time","host","region","v0","v1","v2","n","empty"],` +
+		`"types":["TIMESTAMP","VARCHAR","VARCHAR","DOUBLE","DOUBLE","DOUBLE","BIGINT","DOUBLE"],"data":[`)
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `[%q,"host-%d","eu-west-1",%d.5,%g,%d.25,%d,null]`,
+			base.Add(time.Duration(i)*time.Second).Format("2006-01-02T15:04:05.000000"), i%100, i, float64(i)/7, i*3, i*11)
+	}
+	fmt.Fprintf(&b, `],"rows":%d}`, rows)
+	return b.Bytes()
+}
+
+// BenchmarkJSON compares decoding a 100k-row JSON response the old way,
+// into a map then FrameFromJSON, with ReadJSONResultSets.
+func BenchmarkJSON(b *testing.B) {
+	payload := syntheticJSON(100_000)
+	b.Run("map", func(b *testing.B) {
+		b.SetBytes(int64(len(payload)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var result map[string]interface{}
+			if err := json.NewDecoder(bytes.NewReader(payload)).Decode(&result); err != nil {
+				b.Fatal(err)
+			}
+			if _, _, err := FrameFromJSON(result); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.SetBytes(int64(len(payload)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sets, err := ReadJSONResultSets(bytes.NewReader(payload))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, _, err := sets[0].Frame(JSONOptions{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,585 @@
+package arcclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Streamed JSON decoding. Decoding a whole response into
+// map[string]interface{} boxes every value — each number a float64 on the
+// heap, each row a []interface{} — before the converter copies it again
+// into a field; a 500k-row result allocated gigabytes. ReadJSONResultSets
+// instead walks the response with a json.Decoder and decodes one row at a
+// time into a reused []json.RawMessage, storing each cell unboxed in its
+// column (jsonCell). The converter then builds each field from its column
+// in one pass.
+
+// JSONResultSet is one result set of an Arc JSON response, held column by
+// column as ReadJSONResultSets read it. Frame converts it.
+type JSONResultSet struct {
+	columns    interface{} // "columns" as decoded; checked by Frame
+	types      interface{} // "types", see jsonColumnTypes
+	columnMeta interface{} // "columnMeta", see jsonColumnRoles
+	hasColumns bool
+	hasData    bool
+	dataErr    error          // a "data" array Frame can't convert, found while reading it
+	reported   [3]interface{} // "error", "detail" and "message", see reportedError
+	cells      []jsonColumn   // as many columns as the first row has
+	rows       int
+}
+
+// jsonColumnBlock is how many cells a jsonColumn block holds.
+const jsonColumnBlock = 4096
+
+// jsonColumn is a column's cells, in fixed-size blocks: growing it never
+// copies the cells it holds, which for a large result would allocate
+// several times the column's size.
+type jsonColumn struct {
+	blocks [][]jsonCell
+}
+
+func (c *jsonColumn) append(cell jsonCell) {
+	if n := len(c.blocks); n == 0 || len(c.blocks[n-1]) == jsonColumnBlock {
+		c.blocks = append(c.blocks, make([]jsonCell, 0, jsonColumnBlock))
+	}
+	last := &c.blocks[len(c.blocks)-1]
+	*last = append(*last, cell)
+}
+
+// at returns row i's cell.
+func (c *jsonColumn) at(i int) jsonCell {
+	return c.blocks[i/jsonColumnBlock][i%jsonColumnBlock]
+}
+
+// jsonKind is the JSON type of a cell.
+type jsonKind uint8
+
+const (
+	jsonNull jsonKind = iota
+	jsonNumber
+	jsonString
+	jsonBool
+	jsonOther // an object or array, kept as its JSON text
+)
+
+// jsonCell is one value of a JSON result, unboxed: a number, or a bool as
+// 1 or 0, in num; a string, or an object or array's JSON text, in str. An
+// integer past 2^53, which num can only hold rounded, also keeps its digits
+// in str (see jsonCell.int64).
+type jsonCell struct {
+	str  string
+	num  float64
+	kind jsonKind
+}
+
+// value returns the cell as encoding/json decodes a value into
+// interface{}, for the paths that take any value: INTERVAL objects, a
+// string column's other values, bad-value previews.
+func (c jsonCell) value() interface{} {
+	switch c.kind {
+	case jsonNumber:
+		return c.num
+	case jsonString:
+		return c.str
+	case jsonBool:
+		return c.num != 0
+	case jsonOther:
+		var v interface{}
+		if err := json.Unmarshal([]byte(c.str), &v); err == nil {
+			return v
+		}
+		return c.str
+	}
+	return nil
+}
+
+// int64 returns a number cell's exact integer value, and whether it has
+// one: an integer past 2^53 from its digits, one up to 2^53 from num.
+func (c jsonCell) int64() (int64, bool) {
+	if c.kind != jsonNumber {
+		return 0, false
+	}
+	if c.str != "" {
+		n, err := strconv.ParseInt(c.str, 10, 64)
+		return n, err == nil
+	}
+	if math.Abs(c.num) > maxExactFloatInt || c.num != math.Trunc(c.num) {
+		return 0, false
+	}
+	return int64(c.num), true
+}
+
+// cellOf converts a value decoded into interface{} to a cell, for
+// FrameFromJSON's decoded maps.
+func cellOf(v interface{}) jsonCell {
+	switch x := v.(type) {
+	case nil:
+		return jsonCell{}
+	case float64:
+		return jsonCell{num: x, kind: jsonNumber}
+	case string:
+		return jsonCell{str: x, kind: jsonString}
+	case bool:
+		if x {
+			return jsonCell{num: 1, kind: jsonBool}
+		}
+		return jsonCell{kind: jsonBool}
+	case json.Number:
+		if cell, err := parseJSONNumber([]byte(x)); err == nil {
+			return cell
+		}
+		return jsonCell{str: x.String(), kind: jsonString}
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return jsonCell{str: fmt.Sprintf("%v", v), kind: jsonString}
+	}
+	return jsonCell{str: string(raw), kind: jsonOther}
+}
+
+// parseJSONCell reads one raw JSON value into a cell.
+func parseJSONCell(raw []byte) (jsonCell, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return jsonCell{}, errors.New("empty value")
+	}
+	switch raw[0] {
+	case 'n':
+		return jsonCell{}, nil
+	case 't':
+		return jsonCell{num: 1, kind: jsonBool}, nil
+	case 'f':
+		return jsonCell{kind: jsonBool}, nil
+	case '"':
+		if raw[1] == '\\' {
+			if f, ok := nonFiniteSentinels[string(raw)]; ok {
+				return jsonCell{num: f, kind: jsonNumber}, nil
+			}
+		}
+		s, err := decodeJSONString(raw)
+		return jsonCell{str: s, kind: jsonString}, err
+	case '{', '[':
+		return jsonCell{str: string(raw), kind: jsonOther}, nil
+	}
+	return parseJSONNumber(raw)
+}
+
+// parseJSONNumber reads a JSON number into a cell, keeping the digits of an
+// integer literal past 2^53.
+func parseJSONNumber(raw []byte) (jsonCell, error) {
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return jsonCell{}, fmt.Errorf("invalid number %s", raw)
+	}
+	// Out of range (1e400) is ±Inf, as DuckDB's DOUBLE has it; too small to
+	// represent is 0.
+	cell := jsonCell{num: f, kind: jsonNumber}
+	if math.Abs(f) > maxExactFloatInt && !bytes.ContainsAny(raw, ".eE") {
+		cell.str = string(raw)
+	}
+	return cell, nil
+}
+
+// decodeJSONString unquotes a JSON string, copying it straight out of raw
+// when it holds no escapes, control characters or invalid UTF-8 — the
+// common case — and through encoding/json otherwise.
+func decodeJSONString(raw []byte) (string, error) {
+	inner := raw[1 : len(raw)-1]
+	plain := true
+	for _, b := range inner {
+		if b == '\\' || b < 0x20 {
+			plain = false
+			break
+		}
+	}
+	if plain && utf8.Valid(inner) {
+		return string(inner), nil
+	}
+	var s string
+	err := json.Unmarshal(raw, &s)
+	return s, err
+}
+
+// ReadJSONResultSets reads an Arc JSON response from r, a single result
+// set or the multi-statement `{"results": [...]}` shape (see
+// JSONResultSets), decoding rows as they stream in. The NaN, Infinity and
+// -Infinity tokens DuckDB writes for non-finite floats are read as
+// numbers. Errors are the body's or malformed JSON; what a result set
+// holds is checked when Frame converts it.
+func ReadJSONResultSets(r io.Reader) ([]*JSONResultSet, error) {
+	dec := json.NewDecoder(newNonFiniteReader(r))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object, got %s", tokenKind(tok))
+	}
+	top := &JSONResultSet{}
+	var results []*JSONResultSet
+	multi := false
+	for dec.More() {
+		key, err := objectKey(dec)
+		if err != nil {
+			return nil, err
+		}
+		if key != "results" {
+			if err := top.readField(dec, key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		multi = true
+		if results, err = readResultList(dec); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dec.Token(); err != nil { // the closing brace
+		return nil, err
+	}
+	if err := top.reportedError(); err != nil {
+		return nil, err
+	}
+	if multi {
+		for i, set := range results {
+			if err := set.reportedError(); err != nil {
+				return nil, fmt.Errorf("result %d: %w", i+1, err)
+			}
+		}
+		return results, nil
+	}
+	return []*JSONResultSet{top}, nil
+}
+
+// readResultList reads the "results" array of a multi-result response.
+func readResultList(dec *json.Decoder) ([]*JSONResultSet, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("invalid 'results' format: expected array, got %s", tokenKind(tok))
+	}
+	var sets []*JSONResultSet
+	for i := 0; dec.More(); i++ {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok != json.Delim('{') {
+			return nil, fmt.Errorf("invalid result at index %d: expected object, got %s", i, tokenKind(tok))
+		}
+		set := &JSONResultSet{}
+		for dec.More() {
+			key, err := objectKey(dec)
+			if err != nil {
+				return nil, err
+			}
+			if err := set.readField(dec, key); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// objectKey reads the next key of the object dec is in.
+func objectKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected an object key, got %s", tokenKind(tok))
+	}
+	return key, nil
+}
+
+// readField reads the value of a result set's key.
+func (rs *JSONResultSet) readField(dec *json.Decoder, key string) error {
+	switch key {
+	case "columns":
+		rs.hasColumns = true
+		return dec.Decode(&rs.columns)
+	case "types":
+		return dec.Decode(&rs.types)
+	case "columnMeta":
+		return dec.Decode(&rs.columnMeta)
+	case "data":
+		rs.hasData = true
+		return rs.readData(dec)
+	case "error", "detail", "message":
+		return dec.Decode(&rs.reported[slices.Index(reportedErrorKeys, key)])
+	}
+	var skip json.RawMessage
+	return dec.Decode(&skip)
+}
+
+// readData reads the "data" array row by row into rs.cells.
+func (rs *JSONResultSet) readData(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		rs.dataErr = errors.New("invalid data format")
+		return skipRest(dec, tok)
+	}
+	var row []json.RawMessage // reused: RawMessage decoding keeps each cell's buffer
+	for i := 0; dec.More(); i++ {
+		if err := dec.Decode(&row); err != nil || row == nil {
+			// Not an array (null decodes to a nil slice): the value has
+			// been read, so keep going with the stream in step.
+			got := "null"
+			if err != nil {
+				var typeErr *json.UnmarshalTypeError
+				if !errors.As(err, &typeErr) {
+					return err
+				}
+				got = typeErr.Value
+			}
+			if rs.dataErr == nil {
+				rs.dataErr = fmt.Errorf("invalid row at index %d: expected array, got %s", i, got)
+			}
+			row = nil
+			continue
+		}
+		if rs.dataErr != nil {
+			continue
+		}
+		if i == 0 {
+			rs.cells = make([]jsonColumn, len(row))
+		}
+		if len(row) < len(rs.cells) {
+			rs.dataErr = fmt.Errorf("row %d has %d columns, expected at least %d", i, len(row), len(rs.cells))
+			continue
+		}
+		for c := range rs.cells {
+			cell, err := parseJSONCell(row[c])
+			if err != nil {
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+			rs.cells[c].append(cell)
+		}
+		rs.rows++
+	}
+	_, err = dec.Token() // the closing bracket
+	return err
+}
+
+// skipRest skips the rest of the value tok started.
+func skipRest(dec *json.Decoder, tok json.Token) error {
+	depth := 0
+	for {
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+		var err error
+		if tok, err = dec.Token(); err != nil {
+			return err
+		}
+	}
+}
+
+// tokenKind names the JSON type a token starts, for errors.
+func tokenKind(tok json.Token) string {
+	switch tok {
+	case json.Delim('{'):
+		return "object"
+	case json.Delim('['):
+		return "array"
+	case nil:
+		return "null"
+	}
+	switch tok.(type) {
+	case string:
+		return "string"
+	case float64, json.Number:
+		return "number"
+	case bool:
+		return "bool"
+	}
+	return fmt.Sprintf("%v", tok)
+}
+
+// reportedErrorKeys are the keys an Arc error payload puts its text under,
+// in the order reportedError prefers them.
+var reportedErrorKeys = []string{"error", "detail", "message"}
+
+// reportedError returns the error the result set's payload reports: an
+// "error", or a "detail" or "message" in a payload without result columns
+// or rows. Nil for none.
+func (rs *JSONResultSet) reportedError() *ResponseError {
+	for i, v := range rs.reported {
+		if i > 0 && (rs.hasColumns || rs.hasData) {
+			break
+		}
+		var msg string
+		switch x := v.(type) {
+		case nil:
+			continue
+		case string:
+			msg = x
+		default:
+			raw, _ := json.Marshal(x)
+			msg = string(raw)
+		}
+		if msg = strings.TrimSpace(msg); msg != "" {
+			return &ResponseError{Message: msg}
+		}
+	}
+	return nil
+}
+
+// resultSetOf converts a result set decoded into a map, for FrameFromJSON.
+func resultSetOf(result map[string]interface{}) *JSONResultSet {
+	rs := &JSONResultSet{types: result["types"], columnMeta: result["columnMeta"]}
+	for i, key := range reportedErrorKeys {
+		rs.reported[i] = result[key]
+	}
+	rs.columns, rs.hasColumns = result["columns"]
+	raw, ok := result["data"]
+	rs.hasData = ok
+	if !ok {
+		return rs
+	}
+	rows, ok := raw.([]interface{})
+	if !ok {
+		rs.dataErr = errors.New("invalid data format")
+		return rs
+	}
+	for i, r := range rows {
+		row, ok := r.([]interface{})
+		if !ok {
+			rs.dataErr = fmt.Errorf("invalid row at index %d: expected array, got %T", i, r)
+			return rs
+		}
+		if i == 0 {
+			rs.cells = make([]jsonColumn, len(row))
+		}
+		if len(row) < len(rs.cells) {
+			rs.dataErr = fmt.Errorf("row %d has %d columns, expected at least %d", i, len(row), len(rs.cells))
+			return rs
+		}
+		for c := range rs.cells {
+			rs.cells[c].append(cellOf(row[c]))
+		}
+		rs.rows++
+	}
+	return rs
+}
+
+// Non-finite floats. DuckDB writes a NaN or infinite DOUBLE as a bare NaN,
+// Infinity or -Infinity, which isn't JSON: json.Decoder fails the whole
+// response on it. nonFiniteReader rewrites each such token outside a
+// string into a sentinel string, which parseJSONCell reads back as the
+// number. A sentinel opens with an escaped NUL, which no value Arc sends
+// starts with.
+var (
+	nonFiniteTokens = []string{"NaN", "Infinity", "-Infinity"}
+
+	nonFiniteSentinels = map[string]float64{
+		`"\u0000NaN"`:       math.NaN(),
+		`"\u0000Infinity"`:  math.Inf(1),
+		`"\u0000-Infinity"`: math.Inf(-1),
+	}
+)
+
+// nonFiniteReader is an io.Reader rewriting r's non-finite float tokens
+// (see nonFiniteTokens) into sentinels.
+type nonFiniteReader struct {
+	r        *bufio.Reader
+	pending  []byte // a sentinel not yet returned
+	inString bool
+	escaped  bool // the last byte in a string was a backslash
+}
+
+func newNonFiniteReader(r io.Reader) *nonFiniteReader {
+	return &nonFiniteReader{r: bufio.NewReaderSize(r, 64<<10)}
+}
+
+func (f *nonFiniteReader) Read(p []byte) (int, error) {
+	if len(f.pending) > 0 {
+		n := copy(p, f.pending)
+		f.pending = f.pending[n:]
+		return n, nil
+	}
+	if f.r.Buffered() == 0 {
+		if _, err := f.r.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+	buf, _ := f.r.Peek(f.r.Buffered())
+	if len(buf) > len(p) {
+		buf = buf[:len(p)]
+	}
+	n := 0
+scan:
+	for ; n < len(buf); n++ {
+		b := buf[n]
+		if f.inString {
+			switch {
+			case f.escaped:
+				f.escaped = false
+			case b == '\\':
+				f.escaped = true
+			case b == '"':
+				f.inString = false
+			}
+			continue
+		}
+		switch {
+		case b == '"':
+			f.inString = true
+		case b == 'N', b == 'I', b == '-' && (n+1 == len(buf) || buf[n+1] == 'I'):
+			// Only JSON's literals start with a letter, and none of them
+			// with N or I. A token is matched at the start of a read, where
+			// Peek can see all of it.
+			if n > 0 {
+				break scan
+			}
+			if token := f.nonFiniteToken(); token != "" {
+				_, _ = f.r.Discard(len(token))
+				f.pending = []byte(`"\u0000` + token + `"`)
+				return f.Read(p)
+			}
+		}
+	}
+	copy(p, buf[:n])
+	_, _ = f.r.Discard(n)
+	return n, nil
+}
+
+// nonFiniteToken returns the non-finite float token the buffered input
+// starts with, or "".
+func (f *nonFiniteReader) nonFiniteToken() string {
+	for _, token := range nonFiniteTokens {
+		if next, _ := f.r.Peek(len(token)); string(next) == token {
+			return token
+		}
+	}
+	return ""
+}
@@ -0,0 +1,829 @@
+package arcclient
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Macros. Grafana-style macros are expanded in the SQL before it is sent to
+// Arc:
+//
+//   - $__timeFilter(col), $__timeFilterPrev(col): col >= from AND col < to
+//     over the range, or over the range shifted back by its own length;
+//   - $__timeFrom(), $__timeTo(), $__timeFromPrev(), $__timeToPrev(),
+//     $__rangeFrom(), $__rangeTo(): quoted RFC3339 bounds, with
+//     sub-second digits when the bound has them (formatBound);
+//   - $__interval, $__interval_ms: a bucket width from the panel's interval,
+//     or sized to the range, as SQL and as milliseconds;
+//   - $__timeGroup(col, '15m'): epoch-aligned (or origin-aligned) buckets of
+//     any width IntervalDuration parses, down to a millisecond.
+//   - $__in(col, values), $__quote(values): a multi-value variable's
+//     values as col IN (...) or a list of literals, see ExpandValueMacros.
+//
+// Macros inside string literals and comments are left alone, and one whose
+// arguments don't validate is left unexpanded so Arc reports it.
+
+// TimeRange is a query's time range. It converts to and from the plugin
+// SDK's backend.TimeRange.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// MacroOptions are the inputs to ExpandMacros.
+type MacroOptions struct {
+	// Range is the dashboard's time range.
+	Range TimeRange
+	// Filter is the range the time filters cover when it differs from
+	// Range: one chunk of a split query. Zero means Range.
+	Filter TimeRange
+	// BucketOrigin aligns $__timeGroup buckets; zero is the epoch. See
+	// ResolveBucketOrigin.
+	BucketOrigin time.Time
+	// Interval is Grafana's panel interval (DataQuery.Interval); zero sizes
+	// $__interval to Range instead. See ResolveInterval.
+	Interval time.Duration
+	// MaxDataPoints caps the buckets Interval may give Range; zero is no
+	// cap.
+	MaxDataPoints int64
+}
+
+// columnNameRe matches a SQL column or qualified column reference (table.col).
+// Used to validate macro arguments before interpolating them into SQL.
+var columnNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ValidateColumn returns an error if name doesn't look like a safe SQL
+// column reference. The macro expanders check column arguments with it
+// before interpolating them.
+func ValidateColumn(name string) error {
+	if !columnNameRe.MatchString(name) {
+		return fmt.Errorf("invalid column argument %q: must match %s", name, columnNameRe.String())
+	}
+	return nil
+}
+
+// IntervalStep is one rung of the $__interval ladder: a range longer than
+// Over expands $__interval to Interval. The last rung has Over 0 and takes
+// every shorter range.
+type IntervalStep struct {
+	Over     time.Duration
+	Interval string
+}
+
+// intervalLadder is the $__interval ladder, longest range first.
+var intervalLadder = []IntervalStep{
+	{Over: 7 * 24 * time.Hour, Interval: "1 hour"},
+	{Over: 24 * time.Hour, Interval: "10 minutes"},
+	{Over: 6 * time.Hour, Interval: "1 minute"},
+	{Over: 0, Interval: "10 seconds"},
+}
+
+// IntervalLadder returns the rungs $__interval is chosen from, longest range
+// first, so callers can show how a range maps to an interval.
+func IntervalLadder() []IntervalStep {
+	return append([]IntervalStep(nil), intervalLadder...)
+}
+
+// Interval returns the rung of the ladder a range of the given length
+// falls on; its Interval is what $__interval expands to.
+func Interval(rangeLength time.Duration) IntervalStep {
+	for _, step := range intervalLadder {
+		if rangeLength > step.Over {
+			return step
+		}
+	}
+	return intervalLadder[len(intervalLadder)-1]
+}
+
+// Where $__interval came from; see ResolveInterval.
+const (
+	IntervalFromLadder        = "ladder"
+	IntervalFromPanel         = "panel"
+	IntervalFromMaxDataPoints = "maxDataPoints"
+)
+
+// ResolvedInterval is what $__interval and $__interval_ms expand to.
+type ResolvedInterval struct {
+	// Interval is the SQL interval string, e.g. "30 seconds" or
+	// "100 milliseconds".
+	Interval string
+	// Seconds is its width in whole seconds, rounded up for a sub-second
+	// interval.
+	Seconds int
+	// Milliseconds is its width; $__interval_ms expands to it.
+	Milliseconds int64
+	// Source is IntervalFromLadder, IntervalFromPanel or
+	// IntervalFromMaxDataPoints.
+	Source string
+}
+
+// niceIntervals are the widths a MaxDataPoints-derived interval is rounded
+// up to, in milliseconds; past the last one it is rounded up to whole days.
+var niceIntervals = []int64{
+	1, 2, 5, 10, 20, 50, 100, 200, 250, 500,
+	1000, 2 * 1000, 5 * 1000, 10 * 1000, 15 * 1000, 20 * 1000, 30 * 1000,
+	60 * 1000, 2 * 60 * 1000, 5 * 60 * 1000, 10 * 60 * 1000, 15 * 60 * 1000, 20 * 60 * 1000, 30 * 60 * 1000,
+	3600 * 1000, 2 * 3600 * 1000, 3 * 3600 * 1000, 6 * 3600 * 1000, 12 * 3600 * 1000,
+	86400 * 1000, 7 * 86400 * 1000,
+}
+
+// shortRange is the longest range whose ladder interval MaxDataPoints may
+// refine: a minute of high-frequency data would get six 10-second buckets
+// from the ladder, so it gets the nice width that gives it MaxDataPoints
+// buckets instead, down to a millisecond.
+const shortRange = time.Minute
+
+// ResolveInterval picks $__interval for opts. Grafana's panel interval
+// (opts.Interval) is used rounded up to whole milliseconds, coarsened to a
+// nice width when it would give the range more than opts.MaxDataPoints
+// buckets. Without a panel interval the ladder sizes it to the range (see
+// Interval), or for a range of up to shortRange, MaxDataPoints when that
+// gives narrower buckets.
+func ResolveInterval(opts MacroOptions) ResolvedInterval {
+	rangeLength := opts.Range.To.Sub(opts.Range.From)
+	var perPoint int64
+	if opts.MaxDataPoints > 0 && rangeLength > 0 {
+		perPoint = ceilMillis(rangeLength / time.Duration(opts.MaxDataPoints))
+	}
+	if opts.Interval <= 0 {
+		step := Interval(rangeLength)
+		ms, _ := parseIntervalMillis(step.Interval, false)
+		if perPoint > 0 && rangeLength <= shortRange {
+			if nice := niceIntervalAtLeast(perPoint); nice < ms {
+				return resolvedInterval(nice, IntervalFromMaxDataPoints)
+			}
+		}
+		return ResolvedInterval{Interval: step.Interval, Seconds: int(ms / 1000), Milliseconds: ms, Source: IntervalFromLadder}
+	}
+	ms, source := ceilMillis(opts.Interval), IntervalFromPanel
+	if perPoint > ms {
+		ms, source = niceIntervalAtLeast(perPoint), IntervalFromMaxDataPoints
+	}
+	return resolvedInterval(ms, source)
+}
+
+func resolvedInterval(ms int64, source string) ResolvedInterval {
+	return ResolvedInterval{Interval: formatIntervalMillis(ms), Seconds: int((ms + 999) / 1000), Milliseconds: ms, Source: source}
+}
+
+// ceilMillis rounds d up to whole milliseconds.
+func ceilMillis(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// niceIntervalAtLeast rounds ms up to the next of niceIntervals, or to
+// whole days past them.
+func niceIntervalAtLeast(ms int64) int64 {
+	for _, nice := range niceIntervals {
+		if nice >= ms {
+			return nice
+		}
+	}
+	const day = 86400 * 1000
+	return (ms + day - 1) / day * day
+}
+
+// FormatInterval writes secs (positive) as a SQL interval in the largest
+// unit that divides it: 30 -> "30 seconds", 90 -> "90 seconds", 3600 ->
+// "1 hour", 5400 -> "90 minutes".
+func FormatInterval(secs int) string {
+	units := []struct {
+		secs int
+		name string
+	}{{604800, "week"}, {86400, "day"}, {3600, "hour"}, {60, "minute"}, {1, "second"}}
+	for _, u := range units {
+		if secs%u.secs != 0 {
+			continue
+		}
+		n := secs / u.secs
+		if n == 1 {
+			return "1 " + u.name
+		}
+		return fmt.Sprintf("%d %ss", n, u.name)
+	}
+	return fmt.Sprintf("%d seconds", secs)
+}
+
+// formatIntervalMillis is FormatInterval for a width in milliseconds:
+// "100 milliseconds", or FormatInterval's form for whole seconds.
+func formatIntervalMillis(ms int64) string {
+	switch {
+	case ms%1000 == 0:
+		return FormatInterval(int(ms / 1000))
+	case ms == 1:
+		return "1 millisecond"
+	}
+	return fmt.Sprintf("%d milliseconds", ms)
+}
+
+// ReplaceMacro walks `sql` once and rewrites every occurrence of
+// `macro` that lives outside string literals and comments. For each in-scope
+// occurrence the inner argument (between the macro's opening paren and the
+// matching closing paren, respecting nested parens) is passed to `rewrite`.
+// If rewrite returns ok=false the original macro text is preserved verbatim.
+//
+// The single-pass approach (O(N) over `sql`, with `strings.Builder` output)
+// replaces the previous repeated slice-splice loop that was O(N·L) per
+// macro. The literal-and-comment awareness also fixes the C4 issue where
+// `WHERE message = 'count of $__timeFilter(time)'` would have its literal
+// content rewritten.
+func ReplaceMacro(sql, macro string, rewrite func(arg string) (string, bool)) string {
+	return replaceMacros(sql, []string{macro}, MatchingParen, func(_, arg string) (string, bool) { return rewrite(arg) })
+}
+
+// replaceMacros is ReplaceMacro for several macros in one pass, with the
+// end of an argument list found by argEnd, which is given the index of the
+// opening paren. rewrite is told which macro it is rewriting.
+func replaceMacros(sql string, macros []string, argEnd func(sql string, openIdx int) int, rewrite func(macro, arg string) (string, bool)) string {
+	var out strings.Builder
+	out.Grow(len(sql))
+	i := 0
+	for i < len(sql) {
+		// Skip over '...' string literals (preserve verbatim).
+		if sql[i] == '\'' {
+			out.WriteByte(sql[i])
+			i++
+			for i < len(sql) {
+				out.WriteByte(sql[i])
+				if sql[i] == '\'' {
+					// Escaped quote ''
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						out.WriteByte(sql[i+1])
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			continue
+		}
+		// Skip over -- line comments.
+		if sql[i] == '-' && i+1 < len(sql) && sql[i+1] == '-' {
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				out.WriteString(sql[i:])
+				return out.String()
+			}
+			out.WriteString(sql[i : i+end])
+			i += end
+			continue
+		}
+		// Skip over /* block comments */.
+		if sql[i] == '/' && i+1 < len(sql) && sql[i+1] == '*' {
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				out.WriteString(sql[i:])
+				return out.String()
+			}
+			out.WriteString(sql[i : i+2+end+2])
+			i += 2 + end + 2
+			continue
+		}
+		// Macro at this position?
+		if macro := macroAt(sql[i:], macros); macro != "" {
+			closeIdx := argEnd(sql, i+len(macro)-1)
+			if closeIdx < 0 {
+				// Unmatched paren — leave the rest of the SQL untouched.
+				out.WriteString(sql[i:])
+				return out.String()
+			}
+			arg := sql[i+len(macro) : closeIdx]
+			if rewritten, ok := rewrite(macro, arg); ok {
+				out.WriteString(rewritten)
+			} else {
+				// Caller declined the rewrite — preserve the original macro
+				// text so Arc surfaces a clear error rather than producing
+				// silently-mangled SQL.
+				out.WriteString(sql[i : closeIdx+1])
+			}
+			i = closeIdx + 1
+			continue
+		}
+		out.WriteByte(sql[i])
+		i++
+	}
+	return out.String()
+}
+
+// macroAt returns the one of macros s starts with, or "".
+func macroAt(s string, macros []string) string {
+	for _, macro := range macros {
+		if strings.HasPrefix(s, macro) {
+			return macro
+		}
+	}
+	return ""
+}
+
+// ReplaceToken replaces every occurrence of `token` (a fixed
+// string with no argument list, e.g. "$__interval" or "$__timeFrom()") with
+// `replacement` — skipping occurrences inside string literals and SQL
+// comments. This is the zero-arg sibling of `ReplaceMacro` and
+// fixes R2-CR5: the previous `strings.ReplaceAll` rewrote macros inside
+// string literals (`WHERE msg = 'see $__timeFrom()'` mangled the literal).
+func ReplaceToken(sql, token, replacement string) string {
+	if !strings.Contains(sql, token) {
+		return sql
+	}
+	var out strings.Builder
+	out.Grow(len(sql))
+	i := 0
+	for i < len(sql) {
+		// Skip '...' string literals (preserve verbatim, including any tokens inside).
+		if sql[i] == '\'' {
+			out.WriteByte(sql[i])
+			i++
+			for i < len(sql) {
+				out.WriteByte(sql[i])
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						out.WriteByte(sql[i+1])
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			continue
+		}
+		// Skip -- line comments.
+		if sql[i] == '-' && i+1 < len(sql) && sql[i+1] == '-' {
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				out.WriteString(sql[i:])
+				return out.String()
+			}
+			out.WriteString(sql[i : i+end])
+			i += end
+			continue
+		}
+		// Skip /* block comments */.
+		if sql[i] == '/' && i+1 < len(sql) && sql[i+1] == '*' {
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				out.WriteString(sql[i:])
+				return out.String()
+			}
+			out.WriteString(sql[i : i+2+end+2])
+			i += 2 + end + 2
+			continue
+		}
+		// Token match?
+		if i+len(token) <= len(sql) && sql[i:i+len(token)] == token {
+			out.WriteString(replacement)
+			i += len(token)
+			continue
+		}
+		out.WriteByte(sql[i])
+		i++
+	}
+	return out.String()
+}
+
+// MatchingParen scans forward from `openIdx` (which must point at '(')
+// and returns the index of the matching ')', respecting nested parens and
+// string literals inside the arg. Returns -1 if no match is found.
+func MatchingParen(sql string, openIdx int) int {
+	if openIdx >= len(sql) || sql[openIdx] != '(' {
+		return -1
+	}
+	depth := 1
+	i := openIdx + 1
+	for i < len(sql) {
+		c := sql[i]
+		switch c {
+		case '\'':
+			// Skip string literal.
+			i++
+			for i < len(sql) {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+		case '(':
+			depth++
+			i++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// ExpandTimeFilter replaces $__timeFilter(column) with column >= 'from' AND column < 'to'.
+// Column arguments are validated against columnNameRe — anything else is left
+// un-expanded so Arc surfaces a clear error rather than the macro silently
+// injecting attacker-controlled SQL. Macros inside string literals or comments
+// are not expanded.
+func ExpandTimeFilter(sql string, from, to time.Time) string {
+	return expandTimeFilterMacro(sql, "$__timeFilter", from, to)
+}
+
+// formatBound formats a time filter bound as the macros write it:
+// RFC3339 with as many fractional-second digits as t has, so a range
+// zoomed to a few seconds — or a split chunk boundary inside a second —
+// keeps its milliseconds (and nanoseconds) instead of being truncated to
+// the second, which duplicated or dropped the rows at the edges.
+func formatBound(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// quoteBound is formatBound as a SQL string literal.
+func quoteBound(t time.Time) string {
+	return "'" + formatBound(t) + "'"
+}
+
+// expandTimeFilterMacro is ExpandTimeFilter for any `name(column)` filter
+// macro — shared by $__timeFilter and $__timeFilterPrev.
+func expandTimeFilterMacro(sql, name string, from, to time.Time) string {
+	fromStr, toStr := formatBound(from), formatBound(to)
+	return ReplaceMacro(sql, name+"(", func(arg string) (string, bool) {
+		column := strings.TrimSpace(arg)
+		if column == "" {
+			log.DefaultLogger.Warn(name + " macro has empty column argument, defaulting to 'time'")
+			column = "time"
+		}
+		if err := ValidateColumn(column); err != nil {
+			log.DefaultLogger.Warn(name+" rejected unsafe column argument", "column", column, "error", err.Error())
+			return "", false
+		}
+		return fmt.Sprintf("%s >= '%s' AND %s < '%s'", column, fromStr, column, toStr), true
+	})
+}
+
+// ExpandMacros expands every Grafana macro in sql. Each one goes through
+// literal-and-comment-aware walkers (R2-CR5): the previous implementation
+// used `strings.ReplaceAll` for `$__timeFrom()`, `$__timeTo()`, and
+// `$__interval`, which rewrote macro text inside string literals
+// (`WHERE msg = 'see $__timeFrom()'` mangled the literal). All the macros
+// now share the same safety.
+//
+// opts.Filter is the range the time filters cover (a chunk when splitting);
+// opts.Range is the whole dashboard range. The whole range's length sizes
+// $__interval when there is no panel interval (see ResolveInterval), so
+// every chunk buckets alike, and is also the shift for the previous-period macros
+// ($__timeFilterPrev, $__timeFromPrev(), $__timeToPrev()): the filter window
+// moved back by one range length. Without splitting that is exactly the
+// window preceding the range, [From-d, From); with splitting each chunk's
+// previous-period filter is the chunk shifted back by d, so the chunks of
+// the previous period tile it the same way the current chunks tile the
+// range. Shifting absolute instants keeps the period the same true
+// duration across DST changes (a 23-hour day compares against the 23 hours
+// before it).
+//
+// opts.BucketOrigin aligns $__timeGroup buckets (see ResolveBucketOrigin);
+// the zero time keeps the epoch alignment.
+func ExpandMacros(sql string, opts MacroOptions) string {
+	original, filter := opts.Range, opts.Filter
+	if filter == (TimeRange{}) {
+		filter = original
+	}
+	filterFrom, filterTo := filter.From, filter.To
+	rangeDuration := original.To.Sub(original.From)
+	prevFrom, prevTo := filterFrom.Add(-rangeDuration), filterTo.Add(-rangeDuration)
+	// The value macros first: their JSON arguments may hold quotes the
+	// other walkers would read as the start of a literal.
+	sql = ExpandValueMacros(sql)
+	sql = ExpandTimeFilter(sql, filterFrom, filterTo)
+	sql = expandTimeFilterMacro(sql, "$__timeFilterPrev", prevFrom, prevTo)
+	sql = ReplaceToken(sql, "$__timeFrom()", quoteBound(filterFrom))
+	sql = ReplaceToken(sql, "$__timeTo()", quoteBound(filterTo))
+	sql = ReplaceToken(sql, "$__timeFromPrev()", quoteBound(prevFrom))
+	sql = ReplaceToken(sql, "$__timeToPrev()", quoteBound(prevTo))
+	sql = ReplaceToken(sql, "$__rangeFrom()", quoteBound(original.From))
+	sql = ReplaceToken(sql, "$__rangeTo()", quoteBound(original.To))
+	// $__interval_ms first: $__interval is a prefix of it.
+	interval := ResolveInterval(opts)
+	sql = ReplaceToken(sql, "$__interval_ms", strconv.FormatInt(interval.Milliseconds, 10))
+	sql = ReplaceToken(sql, "$__interval", interval.Interval)
+	// $__timeGroup(column, interval) -> epoch-based bucketing
+	// DuckDB's date_trunc/time_bucket retains nanosecond residuals on TIMESTAMP_NS columns,
+	// causing GROUP BY to produce per-second rows. Epoch math avoids this.
+	sql = expandTimeGroup(sql, opts.BucketOrigin, interval.Milliseconds, filter)
+	return sql
+}
+
+// Interval units $__timeGroup accepts, in milliseconds. Months and years
+// have no fixed length, so epoch-based bucketing can't express them.
+var intervalUnitMillis = map[string]int64{
+	"ms": 1, "millisecond": 1,
+	"s": 1000, "second": 1000,
+	"m": 60 * 1000, "minute": 60 * 1000,
+	"h": 3600 * 1000, "hour": 3600 * 1000,
+	"d": 86400 * 1000, "day": 86400 * 1000,
+	"w": 604800 * 1000, "week": 604800 * 1000,
+}
+
+// compactIntervalRe matches the short form: one or more <count><unit>
+// terms, "90s", "2h30m", "1w", "100ms", "0.5s".
+var compactIntervalRe = regexp.MustCompile(`^(?:\d+(?:\.\d+)?(?:ms|[smhdw]))+$`)
+
+var compactIntervalTermRe = regexp.MustCompile(`(\d+(?:\.\d+)?)(ms|[smhdw])`)
+
+// maxIntervalMillis bounds a bucket width; anything longer is a typo, and
+// the bound keeps the sum of the terms from overflowing.
+const maxIntervalMillis = 100 * 365 * 86400 * 1000
+
+// ErrInvalidInterval is returned for a $__timeGroup interval that isn't a
+// positive width of whole milliseconds (see ValidateTimeGroups).
+var ErrInvalidInterval = errors.New("invalid $__timeGroup interval")
+
+// errZeroInterval is parseIntervalMillis's error for an interval that
+// parses but has no width.
+var errZeroInterval = errors.New("zero-width interval")
+
+// IntervalSeconds converts an interval string to seconds. It accepts the
+// short form ("15m", "90s", "2h30m", "1w") and the DuckDB long form with
+// singular or plural units ("30 seconds", "1 hour", "2 hours 30 minutes"),
+// in seconds, minutes, hours, days and weeks, with whole counts. Returns
+// (seconds, true) on a positive interval and (0, false) otherwise —
+// caller is responsible for deciding fallback behavior. Before this
+// signature the function silently defaulted unknown input to 3600s,
+// masking typos like '1minutes' as a one-hour bucket. See IntervalDuration
+// for sub-second widths.
+func IntervalSeconds(interval string) (int, bool) {
+	ms, err := parseIntervalMillis(interval, false)
+	if err != nil {
+		return 0, false
+	}
+	return int(ms / 1000), true
+}
+
+// IntervalDuration is IntervalSeconds with millisecond precision: it also
+// accepts milliseconds ("100ms", "250 milliseconds") and decimal counts
+// ("0.5s", "1.5 hours"), as long as the width comes to a positive whole
+// number of milliseconds.
+func IntervalDuration(interval string) (time.Duration, bool) {
+	ms, err := parseIntervalMillis(interval, true)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// parseIntervalMillis parses interval to milliseconds; without subSecond
+// only IntervalSeconds's whole-count, whole-second forms are accepted.
+func parseIntervalMillis(interval string, subSecond bool) (int64, error) {
+	interval = strings.ToLower(strings.TrimSpace(interval))
+	var terms [][2]string
+	if compactIntervalRe.MatchString(interval) {
+		for _, m := range compactIntervalTermRe.FindAllStringSubmatch(interval, -1) {
+			terms = append(terms, [2]string{m[1], m[2]})
+		}
+	} else {
+		fields := strings.Fields(interval)
+		if len(fields) == 0 || len(fields)%2 != 0 {
+			return 0, ErrInvalidInterval
+		}
+		for i := 0; i < len(fields); i += 2 {
+			unit := strings.TrimSuffix(fields[i+1], "s")
+			if len(unit) == 1 {
+				// "1 m" and "1 s" are neither form.
+				return 0, ErrInvalidInterval
+			}
+			terms = append(terms, [2]string{fields[i], unit})
+		}
+	}
+	var ms int64
+	for _, term := range terms {
+		unit, ok := intervalUnitMillis[term[1]]
+		if !ok || (!subSecond && unit < 1000) {
+			return 0, ErrInvalidInterval
+		}
+		whole, frac, decimal := strings.Cut(term[0], ".")
+		if decimal && (!subSecond || frac == "" || len(frac) > 9) {
+			return 0, ErrInvalidInterval
+		}
+		n, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || n < 0 || n > maxIntervalMillis/unit {
+			return 0, ErrInvalidInterval
+		}
+		ms += n * unit
+		if decimal {
+			// The fraction has to come to whole milliseconds: 0.5s does,
+			// 0.0001s doesn't.
+			f, err := strconv.ParseInt(frac, 10, 64)
+			scale := int64(1)
+			for range frac {
+				scale *= 10
+			}
+			if err != nil || (f*unit)%scale != 0 {
+				return 0, ErrInvalidInterval
+			}
+			ms += f * unit / scale
+		}
+		if ms > maxIntervalMillis {
+			return 0, ErrInvalidInterval
+		}
+	}
+	if ms == 0 {
+		return 0, errZeroInterval
+	}
+	if !subSecond && ms%1000 != 0 {
+		return 0, ErrInvalidInterval
+	}
+	return ms, nil
+}
+
+// ValidateTimeGroups checks the interval of every $__timeGroup in sql and
+// returns an ErrInvalidInterval error for the first one that isn't a
+// positive whole number of milliseconds — a zero-width bucket, say — so
+// the caller can report it instead of sending Arc the unexpanded macro.
+// Other argument problems are left to the expansion.
+func ValidateTimeGroups(sql string) error {
+	var firstErr error
+	ReplaceMacro(sql, "$__timeGroup(", func(arg string) (string, bool) {
+		parts := strings.Split(arg, ",")
+		if firstErr != nil || len(parts) != 2 {
+			return "", false
+		}
+		interval := strings.Trim(strings.TrimSpace(parts[1]), "'\"")
+		if interval == "$__interval" {
+			return "", false
+		}
+		switch _, err := parseIntervalMillis(interval, true); {
+		case errors.Is(err, errZeroInterval):
+			firstErr = fmt.Errorf("%w %q: buckets must be at least 1ms wide", ErrInvalidInterval, interval)
+		case err != nil:
+			firstErr = fmt.Errorf("%w %q: expected a width such as '100ms', '0.5s', '15m', '2h30m' or '30 seconds', of whole milliseconds", ErrInvalidInterval, interval)
+		}
+		return "", false
+	})
+	return firstErr
+}
+
+// BucketOriginStartOfRange is the ArcQuery.BucketOrigin keyword for "align
+// buckets to the start of the dashboard range".
+const BucketOriginStartOfRange = "startOfRange"
+
+// ErrInvalidBucketOrigin rejects a bucketOrigin that is neither a keyword
+// nor an RFC3339 timestamp. The message echoes only the option value.
+var ErrInvalidBucketOrigin = errors.New("invalid bucketOrigin")
+
+// ResolveBucketOrigin turns ArcQuery.BucketOrigin into the instant $__timeGroup
+// buckets are aligned to. Empty returns the zero time (epoch alignment).
+// "startOfRange" resolves against the ORIGINAL dashboard range, never a
+// chunk, so every chunk of a split query buckets on the same grid.
+//
+// Epoch alignment gives UTC days and Thursday-based weeks; an origin like
+// "2026-01-05T00:00:00+01:00" gives Monday weeks and days starting at
+// midnight Berlin time. A fixed origin can't follow DST — the offset in the
+// timestamp is the one used all year. An IANA zone name such as
+// "Europe/Berlin" can: it resolves to local midnight on Monday 2000-01-03 in
+// that zone, and buckets of whole days, or of widths that divide a day,
+// then follow local midnight all year (see BucketZone and zone.go).
+func ResolveBucketOrigin(origin string, tr TimeRange) (time.Time, error) {
+	switch origin {
+	case "":
+		return time.Time{}, nil
+	case BucketOriginStartOfRange:
+		return tr.From, nil
+	}
+	t, err := time.Parse(time.RFC3339, origin)
+	if err == nil {
+		return t, nil
+	}
+	// "Local" would be the Grafana server's zone, not the dashboard's.
+	if origin != "Local" {
+		if loc, err := time.LoadLocation(origin); err == nil {
+			return time.Date(2000, 1, 3, 0, 0, 0, 0, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w %q: expected %q, an RFC3339 timestamp such as 2026-01-05T00:00:00+01:00 or a time zone such as Europe/Berlin",
+		ErrInvalidBucketOrigin, origin, BucketOriginStartOfRange)
+}
+
+// originOffsetMillis is OriginOffset in milliseconds, for sub-second
+// periods.
+func originOffsetMillis(origin time.Time, periodMs int64) int64 {
+	if origin.IsZero() || periodMs <= 0 {
+		return 0
+	}
+	off := origin.UnixMilli() % periodMs
+	if off < 0 {
+		off += periodMs
+	}
+	return off
+}
+
+// OriginOffset reduces origin to its offset within one period: the seconds
+// past the epoch-aligned grid where the origin-aligned grid starts, in
+// [0, period). Zero origin means no offset. Only the offset matters for
+// where boundaries fall, so an origin before the range and one after it
+// produce the same buckets — and the SQL never subtracts an origin later
+// than the data, which would make DuckDB's truncating // round negative
+// differences toward zero and skew every bucket before the origin.
+func OriginOffset(origin time.Time, periodSecs int64) int64 {
+	if origin.IsZero() || periodSecs <= 0 {
+		return 0
+	}
+	off := origin.Unix() % periodSecs
+	if off < 0 {
+		off += periodSecs
+	}
+	return off
+}
+
+// ExpandTimeGroup replaces $__timeGroup(column, interval) with epoch-based
+// bucketing SQL. DuckDB's date_trunc/time_bucket retains nanosecond
+// residuals on TIMESTAMP_NS columns, causing GROUP BY to produce per-second
+// rows. Epoch math avoids this. The column argument is validated with
+// ValidateColumn; unknown intervals and arg-count mismatches are rejected
+// (macro left un-expanded so Arc surfaces a clear error) rather than
+// silently defaulting.
+//
+// A non-zero origin aligns buckets to it instead of the epoch (see
+// ResolveBucketOrigin): buckets become `((epoch - off) // width) * width +
+// off` where off is the origin's offset within one bucket width (see
+// OriginOffset).
+//
+// Widths of whole seconds bucket epoch seconds; sub-second widths ('100ms',
+// '0.5s') bucket epoch milliseconds the same way.
+//
+// With an origin naming a zone, whole-day widths and widths that divide a
+// day bucket on local days instead (see zone.go), which needs the range the
+// zone's offsets are tabulated for: ExpandMacros passes it, ExpandTimeGroup
+// has none and keeps the origin's fixed offset.
+func ExpandTimeGroup(sql string, origin time.Time) string {
+	return expandTimeGroup(sql, origin, 0, TimeRange{})
+}
+
+// expandTimeGroup is ExpandTimeGroup with the width, in milliseconds, a
+// quoted '$__interval' argument stands for — ReplaceToken leaves string
+// literals alone, so that spelling reaches here unexpanded. Zero leaves it
+// unexpanded. rng is the range zone-aligned day buckets tabulate offsets
+// for; zero disables them.
+func expandTimeGroup(sql string, origin time.Time, intervalMs int64, rng TimeRange) string {
+	return ReplaceMacro(sql, "$__timeGroup(", func(arg string) (string, bool) {
+		parts := strings.Split(arg, ",")
+		if len(parts) < 2 {
+			log.DefaultLogger.Warn("$__timeGroup requires two arguments: $__timeGroup(column, interval)", "found", arg)
+			return "", false
+		}
+		if len(parts) > 2 {
+			// Extra args silently ignored before; now warn loudly.
+			log.DefaultLogger.Warn("$__timeGroup ignored extra arguments — expected $__timeGroup(column, interval)",
+				"found", arg, "extra_count", len(parts)-2)
+			return "", false
+		}
+		column := strings.TrimSpace(parts[0])
+		if err := ValidateColumn(column); err != nil {
+			log.DefaultLogger.Warn("$__timeGroup rejected unsafe column argument", "column", column, "error", err.Error())
+			return "", false
+		}
+		interval := strings.Trim(strings.TrimSpace(parts[1]), "'\"")
+		ms, err := parseIntervalMillis(interval, true)
+		if interval == "$__interval" && intervalMs > 0 {
+			ms, err = intervalMs, nil
+		}
+		if err != nil {
+			log.DefaultLogger.Warn("$__timeGroup rejected unknown interval — expected e.g. '15m', '90s', '2h30m', '1w', '100ms' or '30 seconds'",
+				"interval", interval)
+			return "", false
+		}
+		if ms%1000 != 0 {
+			// to_timestamp() takes (DOUBLE) seconds, so the bucket's epoch
+			// milliseconds are added to the epoch as an interval instead,
+			// which stays exact.
+			if off := originOffsetMillis(origin, ms); off != 0 {
+				return fmt.Sprintf("to_timestamp(0) + to_milliseconds(((epoch_ns(%s) // 1000000 - %d) // %d) * %d + %d)", column, off, ms, ms, off), true
+			}
+			return fmt.Sprintf("to_timestamp(0) + to_milliseconds((epoch_ns(%s) // 1000000 // %d) * %d)", column, ms, ms), true
+		}
+		secs := ms / 1000
+		if zoneAligned(secs, origin) && rng != (TimeRange{}) {
+			loc := BucketZone(origin)
+			return newZoneDays(loc, rng.From, rng.To).bucketSQL(column, secs, localDay(origin, loc)), true
+		}
+		// Use epoch_ns() (BIGINT) with // (integer division) instead of epoch() (DOUBLE)
+		// to avoid floating-point precision loss that causes timestamps near hour
+		// boundaries (e.g. 05:59:59.999) to round up to the next bucket (06:00:00).
+		// DuckDB's / operator returns DOUBLE; // returns BIGINT.
+		if off := OriginOffset(origin, secs); off != 0 {
+			return fmt.Sprintf("to_timestamp(((epoch_ns(%s) // 1000000000 - %d) // %d) * %d + %d)", column, off, secs, secs, off), true
+		}
+		return fmt.Sprintf("to_timestamp((epoch_ns(%s) // 1000000000 // %d) * %d)", column, secs, secs), true
+	})
+}
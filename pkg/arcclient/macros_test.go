@@ -0,0 +1,281 @@
+package arcclient
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandMacros(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(6 * time.Hour)
+	rng := TimeRange{From: from, To: to}
+	chunk := TimeRange{From: from.Add(time.Hour), To: from.Add(2 * time.Hour)}
+
+	cases := []struct {
+		name string
+		sql  string
+		opts MacroOptions
+		want string
+	}{
+		{
+			"time filter",
+			"SELECT * FROM cpu WHERE $__timeFilter(time)",
+			MacroOptions{Range: rng},
+			"SELECT * FROM cpu WHERE time >= '2026-03-01T00:00:00Z' AND time < '2026-03-01T06:00:00Z'",
+		},
+		{
+			"chunk filter, range bounds and interval from the whole range",
+			"SELECT $__rangeFrom(), $__interval FROM cpu WHERE $__timeFilter(ts)",
+			MacroOptions{Range: rng, Filter: chunk},
+			"SELECT '2026-03-01T00:00:00Z', 10 seconds FROM cpu WHERE ts >= '2026-03-01T01:00:00Z' AND ts < '2026-03-01T02:00:00Z'",
+		},
+		{
+			"panel interval",
+			"SELECT $__timeGroup(time, '$__interval'), $__interval_ms FROM cpu",
+			MacroOptions{Range: rng, Filter: chunk, Interval: 30 * time.Second},
+			"SELECT to_timestamp((epoch_ns(time) // 1000000000 // 30) * 30), 30000 FROM cpu",
+		},
+		{
+			"interval_ms from the ladder",
+			"SELECT $__interval_ms",
+			MacroOptions{Range: rng},
+			"SELECT 10000",
+		},
+		{
+			"sub-second time group",
+			"SELECT $__timeGroup(time, '250ms'), $__timeGroup(time, '$__interval'), $__interval_ms FROM cpu",
+			MacroOptions{Range: rng, Interval: 100 * time.Millisecond},
+			"SELECT to_timestamp(0) + to_milliseconds((epoch_ns(time) // 1000000 // 250) * 250), to_timestamp(0) + to_milliseconds((epoch_ns(time) // 1000000 // 100) * 100), 100 FROM cpu",
+		},
+		{
+			"sub-second time group with origin",
+			"SELECT $__timeGroup(time, '0.5s') FROM cpu",
+			MacroOptions{Range: rng, BucketOrigin: from.Add(1200 * time.Millisecond)},
+			"SELECT to_timestamp(0) + to_milliseconds(((epoch_ns(time) // 1000000 - 200) // 500) * 500 + 200) FROM cpu",
+		},
+		{
+			"whole seconds in milliseconds bucket by seconds",
+			"SELECT $__timeGroup(time, '2000ms') FROM cpu",
+			MacroOptions{Range: rng},
+			"SELECT to_timestamp((epoch_ns(time) // 1000000000 // 2) * 2) FROM cpu",
+		},
+		{
+			"zero-width time group left unexpanded",
+			"SELECT $__timeGroup(time, '0ms') FROM cpu",
+			MacroOptions{Range: rng},
+			"SELECT $__timeGroup(time, '0ms') FROM cpu",
+		},
+		{
+			"previous period",
+			"WHERE $__timeFilterPrev(time)",
+			MacroOptions{Range: rng},
+			"WHERE time >= '2026-02-28T18:00:00Z' AND time < '2026-03-01T00:00:00Z'",
+		},
+		{
+			"literals and comments untouched",
+			"SELECT '$__timeFrom()' -- $__timeTo()\nFROM cpu",
+			MacroOptions{Range: rng},
+			"SELECT '$__timeFrom()' -- $__timeTo()\nFROM cpu",
+		},
+		{
+			"time group with origin",
+			"SELECT $__timeGroup(time, '1h') FROM cpu",
+			MacroOptions{Range: rng, BucketOrigin: from.Add(30 * time.Minute)},
+			"SELECT to_timestamp(((epoch_ns(time) // 1000000000 - 1800) // 3600) * 3600 + 1800) FROM cpu",
+		},
+		{
+			"sub-second bounds kept to the nanosecond",
+			"SELECT $__timeFrom(), $__timeTo(), $__rangeTo() FROM cpu WHERE $__timeFilter(time)",
+			MacroOptions{Range: TimeRange{From: from.Add(1500 * time.Millisecond), To: from.Add(4*time.Second + 123456789)}},
+			"SELECT '2026-03-01T00:00:01.5Z', '2026-03-01T00:00:04.123456789Z', '2026-03-01T00:00:04.123456789Z' FROM cpu WHERE time >= '2026-03-01T00:00:01.5Z' AND time < '2026-03-01T00:00:04.123456789Z'",
+		},
+		{
+			"unsafe column left unexpanded",
+			"WHERE $__timeFilter(time; DROP TABLE cpu)",
+			MacroOptions{Range: rng},
+			"WHERE $__timeFilter(time; DROP TABLE cpu)",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ExpandMacros(c.sql, c.opts); got != c.want {
+				t.Errorf("ExpandMacros(%q) =\n%q\nwant\n%q", c.sql, got, c.want)
+			}
+		})
+	}
+}
+
+func TestResolveBucketOrigin(t *testing.T) {
+	rng := TimeRange{From: time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC), To: time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)}
+	if got, err := ResolveBucketOrigin("", rng); err != nil || !got.IsZero() {
+		t.Errorf("empty origin: %v, %v", got, err)
+	}
+	if got, err := ResolveBucketOrigin(BucketOriginStartOfRange, rng); err != nil || !got.Equal(rng.From) {
+		t.Errorf("startOfRange: %v, %v", got, err)
+	}
+	for _, origin := range []string{"monday", "Local", "Europe/Nowhere"} {
+		if _, err := ResolveBucketOrigin(origin, rng); !errors.Is(err, ErrInvalidBucketOrigin) {
+			t.Errorf("%q: expected ErrInvalidBucketOrigin, got %v", origin, err)
+		}
+	}
+	got, err := ResolveBucketOrigin("Europe/Berlin", rng)
+	if err != nil || got.Location().String() != "Europe/Berlin" || !got.Equal(time.Date(2000, 1, 2, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("zone: %v, %v; want local midnight 2000-01-03 in Europe/Berlin", got, err)
+	}
+	if BucketZone(got) == nil {
+		t.Error("zone origin has no BucketZone")
+	}
+	for _, origin := range []string{"2026-01-05T00:00:00+01:00", "2026-01-05T00:00:00Z", BucketOriginStartOfRange} {
+		if got, _ := ResolveBucketOrigin(origin, rng); BucketZone(got) != nil {
+			t.Errorf("%q resolved to zone %v", origin, BucketZone(got))
+		}
+	}
+}
+
+func TestResolveInterval(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	threeDays := TimeRange{From: from, To: from.Add(72 * time.Hour)}
+	cases := []struct {
+		name string
+		opts MacroOptions
+		want ResolvedInterval
+	}{
+		{"no panel interval uses the ladder", MacroOptions{Range: threeDays, MaxDataPoints: 100},
+			ResolvedInterval{Interval: "10 minutes", Seconds: 600, Milliseconds: 600000, Source: IntervalFromLadder}},
+		{"panel interval", MacroOptions{Range: threeDays, Interval: 30 * time.Second},
+			ResolvedInterval{Interval: "30 seconds", Seconds: 30, Milliseconds: 30000, Source: IntervalFromPanel}},
+		{"within maxDataPoints", MacroOptions{Range: threeDays, Interval: 5 * time.Minute, MaxDataPoints: 1000},
+			ResolvedInterval{Interval: "5 minutes", Seconds: 300, Milliseconds: 300000, Source: IntervalFromPanel}},
+		{"sub-second panel interval", MacroOptions{Range: threeDays, Interval: 20 * time.Millisecond},
+			ResolvedInterval{Interval: "20 milliseconds", Seconds: 1, Milliseconds: 20, Source: IntervalFromPanel}},
+		{"rounded up to whole milliseconds", MacroOptions{Range: threeDays, Interval: 1500*time.Millisecond + 1},
+			ResolvedInterval{Interval: "1501 milliseconds", Seconds: 2, Milliseconds: 1501, Source: IntervalFromPanel}},
+		// 10s / 40 points = 250ms.
+		{"short range panel coarsened below a second", MacroOptions{Range: TimeRange{From: from, To: from.Add(10 * time.Second)}, Interval: 10 * time.Millisecond, MaxDataPoints: 40},
+			ResolvedInterval{Interval: "250 milliseconds", Seconds: 1, Milliseconds: 250, Source: IntervalFromMaxDataPoints}},
+		// 30s / 300 points = 100ms, finer than the ladder's 10 seconds.
+		{"short range without a panel interval", MacroOptions{Range: TimeRange{From: from, To: from.Add(30 * time.Second)}, MaxDataPoints: 300},
+			ResolvedInterval{Interval: "100 milliseconds", Seconds: 1, Milliseconds: 100, Source: IntervalFromMaxDataPoints}},
+		{"short range with few points keeps the ladder", MacroOptions{Range: TimeRange{From: from, To: from.Add(30 * time.Second)}, MaxDataPoints: 2},
+			ResolvedInterval{Interval: "10 seconds", Seconds: 10, Milliseconds: 10000, Source: IntervalFromLadder}},
+		{"longer range keeps the ladder", MacroOptions{Range: TimeRange{From: from, To: from.Add(2 * time.Minute)}, MaxDataPoints: 1000},
+			ResolvedInterval{Interval: "10 seconds", Seconds: 10, Milliseconds: 10000, Source: IntervalFromLadder}},
+		{"odd seconds", MacroOptions{Range: threeDays, Interval: 90 * time.Second},
+			ResolvedInterval{Interval: "90 seconds", Seconds: 90, Milliseconds: 90000, Source: IntervalFromPanel}},
+		// 72h / 300 points = 864s, rounded up to 15m.
+		{"narrow panel coarsened", MacroOptions{Range: threeDays, Interval: 30 * time.Second, MaxDataPoints: 300},
+			ResolvedInterval{Interval: "15 minutes", Seconds: 900, Milliseconds: 900000, Source: IntervalFromMaxDataPoints}},
+		{"past a week, whole days", MacroOptions{Range: TimeRange{From: from, To: from.AddDate(1, 0, 0)}, Interval: time.Hour, MaxDataPoints: 30},
+			ResolvedInterval{Interval: "13 days", Seconds: 13 * 86400, Milliseconds: 13 * 86400 * 1000, Source: IntervalFromMaxDataPoints}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ResolveInterval(c.opts); got != c.want {
+				t.Errorf("ResolveInterval = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	for secs, want := range map[int]string{
+		1: "1 second", 30: "30 seconds", 90: "90 seconds", 60: "1 minute", 5400: "90 minutes",
+		3600: "1 hour", 7200: "2 hours", 86400: "1 day", 604800: "1 week", 10 * 86400: "10 days",
+	} {
+		got := FormatInterval(secs)
+		if got != want {
+			t.Errorf("FormatInterval(%d) = %q, want %q", secs, got, want)
+		}
+		if back, ok := IntervalSeconds(got); !ok || back != secs {
+			t.Errorf("IntervalSeconds(%q) = (%d, %v), want %d", got, back, ok, secs)
+		}
+	}
+}
+
+func TestIntervalSeconds(t *testing.T) {
+	valid := map[string]int{
+		"1s": 1, "90s": 90, "15m": 900, "2h30m": 9000, "1h30m15s": 5415,
+		"1d": 86400, "7d": 604800, "1w": 604800, "2W": 1209600,
+		"30 seconds": 30, "1 second": 1, "1 minute": 60, "2 hours 30 minutes": 9000,
+		"1 day": 86400, "1 week": 604800, " 5 Minutes ": 300,
+	}
+	for in, want := range valid {
+		if got, ok := IntervalSeconds(in); !ok || got != want {
+			t.Errorf("IntervalSeconds(%q) = (%d, %v), want (%d, true)", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{
+		"", "0s", "0 seconds", "1minutes", "1 m", "500ms", "1mo", "1 month", "1 year",
+		"h", "1.5h", "-1h", "1h 30m", "30 seconds 5", "999999999999w", "1000000 days",
+	} {
+		if got, ok := IntervalSeconds(in); ok {
+			t.Errorf("IntervalSeconds(%q) = %d, want rejection", in, got)
+		}
+	}
+}
+
+func TestIntervalDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"100ms": 100 * time.Millisecond, "250 milliseconds": 250 * time.Millisecond, "1 millisecond": time.Millisecond,
+		"0.5s": 500 * time.Millisecond, "1.25s": 1250 * time.Millisecond, "1s500ms": 1500 * time.Millisecond,
+		"0.5 seconds": 500 * time.Millisecond, "1.5h": 90 * time.Minute, "15m": 15 * time.Minute, "2 hours 30 minutes": 150 * time.Minute,
+	}
+	for in, want := range valid {
+		if got, ok := IntervalDuration(in); !ok || got != want {
+			t.Errorf("IntervalDuration(%q) = (%s, %v), want (%s, true)", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "0ms", "0.0s", "0.0001s", "1.5ms", "5.s", ".5s", "100 ms", "1mo", "-100ms", "1 minutes 5"} {
+		if got, ok := IntervalDuration(in); ok {
+			t.Errorf("IntervalDuration(%q) = %s, want rejection", in, got)
+		}
+	}
+}
+
+func TestValidateTimeGroups(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT $__timeGroup(time, '100ms'), $__timeGroup(time, '$__interval') FROM cpu",
+		"SELECT '$__timeGroup(time, ''0ms'')' FROM cpu",
+		"SELECT $__timeGroup(time) FROM cpu",
+	} {
+		if err := ValidateTimeGroups(sql); err != nil {
+			t.Errorf("%s: %v", sql, err)
+		}
+	}
+	for sql, want := range map[string]string{
+		"SELECT $__timeGroup(time, '0ms') FROM cpu":         "at least 1ms",
+		"SELECT $__timeGroup(time, 0) FROM cpu":             "'100ms'",
+		"SELECT $__timeGroup(time, '0.0001s') FROM cpu":     "whole milliseconds",
+		"SELECT $__timeGroup(time, '1 fortnight') FROM cpu": "'100ms'",
+	} {
+		if err := ValidateTimeGroups(sql); !errors.Is(err, ErrInvalidInterval) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: %v, want ErrInvalidInterval mentioning %q", sql, err, want)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	cases := []struct {
+		rangeLength time.Duration
+		want        string
+	}{
+		{0, "10 seconds"},
+		{6 * time.Hour, "10 seconds"},
+		{6*time.Hour + time.Second, "1 minute"},
+		{24 * time.Hour, "1 minute"},
+		{48 * time.Hour, "10 minutes"},
+		{30 * 24 * time.Hour, "1 hour"},
+	}
+	for _, c := range cases {
+		if got := Interval(c.rangeLength).Interval; got != c.want {
+			t.Errorf("Interval(%s) = %q, want %q", c.rangeLength, got, c.want)
+		}
+	}
+	ladder := IntervalLadder()
+	ladder[0].Interval = "changed"
+	if Interval(30*24*time.Hour).Interval != "1 hour" {
+		t.Error("IntervalLadder returned the ladder itself, not a copy")
+	}
+}
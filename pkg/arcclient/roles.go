@@ -0,0 +1,133 @@
+package arcclient
+
+import (
+	"strings"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Column roles. Newer Arc versions say what each result column is — the
+// timestamp, a measure or a dimension — so a client doesn't have to guess
+// from names and types which column is time and which columns name a
+// series. The JSON endpoint sends them as a "columnMeta" array next to
+// "columns":
+//
+//	"columnMeta": [{"name": "time", "role": "timestamp"}, {"name": "host", "role": "dimension"}]
+//
+// (an entry without a name, or a bare role string, applies to the column at
+// its position), and the Arrow endpoint as ColumnRoleMetadataKey in each
+// field's metadata. The converters record them on the frame; ColumnRoles
+// reads them back. Unknown roles are ignored, and a response without any
+// leaves the frame as before.
+
+// ColumnRole is what a result column holds.
+type ColumnRole string
+
+// Column roles Arc annotates.
+const (
+	RoleTimestamp ColumnRole = "timestamp"
+	RoleMeasure   ColumnRole = "measure"
+	RoleDimension ColumnRole = "dimension"
+)
+
+// ColumnRoleMetadataKey is the Arrow field metadata key holding a column's
+// role.
+const ColumnRoleMetadataKey = "arc.role"
+
+// ColumnRolesMetaKey is the FrameMeta.Custom key holding a frame's
+// map[string]ColumnRole, keyed by field name. Code replacing a converted
+// frame's Meta keeps the roles under it.
+const ColumnRolesMetaKey = "columnRoles"
+
+// ColumnRoles returns the roles Arc annotated frame's columns with, keyed
+// by field name; nil when the response carried none.
+func ColumnRoles(frame *data.Frame) map[string]ColumnRole {
+	if frame == nil || frame.Meta == nil {
+		return nil
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	roles, _ := custom[ColumnRolesMetaKey].(map[string]ColumnRole)
+	return roles
+}
+
+// parseColumnRole reads a role as Arc spells it, case-insensitively.
+func parseColumnRole(s string) (ColumnRole, bool) {
+	switch role := ColumnRole(strings.ToLower(strings.TrimSpace(s))); role {
+	case RoleTimestamp, RoleMeasure, RoleDimension:
+		return role, true
+	}
+	return "", false
+}
+
+// noteColumnRoles records roles on frame; nothing when there are none.
+func noteColumnRoles(frame *data.Frame, roles map[string]ColumnRole) {
+	if len(roles) == 0 {
+		return
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		custom = map[string]interface{}{}
+		frame.Meta.Custom = custom
+	}
+	custom[ColumnRolesMetaKey] = roles
+}
+
+// jsonColumnRoles reads a JSON result's "columnMeta" array (see above) for
+// the named columns; nil when it is absent or names no known role.
+func jsonColumnRoles(columnMeta interface{}, columns []string) map[string]ColumnRole {
+	raw, ok := columnMeta.([]interface{})
+	if !ok {
+		return nil
+	}
+	known := make(map[string]bool, len(columns))
+	for _, name := range columns {
+		known[name] = true
+	}
+	roles := map[string]ColumnRole{}
+	for i, entry := range raw {
+		var name, role string
+		switch e := entry.(type) {
+		case string:
+			role = e
+		case map[string]interface{}:
+			name, _ = e["name"].(string)
+			role, _ = e["role"].(string)
+		}
+		if name == "" && i < len(columns) {
+			name = columns[i]
+		}
+		if r, ok := parseColumnRole(role); ok && known[name] {
+			roles[name] = r
+		}
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	return roles
+}
+
+// arrowColumnRoles reads ColumnRoleMetadataKey from schema's fields; nil
+// when no field has a known role.
+func arrowColumnRoles(schema *arrow.Schema) map[string]ColumnRole {
+	var roles map[string]ColumnRole
+	for _, f := range schema.Fields() {
+		v, ok := f.Metadata.GetValue(ColumnRoleMetadataKey)
+		if !ok {
+			continue
+		}
+		if r, ok := parseColumnRole(v); ok {
+			if roles == nil {
+				roles = map[string]ColumnRole{}
+			}
+			roles[f.Name] = r
+		}
+	}
+	return roles
+}
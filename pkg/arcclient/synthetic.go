@@ -0,0 +1,77 @@
+package arcclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+)
+
+// syntheticEpoch is the first timestamp of a synthetic stream.
+var syntheticEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SyntheticArrowStream encodes an in-memory Arrow IPC stream shaped like a
+// typical Arc time series result, for measuring the converter: rows rows in
+// record batches of at most batchRows, and columns columns — a nanosecond
+// "time" one second apart, a "host" string cycling through ten hosts, then
+// value columns alternating nullable float64 (every seventh value null)
+// and int64. The content is deterministic, so runs compare.
+func SyntheticArrowStream(rows, columns, batchRows int) ([]byte, error) {
+	if rows < 0 || columns < 1 || batchRows < 1 {
+		return nil, errors.New("synthetic stream: rows must be non-negative, columns and batchRows positive")
+	}
+	fields := []arrow.Field{{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}}}
+	if columns > 1 {
+		fields = append(fields, arrow.Field{Name: "host", Type: arrow.BinaryTypes.String})
+	}
+	for i := 2; i < columns; i++ {
+		if i%2 == 0 {
+			fields = append(fields, arrow.Field{Name: fmt.Sprintf("value_%d", i), Type: arrow.PrimitiveTypes.Float64, Nullable: true})
+		} else {
+			fields = append(fields, arrow.Field{Name: fmt.Sprintf("count_%d", i), Type: arrow.PrimitiveTypes.Int64})
+		}
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	pool := memory.NewGoAllocator()
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(pool))
+	b := array.NewRecordBuilder(pool, schema)
+	defer b.Release()
+	base := syntheticEpoch.UnixNano()
+	for start := 0; start < rows; start += batchRows {
+		end := min(start+batchRows, rows)
+		for row := start; row < end; row++ {
+			b.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(base + int64(row)*int64(time.Second)))
+			for i := 1; i < columns; i++ {
+				switch col := b.Field(i).(type) {
+				case *array.StringBuilder:
+					col.Append(fmt.Sprintf("host-%d", row%10))
+				case *array.Float64Builder:
+					if row%7 == 6 {
+						col.AppendNull()
+					} else {
+						col.Append(float64(row%1000) / 10)
+					}
+				case *array.Int64Builder:
+					col.Append(int64(row * i))
+				}
+			}
+		}
+		rec := b.NewRecord()
+		err := w.Write(rec)
+		rec.Release()
+		if err != nil {
+			return nil, fmt.Errorf("synthetic stream: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("synthetic stream: %w", err)
+	}
+	return buf.Bytes(), nil
+}
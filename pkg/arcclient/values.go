@@ -0,0 +1,229 @@
+package arcclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Value macros: $__in(col, values) and $__quote(values) write a
+// multi-value variable as SQL however Grafana interpolated it — a JSON
+// array or string (${var:json}, the form that survives any value), the
+// datasource's own quoted list ('a','b'), double-quoted values
+// (${var:doublequote}), Grafana's {a,b} or plain CSV (${var:csv}). Every
+// value becomes a single-quoted literal with its quotes doubled; JSON
+// numbers stay numbers and JSON nulls are dropped.
+//
+//   - $__in(col, values) expands to col IN ('a','b'). With no values it
+//     expands to 1=0, or to 1=1 when a last argument includeAll says an
+//     empty selection means all: $__in(host, ${host:json}, includeAll).
+//   - $__quote(values) expands to 'a','b', or NULL with no values, for
+//     lists $__in doesn't fit.
+//
+// Only JSON and quoted values can hold commas; bare CSV values are split at
+// every one. A value literally called includeAll must be quoted to be read
+// as a value. A macro whose arguments don't parse is left unexpanded.
+
+// includeAllHint is the optional last argument of $__in.
+const includeAllHint = "includeAll"
+
+// ExpandValueMacros expands $__in and $__quote in sql (see above).
+// ExpandMacros calls it first, before the other macros; callers that look
+// at the SQL before expanding the rest can call it earlier on its own.
+func ExpandValueMacros(sql string) string {
+	return replaceMacros(sql, []string{"$__in(", "$__quote("}, valueArgsEnd, func(macro, arg string) (string, bool) {
+		args := splitValueArgs(arg)
+		var (
+			expanded string
+			err      error
+		)
+		if macro == "$__in(" {
+			expanded, err = expandIn(args)
+		} else {
+			expanded, err = expandQuote(args)
+		}
+		if err != nil {
+			log.DefaultLogger.Warn("Value macro left unexpanded", "macro", strings.TrimSuffix(macro, "("), "error", err.Error())
+			return "", false
+		}
+		return expanded, true
+	})
+}
+
+// expandIn expands $__in's arguments: a column, the values and the
+// optional includeAll hint.
+func expandIn(args []string) (string, error) {
+	if len(args) < 2 {
+		return "", errors.New("$__in takes a column and the values")
+	}
+	column := strings.TrimSpace(args[0])
+	if err := ValidateColumn(column); err != nil {
+		return "", err
+	}
+	includeAll := false
+	if len(args) > 2 && strings.EqualFold(strings.TrimSpace(args[len(args)-1]), includeAllHint) {
+		includeAll, args = true, args[:len(args)-1]
+	}
+	values, err := valueLiterals(args[1:])
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(values) > 0:
+		return column + " IN (" + strings.Join(values, ",") + ")", nil
+	case includeAll:
+		return "1=1", nil
+	}
+	return "1=0", nil
+}
+
+// expandQuote expands $__quote's arguments, the values.
+func expandQuote(args []string) (string, error) {
+	values, err := valueLiterals(args)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "NULL", nil
+	}
+	return strings.Join(values, ","), nil
+}
+
+// valueLiterals reads the values of a value macro, args being its
+// arguments after any column, as SQL literals.
+func valueLiterals(args []string) ([]string, error) {
+	if len(args) == 1 {
+		arg := strings.TrimSpace(args[0])
+		switch {
+		case strings.HasPrefix(arg, "["):
+			return jsonValueLiterals(arg)
+		case strings.HasPrefix(arg, "{") && strings.HasSuffix(arg, "}"):
+			args = splitValueArgs(arg[1 : len(arg)-1])
+		}
+	}
+	var values []string
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		switch {
+		case arg == "":
+			continue
+		case arg[0] == '\'':
+			if len(arg) < 2 || arg[len(arg)-1] != '\'' || strings.Contains(strings.ReplaceAll(arg[1:len(arg)-1], "''", ""), "'") {
+				return nil, fmt.Errorf("value %s is not a complete quoted string", arg)
+			}
+			values = append(values, arg)
+		case arg[0] == '"':
+			var v string
+			if err := json.Unmarshal([]byte(arg), &v); err != nil {
+				return nil, fmt.Errorf("value %s is not a complete quoted string", arg)
+			}
+			values = append(values, quoteLiteral(v))
+		default:
+			values = append(values, quoteLiteral(arg))
+		}
+	}
+	return values, nil
+}
+
+// jsonValueLiterals reads a JSON array of strings, numbers, booleans and
+// nulls as SQL literals.
+func jsonValueLiterals(arg string) ([]string, error) {
+	dec := json.NewDecoder(strings.NewReader(arg))
+	dec.UseNumber()
+	var items []any
+	if err := dec.Decode(&items); err != nil {
+		return nil, fmt.Errorf("values are not a JSON array: %w", err)
+	}
+	if dec.More() {
+		return nil, errors.New("values hold more than one JSON array")
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case nil:
+		case string:
+			values = append(values, quoteLiteral(v))
+		case json.Number:
+			values = append(values, v.String())
+		case bool:
+			values = append(values, quoteLiteral(fmt.Sprint(v)))
+		default:
+			return nil, fmt.Errorf("value %v is not a string or a number", v)
+		}
+	}
+	return values, nil
+}
+
+// quoteLiteral writes v as a single-quoted SQL string literal.
+func quoteLiteral(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+// splitValueArgs splits a value macro's argument list at the commas
+// outside quotes and brackets.
+func splitValueArgs(arg string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(arg); i++ {
+		switch arg[i] {
+		case '\'', '"':
+			i = quotedEnd(arg, i) - 1
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, arg[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(args, arg[start:])
+}
+
+// valueArgsEnd is MatchingParen for a value macro, whose arguments may
+// hold JSON strings: it skips "..." with backslash escapes as well as
+// '...' literals. Returns -1 if no match is found.
+func valueArgsEnd(sql string, openIdx int) int {
+	if openIdx >= len(sql) || sql[openIdx] != '(' {
+		return -1
+	}
+	depth := 0
+	for i := openIdx; i < len(sql); i++ {
+		switch sql[i] {
+		case '\'', '"':
+			i = quotedEnd(sql, i) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// quotedEnd returns the index just past the quoted string starting at
+// s[start]: a literal in single quotes, where a quote is doubled, or a
+// string in double quotes, where it is doubled or backslash-escaped. An
+// unterminated string runs to the end of s.
+func quotedEnd(s string, start int) int {
+	q := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q && i+1 < len(s) && s[i+1] == q:
+			i++
+		case s[i] == q:
+			return i + 1
+		}
+	}
+	return len(s)
+}
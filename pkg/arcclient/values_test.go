@@ -0,0 +1,59 @@
+package arcclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpandValueMacros(t *testing.T) {
+	cases := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"json", `WHERE $__in(host, ["a","b","c"])`, `WHERE host IN ('a','b','c')`},
+		{"json quotes", `WHERE $__in(host, ["o'neil","say \"hi\""])`, `WHERE host IN ('o''neil','say "hi"')`},
+		{"json commas and parens", `WHERE $__in(host, ["a,b","c)d"]) AND x = 1`, `WHERE host IN ('a,b','c)d') AND x = 1`},
+		{"json unicode", `WHERE $__in(city, ["Zürich","東京","é"])`, `WHERE city IN ('Zürich','東京','é')`},
+		{"json numbers and nulls", `WHERE $__in(id, [1, 2.5, null])`, `WHERE id IN (1,2.5)`},
+		{"json single value", `WHERE $__in(host, "o'neil")`, `WHERE host IN ('o''neil')`},
+		{"quoted list", `WHERE $__in(t.host, 'a','o''neil', 'x,y')`, `WHERE t.host IN ('a','o''neil','x,y')`},
+		{"glob braces", `WHERE $__in(host, {a,b})`, `WHERE host IN ('a','b')`},
+		{"csv", `WHERE $__in(host, a, b ,c)`, `WHERE host IN ('a','b','c')`},
+		{"double quoted", `WHERE $__in(host, "a","b")`, `WHERE host IN ('a','b')`},
+		{"empty json", `WHERE $__in(host, [])`, `WHERE 1=0`},
+		{"empty csv", `WHERE $__in(host, )`, `WHERE 1=0`},
+		{"empty with includeAll", `WHERE $__in(host, [], includeAll)`, `WHERE 1=1`},
+		{"values with includeAll", `WHERE $__in(host, ["a"], includeall)`, `WHERE host IN ('a')`},
+		{"quoted includeAll is a value", `WHERE $__in(host, 'a', 'includeAll')`, `WHERE host IN ('a','includeAll')`},
+		{"quote", `SELECT list_contains([$__quote(["a","it's"])], host)`, `SELECT list_contains(['a','it''s'], host)`},
+		{"quote csv", `WHERE host IN ($__quote(a,b))`, `WHERE host IN ('a','b')`},
+		{"quote empty", `WHERE host IN ($__quote([]))`, `WHERE host IN (NULL)`},
+		{"both in one pass", `WHERE $__quote(["x'"]) = a AND $__in(host, ["y'"])`, `WHERE 'x''' = a AND host IN ('y''')`},
+		{"literals and comments untouched", "SELECT '$__in(a, [1])' -- $__quote([1])\nFROM t", "SELECT '$__in(a, [1])' -- $__quote([1])\nFROM t"},
+		{"unsafe column", `WHERE $__in(host; DROP TABLE t, ["a"])`, `WHERE $__in(host; DROP TABLE t, ["a"])`},
+		{"no values", `WHERE $__in(host)`, `WHERE $__in(host)`},
+		{"bad json", `WHERE $__in(host, ["a",])`, `WHERE $__in(host, ["a",])`},
+		{"doubled quote at the end", `WHERE $__in(host, 'a''')`, `WHERE host IN ('a''')`},
+		{"unterminated quote", `WHERE $__in(host, 'a)`, `WHERE $__in(host, 'a)`},
+		{"interval untouched", `SELECT $__interval`, `SELECT $__interval`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ExpandValueMacros(c.sql); got != c.want {
+				t.Errorf("ExpandValueMacros(%q) =\n%q\nwant\n%q", c.sql, got, c.want)
+			}
+		})
+	}
+}
+
+// TestExpandMacros_ValueMacrosFirst: a quote inside a JSON argument doesn't
+// hide the time filter after it from the other macros.
+func TestExpandMacros_ValueMacrosFirst(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	got := ExpandMacros(`WHERE $__in(host, ["o'neil"]) AND $__timeFilter(time)`, MacroOptions{Range: TimeRange{From: from, To: from.Add(time.Hour)}})
+	want := `WHERE host IN ('o''neil') AND time >= '2026-03-01T00:00:00Z' AND time < '2026-03-01T01:00:00Z'`
+	if got != want {
+		t.Errorf("ExpandMacros =\n%q\nwant\n%q", got, want)
+	}
+}
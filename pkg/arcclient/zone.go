@@ -0,0 +1,191 @@
+package arcclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // zone names resolve the same on hosts without a zoneinfo database
+)
+
+// Zone-aligned days. A bucketOrigin naming an IANA zone ("Europe/Berlin")
+// makes whole-day $__timeGroup buckets, and whole-day split chunks, start
+// at local midnight, so a day over a DST change is 23 or 25 hours long as
+// Grafana's time picker shows it. Widths that divide a day (6h, 15m) are
+// laid out from each local midnight by elapsed time: every local midnight
+// stays a boundary, and the last bucket of a 23-hour day is an hour short
+// where a 25-hour day gets an extra one, rather than a wall-clock hour
+// being skipped or counted twice. DuckDB would need its ICU extension to
+// do that; instead the zone's UTC offsets over the query range are worked
+// out here and written into the SQL as a CASE on epoch seconds, and the
+// chunk boundaries come from the same tables, so chunks and buckets can't
+// disagree.
+//
+// A local day's start is its midnight in the offset in effect at that
+// midnight. In the few zones that change offset at midnight, a skipped
+// midnight starts the day at the change. Rows outside the range (padded by
+// zonePad) take the nearest offset in the table.
+
+// zonePad widens the range a zone's offset table covers, so rows a little
+// outside the range still bucket on their own local day.
+const zonePad = 48 * time.Hour
+
+// BucketZone is the zone origin was resolved from when bucketOrigin named
+// one (see ResolveBucketOrigin), else nil. Origins parsed from RFC3339 are
+// in UTC, the process's Local or an unnamed fixed offset, never a named
+// zone.
+func BucketZone(origin time.Time) *time.Location {
+	loc := origin.Location()
+	if loc == time.UTC || loc == time.Local || loc.String() == "" {
+		return nil
+	}
+	return loc
+}
+
+// zoneDays is a zone's UTC offsets over a range: off[0] before at[0],
+// off[i+1] from at[i]. dayFrom[i] is the first local day whose start is in
+// off[i+1].
+type zoneDays struct {
+	at      []int64
+	off     []int64
+	dayFrom []int64
+}
+
+// newZoneDays tabulates loc's offsets over [from, to], padded by zonePad.
+func newZoneDays(loc *time.Location, from, to time.Time) zoneDays {
+	end := to.Add(zonePad)
+	t := from.Add(-zonePad).In(loc)
+	_, off := t.Zone()
+	z := zoneDays{off: []int64{int64(off)}}
+	for {
+		_, next := t.ZoneBounds()
+		if next.IsZero() || !next.Before(end) {
+			break
+		}
+		t = next.In(loc)
+		if _, off := t.Zone(); int64(off) != z.off[len(z.off)-1] {
+			z.at = append(z.at, next.Unix())
+			z.off = append(z.off, int64(off))
+			// The first midnight, in the new offset, at or after the change.
+			z.dayFrom = append(z.dayFrom, -floorDiv(-(next.Unix()+int64(off)), secondsPerDay))
+		}
+	}
+	return z
+}
+
+// offsetAt is the offset at epoch second e.
+func (z zoneDays) offsetAt(e int64) int64 {
+	i := 0
+	for i < len(z.at) && e >= z.at[i] {
+		i++
+	}
+	return z.off[i]
+}
+
+// day is the local day, counted from 1970-01-01, of epoch second e.
+func (z zoneDays) day(e int64) int64 {
+	return floorDiv(e+z.offsetAt(e), secondsPerDay)
+}
+
+// dayStart is the epoch second local day d starts at.
+func (z zoneDays) dayStart(d int64) int64 {
+	i := 0
+	for i < len(z.dayFrom) && d >= z.dayFrom[i] {
+		i++
+	}
+	return d*secondsPerDay - z.off[i]
+}
+
+// caseSQL is a CASE over expr picking off[i] below thresholds[i], or the
+// constant offset when the table has none.
+func (z zoneDays) caseSQL(expr string, thresholds []int64) string {
+	if len(thresholds) == 0 {
+		return fmt.Sprint(z.off[0])
+	}
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i, th := range thresholds {
+		fmt.Fprintf(&b, " WHEN %s < %d THEN %d", expr, th, z.off[i])
+	}
+	fmt.Fprintf(&b, " ELSE %d END", z.off[len(z.off)-1])
+	return b.String()
+}
+
+// zoneAligned reports whether buckets or chunks secs wide follow origin's
+// zone: whole days, or widths that divide a day.
+func zoneAligned(secs int64, origin time.Time) bool {
+	return BucketZone(origin) != nil && secs > 0 && (secs%secondsPerDay == 0 || secondsPerDay%secs == 0)
+}
+
+// bucketSQL buckets column into secs-wide zone-aligned buckets (see
+// zoneAligned); whole-day ones are counted from local day originDay.
+func (z zoneDays) bucketSQL(column string, secs, originDay int64) string {
+	epoch := fmt.Sprintf("(epoch_ns(%s) // 1000000000)", column)
+	day := fmt.Sprintf("((%s + %s) // %d)", epoch, z.caseSQL(epoch, z.at), secondsPerDay)
+	if secs < secondsPerDay {
+		start := fmt.Sprintf("(%s * %d - %s)", day, secondsPerDay, z.caseSQL(day, z.dayFrom))
+		return fmt.Sprintf("to_timestamp(%s + ((%s - %s) // %d) * %d)", start, epoch, start, secs, secs)
+	}
+	if days := secs / secondsPerDay; days > 1 {
+		od := floorMod(originDay, days)
+		day = fmt.Sprintf("(((%s - %d) // %d) * %d + %d)", day, od, days, days, od)
+	}
+	return fmt.Sprintf("to_timestamp(%s * %d - %s)", day, secondsPerDay, z.caseSQL(day, z.dayFrom))
+}
+
+// localDay is the day, counted from 1970-01-01, of t's date in loc.
+func localDay(t time.Time, loc *time.Location) int64 {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / secondsPerDay
+}
+
+// ZoneAligned reports whether width-wide $__timeGroup buckets follow
+// origin's zone (see zone.go): origin names a zone and width is a whole
+// number of days or divides one.
+func ZoneAligned(width time.Duration, origin time.Time) bool {
+	return width%time.Second == 0 && zoneAligned(int64(width/time.Second), origin)
+}
+
+// ZoneBoundaries returns the edges of origin's zone-aligned buckets width
+// wide that fall strictly inside (from, to), in order: the edges
+// $__timeGroup with that width draws. Nil unless ZoneAligned.
+func ZoneBoundaries(from, to time.Time, width time.Duration, origin time.Time) []time.Time {
+	if !ZoneAligned(width, origin) || !from.Before(to) {
+		return nil
+	}
+	loc, secs := BucketZone(origin), int64(width/time.Second)
+	z := newZoneDays(loc, from, to)
+	days := max(1, secs/secondsPerDay)
+	od := floorMod(localDay(origin, loc), days)
+	d := floorDiv(z.day(from.Unix())-od, days)*days + od
+	var out []time.Time
+	for ; ; d += days {
+		start, end := z.dayStart(d), z.dayStart(d+days)
+		step := secs
+		if secs >= secondsPerDay {
+			step = end - start
+		}
+		for e := start; e < end; e += step {
+			b := time.Unix(e, 0).UTC()
+			if !b.Before(to) {
+				return out
+			}
+			if b.After(from) {
+				out = append(out, b)
+			}
+		}
+	}
+}
+
+// floorDiv is a / b rounded down, for b > 0.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b < 0 {
+		q--
+	}
+	return q
+}
+
+// floorMod is a mod b in [0, b), for b > 0.
+func floorMod(a, b int64) int64 {
+	return a - floorDiv(a, b)*b
+}
@@ -0,0 +1,214 @@
+package arcclient
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func zoneOrigin(t *testing.T, zone string) time.Time {
+	t.Helper()
+	origin, err := ResolveBucketOrigin(zone, TimeRange{})
+	if err != nil {
+		t.Fatalf("ResolveBucketOrigin(%q): %v", zone, err)
+	}
+	return origin
+}
+
+// TestZoneDays_DayStartIsLocalMidnight checks the offset tables against
+// the zone database: every local day over two years starts at the instant
+// time.Date gives for its midnight, DST days included.
+func TestZoneDays_DayStartIsLocalMidnight(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(2, 0, 0)
+	for _, zone := range []string{"Europe/Berlin", "America/New_York", "Australia/Sydney", "Australia/Lord_Howe", "Asia/Kolkata", "UTC"} {
+		loc, _ := time.LoadLocation(zone)
+		z := newZoneDays(loc, from, to)
+		for d := localDay(from, loc); d < localDay(to, loc); d++ {
+			date := time.Unix(d*secondsPerDay, 0).UTC()
+			want := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+			if got := z.dayStart(d); got != want.Unix() {
+				t.Fatalf("%s %s: day starts at %v, want %v", zone, date.Format(time.DateOnly), time.Unix(got, 0).UTC(), want.UTC())
+			}
+			if got := z.day(want.Unix()); got != d {
+				t.Fatalf("%s %s: midnight is on day %d, want %d", zone, date.Format(time.DateOnly), got, d)
+			}
+		}
+	}
+}
+
+func TestZoneBoundaries_DST(t *testing.T) {
+	berlin := zoneOrigin(t, "Europe/Berlin")
+	utc := func(day, hour int, month time.Month) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		name     string
+		from, to time.Time
+		width    time.Duration
+		want     []time.Time
+	}{
+		{"spring forward: a 23-hour day", utc(28, 12, time.March), utc(31, 0, time.March), 24 * time.Hour,
+			[]time.Time{utc(28, 23, time.March), utc(29, 22, time.March), utc(30, 22, time.March)}},
+		{"fall back: a 25-hour day", utc(24, 12, time.October), utc(27, 0, time.October), 24 * time.Hour,
+			[]time.Time{utc(24, 22, time.October), utc(25, 23, time.October), utc(26, 23, time.October)}},
+		{"6h over fall back: a short last bucket", utc(24, 20, time.October), utc(26, 0, time.October), 6 * time.Hour,
+			[]time.Time{utc(24, 22, time.October), utc(25, 4, time.October), utc(25, 10, time.October), utc(25, 16, time.October), utc(25, 22, time.October), utc(25, 23, time.October)}},
+		{"7d weeks start on local Monday", utc(20, 0, time.March), utc(10, 0, time.April), 7 * 24 * time.Hour,
+			[]time.Time{utc(22, 23, time.March), utc(29, 22, time.March), utc(5, 22, time.April)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ZoneBoundaries(c.from, c.to, c.width, berlin)
+			if len(got) != len(c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if !got[i].Equal(c.want[i]) {
+					t.Errorf("boundary %d = %v, want %v", i, got[i], c.want[i])
+				}
+			}
+		})
+	}
+
+	if ZoneAligned(7*time.Hour, berlin) || ZoneBoundaries(utc(28, 0, time.March), utc(30, 0, time.March), 7*time.Hour, berlin) != nil {
+		t.Error("7h divides no day and should keep the fixed grid")
+	}
+	if ZoneAligned(24*time.Hour, time.Time{}) {
+		t.Error("epoch origin reported zone-aligned")
+	}
+}
+
+// TestExpandTimeGroup_ZoneMatchesBoundaries evaluates the $__timeGroup SQL
+// a zone origin expands to for every 15 minutes across both of Berlin's
+// 2026 DST changes, and checks each row lands in the bucket ZoneBoundaries
+// draws: the split code and the SQL agree.
+func TestExpandTimeGroup_ZoneMatchesBoundaries(t *testing.T) {
+	berlin := zoneOrigin(t, "Europe/Berlin")
+	for _, rng := range []TimeRange{
+		{From: time.Date(2026, 3, 27, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{From: time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 10, 27, 0, 0, 0, 0, time.UTC)},
+	} {
+		for _, width := range []string{"1d", "2d", "6h", "1h"} {
+			w, _ := IntervalDuration(width)
+			sql := ExpandMacros("$__timeGroup(time, '"+width+"')", MacroOptions{Range: rng, BucketOrigin: berlin})
+			bounds := ZoneBoundaries(rng.From, rng.To, w, berlin)
+			for ts := rng.From; ts.Before(rng.To); ts = ts.Add(15 * time.Minute) {
+				// The bucket is the last boundary at or before ts (or the
+				// one before the range, which the SQL gives as well).
+				want := time.Time{}
+				for _, b := range bounds {
+					if !b.After(ts) {
+						want = b
+					}
+				}
+				got := evalBucketSQL(t, sql, ts)
+				if !want.IsZero() && !got.Equal(want) {
+					t.Fatalf("%s at %v: bucket %v, want %v", width, ts, got, want)
+				}
+				if got.After(ts) {
+					t.Fatalf("%s at %v: bucket %v starts after the row", width, ts, got)
+				}
+			}
+		}
+	}
+}
+
+// evalBucketSQL evaluates an expanded zone $__timeGroup for a row at ts.
+// It understands just what bucketSQL writes: integers, + - * //, CASE
+// WHEN a < b THEN x ... ELSE y END and to_timestamp.
+func evalBucketSQL(t *testing.T, sql string, ts time.Time) time.Time {
+	t.Helper()
+	sql = strings.ReplaceAll(sql, "epoch_ns(time)", strconv.FormatInt(ts.UnixNano(), 10))
+	sql = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(sql)
+	p := &sqlEval{t: t, toks: strings.Fields(sql)}
+	p.want("to_timestamp")
+	p.want("(")
+	v := p.expr()
+	p.want(")")
+	return time.Unix(v, 0).UTC()
+}
+
+type sqlEval struct {
+	t    *testing.T
+	toks []string
+}
+
+func (p *sqlEval) peek() string {
+	if len(p.toks) == 0 {
+		return ""
+	}
+	return p.toks[0]
+}
+
+func (p *sqlEval) next() string {
+	tok := p.peek()
+	p.toks = p.toks[1:]
+	return tok
+}
+
+func (p *sqlEval) want(tok string) {
+	if got := p.next(); got != tok {
+		p.t.Fatalf("sql eval: got %q, want %q", got, tok)
+	}
+}
+
+func (p *sqlEval) expr() int64 {
+	v := p.term()
+	for p.peek() == "+" || p.peek() == "-" {
+		if p.next() == "+" {
+			v += p.term()
+		} else {
+			v -= p.term()
+		}
+	}
+	return v
+}
+
+func (p *sqlEval) term() int64 {
+	v := p.factor()
+	for p.peek() == "*" || p.peek() == "//" {
+		if p.next() == "*" {
+			v *= p.factor()
+		} else {
+			v /= p.factor() // DuckDB's // truncates, like Go's /
+		}
+	}
+	return v
+}
+
+func (p *sqlEval) factor() int64 {
+	switch tok := p.next(); tok {
+	case "(":
+		v := p.expr()
+		p.want(")")
+		return v
+	case "CASE":
+		var v int64
+		matched := false
+		for p.peek() == "WHEN" {
+			p.next()
+			a := p.expr()
+			p.want("<")
+			b := p.expr()
+			p.want("THEN")
+			x := p.expr()
+			if !matched && a < b {
+				v, matched = x, true
+			}
+		}
+		p.want("ELSE")
+		if y := p.expr(); !matched {
+			v = y
+		}
+		p.want("END")
+		return v
+	default:
+		v, err := strconv.ParseInt(tok, 10, 64)
+		if err != nil {
+			p.t.Fatalf("sql eval: unexpected %q", tok)
+		}
+		return v
+	}
+}
@@ -12,8 +12,9 @@ func main() {
 	ds := plugin.NewArcDatasource()
 
 	if err := datasource.Serve(datasource.ServeOpts{
-		QueryDataHandler:   ds,
-		CheckHealthHandler: ds,
+		QueryDataHandler:    ds,
+		CheckHealthHandler:  ds,
+		CallResourceHandler: ds,
 	}); err != nil {
 		log.DefaultLogger.Error(err.Error())
 		os.Exit(1)
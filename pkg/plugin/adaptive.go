@@ -0,0 +1,160 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Adaptive execution thresholds (AdaptiveExecution setting). The estimate is
+// the row count of the query's own result, so the thresholds are in
+// response rows:
+//
+//   - ≤ adaptiveJSONMaxRows: JSON. A few thousand rows decode faster as
+//     JSON than through Arrow IPC's schema and batch framing.
+//   - < adaptiveSplitMinRows: no splitting. Below this a single request
+//     beats N chunk round trips plus the merge.
+//   - ≤ the time-series row cap: the LIMIT safety net is dropped. The query
+//     provably fits, and a split query no longer has its budget divided
+//     evenly across chunks, which could clip a dense chunk while sparse
+//     ones are under budget.
+const (
+	adaptiveJSONMaxRows  = 10_000
+	adaptiveSplitMinRows = 500_000
+)
+
+// adaptiveEstimateTimeout bounds the count(*) estimate. An estimate slower
+// than this defeats its purpose; the query then runs as configured.
+const adaptiveEstimateTimeout = 5 * time.Second
+
+// adaptiveMetaKey is the FrameMeta.Custom key holding the adaptivePlan.
+const adaptiveMetaKey = "adaptiveExecution"
+
+// adaptivePlan is what the estimate phase decided, and why. It is attached
+// to the response frames' meta so "why did this panel use JSON?" can be
+// answered from the query inspector.
+type adaptivePlan struct {
+	EstimatedRows int64    `json:"estimatedRows"`
+	Protocol      string   `json:"protocol,omitempty"` // "Arrow" or "JSON"; empty when the setting was explicit
+	Split         bool     `json:"split"`
+	RowCap        int64    `json:"rowCap"`
+	Reasons       []string `json:"reasons"`
+}
+
+// decideAdaptive applies the thresholds above to an estimate. Only choices
+// left on auto are touched: protocol when UseArrow is unset (arrowAvailable
+// is the auto-probe's answer), splitting when SplitDuration is auto and the
+// split heuristics allowed it. It never turns splitting on — the heuristics
+// that said no were about correctness, not size.
+func decideAdaptive(estimate int64, autoProtocol, arrowAvailable, autoSplit, splitting bool, rowCap int64) adaptivePlan {
+	plan := adaptivePlan{EstimatedRows: estimate, Split: splitting, RowCap: rowCap}
+
+	if autoProtocol {
+		switch {
+		case !arrowAvailable:
+			plan.Protocol = "JSON"
+			plan.Reasons = append(plan.Reasons, "JSON: the server doesn't offer Arrow")
+		case estimate <= adaptiveJSONMaxRows:
+			plan.Protocol = "JSON"
+			plan.Reasons = append(plan.Reasons, fmt.Sprintf("JSON: %d rows ≤ %d, below Arrow's framing overhead", estimate, adaptiveJSONMaxRows))
+		default:
+			plan.Protocol = "Arrow"
+			plan.Reasons = append(plan.Reasons, fmt.Sprintf("Arrow: %d rows > %d", estimate, adaptiveJSONMaxRows))
+		}
+	}
+
+	if autoSplit && splitting && estimate < adaptiveSplitMinRows {
+		plan.Split = false
+		plan.Reasons = append(plan.Reasons, fmt.Sprintf("no split: %d rows < %d", estimate, adaptiveSplitMinRows))
+	}
+
+	if rowCap > 0 {
+		if estimate <= rowCap {
+			plan.RowCap = 0
+			plan.Reasons = append(plan.Reasons, fmt.Sprintf("no row cap: %d rows fit the cap of %d", estimate, rowCap))
+		} else {
+			plan.Reasons = append(plan.Reasons, fmt.Sprintf("row cap kept: %d rows exceed the cap of %d", estimate, rowCap))
+		}
+	}
+	return plan
+}
+
+// planAdaptive runs the estimate phase for a query: `SELECT count(*)` over
+// the macro-expanded query (full dashboard range, no row cap), then
+// decideAdaptive. Returns nil whenever the estimate can't be had — statements
+// that aren't a single SELECT, a failed or slow count, an unreadable answer
+// — and the caller proceeds exactly as without AdaptiveExecution.
+func (s *ArcInstanceSettings) planAdaptive(ctx context.Context, qm ArcQuery, sql string, stripped strippedSQL, splitting bool, rowCap int64) *adaptivePlan {
+	head := strings.TrimSpace(stripped.upper)
+	if !(strings.HasPrefix(head, "SELECT") || strings.HasPrefix(head, "WITH")) || containsMultipleStatements(stripped) {
+		return nil
+	}
+	estimate, err := s.estimateRows(ctx, sql)
+	if err != nil {
+		log.DefaultLogger.Debug("Adaptive execution estimate failed; running as configured",
+			"refId", qm.RefID, "error", err.Error())
+		return nil
+	}
+	autoSplit := qm.SplitDuration == "" || qm.SplitDuration == "auto"
+	plan := decideAdaptive(estimate, s.settings.UseArrow == nil, s.useArrow(ctx), autoSplit, splitting, rowCap)
+	log.DefaultLogger.Debug("Adaptive execution plan", "refId", qm.RefID,
+		"estimatedRows", estimate, "protocol", plan.Protocol, "split", plan.Split, "rowCap", plan.RowCap)
+	return &plan
+}
+
+// estimateRows counts the rows sql returns. The count is always fetched
+// over JSON: it's a one-cell answer. The newlines keep a trailing line
+// comment in sql from swallowing the closing parenthesis.
+func (s *ArcInstanceSettings) estimateRows(ctx context.Context, sql string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, adaptiveEstimateTimeout)
+	defer cancel()
+	sql = strings.TrimRight(sql, "; \t\n\r")
+	frames, err := queryJSON(ctx, s, attributed(ctx, "SELECT count(*) AS n FROM (\n"+sql+"\n) AS arc_estimate"))
+	if err != nil {
+		return 0, err
+	}
+	if len(frames) != 1 || len(frames[0].Fields) != 1 || frames[0].Rows() != 1 {
+		return 0, errors.New("unexpected count(*) result shape")
+	}
+	n, err := frames[0].Fields[0].FloatAt(0)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("unreadable count(*) result: %v", err)
+	}
+	return int64(n), nil
+}
+
+// withProtocol returns settings that use the plan's protocol for this one
+// query. The shallow copy keeps the shared client, semaphore and caches, as
+// in withDatabaseOverride.
+func (s *ArcInstanceSettings) withProtocol(plan *adaptivePlan) *ArcInstanceSettings {
+	if plan == nil || plan.Protocol == "" {
+		return s
+	}
+	arrow := plan.Protocol == "Arrow"
+	adapted := *s
+	adapted.settings.UseArrow = &arrow
+	return &adapted
+}
+
+// attachAdaptivePlan records plan in every frame's meta.
+func attachAdaptivePlan(frames data.Frames, plan *adaptivePlan) {
+	if plan == nil {
+		return
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = map[string]interface{}{}
+			frame.Meta.Custom = custom
+		}
+		custom[adaptiveMetaKey] = plan
+	}
+}
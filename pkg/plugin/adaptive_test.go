@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// TestDecideAdaptive pins the documented thresholds and that only choices
+// left on auto are changed.
+func TestDecideAdaptive(t *testing.T) {
+	cases := []struct {
+		name                                               string
+		estimate                                           int64
+		autoProtocol, arrowAvailable, autoSplit, splitting bool
+		rowCap                                             int64
+		wantProtocol                                       string
+		wantSplit                                          bool
+		wantRowCap                                         int64
+	}{
+		{"small result: JSON, no split, no cap", 500, true, true, true, true, 5000, "JSON", false, 0},
+		{"JSON threshold is inclusive", adaptiveJSONMaxRows, true, true, true, false, 0, "JSON", false, 0},
+		{"large result: Arrow, split kept, cap kept", 2_000_000, true, true, true, true, 100_000, "Arrow", true, 100_000},
+		{"server without Arrow stays on JSON", 2_000_000, true, false, true, true, 0, "JSON", true, 0},
+		{"explicit protocol untouched", 500, false, true, true, true, 0, "", false, 0},
+		{"explicit split duration untouched", 500, true, true, false, true, 0, "JSON", true, 0},
+		{"never turns splitting on", 2_000_000, true, true, true, false, 0, "Arrow", false, 0},
+		{"split threshold is exclusive", adaptiveSplitMinRows, true, true, true, true, 0, "Arrow", true, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plan := decideAdaptive(c.estimate, c.autoProtocol, c.arrowAvailable, c.autoSplit, c.splitting, c.rowCap)
+			if plan.Protocol != c.wantProtocol || plan.Split != c.wantSplit || plan.RowCap != c.wantRowCap {
+				t.Errorf("got protocol=%q split=%v rowCap=%d, want protocol=%q split=%v rowCap=%d (reasons: %v)",
+					plan.Protocol, plan.Split, plan.RowCap, c.wantProtocol, c.wantSplit, c.wantRowCap, plan.Reasons)
+			}
+			if plan.EstimatedRows != c.estimate {
+				t.Errorf("estimate not recorded: got %d", plan.EstimatedRows)
+			}
+		})
+	}
+}
+
+// adaptiveServer answers count(*) estimates with count (or a 500 when
+// count < 0) and everything else with a two-row time series, recording the
+// SQL of every JSON query in order.
+func adaptiveServer(t *testing.T, count int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.SQL)
+		mu.Unlock()
+		if strings.HasPrefix(body.SQL, "SELECT count(*) AS n FROM (") {
+			if count < 0 {
+				http.Error(w, "estimate failed", http.StatusInternalServerError)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"columns": []string{"n"}, "data": [][]any{{count}}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"columns": []string{"time", "value"},
+			"data":    [][]any{{"2025-01-01T00:00:00Z", 1.0}, {"2025-01-01T00:01:00Z", 2.0}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+const adaptiveTestQuery = `{"sql":"SELECT $__timeGroup(time, '1m') AS time, value FROM cpu WHERE $__timeFilter(time)"}`
+
+// TestQuery_AdaptiveExecution runs a 12h auto-split, row-capped query whose
+// estimate is tiny: it must run as one unsplit, uncapped JSON request even
+// though the server offers Arrow, with the plan in frame meta.
+func TestQuery_AdaptiveExecution(t *testing.T) {
+	srv, seen := adaptiveServer(t, 2)
+	inst := newTestInstance(t, srv.URL)
+	inst.settings.AdaptiveExecution = true
+	inst.settings.TimeSeriesRowCap = 1000
+	inst.protocolCache.resolved, inst.protocolCache.arrow = true, true
+
+	now := time.Now()
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: now.Add(-12 * time.Hour), To: now},
+		JSON:      []byte(adaptiveTestQuery),
+	})
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+
+	sqls := seen()
+	if len(sqls) != 2 {
+		t.Fatalf("expected estimate + one unsplit JSON query, got %d requests: %q", len(sqls), sqls)
+	}
+	if !strings.HasSuffix(sqls[0], "\n) AS arc_estimate") || strings.Contains(sqls[0], "LIMIT") {
+		t.Errorf("estimate should wrap the uncapped query, got %q", sqls[0])
+	}
+	if strings.Contains(sqls[1], "LIMIT") {
+		t.Errorf("row cap should be dropped when the estimate fits, got %q", sqls[1])
+	}
+
+	custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{})
+	plan, ok := custom[adaptiveMetaKey].(*adaptivePlan)
+	if !ok {
+		t.Fatalf("expected adaptive plan in frame meta, got %v", custom)
+	}
+	want := &adaptivePlan{EstimatedRows: 2, Protocol: "JSON", Split: false, RowCap: 0}
+	plan.Reasons = nil
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("plan = %+v, want %+v", plan, want)
+	}
+}
+
+// TestQuery_AdaptiveEstimateFailureFallsBack pins the silent fallback: a
+// failing estimate leaves the query exactly as configured — row cap
+// appended, no plan in meta, no error.
+func TestQuery_AdaptiveEstimateFailureFallsBack(t *testing.T) {
+	srv, seen := adaptiveServer(t, -1)
+	inst := newTestInstance(t, srv.URL)
+	inst.settings.AdaptiveExecution = true
+	inst.settings.TimeSeriesRowCap = 1000
+	useArrow := false
+	inst.settings.UseArrow = &useArrow
+
+	now := time.Now()
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		JSON:      []byte(adaptiveTestQuery),
+	})
+	if resp.Error != nil {
+		t.Fatalf("estimate failure must not fail the query: %v", resp.Error)
+	}
+	sqls := seen()
+	if len(sqls) != 2 || !strings.HasSuffix(sqls[1], "\nLIMIT 1000") {
+		t.Errorf("expected failed estimate then the capped query, got %q", sqls)
+	}
+	if custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{}); custom[adaptiveMetaKey] != nil {
+		t.Errorf("no plan expected after a failed estimate, got %v", custom[adaptiveMetaKey])
+	}
+}
@@ -0,0 +1,390 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Ad hoc filters: a dashboard's ad hoc filters variable arrives on every
+// query under adhocFilters. Where the SQL says $__adhocFilter the filters
+// expand there, ANDed (1=1 when there are none); elsewhere they are
+// injected into the WHERE clause of the outer SELECT, so a filter narrows
+// every panel without its SQL being edited. Injection skips filters on
+// keys that aren't columns of the outer FROM table, when that is a single
+// table DESCRIBE knows, and leaves alone a query whose shape it can't be
+// sure of (WITH, UNION, several statements), saying so in a notice.
+//
+// The variable's keys and values come from GET or POST /tag-keys and
+// /tag-values?key=X: DESCRIBE and SELECT DISTINCT against the table the
+// request names, or the datasource's adhocTable.
+
+// adhocFilterMacro expands to the query's ad hoc filters.
+const adhocFilterMacro = "$__adhocFilter"
+
+// decisionAdhocFilters names the decision saying how the filters applied.
+const decisionAdhocFilters = "adhocFilters"
+
+// maxTagValues caps a /tag-values answer.
+const maxTagValues = 1000
+
+// adhocFilter is one filter of an ad hoc filters variable, as Grafana
+// sends it. Values holds the choices of the multi-value operators.
+type adhocFilter struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Value    string   `json:"value"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// adhocCondition renders f as a SQL condition. Keys are quoted as
+// identifiers and values as string literals; the negated operators match
+// nulls too, as "not this value" reads. Regex operators match the whole
+// value, as Grafana's do.
+func adhocCondition(f adhocFilter) (string, error) {
+	if f.Key == "" {
+		return "", errors.New("ad hoc filter has no key")
+	}
+	if i, r := firstRuneOutside(f.Key, func(r rune) bool { return r >= ' ' && r != 0x7f }); i >= 0 {
+		return "", fmt.Errorf("ad hoc filter key contains %s at byte %d", describeRune(r), i)
+	}
+	col := quoteIdentifier(f.Key)
+	values := f.Values
+	if len(values) == 0 {
+		values = []string{f.Value}
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quoteSQLString(v)
+	}
+	matches := func() string {
+		parts := make([]string, len(quoted))
+		for i, q := range quoted {
+			parts[i] = "regexp_full_match(CAST(" + col + " AS VARCHAR), " + q + ")"
+		}
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		return "(" + strings.Join(parts, " OR ") + ")"
+	}
+	switch f.Operator {
+	case "=", "=|":
+		if len(quoted) == 1 {
+			return col + " = " + quoted[0], nil
+		}
+		return col + " IN (" + strings.Join(quoted, ", ") + ")", nil
+	case "!=", "!=|":
+		if len(quoted) == 1 {
+			return "(" + col + " IS NULL OR " + col + " <> " + quoted[0] + ")", nil
+		}
+		return "(" + col + " IS NULL OR " + col + " NOT IN (" + strings.Join(quoted, ", ") + "))", nil
+	case "=~":
+		return matches(), nil
+	case "!~":
+		return "(" + col + " IS NULL OR NOT " + matches() + ")", nil
+	case "<", ">", "<=", ">=":
+		if len(quoted) != 1 {
+			return "", fmt.Errorf("ad hoc filter operator %q takes one value", f.Operator)
+		}
+		return col + " " + f.Operator + " " + quoted[0], nil
+	}
+	return "", fmt.Errorf("unsupported ad hoc filter operator %q", f.Operator)
+}
+
+// adhocConditions renders filters ANDed, 1=1 when there are none.
+func adhocConditions(filters []adhocFilter) (string, error) {
+	if len(filters) == 0 {
+		return "1=1", nil
+	}
+	conds := make([]string, len(filters))
+	for i, f := range filters {
+		cond, err := adhocCondition(f)
+		if err != nil {
+			return "", err
+		}
+		conds[i] = cond
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+var (
+	outerWhereRe     = regexp.MustCompile(`(?i)\bWHERE\b`)
+	outerJoinRe      = regexp.MustCompile(`(?i)\bJOIN\b`)
+	outerClauseEndRe = regexp.MustCompile(`(?i)\b(?:GROUP\s+BY|HAVING|QUALIFY|WINDOW|ORDER\s+BY|LIMIT|OFFSET|FETCH)\b`)
+)
+
+// adhocTarget is the outer SELECT of a query filters can be injected into:
+// where its FROM clause ends (its WHERE keyword, when it has one) and the
+// single table it reads, "" when it reads a join, a list or a subquery.
+type adhocTarget struct {
+	body     string // the SQL without trailing semicolons
+	outer    string // body masked and with parentheses blanked
+	fromEnd  int    // offset just past FROM
+	whereEnd int    // offset just past WHERE, -1 without one
+	table    string
+}
+
+// findAdhocTarget locates the outer SELECT of sql, or says why filters
+// can't be injected into it.
+func findAdhocTarget(sql string, s strippedSQL) (adhocTarget, error) {
+	head := strings.Fields(s.upper)
+	switch {
+	case len(head) > 0 && head[0] == "WITH":
+		return adhocTarget{}, errors.New("the query starts with WITH")
+	case len(head) == 0 || head[0] != "SELECT":
+		return adhocTarget{}, errors.New("the query isn't a SELECT")
+	case containsMultipleStatements(s):
+		return adhocTarget{}, errors.New("the query has several statements")
+	case containsUnion(s):
+		return adhocTarget{}, errors.New("the query uses UNION")
+	}
+	t := adhocTarget{body: strings.TrimRight(sql, " \t\r\n;"), whereEnd: -1}
+	masked := maskLiteralsAndComments(t.body)
+	t.outer = blankNested(masked)
+	sel := outerSelectRe.FindStringIndex(t.outer)
+	if sel == nil {
+		return adhocTarget{}, errors.New("the query isn't a SELECT")
+	}
+	from := outerFromRe.FindStringIndex(t.outer[sel[1]:])
+	if from == nil {
+		return adhocTarget{}, errors.New("the query has no FROM")
+	}
+	t.fromEnd = sel[1] + from[1]
+	end := len(t.outer)
+	if w := outerWhereRe.FindStringIndex(t.outer[t.fromEnd:]); w != nil {
+		end = t.fromEnd + w[0]
+		t.whereEnd = t.fromEnd + w[1]
+	} else if e := outerClauseEndRe.FindStringIndex(t.outer[t.fromEnd:]); e != nil {
+		end = t.fromEnd + e[0]
+	}
+	items := t.outer[t.fromEnd:end]
+	if !strings.Contains(items, ",") && !outerJoinRe.MatchString(items) {
+		if m := tableNameRe.FindStringSubmatch(masked[t.fromEnd:end]); m != nil {
+			t.table = qualifiedNameSpaceRe.ReplaceAllString(m[1], ".")
+		}
+	}
+	return t, nil
+}
+
+// inject returns the target's SQL with conds added to its WHERE clause,
+// the existing conditions parenthesized after them, or as a new WHERE
+// clause before GROUP BY, ORDER BY, LIMIT and the like. Inserted text is
+// on lines of its own, so a trailing line comment can't swallow it.
+func (t adhocTarget) inject(conds string) string {
+	if t.whereEnd >= 0 {
+		end := len(t.body)
+		if e := outerClauseEndRe.FindStringIndex(t.outer[t.whereEnd:]); e != nil {
+			end = t.whereEnd + e[0]
+		}
+		rest := ""
+		if end < len(t.body) {
+			rest = "\n" + t.body[end:]
+		}
+		return t.body[:t.whereEnd] + " " + conds + " AND (\n" + strings.TrimSpace(t.body[t.whereEnd:end]) + "\n)" + rest
+	}
+	at := len(t.body)
+	if e := outerClauseEndRe.FindStringIndex(t.outer[t.fromEnd:]); e != nil {
+		at = t.fromEnd + e[0]
+	}
+	return strings.TrimRight(t.body[:at], " \t") + "\nWHERE " + conds + "\n" + t.body[at:]
+}
+
+// applyAdhocFilters returns sql with filters applied (see above) and, when
+// they couldn't be injected, a notice saying so. A filter that can't be
+// rendered is an error.
+func (s *ArcInstanceSettings) applyAdhocFilters(ctx context.Context, sql string, filters []adhocFilter) (string, *data.Notice, error) {
+	stripped := newStrippedSQL(sql)
+	if strings.Contains(stripped.stripped, adhocFilterMacro) {
+		conds, err := adhocConditions(filters)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(filters) > 0 {
+			recordDecision(ctx, decision{
+				Name:    decisionAdhocFilters,
+				Outcome: "expanded " + adhocFilterMacro,
+				Inputs:  map[string]any{"filters": filters},
+			})
+		}
+		return replaceLiteralAwareTokens(sql, adhocFilterMacro, conds), nil, nil
+	}
+	if len(filters) == 0 {
+		return sql, nil, nil
+	}
+	// Bad filters fail the query whether or not they would be injected.
+	if _, err := adhocConditions(filters); err != nil {
+		return "", nil, err
+	}
+	target, err := findAdhocTarget(sql, stripped)
+	if err != nil {
+		recordDecision(ctx, decision{
+			Name:    decisionAdhocFilters,
+			Outcome: "not applied",
+			Reason:  err.Error(),
+			Inputs:  map[string]any{"filters": filters},
+		})
+		return sql, &data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Ad hoc filters were not applied: %v. Put %s in the query's WHERE clause to apply them.", err, adhocFilterMacro),
+		}, nil
+	}
+
+	applied, skipped := filters, []string(nil)
+	if target.table != "" {
+		if cols := s.describeTable(ctx, target.table); len(cols) > 0 {
+			known := make(map[string]bool, len(cols))
+			for _, c := range cols {
+				known[strings.ToLower(c.Name)] = true
+			}
+			applied = nil
+			for _, f := range filters {
+				if known[strings.ToLower(f.Key)] {
+					applied = append(applied, f)
+				} else {
+					skipped = append(skipped, f.Key)
+				}
+			}
+		}
+	}
+	d := decision{
+		Name:    decisionAdhocFilters,
+		Outcome: fmt.Sprintf("injected %d of %d", len(applied), len(filters)),
+		Reason:  "no " + adhocFilterMacro + " in the query; added to the outer WHERE clause",
+		Inputs:  map[string]any{"filters": filters},
+	}
+	if len(skipped) > 0 {
+		d.Reason += fmt.Sprintf("; %s not columns of %s", strings.Join(skipped, ", "), target.table)
+	}
+	recordDecision(ctx, d)
+	if len(applied) == 0 {
+		return sql, nil, nil
+	}
+	conds, _ := adhocConditions(applied)
+	return target.inject(conds), nil, nil
+}
+
+// tagRequest is a /tag-keys or /tag-values request: query parameters on a
+// GET, a JSON body on a POST.
+type tagRequest struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Key      string `json:"key"`
+}
+
+// tagSettings reads a tag request and resolves its instance and table,
+// the datasource's adhocTable when the request names none. On failure it
+// has already written the error response.
+func (d *ArcDatasource) tagSettings(w http.ResponseWriter, r *http.Request, route string) (*ArcInstanceSettings, tagRequest, bool) {
+	var req tagRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req = tagRequest{Database: q.Get("database"), Table: q.Get("table"), Key: q.Get("key")}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeResourceError(w, http.StatusBadRequest, sanitizeUserError(route, err))
+			return nil, req, false
+		}
+	default:
+		writeResourceError(w, http.StatusMethodNotAllowed, "use GET or POST")
+		return nil, req, false
+	}
+	settings, ok := d.catalogInstance(w, r, route, req.Database)
+	if !ok {
+		return nil, req, false
+	}
+	if req.Table == "" {
+		req.Table = settings.settings.AdhocTable
+	}
+	if err := validateCatalogTable(req.Table); err != nil {
+		writeResourceError(w, http.StatusBadRequest, err.Error())
+		return nil, req, false
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	if !settings.allowsTable(user, req.Table) {
+		writeResourceError(w, http.StatusForbidden, fmt.Sprintf("table %s is not allowed for the %s role", req.Table, user.Role))
+		return nil, req, false
+	}
+	return settings, req, true
+}
+
+// tagOption is one entry of a /tag-keys or /tag-values answer, in the
+// shape Grafana's ad hoc filters variable reads.
+type tagOption struct {
+	Text string `json:"text"`
+}
+
+// handleTagKeys answers /tag-keys with the columns of the request's table.
+func (d *ArcDatasource) handleTagKeys(w http.ResponseWriter, r *http.Request) {
+	settings, req, ok := d.tagSettings(w, r, "tag-keys")
+	if !ok {
+		return
+	}
+	cols, err := settings.catalogColumns(r.Context(), req.Table)
+	if err != nil {
+		writeResourceError(w, http.StatusBadGateway, sanitizeUserError("tag-keys", err))
+		return
+	}
+	keys := make([]tagOption, len(cols))
+	for i, c := range cols {
+		keys[i] = tagOption{Text: c.Name}
+	}
+	writeResourceJSON(w, http.StatusOK, keys)
+}
+
+// handleTagValues answers /tag-values?key=X with up to maxTagValues
+// distinct non-null values of column X of the request's table.
+func (d *ArcDatasource) handleTagValues(w http.ResponseWriter, r *http.Request) {
+	settings, req, ok := d.tagSettings(w, r, "tag-values")
+	if !ok {
+		return
+	}
+	cols, err := settings.catalogColumns(r.Context(), req.Table)
+	if err != nil {
+		writeResourceError(w, http.StatusBadGateway, sanitizeUserError("tag-values", err))
+		return
+	}
+	known := false
+	for _, c := range cols {
+		known = known || c.Name == req.Key
+	}
+	if !known {
+		writeResourceError(w, http.StatusBadRequest, fmt.Sprintf("%s is not a column of %s", req.Key, req.Table))
+		return
+	}
+
+	key := settings.scopedKey(r.Context(), catalogKey("tag-values", settings.settings.Database, req.Table, req.Key))
+	if values, ok := settings.catalog.get(key); ok {
+		writeResourceJSON(w, http.StatusOK, values)
+		return
+	}
+	col := quoteIdentifier(req.Key)
+	sql := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL ORDER BY 1 LIMIT %d", col, quoteIdentifier(req.Table), col, maxTagValues)
+	ctx, cancel := context.WithTimeout(r.Context(), catalogTimeout)
+	defer cancel()
+	frames, err := queryJSON(ctx, settings, attributed(ctx, sql))
+	if err != nil {
+		writeResourceError(w, http.StatusBadGateway, sanitizeUserError("tag-values", err))
+		return
+	}
+	values := []tagOption{}
+	for _, frame := range frames {
+		if frame == nil || len(frame.Fields) == 0 {
+			continue
+		}
+		for i := range frame.Fields[0].Len() {
+			if v, ok := fieldString(frame.Fields[0], i); ok {
+				values = append(values, tagOption{Text: v})
+			}
+		}
+	}
+	settings.catalog.put(key, values)
+	writeResourceJSON(w, http.StatusOK, values)
+}
@@ -0,0 +1,288 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAdhocCondition(t *testing.T) {
+	cases := []struct {
+		filter adhocFilter
+		want   string
+	}{
+		{adhocFilter{Key: "host", Operator: "=", Value: "a"}, `"host" = 'a'`},
+		{adhocFilter{Key: "host", Operator: "=", Value: "o'neil"}, `"host" = 'o''neil'`},
+		{adhocFilter{Key: "host", Operator: "=|", Values: []string{"a", "b"}}, `"host" IN ('a', 'b')`},
+		{adhocFilter{Key: "host", Operator: "!=", Value: "a"}, `("host" IS NULL OR "host" <> 'a')`},
+		{adhocFilter{Key: "host", Operator: "!=|", Values: []string{"a", "b"}}, `("host" IS NULL OR "host" NOT IN ('a', 'b'))`},
+		{adhocFilter{Key: "host", Operator: "=~", Value: "web-.*"}, `regexp_full_match(CAST("host" AS VARCHAR), 'web-.*')`},
+		{adhocFilter{Key: "host", Operator: "=~", Values: []string{"a.*", "b.*"}},
+			`(regexp_full_match(CAST("host" AS VARCHAR), 'a.*') OR regexp_full_match(CAST("host" AS VARCHAR), 'b.*'))`},
+		{adhocFilter{Key: "host", Operator: "!~", Value: "a.*"}, `("host" IS NULL OR NOT regexp_full_match(CAST("host" AS VARCHAR), 'a.*'))`},
+		{adhocFilter{Key: "usage", Operator: ">", Value: "90"}, `"usage" > '90'`},
+		{adhocFilter{Key: `we"ird`, Operator: "=", Value: "x"}, `"we""ird" = 'x'`},
+	}
+	for _, c := range cases {
+		if got, err := adhocCondition(c.filter); err != nil || got != c.want {
+			t.Errorf("adhocCondition(%+v) = %q, %v; want %q", c.filter, got, err, c.want)
+		}
+	}
+
+	for _, f := range []adhocFilter{
+		{Operator: "=", Value: "a"},
+		{Key: "host\n", Operator: "=", Value: "a"},
+		{Key: "host", Operator: "LIKE", Value: "a"},
+		{Key: "host", Operator: "<", Values: []string{"a", "b"}},
+	} {
+		if got, err := adhocCondition(f); err == nil {
+			t.Errorf("adhocCondition(%+v) = %q, want an error", f, got)
+		}
+	}
+}
+
+func TestFindAdhocTarget(t *testing.T) {
+	const conds = `"host" = 'a'`
+	cases := []struct {
+		name  string
+		sql   string
+		want  string
+		table string
+	}{
+		{"no WHERE", "SELECT * FROM cpu", "SELECT * FROM cpu\nWHERE " + conds + "\n", "cpu"},
+		{"WHERE", "SELECT * FROM cpu WHERE x = 1 OR y = 2", "SELECT * FROM cpu WHERE " + conds + " AND (\nx = 1 OR y = 2\n)", "cpu"},
+		{
+			"WHERE then GROUP BY",
+			"SELECT host, avg(v) FROM db.cpu AS c WHERE $__timeFilter(time) GROUP BY host ORDER BY host LIMIT 5;",
+			"SELECT host, avg(v) FROM db.cpu AS c WHERE " + conds + " AND (\n$__timeFilter(time)\n)\nGROUP BY host ORDER BY host LIMIT 5",
+			"db.cpu",
+		},
+		{"GROUP BY", "SELECT host FROM cpu GROUP BY host", "SELECT host FROM cpu\nWHERE " + conds + "\nGROUP BY host", "cpu"},
+		{
+			"subquery",
+			"SELECT * FROM (SELECT * FROM cpu WHERE a = 1 LIMIT 3) ORDER BY time",
+			"SELECT * FROM (SELECT * FROM cpu WHERE a = 1 LIMIT 3)\nWHERE " + conds + "\nORDER BY time",
+			"",
+		},
+		{
+			"trailing line comment",
+			"SELECT * FROM cpu WHERE a = 1 -- note",
+			"SELECT * FROM cpu WHERE " + conds + " AND (\na = 1 -- note\n)",
+			"cpu",
+		},
+		{"keyword in a literal", "SELECT * FROM cpu WHERE msg = 'a GROUP BY b'", "SELECT * FROM cpu WHERE " + conds + " AND (\nmsg = 'a GROUP BY b'\n)", "cpu"},
+		{"join", "SELECT * FROM cpu JOIN mem USING (host)", "SELECT * FROM cpu JOIN mem USING (host)\nWHERE " + conds + "\n", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			target, err := findAdhocTarget(c.sql, newStrippedSQL(c.sql))
+			if err != nil {
+				t.Fatalf("findAdhocTarget: %v", err)
+			}
+			if target.table != c.table {
+				t.Errorf("table = %q, want %q", target.table, c.table)
+			}
+			if got := target.inject(conds); got != c.want {
+				t.Errorf("inject =\n%s\nwant\n%s", got, c.want)
+			}
+		})
+	}
+
+	for _, sql := range []string{
+		"WITH x AS (SELECT 1) SELECT * FROM x",
+		"SELECT * FROM a UNION ALL SELECT * FROM b",
+		"SELECT 1; SELECT 2",
+		"SHOW TABLES",
+		"SELECT 1",
+	} {
+		if _, err := findAdhocTarget(sql, newStrippedSQL(sql)); err == nil {
+			t.Errorf("findAdhocTarget(%q) found a target", sql)
+		}
+	}
+}
+
+// adhocServer answers DESCRIBE with the columns time, host and usage,
+// SELECT DISTINCT with three hosts and anything else with one row, and
+// records the SQL it was sent.
+type adhocServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []string
+}
+
+func newAdhocServer(t *testing.T) *adhocServer {
+	t.Helper()
+	s := &adhocServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		s.mu.Lock()
+		s.calls = append(s.calls, body.SQL)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		var resp map[string]any
+		switch {
+		case strings.HasPrefix(body.SQL, "DESCRIBE "):
+			resp = map[string]any{
+				"columns": []string{"column_name", "column_type"},
+				"data":    [][]any{{"time", "TIMESTAMP"}, {"host", "VARCHAR"}, {"usage", "DOUBLE"}},
+			}
+		case strings.HasPrefix(body.SQL, "SELECT DISTINCT "):
+			resp = map[string]any{"columns": []string{"host"}, "data": [][]any{{"a"}, {"b"}, {"c"}}}
+		default:
+			resp = map[string]any{"columns": []string{"usage"}, "data": [][]any{{1.5}}}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *adhocServer) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func TestQuery_AdhocFilters(t *testing.T) {
+	filters := `[{"key":"host","operator":"=","value":"a"},{"key":"region","operator":"!=","value":"eu"}]`
+	cases := []struct {
+		name    string
+		sql     string
+		want    string // the panel query Arc was sent
+		warning string
+	}{
+		{
+			name: "injected, unknown key skipped",
+			sql:  "SELECT usage FROM cpu WHERE usage > 1 ORDER BY time",
+			want: "SELECT usage FROM cpu WHERE \"host\" = 'a' AND (\nusage > 1\n)\nORDER BY time",
+		},
+		{
+			name: "macro",
+			sql:  "SELECT usage FROM cpu WHERE $__adhocFilter",
+			want: "SELECT usage FROM cpu WHERE \"host\" = 'a' AND (\"region\" IS NULL OR \"region\" <> 'eu')",
+		},
+		{
+			name:    "not injectable",
+			sql:     "WITH x AS (SELECT * FROM cpu) SELECT usage FROM x",
+			want:    "WITH x AS (SELECT * FROM cpu) SELECT usage FROM x",
+			warning: "Ad hoc filters were not applied: the query starts with WITH",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := newAdhocServer(t)
+			query, _ := json.Marshal(map[string]any{"sql": c.sql, "format": "table", "adhocFilters": json.RawMessage(filters)})
+			res, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+				PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+				Queries: []backend.DataQuery{{
+					RefID:     "A",
+					TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+					JSON:      query,
+				}},
+			})
+			if err != nil {
+				t.Fatalf("QueryData: %v", err)
+			}
+			resp := res.Responses["A"]
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			sent := srv.sent()
+			if len(sent) == 0 || sent[len(sent)-1] != c.want {
+				t.Errorf("Arc was sent %q, want last\n%s", sent, c.want)
+			}
+			warnings := warningNotices(resp.Frames[0])
+			if c.warning == "" && len(warnings) != 0 || c.warning != "" && (len(warnings) != 1 || !strings.HasPrefix(warnings[0], c.warning)) {
+				t.Errorf("warnings = %q, want %q", warnings, c.warning)
+			}
+			if d := frameDecisions(t, resp.Frames[0])[decisionAdhocFilters]; d.Name == "" {
+				t.Errorf("no %s decision", decisionAdhocFilters)
+			}
+		})
+	}
+
+	t.Run("bad filter", func(t *testing.T) {
+		srv := newAdhocServer(t)
+		res, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+			Queries: []backend.DataQuery{{
+				RefID: "A",
+				JSON:  []byte(`{"sql":"SELECT * FROM cpu","adhocFilters":[{"key":"host","operator":"LIKE","value":"a"}]}`),
+			}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		if resp := res.Responses["A"]; resp.Error == nil || !strings.Contains(resp.Error.Error(), `operator "LIKE"`) {
+			t.Errorf("error = %v, want the operator rejected", resp.Error)
+		}
+		if got := srv.sent(); len(got) != 0 {
+			t.Errorf("Arc was sent %q", got)
+		}
+	})
+}
+
+func TestTagResources(t *testing.T) {
+	srv := newAdhocServer(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{
+		"useArrow":         false,
+		"adhocTable":       "cpu",
+		"roleRestrictions": map[string]any{"Viewer": map[string]any{"tables": []string{"cpu"}}},
+	})
+
+	status, body := callResource(t, d, pctx, http.MethodGet, "/tag-keys", nil)
+	var keys []tagOption
+	if status != http.StatusOK || json.Unmarshal(body, &keys) != nil ||
+		!reflect.DeepEqual(keys, []tagOption{{Text: "time"}, {Text: "host"}, {Text: "usage"}}) {
+		t.Fatalf("/tag-keys = %d %s", status, body)
+	}
+
+	status, body = callResource(t, d, pctx, http.MethodPost, "/tag-values", map[string]string{"table": "mem", "key": "host"})
+	var values []tagOption
+	if status != http.StatusOK || json.Unmarshal(body, &values) != nil ||
+		!reflect.DeepEqual(values, []tagOption{{Text: "a"}, {Text: "b"}, {Text: "c"}}) {
+		t.Fatalf("/tag-values = %d %s", status, body)
+	}
+	// Asked again, the values come from the cache.
+	callResource(t, d, pctx, http.MethodPost, "/tag-values", map[string]string{"table": "mem", "key": "host"})
+	want := []string{`DESCRIBE "cpu"`, `DESCRIBE "mem"`, `SELECT DISTINCT "host" FROM "mem" WHERE "host" IS NOT NULL ORDER BY 1 LIMIT 1000`}
+	if got := srv.sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Arc was sent %q, want %q", got, want)
+	}
+
+	viewer := pctx
+	viewer.User = &backend.User{Login: "v", Role: "Viewer"}
+	noTable := testPluginContext(t, srv.URL, map[string]any{"useArrow": false})
+	cases := []struct {
+		name   string
+		pctx   backend.PluginContext
+		method string
+		path   string
+		status int
+		msg    string
+	}{
+		{"no table", noTable, http.MethodGet, "/tag-keys", http.StatusBadRequest, "table is required"},
+		{"unknown key", pctx, http.MethodGet, "/tag-values?key=region", http.StatusBadRequest, "region is not a column of cpu"},
+		{"restricted table", viewer, http.MethodGet, "/tag-values?table=mem&key=host", http.StatusForbidden, "mem is not allowed for the Viewer role"},
+		{"PUT", pctx, http.MethodPut, "/tag-keys", http.StatusMethodNotAllowed, "use GET or POST"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, body := callResource(t, d, c.pctx, c.method, c.path, nil)
+			if status != c.status || !strings.Contains(string(body), c.msg) {
+				t.Errorf("%s %s = %d %s, want %d containing %q", c.method, c.path, status, body, c.status, c.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// The macro engine and the frame converters live in pkg/arcclient, where
+// tools outside Grafana can expand and convert queries as the datasource
+// does. These are the plugin's names for the parts it uses; requests go
+// through doRequest, not arcclient.Client.
+
+var (
+	errNotArrowStream      = arcclient.ErrNotArrowStream
+	errInvalidBucketOrigin = arcclient.ErrInvalidBucketOrigin
+)
+
+const (
+	bucketOriginStartOfRange = arcclient.BucketOriginStartOfRange
+	durationUnit             = arcclient.DurationUnit
+	maxErrorBodyBytes        = arcclient.MaxErrorMessageBytes
+)
+
+type conversionFailure = arcclient.ConversionFailure
+
+// applyMacrosWith expands the macros for one execution: filter is the
+// range the time filters cover (the chunk when splitting), query the
+// panel's query, whose range is the dashboard range and whose Interval and
+// MaxDataPoints size $__interval, bucketOrigin the $__timeGroup alignment
+// (zero = epoch). See arcclient.ExpandMacros.
+func applyMacrosWith(sql string, filter backend.TimeRange, query backend.DataQuery, bucketOrigin time.Time) string {
+	return arcclient.ExpandMacros(sql, macroOptions(filter, query, bucketOrigin))
+}
+
+// macroOptions is the arcclient.MacroOptions applyMacrosWith expands with.
+func macroOptions(filter backend.TimeRange, query backend.DataQuery, bucketOrigin time.Time) arcclient.MacroOptions {
+	return arcclient.MacroOptions{
+		Range:         arcclient.TimeRange(query.TimeRange),
+		Filter:        arcclient.TimeRange(filter),
+		BucketOrigin:  bucketOrigin,
+		Interval:      query.Interval,
+		MaxDataPoints: query.MaxDataPoints,
+	}
+}
+
+func expandTimeFilter(sql string, from, to time.Time) string {
+	return arcclient.ExpandTimeFilter(sql, from, to)
+}
+
+func expandTimeGroup(sql string) string {
+	return arcclient.ExpandTimeGroup(sql, time.Time{})
+}
+
+func expandTimeGroupWithOrigin(sql string, origin time.Time) string {
+	return arcclient.ExpandTimeGroup(sql, origin)
+}
+
+func resolveBucketOrigin(origin string, tr backend.TimeRange) (time.Time, error) {
+	return arcclient.ResolveBucketOrigin(origin, arcclient.TimeRange(tr))
+}
+
+func originOffset(origin time.Time, periodSecs int64) int64 {
+	return arcclient.OriginOffset(origin, periodSecs)
+}
+
+func zoneBoundaries(from, to time.Time, width time.Duration, origin time.Time) ([]time.Time, bool) {
+	if !arcclient.ZoneAligned(width, origin) {
+		return nil, false
+	}
+	return arcclient.ZoneBoundaries(from, to, width, origin), true
+}
+
+func intervalToSeconds(interval string) (int, bool) {
+	return arcclient.IntervalSeconds(interval)
+}
+
+func replaceMacroOccurrences(sql, macro string, rewrite func(arg string) (string, bool)) string {
+	return arcclient.ReplaceMacro(sql, macro, rewrite)
+}
+
+func replaceLiteralAwareTokens(sql, token, replacement string) string {
+	return arcclient.ReplaceToken(sql, token, replacement)
+}
+
+func findMatchingParen(sql string, openIdx int) int {
+	return arcclient.MatchingParen(sql, openIdx)
+}
+
+func validateColumnArg(name string) error {
+	return arcclient.ValidateColumn(name)
+}
+
+func jsonToDataFrame(result map[string]interface{}) (*data.Frame, []conversionFailure, error) {
+	return arcclient.FrameFromJSON(result)
+}
+
+func attachConversionFailures(frame *data.Frame, failures []conversionFailure) {
+	arcclient.AttachConversionFailures(frame, failures)
+}
+
+func frameConversionFailures(frame *data.Frame) []conversionFailure {
+	return arcclient.ConversionFailures(frame)
+}
+
+func epochToTime(x float64) time.Time {
+	return arcclient.EpochToTime(x)
+}
+
+func newFrameFromArrowSchema(schema *arrow.Schema) *data.Frame {
+	return arcclient.FrameForSchema(schema)
+}
+
+func createEmptyField(f arrow.Field) *data.Field {
+	return arcclient.FieldForArrow(f)
+}
+
+func appendRecordToDataFrame(frame *data.Frame, record arrow.Record) error {
+	return arcclient.AppendRecord(frame, record)
+}
+
+func parseIntervalText(s string) (float64, bool) {
+	return arcclient.ParseInterval(s)
+}
+
+func truncateForLog(s string) string {
+	return arcclient.TruncateMessage(s)
+}
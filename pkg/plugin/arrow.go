@@ -2,37 +2,36 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/apache/arrow/go/v14/arrow"
-	"github.com/apache/arrow/go/v14/arrow/array"
-	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
 // queryArrow executes a query against Arc's /api/v1/query/arrow endpoint and
-// returns the decoded Grafana DataFrame. Streams the Arrow IPC response
-// record-by-record and decodes columns via bulk slice accessors where the
-// Arrow library supports them.
+// returns the decoded Grafana DataFrame (see arcclient.ReadArrow). Arrow
+// buffers come from the instance's allocator and are all released before
+// it returns.
 func queryArrow(ctx context.Context, settings *ArcInstanceSettings, sql string) (*data.Frame, error) {
 	start := time.Now()
-	body, err := settings.doRequest(ctx, "/api/v1/query/arrow", map[string]any{"sql": sql})
+	ctx, warnings := withWarningSink(ctx)
+	ctx, retries := withRetryCounter(ctx)
+	body, err := settings.doRequest(ctx, arcclient.ArrowQueryPath, arrowStreamMediaType, map[string]any{"sql": sql})
 	if err != nil {
 		return nil, err
 	}
 	defer body.Close()
 
-	reader, err := ipc.NewReader(body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Arrow reader: %w", err)
-	}
-	defer reader.Release()
-
-	frame, err := frameForRecords(reader)
+	body, capture := settings.captures.track(body)
+	frame, err := arcclient.ReadArrowWithOptions(body, settings.arrowOptions())
 	if err != nil {
+		settings.captures.save(ctx, capture, "arrow", settings.settings.Database, sql, err)
 		return nil, err
 	}
 
@@ -42,396 +41,260 @@ func queryArrow(ctx context.Context, settings *ArcInstanceSettings, sql string)
 		"rows", frame.Rows(),
 		"fields", len(frame.Fields),
 	)
+	arcclient.EpochTimeFields(frame, settings.timeColumns)
+	settings.logResult(frame)
 
-	frame.Meta = &data.FrameMeta{
-		ExecutedQueryString: sql,
-		Custom: map[string]interface{}{
-			"executionTime": duration.Milliseconds(),
-		},
-	}
+	mods := decoderModifications(frame)
+	frame.Meta = resultMeta(frame, sql, duration, mods)
+	settings.noticeUint64(frame, mods)
+	noticeTruncatedCells(frame, mods)
+	attachArcWarnings(frame, warnings.arcWarnings(), 0)
+	recordRetries(frame, retries.Load())
 
 	return frame, nil
 }
 
-// frameForRecords creates a data.Frame from a stream of arrow.Records
-// This is the FlightSQL approach that we know works
-func frameForRecords(reader *ipc.Reader) (*data.Frame, error) {
-	// Wait for first record to get schema
-	if !reader.Next() {
-		if reader.Err() != nil && reader.Err() != io.EOF {
-			return nil, fmt.Errorf("error reading Arrow stream: %w", reader.Err())
-		}
-		return data.NewFrame(""), nil
-	}
-
-	// Create frame from schema
-	record := reader.Record()
-	schema := record.Schema()
-	frame := newFrameFromArrowSchema(schema)
+// exactUint64 reports whether ExactUint64 is on (the default).
+func (s *ArcInstanceSettings) exactUint64() bool {
+	return s.settings.ExactUint64 == nil || *s.settings.ExactUint64
+}
 
-	// Process first record
-	if err := appendRecordToDataFrame(frame, record); err != nil {
-		record.Release()
-		return nil, err
+// arrowOptions configures the Arrow decoder. Expressions and the browser's
+// JSON decoding mangle integers past 2^53, so by default a UINT64 column
+// holding one becomes text (arcclient.Uint64Exact). PreferNumeric keeps
+// such columns float64 for panels that need numbers, and ExactUint64 off
+// restores the silent rounding. The JSON endpoint's numbers are already
+// float64 when they arrive, so only Arrow responses are affected.
+func (s *ArcInstanceSettings) arrowOptions() arcclient.ArrowOptions {
+	opts := arcclient.ArrowOptions{Allocator: s.arrowAlloc, MaxCellBytes: s.maxCellBytes}
+	if !s.exactUint64() || s.settings.PreferNumeric {
+		opts.Uint64 = arcclient.Uint64Float
 	}
-	record.Release()
+	return opts
+}
 
-	// Process remaining records
-	for reader.Next() {
-		record := reader.Record()
-		if err := appendRecordToDataFrame(frame, record); err != nil {
-			record.Release()
-			return nil, err
+// noticeUint64 tells the panel what arrowOptions did to large integers:
+// columns turned into text, or, with PreferNumeric, values rounded.
+// Without ExactUint64 rounding stays silent outside strict mode.
+func (s *ArcInstanceSettings) noticeUint64(frame *data.Frame, mods []modification) {
+	if !s.exactUint64() {
+		return
+	}
+	for _, m := range mods {
+		if m.Kind == modUint64AsText || (m.Kind == modIntegerRounding && s.settings.PreferNumeric) {
+			frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: m.String()})
 		}
-		record.Release()
 	}
+}
 
-	if reader.Err() != nil && reader.Err() != io.EOF {
-		return nil, fmt.Errorf("error reading Arrow stream: %w", reader.Err())
+// reconcileUint64Text converts a column to text in every frame when any
+// frame converted it (modUint64AsText). Split chunks are decoded one by
+// one and only those holding a value past 2^53 convert the column; without
+// this the rest would fail chunkFieldMap and be dropped.
+func reconcileUint64Text(frames []*data.Frame) {
+	text := map[string]bool{}
+	for _, f := range frames {
+		for _, m := range frameModifications(f) {
+			if m.Kind == modUint64AsText {
+				text[m.Column] = true
+			}
+		}
 	}
+	if len(text) == 0 {
+		return
+	}
+	for _, f := range frames {
+		if f == nil {
+			continue
+		}
+		for i, field := range f.Fields {
+			if text[field.Name] && field.Type() == data.FieldTypeNullableFloat64 {
+				f.Fields[i] = arcclient.Uint64AsText(field)
+			}
+		}
+	}
+}
 
-	log.DefaultLogger.Debug("Built frame from Arrow records",
-		"fields", len(frame.Fields),
-		"rows", frame.Rows(),
-	)
+// arrowProbeTimeout bounds the one-off Arrow endpoint probe (see useArrow).
+const arrowProbeTimeout = 5 * time.Second
 
-	return frame, nil
+// protocolCache holds the protocol "auto" resolved to for one instance.
+type protocolCache struct {
+	mu       sync.Mutex
+	resolved bool
+	arrow    bool
 }
 
-// newFrameFromArrowSchema creates a data.Frame with empty fields from Arrow schema
-func newFrameFromArrowSchema(schema *arrow.Schema) *data.Frame {
-	fields := make([]*data.Field, schema.NumFields())
-	for i, arrowField := range schema.Fields() {
-		fields[i] = createEmptyField(arrowField)
+// useArrow reports whether queries should use the Arrow endpoint. An
+// explicit useArrow setting wins. With the key absent — provisioned
+// datasources that never set it, which previously fell to the JSON path
+// without anyone noticing — the protocol is "auto": the Arrow endpoint is
+// probed once per instance with `SELECT 1` and Arrow is used when it
+// answers with a valid stream. Only a definitive answer is cached: the
+// endpoint missing or rejecting the request (404/405/406/415/501) or
+// returning something that isn't Arrow selects JSON; any other failure
+// (Arc down, timeout) leaves the question open and this call uses Arrow,
+// so the real query reports the real error and the next call probes again.
+func (s *ArcInstanceSettings) useArrow(ctx context.Context) bool {
+	if s.settings.UseArrow != nil {
+		return *s.settings.UseArrow
+	}
+	c := s.protocolCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resolved {
+		return c.arrow
 	}
-	return data.NewFrame("", fields...)
-}
 
-// createEmptyField creates an empty data.Field from an Arrow field.
-//
-// Fields are ALWAYS created as nullable (pointer-element slices), regardless
-// of the Arrow schema's `f.Nullable` flag. Arc's Arrow schemas advertise
-// non-nullable for columns that are nullable in practice (e.g. aggregates
-// with all-null groups), and Arrow's underlying buffer at null positions is
-// undefined. Honoring the schema's non-nullable claim let stale buffer bytes
-// surface as real values in the dashboard — see R2-CR2 in the
-// signing-readiness punch list. Coercing to nullable + emitting nil at null
-// positions is the only safe shape.
-//
-// INT64/UINT64 are promoted to *float64 so Grafana's Stat/TimeSeries panels
-// treat them as numeric value fields (DuckDB aggregates return int64 after
-// Arc's decimal normalization; Grafana auto-detection requires float64).
-//
-// Unknown Arrow types fall back to *string so the column is still rendered
-// even if the writer path can't decode it. The writer path matches this
-// fallback (R2-HI12).
-func createEmptyField(f arrow.Field) *data.Field {
-	switch f.Type.ID() {
-	case arrow.STRING:
-		return data.NewField(f.Name, nil, []*string{})
-	case arrow.FLOAT32:
-		return data.NewField(f.Name, nil, []*float32{})
-	case arrow.FLOAT64:
-		return data.NewField(f.Name, nil, []*float64{})
-	case arrow.INT8:
-		return data.NewField(f.Name, nil, []*int8{})
-	case arrow.INT16:
-		return data.NewField(f.Name, nil, []*int16{})
-	case arrow.INT32:
-		return data.NewField(f.Name, nil, []*int32{})
-	case arrow.INT64:
-		return data.NewField(f.Name, nil, []*float64{})
-	case arrow.UINT8:
-		return data.NewField(f.Name, nil, []*uint8{})
-	case arrow.UINT16:
-		return data.NewField(f.Name, nil, []*uint16{})
-	case arrow.UINT32:
-		return data.NewField(f.Name, nil, []*uint32{})
-	case arrow.UINT64:
-		return data.NewField(f.Name, nil, []*float64{})
-	case arrow.BOOL:
-		return data.NewField(f.Name, nil, []*bool{})
-	case arrow.TIMESTAMP:
-		return data.NewField(f.Name, nil, []*time.Time{})
+	probeCtx, cancel := context.WithTimeout(withRequestClass(ctx, requestClassHealth), arrowProbeTimeout)
+	defer cancel()
+	_, err := queryArrow(probeCtx, s, "SELECT 1")
+	var statusErr *arcStatusError
+	switch {
+	case err == nil:
+		c.resolved, c.arrow = true, true
+	case errors.Is(err, errNotArrowStream):
+		c.resolved, c.arrow = true, false
+	case errors.As(err, &statusErr) && arrowUnsupportedStatus(statusErr.StatusCode):
+		c.resolved, c.arrow = true, false
 	default:
-		// Fallback to nullable string for unsupported types — the writer
-		// path's default branch must match this (R2-HI12).
-		return data.NewField(f.Name, nil, []*string{})
+		log.DefaultLogger.Warn("Arrow endpoint probe inconclusive; will retry", "error", err)
+		return true
 	}
+	log.DefaultLogger.Info("Resolved auto protocol", "arrow", c.arrow, "url", s.settings.URL)
+	return c.arrow
 }
 
-// appendRecordToDataFrame appends every column of an Arrow record to its
-// corresponding data.Frame field. Each field is pre-extended by the record's
-// row count so the per-row writes don't trigger repeated reflective slice
-// reallocations (M21/P2 fix).
-func appendRecordToDataFrame(frame *data.Frame, record arrow.Record) error {
-	if record.NumRows() == 0 || len(frame.Fields) == 0 {
-		return nil
-	}
-	rows := int(record.NumRows())
-	startIdx := frame.Fields[0].Len()
-	for i, col := range record.Columns() {
-		field := frame.Fields[i]
-		field.Extend(rows)
-		if err := writeArrowColumnIntoField(field, col, startIdx); err != nil {
-			return fmt.Errorf("failed to append column %s: %w", field.Name, err)
-		}
+// arrowUnsupportedStatus reports whether an HTTP status from the Arrow
+// endpoint means "this server doesn't do Arrow" rather than a transient or
+// query-level failure.
+func arrowUnsupportedStatus(code int) bool {
+	switch code {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotAcceptable,
+		http.StatusUnsupportedMediaType, http.StatusNotImplemented:
+		return true
 	}
-	return nil
+	return false
 }
 
-// writeArrowColumnIntoField writes every value of an Arrow column into the
-// destination field starting at startIdx. The field is assumed to have been
-// pre-extended by the caller (see appendRecordToDataFrame).
+// queryFrames runs sql over the instance's protocol (see useArrow). In auto
+// mode, an Arrow response that turns out not to be an Arrow stream — a
+// proxy rewriting /arrow to the JSON handler, a server that dropped the
+// endpoint since the probe — demotes the instance to JSON and reruns the
+// query there, so the panel gets its data and later queries skip the dead
+// path. A configured useArrow=true never falls back: the admin asked for
+// Arrow, and the targeted error says why it isn't working.
 //
-// Each type-cast uses comma-ok so a schema-vs-concrete-type drift (extension
-// types, dictionary-encoded strings, lists) routes to the string fallback
-// (matching createEmptyField's *string default) rather than panicking the
-// goroutine.
-//
-// Numeric and timestamp columns use Arrow's bulk slice accessors
-// (Int64Values/Float64Values/TimestampValues) and short-circuit the null check
-// when col.NullN() == 0 — significantly faster than per-row Value(i) +
-// IsNull(i) on large batches.
-//
-// All destination fields are nullable (R2-CR2): Arc's schemas can advertise
-// non-nullable for columns that contain nulls in practice, and Arrow's
-// underlying buffer at null positions is undefined. Writers ALWAYS check
-// IsNull and emit a typed nil pointer there.
-func writeArrowColumnIntoField(field *data.Field, col arrow.Array, startIdx int) error {
-	allValid := col.NullN() == 0
-	switch col.DataType().ID() {
-	case arrow.TIMESTAMP:
-		arr, ok := col.(*array.Timestamp)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		ts, ok := col.DataType().(*arrow.TimestampType)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeTimestampColumn(field, arr, ts.Unit, startIdx, allValid)
-	case arrow.STRING:
-		arr, ok := col.(*array.String)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeStringColumn(field, arr, startIdx, allValid)
-	case arrow.BOOL:
-		arr, ok := col.(*array.Boolean)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeBoolColumn(field, arr, startIdx, allValid)
-	case arrow.FLOAT32:
-		arr, ok := col.(*array.Float32)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[float32](field, arr, arr.Float32Values(), startIdx, allValid)
-	case arrow.FLOAT64:
-		arr, ok := col.(*array.Float64)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[float64](field, arr, arr.Float64Values(), startIdx, allValid)
-	case arrow.INT8:
-		arr, ok := col.(*array.Int8)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[int8](field, arr, arr.Int8Values(), startIdx, allValid)
-	case arrow.INT16:
-		arr, ok := col.(*array.Int16)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[int16](field, arr, arr.Int16Values(), startIdx, allValid)
-	case arrow.INT32:
-		arr, ok := col.(*array.Int32)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[int32](field, arr, arr.Int32Values(), startIdx, allValid)
-	case arrow.INT64:
-		arr, ok := col.(*array.Int64)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writePromotedColumn[int64](field, arr, arr.Int64Values(), startIdx, allValid)
-	case arrow.UINT8:
-		arr, ok := col.(*array.Uint8)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[uint8](field, arr, arr.Uint8Values(), startIdx, allValid)
-	case arrow.UINT16:
-		arr, ok := col.(*array.Uint16)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[uint16](field, arr, arr.Uint16Values(), startIdx, allValid)
-	case arrow.UINT32:
-		arr, ok := col.(*array.Uint32)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writeNumericColumn[uint32](field, arr, arr.Uint32Values(), startIdx, allValid)
-	case arrow.UINT64:
-		arr, ok := col.(*array.Uint64)
-		if !ok {
-			return writeUnsupportedAsString(field, col, startIdx)
-		}
-		return writePromotedColumn[uint64](field, arr, arr.Uint64Values(), startIdx, allValid)
-	default:
-		// Unsupported Arrow type: render via String() so the column is still
-		// visible (matches createEmptyField's *string fallback — R2-HI12).
-		return writeUnsupportedAsString(field, col, startIdx)
+// With DurationUnitsFromNames, numeric fields named like request_duration_ms
+// get their unit here, after decoding, so both protocols agree. Errors
+// about a missing database or table come back as a notFoundError. A query
+// slower than slowQueryThreshold is logged (see noteSlowQuery).
+func (s *ArcInstanceSettings) queryFrames(ctx context.Context, sql string) (data.Frames, error) {
+	start := time.Now()
+	frames, err := s.queryProtocolFrames(ctx, sql)
+	if err != nil {
+		return nil, s.explainNotFound(ctx, err)
 	}
-}
-
-// writeUnsupportedAsString renders an Arrow column the writer can't decode
-// natively as the column's per-row String() representation. Lets the panel
-// still display data for extension types / dictionary-encoded strings / lists
-// instead of failing the whole query — schema-build path matches via
-// createEmptyField's *string fallback (R2-HI12).
-func writeUnsupportedAsString(field *data.Field, col arrow.Array, startIdx int) error {
-	n := col.Len()
-	for i := 0; i < n; i++ {
-		if col.IsNull(i) {
-			var s *string
-			field.Set(startIdx+i, s)
-			continue
-		}
-		// arrow.Array's ValueStr renders the i-th element per the type's stringer.
-		v := col.ValueStr(i)
-		field.Set(startIdx+i, &v)
+	s.noteSlowQuery(ctx, sql, time.Since(start))
+	// Decoder modifications (see dataPolicy) are reviewed before anything
+	// else sees the frames.
+	err = s.policy.review(frames)
+	if err == nil && s.settings.DurationUnitsFromNames {
+		applyDurationNameUnits(frames)
 	}
-	return nil
+	return frames, err
 }
 
-// nullable is an interface satisfied by every Arrow array. Used to keep the
-// IsNull lookup polymorphic without a per-row type switch.
-type nullableArrow interface {
-	IsNull(int) bool
-	Len() int
-}
-
-// writeNumericColumn copies a bulk Arrow numeric slice into the (nullable)
-// destination field. When allValid is true the null bitmap is skipped.
-// All destination fields are nullable — see createEmptyField comment.
-func writeNumericColumn[T any](field *data.Field, arr nullableArrow, values []T, startIdx int, allValid bool) error {
-	n := arr.Len()
-	if allValid {
-		for i := 0; i < n; i++ {
-			v := values[i]
-			field.Set(startIdx+i, &v)
-		}
-		return nil
+// queryProtocolFrames is queryFrames without the post-decode passes.
+func (s *ArcInstanceSettings) queryProtocolFrames(ctx context.Context, sql string) (data.Frames, error) {
+	if !s.useArrow(ctx) {
+		return queryJSON(ctx, s, sql)
 	}
-	for i := 0; i < n; i++ {
-		if arr.IsNull(i) {
-			var v *T
-			field.Set(startIdx+i, v)
-			continue
-		}
-		v := values[i]
-		field.Set(startIdx+i, &v)
+	frame, err := queryArrow(ctx, s, sql)
+	if err == nil {
+		return data.Frames{frame}, nil
 	}
-	return nil
+	if s.settings.UseArrow != nil || !errors.Is(err, errNotArrowStream) {
+		return nil, err
+	}
+	log.DefaultLogger.Warn("Arrow endpoint returned a non-Arrow response; falling back to JSON",
+		"url", s.settings.URL, "error", err.Error())
+	c := s.protocolCache
+	c.mu.Lock()
+	c.resolved, c.arrow = true, false
+	c.mu.Unlock()
+	return queryJSON(ctx, s, sql)
 }
 
-// writePromotedColumn copies int64/uint64 Arrow values into a float64 field
-// (the Grafana-compatibility promotion).
-func writePromotedColumn[T int64 | uint64](field *data.Field, arr nullableArrow, values []T, startIdx int, allValid bool) error {
-	n := arr.Len()
-	if allValid {
-		for i := 0; i < n; i++ {
-			v := float64(values[i])
-			field.Set(startIdx+i, &v)
-		}
+// Per-query protocol: ArcQuery.Protocol "arrow" or "json" runs one query
+// over that protocol whatever useArrow says, for the few queries one of the
+// decoders mishandles; "auto" probes as an unset useArrow does, sharing the
+// instance's resolved answer; empty keeps the datasource's setting. The
+// protocol a query used is in its frame meta (protocolMetaKey) and debug
+// log.
+
+// protocolMetaKey is the FrameMeta.Custom key naming the protocol a query
+// ran over, as protocolName describes it.
+const protocolMetaKey = "protocol"
+
+// Values of ArcQuery.Protocol.
+const (
+	queryProtocolArrow = "arrow"
+	queryProtocolJSON  = "json"
+	queryProtocolAuto  = "auto"
+)
+
+// validateQueryProtocol rejects a protocol other than the values above.
+func validateQueryProtocol(protocol string) error {
+	switch strings.ToLower(protocol) {
+	case "", queryProtocolArrow, queryProtocolJSON, queryProtocolAuto:
 		return nil
 	}
-	for i := 0; i < n; i++ {
-		if arr.IsNull(i) {
-			var v *float64
-			field.Set(startIdx+i, v)
-			continue
-		}
-		v := float64(values[i])
-		field.Set(startIdx+i, &v)
-	}
-	return nil
+	return fmt.Errorf("invalid protocol %q (expected %q, %q or %q)", protocol, queryProtocolArrow, queryProtocolJSON, queryProtocolAuto)
 }
 
-// writeTimestampColumn uses Arrow's bulk TimestampValues slice and converts
-// to time.Time using the column's declared unit (passed in to avoid an
-// unchecked (*arrow.TimestampType) cast inside the hot loop — R2-CR4).
-func writeTimestampColumn(field *data.Field, col *array.Timestamp, unit arrow.TimeUnit, startIdx int, allValid bool) error {
-	values := col.TimestampValues()
-	n := col.Len()
-	if allValid {
-		for i := 0; i < n; i++ {
-			t := values[i].ToTime(unit)
-			field.Set(startIdx+i, &t)
-		}
-		return nil
-	}
-	for i := 0; i < n; i++ {
-		if col.IsNull(i) {
-			var t *time.Time
-			field.Set(startIdx+i, t)
-			continue
-		}
-		t := values[i].ToTime(unit)
-		field.Set(startIdx+i, &t)
+// withQueryProtocol returns settings that use protocol, validated, for one
+// query. The shallow copy keeps the shared client, semaphore and caches,
+// the protocol cache included, as in withProtocol.
+func (s *ArcInstanceSettings) withQueryProtocol(protocol string) *ArcInstanceSettings {
+	scoped := *s
+	switch strings.ToLower(protocol) {
+	case queryProtocolArrow, queryProtocolJSON:
+		arrow := strings.EqualFold(protocol, queryProtocolArrow)
+		scoped.settings.UseArrow = &arrow
+	case queryProtocolAuto:
+		scoped.settings.UseArrow = nil
+	default:
+		return s
 	}
-	return nil
+	return &scoped
 }
 
-// writeStringColumn writes Arrow string column values. Arrow's *array.String
-// has no bulk slice accessor (variable-width data), so per-row Value(i) is
-// the right shape here.
-func writeStringColumn(field *data.Field, col *array.String, startIdx int, allValid bool) error {
-	n := col.Len()
-	if allValid {
-		for i := 0; i < n; i++ {
-			s := col.Value(i)
-			field.Set(startIdx+i, &s)
+// attachProtocol records the protocol frames were queried over.
+func attachProtocol(frames data.Frames, protocol string) {
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
 		}
-		return nil
-	}
-	for i := 0; i < n; i++ {
-		if col.IsNull(i) {
-			var s *string
-			field.Set(startIdx+i, s)
-			continue
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = map[string]interface{}{}
+			frame.Meta.Custom = custom
 		}
-		s := col.Value(i)
-		field.Set(startIdx+i, &s)
+		custom[protocolMetaKey] = protocol
 	}
-	return nil
 }
 
-// writeBoolColumn writes Arrow boolean column values. *array.Boolean is
-// bitmap-backed; per-row Value(i) is the public accessor.
-func writeBoolColumn(field *data.Field, col *array.Boolean, startIdx int, allValid bool) error {
-	n := col.Len()
-	if allValid {
-		for i := 0; i < n; i++ {
-			b := col.Value(i)
-			field.Set(startIdx+i, &b)
-		}
-		return nil
+// protocolName describes the protocol in use for health and diagnostics:
+// "Arrow" or "JSON", suffixed with " (auto)" when it was probed rather than
+// configured.
+func (s *ArcInstanceSettings) protocolName(ctx context.Context) string {
+	name := "JSON"
+	if s.useArrow(ctx) {
+		name = "Arrow"
 	}
-	for i := 0; i < n; i++ {
-		if col.IsNull(i) {
-			var b *bool
-			field.Set(startIdx+i, b)
-			continue
-		}
-		b := col.Value(i)
-		field.Set(startIdx+i, &b)
+	if s.settings.UseArrow == nil {
+		name += " (auto)"
 	}
-	return nil
+	return name
 }
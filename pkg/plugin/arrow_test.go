@@ -1,12 +1,23 @@
 package plugin
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/apache/arrow/go/v14/arrow"
 	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
 	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
@@ -313,3 +324,602 @@ func TestNewFrameFromArrowSchema_AllTypes(t *testing.T) {
 		}
 	}
 }
+
+// arrowStreamSegments encodes one IPC stream per batch of values and returns
+// the wire bytes split at message boundaries: segments[0] is the schema plus
+// the first batch, each following segment one more batch, and the last
+// segment the EOS marker. Lets tests interleave padding between messages.
+func arrowStreamSegments(t *testing.T, batches ...[]float64) [][]byte {
+	t.Helper()
+	pool := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(pool))
+	var segments [][]byte
+	last := 0
+	for _, values := range batches {
+		b := array.NewRecordBuilder(pool, schema)
+		b.Field(0).(*array.Float64Builder).AppendValues(values, nil)
+		rec := b.NewRecord()
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("ipc write: %v", err)
+		}
+		rec.Release()
+		b.Release()
+		segments = append(segments, append([]byte(nil), buf.Bytes()[last:]...))
+		last = buf.Len()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ipc close: %v", err)
+	}
+	return append(segments, append([]byte(nil), buf.Bytes()[last:]...))
+}
+
+// ipcKeepAlive is the zero-length continuation message Arc writes as a
+// keep-alive on long-running streams.
+var ipcKeepAlive = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00}
+
+// TestQueryArrow_ToleratesKeepAlivePadding dribbles batches with delays,
+// zero-length keep-alive messages, stray whitespace and an empty batch. All
+// rows from the real batches must arrive; padding must not end the stream.
+func TestQueryArrow_ToleratesKeepAlivePadding(t *testing.T) {
+	segments := arrowStreamSegments(t, []float64{1, 2, 3}, []float64{}, []float64{4, 5})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for i, seg := range segments {
+			if i > 0 {
+				_, _ = w.Write(ipcKeepAlive)
+				_, _ = w.Write([]byte("\n "))
+				flusher.Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+			_, _ = w.Write(seg)
+			flusher.Flush()
+		}
+	}))
+	defer srv.Close()
+
+	frame, err := queryArrow(t.Context(), newTestInstance(t, srv.URL), "SELECT v FROM t")
+	if err != nil {
+		t.Fatalf("queryArrow: %v", err)
+	}
+	if frame.Rows() != 5 {
+		t.Fatalf("expected 5 rows across padded batches, got %d", frame.Rows())
+	}
+	if v := frame.Fields[0].At(4).(*float64); v == nil || *v != 5 {
+		t.Errorf("last row should be 5, got %v", v)
+	}
+}
+
+// TestQueryArrow_StalledStreamErrors locks in the per-read idle deadline: a
+// server that sends the first batch and then goes silent must fail with
+// errStreamStalled well before the client-wide timeout.
+func TestQueryArrow_StalledStreamErrors(t *testing.T) {
+	segments := arrowStreamSegments(t, []float64{1})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(segments[0])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	inst.streamIdleTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := queryArrow(t.Context(), inst, "SELECT v FROM t")
+	if !errors.Is(err, errStreamStalled) {
+		t.Fatalf("expected errStreamStalled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stall detection took %s, expected ~100ms", elapsed)
+	}
+}
+
+// TestQueryArrow_ReleasesBuffersOnEarlyExit cancels a query mid-stream and
+// cuts another off inside a batch; newTestInstance's checked allocator fails
+// the test if either leaves Arrow buffers behind.
+func TestQueryArrow_ReleasesBuffersOnEarlyExit(t *testing.T) {
+	segments := arrowStreamSegments(t, []float64{1, 2}, []float64{3, 4})
+
+	t.Run("canceled", func(t *testing.T) {
+		sent := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(segments[0])
+			w.(http.Flusher).Flush()
+			close(sent)
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		go func() {
+			<-sent
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		if _, err := queryArrow(ctx, newTestInstance(t, srv.URL), "SELECT v FROM t"); err == nil {
+			t.Fatal("expected an error from a canceled query")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(segments[0])
+			_, _ = w.Write(segments[1][:len(segments[1])/2])
+		}))
+		defer srv.Close()
+
+		if _, err := queryArrow(t.Context(), newTestInstance(t, srv.URL), "SELECT v FROM t"); err == nil {
+			t.Fatal("expected an error from a truncated stream")
+		}
+	})
+}
+
+func TestStreamIdleTimeoutFor(t *testing.T) {
+	for _, tc := range []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{30 * time.Second, 15 * time.Second},
+		{120 * time.Second, DefaultStreamIdleTimeout},
+		{0, DefaultStreamIdleTimeout},
+	} {
+		if got := streamIdleTimeoutFor(tc.timeout); got != tc.want {
+			t.Errorf("streamIdleTimeoutFor(%s) = %s, want %s", tc.timeout, got, tc.want)
+		}
+	}
+}
+
+// TestUseArrow_AutoProbesOnceAndCaches locks in the tri-state useArrow
+// handling: an absent key probes the Arrow endpoint once per instance, a
+// missing endpoint resolves to JSON, and an explicit setting never probes.
+func TestUseArrow_AutoProbesOnceAndCaches(t *testing.T) {
+	stream := bytes.Join(arrowStreamSegments(t, []float64{1}), nil)
+	for _, c := range []struct {
+		name      string
+		handler   http.HandlerFunc
+		setting   *bool
+		wantArrow bool
+		wantProbe int32
+	}{
+		{"auto-arrow", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(stream) }, nil, true, 1},
+		{"auto-missing-endpoint", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }, nil, false, 1},
+		{"auto-not-arrow", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(`{"columns":[]}`)) }, nil, false, 1},
+		{"explicit-false", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(stream) }, new(bool), false, 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var probes atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				probes.Add(1)
+				c.handler(w, r)
+			}))
+			defer srv.Close()
+			inst := newTestInstance(t, srv.URL)
+			inst.settings.UseArrow = c.setting
+
+			for i := 0; i < 3; i++ {
+				if got := inst.useArrow(t.Context()); got != c.wantArrow {
+					t.Fatalf("useArrow = %v, want %v", got, c.wantArrow)
+				}
+			}
+			if probes.Load() != c.wantProbe {
+				t.Errorf("expected %d probes, got %d", c.wantProbe, probes.Load())
+			}
+		})
+	}
+}
+
+// TestUseArrow_InconclusiveProbeRetries checks that Arc being down doesn't
+// pin the instance to JSON: the probe result isn't cached.
+func TestUseArrow_InconclusiveProbeRetries(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	inst.retryStatusCodes = nil // count probes, not retries
+
+	if !inst.useArrow(t.Context()) || !inst.useArrow(t.Context()) {
+		t.Error("inconclusive probe should default to Arrow")
+	}
+	if probes.Load() != 2 {
+		t.Errorf("expected a fresh probe per call while inconclusive, got %d", probes.Load())
+	}
+	if name := inst.protocolName(t.Context()); name != "Arrow (auto)" {
+		t.Errorf("protocolName = %q", name)
+	}
+}
+
+// TestContentNegotiation checks the Accept header each path sends and the
+// Content-Type verification before decoding: the clearly wrong answers
+// (JSON from /arrow, an HTML proxy page from the JSON path) fail with a
+// targeted error, while the loose labels Arc and proxies really use pass.
+func TestContentNegotiation(t *testing.T) {
+	stream := bytes.Join(arrowStreamSegments(t, []float64{1}), nil)
+	jsonBody := []byte(`{"columns":["v"],"data":[[1]]}`)
+	cases := []struct {
+		name        string
+		arrow       bool
+		contentType string
+		body        []byte
+		wantErr     string // substring; empty = success
+	}{
+		{"arrow stream", true, "application/vnd.apache.arrow.stream", stream, ""},
+		{"arrow as octet-stream", true, "application/octet-stream", stream, ""},
+		{"arrow without content type", true, "", stream, ""},
+		{"JSON from arrow path", true, "application/json", jsonBody, "expected Arrow stream, got application/json — the /api/v1/query/arrow endpoint may be unavailable on this Arc version"},
+		{"json", false, "application/json; charset=utf-8", jsonBody, ""},
+		{"json as text/plain", false, "text/plain", jsonBody, ""},
+		{"html from json path", false, "text/html; charset=utf-8", []byte("<html>login</html>"), "expected application/json from /api/v1/query, got text/html"},
+		{"arrow from json path", false, "application/vnd.apache.arrow.stream", stream, "got application/vnd.apache.arrow.stream"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var accept string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept")
+				if c.contentType != "" {
+					w.Header().Set("Content-Type", c.contentType)
+				} else {
+					w.Header()["Content-Type"] = nil // suppress sniffing
+				}
+				_, _ = w.Write(c.body)
+			}))
+			defer srv.Close()
+			inst := newTestInstance(t, srv.URL)
+
+			var err error
+			wantAccept := jsonMediaType
+			if c.arrow {
+				wantAccept = arrowStreamMediaType
+				_, err = queryArrow(t.Context(), inst, "SELECT 1")
+			} else {
+				_, err = queryJSON(t.Context(), inst, "SELECT 1")
+			}
+			if accept != wantAccept {
+				t.Errorf("Accept = %q, want %q", accept, wantAccept)
+			}
+			if c.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errUnexpectedContentType) {
+				t.Fatalf("expected errUnexpectedContentType, got %v", err)
+			}
+			if c.arrow && !errors.Is(err, errNotArrowStream) {
+				t.Errorf("an Arrow mismatch must wrap errNotArrowStream for the JSON fallback, got %v", err)
+			}
+			if msg := sanitizeUserError("A", err); !strings.Contains(msg, c.wantErr) {
+				t.Errorf("user message %q does not contain %q", msg, c.wantErr)
+			}
+		})
+	}
+}
+
+// TestQueryFrames_FallsBackToJSONWhenArrowPathAnswersJSON covers a proxy
+// that starts rewriting /arrow after the auto probe chose Arrow: the query
+// still succeeds over JSON and the instance stays on JSON afterwards. With
+// useArrow configured explicitly there is no fallback.
+func TestQueryFrames_FallsBackToJSONWhenArrowPathAnswersJSON(t *testing.T) {
+	var arrowHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/arrow") {
+			arrowHits.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	inst.protocolCache.resolved, inst.protocolCache.arrow = true, true
+	for i := 0; i < 2; i++ {
+		frames, err := inst.queryFrames(t.Context(), "SELECT 1")
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		if len(frames) != 1 || frames[0].Rows() != 1 {
+			t.Fatalf("query %d: unexpected frames %v", i, frames)
+		}
+	}
+	if n := arrowHits.Load(); n != 1 {
+		t.Errorf("expected one Arrow attempt before demotion, got %d", n)
+	}
+	if inst.protocolName(t.Context()) != "JSON (auto)" {
+		t.Errorf("protocol = %q, want JSON (auto)", inst.protocolName(t.Context()))
+	}
+
+	explicit := newTestInstance(t, srv.URL)
+	useArrow := true
+	explicit.settings.UseArrow = &useArrow
+	if _, err := explicit.queryFrames(t.Context(), "SELECT 1"); !errors.Is(err, errNotArrowStream) {
+		t.Errorf("explicit useArrow must not fall back, got %v", err)
+	}
+}
+
+// TestQueryArrow_NullTypeColumn checks a NULL-typed column (`SELECT NULL AS
+// x`) decodes as an all-null nullable string field, not the "(null)" text
+// the generic fallback would render.
+func TestQueryArrow_NullTypeColumn(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "x", Type: arrow.Null, Nullable: true},
+	}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.Float64Builder).AppendValues([]float64{1, 2, 3}, nil)
+		b.Field(1).(*array.NullBuilder).AppendNulls(3)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(stream)
+	}))
+	defer srv.Close()
+
+	frame, err := queryArrow(t.Context(), newTestInstance(t, srv.URL), "SELECT v, NULL AS x FROM t")
+	if err != nil {
+		t.Fatalf("queryArrow: %v", err)
+	}
+	if frame.Rows() != 3 {
+		t.Fatalf("expected 3 rows, got %d", frame.Rows())
+	}
+	x := frame.Fields[1]
+	if x.Type() != data.FieldTypeNullableString {
+		t.Fatalf("expected a nullable string field, got %s", x.Type())
+	}
+	for i := 0; i < x.Len(); i++ {
+		if v := x.At(i).(*string); v != nil {
+			t.Errorf("row %d: expected null, got %q", i, *v)
+		}
+	}
+}
+
+// TestQuery_ZeroFieldSchema checks a schema with no fields comes back, in
+// every format and under splitting, as one empty frame named after the
+// query, untyped, with a "no columns" notice.
+func TestQuery_ZeroFieldSchema(t *testing.T) {
+	stream := arcclienttest.ArrowStream(t, arrow.NewSchema(nil, nil), func(*array.RecordBuilder) {})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(stream)
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+
+	now := time.Now()
+	for _, query := range []string{
+		`{"sql":"SELECT * EXCLUDE (a) FROM t","format":"time_series"}`,
+		`{"sql":"SELECT * EXCLUDE (a) FROM t","format":"table"}`,
+		`{"sql":"SELECT * EXCLUDE (a) FROM t","format":"numeric_table"}`,
+		`{"sql":"SELECT * EXCLUDE (a) FROM t WHERE $__timeFilter(time)","format":"time_series","splitDuration":"1h"}`,
+	} {
+		resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: now.Add(-3 * time.Hour), To: now},
+			JSON:      []byte(query),
+		})
+		if resp.Error != nil {
+			t.Fatalf("%s: %v", query, resp.Error)
+		}
+		if len(resp.Frames) != 1 {
+			t.Fatalf("%s: expected one frame, got %d", query, len(resp.Frames))
+		}
+		frame := resp.Frames[0]
+		if frame.Name != "A" || len(frame.Fields) != 0 {
+			t.Errorf("%s: expected an empty frame named A, got %q with %d fields", query, frame.Name, len(frame.Fields))
+		}
+		if frame.Meta.Type != "" || frame.Meta.PreferredVisualization != "" {
+			t.Errorf("%s: empty frame should be untyped, got %q/%q", query, frame.Meta.Type, frame.Meta.PreferredVisualization)
+		}
+		if notices := frame.Meta.Notices; len(notices) != 1 || notices[0].Text != "Query returned no columns" {
+			t.Errorf("%s: expected the no-columns notice, got %+v", query, notices)
+		}
+	}
+}
+
+// uint64ArrowServer answers every query with one UINT64 column "n" holding
+// values.
+func uint64ArrowServer(t *testing.T, values ...uint64) *httptest.Server {
+	t.Helper()
+	schema := arrow.NewSchema([]arrow.Field{{Name: "n", Type: arrow.PrimitiveTypes.Uint64}}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.Uint64Builder).AppendValues(values, nil)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(stream)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestQueryArrow_Uint64PastExactFloat(t *testing.T) {
+	const aboveMax = uint64(1)<<53 + 1
+	srv := uint64ArrowServer(t, 1, aboveMax)
+	off, on := false, true
+	cases := []struct {
+		name          string
+		exactUint64   *bool
+		preferNumeric bool
+		wantType      data.FieldType
+		wantNotice    string
+	}{
+		{name: "default", wantType: data.FieldTypeNullableString, wantNotice: "shown as text"},
+		{name: "prefer numeric", exactUint64: &on, preferNumeric: true, wantType: data.FieldTypeNullableFloat64, wantNotice: "lose precision"},
+		{name: "off", exactUint64: &off, wantType: data.FieldTypeNullableFloat64},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inst := newTestInstance(t, srv.URL)
+			inst.settings.ExactUint64 = c.exactUint64
+			inst.settings.PreferNumeric = c.preferNumeric
+			frame, err := queryArrow(t.Context(), inst, "SELECT n FROM counters")
+			if err != nil {
+				t.Fatalf("queryArrow: %v", err)
+			}
+			if got := frame.Fields[0].Type(); got != c.wantType {
+				t.Fatalf("field type = %s, want %s", got, c.wantType)
+			}
+			if c.wantType == data.FieldTypeNullableString {
+				if v := frame.Fields[0].At(1).(*string); v == nil || *v != "9007199254740993" {
+					t.Errorf("value = %v, want 9007199254740993", v)
+				}
+			}
+			var notices []string
+			for _, n := range frame.Meta.Notices {
+				notices = append(notices, n.Text)
+			}
+			switch {
+			case c.wantNotice == "" && len(notices) > 0:
+				t.Errorf("unexpected notices %q", notices)
+			case c.wantNotice != "" && (len(notices) != 1 || !strings.Contains(notices[0], c.wantNotice)):
+				t.Errorf("notices = %q, want one containing %q", notices, c.wantNotice)
+			}
+		})
+	}
+}
+
+// TestMergeFrames_ReconcilesUint64Text merges a chunk that turned a UINT64
+// column into text with one that didn't need to: both must survive.
+func TestMergeFrames_ReconcilesUint64Text(t *testing.T) {
+	small, err := queryArrow(t.Context(), newTestInstance(t, uint64ArrowServer(t, 1, 2).URL), "SELECT n FROM counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := queryArrow(t.Context(), newTestInstance(t, uint64ArrowServer(t, 1<<63).URL), "SELECT n FROM counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, skipped := mergeFramesSkipping([]*data.Frame{small, large})
+	if skipped != 0 {
+		t.Fatalf("skipped %d chunks", skipped)
+	}
+	if merged.Rows() != 3 || merged.Fields[0].Type() != data.FieldTypeNullableString {
+		t.Fatalf("merged %d rows of %s, want 3 of text", merged.Rows(), merged.Fields[0].Type())
+	}
+	for i, want := range []string{"1", "2", "9223372036854775808"} {
+		if v := merged.Fields[0].At(i).(*string); v == nil || *v != want {
+			t.Errorf("row %d = %v, want %s", i, v, want)
+		}
+	}
+}
+
+// TestQuery_ProtocolOverride: a query's protocol wins over the datasource's
+// useArrow, and the frame meta says which protocol ran.
+func TestQuery_ProtocolOverride(t *testing.T) {
+	stream := bytes.Join(arrowStreamSegments(t, []float64{1}), nil)
+	var arrowHits, jsonHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/arrow") {
+			arrowHits.Add(1)
+			_, _ = w.Write(stream)
+			return
+		}
+		jsonHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name      string
+		useArrow  bool
+		protocol  string
+		want      string
+		wantArrow int32
+		wantJSON  int32
+	}{
+		{"datasource setting", false, "", "JSON", 0, 1},
+		{"arrow over json", false, "arrow", "Arrow", 1, 0},
+		{"json over arrow", true, "JSON", "JSON", 0, 1},
+		{"auto probes", false, "auto", "Arrow (auto)", 2, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			arrowHits.Store(0)
+			jsonHits.Store(0)
+			res, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+				PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": c.useArrow}),
+				Queries: []backend.DataQuery{{
+					RefID: "A",
+					JSON:  []byte(`{"sql":"SELECT v FROM t","format":"table","protocol":"` + c.protocol + `"}`),
+				}},
+			})
+			if err != nil {
+				t.Fatalf("QueryData: %v", err)
+			}
+			resp := res.Responses["A"]
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{})
+			if got := custom[protocolMetaKey]; got != c.want {
+				t.Errorf("meta protocol = %v, want %q", got, c.want)
+			}
+			if arrowHits.Load() != c.wantArrow || jsonHits.Load() != c.wantJSON {
+				t.Errorf("Arrow requests %d, JSON requests %d; want %d and %d", arrowHits.Load(), jsonHits.Load(), c.wantArrow, c.wantJSON)
+			}
+		})
+	}
+
+	res, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, nil),
+		Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT 1","protocol":"csv"}`)}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	if resp := res.Responses["A"]; resp.Status != backend.StatusBadRequest || !strings.Contains(resp.Error.Error(), `invalid protocol "csv"`) {
+		t.Errorf("status %d, error %v; want a 400 naming the protocol", resp.Status, resp.Error)
+	}
+}
+
+// TestCheckHealth_JSONOnlyServer locks in that Save & Test uses the
+// protocol queries do: a server without the Arrow endpoint passes with
+// useArrow off and with it unset (auto falls back to JSON).
+func TestCheckHealth_JSONOnlyServer(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		extra    map[string]any
+		protocol string
+	}{
+		{"json", map[string]any{"useArrow": false}, "JSON"},
+		{"auto", nil, "JSON (auto)"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var queries []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/query" {
+					http.NotFound(w, r)
+					return
+				}
+				var body struct {
+					SQL string `json:"sql"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				queries = append(queries, body.SQL)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"columns":["name"],"data":[["telemetry"]]}`))
+			}))
+			defer srv.Close()
+
+			pctx := testPluginContext(t, srv.URL, c.extra)
+			res, err := NewArcDatasource().CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx})
+			if err != nil || res.Status != backend.HealthStatusOk {
+				t.Fatalf("CheckHealth: %v %+v", err, res)
+			}
+			if !strings.Contains(res.Message, "protocol: "+c.protocol) {
+				t.Errorf("message = %q, want protocol %s", res.Message, c.protocol)
+			}
+			if len(queries) != 1 || queries[0] != "SHOW DATABASES" {
+				t.Errorf("JSON queries = %q, want just SHOW DATABASES", queries)
+			}
+		})
+	}
+}
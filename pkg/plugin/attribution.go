@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Query attribution (queryAttribution setting): every query sent to Arc gets
+// a leading comment naming where it came from, so Arc's query log can
+// attribute load to dashboards:
+//
+//	/* grafana dashboard=abc123 panel=4 user=alice refId=A */ SELECT ...
+//
+// The comment is added last, to the SQL exactly as it goes out — after
+// snippets, macros and every rewrite — so nothing that inspects or rewrites
+// the query ever sees it, and the chunk cache keys stay user-independent.
+// It is off by default: the user's login ends up in Arc's logs. With
+// hideAttribution the query inspector's ExecutedQueryString shows the SQL
+// without the comment.
+//
+// Values come from request headers and user names, so they are reduced to
+// a safe character set (sanitizeAttributionValue): no value can close the
+// comment early.
+
+// defaultAttributionTemplate is used when attributionTemplate is empty.
+const defaultAttributionTemplate = "grafana dashboard=${dashboard} panel=${panel} user=${user} refId=${refId}"
+
+// maxAttributionValueLen caps each substituted value.
+const maxAttributionValueLen = 64
+
+var attributionPlaceholderRe = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// attributionValues are the template's placeholders.
+var attributionValues = map[string]func(origin requestOrigin, user *backend.User, refID string) string{
+	"dashboard": func(o requestOrigin, _ *backend.User, _ string) string { return o.Dashboard },
+	"panel":     func(o requestOrigin, _ *backend.User, _ string) string { return o.Panel },
+	"org": func(o requestOrigin, _ *backend.User, _ string) string {
+		if o.OrgID == 0 {
+			return ""
+		}
+		return strconv.FormatInt(o.OrgID, 10)
+	},
+	"user": func(_ requestOrigin, u *backend.User, _ string) string {
+		if u == nil {
+			return ""
+		}
+		return u.Login
+	},
+	"refId": func(_ requestOrigin, _ *backend.User, refID string) string { return refID },
+}
+
+// validateAttributionTemplate checks the attributionTemplate setting: known
+// placeholders only, and nothing that could end the comment or the line.
+func validateAttributionTemplate(tmpl string) error {
+	if strings.Contains(tmpl, "*/") || strings.Contains(tmpl, "/*") || strings.ContainsAny(tmpl, "\r\n") {
+		return errors.New("invalid attributionTemplate: it can't contain '/*', '*/' or line breaks")
+	}
+	for _, p := range attributionPlaceholderRe.FindAllStringSubmatch(tmpl, -1) {
+		if attributionValues[p[1]] == nil {
+			return fmt.Errorf("invalid attributionTemplate: unknown placeholder %s (supported: ${dashboard}, ${panel}, ${org}, ${user}, ${refId})", p[0])
+		}
+	}
+	return nil
+}
+
+// sanitizeAttributionValue keeps letters, digits and ._-@: of v, replaces
+// anything else with '_' and caps the length; an empty value becomes "-".
+func sanitizeAttributionValue(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if b.Len() >= maxAttributionValueLen {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("._-@:", r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// requestOrigin is where a query request came from, as far as Grafana says.
+type requestOrigin struct {
+	Dashboard string
+	Panel     string
+	OrgID     int64
+	Alert     bool // an alert rule evaluation (FromAlert header)
+}
+
+type requestOriginKey struct{}
+
+// withRequestOrigin returns ctx carrying req's dashboard, panel and org.
+func withRequestOrigin(ctx context.Context, req *backend.QueryDataRequest) context.Context {
+	origin := requestOrigin{
+		Dashboard: req.GetHTTPHeader("X-Dashboard-Uid"),
+		Panel:     req.GetHTTPHeader("X-Panel-Id"),
+		OrgID:     req.PluginContext.OrgID,
+		Alert:     req.Headers["FromAlert"] == "true",
+	}
+	return context.WithValue(ctx, requestOriginKey{}, origin)
+}
+
+// requestOriginFrom returns the origin withRequestOrigin stored, or the
+// zero origin.
+func requestOriginFrom(ctx context.Context) requestOrigin {
+	origin, _ := ctx.Value(requestOriginKey{}).(requestOrigin)
+	return origin
+}
+
+type attributionKey struct{}
+
+// withAttribution returns ctx carrying the attribution comment for query
+// refID, or ctx itself when attribution is off.
+func (s *ArcInstanceSettings) withAttribution(ctx context.Context, refID string) context.Context {
+	if !s.settings.QueryAttribution {
+		return ctx
+	}
+	tmpl := s.settings.AttributionTemplate
+	if tmpl == "" {
+		tmpl = defaultAttributionTemplate
+	}
+	origin := requestOriginFrom(ctx)
+	user := requestUserFrom(ctx)
+	body := attributionPlaceholderRe.ReplaceAllStringFunc(tmpl, func(p string) string {
+		value := attributionValues[p[2:len(p)-1]]
+		if value == nil {
+			return p // unreachable after validateAttributionTemplate
+		}
+		return sanitizeAttributionValue(value(origin, user, refID))
+	})
+	return context.WithValue(ctx, attributionKey{}, "/* "+body+" */ ")
+}
+
+// attributed returns sql with ctx's attribution comment, if any, prepended.
+func attributed(ctx context.Context, sql string) string {
+	comment, _ := ctx.Value(attributionKey{}).(string)
+	return comment + sql
+}
+
+// shownSQL is the ExecutedQueryString for sent, a query attributed: sent
+// itself, or without the comment under hideAttribution.
+func (s *ArcInstanceSettings) shownSQL(ctx context.Context, sent string) string {
+	if !s.settings.HideAttribution {
+		return sent
+	}
+	comment, _ := ctx.Value(attributionKey{}).(string)
+	return strings.TrimPrefix(sent, comment)
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestSanitizeAttributionValue(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice@example.com":      "alice@example.com",
+		"evil */ DROP TABLE x":   "evil____DROP_TABLE_x",
+		"/* nested":              "___nested",
+		"line\nbreak":            "line_break",
+		"":                       "-",
+		strings.Repeat("a", 100): strings.Repeat("a", maxAttributionValueLen),
+	} {
+		if got := sanitizeAttributionValue(in); got != want {
+			t.Errorf("sanitizeAttributionValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidateAttributionTemplate(t *testing.T) {
+	for tmpl, ok := range map[string]bool{
+		"":                             true,
+		defaultAttributionTemplate:     true,
+		"org=${org} dash=${dashboard}": true,
+		"user=${email}":                false,
+		"x */ y":                       false,
+		"x /* y":                       false,
+		"two\nlines":                   false,
+	} {
+		if err := validateAttributionTemplate(tmpl); (err == nil) != ok {
+			t.Errorf("validateAttributionTemplate(%q) = %v, want ok=%v", tmpl, err, ok)
+		}
+	}
+}
+
+// TestQueryData_Attribution checks the comment reaches Arc on plain and
+// split queries with the request's dashboard, panel and user, that a
+// hostile login can't close it, and that hideAttribution keeps it out of
+// ExecutedQueryString.
+func TestQueryData_Attribution(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.SQL)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"time", "value"}, "data": []interface{}{}})
+	}))
+	defer srv.Close()
+
+	const comment = "/* grafana dashboard=dash-1 panel=7 user=mallory____DROP refId=A */ "
+	to := time.Now()
+	for _, c := range []struct {
+		name  string
+		extra map[string]any
+		query string
+		shown bool
+	}{
+		{"off", map[string]any{}, `{"sql":"SELECT 1"}`, false},
+		{"single", map[string]any{"queryAttribution": true}, `{"sql":"SELECT 1"}`, true},
+		{"split", map[string]any{"queryAttribution": true}, `{"sql":"SELECT time, value FROM cpu WHERE $__timeFilter(time)","format":"table","splitDuration":"1h"}`, false},
+		{"hidden", map[string]any{"queryAttribution": true, "hideAttribution": true}, `{"sql":"SELECT 1"}`, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			seen = nil
+			c.extra["useArrow"] = false
+			req := &backend.QueryDataRequest{
+				PluginContext: testPluginContext(t, srv.URL, c.extra),
+				Queries: []backend.DataQuery{{
+					RefID:     "A",
+					TimeRange: backend.TimeRange{From: to.Add(-3 * time.Hour), To: to},
+					JSON:      []byte(c.query),
+				}},
+			}
+			req.PluginContext.User = &backend.User{Login: "mallory */ DROP"}
+			req.SetHTTPHeader("X-Dashboard-Uid", "dash-1")
+			req.SetHTTPHeader("X-Panel-Id", "7")
+
+			res, err := NewArcDatasource().QueryData(t.Context(), req)
+			if err != nil {
+				t.Fatalf("QueryData: %v", err)
+			}
+			resp := res.Responses["A"]
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			if len(seen) == 0 {
+				t.Fatal("no query reached Arc")
+			}
+			for _, sql := range seen {
+				if got := strings.HasPrefix(sql, comment); got != (c.name != "off") {
+					t.Errorf("attribution sent = %v: %q", got, sql)
+				}
+				if strings.Count(sql, "*/") > 1 {
+					t.Errorf("comment closed early: %q", sql)
+				}
+			}
+			if len(resp.Frames) > 0 && resp.Frames[0].Meta != nil {
+				if got := strings.Contains(resp.Frames[0].Meta.ExecutedQueryString, comment); got != c.shown {
+					t.Errorf("attribution shown = %v: %q", got, resp.Frames[0].Meta.ExecutedQueryString)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"golang.org/x/sync/errgroup"
+)
+
+// Schema audit (POST /audit): after a column is renamed or a table dropped
+// in Arc, the dashboards that used it fail one panel at a time with raw SQL
+// errors. The audit takes the query models of any number of panels — the
+// targets of exported dashboard JSON — and runs each through the same
+// steps as POST /schema (database override, credential, snippets, query
+// restrictions, macros, then a `LIMIT 0` probe), MaxConcurrency at a time.
+// It answers one status per query and a summary, with ok false when any
+// query failed, so a CI job can gate on it. Probes skip the schema cache
+// (a drift check must see the current schema) but refresh it.
+
+// Audit statuses.
+const (
+	auditOK              = "ok"
+	auditSkipped         = "skipped" // no SQL, like a panel's empty target
+	auditMissingDatabase = "missing_database"
+	auditMissingTable    = "missing_table"
+	auditMissingColumn   = "missing_column"
+	auditSyntaxError     = "syntax_error"
+	auditBlocked         = "blocked" // refused by the datasource's query policies
+	auditInvalid         = "invalid" // a query model the datasource can't run as given
+	auditError           = "error"
+)
+
+// maxAuditQueries caps the queries in one audit request.
+const maxAuditQueries = 1000
+
+var (
+	// missingColumnRe and syntaxErrorRe read DuckDB's binder and parser
+	// errors: `Referenced column "host" not found in FROM clause!`,
+	// `Table "cpu" does not have a column named "host"`, `syntax error at
+	// or near "FORM"`.
+	missingColumnRe = regexp.MustCompile(`(?i)(?:\bcolumn\s+["'\x60]?([\w.]+)["'\x60]?\s+(?:not found|does not exist)|does not have a column named\s+["'\x60]?([\w.]+))`)
+	syntaxErrorRe   = regexp.MustCompile(`(?i)syntax error at (?:or near\s+"[^"\n]*"|end of input)`)
+)
+
+// auditQuery is one query of a POST /audit request: a panel target, with
+// an optional label the report echoes back to find it again.
+type auditQuery struct {
+	ArcQuery
+	Panel string `json:"panel"`
+}
+
+// auditRequest is the POST /audit body. From and To are the time range
+// macros expand over (default: the last hour).
+type auditRequest struct {
+	Queries []auditQuery `json:"queries"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+}
+
+// auditResult is the outcome for one query, in request order. Detail names
+// the missing object or the syntax error; Columns is the schema of a query
+// that passed.
+type auditResult struct {
+	Index   int            `json:"index"`
+	RefID   string         `json:"refId,omitempty"`
+	Panel   string         `json:"panel,omitempty"`
+	Status  string         `json:"status"`
+	Detail  string         `json:"detail,omitempty"`
+	Columns []schemaColumn `json:"columns,omitempty"`
+}
+
+// auditReport is the POST /audit answer. Summary counts results by status.
+type auditReport struct {
+	OK      bool           `json:"ok"`
+	Total   int            `json:"total"`
+	Summary map[string]int `json:"summary"`
+	Results []auditResult  `json:"results"`
+}
+
+// handleAudit checks a batch of query models against Arc's current schema.
+func (d *ArcDatasource) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("audit", err))
+		return
+	}
+	var req auditRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<20)).Decode(&req); err != nil {
+		writeResourceError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Queries) == 0 {
+		writeResourceError(w, http.StatusBadRequest, "queries is required")
+		return
+	}
+	if len(req.Queries) > maxAuditQueries {
+		writeResourceError(w, http.StatusBadRequest, "too many queries: audit at most "+strconv.Itoa(maxAuditQueries)+" per request")
+		return
+	}
+
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	results := make([]auditResult, len(req.Queries))
+	var g errgroup.Group
+	g.SetLimit(settings.settings.MaxConcurrency)
+	for i, q := range req.Queries {
+		g.Go(func() error {
+			results[i] = settings.auditQuery(r.Context(), user, q, req.From, req.To)
+			results[i].Index, results[i].RefID, results[i].Panel = i, q.RefID, q.Panel
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	report := auditReport{OK: true, Total: len(results), Summary: map[string]int{}, Results: results}
+	for _, res := range results {
+		report.Summary[res.Status]++
+		if res.Status != auditOK && res.Status != auditSkipped {
+			report.OK = false
+		}
+	}
+	log.DefaultLogger.Info("Schema audit finished", "queries", report.Total, "ok", report.OK, "summary", report.Summary)
+	writeResourceJSON(w, http.StatusOK, report)
+}
+
+// auditQuery probes one query and classifies the outcome.
+func (s *ArcInstanceSettings) auditQuery(ctx context.Context, user *backend.User, q auditQuery, from, to time.Time) auditResult {
+	if err := ctx.Err(); err != nil {
+		return auditResult{Status: auditError, Detail: "audit cancelled before the query ran"}
+	}
+	sql := q.SQL
+	if sql == "" {
+		sql = q.RawSQL
+	}
+	if strings.TrimSpace(sql) == "" {
+		return auditResult{Status: auditSkipped, Detail: "no SQL"}
+	}
+	refID := "audit"
+	if q.RefID != "" {
+		refID = "audit " + q.RefID
+	}
+	settings, err := s.withDatabaseOverride(refID, q.Database)
+	if err == nil {
+		settings, err = settings.withCredential(refID, q.Credential, user)
+	}
+	var blocked *blockedQueryError
+	switch {
+	case errors.As(err, &blocked):
+		return auditResult{Status: auditBlocked, Detail: err.Error()}
+	case err != nil:
+		return auditResult{Status: auditInvalid, Detail: sanitizeUserError("audit", err)}
+	}
+	if sql, err = settings.expandSnippets(sql, user); err != nil {
+		return auditResult{Status: auditInvalid, Detail: err.Error()}
+	}
+	if err := settings.checkRestrictions(refID, user, sql); err != nil {
+		return auditResult{Status: auditBlocked, Detail: err.Error()}
+	}
+
+	cols, err := settings.probeSchema(ctx, schemaRequest{ArcQuery: ArcQuery{SQL: sql}, From: from, To: to})
+	if err != nil {
+		status, detail := classifyAuditError(err)
+		if status == auditError {
+			log.DefaultLogger.Warn("Schema audit probe failed", "refId", q.RefID, "panel", q.Panel, "error", err)
+		}
+		return auditResult{Status: status, Detail: detail}
+	}
+	return auditResult{Status: auditOK, Columns: cols}
+}
+
+// classifyAuditError maps a failed probe to an audit status and a detail
+// safe to show: the missing object's name or the parser's "syntax error at
+// or near …", which only quote the query's own SQL.
+func classifyAuditError(err error) (status, detail string) {
+	var statusErr *arcStatusError
+	if !errors.As(err, &statusErr) {
+		return auditError, sanitizeUserError("audit", err)
+	}
+	switch kind, name := classifyArcError(statusErr.Body); kind {
+	case notFoundDatabase:
+		return auditMissingDatabase, "missing database " + orUnnamed(name)
+	case notFoundTable:
+		return auditMissingTable, "missing table " + orUnnamed(name)
+	}
+	if m := missingColumnRe.FindStringSubmatch(statusErr.Message); m != nil {
+		return auditMissingColumn, "missing column " + firstNonEmpty(m[1], m[2])
+	}
+	if m := syntaxErrorRe.FindString(statusErr.Message); m != "" {
+		return auditSyntaxError, m
+	}
+	return auditError, sanitizeUserError("audit", err)
+}
+
+// orUnnamed stands in for a name Arc's error didn't give.
+func orUnnamed(name string) string {
+	if name == "" {
+		return "(unnamed)"
+	}
+	return name
+}
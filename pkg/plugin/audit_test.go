@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+)
+
+// TestHandleAudit: each query gets a status from its LIMIT 0 probe, the
+// summary counts them, and probes run at most MaxConcurrency at a time.
+func TestHandleAudit(t *testing.T) {
+	stream := schemaOnlyArrowStream(t, arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}, Nullable: true},
+		{Name: "usage", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil))
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+		sql := string(raw)
+		switch {
+		case strings.Contains(sql, "FORM"):
+			http.Error(w, `{"error":"Parser Error: syntax error at or near \"FORM\""}`, http.StatusBadRequest)
+		case strings.Contains(sql, "old_cpu"):
+			http.Error(w, `{"error":"Catalog Error: Table with name old_cpu does not exist!"}`, http.StatusBadRequest)
+		case strings.Contains(sql, "hostname"):
+			http.Error(w, `{"error":"Binder Error: Referenced column \"hostname\" not found in FROM clause!"}`, http.StatusBadRequest)
+		case strings.Contains(sql, "mem"):
+			http.Error(w, `{"error":"IO Error: secret internal path /var/arc/mem"}`, http.StatusInternalServerError)
+		default:
+			_, _ = w.Write(stream)
+		}
+	}))
+	defer srv.Close()
+
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"maxConcurrency": 2, "retryStatusCodes": []int{}})
+	queries := []map[string]any{
+		{"refId": "A", "panel": "CPU", "sql": "SELECT time, usage FROM cpu WHERE $__timeFilter(time)"},
+		{"refId": "B", "panel": "CPU", "rawSql": "SELECT time, hostname FROM cpu"},
+		{"refId": "C", "sql": "SELECT * FROM old_cpu"},
+		{"refId": "D", "sql": "SELECT * FORM cpu"},
+		{"refId": "E", "sql": "SELECT * FROM mem"},
+		{"refId": "F", "sql": "SELECT 1", "credential": "admin"},
+		{"refId": "G", "sql": " "},
+	}
+	for i := 0; i < 5; i++ {
+		queries = append(queries, map[string]any{"refId": "A", "sql": "SELECT time, usage FROM cpu"})
+	}
+	status, body := callResource(t, d, pctx, http.MethodPost, "/audit", map[string]any{"queries": queries})
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var report auditReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || report.Total != len(queries) {
+		t.Errorf("ok %v, total %d", report.OK, report.Total)
+	}
+	want := []struct{ status, detail string }{
+		{auditOK, ""},
+		{auditMissingColumn, "missing column hostname"},
+		{auditMissingTable, "missing table old_cpu"},
+		{auditSyntaxError, `syntax error at or near "FORM"`},
+		{auditError, "Arc error (HTTP 500) query failed (see server logs for detail)"},
+		{auditBlocked, `no credential "admin"`},
+		{auditSkipped, "no SQL"},
+	}
+	for i, w := range want {
+		got := report.Results[i]
+		if got.Index != i || got.Status != w.status || !strings.Contains(got.Detail, w.detail) {
+			t.Errorf("query %d: %+v, want %s %q", i, got, w.status, w.detail)
+		}
+	}
+	if r := report.Results[0]; r.Panel != "CPU" || r.RefID != "A" || len(r.Columns) != 2 || r.Columns[1].Name != "usage" {
+		t.Errorf("ok result = %+v", r)
+	}
+	if strings.Contains(string(body), "/var/arc") {
+		t.Errorf("report carries Arc's error body: %s", body)
+	}
+	if report.Summary[auditOK] != 6 || report.Summary[auditMissingColumn] != 1 || report.Summary[auditSkipped] != 1 {
+		t.Errorf("summary = %v", report.Summary)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d probes in flight, want at most maxConcurrency 2", p)
+	}
+
+	clean := []map[string]any{{"sql": "SELECT time, usage FROM cpu"}, {"sql": ""}}
+	_, body = callResource(t, d, pctx, http.MethodPost, "/audit", map[string]any{"queries": clean})
+	if err := json.Unmarshal(body, &report); err != nil || !report.OK {
+		t.Errorf("clean audit: %s", body)
+	}
+}
+
+func TestHandleAudit_RejectsBadRequests(t *testing.T) {
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, "http://127.0.0.1:1", nil)
+	if status, _ := callResource(t, d, pctx, http.MethodGet, "/audit", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", status)
+	}
+	if status, _ := callResource(t, d, pctx, http.MethodPost, "/audit", map[string]any{"queries": []any{}}); status != http.StatusBadRequest {
+		t.Errorf("no queries: status %d, want 400", status)
+	}
+	if status, _ := callResource(t, d, pctx, http.MethodPost, "/audit", map[string]any{"queries": make([]map[string]any, maxAuditQueries+1)}); status != http.StatusBadRequest {
+		t.Errorf("too many queries: status %d, want 400", status)
+	}
+}
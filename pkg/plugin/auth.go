@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Auth header: the API key goes out as <authHeaderName>: <authHeaderPrefix><key>,
+// Authorization: Bearer <key> unless a gateway in front of Arc wants it
+// elsewhere — X-API-Key with an empty prefix sends the raw key. The key is
+// only ever put on the request; nothing logs request headers.
+
+const (
+	defaultAuthHeaderName   = "Authorization"
+	defaultAuthHeaderPrefix = "Bearer "
+)
+
+// headerNameRe matches an HTTP header field name (RFC 9110 token).
+var headerNameRe = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// reservedHeaders are the headers doRequest sets itself or the transport
+// owns; the key sent in one of them would replace (or be replaced by) it.
+var reservedHeaders = map[string]bool{
+	"Accept":            true,
+	"Content-Type":      true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+	"X-Arc-Database":    true,
+	"X-Grafana-User":    true,
+	"X-Grafana-Org-Id":  true,
+}
+
+// resolveAuthHeader applies the defaults to the configured header name and
+// prefix (nil = defaultAuthHeaderPrefix, "" = the raw key) and validates
+// them. The name comes back canonicalized.
+func resolveAuthHeader(name string, prefix *string) (string, string, error) {
+	if name == "" {
+		name = defaultAuthHeaderName
+	}
+	if !headerNameRe.MatchString(name) {
+		return "", "", fmt.Errorf("authHeaderName %q is not a valid header name", name)
+	}
+	name = http.CanonicalHeaderKey(name)
+	if reservedHeaders[name] {
+		return "", "", fmt.Errorf("authHeaderName %q is a header the plugin sets itself", name)
+	}
+	p := defaultAuthHeaderPrefix
+	if prefix != nil {
+		p = *prefix
+	}
+	if err := validateHeaderValue("authHeaderPrefix", p); err != nil {
+		return "", "", err
+	}
+	return name, p, nil
+}
+
+// setAuthHeader puts the instance's API key on req, or nothing when there
+// is none (see RequireAuth). Under oauthPassThru ctx's OAuth token goes out
+// as Authorization instead (see passThruToken).
+func (s *ArcInstanceSettings) setAuthHeader(ctx context.Context, req *http.Request) {
+	if token := s.passThruToken(ctx); token != "" {
+		req.Header.Set(backend.OAuthIdentityTokenHeaderName, token)
+		return
+	}
+	if s.apiKey != "" {
+		req.Header.Set(s.authHeaderName, s.authHeaderPrefix+s.apiKey)
+	}
+}
@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestResolveAuthHeader(t *testing.T) {
+	empty, token := "", "Token "
+	for _, c := range []struct {
+		name       string
+		header     string
+		prefix     *string
+		wantHeader string
+		wantPrefix string
+		wantErr    bool
+	}{
+		{"defaults", "", nil, "Authorization", "Bearer ", false},
+		{"custom header", "x-api-key", &empty, "X-Api-Key", "", false},
+		{"custom prefix", "", &token, "Authorization", "Token ", false},
+		{"space in name", "X API Key", nil, "", "", true},
+		{"colon in name", "X-Key:", nil, "", "", true},
+		{"reserved", "x-arc-database", nil, "", "", true},
+		{"accept", "Accept", nil, "", "", true},
+		{"newline in prefix", "", func() *string { p := "Bearer\r\nX-Evil: 1 "; return &p }(), "", "", true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			header, prefix, err := resolveAuthHeader(c.header, c.prefix)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("resolveAuthHeader error = %v, wantErr %v", err, c.wantErr)
+			}
+			if header != c.wantHeader || prefix != c.wantPrefix {
+				t.Errorf("resolveAuthHeader = %q, %q, want %q, %q", header, prefix, c.wantHeader, c.wantPrefix)
+			}
+		})
+	}
+}
+
+// TestAuthHeader_Sent checks the exact headers queries and CheckHealth send
+// for each header name and prefix, over both protocols, and that the key
+// is in no log line.
+func TestAuthHeader_Sent(t *testing.T) {
+	const key = "s3cr3t-key-value"
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name      string
+		extra     map[string]any
+		wantName  string
+		wantValue string
+	}{
+		{"default", nil, "Authorization", "Bearer " + key},
+		{"x-api-key raw", map[string]any{"authHeaderName": "X-API-Key", "authHeaderPrefix": ""}, "X-Api-Key", key},
+		{"x-api-key default prefix", map[string]any{"authHeaderName": "X-API-Key"}, "X-Api-Key", "Bearer " + key},
+		{"token scheme", map[string]any{"authHeaderPrefix": "Token "}, "Authorization", "Token " + key},
+	} {
+		for _, useArrow := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/arrow=%v", c.name, useArrow), func(t *testing.T) {
+				mu.Lock()
+				headers = nil
+				mu.Unlock()
+				rec := recordLogs(t)
+				extra := map[string]any{"useArrow": useArrow, "retryStatusCodes": []int{}}
+				for k, v := range c.extra {
+					extra[k] = v
+				}
+				pctx := testPluginContext(t, srv.URL, extra)
+				pctx.DataSourceInstanceSettings.DecryptedSecureJSONData["apiKey"] = key
+				d := NewArcDatasource()
+				// The JSON body isn't an Arrow stream; only the header matters here.
+				_, _ = d.QueryData(t.Context(), &backend.QueryDataRequest{
+					PluginContext: pctx,
+					Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT 1","format":"table"}`)}},
+				})
+				_, _ = d.CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx})
+
+				mu.Lock()
+				defer mu.Unlock()
+				if len(headers) < 2 {
+					t.Fatalf("expected requests from the query and the health check, got %d", len(headers))
+				}
+				for _, h := range headers {
+					if got := h.Values(c.wantName); len(got) != 1 || got[0] != c.wantValue {
+						t.Errorf("%s = %q, want %q", c.wantName, got, c.wantValue)
+					}
+					if c.wantName != "Authorization" && h.Get("Authorization") != "" {
+						t.Errorf("Authorization sent as well: %q", h.Get("Authorization"))
+					}
+				}
+				rec.mu.Lock()
+				defer rec.mu.Unlock()
+				for _, e := range rec.entries {
+					if line := fmt.Sprint(e.msg, e.args); strings.Contains(line, key) {
+						t.Errorf("key logged: %s", line)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestAuthHeader_DroppedOnCrossHostRedirect: Go strips Authorization from a
+// redirect to another host, but not a custom header; the key mustn't follow
+// the redirect either way.
+func TestAuthHeader_DroppedOnCrossHostRedirect(t *testing.T) {
+	var got http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer other.Close()
+	arc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer arc.Close()
+
+	pctx := testPluginContext(t, arc.URL, map[string]any{"useArrow": false, "authHeaderName": "X-API-Key", "authHeaderPrefix": ""})
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: pctx,
+		Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT 1","format":"table"}`)}},
+	})
+	if err != nil || resp.Responses["A"].Error != nil {
+		t.Fatalf("QueryData: %v %v", err, resp.Responses["A"].Error)
+	}
+	if got == nil {
+		t.Fatal("redirect not followed")
+	}
+	if v := got.Get("X-Api-Key"); v != "" {
+		t.Errorf("X-API-Key followed the redirect: %q", v)
+	}
+}
@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+)
+
+// Conversion self-benchmark. The Arrow converter is the hot path of every
+// query, and a regression in it shows up as slower panels long after the
+// change that caused it. POST /bench (org admins only; the UI doesn't link
+// it) decodes a synthetic Arrow stream (arcclient.SyntheticArrowStream) of
+// the requested size with the instance's decoder options and reports the
+// throughput and allocations, so an operator can compare figures across
+// releases on their own hardware. Every instance also runs a small one
+// when it's created and logs the figure. Allocations are read from the Go
+// runtime and count the whole process: queries running at the same time
+// add to them.
+
+// Self-benchmark sizes.
+const (
+	defaultBenchRows    = 100_000
+	defaultBenchColumns = 8
+	maxBenchRows        = 5_000_000
+	maxBenchColumns     = 256
+	benchBatchRows      = 10_000
+	startupBenchRows    = 2_000
+	startupBenchColumns = 4
+)
+
+// benchRunning allows one POST /bench at a time per process: a benchmark
+// competing with another measures neither.
+var benchRunning sync.Mutex
+
+// benchRequest is the POST /bench body; zero fields take the defaults.
+type benchRequest struct {
+	Rows    int `json:"rows"`
+	Columns int `json:"columns"`
+}
+
+// benchResult is a self-benchmark's answer. Duration covers decoding only,
+// not generating the stream.
+type benchResult struct {
+	Rows        int     `json:"rows"`
+	Columns     int     `json:"columns"`
+	StreamBytes int     `json:"streamBytes"`
+	DurationMs  float64 `json:"durationMs"`
+	RowsPerSec  float64 `json:"rowsPerSec"`
+	Allocs      uint64  `json:"allocs"`
+	AllocBytes  uint64  `json:"allocBytes"`
+}
+
+// handleBench runs a conversion self-benchmark for an org admin.
+func (d *ArcDatasource) handleBench(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	if user == nil || !strings.EqualFold(user.Role, "Admin") {
+		writeResourceError(w, http.StatusForbidden, "the conversion benchmark is only available to admins")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("bench", err))
+		return
+	}
+	req := benchRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeResourceError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Rows == 0 {
+		req.Rows = defaultBenchRows
+	}
+	if req.Columns == 0 {
+		req.Columns = defaultBenchColumns
+	}
+	if req.Rows < 1 || req.Rows > maxBenchRows || req.Columns < 1 || req.Columns > maxBenchColumns {
+		writeResourceError(w, http.StatusBadRequest, fmt.Sprintf("rows must be 1 to %d and columns 1 to %d", maxBenchRows, maxBenchColumns))
+		return
+	}
+	if !benchRunning.TryLock() {
+		writeResourceError(w, http.StatusConflict, "a benchmark is already running")
+		return
+	}
+	defer benchRunning.Unlock()
+
+	res, err := settings.conversionBench(req.Rows, req.Columns)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("bench", err))
+		return
+	}
+	log.DefaultLogger.Info("Conversion benchmark", "user", user.Login, "rows", res.Rows, "columns", res.Columns,
+		"duration_ms", res.DurationMs, "rowsPerSec", res.RowsPerSec, "allocs", res.Allocs, "allocBytes", res.AllocBytes)
+	writeResourceJSON(w, http.StatusOK, res)
+}
+
+// conversionBench decodes a synthetic stream of rows × columns with the
+// instance's Arrow options.
+func (s *ArcInstanceSettings) conversionBench(rows, columns int) (benchResult, error) {
+	stream, err := arcclient.SyntheticArrowStream(rows, columns, benchBatchRows)
+	if err != nil {
+		return benchResult{}, err
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	frame, err := arcclient.ReadArrowWithOptions(bytes.NewReader(stream), s.arrowOptions())
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		return benchResult{}, err
+	}
+	if frame.Rows() != rows {
+		return benchResult{}, fmt.Errorf("benchmark decoded %d rows, want %d", frame.Rows(), rows)
+	}
+	return benchResult{
+		Rows:        rows,
+		Columns:     columns,
+		StreamBytes: len(stream),
+		DurationMs:  float64(elapsed.Microseconds()) / 1000,
+		RowsPerSec:  float64(rows) / elapsed.Seconds(),
+		Allocs:      after.Mallocs - before.Mallocs,
+		AllocBytes:  after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
+
+// logStartupBench runs the small self-benchmark a new instance logs.
+func (s *ArcInstanceSettings) logStartupBench(uid string) {
+	res, err := s.conversionBench(startupBenchRows, startupBenchColumns)
+	if err != nil {
+		log.DefaultLogger.Warn("Conversion self-benchmark failed", "datasource", uid, "error", err)
+		return
+	}
+	log.DefaultLogger.Info("Conversion self-benchmark", "datasource", uid, "rows", res.Rows, "columns", res.Columns,
+		"duration_ms", res.DurationMs, "rowsPerSec", int64(res.RowsPerSec), "allocs", res.Allocs)
+}
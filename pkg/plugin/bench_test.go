@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestHandleBench(t *testing.T) {
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, "http://arc.invalid", nil)
+	admin := pctx
+	admin.User = &backend.User{Login: "admin", Role: "Admin"}
+
+	status, body := callResource(t, d, admin, http.MethodPost, "/bench", map[string]int{"rows": 1500, "columns": 5})
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var res benchResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if res.Rows != 1500 || res.Columns != 5 || res.StreamBytes == 0 || res.DurationMs <= 0 || res.RowsPerSec <= 0 || res.Allocs == 0 {
+		t.Errorf("result = %+v", res)
+	}
+
+	for _, c := range []struct {
+		name   string
+		pctx   backend.PluginContext
+		method string
+		body   any
+		status int
+	}{
+		{"viewer", func() backend.PluginContext {
+			p := pctx
+			p.User = &backend.User{Login: "viewer", Role: "Viewer"}
+			return p
+		}(), http.MethodPost, nil, http.StatusForbidden},
+		{"GET", admin, http.MethodGet, nil, http.StatusMethodNotAllowed},
+		{"too many rows", admin, http.MethodPost, map[string]int{"rows": maxBenchRows + 1}, http.StatusBadRequest},
+		{"negative columns", admin, http.MethodPost, map[string]int{"columns": -1}, http.StatusBadRequest},
+	} {
+		if status, body := callResource(t, d, c.pctx, c.method, "/bench", c.body); status != c.status {
+			t.Errorf("%s: status %d (%s), want %d", c.name, status, body, c.status)
+		}
+	}
+}
+
+// TestNewArcInstance_LogsSelfBenchmark: a new instance logs the small
+// conversion benchmark.
+func TestNewArcInstance_LogsSelfBenchmark(t *testing.T) {
+	rec := recordLogs(t)
+	newTestInstance(t, "http://arc.invalid")
+	if rows := rec.field(t, "Conversion self-benchmark", "rows"); rows != startupBenchRows {
+		t.Errorf("rows = %v, want %d", rows, startupBenchRows)
+	}
+}
+
+// BenchmarkQueryArrow measures a query's Arrow path end to end — HTTP
+// response, stream reading and conversion — on the synthetic stream
+// POST /bench decodes.
+func BenchmarkQueryArrow(b *testing.B) {
+	stream, err := arcclient.SyntheticArrowStream(defaultBenchRows, defaultBenchColumns, benchBatchRows)
+	if err != nil {
+		b.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(stream)
+	}))
+	defer srv.Close()
+	inst := newTestInstance(b, srv.URL)
+
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := queryArrow(b.Context(), inst, "SELECT * FROM synthetic"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
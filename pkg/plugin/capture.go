@@ -0,0 +1,229 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Failure capture (captureFailures setting): when a response can't be
+// turned into frames, the raw body Arc sent is kept on disk so a conversion
+// bug report can come with the payload that triggered it. Each capture is
+// two files in a per-datasource directory under os.TempDir():
+// <stamp>.arrow or <stamp>.json with the body (the first captureMaxBytes of
+// it), and <stamp>.meta.json describing the request. Only the newest
+// captureKeep are kept. Admins download the latest through
+// GET /debug/last-failure (see handleLastFailure).
+//
+// Bodies carry query results, never credentials; the SQL stored next to
+// them is passed through scrubSecrets first, since CREATE SECRET and
+// read_parquet('s3://key:secret@…') style queries do carry them.
+
+// captureMaxBytes caps how much of a response is kept in memory per query
+// and written per capture. Conversion bugs show up in the first record
+// batches or rows, and the cap bounds what capturing costs while on.
+const captureMaxBytes = 8 << 20
+
+// captureKeep is how many captures are kept per datasource.
+const captureKeep = 3
+
+// captureMetaSuffix ends the metadata file of a capture.
+const captureMetaSuffix = ".meta.json"
+
+// failureCapture describes one captured response (the .meta.json file).
+type failureCapture struct {
+	Time      time.Time `json:"time"`
+	Protocol  string    `json:"protocol"` // "arrow" or "json"
+	Database  string    `json:"database"`
+	SQL       string    `json:"sql"` // as sent, secrets scrubbed
+	Error     string    `json:"error"`
+	File      string    `json:"file"`  // body file, in the capture directory
+	Bytes     int       `json:"bytes"` // body bytes captured
+	Truncated bool      `json:"truncated"`
+}
+
+// captureStore writes failure captures for one datasource. A nil store
+// (capture off) ignores every call.
+type captureStore struct {
+	dir      string
+	maxBytes int
+	mu       sync.Mutex // serializes write-and-rotate
+}
+
+var captureDirUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// newCaptureStore returns the store for the datasource with uid, or nil
+// when capture is off. The directory is created on the first capture.
+func newCaptureStore(enabled bool, uid string) *captureStore {
+	if !enabled {
+		return nil
+	}
+	name := captureDirUnsafe.ReplaceAllString(uid, "_")
+	if name == "" {
+		name = "_"
+	}
+	return &captureStore{
+		dir:      filepath.Join(os.TempDir(), "grafana-arc-captures", name),
+		maxBytes: captureMaxBytes,
+	}
+}
+
+// captureReader keeps a copy of the first maxBytes read through it.
+type captureReader struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if room := r.max - r.buf.Len(); n > room {
+		r.buf.Write(p[:max(room, 0)])
+		r.truncated = true
+	} else {
+		r.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// track wraps a response body so it can be saved if decoding fails. The
+// returned reader replaces body; the *captureReader is nil when capture is
+// off.
+func (c *captureStore) track(body io.ReadCloser) (io.ReadCloser, *captureReader) {
+	if c == nil {
+		return body, nil
+	}
+	r := &captureReader{ReadCloser: body, max: c.maxBytes}
+	return r, r
+}
+
+// save writes what r read as a capture of the failed query and rotates out
+// old captures. Queries the caller canceled aren't captured: the body is
+// cut short by the cancellation, not by a conversion problem. Failing to
+// write is logged, never surfaced — the query already failed with err.
+func (c *captureStore) save(ctx context.Context, r *captureReader, protocol, database, sql string, err error) {
+	if c == nil || r == nil || ctx.Err() != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().UTC()
+	stamp := now.Format("20060102T150405.000000000Z")
+	meta := failureCapture{
+		Time:      now,
+		Protocol:  protocol,
+		Database:  database,
+		SQL:       scrubSecrets(sql),
+		Error:     scrubSecrets(err.Error()),
+		File:      stamp + "." + protocol,
+		Bytes:     r.buf.Len(),
+		Truncated: r.truncated,
+	}
+	if werr := c.write(stamp, meta, r.buf.Bytes()); werr != nil {
+		log.DefaultLogger.Warn("Failure capture could not be written", "dir", c.dir, "error", werr.Error())
+		return
+	}
+	log.DefaultLogger.Warn("Captured the response of a failed query",
+		"path", filepath.Join(c.dir, meta.File), "bytes", meta.Bytes, "truncated", meta.Truncated, "error", meta.Error)
+	c.rotate()
+}
+
+// write stores one capture. The metadata goes last: list only sees captures
+// whose body is complete.
+func (c *captureStore) write(stamp string, meta failureCapture, body []byte) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, meta.File), body, 0o600); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, stamp+captureMetaSuffix), raw, 0o600)
+}
+
+// rotate deletes all but the newest captureKeep captures.
+func (c *captureStore) rotate() {
+	captures, err := c.list()
+	if err != nil {
+		return
+	}
+	for _, old := range captures[min(len(captures), captureKeep):] {
+		stamp := strings.TrimSuffix(old.File, filepath.Ext(old.File))
+		_ = os.Remove(filepath.Join(c.dir, stamp+captureMetaSuffix))
+		_ = os.Remove(filepath.Join(c.dir, old.File))
+	}
+}
+
+// list returns the stored captures, newest first.
+func (c *captureStore) list() ([]failureCapture, error) {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*"+captureMetaSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths))) // stamps sort by time
+	captures := make([]failureCapture, 0, len(paths))
+	for _, p := range paths {
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			continue // rotated away by a concurrent save
+		}
+		var meta failureCapture
+		if err := json.Unmarshal(raw, &meta); err != nil || filepath.Base(meta.File) != meta.File {
+			continue
+		}
+		captures = append(captures, meta)
+	}
+	return captures, nil
+}
+
+// latest returns the newest capture and its body.
+func (c *captureStore) latest() (failureCapture, []byte, error) {
+	captures, err := c.list()
+	if err != nil {
+		return failureCapture{}, nil, err
+	}
+	if len(captures) == 0 {
+		return failureCapture{}, nil, os.ErrNotExist
+	}
+	body, err := os.ReadFile(filepath.Join(c.dir, captures[0].File))
+	if err != nil {
+		return failureCapture{}, nil, fmt.Errorf("read capture %s: %w", captures[0].File, err)
+	}
+	return captures[0], body, nil
+}
+
+// secretPatterns match credentials that show up in SQL: DuckDB secrets and
+// settings (CREATE SECRET (KEY_ID '…', SECRET '…'), SET s3_secret_access_key
+// = '…'), password/token literals, bearer tokens and user:password@ in URLs.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)\b(\w*(?:password|passwd|secret|token|key_id|api_?key|access_?key)\w*)(\s*(?:=|:|\s)\s*)'(?:[^']|'')*'`), `$1$2'***'`},
+	{regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`), `${1}***`},
+	{regexp.MustCompile(`(://)[^/\s'@]+@`), `${1}***@`},
+}
+
+// scrubSecrets masks the credentials secretPatterns recognize in s.
+func scrubSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
@@ -0,0 +1,201 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// fixedBodyServer answers every request with body as contentType.
+func fixedBodyServer(t *testing.T, contentType string, body []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCaptureFailures_JSON(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	body := []byte(`{"columns": ["time", "value"], "data": [[1772323200, 1.5], [`)
+	srv := fixedBodyServer(t, jsonMediaType, body)
+	inst := newTestInstance(t, srv.URL)
+	inst.captures = newCaptureStore(true, "arc-test")
+
+	sql := "SELECT * FROM read_parquet('s3://AKIA123:hunter2@bucket/x.parquet')"
+	if _, err := queryJSON(t.Context(), inst, sql); err == nil {
+		t.Fatal("expected a decode error")
+	}
+	meta, got, err := inst.captures.latest()
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	if string(got) != string(body) {
+		t.Errorf("captured body %q, want %q", got, body)
+	}
+	if meta.Protocol != "json" || meta.Database != "default" || meta.Truncated {
+		t.Errorf("meta = %+v", meta)
+	}
+	if strings.Contains(meta.SQL, "hunter2") || !strings.Contains(meta.SQL, "s3://***@bucket") {
+		t.Errorf("SQL not scrubbed: %q", meta.SQL)
+	}
+	if !strings.Contains(meta.Error, "failed to decode Arc JSON response") {
+		t.Errorf("meta.Error = %q", meta.Error)
+	}
+	if info, err := os.Stat(filepath.Join(inst.captures.dir, meta.File)); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("capture file: %v, %v", info, err)
+	}
+}
+
+func TestCaptureFailures_ArrowTruncatedAndCapped(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	schema := arrow.NewSchema([]arrow.Field{{Name: "v", Type: arrow.PrimitiveTypes.Float64}}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.Float64Builder).AppendValues(make([]float64, 1000), nil)
+	})
+	corrupt := stream[:len(stream)-4000] // cut inside the record batch body
+	srv := fixedBodyServer(t, arrowStreamMediaType, corrupt)
+	inst := newTestInstance(t, srv.URL)
+	inst.captures = newCaptureStore(true, "arc-test")
+	inst.captures.maxBytes = 64
+
+	if _, err := queryArrow(t.Context(), inst, "SELECT v FROM t"); err == nil {
+		t.Fatal("expected a decode error")
+	}
+	meta, got, err := inst.captures.latest()
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	if meta.Protocol != "arrow" || !strings.HasSuffix(meta.File, ".arrow") {
+		t.Errorf("meta = %+v", meta)
+	}
+	if !meta.Truncated || meta.Bytes != 64 || string(got) != string(corrupt[:64]) {
+		t.Errorf("expected the first 64 bytes, truncated; got %d bytes, truncated=%v", len(got), meta.Truncated)
+	}
+}
+
+func TestCaptureFailures_SuccessAndDisabled(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	srv := fixedBodyServer(t, jsonMediaType, []byte(`{"columns": ["a"], "data": [[1]]}`))
+	inst := newTestInstance(t, srv.URL)
+	inst.captures = newCaptureStore(true, "arc-test")
+	if _, err := queryJSON(t.Context(), inst, "SELECT 1 AS a"); err != nil {
+		t.Fatal(err)
+	}
+	if captures, _ := inst.captures.list(); len(captures) != 0 {
+		t.Errorf("successful query captured: %+v", captures)
+	}
+
+	bad := fixedBodyServer(t, jsonMediaType, []byte(`not json`))
+	off := newTestInstance(t, bad.URL)
+	if _, err := queryJSON(t.Context(), off, "SELECT 1"); err == nil {
+		t.Fatal("expected a decode error")
+	}
+	if entries, _ := os.ReadDir(os.TempDir()); len(entries) != 0 {
+		t.Errorf("capture written while captureFailures is off: %v", entries)
+	}
+}
+
+func TestCaptureStore_KeepsNewest(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	store := newCaptureStore(true, "arc/../test")
+	if filepath.Dir(store.dir) != filepath.Join(os.TempDir(), "grafana-arc-captures") {
+		t.Fatalf("capture dir %q escapes the captures root", store.dir)
+	}
+	for i := 0; i < captureKeep+2; i++ {
+		body, r := store.track(io.NopCloser(strings.NewReader("body" + string(rune('0'+i)))))
+		_, _ = body.Read(make([]byte, 16))
+		store.save(t.Context(), r, "json", "default", "SELECT 1", os.ErrClosed)
+	}
+	captures, err := store.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != captureKeep {
+		t.Fatalf("kept %d captures, want %d", len(captures), captureKeep)
+	}
+	if _, body, _ := store.latest(); string(body) != "body4" {
+		t.Errorf("latest body %q, want body4", body)
+	}
+	if entries, _ := os.ReadDir(store.dir); len(entries) != 2*captureKeep {
+		t.Errorf("%d files left in the capture dir, want %d", len(entries), 2*captureKeep)
+	}
+}
+
+func TestHandleLastFailure(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	body := []byte(`{"columns": ["a"], "data": [[`)
+	srv := fixedBodyServer(t, jsonMediaType, body)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"captureFailures": true, "useArrow": false})
+
+	admin := pctx
+	admin.User = &backend.User{Login: "admin", Role: "Admin"}
+	if status, _ := callResource(t, d, admin, http.MethodGet, "/debug/last-failure", nil); status != http.StatusNotFound {
+		t.Errorf("no capture yet: status %d, want 404", status)
+	}
+
+	inst, err := d.getInstance(t.Context(), pctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queryJSON(t.Context(), inst, "SELECT a FROM t"); err == nil {
+		t.Fatal("expected a decode error")
+	}
+
+	viewer := pctx
+	viewer.User = &backend.User{Login: "viewer", Role: "Viewer"}
+	if status, _ := callResource(t, d, viewer, http.MethodGet, "/debug/last-failure", nil); status != http.StatusForbidden {
+		t.Errorf("viewer: status %d, want 403", status)
+	}
+	if status, _ := callResource(t, d, pctx, http.MethodGet, "/debug/last-failure", nil); status != http.StatusForbidden {
+		t.Errorf("no user: status %d, want 403", status)
+	}
+
+	status, got := callResource(t, d, admin, http.MethodGet, "/debug/last-failure", nil)
+	if status != http.StatusOK || string(got) != string(body) {
+		t.Errorf("admin download: status %d, body %q", status, got)
+	}
+	status, got = callResource(t, d, admin, http.MethodGet, "/debug/last-failure?info=true", nil)
+	var info struct {
+		Captures []failureCapture `json:"captures"`
+	}
+	if err := json.Unmarshal(got, &info); status != http.StatusOK || err != nil || len(info.Captures) != 1 || info.Captures[0].SQL != "SELECT a FROM t" {
+		t.Errorf("info: status %d, %s", status, got)
+	}
+
+	off := testPluginContext(t, srv.URL, nil)
+	off.DataSourceInstanceSettings.UID = "arc-off"
+	off.User = admin.User
+	if status, _ := callResource(t, d, off, http.MethodGet, "/debug/last-failure", nil); status != http.StatusNotFound {
+		t.Errorf("capture off: status %d, want 404", status)
+	}
+}
+
+func TestScrubSecrets(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"CREATE SECRET s3 (TYPE S3, KEY_ID 'AKIA', SECRET 'abc''d')", "CREATE SECRET s3 (TYPE S3, KEY_ID '***', SECRET '***')"},
+		{"SET s3_secret_access_key = 'abc'", "SET s3_secret_access_key = '***'"},
+		{"SELECT * FROM users WHERE password='x' AND name = 'bob'", "SELECT * FROM users WHERE password='***' AND name = 'bob'"},
+		{"-- Authorization: Bearer eyJhbGciOi.abc", "-- Authorization: Bearer ***"},
+		{"SELECT * FROM read_csv('https://u:p@host/f.csv')", "SELECT * FROM read_csv('https://***@host/f.csv')"},
+		{"SELECT host FROM cpu WHERE $__timeFilter(time)", "SELECT host FROM cpu WHERE $__timeFilter(time)"},
+	}
+	for _, c := range cases {
+		if got := scrubSecrets(c.in); got != c.want {
+			t.Errorf("scrubSecrets(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
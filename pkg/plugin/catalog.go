@@ -0,0 +1,271 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Catalog resources: GET /databases, /tables?database=X and
+// /columns?database=X&table=Y list what the query editor can offer for
+// autocomplete, from SHOW DATABASES, SHOW TABLES and DESCRIBE over JSON.
+// Editors ask on every keystroke that opens a completion list, so answers
+// are cached per instance for catalogCacheTTL (default a minute). A
+// database other than the configured one goes through
+// withDatabaseOverride like a query would, and a role restricted to some
+// tables only sees, and can only describe, those.
+
+// DefaultCatalogCacheTTL is how long a catalog answer is reused when
+// catalogCacheTTL is empty.
+const DefaultCatalogCacheTTL = time.Minute
+
+// catalogTimeout bounds one SHOW behind a catalog request; DESCRIBE has
+// its own describeTimeout.
+const catalogTimeout = 5 * time.Second
+
+// catalogCacheMaxEntries caps the catalog cache; each database and each
+// described table is one entry.
+const catalogCacheMaxEntries = 256
+
+// parseCatalogCacheTTL resolves the catalogCacheTTL setting: a Go duration,
+// DefaultCatalogCacheTTL when empty, "0" to always ask Arc.
+func parseCatalogCacheTTL(setting string) (time.Duration, error) {
+	if setting == "" {
+		return DefaultCatalogCacheTTL, nil
+	}
+	ttl, err := time.ParseDuration(setting)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid catalogCacheTTL %q: use a non-negative duration such as 60s or 5m", setting)
+	}
+	return ttl, nil
+}
+
+// catalogColumn is one column of a GET /columns answer, Type being Arc's
+// (DuckDB's) type name.
+type catalogColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+type catalogEntry struct {
+	value   any // []string, []catalogColumn or []tagOption
+	expires time.Time
+}
+
+// catalogCache is a small TTL cache of catalog answers, one per datasource
+// instance so editing the datasource drops it. A zero TTL caches nothing.
+type catalogCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]catalogEntry
+}
+
+func newCatalogCache(ttl time.Duration) *catalogCache {
+	return &catalogCache{ttl: ttl, entries: make(map[string]catalogEntry)}
+}
+
+func (c *catalogCache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// put stores value under key. Like schemaCache, a full cache sweeps expired
+// entries and then evicts an arbitrary one.
+func (c *catalogCache) put(key string, value any) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= catalogCacheMaxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < catalogCacheMaxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = catalogEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+// catalogKey keys a catalog answer; database and table names can't contain
+// NUL (validateDatabaseName, validateCatalogTable).
+func catalogKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// catalogSettings resolves the instance for a catalog request and applies
+// its ?database= through withDatabaseOverride. On failure it has already
+// written the error response.
+func (d *ArcDatasource) catalogSettings(w http.ResponseWriter, r *http.Request, route string) (*ArcInstanceSettings, bool) {
+	if r.Method != http.MethodGet {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use GET")
+		return nil, false
+	}
+	return d.catalogInstance(w, r, route, r.URL.Query().Get("database"))
+}
+
+// catalogInstance is catalogSettings for a database the request named some
+// other way, without the method check.
+func (d *ArcDatasource) catalogInstance(w http.ResponseWriter, r *http.Request, route, database string) (*ArcInstanceSettings, bool) {
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError(route, err))
+		return nil, false
+	}
+	settings, err = settings.withDatabaseOverride(route, database)
+	if err != nil {
+		if errors.Is(err, errDatabaseOverrideDisabled) {
+			writeResourceError(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+		writeResourceError(w, http.StatusBadRequest, sanitizeUserError(route, err))
+		return nil, false
+	}
+	return settings, true
+}
+
+// handleDatabases answers GET /databases with the server's database names.
+func (d *ArcDatasource) handleDatabases(w http.ResponseWriter, r *http.Request) {
+	settings, ok := d.catalogSettings(w, r, "databases")
+	if !ok {
+		return
+	}
+	names, err := settings.catalogNames(r.Context(), catalogKey("databases"), "SHOW DATABASES", databaseNames)
+	if err != nil {
+		writeResourceError(w, http.StatusBadGateway, sanitizeUserError("databases", err))
+		return
+	}
+	writeResourceJSON(w, http.StatusOK, names)
+}
+
+// handleTables answers GET /tables?database=X with the tables of X (the
+// configured database when absent) the requesting user's role may query.
+func (d *ArcDatasource) handleTables(w http.ResponseWriter, r *http.Request) {
+	settings, ok := d.catalogSettings(w, r, "tables")
+	if !ok {
+		return
+	}
+	names, err := settings.catalogNames(r.Context(), catalogKey("tables", settings.settings.Database), "SHOW TABLES", tableNames)
+	if err != nil {
+		writeResourceError(w, http.StatusBadGateway, sanitizeUserError("tables", err))
+		return
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	allowed := make([]string, 0, len(names))
+	for _, name := range names {
+		if settings.allowsTable(user, name) {
+			allowed = append(allowed, name)
+		}
+	}
+	writeResourceJSON(w, http.StatusOK, allowed)
+}
+
+// handleColumns answers GET /columns?database=X&table=Y with Y's columns as
+// DESCRIBE gives them: name, type and, when set, description.
+func (d *ArcDatasource) handleColumns(w http.ResponseWriter, r *http.Request) {
+	settings, ok := d.catalogSettings(w, r, "columns")
+	if !ok {
+		return
+	}
+	table := r.URL.Query().Get("table")
+	if err := validateCatalogTable(table); err != nil {
+		writeResourceError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	if !settings.allowsTable(user, table) {
+		writeResourceError(w, http.StatusForbidden, fmt.Sprintf("table %s is not allowed for the %s role", table, user.Role))
+		return
+	}
+
+	cols, err := settings.catalogColumns(r.Context(), table)
+	if err != nil {
+		writeResourceError(w, http.StatusBadGateway, sanitizeUserError("columns", err))
+		return
+	}
+	writeResourceJSON(w, http.StatusOK, cols)
+}
+
+// catalogColumns describes table, through the catalog cache.
+func (s *ArcInstanceSettings) catalogColumns(ctx context.Context, table string) ([]catalogColumn, error) {
+	key := s.scopedKey(ctx, catalogKey("columns", s.settings.Database, table))
+	if cols, ok := s.catalog.get(key); ok {
+		return cols.([]catalogColumn), nil
+	}
+	described, err := s.describe(ctx, quoteIdentifier(table))
+	if err != nil {
+		return nil, err
+	}
+	cols := make([]catalogColumn, len(described))
+	for i, c := range described {
+		cols[i] = catalogColumn{Name: c.Name, Type: c.NativeType, Description: c.Description}
+	}
+	s.catalog.put(key, cols)
+	return cols, nil
+}
+
+// catalogNames runs sql over JSON and reads names out of the result with
+// names, through the catalog cache under key (scoped, see cacheScope).
+func (s *ArcInstanceSettings) catalogNames(ctx context.Context, key, sql string, names func(data.Frames) []string) ([]string, error) {
+	key = s.scopedKey(ctx, key)
+	if v, ok := s.catalog.get(key); ok {
+		return v.([]string), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, catalogTimeout)
+	defer cancel()
+	frames, err := queryJSON(ctx, s, attributed(ctx, sql))
+	if err != nil {
+		return nil, err
+	}
+	list := names(frames)
+	s.catalog.put(key, list)
+	return list, nil
+}
+
+// tableNames reads the names out of a SHOW TABLES result: the column
+// called name or table_name, else the first string column.
+func tableNames(frames data.Frames) []string {
+	return namesColumn(frames, "name", "table_name")
+}
+
+// validateCatalogTable rejects a /columns table that is empty or holds
+// control characters; anything else is quoted (quoteIdentifier), so names
+// needing quotes in SQL can still be described.
+func validateCatalogTable(table string) error {
+	if table == "" {
+		return errors.New("table is required")
+	}
+	if i, r := firstRuneOutside(table, func(r rune) bool { return r >= ' ' && r != 0x7f }); i >= 0 {
+		return fmt.Errorf("table name contains %s at byte %d", describeRune(r), i)
+	}
+	return nil
+}
+
+// quoteIdentifier quotes name as a SQL identifier, doubling embedded quotes.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
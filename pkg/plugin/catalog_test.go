@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// catalogServer answers SHOW DATABASES, SHOW TABLES and DESCRIBE like Arc's
+// JSON endpoint, and counts the statements it was sent along with the
+// database header each came with.
+type catalogServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []string // "<database> <sql>"
+}
+
+func newCatalogServer(t *testing.T) *catalogServer {
+	t.Helper()
+	s := &catalogServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		s.mu.Lock()
+		s.calls = append(s.calls, r.Header.Get("X-Arc-Database")+" "+body.SQL)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		var resp map[string]any
+		switch {
+		case body.SQL == "SHOW DATABASES":
+			resp = map[string]any{"columns": []string{"database_name"}, "data": [][]any{{"default"}, {"prod"}}}
+		case body.SQL == "SHOW TABLES":
+			resp = map[string]any{"columns": []string{"name"}, "data": [][]any{{"cpu"}, {"mem"}, {"secrets"}}}
+		case strings.HasPrefix(body.SQL, "DESCRIBE "):
+			resp = map[string]any{
+				"columns": []string{"column_name", "column_type", "comment"},
+				"data":    [][]any{{"time", "TIMESTAMP", nil}, {"usage", "DOUBLE", "percent"}},
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			resp = map[string]any{"error": "unexpected " + body.SQL}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *catalogServer) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func TestCatalogResources(t *testing.T) {
+	srv := newCatalogServer(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "allowDatabaseOverride": true})
+
+	status, body := callResource(t, d, pctx, http.MethodGet, "/databases", nil)
+	var dbs []string
+	if status != http.StatusOK || json.Unmarshal(body, &dbs) != nil || !reflect.DeepEqual(dbs, []string{"default", "prod"}) {
+		t.Fatalf("/databases = %d %s", status, body)
+	}
+
+	status, body = callResource(t, d, pctx, http.MethodGet, "/tables?database=prod", nil)
+	var tables []string
+	if status != http.StatusOK || json.Unmarshal(body, &tables) != nil || !reflect.DeepEqual(tables, []string{"cpu", "mem", "secrets"}) {
+		t.Fatalf("/tables = %d %s", status, body)
+	}
+
+	status, body = callResource(t, d, pctx, http.MethodGet, "/columns?database=prod&table=cpu", nil)
+	var cols []catalogColumn
+	if status != http.StatusOK || json.Unmarshal(body, &cols) != nil {
+		t.Fatalf("/columns = %d %s", status, body)
+	}
+	want := []catalogColumn{{Name: "time", Type: "TIMESTAMP"}, {Name: "usage", Type: "DOUBLE", Description: "percent"}}
+	if !reflect.DeepEqual(cols, want) {
+		t.Errorf("/columns = %+v, want %+v", cols, want)
+	}
+
+	// Asked again, every answer comes from the cache.
+	for _, path := range []string{"/databases", "/tables?database=prod", "/columns?database=prod&table=cpu"} {
+		if status, body := callResource(t, d, pctx, http.MethodGet, path, nil); status != http.StatusOK {
+			t.Fatalf("%s again = %d %s", path, status, body)
+		}
+	}
+	wantCalls := []string{"default SHOW DATABASES", "prod SHOW TABLES", `prod DESCRIBE "cpu"`}
+	if got := srv.sent(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("Arc was sent %q, want %q", got, wantCalls)
+	}
+
+	// The configured database is a separate cache entry.
+	callResource(t, d, pctx, http.MethodGet, "/tables", nil)
+	if got := srv.sent(); len(got) != 4 || got[3] != "default SHOW TABLES" {
+		t.Errorf("Arc was sent %q, want a SHOW TABLES in default last", got)
+	}
+}
+
+func TestCatalogResources_CacheTTLZero(t *testing.T) {
+	srv := newCatalogServer(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "catalogCacheTTL": "0"})
+	for range 2 {
+		if status, body := callResource(t, d, pctx, http.MethodGet, "/tables", nil); status != http.StatusOK {
+			t.Fatalf("/tables = %d %s", status, body)
+		}
+	}
+	if got := len(srv.sent()); got != 2 {
+		t.Errorf("Arc was asked %d times, want 2 with the cache off", got)
+	}
+}
+
+func TestCatalogResources_Rejected(t *testing.T) {
+	srv := newCatalogServer(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{
+		"useArrow":         false,
+		"roleRestrictions": map[string]any{"Viewer": map[string]any{"tables": []string{"cpu", "mem"}}},
+	})
+	viewer := pctx
+	viewer.User = &backend.User{Login: "v", Role: "Viewer"}
+
+	cases := []struct {
+		name   string
+		pctx   backend.PluginContext
+		method string
+		path   string
+		status int
+		msg    string
+	}{
+		{"POST", pctx, http.MethodPost, "/databases", http.StatusMethodNotAllowed, "use GET"},
+		{"database override off", pctx, http.MethodGet, "/tables?database=prod", http.StatusBadRequest, "override is not enabled"},
+		{"no table", pctx, http.MethodGet, "/columns", http.StatusBadRequest, "table is required"},
+		{"control character", pctx, http.MethodGet, "/columns?table=cpu%0A", http.StatusBadRequest, "U+000A"},
+		{"restricted table", viewer, http.MethodGet, "/columns?table=secrets", http.StatusForbidden, "secrets is not allowed for the Viewer role"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, body := callResource(t, d, c.pctx, c.method, c.path, nil)
+			if status != c.status || !strings.Contains(string(body), c.msg) {
+				t.Errorf("%s %s = %d %s, want %d containing %q", c.method, c.path, status, body, c.status, c.msg)
+			}
+		})
+	}
+	if got := srv.sent(); len(got) != 0 {
+		t.Errorf("rejected requests reached Arc: %q", got)
+	}
+
+	// A restricted role sees only the tables it may query.
+	status, body := callResource(t, d, viewer, http.MethodGet, "/tables", nil)
+	var tables []string
+	if status != http.StatusOK || json.Unmarshal(body, &tables) != nil || !reflect.DeepEqual(tables, []string{"cpu", "mem"}) {
+		t.Errorf("viewer /tables = %d %s, want cpu and mem", status, body)
+	}
+}
+
+func TestParseCatalogCacheTTL(t *testing.T) {
+	for setting, want := range map[string]time.Duration{"": DefaultCatalogCacheTTL, "0": 0, "5m": 5 * time.Minute} {
+		if got, err := parseCatalogCacheTTL(setting); err != nil || got != want {
+			t.Errorf("parseCatalogCacheTTL(%q) = %v, %v; want %v", setting, got, err, want)
+		}
+	}
+	for _, setting := range []string{"-1s", "soon"} {
+		if _, err := parseCatalogCacheTTL(setting); err == nil {
+			t.Errorf("parseCatalogCacheTTL(%q) accepted", setting)
+		}
+	}
+}
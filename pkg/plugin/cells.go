@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Long text values (maxCellBytes setting). A single cell holding a 50 MB
+// JSON blob makes frame serialization slow and the browser tab unusable,
+// so both decoders cut text values past the limit as they are appended
+// (arcclient.TruncateCell), ending them with an ellipsis. The panel gets
+// one warning notice per affected column with its count, and
+// Meta.Custom["truncatedCells"] lists the columns. Strict mode refuses the
+// truncation like any other modification.
+
+// DefaultMaxCellBytes is the maxCellBytes used when the setting is unset.
+const DefaultMaxCellBytes = 1 << 20
+
+// truncatedCellsMetaKey is the FrameMeta.Custom key listing the columns
+// whose values were truncated.
+const truncatedCellsMetaKey = "truncatedCells"
+
+// resolveMaxCellBytes resolves the maxCellBytes setting: 0 is
+// DefaultMaxCellBytes, negative turns truncation off (0 here).
+func resolveMaxCellBytes(n int) int {
+	switch {
+	case n == 0:
+		return DefaultMaxCellBytes
+	case n < 0:
+		return 0
+	}
+	return n
+}
+
+// jsonOptions configures the JSON decoder.
+func (s *ArcInstanceSettings) jsonOptions() arcclient.JSONOptions {
+	return arcclient.JSONOptions{MaxCellBytes: s.maxCellBytes, TimeColumns: s.timeColumns}
+}
+
+// noticeTruncatedCells tells the panel which columns had values cut: a
+// warning notice per column and the truncatedCells list.
+func noticeTruncatedCells(frame *data.Frame, mods []modification) {
+	var columns []string
+	for _, m := range mods {
+		if m.Kind != modCellTruncated {
+			continue
+		}
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: m.String()})
+		columns = append(columns, m.Column)
+	}
+	if len(columns) == 0 {
+		return
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		custom = map[string]interface{}{}
+		frame.Meta.Custom = custom
+	}
+	custom[truncatedCellsMetaKey] = columns
+}
+
+// mergeTruncatedCells sums the truncations of several chunk frames per
+// column, so a split query reports one notice per column rather than one
+// per chunk.
+func mergeTruncatedCells(frames []*data.Frame) []modification {
+	var merged []modification
+	index := map[string]int{}
+	for _, frame := range frames {
+		for _, m := range frameModifications(frame) {
+			if m.Kind != modCellTruncated {
+				continue
+			}
+			if i, ok := index[m.Column]; ok {
+				merged[i].Count += m.Count
+				continue
+			}
+			index[m.Column] = len(merged)
+			merged = append(merged, m)
+		}
+	}
+	return merged
+}
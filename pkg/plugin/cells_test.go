@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// truncatedCells returns the truncatedCells meta of frame.
+func truncatedCells(frame *data.Frame) []string {
+	if frame.Meta == nil {
+		return nil
+	}
+	custom, _ := frame.Meta.Custom.(map[string]interface{})
+	columns, _ := custom[truncatedCellsMetaKey].([]string)
+	return columns
+}
+
+func TestResolveMaxCellBytes(t *testing.T) {
+	for in, want := range map[int]int{0: DefaultMaxCellBytes, -1: 0, 4096: 4096} {
+		if got := resolveMaxCellBytes(in); got != want {
+			t.Errorf("resolveMaxCellBytes(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestQuery_TruncatesLongCells(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "payload", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+		b.Field(1).(*array.StringBuilder).AppendValues([]string{long, "short"}, nil)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/arrow") {
+			_, _ = w.Write(stream)
+			return
+		}
+		_, _ = w.Write([]byte(`{"columns":["host","payload"],"data":[["a","` + long + `"],["b","short"]]}`))
+	}))
+	defer srv.Close()
+
+	check := func(t *testing.T, frame *data.Frame) {
+		t.Helper()
+		var got []string
+		for i := 0; i < frame.Fields[1].Len(); i++ {
+			got = append(got, *frame.Fields[1].At(i).(*string))
+		}
+		if want := []string{strings.Repeat("x", 16) + "…", "short"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("payload = %q, want %q", got, want)
+		}
+		if got := truncatedCells(frame); !reflect.DeepEqual(got, []string{"payload"}) {
+			t.Errorf("truncatedCells = %v", got)
+		}
+		if texts := noticeTexts(frame); len(texts) != 1 || !strings.Contains(texts[0], "column 'payload': 1 text values") {
+			t.Errorf("notices = %q", texts)
+		}
+	}
+
+	t.Run("arrow", func(t *testing.T) {
+		inst := newTestInstance(t, srv.URL)
+		inst.maxCellBytes = 16
+		frame, err := queryArrow(t.Context(), inst, "SELECT host, payload FROM t")
+		if err != nil {
+			t.Fatalf("queryArrow: %v", err)
+		}
+		check(t, frame)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		inst := newTestInstance(t, srv.URL)
+		inst.maxCellBytes = 16
+		frames, err := queryJSON(t.Context(), inst, "SELECT host, payload FROM t")
+		if err != nil {
+			t.Fatalf("queryJSON: %v", err)
+		}
+		check(t, frames[0])
+	})
+
+	t.Run("off", func(t *testing.T) {
+		inst := newTestInstance(t, srv.URL)
+		inst.maxCellBytes = resolveMaxCellBytes(-1)
+		frame, err := queryArrow(t.Context(), inst, "SELECT host, payload FROM t")
+		if err != nil {
+			t.Fatalf("queryArrow: %v", err)
+		}
+		if got := frame.Fields[1].At(0).(*string); *got != long || truncatedCells(frame) != nil {
+			t.Errorf("value cut with truncation off: %q", *got)
+		}
+	})
+
+	t.Run("strict mode refuses", func(t *testing.T) {
+		inst := newTestInstance(t, srv.URL)
+		inst.maxCellBytes = 16
+		inst.policy = dataPolicy{strict: true}
+		if _, err := inst.queryFrames(t.Context(), "SELECT host, payload FROM t"); !errors.Is(err, errStrictMode) {
+			t.Errorf("err = %v, want strict mode", err)
+		}
+	})
+}
+
+// TestSplitQuery_TruncatedCellsSummed: a split query reports one notice for
+// the column, with the count summed across its chunks.
+func TestSplitQuery_TruncatedCellsSummed(t *testing.T) {
+	long := strings.Repeat("y", 64)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"columns":["time","payload"],"data":[["2026-03-08T00:30:00Z","` + long + `"]]}`))
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "maxCellBytes": 16}),
+		Queries: []backend.DataQuery{{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: from, To: from.Add(3 * time.Hour)},
+			JSON:      []byte(`{"sql":"SELECT time, payload FROM t WHERE $__timeFilter(time)","format":"table","splitDuration":"1h"}`),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	r := resp.Responses["A"]
+	if r.Error != nil {
+		t.Fatalf("query error: %v", r.Error)
+	}
+	frame := r.Frames[0]
+	if got := truncatedCells(frame); !reflect.DeepEqual(got, []string{"payload"}) {
+		t.Errorf("truncatedCells = %v", got)
+	}
+	var notices []string
+	for _, text := range noticeTexts(frame) {
+		if strings.Contains(text, "payload") {
+			notices = append(notices, text)
+		}
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], ": 3 text values") {
+		t.Errorf("payload notices = %q, want one for 3 values", notices)
+	}
+}
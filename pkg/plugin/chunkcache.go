@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// ChunkCacheMBCap is the upper bound on ChunkCacheMB. The cache lives in the
+// plugin process, next to the response buffers MaxResponseMB already sizes.
+const ChunkCacheMBCap = 4096
+
+// DefaultChunkCacheHorizon is the immutability horizon when
+// ChunkCacheHorizon is unset: chunks ending more than this long ago are
+// treated as final. Ten minutes covers ordinary ingest lag; late-arriving
+// backfills need a longer horizon.
+const DefaultChunkCacheHorizon = 10 * time.Minute
+
+// chunkCacheMetaKey is the FrameMeta.Custom key holding a split query's
+// chunk cache hits and misses.
+const chunkCacheMetaKey = "chunkCache"
+
+// chunkCacheStats is the per-query cache outcome recorded in frame meta.
+// Misses count every chunk fetched from Arc, including the ones inside the
+// horizon that are never cached.
+type chunkCacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// chunkCache holds the frames of split-query chunks that lie entirely
+// before the immutability horizon. Historical data doesn't change, so a
+// long-range dashboard's refresh only has to fetch the chunks overlapping
+// the recent, mutable window.
+//
+// It is an LRU bounded by bytes, not entries: a chunk can be a handful of
+// rows or millions. Frames are stored Arrow-encoded, which gives the size
+// for the accounting and an independent copy per hit — chunk frames are
+// appended to in place when merged, so sharing one would corrupt the cache.
+type chunkCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	lru      *list.List // of *chunkCacheEntry, most recently used first
+	entries  map[string]*list.Element
+}
+
+type chunkCacheEntry struct {
+	key   string
+	arrow []byte          // the frame without Meta
+	meta  *data.FrameMeta // kept aside: Custom holds typed values Arrow's JSON metadata wouldn't round-trip
+}
+
+func newChunkCache(maxBytes int64) *chunkCache {
+	return &chunkCache{maxBytes: maxBytes, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// chunkCacheKey keys a chunk by scope (the credential or token, what Arc
+// lets it see: see cacheScope), database, how it is decoded (the protocol,
+// as Arrow and JSON give different field types, and the time columns, see
+// timecolumns.go) and its macro-expanded SQL, which carries the chunk
+// bounds and everything else the macros resolved ($__interval, bucket
+// origin, previous-period shifts).
+func chunkCacheKey(scope, database, protocol string, timeColumns []string, sql string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + database + "\x00" + protocol + "\x00" + strings.Join(timeColumns, ",") + "\x00" + sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns a fresh copy of the cached frame for key.
+func (c *chunkCache) get(key string) (*data.Frame, bool) {
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*chunkCacheEntry)
+	frame, err := data.UnmarshalArrowFrame(entry.arrow)
+	if err != nil {
+		log.DefaultLogger.Warn("Dropping undecodable chunk cache entry", "error", err.Error())
+		c.remove(key)
+		return nil, false
+	}
+	frame.Meta = cloneFrameMeta(entry.meta)
+	return frame, true
+}
+
+// put stores frame under key, evicting least recently used entries until it
+// fits. A frame larger than the whole cache is not stored.
+func (c *chunkCache) put(key string, frame *data.Frame) {
+	meta := frame.Meta
+	frame.Meta = nil
+	encoded, err := frame.MarshalArrow()
+	frame.Meta = meta
+	if err != nil {
+		log.DefaultLogger.Debug("Chunk not cached: Arrow encoding failed", "error", err.Error())
+		return
+	}
+	size := int64(len(encoded))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.bytes -= int64(len(el.Value.(*chunkCacheEntry).arrow))
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	for c.bytes+size > c.maxBytes {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*chunkCacheEntry)
+		c.bytes -= int64(len(entry.arrow))
+		c.lru.Remove(oldest)
+		delete(c.entries, entry.key)
+	}
+	c.entries[key] = c.lru.PushFront(&chunkCacheEntry{key: key, arrow: encoded, meta: cloneFrameMeta(meta)})
+	c.bytes += size
+}
+
+func (c *chunkCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.bytes -= int64(len(el.Value.(*chunkCacheEntry).arrow))
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+}
+
+// cloneFrameMeta copies the parts of meta that callers modify (notices,
+// Custom) so a cached frame's meta is never shared with a response.
+func cloneFrameMeta(meta *data.FrameMeta) *data.FrameMeta {
+	if meta == nil {
+		return nil
+	}
+	clone := *meta
+	clone.Notices = slices.Clone(meta.Notices)
+	if custom, ok := meta.Custom.(map[string]interface{}); ok {
+		clone.Custom = maps.Clone(custom)
+	}
+	return &clone
+}
+
+// parseChunkCacheHorizon resolves the ChunkCacheHorizon setting: a Go
+// duration ("10m", "1h"), DefaultChunkCacheHorizon when empty.
+func parseChunkCacheHorizon(setting string) (time.Duration, error) {
+	if setting == "" {
+		return DefaultChunkCacheHorizon, nil
+	}
+	horizon, err := time.ParseDuration(setting)
+	if err != nil || horizon < 0 {
+		return 0, fmt.Errorf("invalid chunkCacheHorizon %q: use a non-negative duration such as 10m or 1h", setting)
+	}
+	return horizon, nil
+}
+
+// executeChunkCached is executeChunk through the chunk cache: a user query's
+// chunk ending before now minus the horizon is answered from, or stored
+// into, the cache (see requestClass.usesResultCache).
+// hit reports whether Arc was skipped. The protocol and time columns in the
+// key are the ones settings resolves to, after the query's overrides and
+// the adaptive plan (see withQueryProtocol, withTimeColumns, withProtocol).
+func (d *ArcDatasource) executeChunkCached(ctx context.Context, settings *ArcInstanceSettings, rawSQL string, chunk backend.TimeRange, query backend.DataQuery, bucketOrigin time.Time) (frame *data.Frame, hit bool, err error) {
+	if settings.chunkCache == nil || !requestClassFrom(ctx).usesResultCache() ||
+		!chunk.To.Before(time.Now().Add(-settings.chunkCacheHorizon)) {
+		frame, err = d.executeChunk(ctx, settings, rawSQL, chunk, query, bucketOrigin)
+		return frame, false, err
+	}
+	protocol := queryProtocolJSON
+	if settings.useArrow(ctx) {
+		protocol = queryProtocolArrow
+	}
+	key := chunkCacheKey(settings.cacheScope(ctx), settings.settings.Database, protocol, settings.timeColumns, applyMacrosWith(rawSQL, chunk, query, bucketOrigin))
+	if frame, ok := settings.chunkCache.get(key); ok {
+		return frame, true, nil
+	}
+	frame, err = d.executeChunk(ctx, settings, rawSQL, chunk, query, bucketOrigin)
+	if err == nil {
+		settings.chunkCache.put(key, frame)
+	}
+	return frame, false, err
+}
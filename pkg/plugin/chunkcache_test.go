@@ -0,0 +1,332 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// TestQuery_ChunkCache runs the same 3h split query three times: after the
+// first run only the chunks overlapping the mutable window go to Arc, the
+// hit/miss counts land in frame meta, and merging never leaks rows into the
+// cached frames.
+func TestQuery_ChunkCache(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","value"],"data":[["2025-01-01T00:00:00Z",1.5]]}`))
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	inst.chunkCache = newChunkCache(1 << 20)
+	inst.chunkCacheHorizon = 10 * time.Minute
+
+	now := time.Now()
+	q := backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: now.Add(-3 * time.Hour), To: now},
+		JSON:      []byte(`{"sql":"SELECT time, value FROM cpu WHERE $__timeFilter(time)","format":"table","splitDuration":"1h"}`),
+	}
+	split := splitTimeRange(q.TimeRange.From, q.TimeRange.To, time.Hour, 0)
+	chunks, immutable := len(split), 0
+	for _, c := range split {
+		if c.To.Before(now.Add(-inst.chunkCacheHorizon)) {
+			immutable++
+		}
+	}
+	d := NewArcDatasource()
+
+	mutable := chunks - immutable
+	for run, want := range []chunkCacheStats{{Misses: chunks}, {Hits: immutable, Misses: mutable}, {Hits: immutable, Misses: mutable}} {
+		resp := d.query(t.Context(), inst, q)
+		if resp.Error != nil {
+			t.Fatalf("run %d: %v", run, resp.Error)
+		}
+		if rows := resp.Frames[0].Rows(); rows != chunks {
+			t.Errorf("run %d: %d rows, want one per chunk (%d)", run, rows, chunks)
+		}
+		custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{})
+		if got := custom[chunkCacheMetaKey]; got != want {
+			t.Errorf("run %d: cache stats %v, want %v", run, got, want)
+		}
+	}
+	if n := int(requests.Load()); n != chunks+2*mutable {
+		t.Errorf("expected %d Arc requests, got %d", chunks+2*mutable, n)
+	}
+	if immutable == 0 {
+		t.Fatal("test range has no immutable chunk")
+	}
+}
+
+// protocolServer answers the query endpoints with one row over Arrow and
+// over JSON, counting the requests to each.
+func protocolServer(t *testing.T) (srv *httptest.Server, arrowRequests, jsonRequests *atomic.Int32) {
+	t.Helper()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Microsecond}, Nullable: true},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixMicro()))
+		b.Field(1).(*array.Float64Builder).Append(1.5)
+	})
+	arrowRequests, jsonRequests = new(atomic.Int32), new(atomic.Int32)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/query/arrow" {
+			arrowRequests.Add(1)
+			_, _ = w.Write(stream)
+			return
+		}
+		jsonRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","value"],"data":[["2025-01-01T00:00:00Z",1.5]]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, arrowRequests, jsonRequests
+}
+
+// TestQuery_ChunkCacheKeyedByProtocol: a chunk decoded over JSON is not
+// served to the same query sent over Arrow, whose fields differ, and the
+// other way round.
+func TestQuery_ChunkCacheKeyedByProtocol(t *testing.T) {
+	srv, arrowRequests, jsonRequests := protocolServer(t)
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	inst.chunkCache = newChunkCache(1 << 20)
+	inst.chunkCacheHorizon = 0
+
+	// Three 1h chunks, all before the horizon.
+	to := time.Now().Add(-time.Hour).Truncate(time.Hour)
+	d := NewArcDatasource()
+	run := func(protocol string) chunkCacheStats {
+		t.Helper()
+		resp := d.query(t.Context(), inst, backend.DataQuery{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: to.Add(-3 * time.Hour), To: to},
+			JSON: []byte(`{"sql":"SELECT time, value FROM cpu WHERE $__timeFilter(time)","format":"table",` +
+				`"splitDuration":"1h","protocol":"` + protocol + `"}`),
+		})
+		if resp.Error != nil {
+			t.Fatalf("%s: %v", protocol, resp.Error)
+		}
+		custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{})
+		stats, _ := custom[chunkCacheMetaKey].(chunkCacheStats)
+		return stats
+	}
+
+	if got := run("json"); got != (chunkCacheStats{Misses: 3}) {
+		t.Errorf("json: cache stats %v, want 3 misses", got)
+	}
+	if got := run("arrow"); got != (chunkCacheStats{Misses: 3}) {
+		t.Errorf("arrow after json: cache stats %v, want 3 misses", got)
+	}
+	if got := run("json"); got != (chunkCacheStats{Hits: 3}) {
+		t.Errorf("json again: cache stats %v, want 3 hits", got)
+	}
+	if a, j := arrowRequests.Load(), jsonRequests.Load(); a != 3 || j != 3 {
+		t.Errorf("%d Arrow and %d JSON requests, want 3 of each", a, j)
+	}
+}
+
+// TestChunkCache_AdaptiveProtocol: the protocol an adaptive plan picks is
+// the one the chunk is cached under, so a chunk fetched over Arrow for one
+// plan isn't served to a plan that picked JSON.
+func TestChunkCache_AdaptiveProtocol(t *testing.T) {
+	srv, arrowRequests, jsonRequests := protocolServer(t)
+	inst := newTestInstance(t, srv.URL)
+	inst.chunkCache = newChunkCache(1 << 20)
+	inst.chunkCacheHorizon = 0
+
+	to := time.Now().Add(-time.Hour).Truncate(time.Hour)
+	chunk := backend.TimeRange{From: to.Add(-time.Hour), To: to}
+	query := backend.DataQuery{RefID: "A", TimeRange: chunk}
+	d := NewArcDatasource()
+	for i, c := range []struct {
+		protocol string
+		wantHit  bool
+	}{
+		{"Arrow", false},
+		{"JSON", false},
+		{"Arrow", true},
+		{"JSON", true},
+	} {
+		settings := inst.withProtocol(&adaptivePlan{Protocol: c.protocol})
+		_, hit, err := d.executeChunkCached(t.Context(), settings, "SELECT time, value FROM cpu WHERE $__timeFilter(time)", chunk, query, time.Time{})
+		if err != nil {
+			t.Fatalf("run %d (%s): %v", i, c.protocol, err)
+		}
+		if hit != c.wantHit {
+			t.Errorf("run %d (%s): hit = %v, want %v", i, c.protocol, hit, c.wantHit)
+		}
+	}
+	if a, j := arrowRequests.Load(), jsonRequests.Load(); a != 1 || j != 1 {
+		t.Errorf("%d Arrow and %d JSON requests, want 1 of each", a, j)
+	}
+}
+
+// TestChunkCache_UserQueriesOnly: a template-variable query neither fills
+// the chunk cache nor is answered from it.
+func TestChunkCache_UserQueriesOnly(t *testing.T) {
+	srv, _, jsonRequests := protocolServer(t)
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	inst.chunkCache = newChunkCache(1 << 20)
+	inst.chunkCacheHorizon = 0
+
+	to := time.Now().Add(-time.Hour).Truncate(time.Hour)
+	chunk := backend.TimeRange{From: to.Add(-time.Hour), To: to}
+	query := backend.DataQuery{RefID: "A", TimeRange: chunk}
+	d := NewArcDatasource()
+	variable := withRequestClass(t.Context(), requestClassVariable)
+	for i, c := range []struct {
+		ctx     context.Context
+		wantHit bool
+	}{
+		{variable, false},
+		{variable, false}, // the first didn't fill the cache
+		{t.Context(), false},
+		{variable, false}, // nor is it served what the user query cached
+		{t.Context(), true},
+	} {
+		_, hit, err := d.executeChunkCached(c.ctx, inst, "SELECT DISTINCT host FROM cpu WHERE $__timeFilter(time)", chunk, query, time.Time{})
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if hit != c.wantHit {
+			t.Errorf("run %d (%s): hit = %v, want %v", i, requestClassFrom(c.ctx), hit, c.wantHit)
+		}
+	}
+	if n := jsonRequests.Load(); n != 4 {
+		t.Errorf("%d Arc requests, want 4", n)
+	}
+}
+
+// TestQuery_ChunkCacheKeyedByTimeColumns: a query's timeColumnNames
+// changes how its chunks decode, so it neither gets nor leaves frames for
+// the same query without it.
+func TestQuery_ChunkCacheKeyedByTimeColumns(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["created_at","orders"],"data":[[1771408800000,3]]}`))
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	inst.chunkCache = newChunkCache(1 << 20)
+	inst.chunkCacheHorizon = 0
+
+	to := time.Now().Add(-time.Hour).Truncate(time.Hour)
+	d := NewArcDatasource()
+	run := func(timeColumns string) (data.FieldType, chunkCacheStats) {
+		t.Helper()
+		resp := d.query(t.Context(), inst, backend.DataQuery{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: to.Add(-3 * time.Hour), To: to},
+			JSON: []byte(`{"sql":"SELECT created_at, orders FROM orders WHERE $__timeFilter(created_at)","format":"table",` +
+				`"splitDuration":"1h","timeColumnNames":"` + timeColumns + `"}`),
+		})
+		if resp.Error != nil {
+			t.Fatalf("timeColumnNames %q: %v", timeColumns, resp.Error)
+		}
+		custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{})
+		stats, _ := custom[chunkCacheMetaKey].(chunkCacheStats)
+		return resp.Frames[0].Fields[0].Type(), stats
+	}
+
+	for i, c := range []struct {
+		timeColumns string
+		wantType    data.FieldType
+		wantStats   chunkCacheStats
+	}{
+		{"", data.FieldTypeNullableFloat64, chunkCacheStats{Misses: 3}},
+		{"created_at", data.FieldTypeNullableTime, chunkCacheStats{Misses: 3}},
+		{"created_at", data.FieldTypeNullableTime, chunkCacheStats{Hits: 3}},
+		{"", data.FieldTypeNullableFloat64, chunkCacheStats{Hits: 3}},
+	} {
+		typ, stats := run(c.timeColumns)
+		if typ != c.wantType || stats != c.wantStats {
+			t.Errorf("run %d (timeColumnNames %q): created_at %s, cache stats %v; want %s, %v",
+				i, c.timeColumns, typ, stats, c.wantType, c.wantStats)
+		}
+	}
+	if n := requests.Load(); n != 6 {
+		t.Errorf("%d Arc requests, want 6", n)
+	}
+}
+
+func TestChunkCache_EvictsLeastRecentlyUsedByBytes(t *testing.T) {
+	frame := func(n int) *data.Frame {
+		values := make([]float64, n)
+		return data.NewFrame("", data.NewField("value", nil, values))
+	}
+	encoded, _ := frame(1000).MarshalArrow()
+	c := newChunkCache(int64(len(encoded))*2 + 100)
+
+	c.put("a", frame(1000))
+	c.put("b", frame(1000))
+	if _, ok := c.get("a"); !ok { // a is now more recent than b
+		t.Fatal("a missing")
+	}
+	c.put("c", frame(1000))
+	if _, ok := c.get("b"); ok {
+		t.Error("b should have been evicted as least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+	if c.bytes > c.maxBytes {
+		t.Errorf("cache holds %d bytes, over its %d limit", c.bytes, c.maxBytes)
+	}
+
+	c.put("huge", frame(100_000))
+	if _, ok := c.get("huge"); ok {
+		t.Error("a frame larger than the cache must not be stored")
+	}
+
+	got, _ := c.get("a")
+	got.Fields[0].Set(0, 42.0)
+	if again, _ := c.get("a"); again.Fields[0].At(0) != 0.0 {
+		t.Error("hits must be independent copies")
+	}
+}
+
+func TestParseChunkCacheHorizon(t *testing.T) {
+	for _, c := range []struct {
+		setting string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", DefaultChunkCacheHorizon, false},
+		{"1h", time.Hour, false},
+		{"0s", 0, false},
+		{"-5m", 0, true},
+		{"10 minutes", 0, true},
+	} {
+		got, err := parseChunkCacheHorizon(c.setting)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("parseChunkCacheHorizon(%q) = %v, %v; want %v, wantErr %v", c.setting, got, err, c.want, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Named credentials: the secure "credentials" field holds a JSON object of
+// name → Arc API key ({"admin": "<key>", "readonly": "<key>"}), and a query
+// naming one (`credential: "admin"`) runs with that key instead of the
+// datasource's apiKey — for the few dashboards that need a more privileged
+// key, such as cross-tenant admin views, without a second datasource.
+//
+// Only Editors and Admins may run such a query: a Viewer opening the
+// dashboard, or a request with no user, gets a permission error, as does a
+// name the datasource doesn't define. The name, never the key, is logged
+// and recorded in the frame meta (credentialMetaKey).
+
+// credentialMetaKey is the FrameMeta.Custom key naming the credential a
+// query ran with.
+const credentialMetaKey = "credential"
+
+// errCredentialDenied is returned when a query may not use the credential
+// it names.
+var errCredentialDenied = errors.New("credential not allowed")
+
+// parseCredentials decodes the secure credentials field; empty is none.
+func parseCredentials(raw string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var creds map[string]string
+	if err := json.Unmarshal([]byte(raw), &creds); err != nil {
+		// The error would quote the field's content: keys.
+		return nil, errors.New(`invalid credentials: expected a JSON object of name to API key, e.g. {"admin": "<key>"}`)
+	}
+	out := make(map[string]string, len(creds))
+	for name, key := range creds {
+		key = strings.TrimSpace(key)
+		if strings.TrimSpace(name) == "" || key == "" {
+			return nil, fmt.Errorf("invalid credentials: %q needs a name and a non-empty API key", name)
+		}
+		if err := validateHeaderValue("credential "+name, key); err != nil {
+			return nil, err
+		}
+		out[name] = key
+	}
+	return out, nil
+}
+
+// credentialNames lists the defined credentials, sorted.
+func (s *ArcInstanceSettings) credentialNames() []string {
+	names := make([]string, 0, len(s.credentials))
+	for name := range s.credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withCredential returns the settings to use for a query that names the
+// credential name: a copy running with its key, when user may use it. An
+// empty name returns the receiver.
+func (s *ArcInstanceSettings) withCredential(refID, name string, user *backend.User) (*ArcInstanceSettings, error) {
+	if name == "" {
+		return s, nil
+	}
+	key, ok := s.credentials[name]
+	if !ok {
+		log.DefaultLogger.Warn("Query rejected: unknown credential", "refId", refID, "credential", name)
+		return nil, &blockedQueryError{
+			policy:    policyCredential,
+			offending: "credential: " + name,
+			hint:      "Use one of the datasource's credentials (" + strings.Join(s.credentialNames(), ", ") + ") or remove the query's credential to use the datasource's API key.",
+			err:       fmt.Errorf("%w: the datasource has no credential %q", errCredentialDenied, name),
+		}
+	}
+	if user == nil || !(strings.EqualFold(user.Role, "Editor") || strings.EqualFold(user.Role, "Admin")) {
+		role := "no user"
+		if user != nil {
+			role = user.Role
+		}
+		log.DefaultLogger.Warn("Query rejected: credential needs Editor or Admin", "refId", refID, "credential", name, "role", role)
+		return nil, &blockedQueryError{
+			policy:    policyCredential,
+			offending: "credential: " + name,
+			hint:      "Ask an Editor or Admin to run this query, or remove its credential to use the datasource's API key.",
+			err:       fmt.Errorf("%w: credential %q is only available to Editors and Admins", errCredentialDenied, name),
+		}
+	}
+	log.DefaultLogger.Debug("Query runs with a named credential", "refId", refID, "credential", name)
+	scoped := *s
+	scoped.apiKey, scoped.credential = key, name
+	return &scoped, nil
+}
+
+// attachCredential records the credential frames were queried with.
+func attachCredential(frames data.Frames, name string) {
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = map[string]interface{}{}
+			frame.Meta.Custom = custom
+		}
+		custom[credentialMetaKey] = name
+	}
+}
@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseCredentials(t *testing.T) {
+	if creds, err := parseCredentials(""); creds != nil || err != nil {
+		t.Errorf(`parseCredentials("") = %v, %v`, creds, err)
+	}
+	creds, err := parseCredentials(`{"admin": " adm-key ", "readonly": "ro-key"}`)
+	if err != nil || creds["admin"] != "adm-key" || creds["readonly"] != "ro-key" {
+		t.Errorf("parseCredentials = %v, %v", creds, err)
+	}
+	for _, bad := range []string{`{"admin": "secret-key"`, `["secret-key"]`, `{"admin": ""}`, `{"": "secret-key"}`, `{"admin": "secret\nkey"}`} {
+		_, err := parseCredentials(bad)
+		if err == nil {
+			t.Errorf("%s: expected an error", bad)
+		} else if strings.Contains(err.Error(), "secret") {
+			t.Errorf("%s: error %q quotes the key", bad, err)
+		}
+	}
+}
+
+// TestQuery_NamedCredential: an Editor's query naming a credential runs
+// with its key and says so in the frame meta; a Viewer's, or one naming an
+// unknown credential, is refused before reaching Arc.
+func TestQuery_NamedCredential(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		auth []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	rec := recordLogs(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false})
+	pctx.DataSourceInstanceSettings.DecryptedSecureJSONData["credentials"] = `{"admin": "adm-key"}`
+	run := func(role, credential string) backend.DataResponse {
+		t.Helper()
+		pctx.User = &backend.User{Login: "u", Role: role}
+		resp, err := d.QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: pctx,
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(fmt.Sprintf(`{"sql":"SELECT 1","format":"table","credential":%q}`, credential))}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		return resp.Responses["A"]
+	}
+	lastAuth := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return auth[len(auth)-1]
+	}
+
+	r := run("Editor", "admin")
+	if r.Error != nil {
+		t.Fatalf("editor: %v", r.Error)
+	}
+	if got := lastAuth(); got != "Bearer adm-key" {
+		t.Errorf("sent Authorization %q", got)
+	}
+	if custom, _ := r.Frames[0].Meta.Custom.(map[string]interface{}); custom[credentialMetaKey] != "admin" {
+		t.Errorf("meta custom = %v", r.Frames[0].Meta.Custom)
+	}
+
+	r = run("Viewer", "")
+	if r.Error != nil || lastAuth() != "Bearer k" {
+		t.Errorf("no credential: error %v, sent %q", r.Error, lastAuth())
+	}
+	if custom, _ := r.Frames[0].Meta.Custom.(map[string]interface{}); custom[credentialMetaKey] != nil {
+		t.Errorf("query without a credential recorded %v", custom[credentialMetaKey])
+	}
+
+	mu.Lock()
+	sent := len(auth)
+	mu.Unlock()
+	for _, tc := range []struct{ role, credential, want string }{
+		{"Viewer", "admin", "only available to Editors and Admins"},
+		{"", "admin", "only available to Editors and Admins"},
+		{"Admin", "root", `no credential "root"`},
+	} {
+		r := run(tc.role, tc.credential)
+		if r.Error == nil || r.Status != backend.StatusForbidden || !strings.Contains(r.Error.Error(), tc.want) {
+			t.Errorf("%s with %q: status %d, error %v", tc.role, tc.credential, r.Status, r.Error)
+		}
+	}
+	mu.Lock()
+	if len(auth) != sent {
+		t.Errorf("refused queries reached Arc")
+	}
+	mu.Unlock()
+
+	for _, e := range rec.entries {
+		if strings.Contains(fmt.Sprint(e), "adm-key") {
+			t.Errorf("log entry carries the key: %v", e)
+		}
+	}
+}
+
+// TestRequireAuth: with requireAuth off and no API key, requests go out
+// without an Authorization header and an Arc that wants one is reported
+// by CheckHealth as such; with it on (the default) the key stays required.
+func TestRequireAuth(t *testing.T) {
+	newInstance := func(jsonData string, secure map[string]string) error {
+		_, err := newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+			JSONData:                []byte(jsonData),
+			DecryptedSecureJSONData: secure,
+		})
+		return err
+	}
+	if err := newInstance(`{"url":"https://arc.example.com"}`, nil); err == nil || !strings.Contains(err.Error(), "API key is required") {
+		t.Errorf("default: expected \"API key is required\", got %v", err)
+	}
+	if err := newInstance(`{"url":"https://arc.example.com","requireAuth":true}`, nil); err == nil {
+		t.Error("requireAuth true: expected an error without a key")
+	}
+	if err := newInstance(`{"url":"https://arc.example.com","requireAuth":false}`, nil); err != nil {
+		t.Errorf("requireAuth false: %v", err)
+	}
+	if err := newInstance(`{"url":"https://arc.example.com","requireAuth":false}`, map[string]string{"apiKey": ""}); err != nil {
+		t.Errorf("requireAuth false, cleared key: %v", err)
+	}
+
+	var (
+		mu   sync.Mutex
+		auth [][]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth = append(auth, r.Header.Values("Authorization"))
+		mu.Unlock()
+		if r.Header.Get("Authorization") == "" && r.URL.Path != "/api/v1/query" {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+	query := func(pctx backend.PluginContext) []string {
+		t.Helper()
+		resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: pctx,
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT 1","format":"table"}`)}},
+		})
+		if err != nil || resp.Responses["A"].Error != nil {
+			t.Fatalf("QueryData: %v %v", err, resp.Responses["A"].Error)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return auth[len(auth)-1]
+	}
+
+	withKey := testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "requireAuth": false})
+	if got := query(withKey); len(got) != 1 || got[0] != "Bearer k" {
+		t.Errorf("with a key: sent Authorization %q", got)
+	}
+	noKey := testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "requireAuth": false})
+	noKey.DataSourceInstanceSettings.DecryptedSecureJSONData = nil
+	if got := query(noKey); got != nil {
+		t.Errorf("without a key: sent Authorization %q", got)
+	}
+
+	// An Arc that does require auth, here on the Arrow endpoint only.
+	noKey = testPluginContext(t, srv.URL, map[string]any{"useArrow": true, "requireAuth": false, "retryStatusCodes": []int{}})
+	noKey.DataSourceInstanceSettings.DecryptedSecureJSONData = nil
+	res, err := NewArcDatasource().CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: noKey})
+	if err != nil || res.Status != backend.HealthStatusError || !strings.Contains(res.Message, "rejected the unauthenticated request (HTTP 401)") {
+		t.Errorf("CheckHealth = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Upstream cutoffs. Something between Grafana and Arc — Grafana's dataproxy,
+// an ingress, a load balancer — often has a shorter timeout than the
+// datasource's, and closes the connection first. Arc then gets the blame for
+// a query that was merely slow. A connection reset or EOF that lands close
+// to a round number of seconds, short of the configured timeout, is almost
+// always such a cutoff, so the error says so.
+
+// cutoffCandidates are the timeouts intermediaries are commonly set to.
+var cutoffCandidates = []time.Duration{
+	10 * time.Second, 15 * time.Second, 20 * time.Second, 30 * time.Second,
+	45 * time.Second, 60 * time.Second, 90 * time.Second, 100 * time.Second,
+	120 * time.Second, 180 * time.Second, 240 * time.Second, 300 * time.Second,
+	600 * time.Second, 900 * time.Second, 1800 * time.Second, 3600 * time.Second,
+}
+
+// dataproxyTimeoutEnv is Grafana's [dataproxy] timeout, in seconds, as seen
+// from the plugin process (it usually isn't, unless set in the environment).
+const dataproxyTimeoutEnv = "GF_DATAPROXY_TIMEOUT"
+
+// upstreamCutoffError wraps a request error that looks like an
+// intermediary closing the connection after About, short of Timeout.
+type upstreamCutoffError struct {
+	About   time.Duration
+	Timeout time.Duration
+	err     error
+}
+
+// hint is the user-facing explanation, without the underlying error.
+func (e *upstreamCutoffError) hint() string {
+	return fmt.Sprintf("the connection was closed after ~%.0fs by an intermediary, before the %.0fs timeout — check Grafana's dataproxy timeout and any proxy or ingress in front of Arc", e.About.Seconds(), e.Timeout.Seconds())
+}
+
+func (e *upstreamCutoffError) Error() string { return e.hint() + ": " + e.err.Error() }
+
+func (e *upstreamCutoffError) Unwrap() error { return e.err }
+
+// dataproxyTimeout returns GF_DATAPROXY_TIMEOUT when the plugin process can
+// see it and it parses as a positive number of seconds.
+func dataproxyTimeout() (time.Duration, bool) {
+	v, ok := os.LookupEnv(dataproxyTimeoutEnv)
+	if !ok {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs <= 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// isConnectionCut reports whether err is the connection going away under
+// the request: an EOF or a reset.
+func isConnectionCut(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// likelyCutoff returns the round timeout elapsed lands on, if any, that is
+// shorter than timeout. elapsed may overshoot the cutoff by a couple of
+// seconds (or 2% for long ones) and undershoot it by a little clock skew.
+func likelyCutoff(elapsed, timeout time.Duration) (time.Duration, bool) {
+	candidates := cutoffCandidates
+	if proxy, ok := dataproxyTimeout(); ok {
+		candidates = append([]time.Duration{proxy}, candidates...)
+	}
+	for _, c := range candidates {
+		if c >= timeout {
+			continue
+		}
+		slack := max(2*time.Second, c/50)
+		if elapsed >= c-500*time.Millisecond && elapsed <= c+slack {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// withCutoffHint wraps err in an upstreamCutoffError when it is a
+// connection cut after elapsed that looks like an intermediary's timeout.
+// Anything else is returned unchanged.
+func withCutoffHint(err error, elapsed, timeout time.Duration) error {
+	if err == nil || !isConnectionCut(err) {
+		return err
+	}
+	var already *upstreamCutoffError
+	if errors.As(err, &already) {
+		return err
+	}
+	about, ok := likelyCutoff(elapsed, timeout)
+	if !ok {
+		return err
+	}
+	return &upstreamCutoffError{About: about, Timeout: timeout, err: err}
+}
+
+// cutoffReader annotates body read errors with withCutoffHint, timed from
+// the start of the request. A clean io.EOF is the normal end of the body
+// and passes through untouched.
+type cutoffReader struct {
+	r       io.Reader
+	start   time.Time
+	timeout time.Duration
+}
+
+func (r *cutoffReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = withCutoffHint(err, time.Since(r.start), r.timeout)
+	}
+	return n, err
+}
+
+// dataproxyTimeoutWarning is the CheckHealth warning for a configured
+// timeout longer than Grafana's dataproxy timeout, or "" when there is
+// nothing to warn about (or the dataproxy timeout isn't visible).
+func dataproxyTimeoutWarning(timeout time.Duration) (time.Duration, string) {
+	proxy, ok := dataproxyTimeout()
+	if !ok || timeout <= proxy {
+		return proxy, ""
+	}
+	return proxy, fmt.Sprintf("the configured timeout (%.0fs) exceeds Grafana's dataproxy timeout (%.0fs, %s); queries running longer will be cut off", timeout.Seconds(), proxy.Seconds(), dataproxyTimeoutEnv)
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestLikelyCutoff(t *testing.T) {
+	cases := []struct {
+		name             string
+		elapsed, timeout time.Duration
+		want             time.Duration
+	}{
+		{"just past 60s", 60400 * time.Millisecond, 300 * time.Second, 60 * time.Second},
+		{"slightly early clock", 29800 * time.Millisecond, 300 * time.Second, 30 * time.Second},
+		{"long cutoff, proportional slack", 605 * time.Second, 1800 * time.Second, 600 * time.Second},
+		{"between round numbers", 52 * time.Second, 300 * time.Second, 0},
+		{"quick failure", 2 * time.Second, 300 * time.Second, 0},
+		{"at the configured timeout", 60 * time.Second, 60 * time.Second, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := likelyCutoff(c.elapsed, c.timeout)
+			if got != c.want || ok != (c.want > 0) {
+				t.Errorf("likelyCutoff(%s, %s) = %s, %v; want %s", c.elapsed, c.timeout, got, ok, c.want)
+			}
+		})
+	}
+}
+
+func TestLikelyCutoff_UsesVisibleDataproxyTimeout(t *testing.T) {
+	t.Setenv(dataproxyTimeoutEnv, "75")
+	if got, ok := likelyCutoff(75500*time.Millisecond, 300*time.Second); !ok || got != 75*time.Second {
+		t.Errorf("expected the dataproxy timeout as a cutoff, got %s, %v", got, ok)
+	}
+}
+
+func TestWithCutoffHint(t *testing.T) {
+	reset := fmt.Errorf("read tcp: %w", syscall.ECONNRESET)
+	for _, c := range []struct {
+		name     string
+		err      error
+		elapsed  time.Duration
+		wantHint bool
+	}{
+		{"EOF at 60s", formatRequestError(io.EOF), 60 * time.Second, true},
+		{"reset at 120s", reset, 121 * time.Second, true},
+		{"EOF off the round numbers", io.ErrUnexpectedEOF, 52 * time.Second, false},
+		{"refused at 60s", errors.New("connection refused"), 60 * time.Second, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			err := withCutoffHint(c.err, c.elapsed, 300*time.Second)
+			var cutoff *upstreamCutoffError
+			if errors.As(err, &cutoff) != c.wantHint {
+				t.Fatalf("hint = %v, want %v (%v)", !c.wantHint, c.wantHint, err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Errorf("original error dropped from the chain: %v", err)
+			}
+		})
+	}
+}
+
+// TestCutoffReader_AnnotatesTruncatedBody checks a body cut mid-stream at
+// ~60s surfaces the hint to the user, while a clean EOF passes through.
+func TestCutoffReader_AnnotatesTruncatedBody(t *testing.T) {
+	start := time.Now().Add(-60 * time.Second)
+	r := &cutoffReader{r: iotestErrReader{io.ErrUnexpectedEOF}, start: start, timeout: 300 * time.Second}
+	_, err := r.Read(make([]byte, 1))
+	msg := sanitizeUserError("A", err)
+	if !strings.Contains(msg, "closed after ~60s by an intermediary") || !strings.Contains(msg, "dataproxy timeout") {
+		t.Errorf("unexpected user message %q", msg)
+	}
+
+	r = &cutoffReader{r: iotestErrReader{io.EOF}, start: start, timeout: 300 * time.Second}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("clean EOF should pass through, got %v", err)
+	}
+}
+
+type iotestErrReader struct{ err error }
+
+func (r iotestErrReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestCheckHealth_WarnsAboveDataproxyTimeout(t *testing.T) {
+	srv := arrowOKServer(t)
+	defer srv.Close()
+
+	for _, c := range []struct {
+		env         string
+		wantWarning bool
+	}{
+		{"30", true},
+		{"600", false},
+		{"", false},
+	} {
+		t.Run("GF_DATAPROXY_TIMEOUT="+c.env, func(t *testing.T) {
+			t.Setenv(dataproxyTimeoutEnv, c.env)
+			pctx := testPluginContext(t, srv.URL, map[string]any{"timeout": 300})
+			res, err := NewArcDatasource().CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx})
+			if err != nil {
+				t.Fatalf("CheckHealth: %v", err)
+			}
+			if res.Status != backend.HealthStatusOk {
+				t.Fatalf("expected healthy, got %s", res.Message)
+			}
+			if got := strings.Contains(res.Message, "exceeds Grafana's dataproxy timeout (30s"); got != c.wantWarning {
+				t.Errorf("warning = %v, want %v: %s", got, c.wantWarning, res.Message)
+			}
+		})
+	}
+}
@@ -7,13 +7,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"regexp"
 	"runtime/debug"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
@@ -25,25 +30,85 @@ import (
 
 // ArcDataSourceSettings contains Arc connection settings
 type ArcDataSourceSettings struct {
-	URL                   string `json:"url"`
-	Database              string `json:"database"`
-	Timeout               int    `json:"timeout"`               // seconds
-	UseArrow              *bool  `json:"useArrow"`              // pointer so unset (fresh install) is distinguishable from explicit false
-	MaxConcurrency        int    `json:"maxConcurrency"`        // max parallel chunks for query splitting (default 4)
-	MaxResponseMB         int    `json:"maxResponseMB"`         // per-response body size cap in MiB (default 1024 — large analytical queries cross 256 MiB easily, R2-CR7)
-	AllowPrivateIPs       bool   `json:"allowPrivateIPs"`       // opt-in: permit Arc URL to resolve to RFC1918/private addresses (corporate intranets)
-	AllowDatabaseOverride bool   `json:"allowDatabaseOverride"` // opt-in: permit per-query `database` field to override the datasource default (R2-HI6 confused-deputy guard)
+	URL                    string                     `json:"url"`
+	Database               string                     `json:"database"`
+	Timeout                int                        `json:"timeout"`                // seconds
+	UseArrow               *bool                      `json:"useArrow"`               // nil (key absent) = auto: probe the Arrow endpoint once per instance, see useArrow
+	MaxConcurrency         int                        `json:"maxConcurrency"`         // max in-flight Arc requests, refIds and chunks together (default 4)
+	MaxResponseMB          int                        `json:"maxResponseMB"`          // per-response body size cap in MiB (default 1024 — large analytical queries cross 256 MiB easily, R2-CR7)
+	AllowPrivateIPs        bool                       `json:"allowPrivateIPs"`        // opt-in: permit Arc URL to resolve to RFC1918/private addresses (corporate intranets)
+	AllowDatabaseOverride  bool                       `json:"allowDatabaseOverride"`  // opt-in: permit per-query `database` field to override the datasource default (R2-HI6 confused-deputy guard)
+	FailOnConversionErrors bool                       `json:"failOnConversionErrors"` // strict mode: fail the query instead of nulling values the converter couldn't parse
+	TimeSeriesRowCap       int64                      `json:"timeSeriesRowCap"`       // LIMIT safety net for $__timeGroup time series: 0 = auto (see timeSeriesRowCap), <0 = off, >0 = fixed
+	RawRowCap              int64                      `json:"rawRowCap"`              // upper bound of the LIMIT derived from maxDataPoints for table and raw queries (0 = DefaultRawRowCap, <0 = off), see rawRowCap
+	ArcVersion             string                     `json:"arcVersion"`             // override for version detection, for proxies that hide Arc's health endpoint (empty = detect)
+	AdaptiveExecution      bool                       `json:"adaptiveExecution"`      // estimate rows with count(*) first and pick protocol/splitting/row cap from it, see decideAdaptive
+	FixtureMode            string                     `json:"fixtureMode"`            // directory (or file:// URL) of canned responses to replay instead of calling Arc, see fixtureStore
+	FixtureRecord          bool                       `json:"fixtureRecord"`          // with FixtureMode: call Arc and record each response as a fixture
+	EnrichFieldMetadata    bool                       `json:"enrichFieldMetadata"`    // copy column comments and native types from a cached DESCRIBE into field config, see enrichFieldMetadata
+	ChunkCacheMB           int                        `json:"chunkCacheMB"`           // in-memory cache for historical split-query chunks, in MiB (0 = off), see chunkCache
+	ChunkCacheHorizon      string                     `json:"chunkCacheHorizon"`      // chunks ending before now minus this are cached (Go duration, default 10m)
+	RoleRestrictions       map[string]RoleRestriction `json:"roleRestrictions"`       // org role → tables it may query, see checkRestrictions
+	DurationUnitsFromNames bool                       `json:"durationUnitsFromNames"` // set units on numeric columns named like request_duration_ms, see applyDurationNameUnits
+	Snippets               map[string]string          `json:"snippets"`               // named SQL fragments expanded from $__snippet(name), see expandSnippets
+	ForwardUserIdentity    bool                       `json:"forwardUserIdentity"`    // opt-in: let snippets use ${__user.login} / ${__user.email} of the requesting user
+	MaxRows                int64                      `json:"maxRows"`                // LIMIT appended to every query without its own LIMIT or rowLimit (0 = none), see resolveRowLimit
+	ExploreMaxRows         int64                      `json:"exploreMaxRows"`         // Explore's preview cap, in place of MaxRows (0 = DefaultExploreMaxRows, <0 = none), see exploreDefaults
+	StrictMode             bool                       `json:"strictMode"`             // fail the query instead of modifying the result in any way, see dataPolicy
+	QueryAttribution       bool                       `json:"queryAttribution"`       // opt-in: prepend a comment naming dashboard, panel and user to every query, see withAttribution
+	AttributionTemplate    string                     `json:"attributionTemplate"`    // the comment's text with ${dashboard}, ${panel}, ${org}, ${user}, ${refId} (empty = defaultAttributionTemplate)
+	HideAttribution        bool                       `json:"hideAttribution"`        // leave the attribution comment out of ExecutedQueryString
+	NormalizeUnicode       string                     `json:"normalizeUnicode"`       // clean up pasted SQL: "spaces" (default), "quotes" or "off", see normalizeSQL
+	CaptureFailures        bool                       `json:"captureFailures"`        // opt-in: keep the raw body of responses that fail to convert, see captureStore
+	RetryStatusCodes       []int                      `json:"retryStatusCodes"`       // statuses a request is retried on (nil = defaultRetryStatusCodes, empty = no retries), see retry.go
+	MaxRetries             int                        `json:"maxRetries"`             // retries per request after a retryable failure (0 = defaultMaxRetries, negative = none), see retry.go
+	ExactUint64            *bool                      `json:"exactUint64"`            // nil (key absent) = on: UINT64 columns past 2^53 become text instead of rounding, see arrowOptions
+	PreferNumeric          bool                       `json:"preferNumeric"`          // with ExactUint64: keep such columns float64 and show a precision-loss notice instead
+	ExplainBlockedQueries  bool                       `json:"explainBlockedQueries"`  // answer a query a guard refuses with an explanation frame next to the error, see explainBlocked
+	MaxCellBytes           int                        `json:"maxCellBytes"`           // text values longer than this many bytes are cut (0 = DefaultMaxCellBytes, <0 = off), see noticeTruncatedCells
+	TimeColumnNames        string                     `json:"timeColumnNames"`        // comma-separated JSON columns decoded as time (empty = arcclient.DefaultTimeColumns), see timecolumns.go
+	RedactColumns          []string                   `json:"redactColumns"`          // columns whose values the debug log shows as "***", in results and in the SQL's predicates, see logResult
+	SlowQueryThreshold     string                     `json:"slowQueryThreshold"`     // queries Arc takes longer than this to answer are logged (Go duration, empty = off), see noteSlowQuery
+	CaptureSlowQueryPlans  bool                       `json:"captureSlowQueryPlans"`  // with SlowQueryThreshold: EXPLAIN slow queries in the background, see planStore
+	SchemaVersion          int                        `json:"schemaVersion"`          // shape of this JSONData (absent = 0), older shapes are migrated on load, see settingsMigrations
+	QueryTimeout           string                     `json:"queryTimeout"`           // bound on a whole query, all chunks and retries (Go duration, empty = none), see runQuery
+	CancelSuperseded       *bool                      `json:"cancelSuperseded"`       // nil (key absent) = on: a newer run of a panel query cancels the older one, see runQuery
+	MaxSplitChunks         int                        `json:"maxSplitChunks"`         // most chunks a split query is cut into, larger chunks past it (0 = DefaultMaxSplitChunks), see capChunkSize
+	CatalogCacheTTL        string                     `json:"catalogCacheTTL"`        // how long /databases, /tables and /columns answers are reused (Go duration, default 60s, 0 = off), see catalog.go
+	QueryDefaults          map[string]json.RawMessage `json:"queryDefaults"`          // values for query options a query doesn't set, keyed by ArcQuery JSON key, see querydefaults.go
+	AdhocTable             string                     `json:"adhocTable"`             // table /tag-keys and /tag-values describe when a request names none, see adhoc.go
+	RequireAuth            *bool                      `json:"requireAuth"`            // nil (key absent) = on: refuse to run without an API key; off sends requests unauthenticated when none is set
+	AuthHeaderName         string                     `json:"authHeaderName"`         // header the API key is sent in (empty = Authorization), see auth.go
+	AuthHeaderPrefix       *string                    `json:"authHeaderPrefix"`       // put before the key in that header: nil (key absent) = "Bearer ", "" = the raw key
+	ForwardGrafanaUser     bool                       `json:"forwardGrafanaUser"`     // opt-in: name the Grafana user and org in X-Grafana-User / X-Grafana-Org-Id on every request, see identity.go
+	ServiceIdentity        string                     `json:"serviceIdentity"`        // X-Grafana-User of requests without a user, e.g. alerting (empty = "grafana")
+	OAuthPassThru          bool                       `json:"oauthPassThru"`          // send the user's forwarded OAuth token to Arc instead of the API key, see oauth.go
 }
 
 // ArcQuery represents a query to Arc
 type ArcQuery struct {
-	RefID         string `json:"refId"`
-	SQL           string `json:"sql"`
-	RawSQL        string `json:"rawSql"`        // Postgres/MySQL/MSSQL/ClickHouse compatibility
-	Database      string `json:"database"`       // Per-query database override (empty = use datasource default)
-	Format        string `json:"format"`         // "time_series" or "table"
-	MaxDataPoints int64  `json:"maxDataPoints"`
-	SplitDuration string `json:"splitDuration"`  // "auto" (default), "off", or explicit: "1h", "6h", "12h", "1d", "3d", "7d"
+	RefID                 string        `json:"refId"`
+	SQL                   string        `json:"sql"`
+	RawSQL                string        `json:"rawSql"`   // Postgres/MySQL/MSSQL/ClickHouse compatibility
+	Database              string        `json:"database"` // Per-query database override (empty = use datasource default)
+	Format                string        `json:"format"`   // "time_series", "table", or "numeric_table"
+	MaxDataPoints         int64         `json:"maxDataPoints"`
+	SplitDuration         string        `json:"splitDuration"`         // "auto" (default), "off", or explicit: "1h", "6h", "12h", "1d", "3d", "7d"
+	MaxSeries             int           `json:"maxSeries"`             // cap on series returned after processing (0 = unlimited), see applySeriesCap
+	OverflowAction        string        `json:"overflowAction"`        // what to do past MaxSeries: "truncate" (default), "error", "aggregateOther"
+	TableLayout           string        `json:"tableLayout"`           // format=table only: "long" (default) or "wide", see toTableLayout
+	BucketOrigin          string        `json:"bucketOrigin"`          // $__timeGroup alignment: "" (epoch), "startOfRange", RFC3339 or a zone name, see resolveBucketOrigin
+	LastValueOptimization bool          `json:"lastValueOptimization"` // fetch only the latest row per series (stat panels), see lastValueSQL
+	RowLimit              int64         `json:"rowLimit"`              // LIMIT appended to this query (0 = none), see resolveRowLimit
+	OrderByTime           bool          `json:"orderByTime"`           // append ORDER BY <time column> ASC to unordered time series, see orderByTimeSQL
+	App                   string        `json:"app"`                   // "explore" on queries the frontend sends from Explore (never saved), see exploreDefaults
+	Credential            string        `json:"credential"`            // run with this named credential instead of the API key (Editors and Admins), see withCredential
+	AllowPartialResults   bool          `json:"allowPartialResults"`   // split queries: answer with the chunks that succeeded when some fail, see partialResultNotice
+	DedupeRows            bool          `json:"dedupeRows"`            // split queries: drop merged rows repeating the time and labels of an earlier row, see orderMergedRows
+	VariableQuery         bool          `json:"variableQuery"`         // fill a dashboard variable: one frame of __value and __text, see variableFrames
+	Protocol              string        `json:"protocol"`              // "arrow", "json" or "auto" in place of the datasource's useArrow for this query (empty = the datasource's), see withQueryProtocol
+	AdhocFilters          []adhocFilter `json:"adhocFilters"`          // the dashboard's ad hoc filters, expanded from $__adhocFilter or injected into the WHERE clause, see applyAdhocFilters
+	TimeColumnNames       string        `json:"timeColumnNames"`       // comma-separated JSON columns decoded as time in place of the datasource's timeColumnNames (empty = the datasource's), see withTimeColumns
 }
 
 // ArcInstanceSettings is the cached, parsed view of a datasource instance.
@@ -60,11 +125,42 @@ type ArcQuery struct {
 // 24 in-flight requests, not 4. The semaphore is acquired before the HTTP
 // dial and released after the response is fully read.
 type ArcInstanceSettings struct {
-	settings         ArcDataSourceSettings
-	apiKey           string
-	client           *http.Client
-	sem              *semaphore.Weighted
-	maxResponseBytes int64 // resolved from MaxResponseMB at construction time
+	settings          ArcDataSourceSettings
+	apiKey            string
+	authHeaderName    string // resolved from AuthHeaderName, canonical, see auth.go
+	authHeaderPrefix  string // resolved from AuthHeaderPrefix
+	client            *http.Client
+	sem               *semaphore.Weighted
+	maxResponseBytes  int64         // resolved from MaxResponseMB at construction time
+	streamIdleTimeout time.Duration // max gap between body reads before the stream is declared stalled
+	schemaCache       *schemaCache  // POST /schema answers, keyed by schemaFingerprint
+	versionCache      *arcVersionCache
+	protocolCache     *protocolCache             // resolved "auto" protocol when UseArrow is unset
+	fixtures          *fixtureStore              // non-nil in fixture mode (FixtureMode set)
+	chunkCache        *chunkCache                // nil unless ChunkCacheMB > 0
+	chunkCacheHorizon time.Duration              // resolved from ChunkCacheHorizon
+	restrictions      map[string]roleRestriction // resolved from RoleRestrictions, keyed by lowercased role
+	policy            dataPolicy                 // what to do before modifying a result (StrictMode)
+	databaseList      *databaseList              // SHOW DATABASES, for database-not-found errors
+	captures          *captureStore              // nil unless CaptureFailures
+	arrowAlloc        memory.Allocator           // Arrow IPC buffers; tests swap in a memory.CheckedAllocator
+	retryStatusCodes  []int                      // resolved from RetryStatusCodes
+	maxRetries        int                        // resolved from MaxRetries, 0 = none
+	retryBackoff      time.Duration              // delay before the first retry, doubled per attempt
+	maxCellBytes      int                        // resolved from MaxCellBytes, 0 = off
+	timeColumns       []string                   // parsed from TimeColumnNames, nil = arcclient.DefaultTimeColumns
+	exploreMaxRows    int64                      // resolved from ExploreMaxRows, 0 = none
+	redactColumns     map[string]bool            // resolved from RedactColumns, lowercased
+	redactPredicateRe *regexp.Regexp             // predicates on redactColumns, see redactSQL
+	slowThreshold     time.Duration              // resolved from SlowQueryThreshold, 0 = off
+	slowPlans         *planStore                 // nil unless CaptureSlowQueryPlans
+	migrations        []string                   // settings migrations applied to the stored JSONData, see migrateSettings
+	credentials       map[string]string          // named API keys from the secure credentials field, see withCredential
+	credential        string                     // name of the credential apiKey came from ("" = the datasource's)
+	queryTimeout      time.Duration              // resolved from QueryTimeout, 0 = none
+	inflight          *inflightQueries           // running panel queries, for cancelling superseded runs
+	catalog           *catalogCache              // /databases, /tables and /columns answers, see catalog.go
+	queryDefaults     map[string]json.RawMessage // validated queryDefaults setting, merged under each query's JSON, see mergeQueryDefaults
 }
 
 // Dispose is called by the InstanceManager when the cached instance is being
@@ -94,6 +190,127 @@ func (r *semReleasingReader) Close() error {
 	return err
 }
 
+// DefaultStreamIdleTimeout is the longest gap between two response-body
+// reads before a stream is declared stalled. Arc pads long-running responses
+// with keep-alive messages well inside this window, so silence this long
+// means the server or an intermediate proxy has wedged.
+const DefaultStreamIdleTimeout = 30 * time.Second
+
+// errStreamStalled is returned by idleTimeoutReader when no body bytes
+// arrive within the idle window. Surfaces in errors.Is for callers.
+var errStreamStalled = errors.New("response stream stalled")
+
+// streamIdleTimeoutFor derives the per-read idle window from the overall
+// request timeout: half the timeout, capped at DefaultStreamIdleTimeout, so a
+// stall is always reported before the global timeout fires and masks it.
+func streamIdleTimeoutFor(timeout time.Duration) time.Duration {
+	idle := timeout / 2
+	if idle <= 0 || idle > DefaultStreamIdleTimeout {
+		idle = DefaultStreamIdleTimeout
+	}
+	return idle
+}
+
+// idleTimeoutReader enforces a per-read deadline on a response body. Every
+// read that returns data re-arms the timer; when it fires the request
+// context is cancelled (unblocking the pending Read) and the read surfaces
+// errStreamStalled instead of the bare context error.
+type idleTimeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	ir := &idleTimeoutReader{r: r, timeout: timeout}
+	ir.timer = time.AfterFunc(timeout, func() {
+		ir.stalled.Store(true)
+		cancel()
+	})
+	return ir
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.stalled.Load() {
+		return n, fmt.Errorf("%w: no data received for %s", errStreamStalled, r.timeout)
+	}
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// stop disarms the watchdog; called when the body is closed.
+func (r *idleTimeoutReader) stop() {
+	r.timer.Stop()
+}
+
+// Media types doRequest callers ask for.
+const (
+	jsonMediaType        = "application/json"
+	arrowStreamMediaType = "application/vnd.apache.arrow.stream"
+)
+
+// acceptedContentTypes lists, per requested media type, the response
+// Content-Types that decoder can take. Besides the exact type:
+//   - Arrow: application/octet-stream, the generic binary label Arc builds
+//     before content negotiation (and Go's content sniffing) put on IPC
+//     streams.
+//   - JSON: +json suffix types and text/plain, which servers and proxies
+//     commonly use for JSON bodies. The JSON decoder rejects anything that
+//     isn't JSON regardless.
+//
+// What this check exists to catch is the clearly wrong answer: an HTML
+// login or error page from a proxy, JSON from a rewritten /arrow path, an
+// Arrow stream where JSON was expected.
+var acceptedContentTypes = map[string][]string{
+	arrowStreamMediaType: {arrowStreamMediaType, "application/octet-stream"},
+	jsonMediaType:        {jsonMediaType, "text/json", "text/plain"},
+}
+
+// errUnexpectedContentType is returned when a 200 response's Content-Type
+// isn't one the caller can decode. The message names only media types, so
+// it is shown to the user verbatim.
+var errUnexpectedContentType = errors.New("unexpected response content type")
+
+// checkContentType verifies a 200 response's Content-Type against the
+// requested media type. A missing header passes: older Arc versions don't
+// always set it, and the decoder is then the only check — as before.
+// An Arrow mismatch also wraps errNotArrowStream, which is what triggers
+// the auto-protocol JSON fallback (see queryFrames).
+func checkContentType(contentType, accept, path string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Not echoed: an unparseable header can be arbitrarily long.
+		mediaType = "an invalid Content-Type"
+	}
+	for _, ok := range acceptedContentTypes[accept] {
+		if mediaType == ok {
+			return nil
+		}
+	}
+	if accept == jsonMediaType && strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+	if accept == arrowStreamMediaType {
+		return fmt.Errorf("%w: %w: expected Arrow stream, got %s — the %s endpoint may be unavailable on this Arc version",
+			errUnexpectedContentType, errNotArrowStream, mediaType, path)
+	}
+	return fmt.Errorf("%w: expected %s from %s, got %s — check the datasource URL; a proxy may be answering instead of Arc",
+		errUnexpectedContentType, accept, path, mediaType)
+}
+
+// isJSONContentType reports whether a response Content-Type is JSON.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == jsonMediaType || strings.HasSuffix(mediaType, "+json"))
+}
+
 // doRequest POSTs a JSON body to the given Arc API path and returns the
 // response body wrapped in a size-cap reader and a concurrency-slot
 // release-on-close. Callers MUST Close() the returned ReadCloser exactly
@@ -107,36 +324,132 @@ func (r *semReleasingReader) Close() error {
 //
 // Collapses the previous ~50-line duplication between queryArrow and
 // queryJSON (R2-HI10).
-func (s *ArcInstanceSettings) doRequest(ctx context.Context, path string, body any) (io.ReadCloser, error) {
-	jsonData, err := json.Marshal(body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+//
+// Once headers arrive, body reads are guarded by an idleTimeoutReader so a
+// stream that stops delivering bytes fails with errStreamStalled after
+// streamIdleTimeout instead of hanging until the client-wide timeout.
+// Connection cuts that look like an intermediary's timeout are annotated
+// with a hint (see withCutoffHint).
+//
+// A nil body sends a GET (e.g. the version probe); anything else is POSTed
+// as JSON.
+//
+// accept is the media type the caller will decode. It is sent as the Accept
+// header and a 200 response's Content-Type is checked against it (see
+// checkContentType) before the body reaches a decoder.
+func (s *ArcInstanceSettings) doRequest(ctx context.Context, path, accept string, body any) (io.ReadCloser, error) {
+	method := http.MethodGet
+	var jsonData []byte
+	if body != nil {
+		var err error
+		if jsonData, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		method = http.MethodPost
 	}
 
-	url := s.settings.URL + path
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	// Fixture mode (see fixtureStore): replay answers from disk without
+	// touching the network, or remember the fingerprint to record below.
+	var fixture string
+	if s.fixtures != nil {
+		fixture = fixtureFingerprint(path, s.settings.Database, jsonData)
+		if !s.fixtures.record {
+			return s.fixtures.open(fixture, accept)
+		}
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
-	if s.settings.Database != "" {
-		req.Header.Set("X-Arc-Database", s.settings.Database)
+
+	// Every entry point validates these already (newArcInstance,
+	// withDatabaseOverride); re-checking here keeps a future path that
+	// forgets from putting an unvetted value on the wire.
+	if err := validateHeaderValue("API key", s.apiKey); err != nil {
+		return nil, err
+	}
+	if err := validateHeaderValue("database name", s.settings.Database); err != nil {
+		return nil, err
 	}
 
-	if err := s.sem.Acquire(ctx, 1); err != nil {
+	ctx, cancel := context.WithCancel(ctx)
+	url := s.settings.URL + path
+	// A retry sends a fresh request: the body reader of the last one is spent.
+	newRequest := func() (*http.Request, error) {
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(jsonData)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", accept)
+		s.setAuthHeader(ctx, req)
+		s.setIdentityHeaders(ctx, req)
+		if s.settings.Database != "" {
+			req.Header.Set("X-Arc-Database", s.settings.Database)
+		}
+		return req, nil
+	}
+	req, err := newRequest()
+	if err != nil {
+		cancel()
 		return nil, err
 	}
+
+	// Health probes skip the limiter (see requestClass.bypassesLimiter) so
+	// "Save & test" answers even while a dashboard holds every slot.
+	class := requestClassFrom(ctx)
+	limited := !class.bypassesLimiter()
+	if limited {
+		if err := s.sem.Acquire(ctx, 1); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	start := time.Now()
+	finish := func(outcome string) {
+		cancel()
+		if limited {
+			s.sem.Release(1)
+		}
+		arcRequestsTotal.WithLabelValues(string(class), outcome).Inc()
+		arcRequestDuration.WithLabelValues(string(class)).Observe(time.Since(start).Seconds())
+	}
 	released := false
 	defer func() {
 		if !released {
-			s.sem.Release(1)
+			finish("error")
 		}
 	}()
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, formatRequestError(err)
+	// Retryable statuses (see retry.go) are sent again while the slot is
+	// held, so a retrying chunk doesn't requeue behind other queries.
+	timeout := time.Duration(s.settings.Timeout) * time.Second
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		var delay time.Duration
+		if resp, err = s.client.Do(req); err != nil {
+			if attempt >= s.maxRetries || ctx.Err() != nil || !retryableRequestError(err) {
+				return nil, withCutoffHint(formatRequestError(err), time.Since(start), timeout)
+			}
+			delay = retryDelay(s.retryBackoff, attempt, nil)
+			log.DefaultLogger.Debug("Retrying Arc request", "path", path, "error", err, "attempt", attempt+1, "delay", delay)
+		} else {
+			if resp.StatusCode == http.StatusOK || !s.shouldRetry(resp.StatusCode, attempt) {
+				break
+			}
+			delay = retryDelay(s.retryBackoff, attempt, resp.Header)
+			discardBody(resp)
+			log.DefaultLogger.Debug("Retrying Arc request", "path", path, "status", resp.StatusCode, "attempt", attempt+1, "delay", delay)
+		}
+		countRetry(ctx)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+		if req, err = newRequest(); err != nil {
+			return nil, err
+		}
 	}
 
 	capped := http.MaxBytesReader(nil, resp.Body, s.maxResponseBytes)
@@ -146,53 +459,122 @@ func (s *ArcInstanceSettings) doRequest(ctx context.Context, path string, body a
 		// Arc error payload (gemini 3244935449).
 		raw, _ := io.ReadAll(io.LimitReader(capped, 16*1024))
 		_ = resp.Body.Close()
-		return nil, errors.New(parseArcError(resp.StatusCode, raw))
+		return nil, &arcStatusError{StatusCode: resp.StatusCode, Message: arcclient.ErrorMessage(resp.StatusCode, raw), Body: raw}
+	}
+	if err := checkContentType(resp.Header.Get("Content-Type"), accept, path); err != nil {
+		if errors.Is(err, errNotArrowStream) && isJSONContentType(resp.Header.Get("Content-Type")) {
+			// Arc may report a query error as a 200 JSON payload on the
+			// Arrow endpoint too: that is the query's error, not a sign
+			// the endpoint is missing.
+			raw, _ := io.ReadAll(io.LimitReader(capped, 16*1024))
+			if respErr := arcclient.ResponseErrorOf(raw); respErr != nil {
+				err = respErr
+			}
+		}
+		_ = resp.Body.Close()
+		return nil, err
 	}
+	collectArcWarnings(ctx, resp.Header)
 
-	// Transfer ownership of the semaphore slot to the returned reader —
-	// release happens when the caller closes the body.
+	// Transfer ownership of the semaphore slot (and the request context) to
+	// the returned reader — release happens when the caller closes the body.
 	released = true
-	return &semReleasingReader{
+	idle := newIdleTimeoutReader(capped, s.streamIdleTimeout, cancel)
+	var out io.ReadCloser = &semReleasingReader{
 		ReadCloser: struct {
 			io.Reader
 			io.Closer
-		}{Reader: capped, Closer: resp.Body},
-		release: func() { s.sem.Release(1) },
-	}, nil
+		}{Reader: &cutoffReader{r: idle, start: start, timeout: timeout}, Closer: resp.Body},
+		release: func() {
+			idle.stop()
+			finish("ok")
+		},
+	}
+	if fixture != "" {
+		out = s.fixtures.recorder(out, fixture, accept, jsonData)
+	}
+	return out, nil
 }
 
 // ArcDatasource implements the Grafana datasource interface. The im field
 // caches per-instance settings + HTTP client so QueryData does not pay the
-// JSON-unmarshal-and-build-client cost on every refresh.
+// JSON-unmarshal-and-build-client cost on every refresh. resourceHandler
+// routes CallResource requests (see resource.go).
 type ArcDatasource struct {
-	im instancemgmt.InstanceManager
+	im              instancemgmt.InstanceManager
+	resourceHandler backend.CallResourceHandler
 }
 
 // NewArcDatasource constructs the datasource with the SDK's InstanceManager
 // wired up to the newArcInstance factory.
 func NewArcDatasource() *ArcDatasource {
-	return &ArcDatasource{
+	d := &ArcDatasource{
 		im: datasource.NewInstanceManager(newArcInstance),
 	}
+	d.resourceHandler = d.newResourceHandler()
+	return d
 }
 
+// errAPIKeyUndecryptable is returned by newArcInstance when the settings
+// have an apiKey entry that decrypted to nothing — what Grafana hands over
+// after a restore from a backup made with a different secret key. The
+// rest of the configuration is intact; only the key must be entered again.
+// A key cleared with Reset and saved empty looks the same, and re-entering
+// it is the fix there too. The message is user-facing as-is.
+var errAPIKeyUndecryptable = errors.New("the stored API key could not be decrypted — re-enter it in the datasource settings")
+
 // newArcInstance is the SDK InstanceFactoryFunc — invoked once per (settings,
 // secrets) revision. Validates the configuration, applies defaults, and
 // builds the shared HTTP client. The returned value is cached by the
 // InstanceManager and reused until the datasource is edited.
-func newArcInstance(_ context.Context, instanceSettings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
+func newArcInstance(ctx context.Context, instanceSettings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
+	jsonData, migrations, err := migrateSettings(instanceSettings.JSONData, settingsMigrations)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) > 0 {
+		log.DefaultLogger.Info("Migrated datasource settings",
+			"datasource", instanceSettings.UID,
+			"schemaVersion", len(settingsMigrations),
+			"migrations", strings.Join(migrations, "; "),
+		)
+	}
 	var dsSettings ArcDataSourceSettings
-	if err := json.Unmarshal(instanceSettings.JSONData, &dsSettings); err != nil {
+	if err := json.Unmarshal(jsonData, &dsSettings); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal settings: %w", err)
 	}
 
-	if err := validateURL(dsSettings.URL); err != nil {
+	if err := validateArcURL(dsSettings.URL); err != nil {
 		return nil, err
 	}
 
-	apiKey := strings.TrimSpace(instanceSettings.DecryptedSecureJSONData["apiKey"])
-	if apiKey == "" {
-		return nil, errors.New("API key is required")
+	// With requireAuth off, a missing key means an Arc without
+	// authentication (dev, air-gapped): requests go without an
+	// Authorization header, and an Arc that does want one answers 401,
+	// which CheckHealth reports as such. An empty stored key is then taken
+	// for a cleared one rather than an undecryptable one.
+	requireAuth := dsSettings.RequireAuth == nil || *dsSettings.RequireAuth
+	rawKey, stored := instanceSettings.DecryptedSecureJSONData["apiKey"]
+	if stored && rawKey == "" && requireAuth {
+		return nil, errAPIKeyUndecryptable
+	}
+	apiKey := strings.TrimSpace(rawKey)
+	if apiKey == "" && requireAuth {
+		return nil, errors.New("API key is required (turn off Require Auth for an Arc without authentication)")
+	}
+	if err := validateHeaderValue("API key", apiKey); err != nil {
+		return nil, err
+	}
+	authHeaderName, authHeaderPrefix, err := resolveAuthHeader(dsSettings.AuthHeaderName, dsSettings.AuthHeaderPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateHeaderValue("serviceIdentity", dsSettings.ServiceIdentity); err != nil {
+		return nil, err
+	}
+	credentials, err := parseCredentials(instanceSettings.DecryptedSecureJSONData["credentials"])
+	if err != nil {
+		return nil, err
 	}
 
 	if dsSettings.Timeout == 0 {
@@ -210,6 +592,16 @@ func newArcInstance(_ context.Context, instanceSettings backend.DataSourceInstan
 	if dsSettings.MaxConcurrency > MaxConcurrencyCap {
 		dsSettings.MaxConcurrency = MaxConcurrencyCap
 	}
+	// A split needs two chunks; past the cap a chunk grid is cheaper to
+	// count than to send.
+	switch {
+	case dsSettings.MaxSplitChunks == 0:
+		dsSettings.MaxSplitChunks = DefaultMaxSplitChunks
+	case dsSettings.MaxSplitChunks < 2:
+		dsSettings.MaxSplitChunks = 2
+	case dsSettings.MaxSplitChunks > MaxSplitChunksCap:
+		dsSettings.MaxSplitChunks = MaxSplitChunksCap
+	}
 	// Per-response size cap (R2-CR7). 256 MiB (the original hardcoded value)
 	// was too low for 6M+ row analytical queries — Arc reports "Arrow IPC
 	// stream truncated after headers committed" because the plugin closes the
@@ -222,16 +614,102 @@ func newArcInstance(_ context.Context, instanceSettings backend.DataSourceInstan
 	if dsSettings.MaxResponseMB > MaxResponseMBCap {
 		dsSettings.MaxResponseMB = MaxResponseMBCap
 	}
-	if dsSettings.UseArrow == nil {
-		t := true
-		dsSettings.UseArrow = &t
+	if dsSettings.ArcVersion != "" {
+		if _, err := parseArcVersion(dsSettings.ArcVersion); err != nil {
+			return nil, err
+		}
+	}
+	fixtures, err := newFixtureStore(dsSettings.FixtureMode, dsSettings.FixtureRecord)
+	if err != nil {
+		return nil, err
+	}
+	chunkCacheHorizon, err := parseChunkCacheHorizon(dsSettings.ChunkCacheHorizon)
+	if err != nil {
+		return nil, err
+	}
+	if dsSettings.ChunkCacheMB > ChunkCacheMBCap {
+		dsSettings.ChunkCacheMB = ChunkCacheMBCap
+	}
+	if err := validateSnippets(dsSettings.Snippets, dsSettings.ForwardUserIdentity); err != nil {
+		return nil, err
+	}
+	restrictions, err := parseRoleRestrictions(dsSettings.RoleRestrictions)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAttributionTemplate(dsSettings.AttributionTemplate); err != nil {
+		return nil, err
+	}
+	if err := validateNormalizeUnicode(dsSettings.NormalizeUnicode); err != nil {
+		return nil, err
+	}
+	retryStatusCodes, err := resolveRetryStatusCodes(dsSettings.RetryStatusCodes)
+	if err != nil {
+		return nil, err
+	}
+	redactColumns, redactPredicateRe, err := parseRedactColumns(dsSettings.RedactColumns)
+	if err != nil {
+		return nil, err
+	}
+	slowThreshold, err := parseSlowQueryThreshold(dsSettings.SlowQueryThreshold)
+	if err != nil {
+		return nil, err
+	}
+	queryTimeout, err := parseQueryTimeout(dsSettings.QueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	catalogCacheTTL, err := parseCatalogCacheTTL(dsSettings.CatalogCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	queryDefaults, err := parseQueryDefaults(dsSettings.QueryDefaults)
+	if err != nil {
+		return nil, err
+	}
+	if dsSettings.AdhocTable != "" {
+		if err := validateCatalogTable(dsSettings.AdhocTable); err != nil {
+			return nil, fmt.Errorf("invalid adhocTable: %w", err)
+		}
 	}
 
 	inst := &ArcInstanceSettings{
-		settings:         dsSettings,
-		apiKey:           apiKey,
-		sem:              semaphore.NewWeighted(int64(dsSettings.MaxConcurrency)),
-		maxResponseBytes: int64(dsSettings.MaxResponseMB) * 1024 * 1024,
+		settings:          dsSettings,
+		apiKey:            apiKey,
+		sem:               semaphore.NewWeighted(int64(dsSettings.MaxConcurrency)),
+		maxResponseBytes:  int64(dsSettings.MaxResponseMB) * 1024 * 1024,
+		streamIdleTimeout: streamIdleTimeoutFor(time.Duration(dsSettings.Timeout) * time.Second),
+		schemaCache:       newSchemaCache(DefaultSchemaCacheTTL),
+		versionCache:      &arcVersionCache{},
+		protocolCache:     &protocolCache{},
+		fixtures:          fixtures,
+		chunkCacheHorizon: chunkCacheHorizon,
+		restrictions:      restrictions,
+		policy:            dataPolicy{strict: dsSettings.StrictMode},
+		databaseList:      &databaseList{},
+		captures:          newCaptureStore(dsSettings.CaptureFailures, instanceSettings.UID),
+		arrowAlloc:        memory.DefaultAllocator,
+		retryStatusCodes:  retryStatusCodes,
+		maxRetries:        resolveMaxRetries(dsSettings.MaxRetries),
+		retryBackoff:      defaultRetryBackoff,
+		maxCellBytes:      resolveMaxCellBytes(dsSettings.MaxCellBytes),
+		timeColumns:       parseTimeColumnNames(dsSettings.TimeColumnNames),
+		exploreMaxRows:    resolveExploreMaxRows(dsSettings.ExploreMaxRows),
+		redactColumns:     redactColumns,
+		redactPredicateRe: redactPredicateRe,
+		slowThreshold:     slowThreshold,
+		slowPlans:         newPlanStore(dsSettings.CaptureSlowQueryPlans && slowThreshold > 0),
+		migrations:        migrations,
+		credentials:       credentials,
+		authHeaderName:    authHeaderName,
+		authHeaderPrefix:  authHeaderPrefix,
+		queryTimeout:      queryTimeout,
+		inflight:          newInflightQueries(),
+		catalog:           newCatalogCache(catalogCacheTTL),
+		queryDefaults:     queryDefaults,
+	}
+	if dsSettings.ChunkCacheMB > 0 {
+		inst.chunkCache = newChunkCache(int64(dsSettings.ChunkCacheMB) * 1024 * 1024)
 	}
 	// SSRF dial policy is two-axis (gemini 3244943519): a loopback URL only
 	// unlocks loopback IPs (so a 302 redirect to `10.0.0.5` is still
@@ -240,10 +718,15 @@ func newArcInstance(_ context.Context, instanceSettings backend.DataSourceInstan
 		allowLoopback: isLoopbackURL(dsSettings.URL),
 		allowPrivate:  dsSettings.AllowPrivateIPs,
 	}
-	inst.client = newHTTPClient(
-		time.Duration(dsSettings.Timeout)*time.Second,
-		policy,
-	)
+	clientOpts, err := instanceSettings.HTTPClientOptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP client options: %w", err)
+	}
+	inst.client, err = newHTTPClient(clientOpts, time.Duration(dsSettings.Timeout)*time.Second, policy, authHeaderName)
+	if err != nil {
+		return nil, err
+	}
+	inst.logStartupBench(instanceSettings.UID)
 	return inst, nil
 }
 
@@ -270,20 +753,41 @@ func (d *ArcDatasource) getInstance(ctx context.Context, pluginCtx backend.Plugi
 // query fails only that query, not the whole batch (C1).
 //
 // The errgroup is wired with ctx (R2-HI4 / gemini 3244629509): when Grafana
-// cancels the parent QueryDataRequest, the dispatch loop notices via
-// gctx.Done() and stops spawning new refId goroutines rather than queueing
-// MaxConcurrency more HTTP round-trips behind the SetLimit gate.
+// cancels the parent QueryDataRequest, refIds still waiting for a slot
+// answer with a cancellation error instead of queueing more HTTP
+// round-trips behind the SetLimit gate. Every refId gets a response either
+// way, and one refId's failure never touches the others.
+// Each refId then runs under its own context (runQuery), which queryTimeout
+// and a newer run of the same panel query can cancel.
 func (d *ArcDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	response := backend.NewQueryDataResponse()
 
 	settings, err := d.getInstance(ctx, req.PluginContext)
+	if errors.Is(err, errAPIKeyUndecryptable) {
+		// Answer every panel with the fix rather than failing the request,
+		// which Grafana shows as a generic plugin error.
+		for _, q := range req.Queries {
+			response.Responses[q.RefID] = backend.ErrDataResponse(backend.StatusUnauthorized, err.Error())
+		}
+		return response, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if len(req.Queries) <= 1 {
-		for _, q := range req.Queries {
-			response.Responses[q.RefID] = d.queryWithRecover(ctx, settings, q)
+	ctx = withRequestUser(ctx, req.PluginContext.User)
+	ctx = withRequestOrigin(ctx, req)
+	ctx = withOAuthToken(ctx, req.GetHTTPHeaders())
+
+	queries, rejected := normalizeRefIDs(req.Queries)
+	for refID, res := range rejected {
+		response.Responses[refID] = res
+	}
+
+	if len(queries) <= 1 {
+		for _, q := range queries {
+			qctx := withRequestClass(ctx, classForQuery(q))
+			response.Responses[q.RefID] = d.runQuery(qctx, settings, q)
 		}
 		return response, nil
 	}
@@ -291,16 +795,17 @@ func (d *ArcDatasource) QueryData(ctx context.Context, req *backend.QueryDataReq
 	var mu sync.Mutex
 	g, gctx := errgroup.WithContext(ctx)
 	g.SetLimit(settings.settings.MaxConcurrency)
-	for _, q := range req.Queries {
-		select {
-		case <-gctx.Done():
-			// Parent cancelled — stop dispatching, fall through to Wait so
-			// already-running refIds get to write their responses.
-		default:
-		}
+	for _, q := range queries {
 		q := q
 		g.Go(func() error {
-			res := d.queryWithRecover(gctx, settings, q)
+			// A refId still queued behind the limit when the request is
+			// cancelled answers without going to Arc.
+			var res backend.DataResponse
+			if err := gctx.Err(); err != nil {
+				res = backend.ErrDataResponse(backend.StatusTimeout, "Query cancelled before it ran: "+err.Error())
+			} else {
+				res = d.runQuery(withRequestClass(gctx, classForQuery(q)), settings, q)
+			}
 			mu.Lock()
 			response.Responses[q.RefID] = res
 			mu.Unlock()
@@ -313,6 +818,61 @@ func (d *ArcDatasource) QueryData(ctx context.Context, req *backend.QueryDataReq
 	return response, nil
 }
 
+// normalizeRefIDs makes every query in a request addressable by a unique
+// refId before dispatch. Responses are keyed by refId, so without this a
+// provisioned dashboard with two "A" queries lost one result to a map
+// overwrite and a query with an empty refId answered under "" where no
+// panel looks. Empty refIds get a synthetic one (missingRefID) and run
+// normally. For a repeated refId the first occurrence runs and each later
+// one is not executed: it answers with an explanatory error under a
+// suffixed key ("A#2") so the problem is visible in the query inspector
+// instead of one result silently vanishing. Running the duplicate under
+// the suffixed key wouldn't help — no panel query would match it.
+func normalizeRefIDs(queries []backend.DataQuery) ([]backend.DataQuery, map[string]backend.DataResponse) {
+	taken := make(map[string]bool, len(queries))
+	for _, q := range queries {
+		taken[q.RefID] = true
+	}
+	unique := func(base string, n int) string {
+		for ; ; n++ {
+			if id := fmt.Sprintf("%s%d", base, n); !taken[id] {
+				taken[id] = true
+				return id
+			}
+		}
+	}
+
+	out := make([]backend.DataQuery, 0, len(queries))
+	var rejected map[string]backend.DataResponse
+	seen := make(map[string]int, len(queries))
+	for i, q := range queries {
+		if q.RefID == "" {
+			q.RefID = unique(missingRefID, i+1)
+			log.DefaultLogger.Warn("query without refId; assigned a synthetic one", "index", i, "refId", q.RefID)
+			out = append(out, q)
+			continue
+		}
+		seen[q.RefID]++
+		if n := seen[q.RefID]; n > 1 {
+			key := unique(q.RefID+"#", n)
+			log.DefaultLogger.Warn("duplicate refId; later query not executed", "refId", q.RefID, "index", i, "responseKey", key)
+			if rejected == nil {
+				rejected = make(map[string]backend.DataResponse)
+			}
+			rejected[key] = backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf(
+				"Duplicate refId %q: query %d was not executed because an earlier query in the same request uses that refId. Give each query a unique refId.",
+				q.RefID, i+1))
+			continue
+		}
+		out = append(out, q)
+	}
+	return out, rejected
+}
+
+// missingRefID prefixes the synthetic refId normalizeRefIDs assigns to a
+// query sent without one; the query's 1-based position is appended.
+const missingRefID = "_missing_refid_"
+
 // queryWithRecover wraps d.query in a recover so a panic in one refId fails
 // only that refId rather than the entire batch. The full panic value plus
 // stack is logged; the user-facing error is sanitized.
@@ -330,30 +890,106 @@ func (d *ArcDatasource) queryWithRecover(ctx context.Context, settings *ArcInsta
 	return d.query(ctx, settings, q)
 }
 
-// autoSplitDuration picks a split chunk size based on the query time range.
+// autoSplitStep is one rung of the auto split ladder: a range shorter than
+// Under is split into Chunk-sized pieces (Chunk 0 = no split). The last rung
+// has Under 0 and takes every longer range.
+type autoSplitStep struct {
+	Under time.Duration
+	Chunk time.Duration
+}
+
+// autoSplitLadder sizes auto split chunks by the query time range:
 //   - < 3h  → no split (overhead not worth it)
 //   - 3h–24h → 1h
 //   - 1d–7d  → 6h
 //   - 7d–30d → 1d
 //   - > 30d  → 7d
-func autoSplitDuration(tr backend.TimeRange) (time.Duration, bool) {
+var autoSplitLadder = []autoSplitStep{
+	{Under: 3 * time.Hour, Chunk: 0},
+	{Under: 24 * time.Hour, Chunk: time.Hour},
+	{Under: 7 * 24 * time.Hour, Chunk: 6 * time.Hour},
+	{Under: 30 * 24 * time.Hour, Chunk: 24 * time.Hour},
+	{Under: 0, Chunk: 7 * 24 * time.Hour},
+}
+
+// autoSplitRung returns the rung of autoSplitLadder a range falls on.
+func autoSplitRung(tr backend.TimeRange) autoSplitStep {
 	span := tr.To.Sub(tr.From)
-	switch {
-	case span < 3*time.Hour:
+	for _, step := range autoSplitLadder[:len(autoSplitLadder)-1] {
+		if span < step.Under {
+			return step
+		}
+	}
+	return autoSplitLadder[len(autoSplitLadder)-1]
+}
+
+// autoSplitDuration picks a split chunk size based on the query time range
+// (see autoSplitLadder). Like an explicit size, it is grown past
+// maxSplitChunks where the split is made (see capChunkSize).
+func autoSplitDuration(tr backend.TimeRange) (time.Duration, bool) {
+	step := autoSplitRung(tr)
+	if step.Chunk == 0 {
 		return 0, false
-	case span < 24*time.Hour:
-		return time.Hour, true
-	case span < 7*24*time.Hour:
-		return 6 * time.Hour, true
-	case span < 30*24*time.Hour:
-		return 24 * time.Hour, true
-	default:
-		return 7 * 24 * time.Hour, true
 	}
+	return step.Chunk, true
+}
+
+// DefaultMaxSplitChunks is the chunk count a split query stays within when
+// the datasource doesn't set maxSplitChunks: a 1h split of a two-year range
+// would otherwise send Arc 17,000 requests.
+const DefaultMaxSplitChunks = 100
+
+// capChunkSize returns the smallest multiple of chunkSize whose grid
+// (aligned to origin, see splitTimeRangeFrom) cuts [from, to) into at most
+// maxChunks chunks; maxChunks below 2 leaves chunkSize as it is. Every
+// boundary of a multiple's grid is on chunkSize's, so the $__timeGroup
+// buckets that never crossed a chunk boundary still don't.
+func capChunkSize(from, to time.Time, chunkSize time.Duration, origin time.Time, maxChunks int) time.Duration {
+	if maxChunks < 2 || chunkSize < time.Second || countChunks(from, to, chunkSize, origin) <= maxChunks {
+		return chunkSize
+	}
+	// n chunks of size c cover at least (n-2)·c and at most n·c of the
+	// range, which bounds the multiple from below; counting from there
+	// finds the smallest that fits.
+	// A zone-aligned size only grows to sizes that stay zone-aligned, so
+	// the chunks keep meeting the local-day buckets.
+	zoned := arcclient.ZoneAligned(chunkSize, origin)
+	span := to.Sub(from)
+	k := max(1, int64(span/(chunkSize*time.Duration(maxChunks))))
+	for (zoned && !arcclient.ZoneAligned(time.Duration(k)*chunkSize, origin)) ||
+		countChunks(from, to, time.Duration(k)*chunkSize, origin) > maxChunks {
+		k++
+	}
+	return time.Duration(k) * chunkSize
 }
 
-// parseSplitDuration converts a split duration string to time.Duration.
-// "auto" or "" uses autoSplitDuration; "off" disables splitting.
+// countChunks is len(splitTimeRangeFrom(from, to, chunkSize, origin, 0)),
+// without building the chunks.
+func countChunks(from, to time.Time, chunkSize time.Duration, origin time.Time) int {
+	if bounds, ok := zoneBoundaries(from, to, chunkSize, origin); ok {
+		return len(bounds) + 1
+	}
+	chunkSecs := int64(chunkSize.Seconds())
+	if chunkSecs <= 0 {
+		return 1
+	}
+	offset := originOffset(origin, chunkSecs)
+	firstEnd := time.Unix(((from.Unix()-offset)/chunkSecs+1)*chunkSecs+offset, 0)
+	if !firstEnd.Before(to) {
+		return 1
+	}
+	rest := to.Sub(firstEnd)
+	return 1 + int((rest+chunkSize-1)/chunkSize)
+}
+
+// minSplitDuration is the smallest explicit splitDuration: finer chunks
+// cost more in per-request overhead than they save.
+const minSplitDuration = 5 * time.Minute
+
+// parseSplitDuration converts a split duration string to the requested
+// chunk size, before maxSplitChunks grows it (see capChunkSize). "auto" or
+// "" uses autoSplitDuration; "off" disables splitting, as does a value
+// splitDurationValue rejects.
 func parseSplitDuration(s string, tr backend.TimeRange) (time.Duration, bool) {
 	if s == "off" {
 		return 0, false
@@ -361,32 +997,90 @@ func parseSplitDuration(s string, tr backend.TimeRange) (time.Duration, bool) {
 	if s == "" || s == "auto" {
 		return autoSplitDuration(tr)
 	}
-
-	switch s {
-	case "1h":
-		return time.Hour, true
-	case "6h":
-		return 6 * time.Hour, true
-	case "12h":
-		return 12 * time.Hour, true
-	case "1d":
-		return 24 * time.Hour, true
-	case "3d":
-		return 3 * 24 * time.Hour, true
-	case "7d":
-		return 7 * 24 * time.Hour, true
-	default:
+	chunk, err := splitDurationValue(s)
+	if err != nil {
 		return 0, false
 	}
+	return chunk, true
+}
+
+// splitDurationValue parses an explicit splitDuration: a Go duration
+// ("30m", "2h", "12h30m") or one with day and week units ("1d", "14d",
+// "2w", see arcclient.IntervalDuration), of at least minSplitDuration.
+func splitDurationValue(s string) (time.Duration, error) {
+	chunk, err := time.ParseDuration(s)
+	if err != nil {
+		var ok bool
+		if chunk, ok = arcclient.IntervalDuration(s); !ok {
+			return 0, fmt.Errorf("unknown splitDuration %q: use auto, off or a duration such as 30m, 2h, 12h30m or 14d", s)
+		}
+	}
+	if chunk < minSplitDuration {
+		return 0, fmt.Errorf("splitDuration %q is below the %s minimum", s, formatSpan(minSplitDuration))
+	}
+	return chunk, nil
+}
+
+// splitDurationProblem is why splitDurationValue rejects setting, nil for
+// a usable value or a keyword ("", "auto", "off").
+func splitDurationProblem(setting string) error {
+	switch setting {
+	case "", "auto", "off":
+		return nil
+	}
+	_, err := splitDurationValue(setting)
+	return err
+}
+
+// splitDurationNotice is the warning on a query whose splitDuration was
+// rejected, so it ran unsplit.
+func splitDurationNotice(err error) string {
+	return "Query not split: " + err.Error() + "."
+}
+
+// attachSplitDurationNotice adds splitDurationNotice to frames.
+func attachSplitDurationNotice(frames data.Frames, err error) {
+	for _, frame := range frames {
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: splitDurationNotice(err)})
+	}
 }
 
 // splitTimeRange divides a time range into chunks aligned to epoch boundaries.
+// See splitTimeRangeFrom for chunks aligned to a bucket origin.
 // Alignment ensures common aggregation intervals (1h, 10m, etc.) never span a
 // chunk boundary, which would produce incorrect partial aggregations.
 // Example with 6h chunks, range 14:30–02:30:
-//   [14:30, 18:00), [18:00, 00:00), [00:00, 02:30)
+//
+//	[14:30, 18:00), [18:00, 00:00), [00:00, 02:30)
+//
 // All internal boundaries land on 6h multiples from epoch.
-func splitTimeRange(from, to time.Time, chunkSize time.Duration) []backend.TimeRange {
+func splitTimeRange(from, to time.Time, chunkSize time.Duration, maxChunks int) []backend.TimeRange {
+	return splitTimeRangeFrom(from, to, chunkSize, time.Time{}, maxChunks)
+}
+
+// splitTimeRangeFrom is splitTimeRange with the chunk grid shifted to
+// origin, the query's $__timeGroup bucket origin. Chunk boundaries have to
+// move with the buckets: a Monday-aligned weekly bucket cut at an
+// epoch-aligned (Thursday) chunk boundary would be aggregated twice, once
+// per chunk, and come back as two partial rows.
+//
+// With an origin naming a zone, chunks of whole days, or of a size that
+// divides a day, follow the zone's local days the way $__timeGroup buckets
+// do (arcclient.ZoneBoundaries): a 1d chunk over a DST change is 23 or 25
+// hours, and the chunks still meet end to start.
+//
+// A range that would take more than maxChunks chunks is cut with a larger
+// multiple of chunkSize instead (capChunkSize; maxChunks 0 = no cap).
+func splitTimeRangeFrom(from, to time.Time, chunkSize time.Duration, origin time.Time, maxChunks int) []backend.TimeRange {
+	chunkSize = capChunkSize(from, to, chunkSize, origin, maxChunks)
+	if bounds, ok := zoneBoundaries(from, to, chunkSize, origin); ok {
+		chunks := make([]backend.TimeRange, 0, len(bounds)+1)
+		for _, b := range append(bounds, to) {
+			chunks = append(chunks, backend.TimeRange{From: from, To: b})
+			from = b
+		}
+		return chunks
+	}
 	// Truncates to whole seconds — sub-second chunk sizes are not supported,
 	// but all valid split durations (1h, 6h, 1d, etc.) are well above that.
 	chunkSecs := int64(chunkSize.Seconds())
@@ -394,9 +1088,10 @@ func splitTimeRange(from, to time.Time, chunkSize time.Duration) []backend.TimeR
 		return []backend.TimeRange{{From: from, To: to}}
 	}
 
-	// Find the next epoch-aligned boundary after 'from'
-	fromEpoch := from.Unix()
-	nextBoundary := ((fromEpoch / chunkSecs) + 1) * chunkSecs
+	// Find the next origin-aligned boundary after 'from'
+	offset := originOffset(origin, chunkSecs)
+	fromEpoch := from.Unix() - offset
+	nextBoundary := ((fromEpoch/chunkSecs)+1)*chunkSecs + offset
 	firstEnd := time.Unix(nextBoundary, 0).UTC()
 
 	// If the entire range fits before the first boundary, no splitting needed
@@ -428,199 +1123,493 @@ func splitTimeRange(from, to time.Time, chunkSize time.Duration) []backend.TimeR
 	return chunks
 }
 
+// errDatabaseOverrideDisabled is returned by withDatabaseOverride when a
+// query names a different database but the admin hasn't enabled overrides.
+// The message is user-facing as-is.
+var errDatabaseOverrideDisabled = errors.New("per-query database override is not enabled — toggle 'Allow Database Override' in datasource settings")
+
+// withDatabaseOverride returns the settings to use for a request that names
+// `database` (R2-HI6 — confused-deputy guard): permitted only when the admin
+// has opted in via AllowDatabaseOverride. Otherwise a dashboard editor could
+// switch databases on a datasource the admin configured for a single tenant.
+// The shallow-copy preserves the cached *http.Client and apiKey while
+// scoping the change to this one request. An empty or unchanged database
+// returns the receiver.
+func (s *ArcInstanceSettings) withDatabaseOverride(refID, database string) (*ArcInstanceSettings, error) {
+	if database == "" || database == s.settings.Database {
+		return s, nil
+	}
+	if !s.settings.AllowDatabaseOverride {
+		log.DefaultLogger.Warn("per-query database override rejected — not enabled in datasource settings",
+			"refId", refID, "requested", database, "configured", s.settings.Database)
+		return nil, &blockedQueryError{
+			policy:    policyDatabaseOverride,
+			offending: "database: " + database,
+			hint:      "Remove the query's database to use " + s.settings.Database + ", or ask an admin to enable 'Allow Database Override' in the datasource settings.",
+			err:       errDatabaseOverrideDisabled,
+		}
+	}
+	if err := validateDatabaseName(database); err != nil {
+		return nil, err
+	}
+	overridden := *s
+	overridden.settings.Database = database
+	return &overridden, nil
+}
+
 // executeChunk runs a single query chunk against Arc
-func (d *ArcDatasource) executeChunk(ctx context.Context, settings *ArcInstanceSettings, rawSQL string, chunk backend.TimeRange, originalRange backend.TimeRange) (*data.Frame, error) {
+func (d *ArcDatasource) executeChunk(ctx context.Context, settings *ArcInstanceSettings, rawSQL string, chunk backend.TimeRange, query backend.DataQuery, bucketOrigin time.Time) (*data.Frame, error) {
 	// Apply macros with the chunk's time range for time filtering,
-	// but keep the original range for $__interval calculation
-	sql := ApplyMacrosWithSplit(rawSQL, chunk, originalRange)
+	// but keep the query's range and interval for $__interval
+	sql := applyMacrosWith(rawSQL, chunk, query, bucketOrigin)
 
-	if *settings.settings.UseArrow {
-		return queryArrow(ctx, settings, sql)
+	frames, err := settings.queryFrames(ctx, attributed(ctx, sql))
+	if err != nil {
+		return nil, err
+	}
+	// Chunks are merged positionally into one frame, which can't represent
+	// several result sets. The split heuristics skip multi-statement SQL, so
+	// this only fires when Arc splits statements we couldn't see.
+	if len(frames) != 1 {
+		return nil, fmt.Errorf("%w: chunk returned %d result sets", errMultiResultSplit, len(frames))
+	}
+	if frames[0] == nil {
+		return nil, errNoFrame
 	}
-	return queryJSON(ctx, settings, sql)
+	return frames[0], nil
 }
 
-// frameSchemaCompatible returns true when `f` can be safely appended into
-// `merged`: same field count AND same field type per slot. The previous
-// check only compared counts, so a JSON-inference flip (chunk A typed col 2
-// as float64, chunk B typed it as string) silently passed the gate and
-// panicked inside the SDK's reflective Set (R2-HI2). The mismatch is now
-// reported via log and the chunk is skipped.
-func frameSchemaCompatible(merged, f *data.Frame) bool {
-	if f == nil || len(f.Fields) != len(merged.Fields) {
-		return false
+// errMultiResultSplit is returned when a split query's chunk comes back
+// with several result sets. The message is user-facing.
+var errMultiResultSplit = errors.New("queries returning multiple result sets can't be split; set Splitting to Off")
+
+// chunkFieldMap maps the fields of a merged frame to those of chunk f: for
+// each of fields, the index of f's field with the same name, or at the same
+// position when the name is empty. Arc doesn't keep the column order of a
+// hash aggregation stable across chunks, so positions alone put values in
+// the wrong columns. The first `required` fields are the base chunk's and
+// f must have each of them with the same type (a JSON-inference flip from
+// float64 to string would otherwise panic inside the SDK's reflective Set,
+// R2-HI2); problem says which one it lacks otherwise. The fields after them
+// were added by earlier chunks and map to -1, null, when f lacks them.
+// extra lists f's fields that aren't in fields.
+func chunkFieldMap(fields []*data.Field, required int, f *data.Frame) (src, extra []int, problem string) {
+	if f == nil || len(f.Fields) == 0 {
+		return nil, nil, "no columns"
+	}
+	byName := make(map[string][]int, len(f.Fields))
+	for i, field := range f.Fields {
+		if field.Name != "" {
+			byName[field.Name] = append(byName[field.Name], i)
+		}
+	}
+	used := make([]bool, len(f.Fields))
+	src = make([]int, len(fields))
+	for j, dst := range fields {
+		idx := -1
+		if dst.Name == "" {
+			if j < len(f.Fields) && f.Fields[j].Name == "" {
+				idx = j
+			}
+		} else if same := byName[dst.Name]; len(same) > 0 {
+			idx, byName[dst.Name] = same[0], same[1:]
+		}
+		switch {
+		case idx < 0 && j < required:
+			return nil, nil, fmt.Sprintf("missing column %q", dst.Name)
+		case idx < 0:
+			src[j] = -1
+			continue
+		case f.Fields[idx].Type() != dst.Type() && (j < required || f.Fields[idx].Type().NullableType() != dst.Type()):
+			return nil, nil, fmt.Sprintf("column %q is %s, want %s", dst.Name, f.Fields[idx].Type(), dst.Type())
+		}
+		src[j], used[idx] = idx, true
 	}
-	for i, dst := range merged.Fields {
-		if f.Fields[i].Type() != dst.Type() {
-			return false
+	for i := range f.Fields {
+		if !used[i] {
+			extra = append(extra, i)
 		}
 	}
-	return true
+	return src, extra, ""
 }
 
-// mergeFrames appends rows from all chunk frames into a single frame.
-// Skips frames with incompatible schemas (different field count OR different
-// field types per slot — R2-HI2) and logs the skip so the operator can see
-// the result is partial.
+// mergeFrames appends rows from all chunk frames into a single frame,
+// matching columns by name (see chunkFieldMap). A chunk without one of the
+// first chunk's columns, or with a different type for one, is skipped and
+// logged so the operator can see the result is partial. A column that first
+// appears in a later chunk is added as a nullable field, null in the rows
+// of the chunks without it.
 // Pre-allocates capacity to avoid O(n²) re-allocation from row-by-row appends.
 func mergeFrames(frames []*data.Frame) *data.Frame {
+	merged, _ := mergeFramesSkipping(frames)
+	return merged
+}
+
+// mergeFramesSkipping is mergeFrames that also reports how many frames it
+// left out for an incompatible schema.
+func mergeFramesSkipping(frames []*data.Frame) (*data.Frame, int) {
 	if len(frames) == 0 {
-		return nil
+		return nil, 0
 	}
 	if len(frames) == 1 {
-		return frames[0]
+		return frames[0], 0
 	}
+	reconcileUint64Text(frames)
 
-	// Find the first non-empty frame to use as the base
+	// Find the first frame with rows to use as the base, else the first
+	// with columns: an empty JSON chunk without declared types has every
+	// column as a string, and as the base it would turn away the chunks
+	// that do have values.
 	var merged *data.Frame
 	var startIdx int
 	for i, f := range frames {
-		if f != nil && len(f.Fields) > 0 {
+		if f != nil && len(f.Fields) > 0 && (merged == nil || f.Rows() > 0) {
 			merged = f
 			startIdx = i + 1
-			break
+			if f.Rows() > 0 {
+				break
+			}
 		}
 	}
 	if merged == nil {
-		return frames[0]
-	}
-
-	skipped := 0
-
-	// Count total rows to add so we can pre-allocate.
-	additionalRows := 0
-	for _, f := range frames[startIdx:] {
-		if !frameSchemaCompatible(merged, f) {
-			if f != nil {
-				skipped++
-			}
+		return frames[0], 0
+	}
+
+	// Map every chunk onto the merged columns, planning the columns later
+	// chunks add, and count the rows to add so we can pre-allocate.
+	required := len(merged.Fields)
+	fields := append([]*data.Field(nil), merged.Fields...)
+	maps := make([][]int, len(frames))
+	skipped, additionalRows := 0, 0
+	for i, f := range frames[startIdx:] {
+		if f == nil || len(f.Fields) > 0 && f.Rows() == 0 {
+			continue // nothing to add, and its columns may be typed differently
+		}
+		src, extra, problem := chunkFieldMap(fields, required, f)
+		if problem != "" {
+			skipped++
+			log.DefaultLogger.Warn("mergeFrames skipped a chunk with an incompatible schema", "chunk", startIdx+i, "problem", problem)
 			continue
 		}
 		rowLen, err := f.RowLen()
 		if err != nil {
 			continue
 		}
+		for _, idx := range extra {
+			added := data.NewFieldFromFieldType(f.Fields[idx].Type().NullableType(), 0)
+			added.Name, added.Labels, added.Config = f.Fields[idx].Name, f.Fields[idx].Labels, f.Fields[idx].Config
+			fields = append(fields, added)
+			src = append(src, idx)
+			log.DefaultLogger.Debug("mergeFrames added a column a later chunk returned", "chunk", startIdx+i, "column", added.Name)
+		}
+		maps[startIdx+i] = src
 		additionalRows += rowLen
 	}
 
-	if skipped > 0 {
-		log.DefaultLogger.Warn("mergeFrames skipped chunks with incompatible schema",
-			"skipped", skipped, "kept", len(frames)-skipped)
-	}
-
-	if additionalRows == 0 {
-		return merged
+	if additionalRows == 0 && len(fields) == required {
+		return merged, skipped
 	}
 
-	// Pre-extend all fields to avoid repeated re-allocation.
+	// Pre-extend all fields to avoid repeated re-allocation; added columns
+	// start all null.
 	baseRows := merged.Rows()
-	for _, field := range merged.Fields {
-		field.Extend(additionalRows)
+	for _, field := range fields {
+		field.Extend(baseRows + additionalRows - field.Len())
 	}
+	merged.Fields = fields
 
 	// Copy data using Set (single allocation, no per-row realloc).
 	writeIdx := baseRows
-	for _, f := range frames[startIdx:] {
-		if !frameSchemaCompatible(merged, f) {
-			continue
-		}
-		rowLen, err := f.RowLen()
-		if err != nil {
+	for fi, f := range frames {
+		src := maps[fi]
+		if src == nil {
 			continue
 		}
+		rowLen, _ := f.RowLen()
 		for i := 0; i < rowLen; i++ {
-			for fieldIdx := 0; fieldIdx < len(merged.Fields); fieldIdx++ {
-				merged.Fields[fieldIdx].Set(writeIdx, f.Fields[fieldIdx].CopyAt(i))
+			for fieldIdx, idx := range src {
+				if idx < 0 {
+					continue
+				}
+				if dst := fields[fieldIdx]; dst.Type() == f.Fields[idx].Type() {
+					dst.Set(writeIdx, f.Fields[idx].CopyAt(i))
+				} else {
+					dst.SetConcrete(writeIdx, f.Fields[idx].CopyAt(i))
+				}
 			}
 			writeIdx++
 		}
 	}
-	return merged
+	return merged, skipped
 }
 
 // query executes a single query, with optional time-range splitting for large ranges
-func (d *ArcDatasource) query(ctx context.Context, settings *ArcInstanceSettings, query backend.DataQuery) backend.DataResponse {
-	var response backend.DataResponse
-
+func (d *ArcDatasource) query(ctx context.Context, settings *ArcInstanceSettings, query backend.DataQuery) (response backend.DataResponse) {
 	var qm ArcQuery
-	if err := json.Unmarshal(query.JSON, &qm); err != nil {
+	raw, applied, err := mergeQueryDefaults(query.JSON, settings.queryDefaults)
+	if err == nil {
+		err = json.Unmarshal(raw, &qm)
+	}
+	if err != nil {
 		// Sanitize: raw json error can include byte offsets and snippets of
 		// the user-supplied JSON (R2-HI3).
 		return backend.ErrDataResponse(backend.StatusBadRequest, sanitizeUserError(query.RefID, err))
 	}
 
 	qm.RefID = query.RefID
+	if isVariableQuery(query, qm) {
+		qm = variableDefaults(qm)
+	} else if qm = exploreDefaults(ctx, qm); qm.fromExplore() {
+		ctx = withExplore(ctx)
+	}
+
+	// Choices made on the query's behalf are shown in the frame meta.
+	ctx, decisions := withDecisionRecorder(ctx)
+	defer func() { decisions.attach(response.Frames) }()
+	if qm.VariableQuery {
+		// Runs after the other deferred steps have annotated the result;
+		// the variable frame keeps its meta.
+		defer func() {
+			if response.Error == nil {
+				response.Frames = variableFrames(response.Frames)
+			}
+		}()
+	}
+	recordQueryDefaults(ctx, applied)
 
 	// Migrate rawSql from Postgres/MySQL/MSSQL/ClickHouse datasources.
 	if qm.SQL == "" && qm.RawSQL != "" {
 		qm.SQL = qm.RawSQL
 	}
+	// Pasted BOMs and non-breaking spaces go before anything reads the SQL.
+	var norm normalization
+	qm.SQL, norm = normalizeSQL(qm.SQL, settings.settings.NormalizeUnicode)
+	if norm.changed() {
+		log.DefaultLogger.Debug("Normalized query characters", "refId", qm.RefID, "changes", norm.String())
+		defer func() { attachNormalizationNotice(response.Frames, norm) }()
+	}
 
-	// Per-query database override (R2-HI6 — confused-deputy guard):
-	// permitted only when the admin has opted in via AllowDatabaseOverride.
-	// Otherwise a dashboard editor could switch databases on a datasource
-	// the admin configured for a single tenant. The shallow-copy preserves
-	// the cached *http.Client and apiKey while scoping the change to this
-	// one query.
-	if qm.Database != "" && qm.Database != settings.settings.Database {
-		if !settings.settings.AllowDatabaseOverride {
-			log.DefaultLogger.Warn("per-query database override rejected — not enabled in datasource settings",
-				"refId", qm.RefID, "requested", qm.Database, "configured", settings.settings.Database)
-			return backend.ErrDataResponse(backend.StatusBadRequest,
-				"per-query database override is not enabled — toggle 'Allow Database Override' in datasource settings")
+	if err := validateSeriesCap(qm); err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+	if qm.TableLayout != "" && qm.TableLayout != tableLayoutLong && qm.TableLayout != tableLayoutWide {
+		return backend.ErrDataResponse(backend.StatusBadRequest,
+			fmt.Sprintf("invalid tableLayout %q (expected %q or %q)", qm.TableLayout, tableLayoutLong, tableLayoutWide))
+	}
+	if err := validateQueryProtocol(qm.Protocol); err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+	bucketOrigin, err := resolveBucketOrigin(qm.BucketOrigin, query.TimeRange)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+
+	overridden, err := settings.withDatabaseOverride(qm.RefID, qm.Database)
+	if err != nil {
+		if errors.Is(err, errDatabaseOverrideDisabled) {
+			return settings.explainBlocked(ctx, qm.RefID, backend.ErrDataResponse(backend.StatusBadRequest, err.Error()), err)
 		}
-		if err := validateDatabaseName(qm.Database); err != nil {
-			// Sanitize via the user-error helper rather than echoing the raw
-			// validator error (which embeds %q of the offending name) (R2-HI3).
-			return backend.ErrDataResponse(backend.StatusBadRequest, sanitizeUserError(qm.RefID, err))
+		// Sanitize via the user-error helper rather than echoing the raw
+		// error (R2-HI3); a rejected name comes back naming only the
+		// offending character (errInvalidHeaderValue).
+		return backend.ErrDataResponse(backend.StatusBadRequest, sanitizeUserError(qm.RefID, err))
+	}
+	settings = overridden
+	scoped, err := settings.withCredential(qm.RefID, qm.Credential, requestUserFrom(ctx))
+	if err != nil {
+		return settings.explainBlocked(ctx, qm.RefID, backend.ErrDataResponse(backend.StatusForbidden, err.Error()), err)
+	}
+	settings = scoped
+	if settings.credential != "" {
+		defer func() { attachCredential(response.Frames, settings.credential) }()
+	}
+	if notice := settings.missingTokenNotice(ctx); notice != nil {
+		log.DefaultLogger.Warn("OAuth pass-through: no token forwarded, using the API key", "refId", qm.RefID)
+		defer func() {
+			for _, frame := range response.Frames {
+				frame.AppendNotices(*notice)
+			}
+		}()
+	}
+	settings = settings.withQueryProtocol(qm.Protocol)
+	settings = settings.withTimeColumns(qm.TimeColumnNames)
+	// Read at the end: adaptive execution may pick the protocol, and auto
+	// may fall back to JSON mid-query.
+	defer func() {
+		if response.Error == nil {
+			attachProtocol(response.Frames, settings.protocolName(ctx))
 		}
-		overridden := *settings
-		overridden.settings.Database = qm.Database
-		settings = &overridden
+	}()
+	// Snippets expand first: every later step — restrictions, macros,
+	// splitting heuristics, ExecutedQueryString — sees the full SQL.
+	qm.SQL, err = settings.expandSnippets(qm.SQL, requestUserFrom(ctx))
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+	// So do $__in and $__quote, whose JSON arguments would otherwise look
+	// like unterminated literals to the SQL scanners below.
+	qm.SQL = arcclient.ExpandValueMacros(qm.SQL)
+	var adhocNotice *data.Notice
+	qm.SQL, adhocNotice, err = settings.applyAdhocFilters(ctx, qm.SQL, qm.AdhocFilters)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+	if adhocNotice != nil {
+		defer func() {
+			for _, frame := range response.Frames {
+				frame.AppendNotices(*adhocNotice)
+			}
+		}()
+	}
+	if err := arcclient.ValidateTimeGroups(qm.SQL); err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+	if err := settings.checkRestrictions(qm.RefID, requestUserFrom(ctx), qm.SQL); err != nil {
+		return settings.explainBlocked(ctx, qm.RefID, backend.ErrDataResponse(backend.StatusForbidden, err.Error()), err)
 	}
+	ctx = settings.withAttribution(ctx, qm.RefID)
 
 	// Check if query splitting is enabled
 	chunkSize, splitting := parseSplitDuration(qm.SplitDuration, query.TimeRange)
+	splitReason := splitSettingReason(qm.SplitDuration, query.TimeRange)
+	if err := splitDurationProblem(qm.SplitDuration); err != nil {
+		log.DefaultLogger.Warn("Ignoring splitDuration", "refId", qm.RefID, "reason", err.Error())
+		defer func() { attachSplitDurationNotice(response.Frames, err) }()
+	}
 
 	// Compute the stripped-and-uppercased view of the SQL once and reuse it
 	// across every splitting heuristic. Without this each heuristic re-ran
 	// stripStringLiterals + ToUpper independently — three full-string passes
 	// per query.
 	stripped := newStrippedSQL(qm.SQL)
+	if strings.Contains(stripped.stripped, "$__interval") {
+		recordDecision(ctx, intervalDecision(query))
+	}
+
+	// Last-value optimization: one row per series needs no splitting, row
+	// cap or estimate. A query the rewrite doesn't recognize runs in full.
+	lastValue := false
+	if qm.LastValueOptimization {
+		rewritten, err := lastValueSQL(qm.SQL, stripped)
+		if err != nil {
+			log.DefaultLogger.Debug("Last-value rewrite not applicable; running the full query",
+				"refId", qm.RefID, "reason", err.Error())
+		} else {
+			qm.SQL, stripped, splitting, lastValue = rewritten, newStrippedSQL(rewritten), false, true
+			splitReason = "last-value optimization: one row per series"
+		}
+	}
 
 	switch {
 	case splitting && !hasTimeFilterMacro(stripped):
 		// No time macros (or all commented out) → nothing to split along.
 		log.DefaultLogger.Debug("Skipping split for query without time filter", "refId", qm.RefID)
-		splitting = false
+		splitting, splitReason = false, "the query has no time filter to split along"
 	case splitting && containsLIMIT(stripped):
 		// LIMIT applies per-chunk and would return N×chunks rows.
 		log.DefaultLogger.Debug("Skipping split for query with LIMIT", "refId", qm.RefID)
-		splitting = false
+		splitting, splitReason = false, "LIMIT would apply to every chunk"
 	case splitting && containsUnion(stripped):
 		// Macro expansion in multi-statement queries produces mangled SQL.
 		log.DefaultLogger.Debug("Skipping split for UNION query", "refId", qm.RefID)
-		splitting = false
+		splitting, splitReason = false, "UNION queries are not split"
+	case splitting && containsMultipleStatements(stripped):
+		// One result set per statement; chunks merge into a single frame.
+		log.DefaultLogger.Debug("Skipping split for multi-statement query", "refId", qm.RefID)
+		splitting, splitReason = false, "multi-statement queries are not split"
 	case splitting && containsAggregationWithoutTimeGroup(stripped):
 		// Aggregations without time bucketing span the full range; each chunk
 		// aggregating independently produces wrong results (COUNT duplicated,
 		// DISTINCT inflated, bare COUNT(*) returning N rows instead of 1).
 		log.DefaultLogger.Debug("Skipping split for aggregation without $__timeGroup", "refId", qm.RefID)
-		splitting = false
+		splitting, splitReason = false, "aggregation without $__timeGroup spans the whole range"
 	}
 
-	// Auto-add ORDER BY time ASC is disabled until the substring-match bug is fixed
-	// (rewrites queries containing 'lifetime', 'runtime', 'timestamp' columns and
-	// injects ORDER BY against a column named 'time' that may not exist).
-	// Re-enable after C5 fix lands. See docs/progress/2026-05-14-signing-readiness.md.
+	// ORDER BY the resolved time column, ahead of any LIMIT added below.
+	if qm.OrderByTime && !lastValue && qm.Format != "table" && qm.Format != "numeric_table" {
+		ordered, err := orderByTimeSQL(qm.SQL, stripped)
+		if err != nil {
+			log.DefaultLogger.Debug("ORDER BY time not added", "refId", qm.RefID, "reason", err.Error())
+		} else {
+			qm.SQL, stripped = ordered, newStrippedSQL(ordered)
+		}
+	}
+
+	limit := settings.resolveRowLimit(qm, stripped, query.MaxDataPoints)
+	limitDecision := settings.rowLimitDecision(qm, stripped, query.MaxDataPoints, limit)
+	if lastValue {
+		limit = rowLimit{}
+		limitDecision.Outcome, limitDecision.Reason = "none", "last-value optimization: one row per series"
+	}
+
+	// Adaptive execution: size the result with a count(*) first and let the
+	// estimate pick protocol, splitting and row cap (see decideAdaptive). A
+	// nil plan — estimate failed or not applicable — changes nothing.
+	var plan *adaptivePlan
+	if settings.settings.AdaptiveExecution && !lastValue {
+		fullSQL := applyMacrosWith(qm.SQL, query.TimeRange, query, bucketOrigin)
+		if plan = settings.planAdaptive(ctx, qm, fullSQL, stripped, splitting, limit.Limit); plan != nil {
+			recordDecision(ctx, adaptiveDecision(plan))
+			// From here on settings carries the plan's protocol, which is
+			// also what the chunk cache keys by (see executeChunkCached).
+			settings = settings.withProtocol(plan)
+			if splitting && !plan.Split {
+				splitReason = fmt.Sprintf("adaptive execution: estimated %d rows", plan.EstimatedRows)
+			}
+			splitting = plan.Split
+			if plan.RowCap == 0 && limit.Limit > 0 {
+				limit = rowLimit{}
+				limitDecision.Outcome, limitDecision.Reason = "none", fmt.Sprintf("adaptive execution: estimated %d rows fit the cap", plan.EstimatedRows)
+			}
+		}
+	}
+	recordDecision(ctx, limitDecision)
 
 	if !splitting {
+		recordDecision(ctx, splitDecision(qm.SplitDuration, query.TimeRange, splitReason, 0, 0, 0))
 		// No splitting — execute as before
-		return d.querySingle(ctx, settings, query, qm)
+		single := d.querySingle(ctx, settings, query, qm, limit, bucketOrigin)
+		attachAdaptivePlan(single.Frames, plan)
+		if settings.settings.EnrichFieldMetadata && single.Error == nil {
+			settings.enrichFieldMetadata(ctx, single.Frames, stripped)
+		}
+		return single
+	}
+
+	// Split the time range into chunks, larger ones past maxSplitChunks.
+	maxChunks, requestedChunk := settings.settings.MaxSplitChunks, chunkSize
+	if grown := capChunkSize(query.TimeRange.From, query.TimeRange.To, chunkSize, bucketOrigin, maxChunks); grown != chunkSize {
+		wanted := countChunks(query.TimeRange.From, query.TimeRange.To, chunkSize, bucketOrigin)
+		log.DefaultLogger.Info("Split chunks grown to stay within maxSplitChunks",
+			"refId", qm.RefID, "requested", formatSpan(chunkSize), "used", formatSpan(grown),
+			"wantedChunks", wanted, "maxSplitChunks", maxChunks)
+		notice := data.Notice{Severity: data.NoticeSeverityInfo, Text: fmt.Sprintf(
+			"Split into %s chunks instead of %s: the range would take %d chunks, more than the datasource's limit of %d.",
+			formatSpan(grown), formatSpan(chunkSize), wanted, maxChunks)}
+		defer func() {
+			for _, frame := range response.Frames {
+				frame.AppendNotices(notice)
+			}
+		}()
+		chunkSize = grown
 	}
+	chunks := splitTimeRangeFrom(query.TimeRange.From, query.TimeRange.To, chunkSize, bucketOrigin, maxChunks)
 
-	// Split the time range into chunks
-	chunks := splitTimeRange(query.TimeRange.From, query.TimeRange.To, chunkSize)
+	// Each chunk gets its share of the row limit (see chunkLimit).
+	chunkSQL := qm.SQL
+	chunkCap := limit.chunkLimit(len(chunks))
+	if chunkCap > 0 {
+		chunkSQL = appendLimit(qm.SQL, chunkCap)
+	}
+	split := splitDecision(qm.SplitDuration, query.TimeRange, splitReason, len(chunks), chunkSize, settings.settings.MaxConcurrency)
+	if chunkCap > 0 {
+		split.Inputs["chunkLimit"] = chunkCap
+	}
+	if chunkSize != requestedChunk {
+		split.Inputs["requestedChunk"] = formatSpan(requestedChunk)
+		split.Inputs["maxSplitChunks"] = maxChunks
+	}
+	recordDecision(ctx, split)
 
 	log.DefaultLogger.Info("Splitting query into chunks",
 		"refId", qm.RefID,
@@ -628,6 +1617,7 @@ func (d *ArcDatasource) query(ctx context.Context, settings *ArcInstanceSettings
 		"chunks", len(chunks),
 		"from", query.TimeRange.From,
 		"to", query.TimeRange.To,
+		"protocol", settings.protocolName(ctx),
 	)
 
 	// Fan out chunks via errgroup.WithContext so the first error cancels
@@ -635,13 +1625,25 @@ func (d *ArcDatasource) query(ctx context.Context, settings *ArcInstanceSettings
 	// relying on a semaphore that blocked inside already-spawned goroutines
 	// (P8). With cancellation propagated through ctx, the per-chunk HTTP
 	// requests see context.Canceled and unwind without finishing.
+	//
+	// With allowPartialResults a chunk's error is kept in chunkErrs instead,
+	// so the siblings run to completion; only a cancelled request still
+	// fails the group.
 	frames := make([]*data.Frame, len(chunks))
+	hits := make([]bool, len(chunks))
+	chunkErrs := make([]error, len(chunks))
 	g, gctx := errgroup.WithContext(ctx)
 	g.SetLimit(settings.settings.MaxConcurrency)
 
 	for i, chunk := range chunks {
 		i, chunk := i, chunk
 		g.Go(func() (err error) {
+			// Runs last, after the recover below has turned a panic into err.
+			defer func() {
+				if err != nil && qm.AllowPartialResults && ctx.Err() == nil {
+					chunkErrs[i], err = err, nil
+				}
+			}()
 			defer func() {
 				if r := recover(); r != nil {
 					// Mirror queryWithRecover: log the full stack trace
@@ -660,39 +1662,123 @@ func (d *ArcDatasource) query(ctx context.Context, settings *ArcInstanceSettings
 						chunk.To.Format("2006-01-02 15:04"), r)
 				}
 			}()
-			frame, runErr := d.executeChunk(gctx, settings, qm.SQL, chunk, query.TimeRange)
+			frame, hit, runErr := d.executeChunkCached(gctx, settings, chunkSQL, chunk, query, bucketOrigin)
 			if runErr != nil {
 				return fmt.Errorf("[chunk %s to %s] %w",
 					chunk.From.Format("2006-01-02 15:04"),
 					chunk.To.Format("2006-01-02 15:04"), runErr)
 			}
-			frames[i] = frame
+			frames[i], hits[i] = frame, hit
 			return nil
 		})
 	}
 
 	if err := g.Wait(); err != nil {
-		return backend.ErrDataResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err))
+		return queryErrorResponse(err, qm, qm.SQL)
+	}
+	failed, partial := partialResultNotice(qm.RefID, chunks, chunkErrs)
+	if len(failed) == len(chunks) {
+		return queryErrorResponse(chunkErrs[failed[0]], qm, qm.SQL)
+	}
+	if len(failed) > 0 {
+		m := modification{Kind: modDroppedChunks, Detail: partial.Text}
+		if err := settings.policy.allow(nil, m); err != nil {
+			return errorResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err), qm, qm.SQL)
+		}
 	}
 
 	orderedFrames := make([]*data.Frame, 0, len(chunks))
+	capHit := false
 	for _, f := range frames {
 		if f != nil {
 			orderedFrames = append(orderedFrames, f)
+			capHit = capHit || (chunkCap > 0 && int64(f.Rows()) >= chunkCap)
 		}
 	}
 
-	merged := mergeFrames(orderedFrames)
+	merged, skipped := mergeFramesSkipping(orderedFrames)
+	if skipped > 0 {
+		m := modification{Kind: modDroppedChunks, Detail: fmt.Sprintf("%d of %d chunks returned a different schema and were left out", skipped, len(orderedFrames))}
+		if err := settings.policy.allow(nil, m); err != nil {
+			return errorResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err), qm, qm.SQL)
+		}
+	}
 	if merged == nil {
-		log.DefaultLogger.Warn("No data from split query", "refId", qm.RefID)
-		return response
+		return noDataResponse(qm, qm.SQL, "no chunk of the split query returned a frame")
+	}
+	merged, duplicates := orderMergedRows(merged, qm)
+	if !limit.budget() && limit.Limit > 0 && int64(merged.Rows()) > limit.Limit {
+		truncateRows(merged, limit.Limit)
+		capHit = true
 	}
 
+	// The chunks' own Meta goes with the merge; keep their stats by summing
+	// the time Arc spent on, and the retries taken by, the chunks this
+	// request actually ran.
+	var executionTime, retries int64
+	var retried []chunkRetry
+	for i, f := range frames {
+		if f == nil || hits[i] || f.Meta == nil {
+			continue
+		}
+		if custom, ok := f.Meta.Custom.(map[string]interface{}); ok {
+			ms, _ := custom["executionTime"].(int64)
+			executionTime += ms
+			if n, _ := custom[retriesMetaKey].(int64); n > 0 {
+				retries += n
+				retried = append(retried, chunkRetry{From: chunks[i].From, To: chunks[i].To, Retries: n})
+			}
+		}
+	}
+	custom := map[string]interface{}{
+		"splitChunks":   len(chunks),
+		"executionTime": executionTime,
+	}
+	if retries > 0 {
+		custom[retriesMetaKey] = retries
+		custom[chunkRetriesMetaKey] = retried
+	}
+	if qm.DedupeRows {
+		custom["duplicateRows"] = duplicates
+	}
+	if qm.AllowPartialResults {
+		custom["failedChunks"] = len(failed)
+		custom["totalChunks"] = len(chunks)
+	}
+	if settings.chunkCache != nil {
+		var stats chunkCacheStats
+		for _, hit := range hits {
+			if hit {
+				stats.Hits++
+			} else {
+				stats.Misses++
+			}
+		}
+		custom[chunkCacheMetaKey] = stats
+	}
+	// Resetting Meta drops the per-chunk conversion notices and Arc
+	// warnings; re-attach them summed so the panel still warns once per
+	// affected column and distinct warning. merged is one of the chunk
+	// frames, so they are read before the reset.
+	failures, warnings := mergeConversionFailures(orderedFrames), mergeArcWarnings(orderedFrames)
+	truncated := mergeTruncatedCells(orderedFrames)
 	merged.Meta = &data.FrameMeta{
 		ExecutedQueryString: qm.SQL,
-		Custom: map[string]interface{}{
-			"splitChunks": len(chunks),
-		},
+		Custom:              custom,
+	}
+	attachConversionFailures(merged, failures)
+	attachArcWarnings(merged, warnings, len(chunks))
+	noticeTruncatedCells(merged, truncated)
+	if len(failed) > 0 {
+		merged.AppendNotices(partial)
+	}
+	if capHit {
+		if err := settings.policy.allow(merged, limit.modification(fmt.Sprintf("%d rows per chunk across %d chunks", chunkCap, len(chunks)))); err != nil {
+			return errorResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err), qm, qm.SQL)
+		}
+	}
+	if err := settings.policy.reviewLongToWide(merged, qm); err != nil {
+		return errorResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err), qm, qm.SQL)
 	}
 
 	// Prepare frames (long-to-wide conversion, etc.)
@@ -701,8 +1787,15 @@ func (d *ArcDatasource) query(ctx context.Context, settings *ArcInstanceSettings
 	prepareDuration := time.Since(prepareStart)
 
 	if len(processedFrames) == 0 {
-		log.DefaultLogger.Warn("No frames after prepare", "refId", qm.RefID)
-		return response
+		return noDataResponse(qm, qm.SQL, "the merged result could not be shaped into frames")
+	}
+	processedFrames, err = applySeriesCap(ctx, processedFrames, qm, settings.policy)
+	if err != nil {
+		return errorResponse(backend.StatusBadRequest, sanitizeUserError(qm.RefID, err), qm, qm.SQL)
+	}
+	attachAdaptivePlan(processedFrames, plan)
+	if settings.settings.EnrichFieldMetadata {
+		settings.enrichFieldMetadata(ctx, processedFrames, stripped)
 	}
 
 	response.Frames = append(response.Frames, processedFrames...)
@@ -717,41 +1810,111 @@ func (d *ArcDatasource) query(ctx context.Context, settings *ArcInstanceSettings
 	return response
 }
 
-// querySingle executes a query without splitting (original behavior)
-func (d *ArcDatasource) querySingle(ctx context.Context, settings *ArcInstanceSettings, query backend.DataQuery, qm ArcQuery) backend.DataResponse {
+// DefaultTimeSeriesRowsPerPoint is the auto time-series row cap's headroom
+// over maxDataPoints (per estimated series). Legitimate $__timeGroup queries
+// return about one row per point per series, so 10× leaves room for a
+// bucket finer than the panel interval without ever clipping a correct
+// query, while a forgotten GROUP BY over millions of raw rows is cut off.
+const DefaultTimeSeriesRowsPerPoint = 10
+
+// timeSeriesRowCap returns the LIMIT safety net to append to qm, or 0 when
+// none applies. The net only covers queries whose author asked for time
+// bucketing: time_series format, a $__timeGroup macro, and no LIMIT of
+// their own. Raw-mode queries (no $__timeGroup) and table formats are read
+// as "I want the rows": only rawRowCap limits them. With
+// TimeSeriesRowCap unset the cap is maxDataPoints ×
+// DefaultTimeSeriesRowsPerPoint × the estimated series count — none when
+// maxDataPoints ≤ 0 or the product overflows — and a negative setting
+// disables the net. resolveRowLimit decides whether this cap or a
+// rowLimit/maxRows applies.
+func (s *ArcInstanceSettings) timeSeriesRowCap(qm ArcQuery, stripped strippedSQL, maxDataPoints int64) int64 {
+	configured := s.settings.TimeSeriesRowCap
+	if configured < 0 || qm.Format == "table" || qm.Format == "numeric_table" {
+		return 0
+	}
+	if !strings.Contains(stripped.stripped, "$__timeGroup") || containsTopLevelLIMIT(stripped) {
+		return 0
+	}
+	if configured > 0 {
+		return configured
+	}
+	if maxDataPoints == 0 {
+		maxDataPoints = qm.MaxDataPoints
+	}
+	return saturatingMul(maxDataPoints, DefaultTimeSeriesRowsPerPoint, estimateSeriesFactor(stripped))
+}
+
+// rowCapDetail describes a capped query that came back with exactly the
+// cap's worth of rows, i.e. the result was (probably) cut short.
+func rowCapDetail(limit string) string {
+	return "Result truncated by the time-series row cap (" + limit + "). " +
+		"The query uses $__timeGroup but returned far more rows than the panel can plot — check that it groups by the time bucket. " +
+		"Add an explicit LIMIT to opt out of the cap."
+}
+
+// errorResponse is backend.ErrDataResponse for a query that failed after its
+// SQL was built. The response also carries an empty frame with the query's
+// RefID and that SQL, so the query inspector shows what ran.
+func errorResponse(status backend.Status, msg string, qm ArcQuery, sql string) backend.DataResponse {
+	resp := backend.ErrDataResponse(status, msg)
+	frame := data.NewFrame(qm.RefID)
+	frame.RefID = qm.RefID
+	frame.Meta = &data.FrameMeta{ExecutedQueryString: sql}
+	resp.Frames = data.Frames{frame}
+	return resp
+}
+
+// querySingle executes a query without splitting (original behavior).
+// A non-zero limit is appended as a LIMIT (see resolveRowLimit);
+// bucketOrigin is the resolved ArcQuery.BucketOrigin.
+func (d *ArcDatasource) querySingle(ctx context.Context, settings *ArcInstanceSettings, query backend.DataQuery, qm ArcQuery, limit rowLimit, bucketOrigin time.Time) backend.DataResponse {
 	var response backend.DataResponse
 
-	// Apply time range macros
-	sql := ApplyMacros(qm.SQL, query.TimeRange)
+	rawSQL := qm.SQL
+	if limit.Limit > 0 {
+		rawSQL = appendLimit(rawSQL, limit.Limit)
+	}
+
+	// Apply time range macros; the attribution comment goes on last.
+	sent := attributed(ctx, applyMacrosWith(rawSQL, query.TimeRange, query, bucketOrigin))
+	sql := settings.shownSQL(ctx, sent)
 
 	log.DefaultLogger.Debug("Executing Arc query",
 		"refId", qm.RefID,
-		"sql", sql,
+		"sql", settings.redactSQL(sql),
 		"format", qm.Format,
-		"useArrow", *settings.settings.UseArrow,
+		"protocol", settings.protocolName(ctx),
 	)
 
-	var frame *data.Frame
-	var err error
-
-	if *settings.settings.UseArrow {
-		frame, err = queryArrow(ctx, settings, sql)
-	} else {
-		frame, err = queryJSON(ctx, settings, sql)
-	}
-
+	frames, err := settings.queryFrames(ctx, sent)
 	if err != nil {
-		return backend.ErrDataResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err))
+		return queryErrorResponse(err, qm, sql)
+	}
+	for _, frame := range frames {
+		if frame.Meta != nil {
+			frame.Meta.ExecutedQueryString = sql // the decoder saw sent
+		}
+		if limit.Limit > 0 && int64(frame.Rows()) >= limit.Limit {
+			if err := settings.policy.allow(frame, limit.modification(fmt.Sprintf("%d rows", limit.Limit))); err != nil {
+				return errorResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err), qm, sql)
+			}
+		}
+		if err := settings.policy.reviewLongToWide(frame, qm); err != nil {
+			return errorResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err), qm, sql)
+		}
 	}
 
-	// Time the frame preparation (conversion)
+	// Time the frame preparation (conversion).
 	prepareStart := time.Now()
-	processedFrames := prepareFrames(frame, qm)
+	processedFrames := prepareResultSets(frames, qm, sql)
 	prepareDuration := time.Since(prepareStart)
 
 	if len(processedFrames) == 0 {
-		log.DefaultLogger.Warn("No frames returned from query", "refId", qm.RefID)
-		return response
+		return noDataResponse(qm, sql, "Arc answered without a result set")
+	}
+	processedFrames, err = applySeriesCap(ctx, processedFrames, qm, settings.policy)
+	if err != nil {
+		return errorResponse(backend.StatusBadRequest, sanitizeUserError(qm.RefID, err), qm, sql)
 	}
 
 	response.Frames = append(response.Frames, processedFrames...)
@@ -769,37 +1932,100 @@ func (d *ArcDatasource) querySingle(ctx context.Context, settings *ArcInstanceSe
 
 // CheckHealth validates the datasource connection
 func (d *ArcDatasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	var status = backend.HealthStatusOk
-	var message = "Arc datasource is working"
-
 	settings, err := d.getInstance(ctx, req.PluginContext)
+	if errors.Is(err, errAPIKeyUndecryptable) {
+		return healthError(healthErrorSettings, err.Error()), nil
+	}
+	if errors.Is(err, errInvalidURL) {
+		return healthError(healthErrorURL, err.Error()), nil
+	}
 	if err != nil {
-		return &backend.CheckHealthResult{
-			Status:  backend.HealthStatusError,
-			Message: fmt.Sprintf("failed to get settings: %v", err),
-		}, nil
+		return healthError(healthErrorSettings, fmt.Sprintf("failed to get settings: %v", err)), nil
 	}
 
-	// Test connection with a simple query against the production decode path,
-	// so a CheckHealth pass actually proves the path real queries use.
-	_, err = queryArrow(ctx, settings, "SHOW DATABASES")
-
+	// Test connection with a simple query against the production decode path
+	// (whichever protocol queries resolve to), so a CheckHealth pass actually
+	// proves the path real queries use. Tagged as health traffic so it
+	// bypasses the limiter and stays out of the query metrics.
+	ctx = withCallerIdentity(ctx, req.PluginContext)
+	ctx = withOAuthToken(ctx, req.GetHTTPHeaders())
+	hctx := withRequestClass(ctx, requestClassHealth)
+	databases, err := settings.queryFrames(hctx, "SHOW DATABASES")
 	if err != nil {
-		status = backend.HealthStatusError
-		message = "Failed to connect to Arc: " + sanitizeUserError("health", err)
+		return healthError(healthFailure(err, settings)), nil
+	}
+
+	settings.databaseList.remember(databases)
+	// "Save & test" is when an admin expects fresh answers, so the
+	// version is re-probed rather than served from the cache. A failed
+	// version probe doesn't fail the check — queries still work; only
+	// version-gated features are affected.
+	message := "Arc datasource is working"
+	version := settings.arcVersion(ctx, true)
+	if version.Version != "" {
+		message = fmt.Sprintf("%s (Arc %s)", message, version.Version)
 	} else {
-		log.DefaultLogger.Info("Health check passed",
-			"url", settings.settings.URL,
-			"database", settings.settings.Database,
-		)
-	}
+		message += " (Arc version unknown: " + version.Error + ")"
+	}
+	protocol := settings.protocolName(ctx)
+	message += "; database: " + settings.settings.Database + "; protocol: " + protocol
+	healthDetails := map[string]any{"arcVersion": version, "database": settings.settings.Database, "protocol": protocol, "retryStatusCodes": settings.retryStatusCodes}
+	if proxy, warning := dataproxyTimeoutWarning(time.Duration(settings.settings.Timeout) * time.Second); warning != "" {
+		message += "; warning: " + warning
+		healthDetails["dataproxyTimeout"] = proxy.Seconds()
+	}
+	if settings.settings.OAuthPassThru {
+		// The check runs as one user, or none; every other user's token
+		// only meets Arc when they query.
+		checkedWith, credential := "the API key", "apiKey"
+		if settings.passThruToken(ctx) != "" {
+			checkedWith, credential = "your OAuth token", "oauthToken"
+		}
+		message += "; OAuth pass-through: checked with " + checkedWith + " only, other users' tokens can only be validated at query time"
+		healthDetails["oauthPassThru"] = map[string]any{"checkedWith": credential}
+	}
+	details, _ := json.Marshal(healthDetails)
+	log.DefaultLogger.Info("Health check passed",
+		"url", settings.settings.URL,
+		"database", settings.settings.Database,
+		"arcVersion", version.Version,
+		"protocol", protocol,
+	)
 
 	return &backend.CheckHealthResult{
-		Status:  status,
-		Message: message,
+		Status:      backend.HealthStatusOk,
+		Message:     message,
+		JSONDetails: details,
 	}, nil
 }
 
+// prepareResultSets runs each result set of a response through
+// prepareFrames. The result sets of a multi-result response go through
+// format handling on their own and are named <refId>-<n> so panels and
+// transformations can tell them apart; one the converter lost keeps a
+// noDataFrame of its own rather than vanishing.
+func prepareResultSets(frames data.Frames, qm ArcQuery, sql string) data.Frames {
+	var processed data.Frames
+	for i, frame := range frames {
+		prepared := prepareFrames(frame, qm)
+		if len(prepared) == 0 {
+			prepared = data.Frames{noDataFrame(qm, sql, errNoFrame.Error())}
+		}
+		if len(frames) > 1 {
+			for _, p := range prepared {
+				p.Name = fmt.Sprintf("%s-%d", qm.RefID, i+1)
+			}
+		}
+		processed = append(processed, prepared...)
+	}
+	return processed
+}
+
+// prepareFrames shapes frame for qm.Format (see shapeFrames) and makes sure
+// every frame it returns carries the query's RefID, a name, and the Meta the
+// decoder built (ExecutedQueryString, stats, notices). Conversions build new
+// frames, and one that lost its RefID breaks transformations that join by
+// refId.
 func prepareFrames(frame *data.Frame, qm ArcQuery) data.Frames {
 	if frame == nil {
 		return nil
@@ -811,17 +2037,71 @@ func prepareFrames(frame *data.Frame, qm ArcQuery) data.Frames {
 	if frame.Meta == nil {
 		frame.Meta = &data.FrameMeta{}
 	}
+	meta := frame.Meta
+
+	frames := shapeFrames(frame, qm)
+	for _, f := range frames {
+		f.RefID = qm.RefID
+		if f.Name == "" {
+			f.Name = qm.RefID
+		}
+		switch {
+		case f.Meta == nil:
+			f.Meta = meta
+		case f.Meta != meta:
+			fillFrameMeta(f.Meta, meta)
+		}
+	}
+	return frames
+}
+
+// fillFrameMeta copies the query-level fields of src that dst lacks.
+func fillFrameMeta(dst, src *data.FrameMeta) {
+	if dst.ExecutedQueryString == "" {
+		dst.ExecutedQueryString = src.ExecutedQueryString
+	}
+	if dst.Custom == nil {
+		dst.Custom = src.Custom
+	}
+	if len(dst.Stats) == 0 {
+		dst.Stats = src.Stats
+	}
+	if len(dst.Notices) == 0 {
+		dst.Notices = src.Notices
+	}
+}
+
+// shapeFrames converts a decoded frame (named, with Meta) to the layout
+// qm.Format asks for.
+func shapeFrames(frame *data.Frame, qm ArcQuery) data.Frames {
+	// A result with no columns (a projection that collapsed to nothing) has
+	// nothing to visualize, and typed as a table or time series Grafana
+	// rejects it. It goes back untyped, named, with a notice.
+	if len(frame.Fields) == 0 {
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityInfo, Text: "Query returned no columns"})
+		return data.Frames{frame}
+	}
 
 	switch qm.Format {
 	case "table":
+		frame = toTableLayout(frame, qm.TableLayout)
 		frame.Meta.PreferredVisualization = data.VisTypeTable
 		frame.Meta.Type = data.FrameTypeTable
 		return data.Frames{frame}
+	case "numeric_table":
+		return data.Frames{toNumericTable(frame)}
 	default:
 		// Default to time series visualization
 		frame.Meta.PreferredVisualization = data.VisTypeGraph
 	}
 
+	// Arc said which column is which: see columnRoleLayout.
+	if layout, ok := columnRoleLayout(frame); ok {
+		return shapeByRoles(layout)
+	}
+
+	// Decide the labels before converting: see nullColumnsAsValues.
+	nullColumnsAsValues(frame)
 	schema := frame.TimeSeriesSchema()
 
 	// Handle wide format time series (already optimized, no conversion needed)
@@ -856,7 +2136,7 @@ func prepareFrames(frame *data.Frame, qm ArcQuery) data.Frames {
 				"error", err,
 			)
 			longFrame.Meta.PreferredVisualization = data.VisTypeGraph
-			longFrame.RefID = qm.RefID
+			noticeShapeFallback(longFrame, "wide", err)
 			return data.Frames{longFrame}
 		}
 
@@ -871,7 +2151,6 @@ func prepareFrames(frame *data.Frame, qm ArcQuery) data.Frames {
 		}
 		wideFrame.Meta.PreferredVisualization = data.VisTypeGraph
 		wideFrame.Meta.Type = data.FrameTypeTimeSeriesWide
-		wideFrame.RefID = qm.RefID
 		return data.Frames{wideFrame}
 	}
 
@@ -881,8 +2160,167 @@ func prepareFrames(frame *data.Frame, qm ArcQuery) data.Frames {
 	return data.Frames{frame}
 }
 
+// nullColumnsAsValues replaces the string fields of frame that hold no
+// value at all with nullable float64 fields of the same name and length.
+// The labels of a long frame are its string fields, but a column with
+// nothing but NULLs names no series: typically it is a value column the
+// decoder had no type for (an all-NULL mem next to cpu and disk). Left a
+// string, it would drop out of the values and tag every series with
+// mem="". The frame is changed in place.
+func nullColumnsAsValues(frame *data.Frame) {
+	for i, f := range frame.Fields {
+		frame.Fields[i] = nullStringAsValue(f)
+	}
+}
+
+// nullStringAsValue returns a nullable float64 field in place of a string
+// field without a value (see nullColumnsAsValues), else f.
+func nullStringAsValue(f *data.Field) *data.Field {
+	if f.Type() != data.FieldTypeNullableString || f.Len() == 0 || hasValue(f) {
+		return f
+	}
+	empty := data.NewField(f.Name, f.Labels, make([]*float64, f.Len()))
+	empty.Config = f.Config
+	return empty
+}
+
+// hasValue reports whether f has any non-null value.
+func hasValue(f *data.Field) bool {
+	for i := 0; i < f.Len(); i++ {
+		if _, ok := f.ConcreteAt(i); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Table layouts for ArcQuery.TableLayout.
+const (
+	tableLayoutLong = "long"
+	tableLayoutWide = "wide"
+)
+
+// toTableLayout reshapes a table-format result into the requested layout.
+// "long" (the default) turns a wide frame whose series are named by labels
+// — unreadable as a table, every column header is `usage {host=a, dc=x}` —
+// back into tidy rows: time, one string column per label, value. "wide"
+// goes the other way for people who want one column per series. Frames
+// that are already in the requested layout (or aren't time series at all)
+// pass through untouched, and a failed conversion keeps the original frame,
+// with a notice, rather than failing the query.
+func toTableLayout(frame *data.Frame, layout string) *data.Frame {
+	schema := frame.TimeSeriesSchema()
+	var converted *data.Frame
+	var err error
+	target := tableLayoutWide
+	switch {
+	case layout == tableLayoutWide && schema.Type == data.TimeSeriesTypeLong:
+		converted, err = data.LongToWide(ensureAscendingTimes(frame, schema.TimeIndex), nil)
+	case layout != tableLayoutWide && schema.Type == data.TimeSeriesTypeWide && frameHasLabels(frame):
+		target = tableLayoutLong
+		converted, err = data.WideToLong(frame)
+	default:
+		return frame
+	}
+	if err != nil {
+		log.DefaultLogger.Warn("table layout conversion failed, returning frame as-is", "layout", layout, "error", err)
+		noticeShapeFallback(frame, target, err)
+		return frame
+	}
+	converted.Name = frame.Name
+	converted.RefID = frame.RefID
+	if converted.Meta == nil {
+		converted.Meta = frame.Meta
+	}
+	return converted
+}
+
+// toNumericTable reshapes a frame into the "numeric table" layout Grafana's
+// SQL expressions consume reliably: guaranteed long format (labels flattened
+// back into string columns, one row per time+label tuple) with a stable
+// column order — time first, then numeric value columns, then every other
+// column, each group sorted by name. This is the same order data.WideToLong
+// emits, applied to long input as well so the shape doesn't depend on how
+// the data arrived.
+func toNumericTable(frame *data.Frame) *data.Frame {
+	schema := frame.TimeSeriesSchema()
+	if schema.Type == data.TimeSeriesTypeWide && frameHasLabels(frame) {
+		long, err := data.WideToLong(frame)
+		if err != nil {
+			log.DefaultLogger.Warn("WideToLong conversion failed, returning frame as-is", "error", err)
+			noticeShapeFallback(frame, "long", err)
+		} else {
+			long.Name = frame.Name
+			long.RefID = frame.RefID
+			frame = long
+			schema = frame.TimeSeriesSchema()
+		}
+	}
+
+	hasTime := schema.Type != data.TimeSeriesTypeNot
+	if hasTime {
+		frame = ensureAscendingTimes(frame, schema.TimeIndex)
+	}
+	frame.Fields = numericTableFieldOrder(frame.Fields, schema.TimeIndex, hasTime)
+
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.PreferredVisualization = data.VisTypeTable
+	if hasTime {
+		frame.Meta.Type = data.FrameTypeTimeSeriesLong
+	} else {
+		frame.Meta.Type = data.FrameTypeNumericLong
+	}
+	return frame
+}
+
+// frameHasLabels reports whether any field carries a non-empty label set.
+func frameHasLabels(frame *data.Frame) bool {
+	for _, f := range frame.Fields {
+		if len(f.Labels) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// numericTableFieldOrder returns fields ordered time → numeric values →
+// everything else, sorted by name within each group (see toNumericTable).
+func numericTableFieldOrder(fields []*data.Field, timeIdx int, hasTime bool) []*data.Field {
+	var timeField *data.Field
+	var values, others []*data.Field
+	for i, f := range fields {
+		switch {
+		case hasTime && i == timeIdx:
+			timeField = f
+		case f.Type().Numeric():
+			values = append(values, f)
+		default:
+			others = append(others, f)
+		}
+	}
+	byName := func(fs []*data.Field) {
+		sort.SliceStable(fs, func(i, j int) bool { return fs[i].Name < fs[j].Name })
+	}
+	byName(values)
+	byName(others)
+
+	ordered := make([]*data.Field, 0, len(fields))
+	if timeField != nil {
+		ordered = append(ordered, timeField)
+	}
+	ordered = append(ordered, values...)
+	return append(ordered, others...)
+}
+
 // ensureAscendingTimes sorts frame rows by time if needed.
 // Performance: O(n) check + O(n log n) sort if unsorted (vs previous O(n²) bubble sort)
+//
+// Ordering contract: rows with identical timestamps keep their input order.
+// The sort is keyed by (time, original index) so ties never swap between
+// refreshes — which value "wins" a later dedup, and the order labels appear
+// in after LongToWide, must not jitter. Downstream features rely on this.
 func ensureAscendingTimes(frame *data.Frame, timeIdx int) *data.Frame {
 	rowLen, err := frame.RowLen()
 	if err != nil || rowLen < 2 {
@@ -916,6 +2354,7 @@ func ensureAscendingTimes(frame *data.Frame, timeIdx int) *data.Frame {
 	// Create sorted frame by collecting all rows with their timestamps
 	type rowWithTime struct {
 		time time.Time
+		idx  int
 		data []interface{}
 	}
 
@@ -924,13 +2363,18 @@ func ensureAscendingTimes(frame *data.Frame, timeIdx int) *data.Frame {
 		t, _ := toTime(frame.CopyAt(timeIdx, i))
 		rows[i] = rowWithTime{
 			time: t,
+			idx:  i,
 			data: frame.RowCopy(i),
 		}
 	}
 
-	// Sort by time ascending using efficient O(n log n) algorithm
+	// Sort by (time, original index) — a total order, so the result is
+	// deterministic for duplicate timestamps.
 	sort.Slice(rows, func(i, j int) bool {
-		return rows[i].time.Before(rows[j].time)
+		if !rows[i].time.Equal(rows[j].time) {
+			return rows[i].time.Before(rows[j].time)
+		}
+		return rows[i].idx < rows[j].idx
 	})
 
 	// Build sorted frame
@@ -6,12 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"unicode/utf8"
 
+	"github.com/apache/arrow/go/v14/arrow/memory"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
@@ -152,6 +160,13 @@ func TestParseSplitDuration_Explicit(t *testing.T) {
 		{"1d", 24 * time.Hour},
 		{"3d", 3 * 24 * time.Hour},
 		{"7d", 7 * 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"30m", 30 * time.Minute},
+		{"2h", 2 * time.Hour},
+		{"12h30m", 12*time.Hour + 30*time.Minute},
+		{"14d", 14 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"5m", 5 * time.Minute},
 	}
 	for _, c := range cases {
 		dur, ok := parseSplitDuration(c.input, tr)
@@ -169,6 +184,57 @@ func TestParseSplitDuration_UnknownValue(t *testing.T) {
 	}
 }
 
+func TestParseSplitDuration_BelowMinimum(t *testing.T) {
+	for _, input := range []string{"4m59s", "1m", "30s", "0s", "-1h"} {
+		if dur, ok := parseSplitDuration(input, backend.TimeRange{}); ok || dur != 0 {
+			t.Errorf("parseSplitDuration(%q) = %v, %v; want no split below the minimum", input, dur, ok)
+		}
+	}
+	if _, err := splitDurationValue("1m"); err == nil || err.Error() != `splitDuration "1m" is below the 5m minimum` {
+		t.Errorf("error = %v", err)
+	}
+}
+
+// TestQuery_InvalidSplitDuration: a splitDuration that can't be used runs
+// the query unsplit, with a warning on the frame.
+func TestQuery_InvalidSplitDuration(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"columns":["time","v"],"data":[["2026-03-08T00:30:00Z",1]]}`))
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct{ split, notice string }{
+		{"abc", `Query not split: unknown splitDuration "abc": use auto, off or a duration such as 30m, 2h, 12h30m or 14d.`},
+		{"1m", `Query not split: splitDuration "1m" is below the 5m minimum.`},
+	} {
+		requests.Store(0)
+		resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+			Queries: []backend.DataQuery{{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from, To: from.Add(6 * time.Hour)},
+				JSON:      []byte(`{"sql":"SELECT time, v FROM t WHERE $__timeFilter(time)","format":"table","splitDuration":"` + c.split + `"}`),
+			}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		r := resp.Responses["A"]
+		if r.Error != nil {
+			t.Fatalf("%s: query error: %v", c.split, r.Error)
+		}
+		if n := requests.Load(); n != 1 {
+			t.Errorf("%s: %d requests to Arc, want 1 (unsplit)", c.split, n)
+		}
+		if texts := noticeTexts(r.Frames[0]); !slices.Contains(texts, c.notice) {
+			t.Errorf("%s: notices = %q, want %q", c.split, texts, c.notice)
+		}
+	}
+}
+
 // --- splitTimeRange ---
 
 func TestSplitTimeRange_AlignedBoundaries(t *testing.T) {
@@ -176,7 +242,7 @@ func TestSplitTimeRange_AlignedBoundaries(t *testing.T) {
 	// Expected: [14:30,18:00), [18:00,00:00), [00:00,02:30)
 	from := time.Date(2026, 2, 18, 14, 30, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 19, 2, 30, 0, 0, time.UTC)
-	chunks := splitTimeRange(from, to, 6*time.Hour)
+	chunks := splitTimeRange(from, to, 6*time.Hour, 0)
 
 	if len(chunks) != 3 {
 		t.Fatalf("expected 3 chunks, got %d: %v", len(chunks), chunks)
@@ -199,7 +265,7 @@ func TestSplitTimeRange_ExactlyOnBoundary(t *testing.T) {
 	// from is exactly on a 1h boundary
 	from := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 18, 13, 0, 0, 0, time.UTC)
-	chunks := splitTimeRange(from, to, time.Hour)
+	chunks := splitTimeRange(from, to, time.Hour, 0)
 
 	if len(chunks) != 3 {
 		t.Fatalf("expected 3 chunks, got %d: %v", len(chunks), chunks)
@@ -217,7 +283,7 @@ func TestSplitTimeRange_ExactlyOnBoundary(t *testing.T) {
 func TestSplitTimeRange_SmallRange_NoSplit(t *testing.T) {
 	from := time.Date(2026, 2, 18, 10, 15, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 18, 10, 45, 0, 0, time.UTC) // 30 min
-	chunks := splitTimeRange(from, to, time.Hour)
+	chunks := splitTimeRange(from, to, time.Hour, 0)
 
 	if len(chunks) != 1 {
 		t.Fatalf("expected 1 chunk for range smaller than chunkSize, got %d", len(chunks))
@@ -229,7 +295,7 @@ func TestSplitTimeRange_SmallRange_NoSplit(t *testing.T) {
 func TestSplitTimeRange_ZeroDuration_NoSplit(t *testing.T) {
 	from := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC)
-	chunks := splitTimeRange(from, to, 0)
+	chunks := splitTimeRange(from, to, 0, 0)
 
 	if len(chunks) != 1 {
 		t.Fatalf("expected 1 chunk for zero duration, got %d", len(chunks))
@@ -240,7 +306,7 @@ func TestSplitTimeRange_Contiguous(t *testing.T) {
 	// Verify chunks are contiguous with no gaps or overlaps
 	from := time.Date(2026, 2, 18, 10, 37, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 20, 5, 12, 0, 0, time.UTC)
-	chunks := splitTimeRange(from, to, 6*time.Hour)
+	chunks := splitTimeRange(from, to, 6*time.Hour, 0)
 
 	if len(chunks) < 2 {
 		t.Fatalf("expected multiple chunks, got %d", len(chunks))
@@ -263,7 +329,7 @@ func TestSplitTimeRange_Contiguous(t *testing.T) {
 func TestSplitTimeRange_InternalBoundariesAligned(t *testing.T) {
 	from := time.Date(2026, 2, 18, 10, 37, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 20, 5, 12, 0, 0, time.UTC)
-	chunks := splitTimeRange(from, to, 6*time.Hour)
+	chunks := splitTimeRange(from, to, 6*time.Hour, 0)
 
 	// All internal boundaries (not first From or last To) should be on 6h epoch multiples
 	for i := 0; i < len(chunks)-1; i++ {
@@ -278,7 +344,7 @@ func TestSplitTimeRange_InternalBoundariesAligned(t *testing.T) {
 func TestSplitTimeRange_1dChunks_30dRange(t *testing.T) {
 	from := time.Date(2026, 1, 19, 8, 30, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 18, 8, 30, 0, 0, time.UTC)
-	chunks := splitTimeRange(from, to, 24*time.Hour)
+	chunks := splitTimeRange(from, to, 24*time.Hour, 0)
 
 	// 30 days = ~31 chunks (first and last partial + 29 full)
 	if len(chunks) < 30 || len(chunks) > 32 {
@@ -298,7 +364,7 @@ func TestSplitTimeRange_BoundaryNoDuplicates(t *testing.T) {
 	// the boundary timestamp matches only one chunk (no duplicates).
 	from := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
 	to := time.Date(2026, 2, 18, 13, 0, 0, 0, time.UTC)
-	chunks := splitTimeRange(from, to, time.Hour)
+	chunks := splitTimeRange(from, to, time.Hour, 0)
 
 	if len(chunks) < 2 {
 		t.Fatalf("expected multiple chunks, got %d", len(chunks))
@@ -403,6 +469,380 @@ func TestMergeFrames_SkipsEmptyFirstFrame(t *testing.T) {
 	}
 }
 
+// TestMergeFrames_EmptyChunksKeepColumns: chunks without rows now keep
+// their columns, typed as strings when Arc declared none; they neither
+// become the base nor turn away the chunks with values.
+func TestMergeFrames_EmptyChunksKeepColumns(t *testing.T) {
+	empty := func() *data.Frame {
+		return data.NewFrame("", data.NewField("value", nil, []*string{}))
+	}
+	one, two := 1.0, 2.0
+	f := data.NewFrame("", data.NewField("value", nil, []*float64{&one, &two}))
+
+	result, skipped := mergeFramesSkipping([]*data.Frame{empty(), f, empty()})
+	if skipped != 0 || result.Rows() != 2 || result.Fields[0].Type() != data.FieldTypeNullableFloat64 {
+		t.Errorf("merged %d rows of %s, skipped %d; want 2 float64 rows", result.Rows(), result.Fields[0].Type(), skipped)
+	}
+	if result := mergeFrames([]*data.Frame{empty(), empty()}); len(result.Fields) != 1 || result.Rows() != 0 {
+		t.Errorf("all-empty merge = %d fields, %d rows; want the columns", len(result.Fields), result.Rows())
+	}
+}
+
+// TestMergeFrames_ReorderedColumns: chunks returning the same columns in a
+// different order (hash aggregation) are merged by name, not by position.
+func TestMergeFrames_ReorderedColumns(t *testing.T) {
+	f1 := data.NewFrame("",
+		data.NewField("host", nil, []string{"a"}),
+		data.NewField("max", nil, []float64{1}),
+		data.NewField("min", nil, []float64{0}),
+	)
+	f2 := data.NewFrame("",
+		data.NewField("min", nil, []float64{10}),
+		data.NewField("host", nil, []string{"b"}),
+		data.NewField("max", nil, []float64{20}),
+	)
+	merged, skipped := mergeFramesSkipping([]*data.Frame{f1, f2})
+	if skipped != 0 || merged.Rows() != 2 {
+		t.Fatalf("merged %d rows, skipped %d", merged.Rows(), skipped)
+	}
+	for i, name := range []string{"host", "max", "min"} {
+		if merged.Fields[i].Name != name {
+			t.Errorf("field %d = %s, want %s", i, merged.Fields[i].Name, name)
+		}
+	}
+	if merged.Fields[0].At(1) != "b" || merged.Fields[1].At(1) != 20.0 || merged.Fields[2].At(1) != 10.0 {
+		t.Errorf("second row = %v %v %v, want b 20 10", merged.Fields[0].At(1), merged.Fields[1].At(1), merged.Fields[2].At(1))
+	}
+}
+
+// TestMergeFrames_ColumnAddedMidStream: a column first returned by a later
+// chunk is added as a nullable field, null for the chunks without it.
+func TestMergeFrames_ColumnAddedMidStream(t *testing.T) {
+	chunk := func(v float64, region ...string) *data.Frame {
+		f := data.NewFrame("", data.NewField("value", nil, []float64{v}))
+		if region != nil {
+			f.Fields = append([]*data.Field{data.NewField("region", nil, region)}, f.Fields...)
+		}
+		return f
+	}
+	merged, skipped := mergeFramesSkipping([]*data.Frame{chunk(1), chunk(2, "eu"), chunk(3)})
+	if skipped != 0 || merged.Rows() != 3 || len(merged.Fields) != 2 {
+		t.Fatalf("merged %d rows in %d fields, skipped %d", merged.Rows(), len(merged.Fields), skipped)
+	}
+	region := merged.Fields[1]
+	if region.Name != "region" || region.Type() != data.FieldTypeNullableString {
+		t.Fatalf("added field %s of %s", region.Name, region.Type())
+	}
+	if region.At(0).(*string) != nil || *region.At(1).(*string) != "eu" || region.At(2).(*string) != nil {
+		t.Errorf("region = %v %v %v, want nil eu nil", region.At(0), region.At(1), region.At(2))
+	}
+	if v, _ := merged.Fields[0].ConcreteAt(2); v != 3.0 {
+		t.Errorf("value row 2 = %v", v)
+	}
+}
+
+// TestMergeFrames_MissingColumnSkipped: a chunk without one of the first
+// chunk's columns is left out rather than merged with a gap.
+func TestMergeFrames_MissingColumnSkipped(t *testing.T) {
+	f1 := data.NewFrame("",
+		data.NewField("host", nil, []string{"a"}),
+		data.NewField("value", nil, []float64{1}),
+	)
+	f2 := data.NewFrame("",
+		data.NewField("host", nil, []string{"b"}),
+		data.NewField("other", nil, []float64{2}),
+	)
+	f3 := data.NewFrame("",
+		data.NewField("value", nil, []float64{3}),
+		data.NewField("host", nil, []string{"c"}),
+	)
+	merged, skipped := mergeFramesSkipping([]*data.Frame{f1, f2, f3})
+	if skipped != 1 || merged.Rows() != 2 || len(merged.Fields) != 2 {
+		t.Fatalf("merged %d rows in %d fields, skipped %d", merged.Rows(), len(merged.Fields), skipped)
+	}
+	if merged.Fields[0].At(1) != "c" {
+		t.Errorf("second row host = %v, want c", merged.Fields[0].At(1))
+	}
+}
+
+// --- ensureAscendingTimes ---
+
+// TestEnsureAscendingTimes_StableForDuplicateTimes locks in the ordering
+// contract: rows sharing a timestamp come out in their input order. Many
+// ties across few distinct times so an unstable sort would reliably shuffle.
+func TestEnsureAscendingTimes_StableForDuplicateTimes(t *testing.T) {
+	base := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
+	const rows = 500
+	times := make([]time.Time, rows)
+	seq := make([]float64, rows)
+	for i := 0; i < rows; i++ {
+		// Descending buckets of 5 distinct times forces a sort.
+		times[i] = base.Add(time.Duration(4-i%5) * time.Minute)
+		seq[i] = float64(i)
+	}
+	frame := data.NewFrame("",
+		data.NewField("time", nil, times),
+		data.NewField("seq", nil, seq),
+	)
+
+	sorted := ensureAscendingTimes(frame, 0)
+
+	var prevTime time.Time
+	prevSeq := -1.0
+	for i := 0; i < sorted.Rows(); i++ {
+		ts, _ := toTime(sorted.Fields[0].At(i))
+		s := sorted.Fields[1].At(i).(float64)
+		if ts.Before(prevTime) {
+			t.Fatalf("row %d: time went backwards", i)
+		}
+		if ts.Equal(prevTime) && s < prevSeq {
+			t.Fatalf("row %d: tie reordered — seq %v came after %v", i, s, prevSeq)
+		}
+		prevTime, prevSeq = ts, s
+	}
+}
+
+func TestEnsureAscendingTimes_SortedInputUnchanged(t *testing.T) {
+	t1 := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{t1, t1, t1.Add(time.Minute)}),
+		data.NewField("v", nil, []float64{2, 1, 3}),
+	)
+	if got := ensureAscendingTimes(frame, 0); got != frame {
+		t.Error("already-ascending input should be returned as-is")
+	}
+}
+
+// --- shapeFrames ---
+
+// wideMetricsFrame is a long result of (time, host, cpu, mem, disk) for two
+// hosts over two times, with the columns in the given order. mem is NULL
+// where memNull is set.
+func wideMetricsFrame(order []string, memNull bool) *data.Frame {
+	t1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	f64 := func(v float64) *float64 { return &v }
+	mem := []*float64{f64(50), f64(60), f64(51), f64(61)}
+	if memNull {
+		mem = make([]*float64, 4)
+	}
+	columns := map[string]*data.Field{
+		"time": data.NewField("time", nil, []time.Time{t1, t1, t2, t2}),
+		"host": data.NewField("host", nil, []string{"a", "b", "a", "b"}),
+		"cpu":  data.NewField("cpu", nil, []*float64{f64(1), f64(2), f64(3), f64(4)}),
+		"mem":  data.NewField("mem", nil, mem),
+		"disk": data.NewField("disk", nil, []*float64{f64(10), f64(20), f64(30), f64(40)}),
+	}
+	frame := data.NewFrame("").SetMeta(&data.FrameMeta{})
+	for _, name := range order {
+		frame.Fields = append(frame.Fields, columns[name])
+	}
+	return frame
+}
+
+// seriesByName indexes the value fields of a wide frame as "name{host}".
+func seriesByName(t *testing.T, frame *data.Frame) map[string]*data.Field {
+	t.Helper()
+	out := map[string]*data.Field{}
+	for _, f := range frame.Fields {
+		if f.Type().Time() {
+			continue
+		}
+		if len(f.Labels) != 1 {
+			t.Errorf("field %q has labels %v, want host only", f.Name, f.Labels)
+		}
+		out[f.Name+"{"+f.Labels["host"]+"}"] = f
+	}
+	return out
+}
+
+// TestShapeFrames_SeveralValueColumns: each numeric column becomes its own
+// series per host, whatever the column order.
+func TestShapeFrames_SeveralValueColumns(t *testing.T) {
+	for _, order := range [][]string{
+		{"time", "host", "cpu", "mem", "disk"},
+		{"disk", "host", "mem", "time", "cpu"},
+		{"cpu", "mem", "disk", "host", "time"},
+	} {
+		t.Run(strings.Join(order, ","), func(t *testing.T) {
+			frames := shapeFrames(wideMetricsFrame(order, false), ArcQuery{})
+			if len(frames) != 1 || frames[0].Meta.Type != data.FrameTypeTimeSeriesWide {
+				t.Fatalf("got %d frames, %+v", len(frames), frames[0].Meta)
+			}
+			series := seriesByName(t, frames[0])
+			want := map[string]float64{
+				"cpu{a}": 3, "cpu{b}": 4, "mem{a}": 51, "mem{b}": 61, "disk{a}": 30, "disk{b}": 40,
+			}
+			if len(series) != len(want) {
+				t.Fatalf("got series %v", series)
+			}
+			for name, last := range want {
+				f := series[name]
+				if f == nil {
+					t.Errorf("missing series %s", name)
+					continue
+				}
+				if v, _ := f.ConcreteAt(f.Len() - 1); v != last {
+					t.Errorf("%s: last value %v, want %v", name, v, last)
+				}
+			}
+		})
+	}
+}
+
+// TestShapeFrames_AllNullValueColumn: a value column with nothing but NULLs
+// that arrives as strings (no declared type) stays a value series rather
+// than becoming a mem="" label on every series.
+func TestShapeFrames_AllNullValueColumn(t *testing.T) {
+	frame := wideMetricsFrame([]string{"time", "host", "cpu", "mem", "disk"}, true)
+	frame.Fields[3] = data.NewField("mem", nil, make([]*string, 4))
+
+	series := seriesByName(t, shapeFrames(frame, ArcQuery{})[0])
+	for _, name := range []string{"cpu{a}", "cpu{b}", "mem{a}", "mem{b}", "disk{a}", "disk{b}"} {
+		if series[name] == nil {
+			t.Errorf("missing series %s (got %d series)", name, len(series))
+		}
+	}
+	if f := series["mem{a}"]; f != nil {
+		if _, ok := f.ConcreteAt(0); ok {
+			t.Error("all-NULL mem series has a value")
+		}
+	}
+}
+
+// --- toTableLayout ---
+
+// TestToTableLayout_TwoLabelRoundTrip round-trips a two-label dataset: the
+// wide frame becomes tidy long rows (time, labels as columns, value) and
+// tableLayout "wide" rebuilds the same labelled series from those rows.
+func TestToTableLayout_TwoLabelRoundTrip(t *testing.T) {
+	t1 := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	wide := data.NewFrame("A",
+		data.NewField("time", nil, []time.Time{t1, t2}),
+		data.NewField("usage", data.Labels{"host": "a", "dc": "east"}, []float64{1, 2}),
+		data.NewField("usage", data.Labels{"host": "b", "dc": "west"}, []float64{3, 4}),
+	)
+	wide.RefID = "A"
+	wide.Meta = &data.FrameMeta{Notices: []data.Notice{{Text: "kept"}}}
+
+	frames := prepareFrames(wide, ArcQuery{RefID: "A", Format: "table"})
+	long := frames[0]
+	if long.TimeSeriesSchema().Type != data.TimeSeriesTypeLong || frameHasLabels(long) {
+		t.Fatalf("expected a label-free long frame, got fields %v", fieldNames(long))
+	}
+	if long.Rows() != 4 || len(long.Fields) != 4 {
+		t.Fatalf("expected 4 rows x (time, usage, dc, host), got %d rows, fields %v", long.Rows(), fieldNames(long))
+	}
+	if long.RefID != "A" || long.Meta.Type != data.FrameTypeTable || len(long.Meta.Notices) != 1 {
+		t.Errorf("refId/meta not carried through: %q %+v", long.RefID, long.Meta)
+	}
+
+	back := toTableLayout(long, tableLayoutWide)
+	if back.TimeSeriesSchema().Type != data.TimeSeriesTypeWide || len(back.Fields) != 3 || back.Rows() != 2 {
+		t.Fatalf("expected wide frame with 2 series x 2 rows, got fields %v rows %d", fieldNames(back), back.Rows())
+	}
+	for _, f := range back.Fields[1:] {
+		want := map[string][]float64{"a": {1, 2}, "b": {3, 4}}[f.Labels["host"]]
+		for i, w := range want {
+			if v, _ := f.FloatAt(i); v != w {
+				t.Errorf("series %v row %d = %v, want %v", f.Labels, i, v, w)
+			}
+		}
+		if dc := map[string]string{"a": "east", "b": "west"}[f.Labels["host"]]; f.Labels["dc"] != dc {
+			t.Errorf("series %v lost its dc label", f.Labels)
+		}
+	}
+
+	// Explicit "wide" leaves the wide input as-is.
+	if got := toTableLayout(wide, tableLayoutWide); got != wide {
+		t.Error("tableLayout wide should not touch an already-wide frame")
+	}
+}
+
+// --- toNumericTable ---
+
+// TestToNumericTable_WideRoundTrip converts a wide frame with labelled value
+// fields into the numeric table shape: one row per time+label tuple with the
+// label flattened back into a string column.
+func TestToNumericTable_WideRoundTrip(t *testing.T) {
+	t1 := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
+	t2 := time.Date(2026, 2, 18, 11, 0, 0, 0, time.UTC)
+	wide := data.NewFrame("A",
+		data.NewField("time", nil, []time.Time{t1, t2}),
+		data.NewField("usage", data.Labels{"host": "b"}, []float64{3, 4}),
+		data.NewField("usage", data.Labels{"host": "a"}, []float64{1, 2}),
+	)
+	wide.RefID = "A"
+
+	got := toNumericTable(wide)
+
+	wantNames := []string{"time", "usage", "host"}
+	if len(got.Fields) != len(wantNames) {
+		t.Fatalf("expected %d fields, got %d", len(wantNames), len(got.Fields))
+	}
+	for i, name := range wantNames {
+		if got.Fields[i].Name != name {
+			t.Errorf("field %d: expected %q, got %q", i, name, got.Fields[i].Name)
+		}
+		if len(got.Fields[i].Labels) != 0 {
+			t.Errorf("field %q should carry no labels, got %v", name, got.Fields[i].Labels)
+		}
+	}
+	wantRows := []struct {
+		time  time.Time
+		usage float64
+		host  string
+	}{
+		{t1, 1, "a"}, {t1, 3, "b"}, {t2, 2, "a"}, {t2, 4, "b"},
+	}
+	if got.Rows() != len(wantRows) {
+		t.Fatalf("expected %d rows, got %d", len(wantRows), got.Rows())
+	}
+	for i, want := range wantRows {
+		ts, _ := toTime(got.Fields[0].At(i))
+		usage, _ := got.Fields[1].ConcreteAt(i)
+		host, _ := got.Fields[2].ConcreteAt(i)
+		if !ts.Equal(want.time) || usage != want.usage || host != want.host {
+			t.Errorf("row %d: got (%v, %v, %v), want (%v, %v, %v)", i, ts, usage, host, want.time, want.usage, want.host)
+		}
+	}
+	if got.RefID != "A" || got.Meta.Type != data.FrameTypeTimeSeriesLong {
+		t.Errorf("unexpected refId/meta: %q %+v", got.RefID, got.Meta)
+	}
+}
+
+// TestToNumericTable_LongInputStableOrder locks in that long input arriving
+// with an arbitrary column order ends up in the same layout as the wide path.
+func TestToNumericTable_LongInputStableOrder(t *testing.T) {
+	t1 := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)
+	long := data.NewFrame("",
+		data.NewField("host", nil, []string{"a"}),
+		data.NewField("usage", nil, []float64{1}),
+		data.NewField("time", nil, []time.Time{t1}),
+		data.NewField("idle", nil, []float64{9}),
+	)
+
+	got := toNumericTable(long)
+
+	for i, name := range []string{"time", "idle", "usage", "host"} {
+		if got.Fields[i].Name != name {
+			t.Errorf("field %d: expected %q, got %q", i, name, got.Fields[i].Name)
+		}
+	}
+}
+
+func TestToNumericTable_NoTimeColumn(t *testing.T) {
+	frame := data.NewFrame("",
+		data.NewField("host", nil, []string{"a"}),
+		data.NewField("count", nil, []float64{1}),
+	)
+	got := toNumericTable(frame)
+	if got.Fields[0].Name != "count" || got.Meta.Type != data.FrameTypeNumericLong {
+		t.Errorf("expected numeric-long with value first, got %q / %s", got.Fields[0].Name, got.Meta.Type)
+	}
+}
+
 // --- containsLIMIT ---
 
 func TestContainsLIMIT(t *testing.T) {
@@ -418,6 +858,15 @@ func TestContainsLIMIT(t *testing.T) {
 		{"SELECT limited FROM t", false},                            // "limited" is not " LIMIT "
 		{"SELECT * FROM t WHERE name = 'THE LIMIT 10'", false},      // LIMIT inside string literal
 		{"SELECT * FROM t WHERE desc = 'NO LIMIT ' ORDER BY id", false}, // LIMIT inside string literal with trailing space
+
+		// Whitespace around the keyword
+		{"SELECT * FROM t\nLIMIT 10", true},
+		{"SELECT * FROM t\nLIMIT\n10", true},
+		{"SELECT * FROM t\tlImIt\t10", true},
+		{"SELECT * FROM t\r\nLIMIT\r\n  $limit", true},
+		{"SELECT * FROM t WHERE x = 1LIMIT 10", false},
+		// Nested: still a LIMIT for the splitting heuristics
+		{"SELECT * FROM (SELECT * FROM t LIMIT 5) s", true},
 	}
 	for _, c := range cases {
 		result := containsLIMIT(newStrippedSQL(c.sql))
@@ -427,6 +876,31 @@ func TestContainsLIMIT(t *testing.T) {
 	}
 }
 
+func TestContainsTopLevelLIMIT(t *testing.T) {
+	cases := []struct {
+		sql      string
+		expected bool
+	}{
+		{"SELECT * FROM t LIMIT 10", true},
+		{"SELECT * FROM t\nLIMIT\n10", true},
+		{"SELECT * FROM t\n\tLimit\t10", true},
+		{"SELECT * FROM t LIMIT (SELECT max(n) FROM cap)", true},
+		{"SELECT * FROM (SELECT * FROM t LIMIT 5) s LIMIT 10", true},
+		{"SELECT * FROM (SELECT * FROM t LIMIT 5) s", false},
+		{"SELECT * FROM (\n  SELECT * FROM t\n  LIMIT 5\n) s", false},
+		{"WITH top AS (SELECT * FROM t LIMIT 5) SELECT * FROM top", false},
+		{"SELECT * FROM t WHERE host IN (SELECT host FROM h ORDER BY n LIMIT 3)", false},
+		{"SELECT * FROM t WHERE note = ') LIMIT 10'", false},
+		{"SELECT * FROM t -- LIMIT 10", false},
+		{"SELECT limited FROM t", false},
+	}
+	for _, c := range cases {
+		if got := containsTopLevelLIMIT(newStrippedSQL(c.sql)); got != c.expected {
+			t.Errorf("containsTopLevelLIMIT(%q): expected %v, got %v", c.sql, c.expected, got)
+		}
+	}
+}
+
 // --- containsAggregationWithoutTimeGroup ---
 
 func TestContainsAggregationWithoutTimeGroup(t *testing.T) {
@@ -547,6 +1021,392 @@ func TestExpandTimeGroup_MalformedInput(t *testing.T) {
 	}
 }
 
+// TestExpandTimeGroupWithOrigin pins the origin-aligned bucket SQL. Only
+// the origin's offset within one bucket width reaches the SQL, so an origin
+// before the range and one years after it generate identical buckets.
+// 342000s is Monday 00:00 CET relative to the epoch's Thursday; 82800s is
+// midnight CET relative to UTC midnight.
+func TestExpandTimeGroupWithOrigin(t *testing.T) {
+	cases := []struct {
+		name, origin, interval, want string
+	}{
+		{
+			name:     "no origin keeps epoch alignment",
+			interval: "1w",
+			want:     "to_timestamp((epoch_ns(time) // 1000000000 // 604800) * 604800)",
+		},
+		{
+			name:     "Monday weeks, origin before the range",
+			origin:   "2026-01-05T00:00:00+01:00",
+			interval: "1w",
+			want:     "to_timestamp(((epoch_ns(time) // 1000000000 - 342000) // 604800) * 604800 + 342000)",
+		},
+		{
+			name:     "Monday weeks, origin after the range",
+			origin:   "2030-01-07T00:00:00+01:00",
+			interval: "1w",
+			want:     "to_timestamp(((epoch_ns(time) // 1000000000 - 342000) // 604800) * 604800 + 342000)",
+		},
+		{
+			name:     "Berlin days",
+			origin:   "2026-01-05T00:00:00+01:00",
+			interval: "1d",
+			want:     "to_timestamp(((epoch_ns(time) // 1000000000 - 82800) // 86400) * 86400 + 82800)",
+		},
+		{
+			name:     "origin on the epoch grid needs no shift",
+			origin:   "2026-01-05T00:00:00Z",
+			interval: "1h",
+			want:     "to_timestamp((epoch_ns(time) // 1000000000 // 3600) * 3600)",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			origin, err := resolveBucketOrigin(c.origin, backend.TimeRange{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := expandTimeGroupWithOrigin("$__timeGroup(time, '"+c.interval+"')", origin)
+			if got != c.want {
+				t.Errorf("expected:\n  %s\ngot:\n  %s", c.want, got)
+			}
+		})
+	}
+}
+
+// TestBucketOrigin_BoundaryArithmetic evaluates the generated bucket formula
+// in Go: with a Monday-Berlin origin, Sunday 23:59 CET still belongs to the
+// previous week and Monday 00:00 CET starts a new one, whichever side of
+// the data the origin lies on.
+func TestBucketOrigin_BoundaryArithmetic(t *testing.T) {
+	const week = int64(7 * 24 * 3600)
+	cet := time.FixedZone("CET", 3600)
+	bucket := func(ts time.Time, origin time.Time) time.Time {
+		off := originOffset(origin, week)
+		return time.Unix((ts.Unix()-off)/week*week+off, 0)
+	}
+	monday := time.Date(2026, 2, 16, 0, 0, 0, 0, cet)
+	for _, origin := range []string{"2026-01-05T00:00:00+01:00", "2030-01-07T00:00:00+01:00"} {
+		o, err := time.Parse(time.RFC3339, origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bucket(monday, o); !got.Equal(monday) {
+			t.Errorf("origin %s: Monday 00:00 in bucket %s, want %s", origin, got, monday)
+		}
+		if got, want := bucket(monday.Add(-time.Minute), o), monday.AddDate(0, 0, -7); !got.Equal(want) {
+			t.Errorf("origin %s: Sunday 23:59 in bucket %s, want %s", origin, got, want)
+		}
+		if got := bucket(monday.Add(6*24*time.Hour+23*time.Hour), o); !got.Equal(monday) {
+			t.Errorf("origin %s: following Sunday 23:00 in bucket %s, want %s", origin, got, monday)
+		}
+	}
+}
+
+func TestResolveBucketOrigin(t *testing.T) {
+	tr := backend.TimeRange{
+		From: time.Date(2026, 2, 18, 10, 37, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 19, 10, 37, 0, 0, time.UTC),
+	}
+	if got, err := resolveBucketOrigin("", tr); err != nil || !got.IsZero() {
+		t.Errorf("empty origin: got %v, %v; want zero time", got, err)
+	}
+	if got, err := resolveBucketOrigin(bucketOriginStartOfRange, tr); err != nil || !got.Equal(tr.From) {
+		t.Errorf("startOfRange: got %v, %v; want %v", got, err, tr.From)
+	}
+	for _, bad := range []string{"monday", "2026-01-05", "startofrange"} {
+		if _, err := resolveBucketOrigin(bad, tr); !errors.Is(err, errInvalidBucketOrigin) {
+			t.Errorf("%q: expected errInvalidBucketOrigin, got %v", bad, err)
+		}
+	}
+}
+
+// TestSplitTimeRangeFrom_AlignsChunksToBucketOrigin pins the chunk/bucket
+// interplay: with a bucket origin the internal chunk boundaries move onto
+// the origin's grid, so no $__timeGroup bucket straddles two chunks. With
+// epoch-aligned chunks a Berlin-midnight day bucket would be cut at UTC
+// midnight and aggregated twice.
+func TestSplitTimeRangeFrom_AlignsChunksToBucketOrigin(t *testing.T) {
+	origin, _ := time.Parse(time.RFC3339, "2026-01-05T00:00:00+01:00")
+	from := time.Date(2026, 2, 18, 10, 37, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 21, 5, 12, 0, 0, time.UTC)
+	chunks := splitTimeRangeFrom(from, to, 24*time.Hour, origin, 0)
+
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d: %v", len(chunks), chunks)
+	}
+	expect(t, chunks[0].From, from, "first chunk start")
+	expect(t, chunks[0].To, time.Date(2026, 2, 18, 23, 0, 0, 0, time.UTC), "first boundary at Berlin midnight")
+	expect(t, chunks[len(chunks)-1].To, to, "last chunk end")
+	for i := 0; i < len(chunks)-1; i++ {
+		if !chunks[i].To.Equal(chunks[i+1].From) {
+			t.Errorf("gap between chunk %d and %d", i, i+1)
+		}
+		if off := chunks[i].To.Unix() % 86400; off != 82800 {
+			t.Errorf("internal boundary %v is not on the origin's day grid (offset %d)", chunks[i].To, off)
+		}
+	}
+
+	// startOfRange resolves against the original range, so the grid starts
+	// at From and the first chunk is a full one.
+	start, _ := resolveBucketOrigin(bucketOriginStartOfRange, backend.TimeRange{From: from, To: to})
+	chunks = splitTimeRangeFrom(from, to, 24*time.Hour, start, 0)
+	expect(t, chunks[0].To, from.Add(24*time.Hour), "startOfRange first boundary")
+}
+
+// TestSplitTimeRangeFrom_DST: with a zone bucket origin, day chunks over a
+// DST change are 23 or 25 hours, start at local midnight and meet end to
+// start.
+func TestSplitTimeRangeFrom_DST(t *testing.T) {
+	berlin, err := resolveBucketOrigin("Europe/Berlin", backend.TimeRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := berlin.Location()
+	for _, c := range []struct {
+		name     string
+		from, to time.Time
+		chunk    time.Duration
+		want     []time.Duration // lengths of the chunks after the first
+	}{
+		{"spring forward", time.Date(2026, 3, 27, 10, 0, 0, 0, time.UTC), time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC), 24 * time.Hour,
+			[]time.Duration{24 * time.Hour, 23 * time.Hour, 24 * time.Hour, 14 * time.Hour}},
+		{"fall back", time.Date(2026, 10, 23, 10, 0, 0, 0, time.UTC), time.Date(2026, 10, 27, 12, 0, 0, 0, time.UTC), 24 * time.Hour,
+			[]time.Duration{24 * time.Hour, 25 * time.Hour, 24 * time.Hour, 13 * time.Hour}},
+		{"12h over fall back", time.Date(2026, 10, 24, 21, 0, 0, 0, time.UTC), time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC), 12 * time.Hour,
+			[]time.Duration{12 * time.Hour, 12 * time.Hour, time.Hour, time.Hour}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			chunks := splitTimeRangeFrom(c.from, c.to, c.chunk, berlin, 0)
+			if len(chunks) != len(c.want)+1 {
+				t.Fatalf("got %d chunks, want %d: %v", len(chunks), len(c.want)+1, chunks)
+			}
+			if n := countChunks(c.from, c.to, c.chunk, berlin); n != len(chunks) {
+				t.Errorf("countChunks = %d, want %d", n, len(chunks))
+			}
+			expect(t, chunks[0].From, c.from, "first chunk start")
+			expect(t, chunks[len(chunks)-1].To, c.to, "last chunk end")
+			for i, chunk := range chunks[1:] {
+				if !chunks[i].To.Equal(chunk.From) {
+					t.Errorf("gap between chunk %d and %d", i, i+1)
+				}
+				if got := chunk.To.Sub(chunk.From); got != c.want[i] {
+					t.Errorf("chunk %d is %v, want %v", i+1, got, c.want[i])
+				}
+				if local := chunk.From.In(loc); c.chunk == 24*time.Hour && (local.Hour() != 0 || local.Minute() != 0) {
+					t.Errorf("chunk %d starts at %v, not local midnight", i+1, local)
+				}
+			}
+		})
+	}
+
+	// Grown past maxSplitChunks, a zone-aligned chunk stays zone-aligned:
+	// 6h grows through 12h and whole days, never 18h.
+	from := time.Date(2026, 3, 1, 5, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 60)
+	if got := capChunkSize(from, to, 6*time.Hour, berlin, 20); got%(24*time.Hour) != 0 {
+		t.Errorf("capChunkSize = %v, want whole days", got)
+	}
+	capped := splitTimeRangeFrom(from, to, 6*time.Hour, berlin, 20)
+	if len(capped) > 20 {
+		t.Errorf("%d chunks, want at most 20", len(capped))
+	}
+	for _, chunk := range capped[1:] {
+		if local := chunk.From.In(loc); local.Hour() != 0 {
+			t.Errorf("capped chunk starts at %v, not local midnight", local)
+		}
+	}
+}
+
+// TestQuery_BucketOriginZone runs a 1d split over Berlin's spring-forward
+// with bucketOrigin "Europe/Berlin": each chunk's filter starts at local
+// midnight, and the day buckets use the zone's offsets.
+func TestQuery_BucketOriginZone(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = append(sent, body.SQL)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"columns":["time","v"],"data":[["2026-03-29T00:00:00Z",1]]}`))
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	q, _ := json.Marshal(map[string]interface{}{
+		"sql":           "SELECT $__timeGroup(time, '1d') AS time, avg(v) AS v FROM cpu WHERE $__timeFilter(time) GROUP BY 1",
+		"format":        "table",
+		"splitDuration": "1d",
+		"bucketOrigin":  "Europe/Berlin",
+	})
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: time.Date(2026, 3, 28, 12, 0, 0, 0, time.UTC), To: time.Date(2026, 3, 30, 12, 0, 0, 0, time.UTC)},
+		JSON:      q,
+	})
+	if resp.Error != nil {
+		t.Fatalf("query error: %v", resp.Error)
+	}
+	lowerBound := regexp.MustCompile(`>= '([^']+)'`)
+	var starts []string
+	for _, sql := range sent {
+		m := lowerBound.FindStringSubmatch(sql)
+		if m == nil {
+			t.Fatalf("no time bound in %q", sql)
+		}
+		starts = append(starts, m[1])
+		if !strings.Contains(sql, "THEN 3600 ELSE 7200 END") {
+			t.Errorf("day buckets don't follow the CET/CEST change: %q", sql)
+		}
+	}
+	slices.Sort(starts)
+	want := []string{"2026-03-28T12:00:00Z", "2026-03-28T23:00:00Z", "2026-03-29T22:00:00Z"}
+	if !slices.Equal(starts, want) {
+		t.Errorf("chunk starts = %v, want %v", starts, want)
+	}
+}
+
+// TestSplitTimeRange_MaxChunks pins the maxSplitChunks cap: a 1h split of
+// two years grows to the smallest multiple of 1h that fits in 100 chunks,
+// and the chunks stay contiguous and on the grown size's grid.
+func TestSplitTimeRange_MaxChunks(t *testing.T) {
+	from := time.Date(2024, 3, 8, 10, 37, 0, 0, time.UTC)
+	to := from.AddDate(2, 0, 0)
+	chunks := splitTimeRange(from, to, time.Hour, 100)
+	if len(chunks) > 100 || len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want 2 to 100", len(chunks))
+	}
+	size := capChunkSize(from, to, time.Hour, time.Time{}, 100)
+	if size%time.Hour != 0 {
+		t.Fatalf("grown chunk %v is not a multiple of 1h", size)
+	}
+	if n := countChunks(from, to, size-time.Hour, time.Time{}); n <= 100 {
+		t.Errorf("%v already fits in %d chunks; %v is not the smallest multiple", size-time.Hour, n, size)
+	}
+	expect(t, chunks[0].From, from, "first chunk start")
+	expect(t, chunks[len(chunks)-1].To, to, "last chunk end")
+	secs := int64(size.Seconds())
+	for i := 0; i < len(chunks)-1; i++ {
+		if !chunks[i].To.Equal(chunks[i+1].From) {
+			t.Errorf("gap between chunk %d and %d", i, i+1)
+		}
+		if chunks[i].To.Unix()%secs != 0 {
+			t.Errorf("internal boundary %v is not on the %v grid", chunks[i].To, size)
+		}
+	}
+
+	// Under the cap, or with no cap, the requested size is kept.
+	if got := len(splitTimeRange(from, to, time.Hour, 0)); got != countChunks(from, to, time.Hour, time.Time{}) || got <= 100 {
+		t.Errorf("uncapped: %d chunks", got)
+	}
+	if got := capChunkSize(from, from.Add(48*time.Hour), time.Hour, time.Time{}, 100); got != time.Hour {
+		t.Errorf("48 chunks under a cap of 100 grew to %v", got)
+	}
+}
+
+func TestSplitTimeRangeFrom_MaxChunksKeepsOriginGrid(t *testing.T) {
+	origin, _ := time.Parse(time.RFC3339, "2026-01-05T00:00:00+01:00")
+	from := time.Date(2026, 1, 18, 10, 37, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 60)
+	chunks := splitTimeRangeFrom(from, to, 24*time.Hour, origin, 10)
+	if len(chunks) > 10 {
+		t.Fatalf("got %d chunks, want at most 10", len(chunks))
+	}
+	size := capChunkSize(from, to, 24*time.Hour, origin, 10)
+	secs := int64(size.Seconds())
+	for i := 0; i < len(chunks)-1; i++ {
+		if off := (chunks[i].To.Unix() - origin.Unix()) % secs; off != 0 {
+			t.Errorf("internal boundary %v is %ds off the origin's %v grid", chunks[i].To, off, size)
+		}
+	}
+}
+
+// TestAutoSplitDuration_MaxChunks: the auto size is capped where the split
+// is made, like an explicit one, growing to a multiple of the ladder's 7d.
+func TestAutoSplitDuration_MaxChunks(t *testing.T) {
+	to := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	tr := backend.TimeRange{From: to.AddDate(-1, 0, 0), To: to}
+	dur, ok := autoSplitDuration(tr)
+	if !ok || dur != 7*24*time.Hour {
+		t.Fatalf("autoSplitDuration(1y) = %v, %v; want 7d", dur, ok)
+	}
+	if grown := capChunkSize(tr.From, tr.To, dur, time.Time{}, 10); grown%dur != 0 || grown == dur {
+		t.Errorf("capChunkSize(1y, 7d, 10) = %v, want a multiple of 7d above 7d", grown)
+	}
+	if n := len(splitTimeRange(tr.From, tr.To, dur, 10)); n > 10 {
+		t.Errorf("%d chunks, want at most 10", n)
+	}
+}
+
+func TestCountChunks_MatchesSplitTimeRangeFrom(t *testing.T) {
+	origin, _ := time.Parse(time.RFC3339, "2026-01-05T00:00:00+01:00")
+	from := time.Date(2026, 2, 18, 10, 37, 0, 0, time.UTC)
+	for _, to := range []time.Time{from.Add(time.Minute), from.Add(83 * time.Minute), from.AddDate(0, 0, 9).Add(17 * time.Minute)} {
+		for _, size := range []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour} {
+			for _, o := range []time.Time{{}, origin} {
+				if got, want := countChunks(from, to, size, o), len(splitTimeRangeFrom(from, to, size, o, 0)); got != want {
+					t.Errorf("countChunks(%v, %v, origin %v) = %d, want %d", to.Sub(from), size, o, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestQuery_MaxSplitChunksNotice checks that a query past maxSplitChunks
+// runs in fewer, larger chunks and says so, with an explicit splitDuration
+// and with the auto one.
+func TestQuery_MaxSplitChunksNotice(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"columns":["time","v"],"data":[["2026-03-08T00:30:00Z",1]]}`))
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name, split string
+		span        time.Duration
+		want        string
+	}{
+		{"explicit", `,"splitDuration":"1h"`, 12 * time.Hour,
+			"Split into 3h chunks instead of 1h: the range would take 12 chunks, more than the datasource's limit of 4."},
+		{"auto", "", 48 * time.Hour,
+			"Split into 12h chunks instead of 6h: the range would take 8 chunks, more than the datasource's limit of 4."},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			requests.Store(0)
+			resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+				PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "maxSplitChunks": 4}),
+				Queries: []backend.DataQuery{{
+					RefID:     "A",
+					TimeRange: backend.TimeRange{From: from, To: from.Add(c.span)},
+					JSON:      []byte(`{"sql":"SELECT time, v FROM t WHERE $__timeFilter(time)","format":"table"` + c.split + `}`),
+				}},
+			})
+			if err != nil {
+				t.Fatalf("QueryData: %v", err)
+			}
+			r := resp.Responses["A"]
+			if r.Error != nil {
+				t.Fatalf("query error: %v", r.Error)
+			}
+			if n := requests.Load(); n != 4 {
+				t.Errorf("%d requests to Arc, want 4", n)
+			}
+			if texts := noticeTexts(r.Frames[0]); !slices.Contains(texts, c.want) {
+				t.Errorf("notices = %q, want %q", texts, c.want)
+			}
+		})
+	}
+}
+
 // --- intervalToSeconds ---
 
 func TestIntervalToSeconds(t *testing.T) {
@@ -566,6 +1426,11 @@ func TestIntervalToSeconds(t *testing.T) {
 		{"10 minutes", 600},
 		{"1 hour", 3600},
 		{"1 day", 86400},
+		{"15m", 900},
+		{"90s", 90},
+		{"2h30m", 9000},
+		{"1w", 604800},
+		{"30 seconds", 30},
 	}
 	for _, c := range cases {
 		result, ok := intervalToSeconds(c.input)
@@ -641,6 +1506,83 @@ func TestApplyMacros_Interval(t *testing.T) {
 	}
 }
 
+// TestQuery_PanelInterval checks $__interval and $__interval_ms come from
+// the DataQuery's Interval, in every chunk of a split query, and that
+// MaxDataPoints coarsens an interval too fine for the panel.
+func TestQuery_PanelInterval(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = append(sent, body.SQL)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"columns":["time","v"],"data":[["2026-02-18T00:00:00Z",1]]}`))
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name          string
+		split         string
+		maxDataPoints int64
+		want          string
+	}{
+		{name: "single", split: "off", want: "(epoch_ns(time) // 1000000000 // 30) * 30) AS time, 30000 AS ms"},
+		{name: "split", split: "1d", want: "(epoch_ns(time) // 1000000000 // 30) * 30) AS time, 30000 AS ms"},
+		// 3d / 300 points = 864s, rounded up to 15 minutes.
+		{name: "narrow panel", split: "off", maxDataPoints: 300, want: "(epoch_ns(time) // 1000000000 // 900) * 900) AS time, 900000 AS ms"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mu.Lock()
+			sent = nil
+			mu.Unlock()
+			inst := newTestInstance(t, srv.URL)
+			useJSON := false
+			inst.settings.UseArrow = &useJSON
+			q, _ := json.Marshal(map[string]interface{}{
+				"sql":           "SELECT $__timeGroup(time, '$__interval') AS time, $__interval_ms AS ms, avg(v) AS v FROM cpu WHERE $__timeFilter(time) GROUP BY 1",
+				"format":        "table",
+				"splitDuration": c.split,
+			})
+			resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+				RefID:         "A",
+				TimeRange:     backend.TimeRange{From: from, To: from.Add(72 * time.Hour)},
+				Interval:      30 * time.Second,
+				MaxDataPoints: c.maxDataPoints,
+				JSON:          q,
+			})
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(sent) == 0 {
+				t.Fatal("no query reached Arc")
+			}
+			for _, sql := range sent {
+				if !strings.Contains(sql, c.want) {
+					t.Errorf("expected %q in: %s", c.want, sql)
+				}
+			}
+		})
+	}
+
+	got := ApplyMacros("GROUP BY $__interval", backend.TimeRange{From: from, To: from.Add(72 * time.Hour)})
+	if got != "GROUP BY 10 minutes" {
+		t.Errorf("without a panel interval, expected the ladder's 10 minutes: %s", got)
+	}
+	got = applyMacrosWith("GROUP BY $__interval", backend.TimeRange{From: from, To: from.Add(72 * time.Hour)},
+		backend.DataQuery{TimeRange: backend.TimeRange{From: from, To: from.Add(72 * time.Hour)}, Interval: 30 * time.Second}, time.Time{})
+	if got != "GROUP BY 30 seconds" {
+		t.Errorf("expected a 30s panel interval to give 30 seconds: %s", got)
+	}
+}
+
 // TestApplyMacros_TimeFilter_MultipleOccurrences locks in the searchFrom
 // advancement after a successful expansion: a second macro in the same SQL
 // must also expand, exactly once, with the same time bounds.
@@ -769,6 +1711,23 @@ func TestApplyMacros_NotExpandedInsideComment(t *testing.T) {
 	}
 }
 
+// TestApplyMacros_EscapedQuotesAndBlockComments: an escaped quote doesn't
+// end a literal early, and block comments (and comment markers inside
+// literals) are handled like line comments.
+func TestApplyMacros_EscapedQuotesAndBlockComments(t *testing.T) {
+	tr := backend.TimeRange{
+		From: time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 18, 11, 0, 0, 0, time.UTC),
+	}
+	sql := "SELECT 'it''s $__timeFrom()' AS a, '/* $__timeTo() */' AS b /* $__timeFilter(time) */\n" +
+		"FROM t WHERE s = '--' AND $__timeFilter(time) -- $__interval"
+	want := "SELECT 'it''s $__timeFrom()' AS a, '/* $__timeTo() */' AS b /* $__timeFilter(time) */\n" +
+		"FROM t WHERE s = '--' AND time >= '2026-02-18T10:00:00Z' AND time < '2026-02-18T11:00:00Z' -- $__interval"
+	if got := ApplyMacros(sql, tr); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
 // TestApplyMacros_TimeFilter_NestedParens locks in the paren-matching fix:
 // $__timeFilter(COALESCE(t1, t2)) used to find the FIRST `)` and produce
 // broken SQL. Now we leave it un-expanded because the column arg isn't a
@@ -799,6 +1758,119 @@ func TestApplyMacros_TimeFilter_NestedParens(t *testing.T) {
 	}
 }
 
+// TestApplyMacros_PreviousPeriod locks in the previous-period boundary
+// arithmetic: the window has the same absolute duration as the dashboard
+// range and ends exactly at From. The DST cases pin that a range crossing a
+// clock change compares against the same number of real hours (23h or 25h),
+// not the previous calendar day.
+func TestApplyMacros_PreviousPeriod(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	cases := []struct {
+		name             string
+		from, to         time.Time
+		prevFrom, prevTo string
+	}{
+		{
+			name:     "one hour UTC",
+			from:     time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC),
+			to:       time.Date(2026, 2, 18, 11, 0, 0, 0, time.UTC),
+			prevFrom: "2026-02-18T09:00:00Z",
+			prevTo:   "2026-02-18T10:00:00Z",
+		},
+		{
+			name:     "seven days across a month boundary",
+			from:     time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC),
+			prevFrom: "2026-02-24T00:00:00Z",
+			prevTo:   "2026-03-03T00:00:00Z",
+		},
+		{
+			// Spring forward: local midnight to midnight is 23 hours.
+			name:     "23h day (DST start)",
+			from:     time.Date(2026, 3, 29, 0, 0, 0, 0, berlin),
+			to:       time.Date(2026, 3, 30, 0, 0, 0, 0, berlin),
+			prevFrom: "2026-03-28T01:00:00+01:00",
+			prevTo:   "2026-03-29T00:00:00+01:00",
+		},
+		{
+			// Fall back: local midnight to midnight is 25 hours.
+			name:     "25h day (DST end)",
+			from:     time.Date(2026, 10, 25, 0, 0, 0, 0, berlin),
+			to:       time.Date(2026, 10, 26, 0, 0, 0, 0, berlin),
+			prevFrom: "2026-10-23T23:00:00+02:00",
+			prevTo:   "2026-10-25T00:00:00+02:00",
+		},
+		{
+			// The previous window itself crosses the change: 3 hours
+			// before 02:00 CET (the second 02:00) is 00:00 CEST.
+			name:     "previous window crosses DST end",
+			from:     time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC).In(berlin), // 02:00 CET
+			to:       time.Date(2026, 10, 25, 4, 0, 0, 0, time.UTC).In(berlin), // 05:00 CET
+			prevFrom: "2026-10-25T00:00:00+02:00",
+			prevTo:   "2026-10-25T02:00:00+01:00",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tr := backend.TimeRange{From: c.from, To: c.to}
+			got := ApplyMacros("WHERE $__timeFilterPrev(ts) AND $__timeFromPrev() < $__timeToPrev()", tr)
+			want := fmt.Sprintf("WHERE ts >= '%s' AND ts < '%s' AND '%s' < '%s'", c.prevFrom, c.prevTo, c.prevFrom, c.prevTo)
+			if got != want {
+				t.Errorf("got  %s\nwant %s", got, want)
+			}
+			pf, _ := time.Parse(time.RFC3339, c.prevFrom)
+			pt, _ := time.Parse(time.RFC3339, c.prevTo)
+			if !pt.Equal(c.from) || pt.Sub(pf) != c.to.Sub(c.from) {
+				t.Errorf("previous window [%s, %s) is not the %s before %s", pf, pt, c.to.Sub(c.from), c.from)
+			}
+		})
+	}
+}
+
+// TestApplyMacros_PreviousPeriodAlongsideCurrent pins that the Prev macros
+// and their non-Prev prefixes ($__timeFilter, $__timeFrom) expand
+// independently in the same query.
+func TestApplyMacros_PreviousPeriodAlongsideCurrent(t *testing.T) {
+	tr := backend.TimeRange{
+		From: time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC),
+	}
+	got := ApplyMacros("WHERE $__timeFilter(ts) OR $__timeFilterPrev(ts) -- $__timeFromPrev()\nAND $__timeFrom() > $__timeFromPrev()", tr)
+	want := "WHERE ts >= '2026-02-18T10:00:00Z' AND ts < '2026-02-18T12:00:00Z' OR ts >= '2026-02-18T08:00:00Z' AND ts < '2026-02-18T10:00:00Z' -- $__timeFromPrev()\nAND '2026-02-18T10:00:00Z' > '2026-02-18T08:00:00Z'"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// TestApplyMacrosWithSplit_PreviousPeriodChunked pins how the previous
+// period splits: each chunk's Prev window is that chunk shifted back by the
+// full range length, so the Prev windows of all chunks tile [From-d, From)
+// exactly as the chunks tile [From, To).
+func TestApplyMacrosWithSplit_PreviousPeriodChunked(t *testing.T) {
+	from := time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC)
+	to := from.Add(3 * time.Hour)
+	original := backend.TimeRange{From: from, To: to}
+	chunks := splitTimeRange(from, to, time.Hour, 0)
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(chunks))
+	}
+	wantPrev := [][2]string{
+		{"2026-02-17T21:00:00Z", "2026-02-17T22:00:00Z"},
+		{"2026-02-17T22:00:00Z", "2026-02-17T23:00:00Z"},
+		{"2026-02-17T23:00:00Z", "2026-02-18T00:00:00Z"},
+	}
+	for i, chunk := range chunks {
+		got := ApplyMacrosWithSplit("WHERE $__timeFilterPrev(ts)", chunk, original)
+		want := fmt.Sprintf("WHERE ts >= '%s' AND ts < '%s'", wantPrev[i][0], wantPrev[i][1])
+		if got != want {
+			t.Errorf("chunk %d: got %s, want %s", i, got, want)
+		}
+	}
+}
+
 // TestExpandTimeGroup_UnknownInterval locks in M4: unknown intervals are no
 // longer silently bucketed at 1h.
 func TestExpandTimeGroup_UnknownInterval(t *testing.T) {
@@ -815,6 +1887,37 @@ func TestExpandTimeGroup_UnknownInterval(t *testing.T) {
 	}
 }
 
+// TestExpandTimeGroup_SameWithAndWithoutSplit pins that $__timeGroup takes
+// any column and any interval IntervalSeconds parses, and expands the same
+// way whether or not the query is split: buckets never depend on the chunk.
+func TestExpandTimeGroup_SameWithAndWithoutSplit(t *testing.T) {
+	original := backend.TimeRange{
+		From: time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 19, 0, 0, 0, 0, time.UTC),
+	}
+	chunk := backend.TimeRange{From: original.From.Add(6 * time.Hour), To: original.From.Add(12 * time.Hour)}
+	cases := []struct {
+		column, interval string
+		secs             int
+	}{
+		{"time", "15m", 900},
+		{"ts", "30 seconds", 30},
+		{"cpu.recorded_at", "90s", 90},
+		{"time", "2h30m", 9000},
+		{"time", "1w", 604800},
+	}
+	for _, c := range cases {
+		sql := fmt.Sprintf("SELECT $__timeGroup(%s, '%s') AS time FROM cpu GROUP BY 1", c.column, c.interval)
+		want := fmt.Sprintf("SELECT to_timestamp((epoch_ns(%s) // 1000000000 // %d) * %d) AS time FROM cpu GROUP BY 1", c.column, c.secs, c.secs)
+		if got := ApplyMacros(sql, original); got != want {
+			t.Errorf("ApplyMacros(%q) =\n%s\nwant\n%s", sql, got, want)
+		}
+		if got := ApplyMacrosWithSplit(sql, chunk, original); got != want {
+			t.Errorf("ApplyMacrosWithSplit(%q) =\n%s\nwant\n%s", sql, got, want)
+		}
+	}
+}
+
 // TestExpandTimeGroup_ExtraArgs locks in M3: extra arguments warn loudly
 // and leave the macro un-expanded.
 func TestExpandTimeGroup_ExtraArgs(t *testing.T) {
@@ -849,31 +1952,310 @@ func TestApplyMacros_TimeFilter_NoInfiniteLoopOnUnclosedParen(t *testing.T) {
 	}
 }
 
-func TestApplyMacrosWithSplit_UsesChunkForFilter_OriginalForInterval(t *testing.T) {
-	chunk := backend.TimeRange{
-		From: time.Date(2026, 2, 18, 6, 0, 0, 0, time.UTC),
-		To:   time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC),
-	}
-	originalRange := backend.TimeRange{
-		From: time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC),
-		To:   time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC), // 8 days (> 7d)
-	}
-
-	sql := "WHERE $__timeFilter(time) GROUP BY $__interval"
-	result := ApplyMacrosWithSplit(sql, chunk, originalRange)
+func TestApplyMacrosWithSplit_UsesChunkForFilter_OriginalForInterval(t *testing.T) {
+	chunk := backend.TimeRange{
+		From: time.Date(2026, 2, 18, 6, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC),
+	}
+	originalRange := backend.TimeRange{
+		From: time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC), // 8 days (> 7d)
+	}
+
+	sql := "WHERE $__timeFilter(time) GROUP BY $__interval"
+	result := ApplyMacrosWithSplit(sql, chunk, originalRange)
+
+	// Time filter should use chunk boundaries
+	if !strings.Contains(result, "2026-02-18T06:00:00Z") {
+		t.Errorf("expected chunk From in filter: %s", result)
+	}
+	// Interval should use original 8d range (> 7d) → "1 hour"
+	if !strings.Contains(result, "1 hour") {
+		t.Errorf("expected '1 hour' interval from 8d original range: %s", result)
+	}
+}
+
+// TestApplyMacrosWithSplit_TimeVersusRangeBounds pins the split rule for
+// the bare bounds: $__timeFrom()/$__timeTo() follow the chunk in every
+// position (WHERE, JOIN condition, CASE), $__rangeFrom()/$__rangeTo() are
+// always the full dashboard range.
+func TestApplyMacrosWithSplit_TimeVersusRangeBounds(t *testing.T) {
+	original := backend.TimeRange{
+		From: time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC),
+	}
+	chunk := backend.TimeRange{
+		From: time.Date(2026, 2, 18, 6, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC),
+	}
+	sql := "SELECT CASE WHEN e.time < $__timeTo() THEN 'in' END AS s, $__rangeFrom() AS range_start, $__rangeTo() AS range_end " +
+		"FROM events e JOIN deploys d ON d.time >= $__timeFrom() AND d.time < $__timeTo() " +
+		"WHERE e.time >= $__timeFrom() -- $__rangeFrom()"
+	want := "SELECT CASE WHEN e.time < '2026-02-18T12:00:00Z' THEN 'in' END AS s, '2026-02-18T00:00:00Z' AS range_start, '2026-02-18T12:00:00Z' AS range_end " +
+		"FROM events e JOIN deploys d ON d.time >= '2026-02-18T06:00:00Z' AND d.time < '2026-02-18T12:00:00Z' " +
+		"WHERE e.time >= '2026-02-18T06:00:00Z' -- $__rangeFrom()"
+	if got := ApplyMacrosWithSplit(sql, chunk, original); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Unsplit, both pairs are the same range.
+	if got := ApplyMacros("$__timeFrom() = $__rangeFrom() AND $__timeTo() = $__rangeTo()", original); got != "'2026-02-18T00:00:00Z' = '2026-02-18T00:00:00Z' AND '2026-02-18T12:00:00Z' = '2026-02-18T12:00:00Z'" {
+		t.Errorf("unsplit bounds differ: %s", got)
+	}
+}
+
+// TestApplyMacros_SubSecondBounds: a range zoomed to a few seconds keeps
+// its sub-second bounds through macro expansion, and split chunks meet at
+// the exact instant instead of overlapping by the truncated fraction.
+func TestApplyMacros_SubSecondBounds(t *testing.T) {
+	from := time.Date(2026, 2, 18, 6, 0, 0, 250_000_000, time.UTC)
+	to := from.Add(3*time.Second + 1)
+	got := ApplyMacros("SELECT * FROM cpu WHERE $__timeFilter(time) AND $__timeFrom() < $__timeTo()", backend.TimeRange{From: from, To: to})
+	want := "SELECT * FROM cpu WHERE time >= '2026-02-18T06:00:00.25Z' AND time < '2026-02-18T06:00:03.250000001Z' AND '2026-02-18T06:00:00.25Z' < '2026-02-18T06:00:03.250000001Z'"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	original := backend.TimeRange{From: from, To: from.Add(3 * time.Hour)}
+	chunks := splitTimeRange(original.From, original.To, time.Hour, 0)
+	for i, chunk := range chunks {
+		sql := ApplyMacrosWithSplit("$__timeFilter(time)", chunk, original)
+		wantSQL := fmt.Sprintf("time >= '%s' AND time < '%s'",
+			chunk.From.Format(time.RFC3339Nano), chunk.To.Format(time.RFC3339Nano))
+		if sql != wantSQL {
+			t.Errorf("chunk %d: got %s, want %s", i, sql, wantSQL)
+		}
+		if i > 0 && !chunk.From.Equal(chunks[i-1].To) {
+			t.Errorf("chunk %d starts at %s, previous ends at %s", i, chunk.From, chunks[i-1].To)
+		}
+	}
+	if !strings.Contains(ApplyMacrosWithSplit("$__timeFilter(time)", chunks[0], original), "'2026-02-18T06:00:00.25Z'") {
+		t.Error("first chunk lost the range's milliseconds")
+	}
+}
+
+// TestQuery_SplitMixesTimeAndRangeBounds runs a split query through the
+// datasource and checks each chunk's SQL: the filter and $__timeFrom()
+// follow the chunk, $__rangeFrom() is the same full-range start in every
+// chunk.
+func TestQuery_SplitMixesTimeAndRangeBounds(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.SQL)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"time", "value"}, "data": []interface{}{}})
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	to := time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC)
+	from := to.Add(-3 * time.Hour)
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: from, To: to},
+		JSON:      []byte(`{"sql":"SELECT time, value, $__rangeFrom() AS range_start FROM cpu WHERE time >= $__timeFrom() AND $__timeFilter(time)","format":"table","splitDuration":"1h"}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(seen))
+	}
+	starts := map[string]bool{}
+	for _, sql := range seen {
+		if !strings.Contains(sql, "'2026-02-18T09:00:00Z' AS range_start") {
+			t.Errorf("$__rangeFrom() should be the full-range start in every chunk: %s", sql)
+		}
+		i := strings.Index(sql, "time >= '")
+		starts[sql[i:i+len("time >= '2026-02-18T09:00:00Z'")]] = true
+	}
+	if len(starts) != 3 {
+		t.Errorf("$__timeFrom() should follow each chunk, got starts %v", starts)
+	}
+}
+
+// TestQuery_SplitMergeConvertKeepsRefIDAndMeta runs long-format chunks
+// through split, merge and long-to-wide conversion (time series, and the
+// wide table layout) and checks every returned frame keeps the RefID, a
+// name and the query-level Meta.
+func TestQuery_SplitMergeConvertKeepsRefIDAndMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"columns": []string{"time", "host", "value"},
+			"data": []interface{}{
+				[]interface{}{"2026-02-18T10:00:00Z", "a", 1.0},
+				[]interface{}{"2026-02-18T10:00:00Z", "b", 2.0},
+			},
+		})
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	to := time.Date(2026, 2, 18, 12, 0, 0, 0, time.UTC)
+	for _, q := range []string{
+		`{"sql":"SELECT time, host, value FROM cpu WHERE $__timeFilter(time)","format":"time_series","splitDuration":"1h"}`,
+		`{"sql":"SELECT time, host, value FROM cpu WHERE $__timeFilter(time)","format":"table","tableLayout":"wide","splitDuration":"1h"}`,
+	} {
+		resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+			RefID:     "B",
+			TimeRange: backend.TimeRange{From: to.Add(-3 * time.Hour), To: to},
+			JSON:      []byte(q),
+		})
+		if resp.Error != nil {
+			t.Fatalf("%s: %v", q, resp.Error)
+		}
+		if len(resp.Frames) == 0 {
+			t.Fatalf("%s: no frames", q)
+		}
+		for _, f := range resp.Frames {
+			if f.RefID != "B" || f.Name != "B" {
+				t.Errorf("%s: frame RefID/Name = %q/%q, want B/B", q, f.RefID, f.Name)
+			}
+			if len(f.Fields) != 3 {
+				t.Errorf("%s: expected the wide frame (time + 2 series), got %d fields", q, len(f.Fields))
+			}
+			if f.Meta == nil || f.Meta.ExecutedQueryString == "" {
+				t.Fatalf("%s: Meta lost ExecutedQueryString: %+v", q, f.Meta)
+			}
+			custom, _ := f.Meta.Custom.(map[string]interface{})
+			if custom["splitChunks"] != 3 {
+				t.Errorf("%s: expected splitChunks=3 in Meta.Custom, got %v", q, custom)
+			}
+			if _, ok := custom["executionTime"].(int64); !ok {
+				t.Errorf("%s: expected the summed executionTime in Meta.Custom, got %v", q, custom)
+			}
+		}
+	}
+}
+
+// TestQuery_ErrorResponseCarriesRefIDAndSQL checks a failed execution
+// still returns a frame with the RefID and the SQL that ran.
+func TestQuery_ErrorResponseCarriesRefIDAndSQL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"boom"}`, http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+
+	now := time.Now()
+	for _, q := range []string{
+		`{"sql":"SELECT time, value FROM cpu WHERE $__timeFilter(time)","format":"table"}`,
+		`{"sql":"SELECT time, value FROM cpu WHERE $__timeFilter(time)","format":"table","splitDuration":"1h"}`,
+	} {
+		resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+			RefID:     "C",
+			TimeRange: backend.TimeRange{From: now.Add(-3 * time.Hour), To: now},
+			JSON:      []byte(q),
+		})
+		if resp.Error == nil {
+			t.Fatalf("%s: expected an error", q)
+		}
+		if len(resp.Frames) != 1 || resp.Frames[0].RefID != "C" || !strings.Contains(resp.Frames[0].Meta.ExecutedQueryString, "FROM cpu") {
+			t.Errorf("%s: expected one frame with RefID C and the SQL, got %+v", q, resp.Frames)
+		}
+	}
+}
+
+// TestQuery_ErrorInOKResponse: an error Arc reports in a 200 answer reaches
+// the panel instead of "missing 'columns' field": DuckDB's message about
+// the SQL verbatim as a 400, anything else sanitized as a 500, over both
+// protocols.
+func TestQuery_ErrorInOKResponse(t *testing.T) {
+	to := time.Now()
+	for _, c := range []struct {
+		name, body, want, hidden string
+		status                   backend.Status
+	}{
+		{"sql error", `{"error":"Binder Error: Referenced column \"foo\" not found in FROM clause!"}`,
+			`Arc error: Binder Error: Referenced column "foo" not found in FROM clause!`, "", backend.StatusBadRequest},
+		{"missing table", `{"error":"Catalog Error: Table with name cpu does not exist!"}`,
+			"table 'cpu' not found in database", "", backend.StatusBadRequest},
+		{"server error", `{"detail":"worker pool exhausted on node-7"}`,
+			"Arc query failed (see server logs for detail)", "node-7", backend.StatusInternal},
+	} {
+		for _, arrow := range []bool{false, true} {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(c.body))
+			}))
+			inst := newTestInstance(t, srv.URL)
+			inst.settings.UseArrow = &arrow
+
+			resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: to.Add(-time.Hour), To: to},
+				JSON:      []byte(`{"sql":"SELECT foo FROM cpu","format":"table"}`),
+			})
+			srv.Close()
+			if resp.Error == nil || !strings.Contains(resp.Error.Error(), c.want) {
+				t.Errorf("%s (arrow %v): error = %v, want %q", c.name, arrow, resp.Error, c.want)
+				continue
+			}
+			if c.hidden != "" && strings.Contains(resp.Error.Error(), c.hidden) {
+				t.Errorf("%s (arrow %v): error leaks %q: %v", c.name, arrow, c.hidden, resp.Error)
+			}
+			if resp.Status != c.status {
+				t.Errorf("%s (arrow %v): status = %d, want %d", c.name, arrow, resp.Status, c.status)
+			}
+			if downstream := resp.ErrorSource == backend.ErrorSourceDownstream; downstream != (c.status == backend.StatusBadRequest) {
+				t.Errorf("%s (arrow %v): error source = %q", c.name, arrow, resp.ErrorSource)
+			}
+		}
+	}
+}
+
+// --- newArcInstance / ArcInstanceSettings (P3/P4) ---
 
-	// Time filter should use chunk boundaries
-	if !strings.Contains(result, "2026-02-18T06:00:00Z") {
-		t.Errorf("expected chunk From in filter: %s", result)
+// TestSharedClient_ReusesConnections runs rounds of parallel queries, as a
+// dashboard refresh does, and checks later rounds reuse the first round's
+// connections instead of dialing new ones.
+func TestSharedClient_ReusesConnections(t *testing.T) {
+	var dials sync.Map
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond) // keep the round's requests overlapping
+		_ = json.NewEncoder(w).Encode(map[string]any{"columns": []string{"v"}, "data": [][]any{{1}}})
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Store(c.RemoteAddr().String(), true)
+		}
 	}
-	// Interval should use original 8d range (> 7d) → "1 hour"
-	if !strings.Contains(result, "1 hour") {
-		t.Errorf("expected '1 hour' interval from 8d original range: %s", result)
+	srv.Start()
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	const parallel = 4
+	for round := 0; round < 5; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < parallel; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := queryJSON(t.Context(), inst, "SELECT 1"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	n := 0
+	dials.Range(func(any, any) bool { n++; return true })
+	if n > parallel {
+		t.Errorf("%d connections for %d parallel queries; idle connections aren't being reused", n, parallel)
 	}
 }
 
-// --- newArcInstance / ArcInstanceSettings (P3/P4) ---
-
 // TestNewArcInstance_BuildsSharedClient locks in P3/P4: the factory parses
 // settings AND builds a shared *http.Client. Both are then cached for reuse
 // by the InstanceManager — the per-call newHTTPClient pattern is gone.
@@ -1000,6 +2382,28 @@ func jsonMarshal(v any) ([]byte, error) {
 	return json.Marshal(v)
 }
 
+// newTestInstance builds an instance pointed at a local mock Arc (an
+// httptest server on loopback, which the dial policy permits for loopback
+// URLs). Arrow decoding goes through a checked allocator, so any test that
+// leaks an Arrow buffer fails at cleanup, and retries wait a millisecond.
+func newTestInstance(t testing.TB, url string) *ArcInstanceSettings {
+	t.Helper()
+	jsonData, _ := jsonMarshal(map[string]any{"url": url})
+	inst, err := newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: map[string]string{"apiKey": "k"},
+	})
+	if err != nil {
+		t.Fatalf("newArcInstance: %v", err)
+	}
+	settings := inst.(*ArcInstanceSettings)
+	settings.retryBackoff = time.Millisecond
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	settings.arrowAlloc = mem
+	t.Cleanup(func() { mem.AssertSize(t, 0) })
+	return settings
+}
+
 // --- truncateForLog (L8) ---
 
 // TestContainsLIMIT_WhitespaceFlavors locks in R2-CR3: the LIMIT detector
@@ -1287,6 +2691,523 @@ func TestFormatRequestError_UsesTypedErrors(t *testing.T) {
 	}
 }
 
+// --- time-series row cap ---
+
+func TestEstimateSeriesFactor(t *testing.T) {
+	for _, c := range []struct {
+		sql  string
+		want int64
+	}{
+		{"SELECT $__timeGroup(time, '1m') AS time, value FROM cpu", 1},
+		{"SELECT $__timeGroup(time, '1m') AS time, avg(v) FROM cpu GROUP BY 1 ORDER BY 1", 1},
+		{"SELECT $__timeGroup(time, '1m') AS time, host, avg(v) FROM cpu GROUP BY 1, host ORDER BY 1", 10},
+		{"SELECT t, host, dc, avg(v) FROM cpu GROUP BY t, host, coalesce(dc, 'x') HAVING avg(v) > 0", 100},
+		{"SELECT * FROM (SELECT a, b FROM t GROUP BY a, b) GROUP BY time", 1},
+		{"SELECT 1 GROUP BY a, b, c, d, e, f", maxSeriesFactor},
+	} {
+		if got := estimateSeriesFactor(newStrippedSQL(c.sql)); got != c.want {
+			t.Errorf("estimateSeriesFactor(%q) = %d, want %d", c.sql, got, c.want)
+		}
+	}
+}
+
+// TestTimeSeriesRowCap_OnlyForTimeGroupQueries locks in when the safety net
+// fires: time_series format, $__timeGroup present, no user LIMIT. Raw-mode
+// queries and table formats are never capped.
+func TestTimeSeriesRowCap_OnlyForTimeGroupQueries(t *testing.T) {
+	inst := newTestInstance(t, "http://127.0.0.1:1")
+	bucketed := "SELECT $__timeGroup(time, '1m') AS time, value FROM cpu WHERE $__timeFilter(time)"
+	for _, c := range []struct {
+		name   string
+		qm     ArcQuery
+		mdp    int64
+		config int64
+		want   int64
+	}{
+		{"auto", ArcQuery{SQL: bucketed}, 500, 0, 5000},
+		{"auto-falls-back-to-query-model", ArcQuery{SQL: bucketed, MaxDataPoints: 100}, 0, 0, 1000},
+		{"auto-without-maxDataPoints", ArcQuery{SQL: bucketed}, 0, 0, 0},
+		{"fixed", ArcQuery{SQL: bucketed}, 500, 123, 123},
+		{"disabled", ArcQuery{SQL: bucketed}, 500, -1, 0},
+		{"raw-mode", ArcQuery{SQL: "SELECT time, value FROM cpu WHERE $__timeFilter(time)"}, 500, 0, 0},
+		{"user-limit", ArcQuery{SQL: bucketed + " LIMIT 10"}, 500, 0, 0},
+		{"table-format", ArcQuery{SQL: bucketed, Format: "table"}, 500, 0, 0},
+		{"commented-macro", ArcQuery{SQL: "SELECT time FROM cpu -- $__timeGroup(time, '1m')"}, 500, 0, 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			inst.settings.TimeSeriesRowCap = c.config
+			if got := inst.timeSeriesRowCap(c.qm, newStrippedSQL(c.qm.SQL), c.mdp); got != c.want {
+				t.Errorf("timeSeriesRowCap = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAppendLimit(t *testing.T) {
+	got := appendLimit("SELECT * FROM t -- note\n;  ", 42)
+	if want := "SELECT * FROM t -- note\nLIMIT 42"; got != want {
+		t.Errorf("appendLimit = %q, want %q", got, want)
+	}
+}
+
+// TestQuery_RowCapNoticeWhenHit runs a capped query end to end: the LIMIT
+// reaches Arc, and the notice appears only when the cap was actually hit.
+func TestQuery_RowCapNoticeWhenHit(t *testing.T) {
+	var gotSQL string
+	rows := 3
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotSQL = body.SQL
+		data := make([]interface{}, rows)
+		for i := range data {
+			data[i] = []interface{}{fmt.Sprintf("2025-01-01T00:0%d:00Z", i), float64(i)}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"time", "value"}, "data": data})
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useArrow := false
+	inst.settings.UseArrow = &useArrow
+	inst.settings.TimeSeriesRowCap = 3
+
+	now := time.Now()
+	q := backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		JSON:      []byte(`{"sql":"SELECT $__timeGroup(time, '1m') AS time, value FROM cpu WHERE $__timeFilter(time)","splitDuration":"off"}`),
+	}
+	d := NewArcDatasource()
+
+	resp := d.query(t.Context(), inst, q)
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	if !strings.HasSuffix(gotSQL, "\nLIMIT 3") {
+		t.Errorf("expected LIMIT 3 appended, got %q", gotSQL)
+	}
+	if n := len(resp.Frames[0].Meta.Notices); n != 1 {
+		t.Fatalf("expected row-cap notice when rows == cap, got %d notices", n)
+	}
+
+	rows = 2
+	resp = d.query(t.Context(), inst, q)
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	if n := len(resp.Frames[0].Meta.Notices); n != 0 {
+		t.Errorf("expected no notice under the cap, got %+v", resp.Frames[0].Meta.Notices)
+	}
+}
+
+// --- multi-result JSON ---
+
+// TestQuery_JSONMultiResult covers Arc's `{"results": [...]}` shape: one
+// frame per result set named <refId>-<n>, including an empty middle result,
+// plus the zero- and one-result edge cases.
+func TestQuery_JSONMultiResult(t *testing.T) {
+	result := func(col string, rows ...float64) map[string]interface{} {
+		data := make([]interface{}, len(rows))
+		for i, v := range rows {
+			data[i] = []interface{}{v}
+		}
+		return map[string]interface{}{"columns": []string{col}, "data": data}
+	}
+	var body interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useArrow := false
+	inst.settings.UseArrow = &useArrow
+	d := NewArcDatasource()
+	q := backend.DataQuery{RefID: "A", JSON: []byte(`{"sql":"SELECT 1; SELECT 2; SELECT 3","format":"table"}`)}
+
+	body = map[string]interface{}{"results": []interface{}{result("a", 1, 2), result("b"), result("c", 3)}}
+	resp := d.query(t.Context(), inst, q)
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	if len(resp.Frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(resp.Frames))
+	}
+	for i, want := range []struct {
+		name string
+		rows int
+	}{{"A-1", 2}, {"A-2", 0}, {"A-3", 1}} {
+		f := resp.Frames[i]
+		if f.Name != want.name || f.RefID != "A" || f.Rows() != want.rows {
+			t.Errorf("frame %d: got name=%q refId=%q rows=%d, want %s/%d", i, f.Name, f.RefID, f.Rows(), want.name, want.rows)
+		}
+	}
+
+	body = map[string]interface{}{"results": []interface{}{result("a", 1)}}
+	if resp = d.query(t.Context(), inst, q); len(resp.Frames) != 1 || resp.Frames[0].Name != "A" {
+		t.Errorf("one result: expected a single frame named A, got %+v", resp.Frames)
+	}
+
+	body = map[string]interface{}{"results": []interface{}{}}
+	if resp = d.query(t.Context(), inst, q); resp.Error != nil || len(resp.Frames) != 1 || resp.Frames[0].Rows() != 0 || len(resp.Frames[0].Meta.Notices) != 1 {
+		t.Errorf("zero results: expected one empty frame with a notice, got %+v", resp)
+	}
+
+	// The single-result shape is unchanged.
+	body = result("a", 1, 2)
+	if resp = d.query(t.Context(), inst, q); len(resp.Frames) != 1 || resp.Frames[0].Name != "A" || resp.Frames[0].Rows() != 2 {
+		t.Errorf("single result: unexpected frames %+v", resp.Frames)
+	}
+}
+
+func TestContainsMultipleStatements(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"SELECT 1":                          false,
+		"SELECT 1;\n  ":                     false,
+		"SELECT 1; SELECT 2":                true,
+		"SELECT ';' AS sep":                 false,
+		"SELECT 1 -- ; SELECT 2":            false,
+		"SET threads = 4;\nSELECT * FROM t": true,
+	} {
+		if got := containsMultipleStatements(newStrippedSQL(sql)); got != want {
+			t.Errorf("containsMultipleStatements(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
+
+// --- conversion failures ---
+
+// TestJSONToDataFrame_ReportsConversionFailures locks in that values nulled
+// by the converter surface as a per-column warning notice and as counts in
+// Meta.Custom, instead of only a server log line.
+func TestJSONToDataFrame_ReportsConversionFailures(t *testing.T) {
+	frame, err := JSONToDataFrame(map[string]interface{}{
+		"columns": []interface{}{"ts", "value"},
+		"data": []interface{}{
+			[]interface{}{"2025-01-01T00:00:00Z", 1.0},
+			[]interface{}{"2025-13-40", 2.0},
+			[]interface{}{"garbage", "n/a"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("JSONToDataFrame: %v", err)
+	}
+	if frame.Meta == nil || len(frame.Meta.Notices) != 2 {
+		t.Fatalf("expected 2 notices, got %+v", frame.Meta)
+	}
+	want := "column 'ts': 2 values could not be parsed as timestamps (first bad value: '2025-13-40')"
+	if got := frame.Meta.Notices[0]; got.Text != want || got.Severity != data.NoticeSeverityWarning {
+		t.Errorf("notice = %+v, want warning %q", got, want)
+	}
+	failures := frameConversionFailures(frame)
+	if len(failures) != 2 || failures[1].Column != "value" || failures[1].Count != 1 || failures[1].Kind != "numbers" {
+		t.Errorf("unexpected Meta.Custom failures: %+v", failures)
+	}
+}
+
+// TestJSONToDataFrame_DeclaredTypeFailures: a column Arc declared keeps
+// its type even when most of its values are text, and those values are
+// reported as failures rather than turning the column into a string one.
+func TestJSONToDataFrame_DeclaredTypeFailures(t *testing.T) {
+	frame, err := JSONToDataFrame(map[string]interface{}{
+		"columns": []interface{}{"ts", "value"},
+		"types":   []interface{}{"TIMESTAMP", "DOUBLE"},
+		"data": []interface{}{
+			[]interface{}{"2025-01-01T00:00:00Z", 1.0},
+			[]interface{}{"garbage", "n/a"},
+			[]interface{}{"later", "high"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("JSONToDataFrame: %v", err)
+	}
+	if typ := frame.Fields[0].Type(); typ != data.FieldTypeNullableTime {
+		t.Errorf("ts typed %s, want nullable time", typ)
+	}
+	if typ := frame.Fields[1].Type(); typ != data.FieldTypeNullableFloat64 {
+		t.Errorf("value typed %s, want nullable float64", typ)
+	}
+	failures := frameConversionFailures(frame)
+	if len(failures) != 2 || failures[0].Count != 2 || failures[0].FirstBadValue != "garbage" ||
+		failures[1].Count != 2 || failures[1].FirstBadValue != "n/a" {
+		t.Errorf("unexpected Meta.Custom failures: %+v", failures)
+	}
+}
+
+func TestMergeConversionFailures_SumsPerColumn(t *testing.T) {
+	a, b := data.NewFrame(""), data.NewFrame("")
+	attachConversionFailures(a, []conversionFailure{{Column: "ts", Kind: "timestamps", Count: 2, FirstBadValue: "x"}})
+	attachConversionFailures(b, []conversionFailure{{Column: "ts", Kind: "timestamps", Count: 3, FirstBadValue: "y"}})
+	got := mergeConversionFailures([]*data.Frame{a, b, data.NewFrame("")})
+	if len(got) != 1 || got[0].Count != 5 || got[0].FirstBadValue != "x" {
+		t.Errorf("mergeConversionFailures = %+v, want one ts entry with count 5 and first value x", got)
+	}
+}
+
+// TestQueryJSON_FailOnConversionErrors checks the strict-mode setting turns
+// the warning into a query error with a user-facing message.
+func TestQueryJSON_FailOnConversionErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"columns":["ts"],"data":[["2025-01-01T00:00:00Z"],["2025-13-40"]]}`))
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+
+	if _, err := queryJSON(t.Context(), inst, "SELECT ts FROM t"); err != nil {
+		t.Fatalf("lenient mode should not fail: %v", err)
+	}
+
+	inst.settings.FailOnConversionErrors = true
+	_, err := queryJSON(t.Context(), inst, "SELECT ts FROM t")
+	if !errors.Is(err, errDataConversion) {
+		t.Fatalf("expected errDataConversion, got %v", err)
+	}
+	if msg := sanitizeUserError("A", err); !strings.Contains(msg, "column 'ts'") || !strings.Contains(msg, "Fail on Conversion Errors") {
+		t.Errorf("unexpected user message: %q", msg)
+	}
+}
+
+// --- non-finite floats over JSON ---
+
+// TestQuery_JSONNonFiniteFloats: DuckDB's bare NaN and Infinity tokens in a
+// JSON body come through as NaN and Inf values, long-to-wide included,
+// instead of failing the panel with a decode error.
+func TestQuery_JSONNonFiniteFloats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","host","value"],"types":["TIMESTAMP","VARCHAR","DOUBLE"],"data":[` +
+			`["2026-02-18T10:00:00Z","a",NaN],["2026-02-18T10:00:00Z","b",Infinity],` +
+			`["2026-02-18T10:01:00Z","a",1.5e-300],["2026-02-18T10:01:00Z","b",-Infinity]]}`))
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"sql":"SELECT time, host, value FROM cpu","format":"time_series"}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	frame := resp.Frames[0]
+	if frame.Meta.Type != data.FrameTypeTimeSeriesWide || len(frame.Fields) != 3 {
+		t.Fatalf("frame = %s with %d fields, want the wide series a and b", frame.Meta.Type, len(frame.Fields))
+	}
+	want := map[string][]float64{"a": {math.NaN(), 1.5e-300}, "b": {math.Inf(1), math.Inf(-1)}}
+	for _, f := range frame.Fields[1:] {
+		for i, w := range want[f.Labels["host"]] {
+			got, err := f.FloatAt(i)
+			if err != nil || got != w && !(math.IsNaN(got) && math.IsNaN(w)) {
+				t.Errorf("%s[%d] = %v (%v), want %v", f.Labels["host"], i, got, err, w)
+			}
+		}
+	}
+}
+
+// TestQuery_JSONLongSeries: a long result over JSON, without declared
+// types, becomes one series per tag combination like the Arrow path's: the
+// string columns host and region are the labels, and the value fields read
+// as cpu {host="a", region="eu"} in the panel.
+func TestQuery_JSONLongSeries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","host","region","cpu"],"data":[` +
+			`["2026-02-18T10:00:00Z","a","eu",1],["2026-02-18T10:00:00Z","b","us",2],` +
+			`["2026-02-18T10:01:00Z","a","eu",3],["2026-02-18T10:01:00Z","b","us",4]]}`))
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"sql":"SELECT time, host, region, cpu FROM cpu","format":"time_series"}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	frame := resp.Frames[0]
+	if frame.Meta.Type != data.FrameTypeTimeSeriesWide || len(frame.Fields) != 3 || frame.Rows() != 2 {
+		t.Fatalf("frame = %s with %d fields and %d rows, want two series over two times", frame.Meta.Type, len(frame.Fields), frame.Rows())
+	}
+	want := map[string][]float64{
+		`cpu {host="a", region="eu"}`: {1, 3},
+		`cpu {host="b", region="us"}`: {2, 4},
+	}
+	for _, f := range frame.Fields[1:] {
+		name := displayName(f)
+		values, ok := want[name]
+		if !ok {
+			t.Errorf("unexpected series %s", name)
+			continue
+		}
+		delete(want, name)
+		for i, w := range values {
+			if got, err := f.FloatAt(i); err != nil || got != w {
+				t.Errorf("%s[%d] = %v (%v), want %v", name, i, got, err, w)
+			}
+		}
+	}
+	for name := range want {
+		t.Errorf("missing series %s", name)
+	}
+}
+
+// displayName is the name Grafana shows for a field without a configured
+// display name: its name, then its labels sorted by key.
+func displayName(f *data.Field) string {
+	if len(f.Labels) == 0 {
+		return f.Name
+	}
+	keys := make([]string, 0, len(f.Labels))
+	for k := range f.Labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", k, f.Labels[k])
+	}
+	return f.Name + " {" + strings.Join(pairs, ", ") + "}"
+}
+
+// --- numeric epoch time over JSON ---
+
+// TestJSONToDataFrame_FloatEpochTime is the Arc 1.3 regression: the
+// $__timeGroup expansion's to_timestamp() came back over JSON as a float
+// epoch in seconds, so "time" was typed float64 and the panel had no time
+// field.
+func TestJSONToDataFrame_FloatEpochTime(t *testing.T) {
+	var result map[string]interface{}
+	body := `{"columns":["time","value"],"data":[[1735689600.0,1.5],[1735689660.123456,2.5]],"rows":2}`
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := JSONToDataFrame(result)
+	if err != nil {
+		t.Fatalf("JSONToDataFrame: %v", err)
+	}
+	if typ := frame.Fields[0].Type(); typ != data.FieldTypeNullableTime {
+		t.Fatalf("time field typed %s, want nullable time", typ)
+	}
+	for i, want := range []time.Time{
+		time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 1, 0, 1, 0, 123456000, time.UTC),
+	} {
+		got, _ := frame.Fields[0].ConcreteAt(i)
+		if d := got.(time.Time).Sub(want); d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("row %d: got %v, want %v", i, got, want)
+		}
+	}
+	if frame.Meta != nil && len(frame.Meta.Notices) > 0 {
+		t.Errorf("unexpected conversion notices: %v", frame.Meta.Notices)
+	}
+}
+
+func TestEpochToTime_Units(t *testing.T) {
+	want := time.Date(2025, 1, 1, 0, 0, 0, 500_000_000, time.UTC)
+	for _, x := range []float64{1735689600.5, 1735689600500, 1735689600500000, 1735689600500000000} {
+		if got := epochToTime(x); !got.Equal(want) {
+			t.Errorf("epochToTime(%v) = %v, want %v", x, got.UTC(), want)
+		}
+	}
+}
+
+// TestJSONToDataFrame_EpochTimeTyping covers when a numeric column becomes
+// time: Arc's declared types win over the name heuristic, and a time-named
+// column of small numbers (a duration) stays numeric.
+func TestJSONToDataFrame_EpochTimeTyping(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		body  string
+		field int
+		want  data.FieldType
+	}{
+		{"duration named time", `{"columns":["time"],"data":[[0.25],[3.5]]}`, 0, data.FieldTypeNullableFloat64},
+		{"declared DOUBLE wins over the name", `{"columns":["time"],"types":["DOUBLE"],"data":[[1735689600.0]]}`, 0, data.FieldTypeNullableFloat64},
+		{"declared TIMESTAMP on any name", `{"columns":["bucket","n"],"types":["TIMESTAMP","BIGINT"],"data":[[1735689600.0,3]]}`, 0, data.FieldTypeNullableTime},
+		{"declared DECIMAL serialized as string", `{"columns":["price"],"types":["DECIMAL(18,3)"],"data":[["1.500"]]}`, 0, data.FieldTypeNullableString},
+		{"misaligned types ignored", `{"columns":["time","v"],"types":["DOUBLE"],"data":[[1735689600.0,1]]}`, 0, data.FieldTypeNullableTime},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var result map[string]interface{}
+			if err := json.Unmarshal([]byte(c.body), &result); err != nil {
+				t.Fatal(err)
+			}
+			frame, err := JSONToDataFrame(result)
+			if err != nil {
+				t.Fatalf("JSONToDataFrame: %v", err)
+			}
+			if got := frame.Fields[c.field].Type(); got != c.want {
+				t.Errorf("field typed %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+// --- QueryData refIds ---
+
+// TestQueryData_DuplicateAndEmptyRefIDs locks in that every submitted query
+// yields a visible response: the first "A" runs, the second answers with an
+// error under "A#2", and the refId-less query runs under a synthetic refId.
+func TestQueryData_DuplicateAndEmptyRefIDs(t *testing.T) {
+	srv := arrowOKServer(t)
+	defer srv.Close()
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, nil)
+
+	q := func(refID string) backend.DataQuery {
+		return backend.DataQuery{RefID: refID, JSON: []byte(`{"sql":"SELECT 1","format":"table"}`)}
+	}
+	resp, err := d.QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: pctx,
+		Queries:       []backend.DataQuery{q("A"), q("A"), q(""), q("B")},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	if len(resp.Responses) != 4 {
+		t.Fatalf("expected 4 responses, got %d: %v", len(resp.Responses), resp.Responses)
+	}
+	for _, id := range []string{"A", "B", missingRefID + "3"} {
+		if r, ok := resp.Responses[id]; !ok || r.Error != nil {
+			t.Errorf("refId %q: expected a successful response, got %+v (present=%v)", id, r, ok)
+		}
+	}
+	if frame := resp.Responses[missingRefID+"3"].Frames; len(frame) == 0 || frame[0].RefID != missingRefID+"3" {
+		t.Errorf("synthetic refId not propagated to frames: %+v", frame)
+	}
+	dup, ok := resp.Responses["A#2"]
+	if !ok || dup.Error == nil || !strings.Contains(dup.Error.Error(), "Duplicate refId") {
+		t.Errorf("expected duplicate error under A#2, got %+v", dup)
+	}
+}
+
+func TestNormalizeRefIDs_AvoidsCollisions(t *testing.T) {
+	queries, rejected := normalizeRefIDs([]backend.DataQuery{
+		{RefID: missingRefID + "1"}, {RefID: ""}, {RefID: "A"}, {RefID: "A#2"}, {RefID: "A"},
+	})
+	seen := map[string]bool{}
+	for _, q := range queries {
+		if q.RefID == "" || seen[q.RefID] {
+			t.Errorf("refId %q empty or reused", q.RefID)
+		}
+		seen[q.RefID] = true
+	}
+	for key := range rejected {
+		if seen[key] {
+			t.Errorf("rejected key %q collides with an executed refId", key)
+		}
+	}
+	if len(queries)+len(rejected) != 5 {
+		t.Errorf("expected 5 responses in total, got %d + %d", len(queries), len(rejected))
+	}
+}
+
 // helpers
 
 func expect(t *testing.T, got, want time.Time, label string) {
@@ -1296,3 +3217,300 @@ func expect(t *testing.T, got, want time.Time, label string) {
 	}
 }
 
+
+// TestUndecryptableAPIKey covers an apiKey entry that decrypted to nothing
+// (Grafana restored with another secret key): CheckHealth and every query
+// say so instead of "API key is required".
+func TestUndecryptableAPIKey(t *testing.T) {
+	newWithKey := func(secure map[string]string) error {
+		_, err := newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+			JSONData:                []byte(`{"url":"https://arc.example.com"}`),
+			DecryptedSecureJSONData: secure,
+		})
+		return err
+	}
+	if err := newWithKey(map[string]string{"apiKey": ""}); !errors.Is(err, errAPIKeyUndecryptable) {
+		t.Errorf("empty stored key: expected errAPIKeyUndecryptable, got %v", err)
+	}
+	if err := newWithKey(map[string]string{}); err == nil || errors.Is(err, errAPIKeyUndecryptable) || !strings.Contains(err.Error(), "API key is required") {
+		t.Errorf("no stored key: expected \"API key is required\", got %v", err)
+	}
+
+	pctx := testPluginContext(t, "https://arc.example.com", nil)
+	pctx.DataSourceInstanceSettings.DecryptedSecureJSONData = map[string]string{"apiKey": ""}
+	d := NewArcDatasource()
+
+	health, err := d.CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx})
+	if err != nil || health.Status != backend.HealthStatusError || health.Message != errAPIKeyUndecryptable.Error() {
+		t.Errorf("CheckHealth = %+v, %v", health, err)
+	}
+
+	resp, err := d.QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: pctx,
+		Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT 1"}`)}, {RefID: "B", JSON: []byte(`{"sql":"SELECT 2"}`)}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	for _, refID := range []string{"A", "B"} {
+		r := resp.Responses[refID]
+		if r.Error == nil || r.Error.Error() != errAPIKeyUndecryptable.Error() || r.Status != backend.StatusUnauthorized {
+			t.Errorf("%s: got %d %v", refID, r.Status, r.Error)
+		}
+	}
+}
+
+// TestQueryData_RefIDsRunConcurrently: refIds share the MaxConcurrency
+// slots, so a batch takes about as long as its slowest query rather than
+// the sum, and a failing refId leaves the others alone.
+func TestQueryData_RefIDsRunConcurrently(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		time.Sleep(delay)
+		if strings.Contains(string(body), "broken") {
+			http.Error(w, "Catalog Error: Table broken does not exist", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	var queries []backend.DataQuery
+	for _, refID := range []string{"A", "B", "C", "D", "E", "F"} {
+		sql := "SELECT 1"
+		if refID == "C" {
+			sql = "SELECT * FROM broken"
+		}
+		queries = append(queries, backend.DataQuery{RefID: refID, JSON: []byte(`{"sql":"` + sql + `","format":"table"}`)})
+	}
+	start := time.Now()
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "maxConcurrency": len(queries)}),
+		Queries:       queries,
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*delay {
+		t.Errorf("6 queries of %v took %v: not run concurrently", delay, elapsed)
+	}
+	for _, q := range queries {
+		r := resp.Responses[q.RefID]
+		if failed := r.Error != nil; failed != (q.RefID == "C") {
+			t.Errorf("refId %s: error %v", q.RefID, r.Error)
+		}
+	}
+}
+
+// TestQueryData_CancelledBatch: refIds of a cancelled request still answer,
+// without going to Arc.
+func TestQueryData_CancelledBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to Arc")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	queries := []backend.DataQuery{
+		{RefID: "A", JSON: []byte(`{"sql":"SELECT 1"}`)},
+		{RefID: "B", JSON: []byte(`{"sql":"SELECT 2"}`)},
+	}
+	resp, err := NewArcDatasource().QueryData(ctx, &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, nil),
+		Queries:       queries,
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	for _, q := range queries {
+		if r, ok := resp.Responses[q.RefID]; !ok || r.Error == nil {
+			t.Errorf("refId %s: response %+v (present=%v), want a cancellation error", q.RefID, r, ok)
+		}
+	}
+}
+
+// --- split chunk fan-out ---
+
+// TestSplitQuery_ChunksRunConcurrently: a 30-chunk query takes about
+// chunks/maxConcurrency round trips, and the merged rows stay in time order
+// even though later chunks answer first.
+func TestSplitQuery_ChunksRunConcurrently(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	from := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	lowerBound := regexp.MustCompile(`>= '([^']+)'`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		m := lowerBound.FindStringSubmatch(body.SQL)
+		if m == nil {
+			t.Errorf("no time bound in %q", body.SQL)
+			return
+		}
+		chunkFrom, _ := time.Parse(time.RFC3339Nano, m[1])
+		// Earlier chunks answer later.
+		day := int(chunkFrom.Sub(from) / (24 * time.Hour))
+		time.Sleep(delay + time.Duration(30-day)*time.Millisecond)
+		_, _ = fmt.Fprintf(w, `{"columns":["time","v"],"data":[["%s",%d]]}`, chunkFrom.Format(time.RFC3339), day)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "maxConcurrency": 8}),
+		Queries: []backend.DataQuery{{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: from, To: from.Add(30 * 24 * time.Hour)},
+			JSON:      []byte(`{"sql":"SELECT time, v FROM t WHERE $__timeFilter(time)","format":"table","splitDuration":"1d"}`),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	elapsed := time.Since(start)
+	r := resp.Responses["A"]
+	if r.Error != nil {
+		t.Fatalf("query error: %v", r.Error)
+	}
+	// 30 chunks, 8 at a time: 4 rounds of at most 80ms; serially 2.4s.
+	if elapsed > 30*delay/2 {
+		t.Errorf("30 chunks took %v: not run concurrently", elapsed)
+	}
+	frame := r.Frames[0]
+	if frame.Rows() != 30 {
+		t.Fatalf("merged %d rows, want 30", frame.Rows())
+	}
+	for i := 0; i < frame.Rows(); i++ {
+		if v, _ := frame.Fields[1].ConcreteAt(i); v != float64(i) {
+			t.Fatalf("row %d holds chunk %v: merged out of order", i, v)
+		}
+	}
+}
+
+// TestSplitQuery_CancelStopsChunks: cancelling the request unwinds the
+// chunks in flight and starts no more.
+func TestSplitQuery_CancelStopsChunks(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		started int
+	)
+	ctx, cancel := context.WithCancel(t.Context())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body is read.
+		_, _ = io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		started++
+		if started == 2 {
+			cancel()
+		}
+		mu.Unlock()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	done := make(chan backend.DataResponse, 1)
+	go func() {
+		resp, _ := NewArcDatasource().QueryData(ctx, &backend.QueryDataRequest{
+			PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "maxConcurrency": 2}),
+			Queries: []backend.DataQuery{{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from, To: from.Add(30 * 24 * time.Hour)},
+				JSON:      []byte(`{"sql":"SELECT time, v FROM t WHERE $__timeFilter(time)","format":"table","splitDuration":"1d"}`),
+			}},
+		})
+		done <- resp.Responses["A"]
+	}()
+	select {
+	case r := <-done:
+		if r.Error == nil {
+			t.Error("cancelled split query succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("split query kept running after cancellation")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if started > 2 {
+		t.Errorf("%d chunks sent, want the 2 in flight at cancellation", started)
+	}
+}
+
+// TestQuery_ZeroWidthTimeGroup: a $__timeGroup that can't form buckets is a
+// validation error, not SQL Arc fails on.
+func TestQuery_ZeroWidthTimeGroup(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"columns":["time","v"],"data":[]}`))
+	}))
+	defer srv.Close()
+
+	for sql, want := range map[string]string{
+		"SELECT $__timeGroup(time, '0ms') AS time, avg(v) FROM t GROUP BY 1":   "at least 1ms",
+		"SELECT $__timeGroup(time, '0.0001s') AS time, avg(v) FROM t GROUP BY 1": "whole milliseconds",
+	} {
+		resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(fmt.Sprintf(`{"sql":%q}`, sql))}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := resp.Responses["A"]; r.Status != backend.StatusBadRequest || r.Error == nil || !strings.Contains(r.Error.Error(), want) {
+			t.Errorf("%s: status %d, error %v", sql, r.Status, r.Error)
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("%d requests reached Arc", n)
+	}
+}
+
+// TestQueryData_ValueMacrosBeforeSplit: a quote inside $__in's JSON doesn't
+// hide the time filter after it, so the query is still split and every
+// chunk gets both macros expanded.
+func TestQueryData_ValueMacrosBeforeSplit(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.SQL)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","n"],"data":[["2026-03-01T00:00:00Z",1]]}`))
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+		Queries: []backend.DataQuery{{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: from, To: from.Add(3 * 24 * time.Hour)},
+			JSON:      []byte(`{"sql":"SELECT time, n FROM t WHERE $__in(host, [\"o'neil\",\"b\"]) AND $__timeFilter(time)","format":"table","splitDuration":"1d"}`),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	if r := resp.Responses["A"]; r.Error != nil {
+		t.Fatalf("query: %v", r.Error)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 3 {
+		t.Fatalf("sent %d queries, want one per day: %q", len(seen), seen)
+	}
+	for _, sql := range seen {
+		if !strings.Contains(sql, "host IN ('o''neil','b') AND time >= '2026-03-0") {
+			t.Errorf("sent %q, want both macros expanded", sql)
+		}
+	}
+}
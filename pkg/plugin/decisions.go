@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Decisions: the choices the datasource makes on a query's behalf — what
+// $__interval expands to, whether and how it is split, which LIMIT is
+// appended, what adaptive execution and the series cap changed — are
+// recorded with their inputs and outcome and attached to the response
+// frames' meta under "decisions", so the query inspector answers "why did
+// my query group by 10 minutes?".
+//
+// query() puts a decisionRecorder on the context; each step calls
+// recordDecision, which is a no-op when there is no recorder (resource
+// calls, health checks). A new feature that decides something for the user
+// records it the same way.
+
+// decisionsMetaKey is the FrameMeta.Custom key holding the decisions.
+const decisionsMetaKey = "decisions"
+
+// Decision names.
+const (
+	decisionInterval  = "interval"
+	decisionSplit     = "split"
+	decisionRowLimit  = "rowLimit"
+	decisionAdaptive  = "adaptive"
+	decisionSeriesCap = "seriesCap"
+)
+
+// decision is one recorded choice: what was decided (Outcome), the rule
+// that decided it (Reason) and the values the rule looked at (Inputs).
+type decision struct {
+	Name    string         `json:"name"`
+	Outcome string         `json:"outcome"`
+	Reason  string         `json:"reason,omitempty"`
+	Inputs  map[string]any `json:"inputs,omitempty"`
+}
+
+// decisionRecorder collects the decisions made for one query. Split chunks
+// run concurrently, so appends are locked.
+type decisionRecorder struct {
+	mu        sync.Mutex
+	decisions []decision
+}
+
+type decisionRecorderKey struct{}
+
+// withDecisionRecorder returns ctx carrying a fresh recorder.
+func withDecisionRecorder(ctx context.Context) (context.Context, *decisionRecorder) {
+	r := &decisionRecorder{}
+	return context.WithValue(ctx, decisionRecorderKey{}, r), r
+}
+
+// recordDecision appends d to the recorder on ctx, if any.
+func recordDecision(ctx context.Context, d decision) {
+	r, _ := ctx.Value(decisionRecorderKey{}).(*decisionRecorder)
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decisions = append(r.decisions, d)
+}
+
+// attach adds the recorded decisions to every frame's meta.
+func (r *decisionRecorder) attach(frames data.Frames) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.decisions) == 0 {
+		return
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = map[string]interface{}{}
+			frame.Meta.Custom = custom
+		}
+		custom[decisionsMetaKey] = append([]decision(nil), r.decisions...)
+	}
+}
+
+// intervalDecision describes what $__interval expands to for query: the
+// panel interval, coarsened for maxDataPoints, or without one the ladder
+// rung picked for the range (arcclient.ResolveInterval).
+func intervalDecision(query backend.DataQuery) decision {
+	span := query.TimeRange.To.Sub(query.TimeRange.From)
+	resolved := arcclient.ResolveInterval(macroOptions(query.TimeRange, query, time.Time{}))
+	switch resolved.Source {
+	case arcclient.IntervalFromPanel:
+		return decision{
+			Name:    decisionInterval,
+			Outcome: resolved.Interval,
+			Reason:  fmt.Sprintf("panel interval %s", query.Interval),
+			Inputs:  map[string]any{"range": formatSpan(span), "panelInterval": query.Interval.String(), "maxDataPoints": query.MaxDataPoints},
+		}
+	case arcclient.IntervalFromMaxDataPoints:
+		if query.Interval <= 0 {
+			return decision{
+				Name:    decisionInterval,
+				Outcome: resolved.Interval,
+				Reason:  fmt.Sprintf("range %s is short enough to size buckets for %d points", formatSpan(span), query.MaxDataPoints),
+				Inputs:  map[string]any{"range": formatSpan(span), "maxDataPoints": query.MaxDataPoints},
+			}
+		}
+		return decision{
+			Name:    decisionInterval,
+			Outcome: resolved.Interval,
+			Reason:  fmt.Sprintf("panel interval %s gives range %s more than %d points", query.Interval, formatSpan(span), query.MaxDataPoints),
+			Inputs:  map[string]any{"range": formatSpan(span), "panelInterval": query.Interval.String(), "maxDataPoints": query.MaxDataPoints},
+		}
+	}
+	step := arcclient.Interval(span)
+	ladder := arcclient.IntervalLadder()
+	rungs := make([]string, len(ladder))
+	for i, rung := range ladder {
+		if rung.Over > 0 {
+			rungs[i] = fmt.Sprintf("> %s: %s", formatSpan(rung.Over), rung.Interval)
+		} else {
+			rungs[i] = "otherwise: " + rung.Interval
+		}
+	}
+	reason := fmt.Sprintf("range %s is longer than %s", formatSpan(span), formatSpan(step.Over))
+	if step.Over == 0 {
+		reason = fmt.Sprintf("range %s is %s or shorter", formatSpan(span), formatSpan(ladder[len(ladder)-2].Over))
+	}
+	return decision{
+		Name:    decisionInterval,
+		Outcome: step.Interval,
+		Reason:  reason,
+		Inputs:  map[string]any{"range": formatSpan(span), "ladder": rungs},
+	}
+}
+
+// splitSettingReason explains what the splitDuration setting alone decided
+// for tr; the split heuristics and adaptive execution may override it.
+func splitSettingReason(setting string, tr backend.TimeRange) string {
+	switch setting {
+	case "off":
+		return "splitDuration is off"
+	case "", "auto":
+		span := tr.To.Sub(tr.From)
+		step := autoSplitRung(tr)
+		if step.Under == 0 {
+			prev := autoSplitLadder[len(autoSplitLadder)-2]
+			return fmt.Sprintf("auto: range %s is %s or longer", formatSpan(span), formatSpan(prev.Under))
+		}
+		return fmt.Sprintf("auto: range %s is under %s", formatSpan(span), formatSpan(step.Under))
+	}
+	if _, err := splitDurationValue(setting); err != nil {
+		return err.Error()
+	}
+	return "splitDuration is " + setting
+}
+
+// splitDecision describes the final split choice: chunks of chunkSize, or
+// no split when chunks is 0.
+func splitDecision(setting string, tr backend.TimeRange, reason string, chunks int, chunkSize time.Duration, maxConcurrency int) decision {
+	if setting == "" {
+		setting = "auto"
+	}
+	d := decision{
+		Name:    decisionSplit,
+		Outcome: "off",
+		Reason:  reason,
+		Inputs:  map[string]any{"splitDuration": setting, "range": formatSpan(tr.To.Sub(tr.From))},
+	}
+	if chunks > 0 {
+		d.Outcome = fmt.Sprintf("%d chunks of %s", chunks, formatSpan(chunkSize))
+		d.Inputs["maxConcurrency"] = maxConcurrency
+	}
+	return d
+}
+
+// adaptiveDecision summarizes an adaptive execution plan (the full plan is
+// under its own meta key, see attachAdaptivePlan).
+func adaptiveDecision(plan *adaptivePlan) decision {
+	return decision{
+		Name:    decisionAdaptive,
+		Outcome: fmt.Sprintf("estimated %d rows", plan.EstimatedRows),
+		Reason:  strings.Join(plan.Reasons, "; "),
+	}
+}
+
+// formatSpan renders d compactly in days, hours, minutes and seconds
+// ("1d12h", "6h", "90s" as "1m30s"); sub-second parts are dropped.
+func formatSpan(d time.Duration) string {
+	if d < time.Second {
+		return "0s"
+	}
+	var b strings.Builder
+	for _, unit := range []struct {
+		size time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if n := d / unit.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.name)
+			d -= n * unit.size
+		}
+	}
+	return b.String()
+}
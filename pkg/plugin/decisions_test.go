@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestFormatSpan(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                                "0s",
+		90 * time.Second:                 "1m30s",
+		6 * time.Hour:                    "6h",
+		36 * time.Hour:                   "1d12h",
+		7 * 24 * time.Hour:               "7d",
+		time.Hour + 500*time.Millisecond: "1h",
+	}
+	for d, want := range cases {
+		if got := formatSpan(d); got != want {
+			t.Errorf("formatSpan(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestSplitSettingReason(t *testing.T) {
+	now := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	rangeOf := func(d time.Duration) backend.TimeRange { return backend.TimeRange{From: now.Add(-d), To: now} }
+	cases := []struct {
+		setting string
+		span    time.Duration
+		want    string
+	}{
+		{"", 2 * time.Hour, "auto: range 2h is under 3h"},
+		{"auto", 2 * 24 * time.Hour, "auto: range 2d is under 7d"},
+		{"auto", 45 * 24 * time.Hour, "auto: range 45d is 30d or longer"},
+		{"off", 2 * 24 * time.Hour, "splitDuration is off"},
+		{"6h", 2 * 24 * time.Hour, "splitDuration is 6h"},
+		{"2w", 2 * 24 * time.Hour, "splitDuration is 2w"},
+		{"abc", 2 * 24 * time.Hour, `unknown splitDuration "abc": use auto, off or a duration such as 30m, 2h, 12h30m or 14d`},
+		{"1m", 2 * 24 * time.Hour, `splitDuration "1m" is below the 5m minimum`},
+	}
+	for _, c := range cases {
+		if got := splitSettingReason(c.setting, rangeOf(c.span)); got != c.want {
+			t.Errorf("splitSettingReason(%q, %s) = %q, want %q", c.setting, c.span, got, c.want)
+		}
+	}
+}
+
+// frameDecisions returns the decisions recorded on frame, by name.
+func frameDecisions(t *testing.T, frame *data.Frame) map[string]decision {
+	t.Helper()
+	if frame.Meta == nil {
+		t.Fatal("frame has no meta")
+	}
+	custom, _ := frame.Meta.Custom.(map[string]interface{})
+	list, ok := custom[decisionsMetaKey].([]decision)
+	if !ok {
+		t.Fatalf("no decisions in meta: %+v", frame.Meta.Custom)
+	}
+	byName := make(map[string]decision, len(list))
+	for _, d := range list {
+		byName[d.Name] = d
+	}
+	return byName
+}
+
+func TestQuery_Decisions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"columns": []string{"time", "host", "v"},
+			"data": []interface{}{
+				[]interface{}{"2026-03-08T00:00:00Z", "a", 1},
+				[]interface{}{"2026-03-08T00:00:00Z", "b", 2},
+				[]interface{}{"2026-03-08T00:00:00Z", "c", 3},
+			},
+		})
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	run := func(model map[string]interface{}) backend.DataResponse {
+		q, _ := json.Marshal(model)
+		return NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+			RefID:         "A",
+			TimeRange:     backend.TimeRange{From: from, To: from.Add(48 * time.Hour)},
+			MaxDataPoints: 1000,
+			JSON:          q,
+		})
+	}
+
+	t.Run("single query", func(t *testing.T) {
+		resp := run(map[string]interface{}{
+			"sql":           "SELECT $__timeGroup(time, $__interval) AS time, host, avg(v) AS v FROM cpu WHERE $__timeFilter(time) GROUP BY 1, host",
+			"format":        "time_series",
+			"splitDuration": "off",
+			"maxSeries":     2,
+		})
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		got := frameDecisions(t, resp.Frames[0])
+
+		if d := got[decisionInterval]; d.Outcome != "10 minutes" || d.Reason != "range 2d is longer than 1d" {
+			t.Errorf("interval decision = %+v", d)
+		}
+		if d := got[decisionSplit]; d.Outcome != "off" || d.Reason != "splitDuration is off" {
+			t.Errorf("split decision = %+v", d)
+		}
+		// estimateSeriesFactor counts 10 series for the host column.
+		if d := got[decisionRowLimit]; d.Outcome != "LIMIT 100000" || d.Reason != "time-series row cap: maxDataPoints 1000 × 10 rows per point × 10 estimated series" {
+			t.Errorf("rowLimit decision = %+v", d)
+		}
+		if d := got[decisionSeriesCap]; d.Outcome != "kept the first 2 series, dropped 1" || d.Inputs["overflowAction"] != overflowTruncate {
+			t.Errorf("seriesCap decision = %+v", d)
+		}
+	})
+
+	t.Run("split query", func(t *testing.T) {
+		resp := run(map[string]interface{}{
+			"sql":    "SELECT time, host, v FROM cpu WHERE $__timeFilter(time)",
+			"format": "table",
+		})
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		got := frameDecisions(t, resp.Frames[0])
+		if d := got[decisionSplit]; d.Outcome != "8 chunks of 6h" || d.Reason != "auto: range 2d is under 7d" || d.Inputs["maxConcurrency"] != 4 {
+			t.Errorf("split decision = %+v", d)
+		}
+		if d := got[decisionRowLimit]; d.Outcome != "LIMIT 1000" || d.Reason != "raw row cap: maxDataPoints 1000 × 1 estimated series, at most the datasource's rawRowCap 1000000" {
+			t.Errorf("rowLimit decision = %+v", d)
+		}
+		if _, ok := got[decisionInterval]; ok {
+			t.Error("interval decision recorded for a query without $__interval")
+		}
+	})
+
+	t.Run("split skipped", func(t *testing.T) {
+		resp := run(map[string]interface{}{"sql": "SELECT time, v FROM cpu WHERE $__timeFilter(time) LIMIT 10"})
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		got := frameDecisions(t, resp.Frames[0])
+		if d := got[decisionSplit]; d.Outcome != "off" || d.Reason != "LIMIT would apply to every chunk" {
+			t.Errorf("split decision = %+v", d)
+		}
+		if d := got[decisionRowLimit]; d.Reason != "the query has its own LIMIT" {
+			t.Errorf("rowLimit decision = %+v", d)
+		}
+	})
+}
+
+func TestIntervalDecision(t *testing.T) {
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	tr := backend.TimeRange{From: from, To: from.Add(72 * time.Hour)}
+	cases := []struct {
+		query   backend.DataQuery
+		outcome string
+		reason  string
+	}{
+		{backend.DataQuery{TimeRange: tr, MaxDataPoints: 300}, "10 minutes", "range 3d is longer than 1d"},
+		{backend.DataQuery{TimeRange: tr, Interval: 30 * time.Second, MaxDataPoints: 10000}, "30 seconds", "panel interval 30s"},
+		{backend.DataQuery{TimeRange: tr, Interval: 30 * time.Second, MaxDataPoints: 300}, "15 minutes", "panel interval 30s gives range 3d more than 300 points"},
+		{backend.DataQuery{TimeRange: backend.TimeRange{From: from, To: from.Add(30 * time.Second)}, MaxDataPoints: 300}, "100 milliseconds", "range 30s is short enough to size buckets for 300 points"},
+	}
+	for _, c := range cases {
+		d := intervalDecision(c.query)
+		if d.Outcome != c.outcome || d.Reason != c.reason {
+			t.Errorf("intervalDecision(%s, %d points) = %q (%s), want %q (%s)", c.query.Interval, c.query.MaxDataPoints, d.Outcome, d.Reason, c.outcome, c.reason)
+		}
+	}
+}
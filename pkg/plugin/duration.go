@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// durationNameRe matches numeric column names that carry their unit as a
+// suffix: request_duration_ms, latency_us, elapsed_seconds, response_time_ms.
+var durationNameRe = regexp.MustCompile(`(?i)(?:duration|latency|elapsed|time)_(ns|nanos|us|micros|ms|millis|s|sec|secs|seconds)$`)
+
+// durationNameUnits maps a durationNameRe suffix to its Grafana unit.
+var durationNameUnits = map[string]string{
+	"ns": "ns", "nanos": "ns",
+	"us": "µs", "micros": "µs",
+	"ms": "ms", "millis": "ms",
+	"s": "s", "sec": "s", "secs": "s", "seconds": "s",
+}
+
+// applyDurationNameUnits sets the unit of numeric fields whose name ends in
+// a duration suffix (durationUnitsFromNames setting). It runs on decoded
+// frames, so Arrow and JSON results get the same units, and never replaces
+// a unit the field already has.
+func applyDurationNameUnits(frames data.Frames) {
+	for _, frame := range frames {
+		if frame == nil {
+			continue
+		}
+		for _, field := range frame.Fields {
+			if !field.Type().Numeric() || (field.Config != nil && field.Config.Unit != "") {
+				continue
+			}
+			m := durationNameRe.FindStringSubmatch(field.Name)
+			if m == nil {
+				continue
+			}
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			field.Config.Unit = durationNameUnits[strings.ToLower(m[1])]
+		}
+	}
+}
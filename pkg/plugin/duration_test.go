@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// durationFieldValues checks field is a seconds-unit float64 field and
+// returns its values.
+func durationFieldValues(t *testing.T, field *data.Field) []*float64 {
+	t.Helper()
+	if field.Type() != data.FieldTypeNullableFloat64 {
+		t.Fatalf("%s: expected nullable float64, got %s", field.Name, field.Type())
+	}
+	if field.Config == nil || field.Config.Unit != durationUnit {
+		t.Fatalf("%s: expected unit %q, got %+v", field.Name, durationUnit, field.Config)
+	}
+	values := make([]*float64, field.Len())
+	for i := range values {
+		values[i] = field.At(i).(*float64)
+	}
+	return values
+}
+
+// TestAppendRecordToDataFrame_Duration decodes a duration in every Arrow
+// time unit, plus a null, to a seconds field.
+func TestAppendRecordToDataFrame_Duration(t *testing.T) {
+	for _, c := range []struct {
+		unit  arrow.TimeUnit
+		value arrow.Duration
+	}{
+		{arrow.Second, 2}, // whole seconds only
+		{arrow.Millisecond, 1500},
+		{arrow.Microsecond, 1_500_000},
+		{arrow.Nanosecond, 1_500_000_000},
+	} {
+		t.Run(c.unit.String(), func(t *testing.T) {
+			schema := arrow.NewSchema([]arrow.Field{
+				{Name: "took", Type: &arrow.DurationType{Unit: c.unit}, Nullable: true},
+			}, nil)
+			b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+			defer b.Release()
+			b.Field(0).(*array.DurationBuilder).AppendValues([]arrow.Duration{c.value, 0}, []bool{true, false})
+			rec := b.NewRecord()
+			defer rec.Release()
+
+			frame := newFrameFromArrowSchema(schema)
+			if err := appendRecordToDataFrame(frame, rec); err != nil {
+				t.Fatalf("appendRecordToDataFrame: %v", err)
+			}
+			want := 1.5
+			if c.unit == arrow.Second {
+				want = 2
+			}
+			got := durationFieldValues(t, frame.Fields[0])
+			if got[0] == nil || *got[0] != want {
+				t.Errorf("row 0: expected %v s, got %v", want, got[0])
+			}
+			if got[1] != nil {
+				t.Errorf("row 1: expected null, got %v", *got[1])
+			}
+		})
+	}
+}
+
+// TestDurationConvertersAgree pins that the same INTERVAL decodes to the
+// same seconds over Arrow (MONTH_DAY_NANO) and JSON (text and object forms).
+func TestDurationConvertersAgree(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "age", Type: arrow.FixedWidthTypes.MonthDayNanoInterval, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+	b.Field(0).(*array.MonthDayNanoIntervalBuilder).AppendValues([]arrow.MonthDayNanoInterval{
+		{Months: 0, Days: 0, Nanoseconds: 1_200_000_000},
+		{Months: 0, Days: 1, Nanoseconds: 7_384_500_000_000},
+		{Months: 14, Days: 0, Nanoseconds: 0},
+	}, nil)
+	rec := b.NewRecord()
+	defer rec.Release()
+	arrowFrame := newFrameFromArrowSchema(schema)
+	if err := appendRecordToDataFrame(arrowFrame, rec); err != nil {
+		t.Fatalf("appendRecordToDataFrame: %v", err)
+	}
+
+	jsonFrame, failures, err := jsonToDataFrame(map[string]interface{}{
+		"columns": []interface{}{"age"},
+		"types":   []interface{}{"INTERVAL"},
+		"data": []interface{}{
+			[]interface{}{"00:00:01.2"},
+			[]interface{}{"1 day 02:03:04.5"},
+			[]interface{}{map[string]interface{}{"months": 14.0, "days": 0.0, "micros": 0.0}},
+		},
+	})
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("jsonToDataFrame: %v %v", err, failures)
+	}
+
+	want := []float64{1.2, 93784.5, 14 * 30 * 86400}
+	arrowValues := durationFieldValues(t, arrowFrame.Fields[0])
+	jsonValues := durationFieldValues(t, jsonFrame.Fields[0])
+	for i, w := range want {
+		if arrowValues[i] == nil || *arrowValues[i] != w {
+			t.Errorf("arrow row %d: expected %v, got %v", i, w, arrowValues[i])
+		}
+		if jsonValues[i] == nil || *jsonValues[i] != w {
+			t.Errorf("json row %d: expected %v, got %v", i, w, jsonValues[i])
+		}
+	}
+}
+
+func TestParseIntervalText(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"00:00:00.25", 0.25, true},
+		{"-00:01:00", -60, true},
+		{"2 days", 2 * 86400, true},
+		{"1 year 1 mon 1 day 01:00:00", (12+1)*30*86400 + 86400 + 3600, true},
+		{"3 months", 3 * 30 * 86400, true},
+		{"", 0, false},
+		{"1 fortnight", 0, false},
+		{"soon", 0, false},
+	} {
+		got, ok := parseIntervalText(c.in)
+		if ok != c.ok || got != c.want {
+			t.Errorf("parseIntervalText(%q) = %v, %v; want %v, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestApplyDurationNameUnits(t *testing.T) {
+	withUnit := data.NewField("query_time_ms", nil, []*float64{})
+	withUnit.Config = &data.FieldConfig{Unit: "percent"}
+	frame := data.NewFrame("",
+		data.NewField("request_duration_ms", nil, []*float64{}),
+		data.NewField("latency_us", nil, []*int32{}),
+		data.NewField("Elapsed_Seconds", nil, []*float64{}),
+		data.NewField("exec_time_ns", nil, []*float64{}),
+		data.NewField("duration_ms_label", nil, []*float64{}),
+		data.NewField("span_duration_ms", nil, []*string{}),
+		withUnit,
+	)
+	applyDurationNameUnits(data.Frames{frame})
+
+	want := []string{"ms", "µs", "s", "ns", "", "", "percent"}
+	for i, field := range frame.Fields {
+		got := ""
+		if field.Config != nil {
+			got = field.Config.Unit
+		}
+		if got != want[i] {
+			t.Errorf("%s: unit %q, want %q", field.Name, got, want[i])
+		}
+	}
+}
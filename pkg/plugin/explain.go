@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Explanation frames (explainBlockedQueries setting): a query a guard
+// refuses before it reaches Arc — role restrictions, the database-override
+// guard, named credentials — answers with its error and, next to it, a one-row table naming
+// the policy, the part of the SQL it objected to and what to do about it.
+// The error alone ends up in a panel corner; Explore and table panels show
+// the row.
+//
+// The frame is marked with Meta.Custom["arcExplanation"] = true so
+// automation reading the response can drop it, and is never added to an
+// alert rule's response, where it would be evaluated as data.
+
+// explanationMetaKey is the FrameMeta.Custom key marking an explanation
+// frame.
+const explanationMetaKey = "arcExplanation"
+
+// Policies a blockedQueryError names.
+const (
+	policyRoleRestrictions = "roleRestrictions"
+	policyDatabaseOverride = "databaseOverride"
+	policyCredential       = "credential"
+)
+
+// blockedQueryError is a guard's refusal of a query: the error the user
+// sees, with what an explanation frame shows.
+type blockedQueryError struct {
+	policy    string // one of the policy constants
+	offending string // the part of the SQL or query the policy objected to
+	hint      string // what the user or an admin can do
+	err       error
+}
+
+func (e *blockedQueryError) Error() string { return e.err.Error() }
+func (e *blockedQueryError) Unwrap() error { return e.err }
+
+// explainBlocked adds an explanation frame to resp, the response to a query
+// refused with err, when explainBlockedQueries is on, err is a
+// blockedQueryError and the request isn't an alert evaluation.
+func (s *ArcInstanceSettings) explainBlocked(ctx context.Context, refID string, resp backend.DataResponse, err error) backend.DataResponse {
+	var blocked *blockedQueryError
+	if !s.settings.ExplainBlockedQueries || requestOriginFrom(ctx).Alert || !errors.As(err, &blocked) {
+		return resp
+	}
+	resp.Frames = append(resp.Frames, explanationFrame(refID, blocked))
+	return resp
+}
+
+// explanationFrame is the one-row table for blocked.
+func explanationFrame(refID string, blocked *blockedQueryError) *data.Frame {
+	frame := data.NewFrame("explanation",
+		data.NewField("policy", nil, []string{blocked.policy}),
+		data.NewField("offending", nil, []string{blocked.offending}),
+		data.NewField("remediation", nil, []string{blocked.hint}),
+		data.NewField("error", nil, []string{blocked.Error()}),
+	)
+	frame.RefID = refID
+	frame.Meta = &data.FrameMeta{
+		PreferredVisualization: data.VisTypeTable,
+		Custom:                 map[string]interface{}{explanationMetaKey: true},
+	}
+	return frame
+}
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// explanation returns the explanation frame of resp and its row as a map,
+// or nil when there is none.
+func explanation(t *testing.T, resp backend.DataResponse) map[string]string {
+	t.Helper()
+	for _, frame := range resp.Frames {
+		if frame.Meta == nil {
+			continue
+		}
+		if custom, _ := frame.Meta.Custom.(map[string]interface{}); custom[explanationMetaKey] != true {
+			continue
+		}
+		if frame.Rows() != 1 {
+			t.Fatalf("explanation frame has %d rows", frame.Rows())
+		}
+		row := map[string]string{}
+		for _, f := range frame.Fields {
+			row[f.Name] = f.At(0).(string)
+		}
+		return row
+	}
+	return nil
+}
+
+func TestQueryData_ExplainsBlockedQueries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"columns":["n"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	run := func(t *testing.T, explain bool, headers map[string]string, query string) backend.DataResponse {
+		t.Helper()
+		pctx := testPluginContext(t, srv.URL, map[string]any{
+			"useArrow":              false,
+			"database":              "prod",
+			"explainBlockedQueries": explain,
+			"roleRestrictions":      map[string]any{"Viewer": map[string]any{"tables": []string{"cpu"}}},
+		})
+		pctx.User = &backend.User{Login: "v", Role: "Viewer"}
+		resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: pctx,
+			Headers:       headers,
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(query)}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		r := resp.Responses["A"]
+		if r.Error == nil {
+			t.Fatal("expected the query to be refused")
+		}
+		return r
+	}
+
+	t.Run("blocked table", func(t *testing.T) {
+		r := run(t, true, nil, `{"sql":"SELECT * FROM cpu JOIN secrets s ON true"}`)
+		row := explanation(t, r)
+		if row == nil {
+			t.Fatal("no explanation frame")
+		}
+		if row["policy"] != policyRoleRestrictions || row["offending"] != "secrets" || row["error"] != r.Error.Error() || row["remediation"] == "" {
+			t.Errorf("explanation = %+v", row)
+		}
+		if r.Status != backend.StatusForbidden {
+			t.Errorf("status = %d, want 403", r.Status)
+		}
+	})
+
+	t.Run("undetermined tables", func(t *testing.T) {
+		row := explanation(t, run(t, true, nil, `{"sql":"SELECT * FROM '/data/secrets.parquet'"}`))
+		if row == nil || row["offending"] != "FROM '/data/secrets.parquet'" {
+			t.Errorf("explanation = %+v", row)
+		}
+	})
+
+	t.Run("database override", func(t *testing.T) {
+		row := explanation(t, run(t, true, nil, `{"sql":"SELECT * FROM cpu","database":"billing"}`))
+		if row == nil || row["policy"] != policyDatabaseOverride || row["offending"] != "database: billing" {
+			t.Errorf("explanation = %+v", row)
+		}
+	})
+
+	t.Run("setting off", func(t *testing.T) {
+		if row := explanation(t, run(t, false, nil, `{"sql":"SELECT * FROM secrets"}`)); row != nil {
+			t.Errorf("explanation without the setting: %+v", row)
+		}
+	})
+
+	t.Run("never for alerting", func(t *testing.T) {
+		if row := explanation(t, run(t, true, map[string]string{"FromAlert": "true"}, `{"sql":"SELECT * FROM secrets"}`)); row != nil {
+			t.Errorf("explanation for an alert evaluation: %+v", row)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"context"
+)
+
+// Explore requests. Explore users iterate on raw SQL and read the answer as
+// a table, so a query sent from Explore gets table-first defaults:
+//
+//   - format "table" when the query sets none, which also leaves out the
+//     time-series ORDER BY (orderByTime only applies to time series);
+//   - the exploreMaxRows preview cap (DefaultExploreMaxRows) in place of
+//     maxRows and the time-series row cap — the query's own LIMIT and its
+//     rowLimit still win (see resolveRowLimit).
+//
+// Grafana doesn't tell a backend which app a query came from, so the
+// frontend stamps app: "explore" on the queries it sends from Explore — the
+// field is never saved with the query — and a request carrying Grafana's
+// dashboard, panel or alerting headers is never treated as Explore. Every
+// default yields to the query's own fields, so a saved Explore query added
+// to a dashboard runs the same way.
+
+// appExplore is the app the frontend stamps on Explore queries (Grafana's
+// CoreApp.Explore).
+const appExplore = "explore"
+
+// DefaultExploreMaxRows is the exploreMaxRows used when the setting is
+// unset.
+const DefaultExploreMaxRows = 10000
+
+// resolveExploreMaxRows resolves the exploreMaxRows setting: 0 is
+// DefaultExploreMaxRows, negative means no preview cap (0 here).
+func resolveExploreMaxRows(n int64) int64 {
+	switch {
+	case n == 0:
+		return DefaultExploreMaxRows
+	case n < 0:
+		return 0
+	}
+	return n
+}
+
+// exploreDefaults applies the Explore defaults to qm when the request came
+// from Explore, and clears qm.App otherwise, so later steps can trust
+// qm.fromExplore.
+func exploreDefaults(ctx context.Context, qm ArcQuery) ArcQuery {
+	origin := requestOriginFrom(ctx)
+	if qm.App != appExplore || origin.Dashboard != "" || origin.Panel != "" || origin.Alert || qm.RefID == metricFindQueryRefID {
+		qm.App = ""
+		return qm
+	}
+	if qm.Format == "" {
+		qm.Format = "table"
+	}
+	return qm
+}
+
+// fromExplore reports whether qm, after exploreDefaults, came from Explore.
+func (qm ArcQuery) fromExplore() bool {
+	return qm.App == appExplore
+}
+
+type exploreKey struct{}
+
+// withExplore returns ctx marked as serving an Explore query.
+func withExplore(ctx context.Context) context.Context {
+	return context.WithValue(ctx, exploreKey{}, true)
+}
+
+// exploreFrom reports whether ctx serves an Explore query.
+func exploreFrom(ctx context.Context) bool {
+	explore, _ := ctx.Value(exploreKey{}).(bool)
+	return explore
+}
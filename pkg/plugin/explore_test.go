@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestExploreDefaults(t *testing.T) {
+	withOrigin := func(origin requestOrigin) context.Context {
+		return context.WithValue(t.Context(), requestOriginKey{}, origin)
+	}
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		qm          ArcQuery
+		wantExplore bool
+		wantFormat  string
+	}{
+		{"explore", withOrigin(requestOrigin{}), ArcQuery{App: appExplore}, true, "table"},
+		{"explicit format kept", withOrigin(requestOrigin{}), ArcQuery{App: appExplore, Format: "time_series"}, true, "time_series"},
+		{"not stamped", withOrigin(requestOrigin{}), ArcQuery{}, false, ""},
+		{"other app", withOrigin(requestOrigin{}), ArcQuery{App: "dashboard"}, false, ""},
+		{"dashboard headers", withOrigin(requestOrigin{Dashboard: "d1", Panel: "2"}), ArcQuery{App: appExplore}, false, ""},
+		{"alert", withOrigin(requestOrigin{Alert: true}), ArcQuery{App: appExplore}, false, ""},
+		{"variable query", withOrigin(requestOrigin{}), ArcQuery{App: appExplore, RefID: metricFindQueryRefID}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exploreDefaults(tt.ctx, tt.qm)
+			if got.fromExplore() != tt.wantExplore || got.Format != tt.wantFormat {
+				t.Errorf("fromExplore = %v, format %q; want %v, %q", got.fromExplore(), got.Format, tt.wantExplore, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestResolveExploreMaxRows(t *testing.T) {
+	for in, want := range map[int64]int64{0: DefaultExploreMaxRows, -1: 0, 500: 500} {
+		if got := resolveExploreMaxRows(in); got != want {
+			t.Errorf("resolveExploreMaxRows(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+// TestQuery_Explore: an Explore query is capped by exploreMaxRows instead
+// of maxRows, shaped as a table, and keeps its columns when empty; its own
+// fields and a dashboard request are left alone.
+func TestQuery_Explore(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = body.SQL
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"columns":["host","value"],"types":["VARCHAR","DOUBLE"],"data":[]}`))
+	}))
+	defer srv.Close()
+
+	run := func(t *testing.T, extra map[string]any, query string, dashboard bool) (string, *data.Frame) {
+		t.Helper()
+		if extra == nil {
+			extra = map[string]any{}
+		}
+		extra["useArrow"] = false
+		extra["maxRows"] = 50
+		req := &backend.QueryDataRequest{
+			PluginContext: testPluginContext(t, srv.URL, extra),
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(query)}},
+		}
+		if dashboard {
+			req.SetHTTPHeader("X-Dashboard-Uid", "dash-1")
+			req.SetHTTPHeader("X-Panel-Id", "7")
+		}
+		res, err := NewArcDatasource().QueryData(t.Context(), req)
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		resp := res.Responses["A"]
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return sent, resp.Frames[0]
+	}
+
+	t.Run("explore", func(t *testing.T) {
+		sql, frame := run(t, nil, `{"sql":"SELECT * FROM t","app":"explore"}`, false)
+		if !strings.HasSuffix(sql, "LIMIT 10000") {
+			t.Errorf("sent %q, want the Explore preview cap", sql)
+		}
+		if len(frame.Fields) != 2 || frame.Fields[1].Type() != data.FieldTypeNullableFloat64 {
+			t.Errorf("empty result fields = %v", frame.Fields)
+		}
+		if frame.Meta.Type != data.FrameTypeTable {
+			t.Errorf("frame type %q, want table", frame.Meta.Type)
+		}
+	})
+
+	t.Run("configured cap", func(t *testing.T) {
+		if sql, _ := run(t, map[string]any{"exploreMaxRows": 200}, `{"sql":"SELECT * FROM t","app":"explore"}`, false); !strings.HasSuffix(sql, "LIMIT 200") {
+			t.Errorf("sent %q", sql)
+		}
+		if sql, _ := run(t, map[string]any{"exploreMaxRows": -1}, `{"sql":"SELECT * FROM t","app":"explore"}`, false); strings.Contains(sql, "LIMIT") {
+			t.Errorf("sent %q with the preview cap off", sql)
+		}
+	})
+
+	t.Run("query fields win", func(t *testing.T) {
+		if sql, _ := run(t, nil, `{"sql":"SELECT * FROM t","app":"explore","rowLimit":5}`, false); !strings.HasSuffix(sql, "LIMIT 5") {
+			t.Errorf("sent %q, want the query's rowLimit", sql)
+		}
+		if sql, _ := run(t, nil, `{"sql":"SELECT * FROM t LIMIT 3","app":"explore"}`, false); strings.Count(sql, "LIMIT") != 1 {
+			t.Errorf("sent %q, want the query's own LIMIT only", sql)
+		}
+		if _, frame := run(t, nil, `{"sql":"SELECT * FROM t","app":"explore","format":"time_series"}`, false); frame.Meta.Type == data.FrameTypeTable {
+			t.Error("explicit time_series format shaped as a table")
+		}
+	})
+
+	t.Run("dashboard", func(t *testing.T) {
+		sql, frame := run(t, nil, `{"sql":"SELECT * FROM t","app":"explore"}`, true)
+		if !strings.HasSuffix(sql, "LIMIT 50") {
+			t.Errorf("sent %q, want the datasource's maxRows", sql)
+		}
+		if len(frame.Fields) != 2 {
+			t.Errorf("dashboard query kept %d columns of an empty result, want 2", len(frame.Fields))
+		}
+	})
+}
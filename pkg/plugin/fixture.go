@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// errNoFixture is returned in fixture mode for a request with no stored
+// response. The message names only the fixture file to add, so it is shown
+// to the user verbatim.
+var errNoFixture = errors.New("no fixture for this query")
+
+// fixtureStore replays (and optionally records) Arc responses from a local
+// directory, for panel development without a live Arc: CI screenshot tests,
+// demos, reproducible bug reports. Fixtures sit under doRequest, so a
+// replayed body goes through exactly the decoding and frame preparation a
+// live one does.
+//
+// A fixture is the raw body of one 200 response, stored as
+// <fingerprint>.arrow or <fingerprint>.json by the protocol that asked for
+// it. Recording also writes <fingerprint>.sql with the request body, so a
+// human can tell what a fixture answers. The fingerprint covers the SQL as
+// sent — after macro expansion — so a fixture matches one concrete time
+// range: record with an absolute dashboard range, not "last 6 hours".
+// Split queries record one fixture per chunk.
+type fixtureStore struct {
+	dir    string
+	record bool
+}
+
+// newFixtureStore builds the store for the fixtureMode setting: a local
+// directory path or a file:// URL. Empty disables fixtures (nil store).
+// The directory must exist; recording never creates directories, so a typo
+// fails at "Save & test" instead of scattering files.
+func newFixtureStore(setting string, record bool) (*fixtureStore, error) {
+	if setting == "" {
+		if record {
+			return nil, errors.New("fixtureRecord needs fixtureMode set to the fixture directory")
+		}
+		return nil, nil
+	}
+	dir := strings.TrimPrefix(setting, "file://")
+	if strings.Contains(dir, "://") {
+		return nil, fmt.Errorf("fixtureMode must be a local directory or file:// URL, got %q", setting)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("fixture directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("fixture directory %q is not a directory", dir)
+	}
+	return &fixtureStore{dir: dir, record: record}, nil
+}
+
+// fixtureFingerprint keys a fixture by endpoint, database and request body.
+func fixtureFingerprint(path, database string, body []byte) string {
+	sum := sha256.Sum256([]byte(path + "\x00" + database + "\x00" + string(body)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// fixtureFile names the fixture for fingerprint fp answering accept.
+func fixtureFile(fp, accept string) string {
+	if accept == arrowStreamMediaType {
+		return fp + ".arrow"
+	}
+	return fp + ".json"
+}
+
+// open replays the fixture for fp.
+func (f *fixtureStore) open(fp, accept string) (io.ReadCloser, error) {
+	name := fixtureFile(fp, accept)
+	file, err := os.Open(filepath.Join(f.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: add %s to the fixture directory, or enable fixture recording against a live Arc", errNoFixture, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture %s: %w", name, err)
+	}
+	return file, nil
+}
+
+// recorder tees a live response body into the fixture for fp. The fixture
+// is written to a temp file and renamed into place only when the body was
+// read to EOF, so a canceled or failed response never leaves a truncated
+// fixture behind. Recording failures are logged, never surfaced: the live
+// query already succeeded.
+func (f *fixtureStore) recorder(body io.ReadCloser, fp, accept string, request []byte) io.ReadCloser {
+	tmp, err := os.CreateTemp(f.dir, fp+".*.tmp")
+	if err != nil {
+		log.DefaultLogger.Warn("Fixture recording failed", "fingerprint", fp, "error", err.Error())
+		return body
+	}
+	return &fixtureRecorder{
+		ReadCloser: body,
+		tmp:        tmp,
+		final:      filepath.Join(f.dir, fixtureFile(fp, accept)),
+		sqlFile:    filepath.Join(f.dir, fp+".sql"),
+		request:    request,
+	}
+}
+
+type fixtureRecorder struct {
+	io.ReadCloser
+	tmp      *os.File
+	final    string
+	sqlFile  string
+	request  []byte
+	complete bool
+	failed   bool
+}
+
+func (r *fixtureRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && !r.failed {
+		if _, werr := r.tmp.Write(p[:n]); werr != nil {
+			r.failed = true
+		}
+	}
+	if err == io.EOF {
+		r.complete = true
+	}
+	return n, err
+}
+
+// Close first drains what the decoder left unread — a JSON decoder or the
+// Arrow reader can stop before the transport's EOF — so the fixture holds
+// the whole body. A body that can't be read to EOF (canceled, stalled,
+// over the size cap) is discarded rather than stored truncated.
+func (r *fixtureRecorder) Close() error {
+	if !r.complete && !r.failed {
+		_, _ = io.Copy(io.Discard, r)
+	}
+	err := r.ReadCloser.Close()
+	name := r.tmp.Name()
+	if cerr := r.tmp.Close(); cerr != nil {
+		r.failed = true
+	}
+	if !r.complete || r.failed {
+		_ = os.Remove(name)
+		return err
+	}
+	if rerr := os.Rename(name, r.final); rerr != nil {
+		_ = os.Remove(name)
+		log.DefaultLogger.Warn("Fixture recording failed", "fixture", r.final, "error", rerr.Error())
+		return err
+	}
+	if werr := os.WriteFile(r.sqlFile, r.request, 0o644); werr != nil {
+		log.DefaultLogger.Warn("Fixture request not written", "file", r.sqlFile, "error", werr.Error())
+	}
+	log.DefaultLogger.Debug("Recorded fixture", "fixture", r.final)
+	return err
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// TestFixtures_RecordThenReplay records a live JSON response and replays it
+// with Arc gone: the replayed query returns the same data through the
+// normal pipeline.
+func TestFixtures_RecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","value"],"data":[["2025-01-01T00:00:00Z",1.5],["2025-01-01T00:01:00Z",2.5]]}`))
+	}))
+
+	useJSON := false
+	q := backend.DataQuery{
+		RefID: "A",
+		TimeRange: backend.TimeRange{
+			From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC),
+		},
+		JSON: []byte(`{"sql":"SELECT time, value FROM cpu WHERE $__timeFilter(time)","format":"table"}`),
+	}
+	d := NewArcDatasource()
+
+	recorder := newTestInstance(t, srv.URL)
+	recorder.settings.UseArrow = &useJSON
+	var err error
+	if recorder.fixtures, err = newFixtureStore(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	live := d.query(t.Context(), recorder, q)
+	if live.Error != nil {
+		t.Fatalf("live query: %v", live.Error)
+	}
+	srv.Close()
+
+	for _, pattern := range []string{"*.json", "*.sql"} {
+		if m, _ := filepath.Glob(filepath.Join(dir, pattern)); len(m) != 1 {
+			t.Errorf("expected one %s fixture file, got %v", pattern, m)
+		}
+	}
+	if m, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(m) != 0 {
+		t.Errorf("temp files left behind: %v", m)
+	}
+
+	replayer := newTestInstance(t, srv.URL)
+	replayer.settings.UseArrow = &useJSON
+	if replayer.fixtures, err = newFixtureStore("file://"+dir, false); err != nil {
+		t.Fatal(err)
+	}
+	replayed := d.query(t.Context(), replayer, q)
+	if replayed.Error != nil {
+		t.Fatalf("replayed query: %v", replayed.Error)
+	}
+	if len(replayed.Frames) != 1 || replayed.Frames[0].Rows() != 2 {
+		t.Fatalf("unexpected replayed frames: %v", replayed.Frames)
+	}
+	if v, _ := replayed.Frames[0].Fields[1].FloatAt(1); v != 2.5 {
+		t.Errorf("replayed value = %v, want 2.5", v)
+	}
+}
+
+// TestFixtures_ReplayArrowAndMiss replays an Arrow fixture through
+// queryArrow and checks that a miss names the exact file to add.
+func TestFixtures_ReplayArrowAndMiss(t *testing.T) {
+	dir := t.TempDir()
+	inst := newTestInstance(t, "http://127.0.0.1:1") // never dialed
+	var err error
+	if inst.fixtures, err = newFixtureStore(dir, false); err != nil {
+		t.Fatal(err)
+	}
+
+	fp := fixtureFingerprint("/api/v1/query/arrow", inst.settings.Database, []byte(`{"sql":"SELECT 1"}`))
+	stream := bytes.Join(arrowStreamSegments(t, []float64{1, 2, 3}), nil)
+	if err := os.WriteFile(filepath.Join(dir, fp+".arrow"), stream, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := queryArrow(t.Context(), inst, "SELECT 1")
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if frame.Rows() != 3 {
+		t.Errorf("expected 3 replayed rows, got %d", frame.Rows())
+	}
+
+	_, err = queryArrow(t.Context(), inst, "SELECT 2")
+	if !errors.Is(err, errNoFixture) {
+		t.Fatalf("expected errNoFixture, got %v", err)
+	}
+	missing := fixtureFingerprint("/api/v1/query/arrow", inst.settings.Database, []byte(`{"sql":"SELECT 2"}`)) + ".arrow"
+	if msg := sanitizeUserError("A", err); !strings.Contains(msg, missing) {
+		t.Errorf("user message %q should name %s", msg, missing)
+	}
+}
+
+func TestNewFixtureStore_Validation(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "f")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		setting string
+		record  bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"", true, true},
+		{dir, true, false},
+		{"file://" + dir, false, false},
+		{"https://example.com/fixtures", false, true},
+		{filepath.Join(dir, "missing"), false, true},
+		{file, false, true},
+	} {
+		store, err := newFixtureStore(c.setting, c.record)
+		if (err != nil) != c.wantErr {
+			t.Errorf("newFixtureStore(%q, %v): err = %v, wantErr %v", c.setting, c.record, err, c.wantErr)
+		}
+		if c.setting == "" && store != nil {
+			t.Errorf("empty setting should disable fixtures")
+		}
+	}
+}
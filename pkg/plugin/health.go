@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Classes of CheckHealth failure, reported as JSONDetails' errorClass so
+// the config page (and anyone scripting Save & Test) can tell an unusable
+// URL from an unreachable server, a rejected key and a failing query.
+const (
+	healthErrorURL      = "url"      // the configured URL is invalid
+	healthErrorSettings = "settings" // other settings are invalid
+	healthErrorNetwork  = "network"  // Arc couldn't be reached
+	healthErrorAuth     = "auth"     // Arc rejected the API key
+	healthErrorQuery    = "query"    // Arc answered, but the query failed
+)
+
+// healthFailure classifies err, the failure of CheckHealth's SHOW DATABASES
+// on s, into one of the classes above and a message that says what to fix.
+func healthFailure(err error, s *ArcInstanceSettings) (class, message string) {
+	arcURL := s.settings.URL
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var statusErr *arcStatusError
+	switch {
+	case errors.As(err, &dnsErr):
+		class, message = healthErrorNetwork, fmt.Sprintf("Cannot reach Arc at %s: hostname not found", hostPort(arcURL))
+	case errors.Is(err, syscall.ECONNREFUSED):
+		class, message = healthErrorNetwork, fmt.Sprintf("Cannot reach Arc at %s: connection refused", hostPort(arcURL))
+	case errors.Is(err, errBlockedAddr):
+		class, message = healthErrorNetwork, fmt.Sprintf("Cannot reach Arc at %s: it resolves to a blocked (private/loopback) address. Enable 'Allow Private IPs' if that is intended.", hostPort(arcURL))
+	case errors.As(err, &opErr):
+		class, message = healthErrorNetwork, fmt.Sprintf("Cannot reach Arc at %s: %s failed", hostPort(arcURL), opErr.Op)
+	case errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden):
+		class = healthErrorAuth
+		if s.apiKey == "" {
+			message = fmt.Sprintf("Arc rejected the unauthenticated request (HTTP %d): it requires an API key. Set one in the datasource settings.", statusErr.StatusCode)
+		} else {
+			message = fmt.Sprintf("API key rejected by Arc (HTTP %d). Check the API key in the datasource settings.", statusErr.StatusCode)
+		}
+	default:
+		return healthErrorQuery, "Arc query failed: " + sanitizeUserError("health", err)
+	}
+	log.DefaultLogger.Error("Health check failed", "class", class, "error", err.Error())
+	return class, message
+}
+
+// hostPort names the host and port of arcURL, the port defaulted from the
+// scheme, for "cannot reach" messages.
+func hostPort(arcURL string) string {
+	u, err := url.Parse(arcURL)
+	if err != nil || u.Host == "" {
+		return arcURL
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// healthError is a failed CheckHealthResult whose JSONDetails carry class.
+func healthError(class, message string) *backend.CheckHealthResult {
+	details, _ := json.Marshal(map[string]string{"errorClass": class})
+	return &backend.CheckHealthResult{
+		Status:      backend.HealthStatusError,
+		Message:     message,
+		JSONDetails: details,
+	}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestValidateArcURL(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"plain", "http://arc.example.com:8000", false},
+		{"path", "https://arc.example.com/arc", false},
+		{"bad scheme", "ftp://arc.example.com", true},
+		{"query", "http://arc.example.com:8000?db=x", true},
+		{"empty query", "http://arc.example.com:8000?", true},
+		{"fragment", "http://arc.example.com:8000/#x", true},
+		{"trailing text", "http://arc.example.com:8000/ copy", true},
+		{"trailing newline", "http://arc.example.com:8000\n", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateArcURL(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validateArcURL(%q) error=%v wantErr=%v", tc.input, err, tc.wantErr)
+			}
+			if err != nil && !errors.Is(err, errInvalidURL) {
+				t.Errorf("error %v is not errInvalidURL", err)
+			}
+		})
+	}
+}
+
+// TestCheckHealth_FailureClasses checks each failure gets its own message
+// and errorClass rather than one opaque "failed to connect".
+func TestCheckHealth_FailureClasses(t *testing.T) {
+	status := func(code int) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"nope"}`, code)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	for _, c := range []struct {
+		name        string
+		url         string
+		wantClass   string
+		wantMessage string
+	}{
+		{"invalid url", "http://arc.example.com:8000?x=1", healthErrorURL, "URL must not have a query string"},
+		{"connection refused", closedURL, healthErrorNetwork, "Cannot reach Arc at " + strings.TrimPrefix(closedURL, "http://") + ": connection refused"},
+		{"unknown host", "http://arc.invalid:8000", healthErrorNetwork, "Cannot reach Arc at arc.invalid:8000"},
+		{"unauthorized", status(http.StatusUnauthorized), healthErrorAuth, "API key rejected by Arc (HTTP 401)"},
+		{"forbidden", status(http.StatusForbidden), healthErrorAuth, "API key rejected by Arc (HTTP 403)"},
+		{"query error", status(http.StatusBadRequest), healthErrorQuery, "Arc query failed: "},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			pctx := testPluginContext(t, c.url, map[string]any{"useArrow": false, "retryStatusCodes": []int{}})
+			res, err := NewArcDatasource().CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != backend.HealthStatusError || !strings.Contains(res.Message, c.wantMessage) {
+				t.Errorf("CheckHealth = %v %q, want error containing %q", res.Status, res.Message, c.wantMessage)
+			}
+			var details struct {
+				ErrorClass string `json:"errorClass"`
+			}
+			if err := json.Unmarshal(res.JSONDetails, &details); err != nil || details.ErrorClass != c.wantClass {
+				t.Errorf("errorClass = %q (%v), want %q", details.ErrorClass, err, c.wantClass)
+			}
+		})
+	}
+}
+
+// TestCheckHealth_ReportsVersionAndDatabase checks a passing check names
+// the Arc version and configured database, in the message and details.
+func TestCheckHealth_ReportsVersionAndDatabase(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == arcVersionPath {
+			_, _ = w.Write([]byte(`{"status":"ok","version":"26.01.1"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"columns":["name"],"data":[["metrics"]]}`))
+	}))
+	defer srv.Close()
+
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "database": "metrics"})
+	res, err := NewArcDatasource().CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx})
+	if err != nil || res.Status != backend.HealthStatusOk {
+		t.Fatalf("CheckHealth: %v %+v", err, res)
+	}
+	if want := "Arc datasource is working (Arc 26.01.1); database: metrics; protocol: JSON"; res.Message != want {
+		t.Errorf("message = %q, want %q", res.Message, want)
+	}
+	var details struct {
+		Database   string      `json:"database"`
+		ArcVersion versionInfo `json:"arcVersion"`
+	}
+	if err := json.Unmarshal(res.JSONDetails, &details); err != nil {
+		t.Fatal(err)
+	}
+	if details.Database != "metrics" || details.ArcVersion.Version != "26.01.1" {
+		t.Errorf("details = %+v", details)
+	}
+}
@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Grafana identity (forwardGrafanaUser setting): every request to Arc names
+// the Grafana user behind it, so Arc's audit log can tell users apart
+// rather than showing everything as the datasource's one API key:
+//
+//	X-Grafana-User:   the user's login, percent-encoded (RFC 3986)
+//	X-Grafana-Org-Id: the org the request came from
+//
+// Requests without a user — alert rule evaluations, background work — name
+// the serviceIdentity setting instead. It is off by default: it puts logins
+// in Arc's logs. The identity is informational; Arc still authorizes by the
+// API key.
+
+const (
+	grafanaUserHeader  = "X-Grafana-User"
+	grafanaOrgIDHeader = "X-Grafana-Org-Id"
+
+	// defaultServiceIdentity is sent as the user when serviceIdentity is
+	// empty.
+	defaultServiceIdentity = "grafana"
+)
+
+// withCallerIdentity returns ctx carrying pctx's user and org, for requests
+// other than QueryData, whose context withRequestUser and withRequestOrigin
+// fill in along with the dashboard and panel.
+func withCallerIdentity(ctx context.Context, pctx backend.PluginContext) context.Context {
+	ctx = withRequestUser(ctx, pctx.User)
+	return context.WithValue(ctx, requestOriginKey{}, requestOrigin{OrgID: pctx.OrgID})
+}
+
+// setIdentityHeaders names ctx's Grafana user and org on req when
+// forwardGrafanaUser is on.
+func (s *ArcInstanceSettings) setIdentityHeaders(ctx context.Context, req *http.Request) {
+	if !s.settings.ForwardGrafanaUser {
+		return
+	}
+	login := s.settings.ServiceIdentity
+	if login == "" {
+		login = defaultServiceIdentity
+	}
+	if user := requestUserFrom(ctx); user != nil && user.Login != "" {
+		// Logins can hold anything Grafana accepts, non-ASCII included;
+		// escaped, every one fits in a header.
+		login = url.PathEscape(user.Login)
+	}
+	req.Header.Set(grafanaUserHeader, login)
+	if org := requestOriginFrom(ctx).OrgID; org != 0 {
+		req.Header.Set(grafanaOrgIDHeader, strconv.FormatInt(org, 10))
+	}
+}
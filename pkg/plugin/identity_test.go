@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// TestForwardGrafanaUser checks the identity headers of queries and health
+// checks for an interactive user, for requests without one (alerting) and
+// with the setting off.
+func TestForwardGrafanaUser(t *testing.T) {
+	type sent struct{ user, org string }
+	var (
+		mu   sync.Mutex
+		seen []sent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, sent{r.Header.Get(grafanaUserHeader), r.Header.Get(grafanaOrgIDHeader)})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name  string
+		extra map[string]any
+		user  *backend.User
+		want  sent
+	}{
+		{"user", map[string]any{"forwardGrafanaUser": true}, &backend.User{Login: "alice", Role: "Viewer"}, sent{"alice", "3"}},
+		{"unicode login", map[string]any{"forwardGrafanaUser": true}, &backend.User{Login: "zoë smith"}, sent{"zo%C3%AB%20smith", "3"}},
+		{"no user", map[string]any{"forwardGrafanaUser": true, "serviceIdentity": "grafana-alerting"}, nil, sent{"grafana-alerting", "3"}},
+		{"no user, default identity", map[string]any{"forwardGrafanaUser": true}, nil, sent{defaultServiceIdentity, "3"}},
+		{"off", nil, &backend.User{Login: "alice"}, sent{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			mu.Lock()
+			seen = nil
+			mu.Unlock()
+			extra := map[string]any{"useArrow": false}
+			for k, v := range c.extra {
+				extra[k] = v
+			}
+			pctx := testPluginContext(t, srv.URL, extra)
+			pctx.OrgID, pctx.User = 3, c.user
+			d := NewArcDatasource()
+			resp, err := d.QueryData(t.Context(), &backend.QueryDataRequest{
+				PluginContext: pctx,
+				Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT 1","format":"table"}`)}},
+			})
+			if err != nil || resp.Responses["A"].Error != nil {
+				t.Fatalf("QueryData: %v %v", err, resp.Responses["A"].Error)
+			}
+			if res, err := d.CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx}); err != nil || res.Status != backend.HealthStatusOk {
+				t.Fatalf("CheckHealth: %v %+v", err, res)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(seen) < 2 {
+				t.Fatalf("expected requests from the query and the health check, got %d", len(seen))
+			}
+			for _, got := range seen {
+				if got != c.want {
+					t.Errorf("sent %+v, want %+v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestServiceIdentity_Validated(t *testing.T) {
+	_, err := newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"url":"https://arc.example.com","forwardGrafanaUser":true,"serviceIdentity":"svc\r\nX-Evil: 1"}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "k"},
+	})
+	if err == nil {
+		t.Fatal("expected a serviceIdentity with a line break to be rejected")
+	}
+}
@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Last-value optimization (lastValueOptimization query option): a stat panel
+// showing the latest value per series only needs one row per series, yet
+// ran the full panel SQL every refresh. lastValueSQL rewrites the query so
+// Arc returns just those rows:
+//
+//   - a single-series raw query (`SELECT time, value FROM ...`, no GROUP BY
+//     or ORDER BY) gets `ORDER BY time DESC LIMIT 1` appended;
+//   - any other single-series query is wrapped:
+//     `SELECT * FROM (<sql>) ORDER BY time DESC LIMIT 1`;
+//   - a query grouped by series keys (`GROUP BY 1, host`) is wrapped in a
+//     latest-per-group query: `QUALIFY row_number() OVER (PARTITION BY host
+//     ORDER BY time DESC) = 1`.
+//
+// The series keys come from the outer GROUP BY, so a raw query selecting
+// several columns can't be rewritten: nothing says which are labels and
+// which are values. Every shape the parser doesn't recognize is left alone
+// and runs in full — the optimization is never allowed to change which
+// series a panel shows.
+
+var (
+	outerSelectRe  = regexp.MustCompile(`(?i)\bSELECT\b`)
+	outerFromRe    = regexp.MustCompile(`(?i)\bFROM\b`)
+	outerOrderByRe = regexp.MustCompile(`(?i)\bORDER\s+BY\b`)
+	selectAliasRe  = regexp.MustCompile(`(?is)^(.*?)\s+AS\s+("(?:[^"]|"")+"|[A-Za-z_][\w$]*)\s*$`)
+	bareColumnRe   = regexp.MustCompile(`^(?:(?:"[^"]+"|[A-Za-z_][\w$]*)\s*\.\s*)*("[^"]+"|[A-Za-z_][\w$]*)$`)
+)
+
+// selectItem is one expression of the outer select list.
+type selectItem struct {
+	expr string // expression without its alias, whitespace-normalized
+	name string // output column name as written (quotes kept), "" if unknown
+}
+
+// lastValueSQL rewrites sql to return only the latest row per series (see
+// above). The error says why a query was left alone, for the debug log.
+func lastValueSQL(sql string, s strippedSQL) (string, error) {
+	switch {
+	case containsMultipleStatements(s):
+		return "", errors.New("multiple statements")
+	case containsUnion(s):
+		return "", errors.New("UNION")
+	case containsLIMIT(s):
+		return "", errors.New("query has its own LIMIT")
+	}
+
+	outer := blankNested(s.stripped)
+	sel := outerSelectRe.FindStringIndex(outer)
+	if sel == nil {
+		return "", errors.New("no SELECT")
+	}
+	from := outerFromRe.FindStringIndex(outer[sel[1]:])
+	if from == nil {
+		return "", errors.New("no FROM")
+	}
+	listEnd := sel[1] + from[0]
+	items, err := selectItems(s.stripped[sel[1]:listEnd], outer[sel[1]:listEnd])
+	if err != nil {
+		return "", err
+	}
+	timeIdx := -1
+	for i, item := range items {
+		if strings.EqualFold(strings.Trim(item.name, `"`), "time") {
+			timeIdx = i
+			break
+		}
+	}
+	if timeIdx < 0 {
+		return "", errors.New("no time column in the select list")
+	}
+	timeCol := items[timeIdx].name
+
+	rest := outer[listEnd:]
+	keys, grouped, err := seriesKeys(s.stripped[listEnd:], rest, items, timeIdx)
+	if err != nil {
+		return "", err
+	}
+	body := strings.TrimRight(sql, " \t\r\n;")
+
+	switch {
+	case !grouped && len(items) == 2 && !outerOrderByRe.MatchString(rest):
+		return body + "\nORDER BY " + timeCol + " DESC\nLIMIT 1", nil
+	case !grouped && len(items) != 2:
+		return "", errors.New("raw query selects several columns; series labels can't be told from values")
+	case len(keys) == 0:
+		return "SELECT * FROM (\n" + body + "\n) AS _arc_last ORDER BY " + timeCol + " DESC LIMIT 1", nil
+	default:
+		return "SELECT * FROM (\n" + body + "\n) AS _arc_last QUALIFY row_number() OVER (PARTITION BY " +
+			strings.Join(keys, ", ") + " ORDER BY " + timeCol + " DESC) = 1", nil
+	}
+}
+
+// selectItems splits the outer select list (list, with outer its
+// blankNested view for finding top-level commas) into items.
+func selectItems(list, outer string) ([]selectItem, error) {
+	if d := strings.Fields(strings.ToUpper(outer)); len(d) > 0 && d[0] == "DISTINCT" {
+		return nil, errors.New("SELECT DISTINCT")
+	}
+	var items []selectItem
+	for _, part := range splitTopLevel(list, outer) {
+		part = strings.Join(strings.Fields(part), " ")
+		if part == "*" || strings.HasSuffix(part, ".*") {
+			return nil, errors.New("SELECT * hides which columns are series labels")
+		}
+		item := selectItem{expr: part}
+		if m := selectAliasRe.FindStringSubmatch(part); m != nil {
+			item.expr, item.name = m[1], m[2]
+		} else if m := bareColumnRe.FindStringSubmatch(part); m != nil {
+			item.name = m[1]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// seriesKeys resolves the outer GROUP BY (clause, with outer its
+// blankNested view) against the select list and returns the output names
+// of every key but the time bucket. grouped is false when there is no
+// GROUP BY.
+func seriesKeys(clause, outer string, items []selectItem, timeIdx int) (keys []string, grouped bool, err error) {
+	loc := groupByRe.FindStringIndex(outer)
+	if loc == nil {
+		return nil, false, nil
+	}
+	list, listOuter := clause[loc[1]:], outer[loc[1]:]
+	if end := groupByEndRe.FindStringIndex(listOuter); end != nil {
+		list, listOuter = list[:end[0]], listOuter[:end[0]]
+	}
+	for _, key := range splitTopLevel(list, listOuter) {
+		key = strings.Join(strings.Fields(key), " ")
+		idx := -1
+		if n, err := strconv.Atoi(key); err == nil {
+			if n >= 1 && n <= len(items) {
+				idx = n - 1
+			}
+		} else {
+			for i, item := range items {
+				if strings.EqualFold(key, item.name) || strings.EqualFold(key, item.expr) {
+					idx = i
+					break
+				}
+			}
+		}
+		switch {
+		case strings.EqualFold(key, "ALL"):
+			return nil, true, errors.New("GROUP BY ALL")
+		case idx < 0:
+			return nil, true, fmt.Errorf("GROUP BY key %q isn't in the select list", key)
+		case idx == timeIdx:
+			continue
+		case items[idx].name == "":
+			return nil, true, fmt.Errorf("GROUP BY key %q has no output name", key)
+		}
+		keys = append(keys, items[idx].name)
+	}
+	return keys, true, nil
+}
+
+// blankNested returns s with everything inside parentheses replaced by
+// spaces — the parentheses themselves are kept — so keyword searches see
+// only the outer statement. Offsets into s are unchanged.
+func blankNested(s string) string {
+	out := []byte(s)
+	depth := 0
+	for i, c := range out {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth > 0:
+			out[i] = ' '
+		}
+	}
+	return string(out)
+}
+
+// splitTopLevel splits s at the commas its blankNested view outer still
+// shows, i.e. the ones outside parentheses.
+func splitTopLevel(s, outer string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(outer); i++ {
+		if outer[i] == ',' {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
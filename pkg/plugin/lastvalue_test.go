@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestLastValueSQL(t *testing.T) {
+	cases := []struct {
+		name, sql, want string
+	}{
+		{
+			"raw single series: ORDER BY appended",
+			"SELECT time, usage FROM cpu WHERE $__timeFilter(time);",
+			"SELECT time, usage FROM cpu WHERE $__timeFilter(time)\nORDER BY time DESC\nLIMIT 1",
+		},
+		{
+			"raw single series with ORDER BY: wrapped",
+			"SELECT time, usage FROM cpu ORDER BY time",
+			"SELECT * FROM (\nSELECT time, usage FROM cpu ORDER BY time\n) AS _arc_last ORDER BY time DESC LIMIT 1",
+		},
+		{
+			"time-only GROUP BY: wrapped",
+			"SELECT $__timeGroup(time, '1m') AS time, avg(usage) AS usage FROM cpu GROUP BY 1 ORDER BY 1",
+			"SELECT * FROM (\nSELECT $__timeGroup(time, '1m') AS time, avg(usage) AS usage FROM cpu GROUP BY 1 ORDER BY 1\n) AS _arc_last ORDER BY time DESC LIMIT 1",
+		},
+		{
+			"series keys by position, alias and expression",
+			"SELECT $__timeGroup(time, '1m') AS time, c.host, region AS \"Region\", avg(usage) FROM cpu c GROUP BY $__timeGroup(time, '1m'), 2, region",
+			"SELECT * FROM (\nSELECT $__timeGroup(time, '1m') AS time, c.host, region AS \"Region\", avg(usage) FROM cpu c GROUP BY $__timeGroup(time, '1m'), 2, region\n) AS _arc_last QUALIFY row_number() OVER (PARTITION BY host, \"Region\" ORDER BY time DESC) = 1",
+		},
+		{
+			"CTE: outer select list is used",
+			"WITH x AS (SELECT time, host, usage FROM cpu) SELECT time, host, max(usage) AS m FROM x GROUP BY time, host",
+			"SELECT * FROM (\nWITH x AS (SELECT time, host, usage FROM cpu) SELECT time, host, max(usage) AS m FROM x GROUP BY time, host\n) AS _arc_last QUALIFY row_number() OVER (PARTITION BY host ORDER BY time DESC) = 1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := lastValueSQL(c.sql, newStrippedSQL(c.sql))
+			if err != nil {
+				t.Fatalf("unexpected fallback: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+// TestLastValueSQL_FallsBack pins the shapes left alone: each would risk
+// returning different series than the full query.
+func TestLastValueSQL_FallsBack(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT * FROM cpu",
+		"SELECT time, host, usage FROM cpu",
+		"SELECT time, usage FROM cpu LIMIT 10",
+		"SELECT time, usage FROM a UNION ALL SELECT time, usage FROM b",
+		"SELECT time, usage FROM cpu; SELECT 1",
+		"SELECT ts, usage FROM cpu",
+		"SELECT DISTINCT time, usage FROM cpu",
+		"SELECT time, host, avg(usage) FROM cpu GROUP BY ALL",
+		"SELECT time, upper(host), avg(usage) FROM cpu GROUP BY 1, 2",
+		"SELECT time, avg(usage) FROM cpu GROUP BY time, host",
+	} {
+		if got, err := lastValueSQL(sql, newStrippedSQL(sql)); err == nil {
+			t.Errorf("%q should fall back, got %q", sql, got)
+		}
+	}
+}
+
+// TestQuery_LastValueOptimization checks the rewritten SQL is what reaches
+// Arc, unsplit and without the row cap, even over a range that would
+// otherwise auto-split.
+func TestQuery_LastValueOptimization(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.SQL)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","host","usage"],"data":[["2025-01-01T00:00:00Z","a",1.5],["2025-01-01T00:00:00Z","b",2.5]]}`))
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	inst.settings.TimeSeriesRowCap = 1000
+
+	now := time.Now()
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: now.Add(-7 * 24 * time.Hour), To: now},
+		JSON: []byte(`{"sql":"SELECT $__timeGroup(time, '1m') AS time, host, avg(usage) AS usage FROM cpu WHERE $__timeFilter(time) GROUP BY 1, 2",` +
+			`"lastValueOptimization":true}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	if len(seen) != 1 {
+		t.Fatalf("expected one unsplit request, got %d: %q", len(seen), seen)
+	}
+	if !strings.HasSuffix(seen[0], "QUALIFY row_number() OVER (PARTITION BY host ORDER BY time DESC) = 1") || strings.Contains(seen[0], "LIMIT") {
+		t.Errorf("unexpected SQL sent: %s", seen[0])
+	}
+	if strings.Contains(seen[0], "$__") {
+		t.Errorf("macros not expanded in the rewritten SQL: %s", seen[0])
+	}
+}
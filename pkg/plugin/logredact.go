@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Log redaction (redactColumns setting): results reach the debug log only
+// through logResult, which logs a capped list of column names and the first
+// row with each value cut to maxLoggedValueLen and the values of redacted
+// columns replaced by "***". The query log goes through redactSQL, which
+// masks the string literals a redacted column is compared with
+// (`email = 'a@example.com'`, `email IN ('a', 'b')`). A literal on the left
+// of the comparison, reaching the column through a function, or inside a
+// comment, is not recognized.
+
+// Limits on what a result puts in the debug log.
+const (
+	maxLoggedValueLen = 64
+	maxLoggedColumns  = 20
+)
+
+// redactedValue replaces a redacted column's values in the log.
+const redactedValue = "***"
+
+// redactPredicateOps are the comparisons whose right-hand literals redactSQL
+// masks.
+const redactPredicateOps = `(?:=|<>|!=|<=|>=|<|>|(?:NOT\s+)?(?:I?LIKE|IN))`
+
+// parseRedactColumns validates the redactColumns setting: the lowercased
+// column names, and the regexp redactSQL uses to find their predicates.
+func parseRedactColumns(columns []string) (map[string]bool, *regexp.Regexp, error) {
+	if len(columns) == 0 {
+		return nil, nil, nil
+	}
+	names := make(map[string]bool, len(columns))
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			return nil, nil, errors.New("invalid redactColumns: empty column name")
+		}
+		if !names[c] {
+			names[c] = true
+			quoted = append(quoted, regexp.QuoteMeta(c))
+		}
+	}
+	re, err := regexp.Compile(`(?i)(?:^|[^\w$])"?(?:` + strings.Join(quoted, "|") + `)"?\s*` + redactPredicateOps + `\s*`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid redactColumns: %w", err)
+	}
+	return names, re, nil
+}
+
+// redactSQL returns sql with the literals compared against redacted columns
+// replaced by '***'. Predicates are looked for in sql with its comments and
+// the contents of its literals blanked (maskLiteralsAndComments, which keeps
+// offsets), so a column name or a quote inside either is left alone.
+func (s *ArcInstanceSettings) redactSQL(sql string) string {
+	if s.redactPredicateRe == nil {
+		return sql
+	}
+	masked := maskLiteralsAndComments(sql)
+	var out strings.Builder
+	pos := 0
+	for {
+		m := s.redactPredicateRe.FindStringIndex(masked[pos:])
+		if m == nil {
+			out.WriteString(sql[pos:])
+			return out.String()
+		}
+		out.WriteString(sql[pos : pos+m[1]])
+		pos += m[1]
+		end := pos
+		switch {
+		case strings.HasPrefix(masked[pos:], "("):
+			// An IN list: every literal up to the closing paren.
+			end = findMatchingParen(masked, pos) + 1
+			if end == 0 {
+				end = len(sql)
+			}
+		case strings.HasPrefix(masked[pos:], "'"):
+			end = quotedEnd(sql, pos, '\'')
+		}
+		out.WriteString(maskLiterals(sql[pos:end], masked[pos:end]))
+		pos = end
+	}
+}
+
+// maskLiterals replaces every string literal in s with '***'. masked is s
+// through maskLiteralsAndComments, where only a literal's quotes are left,
+// so a quote inside a comment doesn't open one.
+func maskLiterals(s, masked string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		if masked[i] == '\'' {
+			out.WriteString("'" + redactedValue + "'")
+			i = quotedEnd(s, i, '\'')
+			continue
+		}
+		out.WriteByte(s[i])
+		i++
+	}
+	return out.String()
+}
+
+// logResult writes a decoded frame to the debug log: row and column counts,
+// the first maxLoggedColumns column names and the first row's values for
+// them, truncated and redacted.
+func (s *ArcInstanceSettings) logResult(frame *data.Frame) {
+	if frame == nil || log.DefaultLogger.Level() > log.Debug {
+		return
+	}
+	shown := frame.Fields
+	if len(shown) > maxLoggedColumns {
+		shown = shown[:maxLoggedColumns]
+	}
+	names := make([]string, len(shown))
+	var firstRow []string
+	if frame.Rows() > 0 {
+		firstRow = make([]string, len(shown))
+	}
+	for i, f := range shown {
+		names[i] = f.Name
+		if firstRow == nil {
+			continue
+		}
+		if s.redactColumns[strings.ToLower(f.Name)] {
+			firstRow[i] = redactedValue
+			continue
+		}
+		firstRow[i] = truncateLogValue(loggedValue(f, 0))
+	}
+	log.DefaultLogger.Debug("Decoded Arc result",
+		"rows", frame.Rows(),
+		"fields", len(frame.Fields),
+		"fieldNames", names,
+		"firstRow", firstRow,
+	)
+}
+
+// loggedValue renders the value of f at i for the log.
+func loggedValue(f *data.Field, i int) string {
+	v, ok := f.ConcreteAt(i)
+	if !ok {
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// truncateLogValue cuts v to maxLoggedValueLen runes.
+func truncateLogValue(v string) string {
+	if utf8.RuneCountInString(v) <= maxLoggedValueLen {
+		return v
+	}
+	return string([]rune(v)[:maxLoggedValueLen]) + "..."
+}
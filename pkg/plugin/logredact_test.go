@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// recordingLogger keeps every message logged at debug level or above.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+type logEntry struct {
+	msg  string
+	args []interface{}
+}
+
+func (l *recordingLogger) record(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{msg: msg, args: args})
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{})      { l.record(msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...interface{})       { l.record(msg, args...) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})       { l.record(msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...interface{})      { l.record(msg, args...) }
+func (l *recordingLogger) With(args ...interface{}) log.Logger        { return l }
+func (l *recordingLogger) Level() log.Level                           { return log.Debug }
+func (l *recordingLogger) FromContext(ctx context.Context) log.Logger { return l }
+
+// field returns the value logged under key with the first message msg.
+func (l *recordingLogger) field(t *testing.T, msg, key string) interface{} {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e.msg != msg {
+			continue
+		}
+		for i := 0; i+1 < len(e.args); i += 2 {
+			if e.args[i] == key {
+				return e.args[i+1]
+			}
+		}
+		t.Fatalf("%q logged without %q: %v", msg, key, e.args)
+	}
+	t.Fatalf("%q not logged", msg)
+	return nil
+}
+
+// recordLogs swaps the default logger for a recordingLogger until the test
+// ends.
+func recordLogs(t *testing.T) *recordingLogger {
+	t.Helper()
+	prev := log.DefaultLogger
+	rec := &recordingLogger{}
+	log.DefaultLogger = rec
+	t.Cleanup(func() { log.DefaultLogger = prev })
+	return rec
+}
+
+func TestRedactSQL(t *testing.T) {
+	names, re, err := parseRedactColumns([]string{"email", " SSN "})
+	if err != nil {
+		t.Fatalf("parseRedactColumns: %v", err)
+	}
+	s := &ArcInstanceSettings{redactColumns: names, redactPredicateRe: re}
+	tests := []struct {
+		sql, want string
+	}{
+		{"SELECT * FROM users WHERE email = 'a@example.com'", "SELECT * FROM users WHERE email = '***'"},
+		{"SELECT * FROM users WHERE u.Email<>'a' AND host = 'h1'", "SELECT * FROM users WHERE u.Email<>'***' AND host = 'h1'"},
+		{`SELECT * FROM users WHERE "ssn" LIKE '123-%'`, `SELECT * FROM users WHERE "ssn" LIKE '***'`},
+		{"SELECT * FROM users WHERE ssn NOT ILIKE '9%'", "SELECT * FROM users WHERE ssn NOT ILIKE '***'"},
+		{"SELECT * FROM users WHERE email IN ('a', 'b''c', lower('D'))", "SELECT * FROM users WHERE email IN ('***', '***', lower('***'))"},
+		{"SELECT * FROM users WHERE email = 'o''brien' OR ssn = '1'", "SELECT * FROM users WHERE email = '***' OR ssn = '***'"},
+		// A quote inside a comment opens no literal.
+		{"SELECT * FROM users WHERE email IN ('a', -- don't\n'b') AND host = 'h1'", "SELECT * FROM users WHERE email IN ('***', -- don't\n'***') AND host = 'h1'"},
+		{"SELECT * FROM users WHERE email = /* it's */ 'a' AND host = 'h1'", "SELECT * FROM users WHERE email = /* it's */ '***' AND host = 'h1'"},
+		{"SELECT * FROM users WHERE email IN ('a' /* ) */, 'b')", "SELECT * FROM users WHERE email IN ('***' /* ) */, '***')"},
+		// Not predicates on a redacted column.
+		{"SELECT * FROM users WHERE user_email = 'a'", "SELECT * FROM users WHERE user_email = 'a'"},
+		{"SELECT * FROM users WHERE email = backup_email", "SELECT * FROM users WHERE email = backup_email"},
+		{"SELECT email FROM users WHERE host = 'h1'", "SELECT email FROM users WHERE host = 'h1'"},
+	}
+	for _, tt := range tests {
+		if got := s.redactSQL(tt.sql); got != tt.want {
+			t.Errorf("redactSQL(%q)\n got %q\nwant %q", tt.sql, got, tt.want)
+		}
+	}
+
+	if got := (&ArcInstanceSettings{}).redactSQL(tests[0].sql); got != tests[0].sql {
+		t.Errorf("redactSQL without redactColumns changed the SQL: %q", got)
+	}
+	if _, _, err := parseRedactColumns([]string{"email", " "}); err == nil {
+		t.Error("expected an error for an empty column name")
+	}
+}
+
+func TestQuery_LogsRedactedResults(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	cols := []string{`"time"`, `"email"`, `"note"`}
+	row := []string{`"2026-03-08T00:00:00Z"`, `"a@example.com"`, `"` + long + `"`}
+	for i := 0; i < maxLoggedColumns; i++ {
+		cols = append(cols, fmt.Sprintf(`"c%d"`, i))
+		row = append(row, "1")
+	}
+	body := `{"columns":[` + strings.Join(cols, ",") + `],"data":[[` + strings.Join(row, ",") + `]]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	rec := recordLogs(t)
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, map[string]any{
+			"useArrow":      false,
+			"redactColumns": []string{"Email"},
+		}),
+		Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT * FROM users WHERE email = 'a@example.com'","format":"table"}`)}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	if r := resp.Responses["A"]; r.Error != nil {
+		t.Fatalf("query error: %v", r.Error)
+	}
+
+	if sql := rec.field(t, "Executing Arc query", "sql").(string); strings.Contains(sql, "a@example.com") || !strings.Contains(sql, "email = '***'") {
+		t.Errorf("logged sql = %q", sql)
+	}
+	names := rec.field(t, "Decoded Arc result", "fieldNames").([]string)
+	if len(names) != maxLoggedColumns {
+		t.Errorf("logged %d column names, want %d", len(names), maxLoggedColumns)
+	}
+	if fields := rec.field(t, "Decoded Arc result", "fields"); fields != len(cols) {
+		t.Errorf("fields = %v, want %d", fields, len(cols))
+	}
+	values := rec.field(t, "Decoded Arc result", "firstRow").([]string)
+	if values[1] != redactedValue {
+		t.Errorf("email logged as %q", values[1])
+	}
+	if want := strings.Repeat("x", maxLoggedValueLen) + "..."; values[2] != want {
+		t.Errorf("long value logged as %q, want %q", values[2], want)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, e := range rec.entries {
+		if s := fmt.Sprint(e.args...); strings.Contains(s, "a@example.com") {
+			t.Errorf("%q logged a redacted value: %s", e.msg, s)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Row order after a split merge. mergeFrames appends the chunks' rows in
+// range order, so the merged frame is ascending only if every chunk came
+// back sorted; an aggregate without ORDER BY comes back in whatever order
+// Arc finished it. orderMergedRows sorts the merged frame by its first time
+// field (ensureAscendingTimes: stable, a no-op when already sorted), except
+// for a table query with a top-level ORDER BY of its own, whose order is
+// kept.
+//
+// With the dedupeRows query flag it then drops rows that repeat the time
+// and labels (string and bool columns) of a row already kept for the same
+// timestamp, keeping the earliest chunk's. Chunks filtered with
+// $__timeFilter are half-open and never overlap; a query bounding its own
+// chunk with `BETWEEN $__timeFrom() AND $__timeTo()` reads the boundary
+// rows twice.
+
+// orderMergedRows sorts and optionally de-duplicates a merged split result
+// (see above), returning the frame and the number of rows dropped.
+func orderMergedRows(frame *data.Frame, qm ArcQuery) (*data.Frame, int) {
+	timeIndices := frame.TypeIndices(data.FieldTypeTime, data.FieldTypeNullableTime)
+	if len(timeIndices) == 0 {
+		return frame, 0
+	}
+	timeIdx := timeIndices[0]
+	if (qm.Format != "table" && qm.Format != "numeric_table") || !hasOuterOrderBy(qm.SQL) {
+		frame = ensureAscendingTimes(frame, timeIdx)
+	}
+	if !qm.DedupeRows {
+		return frame, 0
+	}
+	return dedupeTimeRows(frame, timeIdx)
+}
+
+// hasOuterOrderBy reports whether sql orders its result at the top level.
+func hasOuterOrderBy(sql string) bool {
+	return outerOrderByRe.MatchString(blankNested(maskLiteralsAndComments(sql)))
+}
+
+// dedupeTimeRows drops the rows of a time-sorted frame whose time and label
+// values match a row kept earlier for the same timestamp. Rows with a null
+// time are kept.
+func dedupeTimeRows(frame *data.Frame, timeIdx int) (*data.Frame, int) {
+	rowLen, err := frame.RowLen()
+	if err != nil || rowLen < 2 {
+		return frame, 0
+	}
+	labels := frame.TypeIndices(data.FieldTypeString, data.FieldTypeNullableString, data.FieldTypeBool, data.FieldTypeNullableBool)
+
+	keep := make([]int, 0, rowLen)
+	var (
+		runTime time.Time
+		runKeys map[string]struct{}
+	)
+	for i := 0; i < rowLen; i++ {
+		t, ok := toTime(frame.CopyAt(timeIdx, i))
+		if !ok {
+			keep = append(keep, i)
+			continue
+		}
+		if runKeys == nil || !t.Equal(runTime) {
+			runTime, runKeys = t, map[string]struct{}{}
+		}
+		key := ""
+		for _, idx := range labels {
+			key += "\x00" + cellKey(frame.Fields[idx], i)
+		}
+		if _, dup := runKeys[key]; dup {
+			continue
+		}
+		runKeys[key] = struct{}{}
+		keep = append(keep, i)
+	}
+	dropped := rowLen - len(keep)
+	if dropped == 0 {
+		return frame, 0
+	}
+
+	log.DefaultLogger.Debug("Dropping duplicate rows from merged chunks", "rows", rowLen, "dropped", dropped)
+	deduped := frame.EmptyCopy()
+	deduped.Meta = frame.Meta
+	deduped.Name = frame.Name
+	deduped.RefID = frame.RefID
+	for _, i := range keep {
+		deduped.AppendRow(frame.RowCopy(i)...)
+	}
+	return deduped, dropped
+}
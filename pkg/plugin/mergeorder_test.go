@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// TestSplitQuery_OverlappingChunks: chunks that answer out of order and
+// read their boundary rows twice merge sorted, and dedupeRows drops the
+// repeated rows.
+func TestSplitQuery_OverlappingChunks(t *testing.T) {
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	chunkStart := regexp.MustCompile(`'2026-03-08T(\d\d)`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		m := chunkStart.FindStringSubmatch(body.SQL)
+		if m == nil {
+			http.Error(w, "no chunk filter", http.StatusBadRequest)
+			return
+		}
+		var hour int
+		_, _ = fmt.Sscanf(m[1], "%d", &hour)
+		at := func(minutes int) string {
+			return from.Add(time.Duration(hour*60+minutes) * time.Minute).Format(time.RFC3339)
+		}
+		// Newest first, and inclusive of the chunk's end.
+		_, _ = fmt.Fprintf(w, `{"columns":["time","host","v"],"data":[["%s","a",%d],["%s","a",%d],["%s","a",%d],["%s","b",%d]]}`,
+			at(60), hour, at(30), hour, at(0), hour, at(0), hour)
+	}))
+	defer srv.Close()
+
+	run := func(t *testing.T, query string) *data.Frame {
+		t.Helper()
+		resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+			Queries: []backend.DataQuery{{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from, To: from.Add(3 * time.Hour)},
+				JSON:      []byte(query),
+			}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		r := resp.Responses["A"]
+		if r.Error != nil {
+			t.Fatalf("query error: %v", r.Error)
+		}
+		return r.Frames[0]
+	}
+	rows := func(frame *data.Frame) []string {
+		var out []string
+		for i := 0; i < frame.Rows(); i++ {
+			tm, _ := toTime(frame.Fields[0].CopyAt(i))
+			host, _ := frame.Fields[1].ConcreteAt(i)
+			v, _ := frame.Fields[2].ConcreteAt(i)
+			out = append(out, fmt.Sprintf("%s %v %v", tm.UTC().Format("15:04"), host, v))
+		}
+		return out
+	}
+	const sql = `"sql":"SELECT time, host, v FROM t WHERE time BETWEEN $__timeFrom() AND $__timeTo()","format":"table","splitDuration":"1h"`
+
+	t.Run("sorted", func(t *testing.T) {
+		frame := run(t, "{"+sql+"}")
+		got := rows(frame)
+		want := []string{
+			"00:00 a 0", "00:00 b 0", "00:30 a 0",
+			"01:00 a 0", "01:00 a 1", "01:00 b 1", "01:30 a 1",
+			"02:00 a 1", "02:00 a 2", "02:00 b 2", "02:30 a 2",
+			"03:00 a 2",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("rows = %v\nwant %v", got, want)
+		}
+		if _, ok := frame.Meta.Custom.(map[string]interface{})["duplicateRows"]; ok {
+			t.Errorf("duplicateRows set without dedupeRows: %v", frame.Meta.Custom)
+		}
+	})
+
+	t.Run("dedupeRows", func(t *testing.T) {
+		frame := run(t, "{"+sql+`,"dedupeRows":true}`)
+		got := rows(frame)
+		want := []string{
+			"00:00 a 0", "00:00 b 0", "00:30 a 0",
+			"01:00 a 0", "01:00 b 1", "01:30 a 1",
+			"02:00 a 1", "02:00 b 2", "02:30 a 2",
+			"03:00 a 2",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("rows = %v\nwant %v", got, want)
+		}
+		if n := frame.Meta.Custom.(map[string]interface{})["duplicateRows"]; n != 2 {
+			t.Errorf("duplicateRows = %v, want 2", n)
+		}
+	})
+
+	t.Run("table with its own ORDER BY", func(t *testing.T) {
+		frame := run(t, `{"sql":"SELECT time, host, v FROM t WHERE $__timeFilter(time) ORDER BY time DESC","format":"table","splitDuration":"1h"}`)
+		if got := rows(frame); got[0] != "01:00 a 0" {
+			t.Errorf("rows = %v, want the chunks' own order", got)
+		}
+	})
+}
+
+func TestDedupeTimeRows(t *testing.T) {
+	t0 := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []*time.Time{&t0, &t0, &t0, nil, nil, &t1, &t1}),
+		data.NewField("host", nil, []string{"a", "b", "a", "a", "a", "a", "b"}),
+		data.NewField("v", nil, []float64{1, 2, 3, 4, 5, 6, 7}),
+	)
+	deduped, dropped := dedupeTimeRows(frame, 0)
+	if dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+	var got []float64
+	for i := 0; i < deduped.Rows(); i++ {
+		got = append(got, deduped.Fields[2].At(i).(float64))
+	}
+	// The later "a" at t0 repeats an earlier row, even with "b" between
+	// them; null times are kept.
+	if want := []float64{1, 2, 4, 5, 6, 7}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("kept v = %v, want %v", got, want)
+	}
+}
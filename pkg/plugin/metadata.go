@@ -0,0 +1,171 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// describeCacheTTL bounds how long a table's DESCRIBE answer is reused. Much
+// longer than DefaultSchemaCacheTTL: a dashboard refreshing every few
+// seconds would otherwise re-describe its tables every minute, and a stale
+// column comment is harmless.
+const describeCacheTTL = 10 * time.Minute
+
+// describeTimeout bounds one DESCRIBE. It runs after the query has already
+// answered, so a slow one only delays the panel — and is abandoned.
+const describeTimeout = 2 * time.Second
+
+// nativeTypesMetaKey is the FrameMeta.Custom key holding the Arc (DuckDB)
+// column types, field name → type, e.g. {"value": "DOUBLE"}.
+const nativeTypesMetaKey = "nativeTypes"
+
+// enrichFieldMetadata copies column comments from the DESCRIBE output of the
+// tables a query reads into field.Config.Description (shown on hover in
+// tables), and their native types into frame meta. Fields match columns by
+// name, case-insensitively; with several tables the first to name a column
+// wins. Entirely best-effort: an unparseable FROM clause or a failed
+// DESCRIBE leaves the frames as they were.
+func (s *ArcInstanceSettings) enrichFieldMetadata(ctx context.Context, frames data.Frames, stripped strippedSQL) {
+	columns := map[string]schemaColumn{}
+	for _, table := range referencedTables(stripped) {
+		for _, col := range s.describeTable(ctx, table) {
+			key := strings.ToLower(col.Name)
+			if _, ok := columns[key]; !ok {
+				columns[key] = col
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return
+	}
+	for _, frame := range frames {
+		nativeTypes := map[string]string{}
+		for _, field := range frame.Fields {
+			col, ok := columns[strings.ToLower(field.Name)]
+			if !ok {
+				continue
+			}
+			if col.Description != "" {
+				if field.Config == nil {
+					field.Config = &data.FieldConfig{}
+				}
+				if field.Config.Description == "" {
+					field.Config.Description = col.Description
+				}
+			}
+			if col.NativeType != "" {
+				nativeTypes[field.Name] = col.NativeType
+			}
+		}
+		if len(nativeTypes) == 0 {
+			continue
+		}
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = map[string]interface{}{}
+			frame.Meta.Custom = custom
+		}
+		custom[nativeTypesMetaKey] = nativeTypes
+	}
+}
+
+// describeTable returns table's columns from Arc's DESCRIBE, through the
+// instance's schema cache. Failures are cached too (as no columns), so a
+// table DESCRIBE can't answer costs one Arc call per describeCacheTTL, not
+// one per query. A canceled request isn't cached: it says nothing about the
+// table.
+func (s *ArcInstanceSettings) describeTable(ctx context.Context, table string) []schemaColumn {
+	key := s.scopedKey(ctx, describeFingerprint(s.settings.Database, table))
+	if cols, ok := s.schemaCache.get(key); ok {
+		return cols
+	}
+	cols, err := s.describe(ctx, table)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.DefaultLogger.Debug("DESCRIBE failed; field metadata not enriched", "table", table, "error", err.Error())
+		cols = []schemaColumn{}
+	}
+	s.schemaCache.putFor(key, cols, describeCacheTTL)
+	return cols
+}
+
+// describe runs DESCRIBE over JSON and reads the name, type and comment
+// columns, accepting the column spellings DuckDB and common proxies use.
+// A result without a name column is an error; type and comment are
+// optional.
+func (s *ArcInstanceSettings) describe(ctx context.Context, table string) ([]schemaColumn, error) {
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+	frames, err := queryJSON(ctx, s, attributed(ctx, "DESCRIBE "+table))
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) != 1 {
+		return nil, errors.New("unexpected DESCRIBE result shape")
+	}
+	frame := frames[0]
+	nameField := describeField(frame, "column_name", "name", "field")
+	if nameField == nil {
+		return nil, errors.New("DESCRIBE result has no column name")
+	}
+	typeField := describeField(frame, "column_type", "type", "data_type")
+	commentField := describeField(frame, "comment", "description")
+
+	cols := make([]schemaColumn, 0, frame.Rows())
+	for i := 0; i < frame.Rows(); i++ {
+		name := describeString(nameField, i)
+		if name == "" {
+			continue
+		}
+		cols = append(cols, schemaColumn{
+			Name:        name,
+			NativeType:  describeString(typeField, i),
+			Description: describeString(commentField, i),
+		})
+	}
+	return cols, nil
+}
+
+// describeField returns the first field of frame named any of names
+// (case-insensitively), or nil.
+func describeField(frame *data.Frame, names ...string) *data.Field {
+	for _, name := range names {
+		for _, f := range frame.Fields {
+			if strings.EqualFold(f.Name, name) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// describeString reads row i of f as a string; anything else (null, a
+// number, a missing field) reads as "".
+func describeString(f *data.Field, i int) string {
+	if f == nil {
+		return ""
+	}
+	v, ok := f.ConcreteAt(i)
+	if !ok {
+		return ""
+	}
+	str, _ := v.(string)
+	return strings.TrimSpace(str)
+}
+
+// describeFingerprint keys a table's DESCRIBE answer in the schema cache.
+// The "\x00describe" suffix keeps it apart from POST /schema's keys for the
+// same text; database names can't contain NUL (validateDatabaseName).
+func describeFingerprint(database, table string) string {
+	return schemaFingerprint(database+"\x00describe", strings.ToLower(table))
+}
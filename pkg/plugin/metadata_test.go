@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestReferencedTables(t *testing.T) {
+	cases := []struct {
+		sql  string
+		want []string
+	}{
+		{"SELECT * FROM cpu WHERE $__timeFilter(time)", []string{"cpu"}},
+		{"SELECT * FROM prod.cpu c JOIN prod.mem m ON c.host = m.host", []string{"prod.cpu", "prod.mem"}},
+		{`SELECT * FROM "my db" . "cpu"`, []string{`"my db"."cpu"`}},
+		{"SELECT * FROM (SELECT * FROM cpu) AS t", []string{"cpu"}},
+		{"WITH recent AS (SELECT * FROM cpu) SELECT * FROM recent", []string{"cpu"}},
+		{"SELECT EXTRACT(hour FROM time) AS h FROM cpu", []string{"cpu"}},
+		{"SELECT * FROM read_parquet('s3://bucket/x.parquet')", nil},
+		{"SELECT * FROM cpu UNION ALL SELECT * FROM CPU", []string{"cpu"}},
+		{"SELECT 'FROM fake' AS s -- FROM commented\nFROM cpu", []string{"cpu"}},
+		{"SELECT 1", nil},
+	}
+	for _, c := range cases {
+		if got := referencedTables(newStrippedSQL(c.sql)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("referencedTables(%q) = %q, want %q", c.sql, got, c.want)
+		}
+	}
+}
+
+// TestQuery_EnrichFieldMetadata checks comments and native types land on the
+// matching fields, and that a second query is answered from the schema cache
+// without another DESCRIBE.
+func TestQuery_EnrichFieldMetadata(t *testing.T) {
+	var describes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(body.SQL, "DESCRIBE ") {
+			describes.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"columns": []string{"column_name", "column_type", "comment"},
+				"data": [][]any{
+					{"time", "TIMESTAMP", nil},
+					{"value", "DOUBLE", "CPU usage, percent"},
+				},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"columns": []string{"time", "Value"},
+			"data":    [][]any{{"2025-01-01T00:00:00Z", 1.0}},
+		})
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	inst.settings.EnrichFieldMetadata = true
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	now := time.Now()
+	q := backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		JSON:      []byte(`{"sql":"SELECT time, value AS \"Value\" FROM cpu WHERE $__timeFilter(time)","format":"table"}`),
+	}
+	d := NewArcDatasource()
+	for i := 0; i < 2; i++ {
+		resp := d.query(t.Context(), inst, q)
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		frame := resp.Frames[0]
+		if cfg := frame.Fields[1].Config; cfg == nil || cfg.Description != "CPU usage, percent" {
+			t.Errorf("value description = %+v, want the column comment", cfg)
+		}
+		if cfg := frame.Fields[0].Config; cfg != nil && cfg.Description != "" {
+			t.Errorf("time has no comment, got description %q", cfg.Description)
+		}
+		custom, _ := frame.Meta.Custom.(map[string]interface{})
+		want := map[string]string{"time": "TIMESTAMP", "Value": "DOUBLE"}
+		if got := custom[nativeTypesMetaKey]; !reflect.DeepEqual(got, want) {
+			t.Errorf("native types = %v, want %v", got, want)
+		}
+	}
+	if n := describes.Load(); n != 1 {
+		t.Errorf("expected one DESCRIBE across both queries, got %d", n)
+	}
+}
+
+// TestQuery_EnrichFieldMetadataFailureIsSilent pins that a failing DESCRIBE
+// neither fails the query nor is retried on the next one.
+func TestQuery_EnrichFieldMetadataFailureIsSilent(t *testing.T) {
+	var describes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if strings.HasPrefix(body.SQL, "DESCRIBE ") {
+			describes.Add(1)
+			http.Error(w, `{"error":"no such table"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["n"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	inst.settings.EnrichFieldMetadata = true
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	q := backend.DataQuery{RefID: "A", JSON: []byte(`{"sql":"SELECT count(*) AS n FROM missing","format":"table"}`)}
+	d := NewArcDatasource()
+	for i := 0; i < 2; i++ {
+		resp := d.query(t.Context(), inst, q)
+		if resp.Error != nil {
+			t.Fatalf("a failed DESCRIBE must not fail the query: %v", resp.Error)
+		}
+		if cfg := resp.Frames[0].Fields[0].Config; cfg != nil && cfg.Description != "" {
+			t.Errorf("unexpected description %q", cfg.Description)
+		}
+	}
+	if n := describes.Load(); n != 1 {
+		t.Errorf("a failed DESCRIBE should be cached, got %d calls", n)
+	}
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// requestClass is the internal classification of traffic to Arc. It is
+// threaded through the execution path on the context (withRequestClass) so
+// the shared machinery — concurrency semaphore, metrics — can tell user
+// queries apart from the plugin's own housekeeping traffic.
+type requestClass string
+
+const (
+	// requestClassQuery is a dashboard/Explore/alerting query (the default).
+	requestClassQuery requestClass = "query"
+	// requestClassVariable is a template-variable query (metricFindQuery).
+	requestClassVariable requestClass = "variable"
+	// requestClassHealth is CheckHealth's probe.
+	requestClassHealth requestClass = "health"
+	// requestClassResource is a CallResource request (schema lookups etc.).
+	requestClassResource requestClass = "resource"
+	// requestClassPlan is an EXPLAIN captured for a slow query (see
+	// slowplan.go).
+	requestClassPlan requestClass = "plan"
+)
+
+// metricFindQueryRefID is the refId the frontend's metricFindQuery stamps on
+// template-variable queries (see src/datasource.ts).
+const metricFindQueryRefID = "metricFindQuery"
+
+type requestClassKey struct{}
+
+// withRequestClass returns ctx tagged with class c.
+func withRequestClass(ctx context.Context, c requestClass) context.Context {
+	return context.WithValue(ctx, requestClassKey{}, c)
+}
+
+// requestClassFrom returns the class ctx was tagged with, defaulting to
+// requestClassQuery so an untagged path is never accidentally exempted from
+// the limiter.
+func requestClassFrom(ctx context.Context) requestClass {
+	if c, ok := ctx.Value(requestClassKey{}).(requestClass); ok {
+		return c
+	}
+	return requestClassQuery
+}
+
+// classForQuery classifies a QueryData entry by its refId and query type.
+func classForQuery(q backend.DataQuery) requestClass {
+	if q.RefID == metricFindQueryRefID || q.QueryType == queryTypeVariable {
+		return requestClassVariable
+	}
+	return requestClassQuery
+}
+
+// bypassesLimiter reports whether requests of this class skip the shared
+// concurrency semaphore. Only the health probe does: it is a single tiny
+// SHOW DATABASES, and "Save & test" must answer even when a heavy dashboard
+// has every slot occupied — queueing it behind user queries made a healthy
+// but busy Arc look down.
+func (c requestClass) bypassesLimiter() bool {
+	return c == requestClassHealth
+}
+
+// usesResultCache reports whether requests of this class may read from and
+// write to the chunk cache. Only user queries do: a template-variable query
+// or the plugin's own traffic neither fills it nor is answered from it.
+func (c requestClass) usesResultCache() bool {
+	return c == requestClassQuery
+}
+
+// arcRequestsTotal counts HTTP requests sent to Arc, by class and outcome
+// ("ok" or "error"). Dashboards tracking query traffic should filter on
+// class="query" so health probes and resource calls don't skew them.
+var arcRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "arc_datasource",
+	Name:      "requests_total",
+	Help:      "HTTP requests sent to Arc, by request class and outcome.",
+}, []string{"class", "outcome"})
+
+// arcRequestDuration observes the time from dispatch until the response
+// body is closed (i.e. including the full stream decode), by class.
+var arcRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "arc_datasource",
+	Name:      "request_duration_seconds",
+	Help:      "Duration of HTTP requests to Arc including response decode, by request class.",
+	Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8), // 10ms .. ~164s
+}, []string{"class"})
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRequestClassFrom_DefaultsToQuery(t *testing.T) {
+	if c := requestClassFrom(context.Background()); c != requestClassQuery {
+		t.Errorf("untagged context should classify as query, got %q", c)
+	}
+	ctx := withRequestClass(context.Background(), requestClassHealth)
+	if c := requestClassFrom(ctx); c != requestClassHealth {
+		t.Errorf("expected health, got %q", c)
+	}
+}
+
+func TestClassForQuery(t *testing.T) {
+	if c := classForQuery(backend.DataQuery{RefID: "A"}); c != requestClassQuery {
+		t.Errorf("refId A: expected query, got %q", c)
+	}
+	if c := classForQuery(backend.DataQuery{RefID: metricFindQueryRefID}); c != requestClassVariable {
+		t.Errorf("metricFindQuery: expected variable, got %q", c)
+	}
+	if c := classForQuery(backend.DataQuery{RefID: "A", QueryType: queryTypeVariable}); c != requestClassVariable {
+		t.Errorf("queryType variable: expected variable, got %q", c)
+	}
+}
+
+// arrowOKServer serves a tiny valid Arrow stream for every request.
+func arrowOKServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	stream := bytes.Join(arrowStreamSegments(t, []float64{1}), nil)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(stream)
+	}))
+}
+
+// TestCheckHealth_BypassesSaturatedLimiter locks in that a dashboard holding
+// every concurrency slot can't make "Save & test" hang or fail.
+func TestCheckHealth_BypassesSaturatedLimiter(t *testing.T) {
+	srv := arrowOKServer(t)
+	defer srv.Close()
+
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"maxConcurrency": 1})
+	inst, err := d.getInstance(t.Context(), pctx)
+	if err != nil {
+		t.Fatalf("getInstance: %v", err)
+	}
+	if err := inst.sem.Acquire(t.Context(), 1); err != nil {
+		t.Fatalf("saturate: %v", err)
+	}
+	defer inst.sem.Release(1)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	res, err := d.CheckHealth(ctx, &backend.CheckHealthRequest{PluginContext: pctx})
+	if err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+	if res.Status != backend.HealthStatusOk {
+		t.Fatalf("expected healthy with saturated queue, got %v: %s", res.Status, res.Message)
+	}
+
+	// User queries still queue behind the limiter.
+	qctx, qcancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer qcancel()
+	if _, err := queryArrow(qctx, inst, "SELECT 1"); err == nil {
+		t.Fatal("expected user query to block on the saturated limiter")
+	}
+}
+
+// TestDoRequest_MetricsLabelledByClass checks health traffic lands under
+// class="health", leaving the query series untouched.
+func TestDoRequest_MetricsLabelledByClass(t *testing.T) {
+	srv := arrowOKServer(t)
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+
+	queryBefore := counterValue(t, requestClassQuery, "ok")
+	healthBefore := counterValue(t, requestClassHealth, "ok")
+
+	if _, err := queryArrow(withRequestClass(t.Context(), requestClassHealth), inst, "SHOW DATABASES"); err != nil {
+		t.Fatalf("queryArrow: %v", err)
+	}
+
+	if got := counterValue(t, requestClassHealth, "ok") - healthBefore; got != 1 {
+		t.Errorf("expected 1 health request recorded, got %v", got)
+	}
+	if got := counterValue(t, requestClassQuery, "ok") - queryBefore; got != 0 {
+		t.Errorf("health probe leaked into query metrics: %v", got)
+	}
+}
+
+func counterValue(t *testing.T, class requestClass, outcome string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := arcRequestsTotal.WithLabelValues(string(class), outcome).Write(&m); err != nil {
+		t.Fatalf("read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// No silent empties: a panel showing "No data" must mean Arc found no
+// rows. Whenever the plugin itself ends up with nothing to return — a
+// converter answered without a frame, a split query's chunks merged into
+// nothing, shaping dropped every frame — the query either fails or answers
+// with a frame carrying a warning notice that says why, never with an
+// empty response. A converter or fallback that keeps the data but changes
+// its shape (LongToWide failing, say) adds a notice too.
+
+// errNoFrame is a converter answering without a frame and without an
+// error. The message is user-facing.
+var errNoFrame = errors.New("Arc's answer could not be converted to a frame")
+
+// noDataFrame is a frame standing in for a result the plugin lost: named
+// and RefID'd like the query's frames, with the SQL that ran and a warning
+// notice giving reason.
+func noDataFrame(qm ArcQuery, sql, reason string) *data.Frame {
+	frame := data.NewFrame(qm.RefID)
+	frame.RefID = qm.RefID
+	frame.Meta = &data.FrameMeta{ExecutedQueryString: sql}
+	frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: "No data: " + reason})
+	return frame
+}
+
+// noDataResponse answers a query whose result the plugin lost with a
+// noDataFrame, logging reason.
+func noDataResponse(qm ArcQuery, sql, reason string) backend.DataResponse {
+	log.DefaultLogger.Warn("Query produced no frames", "refId", qm.RefID, "reason", reason)
+	return backend.DataResponse{Frames: data.Frames{noDataFrame(qm, sql, reason)}}
+}
+
+// noticeShapeFallback marks frame as left in its original layout because
+// converting it to the layout format names failed with err.
+func noticeShapeFallback(frame *data.Frame, layout string, err error) {
+	frame.AppendNotices(data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("The result could not be converted to %s format (%v); it is shown as Arc returned it.", layout, err),
+	})
+}
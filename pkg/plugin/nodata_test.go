@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// warningNotices returns the text of frame's warning notices.
+func warningNotices(frame *data.Frame) []string {
+	var texts []string
+	if frame.Meta == nil {
+		return nil
+	}
+	for _, n := range frame.Meta.Notices {
+		if n.Severity == data.NoticeSeverityWarning {
+			texts = append(texts, n.Text)
+		}
+	}
+	return texts
+}
+
+// TestQuery_NoSilentEmpties: every way the plugin can end up without frames
+// answers with an error or a frame that says why, never with nothing.
+func TestQuery_NoSilentEmpties(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results": []}`))
+	}))
+	defer srv.Close()
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"no result set", `{"sql":"SELECT * FROM t WHERE $__timeFilter(time)","splitDuration":"off"}`, ""},
+		{"no result set in a chunk", `{"sql":"SELECT * FROM t WHERE $__timeFilter(time)","splitDuration":"1d"}`, "result sets"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+				PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+				Queries: []backend.DataQuery{{
+					RefID:     "A",
+					TimeRange: backend.TimeRange{From: from, To: from.Add(3 * 24 * time.Hour)},
+					JSON:      []byte(c.query),
+				}},
+			})
+			if err != nil {
+				t.Fatalf("QueryData: %v", err)
+			}
+			resp := res.Responses["A"]
+			if c.wantErr != "" {
+				if resp.Error == nil || !strings.Contains(resp.Error.Error(), c.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", resp.Error, c.wantErr)
+				}
+				return
+			}
+			if resp.Error != nil {
+				t.Fatalf("error = %v, want a frame with a notice", resp.Error)
+			}
+			if len(resp.Frames) != 1 {
+				t.Fatalf("got %d frames, want 1", len(resp.Frames))
+			}
+			frame := resp.Frames[0]
+			if frame.RefID != "A" || frame.Meta.ExecutedQueryString == "" {
+				t.Errorf("frame refId %q, executed query %q", frame.RefID, frame.Meta.ExecutedQueryString)
+			}
+			if w := warningNotices(frame); len(w) != 1 || !strings.HasPrefix(w[0], "No data: ") {
+				t.Errorf("warnings = %q, want a No data notice", w)
+			}
+		})
+	}
+}
+
+func TestPrepareResultSets_LostResultSet(t *testing.T) {
+	qm := ArcQuery{RefID: "A", Format: "table"}
+	kept := data.NewFrame("", data.NewField("v", nil, []float64{1}))
+	frames := prepareResultSets(data.Frames{kept, nil}, qm, "SELECT 1; SELECT 2")
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want one per result set", len(frames))
+	}
+	if frames[0].Name != "A-1" || len(warningNotices(frames[0])) != 0 {
+		t.Errorf("first frame %q, warnings %q", frames[0].Name, warningNotices(frames[0]))
+	}
+	lost := frames[1]
+	if lost.Name != "A-2" || lost.RefID != "A" || lost.Meta.ExecutedQueryString != "SELECT 1; SELECT 2" {
+		t.Errorf("lost frame name %q, refId %q, executed %q", lost.Name, lost.RefID, lost.Meta.ExecutedQueryString)
+	}
+	if w := warningNotices(lost); len(w) != 1 || !strings.Contains(w[0], errNoFrame.Error()) {
+		t.Errorf("lost frame warnings = %q", w)
+	}
+}
+
+// TestShapeFrames_FallbackNotices: a conversion that fails keeps the data
+// in its original layout and says so.
+func TestShapeFrames_FallbackNotices(t *testing.T) {
+	// LongToWide refuses null times.
+	longWithNullTime := func() *data.Frame {
+		tm := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+		a, b := "a", "b"
+		f := data.NewFrame("A",
+			data.NewField("time", nil, []*time.Time{&tm, nil}),
+			data.NewField("host", nil, []*string{&a, &b}),
+			data.NewField("v", nil, []float64{1, 2}))
+		f.Meta = &data.FrameMeta{ExecutedQueryString: "SELECT 1"}
+		return f
+	}
+	cases := []struct {
+		name string
+		qm   ArcQuery
+		want string
+	}{
+		{"time series", ArcQuery{Format: "time_series"}, "converted to wide format"},
+		{"wide table", ArcQuery{Format: "table", TableLayout: tableLayoutWide}, "converted to wide format"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			frames := shapeFrames(longWithNullTime(), c.qm)
+			if len(frames) != 1 || frames[0].Rows() != 2 {
+				t.Fatalf("frames = %v, want the two rows kept", frames)
+			}
+			if w := warningNotices(frames[0]); len(w) != 1 || !strings.Contains(w[0], c.want) {
+				t.Errorf("warnings = %q, want one containing %q", w, c.want)
+			}
+			if frames[0].Meta.ExecutedQueryString != "SELECT 1" {
+				t.Errorf("meta lost: %+v", frames[0].Meta)
+			}
+		})
+	}
+}
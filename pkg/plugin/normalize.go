@@ -0,0 +1,230 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Unicode normalization (normalizeUnicode setting). SQL pasted from wikis,
+// chat and word processors carries characters that look right and aren't:
+// a byte order mark, non-breaking and zero-width spaces, curly quotes. Arc
+// rejects them with syntax errors at positions that make no sense to the
+// user. normalizeSQL cleans them up before anything else reads the query:
+//
+//   - "spaces" (the default): drop a leading BOM, replace non-breaking
+//     spaces with plain ones and drop zero-width characters — a zero-width
+//     space pasted inside a word would otherwise split it in two;
+//   - "quotes": also turn ‘curly’ single quotes into straight ones where
+//     they clearly delimit a literal;
+//   - "off": leave the SQL alone.
+//
+// String literals, quoted identifiers and comments are copied unchanged:
+// there a non-breaking space may be exactly what the user means.
+
+// normalizeUnicode setting values.
+const (
+	normalizeOff    = "off"
+	normalizeSpaces = "spaces"
+	normalizeQuotes = "quotes"
+)
+
+const byteOrderMark = '\uFEFF'
+
+// validateNormalizeUnicode checks the normalizeUnicode setting.
+func validateNormalizeUnicode(mode string) error {
+	switch mode {
+	case "", normalizeOff, normalizeSpaces, normalizeQuotes:
+		return nil
+	}
+	return fmt.Errorf("invalid normalizeUnicode %q (expected %q, %q or %q)", mode, normalizeSpaces, normalizeQuotes, normalizeOff)
+}
+
+// normalization counts what normalizeSQL changed.
+type normalization struct {
+	BOM       bool
+	Spaces    int // non-breaking spaces replaced
+	ZeroWidth int // zero-width characters dropped
+	Quotes    int // curly-quoted literals straightened
+}
+
+func (n normalization) changed() bool {
+	return n.BOM || n.Spaces > 0 || n.ZeroWidth > 0 || n.Quotes > 0
+}
+
+// String lists the changes, e.g. "removed a byte order mark, replaced 2
+// non-breaking spaces".
+func (n normalization) String() string {
+	var parts []string
+	if n.BOM {
+		parts = append(parts, "removed a byte order mark")
+	}
+	if n.Spaces > 0 {
+		parts = append(parts, fmt.Sprintf("replaced %d non-breaking spaces", n.Spaces))
+	}
+	if n.ZeroWidth > 0 {
+		parts = append(parts, fmt.Sprintf("removed %d zero-width characters", n.ZeroWidth))
+	}
+	if n.Quotes > 0 {
+		parts = append(parts, fmt.Sprintf("straightened %d curly-quoted literals", n.Quotes))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isNonBreakingSpace reports whether r is a space character Arc doesn't
+// accept as whitespace.
+func isNonBreakingSpace(r rune) bool {
+	switch r {
+	case '\u00A0', '\u202F', '\u205F', '\u3000': // no-break, narrow no-break, math, ideographic
+		return true
+	}
+	return r >= '\u2000' && r <= '\u200A' // en quad … hair space
+}
+
+// isZeroWidth reports whether r is an invisible zero-width character.
+func isZeroWidth(r rune) bool {
+	switch r {
+	case '\u200B', '\u200C', '\u200D', '\u2060', byteOrderMark: // zero-width space, non-joiner, joiner, word joiner
+		return true
+	}
+	return false
+}
+
+// normalizeSQL applies the normalizeUnicode mode to sql (see above).
+func normalizeSQL(sql, mode string) (string, normalization) {
+	var n normalization
+	if mode == normalizeOff {
+		return sql, n
+	}
+	if strings.HasPrefix(sql, string(byteOrderMark)) {
+		sql = strings.TrimPrefix(sql, string(byteOrderMark))
+		n.BOM = true
+	}
+	var out strings.Builder
+	out.Grow(len(sql))
+	prev := rune(-1)
+	for i := 0; i < len(sql); {
+		r, size := utf8.DecodeRuneInString(sql[i:])
+		switch {
+		case r == '\'' || r == '"':
+			end := quotedEnd(sql, i, byte(r))
+			out.WriteString(sql[i:end])
+			i = end
+			prev = r
+			continue
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			out.WriteString(sql[i : i+end])
+			i += end
+			continue
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := blockCommentEnd(sql, i)
+			out.WriteString(sql[i:end])
+			i = end
+			continue
+		case isNonBreakingSpace(r):
+			out.WriteByte(' ')
+			n.Spaces++
+			r = ' '
+		case isZeroWidth(r):
+			n.ZeroWidth++
+			i += size
+			continue
+		case r == '‘' && mode == normalizeQuotes && !isWordRune(prev):
+			if end, ok := curlyLiteralEnd(sql, i+size); ok {
+				out.WriteByte('\'')
+				out.WriteString(sql[i+size : end])
+				out.WriteByte('\'')
+				n.Quotes++
+				i = end + len("’")
+				prev = '\''
+				continue
+			}
+			out.WriteRune(r)
+		default:
+			out.WriteRune(r)
+		}
+		prev = r
+		i += size
+	}
+	return out.String(), n
+}
+
+// quotedEnd returns the index just past the literal or quoted identifier
+// opened by the quote at sql[start], doubled quotes included, or len(sql)
+// when it is unterminated.
+func quotedEnd(sql string, start int, quote byte) int {
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(sql)
+}
+
+// blockCommentEnd returns the index just past the (possibly nested) block
+// comment opening at sql[start], or len(sql) when it is unterminated.
+func blockCommentEnd(sql string, start int) int {
+	depth := 0
+	for i := start; i < len(sql)-1; i++ {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			depth++
+			i++
+		case sql[i] == '*' && sql[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// curlyLiteralEnd finds the ’ closing a ‘ literal whose content starts at
+// sql[start]: on the same line, with no straight or opening quote in
+// between, and not followed by a letter or digit (which makes it an
+// apostrophe). It returns the closing quote's index.
+func curlyLiteralEnd(sql string, start int) (int, bool) {
+	for i := start; i < len(sql); {
+		r, size := utf8.DecodeRuneInString(sql[i:])
+		switch r {
+		case '\n', '\'', '‘':
+			return 0, false
+		case '’':
+			next, _ := utf8.DecodeRuneInString(sql[i+size:])
+			if i+size == len(sql) || !isWordRune(next) {
+				return i, true
+			}
+		}
+		i += size
+	}
+	return 0, false
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// attachNormalizationNotice tells the panel the query it ran isn't
+// byte-for-byte the one it sent.
+func attachNormalizationNotice(frames data.Frames, n normalization) {
+	for _, frame := range frames {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     "Normalized pasted characters in the query: " + n.String() + ".",
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	cases := []struct {
+		name, mode, in, want string
+		changed              bool
+	}{
+		{"BOM", "", "\uFEFFSELECT 1", "SELECT 1", true},
+		{"non-breaking spaces", "", "SELECT\u00A0* FROM cpu", "SELECT * FROM cpu", true},
+		{"zero-width inside a word", "", "SELECT * FROM c\u200Bpu", "SELECT * FROM cpu", true},
+		{"literal untouched", "", "SELECT 'a\u00A0b' AS x", "SELECT 'a\u00A0b' AS x", false},
+		{"quoted identifier untouched", "", "SELECT \"a\u00A0b\" FROM t", "SELECT \"a\u00A0b\" FROM t", false},
+		{"comment untouched", "", "SELECT 1 -- it\u00A0's\nFROM t", "SELECT 1 -- it\u00A0's\nFROM t", false},
+		{"quotes off by default", "", "WHERE host = ‘a’", "WHERE host = ‘a’", false},
+		{"curly literal", normalizeQuotes, "WHERE host = ‘web-1’ AND x IN (‘a’,‘b’)", "WHERE host = 'web-1' AND x IN ('a','b')", true},
+		{"apostrophe is not a literal", normalizeQuotes, "WHERE note = ‘don’t’", "WHERE note = 'don’t'", true},
+		{"unclosed curly quote", normalizeQuotes, "WHERE host = ‘web\nAND 1", "WHERE host = ‘web\nAND 1", false},
+		{"off", normalizeOff, "\uFEFFSELECT\u00A01", "\uFEFFSELECT\u00A01", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, n := normalizeSQL(c.in, c.mode)
+			if got != c.want {
+				t.Errorf("normalizeSQL(%q) = %q, want %q", c.in, got, c.want)
+			}
+			if n.changed() != c.changed {
+				t.Errorf("changed = %v, want %v (%s)", n.changed(), c.changed, n)
+			}
+		})
+	}
+}
+
+// TestQuery_NormalizesPastedSQL checks Arc receives the cleaned-up SQL and
+// the panel is told about it.
+func TestQuery_NormalizesPastedSQL(t *testing.T) {
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sent = body.SQL
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"n"}, "data": []interface{}{[]interface{}{1}}})
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	q, _ := json.Marshal(map[string]string{"sql": "\uFEFFSELECT\u00A0count(*) AS n FROM cpu", "format": "table"})
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+		JSON:      q,
+	})
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	if sent != "SELECT count(*) AS n FROM cpu" {
+		t.Errorf("Arc received %q", sent)
+	}
+	notices := resp.Frames[0].Meta.Notices
+	if len(notices) != 1 || !strings.Contains(notices[0].Text, "removed a byte order mark, replaced 1 non-breaking spaces") {
+		t.Errorf("expected a normalization notice, got %+v", notices)
+	}
+}
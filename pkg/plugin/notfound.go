@@ -0,0 +1,247 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Not-found errors. Arc answers a query against a missing database and one
+// against a missing table with similar 4xx errors, and users end up editing
+// the query when the datasource is wrong or the other way around. Arc's
+// error payload names the case — an error code when the server sends one,
+// otherwise DuckDB's catalog message — so explainNotFound turns it into an
+// error saying which one it is: for a database, with the databases the
+// server does have (SHOW DATABASES, cached). Both are the user's to fix, so
+// the query answers 400 rather than 500 (queryErrorResponse).
+
+// errNotFound is wrapped by notFoundError. The message only names the
+// database or table the query itself used and the server's database list,
+// so it is shown to the user verbatim.
+var errNotFound = errors.New("not found")
+
+// Not-found kinds.
+const (
+	notFoundDatabase = "database"
+	notFoundTable    = "table"
+)
+
+// notFoundError is an Arc error recognized as a missing database or table.
+type notFoundError struct {
+	Kind      string
+	Name      string   // the missing database or table, when Arc said
+	Database  string   // the database queried
+	Available []string // databases on the server (Kind database only)
+	err       error
+}
+
+// maxListedDatabases caps how many databases a not-found message lists.
+const maxListedDatabases = 20
+
+func (e *notFoundError) Error() string {
+	if e.Kind == notFoundTable {
+		if e.Name == "" {
+			return fmt.Sprintf("table not found in database '%s'", e.Database)
+		}
+		return fmt.Sprintf("table '%s' not found in database '%s'", e.Name, e.Database)
+	}
+	msg := fmt.Sprintf("database '%s' does not exist on this Arc server", e.Name)
+	switch n := len(e.Available); {
+	case n == 0:
+		return msg + " — check the datasource's Database setting"
+	case n > maxListedDatabases:
+		return fmt.Sprintf("%s — available: %s, … (%d more)", msg, strings.Join(e.Available[:maxListedDatabases], ", "), n-maxListedDatabases)
+	default:
+		return msg + " — available: " + strings.Join(e.Available, ", ")
+	}
+}
+
+func (e *notFoundError) Unwrap() []error { return []error{errNotFound, e.err} }
+
+var (
+	// databaseNotFoundRe and tableNotFoundRe find the missing object in
+	// Arc's and DuckDB's wording: "database 'metrics' not found",
+	// `Catalog Error: Table with name cpu does not exist!`.
+	databaseNotFoundRe = regexp.MustCompile(`(?i)\b(?:database|catalog)(?: with name)?\s+["'\x60]?([\w.-]+)["'\x60]?\s+(?:does not exist|not found)`)
+	tableNotFoundRe    = regexp.MustCompile(`(?i)\btable(?: with name)?\s+["'\x60]?([\w.-]+)["'\x60]?\s+(?:does not exist|not found)`)
+)
+
+// classifyArcError reads Arc's error payload for a missing database or
+// table. It returns the kind ("" when neither) and the name when the
+// payload gives one.
+func classifyArcError(body []byte) (kind, name string) {
+	var payload struct {
+		Error     string `json:"error"`
+		Message   string `json:"message"`
+		Code      string `json:"code"`
+		ErrorCode string `json:"error_code"`
+		ErrorType string `json:"error_type"`
+		Database  string `json:"database"`
+		Table     string `json:"table"`
+	}
+	msg := string(body)
+	if json.Unmarshal(body, &payload) == nil {
+		msg = payload.Error + " " + payload.Message
+		code := strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(payload.Code + " " + payload.ErrorCode + " " + payload.ErrorType))
+		switch {
+		case strings.Contains(code, "DATABASE_NOT_FOUND"), strings.Contains(code, "UNKNOWN_DATABASE"):
+			return notFoundDatabase, firstNonEmpty(payload.Database, submatch(databaseNotFoundRe, msg))
+		case strings.Contains(code, "TABLE_NOT_FOUND"), strings.Contains(code, "UNKNOWN_TABLE"):
+			return notFoundTable, firstNonEmpty(payload.Table, submatch(tableNotFoundRe, msg))
+		}
+	}
+	if name := submatch(databaseNotFoundRe, msg); name != "" {
+		return notFoundDatabase, name
+	}
+	if name := submatch(tableNotFoundRe, msg); name != "" {
+		return notFoundTable, name
+	}
+	return "", ""
+}
+
+func submatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// explainNotFound replaces an Arc error about a missing database or table
+// with a notFoundError; other errors are returned unchanged.
+func (s *ArcInstanceSettings) explainNotFound(ctx context.Context, err error) error {
+	var (
+		statusErr *arcStatusError
+		respErr   *arcclient.ResponseError
+		body      []byte
+	)
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+		body = statusErr.Body
+	case errors.As(err, &respErr):
+		body = respErr.Body
+		if body == nil {
+			body = []byte(respErr.Message)
+		}
+	default:
+		return err
+	}
+	kind, name := classifyArcError(body)
+	nf := &notFoundError{Kind: kind, Name: name, Database: s.settings.Database, err: err}
+	switch kind {
+	case notFoundTable:
+		return nf
+	case notFoundDatabase:
+		if nf.Name == "" {
+			nf.Name = s.settings.Database
+		}
+		nf.Available = s.databases(ctx)
+		return nf
+	}
+	return err
+}
+
+// queryErrorResponse is errorResponse for a failed Arc round trip. A
+// missing database or table, or an error Arc reported about the SQL (see
+// arcclient.ResponseError.SQLError), is the user's to fix: 400,
+// downstream. Anything else is a 500.
+func queryErrorResponse(err error, qm ArcQuery, sql string) backend.DataResponse {
+	var respErr *arcclient.ResponseError
+	if errors.Is(err, errNotFound) || errors.As(err, &respErr) && respErr.SQLError() {
+		resp := errorResponse(backend.StatusBadRequest, sanitizeUserError(qm.RefID, err), qm, sql)
+		resp.ErrorSource = backend.ErrorSourceDownstream
+		return resp
+	}
+	return errorResponse(backend.StatusInternal, sanitizeUserError(qm.RefID, err), qm, sql)
+}
+
+// databaseListTTL is how long a SHOW DATABASES answer is reused.
+const databaseListTTL = 5 * time.Minute
+
+// databaseListTimeout bounds the SHOW DATABASES behind a not-found error.
+const databaseListTimeout = 5 * time.Second
+
+// databaseList caches the server's databases for not-found messages. It
+// is filled by CheckHealth, which runs SHOW DATABASES anyway, or on demand.
+type databaseList struct {
+	mu      sync.Mutex
+	names   []string
+	fetched time.Time
+}
+
+// databases returns the server's databases, from the cache when fresh;
+// nil when they can't be listed.
+func (s *ArcInstanceSettings) databases(ctx context.Context) []string {
+	c := s.databaseList
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names != nil && time.Since(c.fetched) < databaseListTTL {
+		return c.names
+	}
+	ctx, cancel := context.WithTimeout(withRequestClass(ctx, requestClassHealth), databaseListTimeout)
+	defer cancel()
+	frames, err := s.queryProtocolFrames(ctx, "SHOW DATABASES")
+	if err != nil {
+		return nil
+	}
+	c.names, c.fetched = databaseNames(frames), time.Now()
+	return c.names
+}
+
+// remember caches the answer to a SHOW DATABASES run elsewhere.
+func (c *databaseList) remember(frames data.Frames) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.names, c.fetched = databaseNames(frames), time.Now()
+}
+
+// databaseNames reads the names out of a SHOW DATABASES result: the
+// column called name or database_name, else the first string column.
+func databaseNames(frames data.Frames) []string {
+	return namesColumn(frames, "name", "database_name")
+}
+
+// namesColumn reads the values of the first frame's string column called
+// one of names, else of its first string column.
+func namesColumn(frames data.Frames, names ...string) []string {
+	if len(frames) == 0 {
+		return []string{}
+	}
+	var field *data.Field
+	for _, f := range frames[0].Fields {
+		if f.Type().NonNullableType() != data.FieldTypeString {
+			continue
+		}
+		if field == nil || slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(f.Name, n) }) {
+			field = f
+		}
+	}
+	values := []string{}
+	if field == nil {
+		return values
+	}
+	for i := 0; i < field.Len(); i++ {
+		if v, ok := field.ConcreteAt(i); ok {
+			values = append(values, v.(string))
+		}
+	}
+	return values
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestClassifyArcError(t *testing.T) {
+	cases := []struct {
+		body, kind, name string
+	}{
+		{`{"error":"database not found","code":"DATABASE_NOT_FOUND","database":"metrics"}`, notFoundDatabase, "metrics"},
+		{`{"error":"database 'metrics' not found","code":"database-not-found"}`, notFoundDatabase, "metrics"},
+		{`{"error":"no such table","error_code":"TABLE_NOT_FOUND","table":"cpu"}`, notFoundTable, "cpu"},
+		{`{"error":"Catalog Error: Table with name cpu does not exist!"}`, notFoundTable, "cpu"},
+		{`{"error":"Catalog Error: Catalog with name metrics does not exist!"}`, notFoundDatabase, "metrics"},
+		{`{"error":"Parser Error: syntax error at or near \"FORM\""}`, "", ""},
+		{`table "cpu" not found`, notFoundTable, "cpu"},
+	}
+	for _, c := range cases {
+		kind, name := classifyArcError([]byte(c.body))
+		if kind != c.kind || name != c.name {
+			t.Errorf("classifyArcError(%s) = %q, %q; want %q, %q", c.body, kind, name, c.kind, c.name)
+		}
+	}
+}
+
+// notFoundServer answers SHOW DATABASES with two databases and every other
+// query with status and body, counting the SHOW DATABASES calls.
+func notFoundServer(t *testing.T, status int, body string, listed *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.SQL == "SHOW DATABASES" {
+			listed.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"name"}, "data": []interface{}{[]interface{}{"prod"}, []interface{}{"staging"}}})
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestQuery_NotFoundErrors(t *testing.T) {
+	to := time.Now()
+	for _, c := range []struct {
+		name, body, want string
+		status           int
+	}{
+		{"database", `{"error":"database metrics not found","code":"DATABASE_NOT_FOUND"}`, "database 'metrics' does not exist on this Arc server — available: prod, staging", http.StatusBadRequest},
+		{"table", `{"error":"Catalog Error: Table with name cpu does not exist!"}`, "table 'cpu' not found in database 'metrics'", http.StatusBadRequest},
+		{"other 4xx", `{"error":"syntax error"}`, "Arc error (HTTP 400) query failed", http.StatusBadRequest},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var listed atomic.Int32
+			srv := notFoundServer(t, c.status, c.body, &listed)
+			defer srv.Close()
+			inst := newTestInstance(t, srv.URL)
+			inst.settings.Database = "metrics"
+			useJSON := false
+			inst.settings.UseArrow = &useJSON
+
+			q := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: to.Add(-time.Hour), To: to}, JSON: []byte(`{"sql":"SELECT * FROM cpu","format":"table"}`)}
+			resp := NewArcDatasource().query(t.Context(), inst, q)
+			if resp.Error == nil || !strings.Contains(resp.Error.Error(), c.want) {
+				t.Fatalf("expected %q, got %v", c.want, resp.Error)
+			}
+			notFound := c.name != "other 4xx"
+			wantStatus := backend.StatusInternal
+			if notFound {
+				wantStatus = backend.StatusBadRequest
+			}
+			if resp.Status != wantStatus {
+				t.Errorf("status = %d, want %d", resp.Status, wantStatus)
+			}
+			if notFound != (resp.ErrorSource == backend.ErrorSourceDownstream) {
+				t.Errorf("error source = %q", resp.ErrorSource)
+			}
+
+			// The database list is cached.
+			_ = NewArcDatasource().query(t.Context(), inst, q)
+			if c.name == "database" && listed.Load() != 1 {
+				t.Errorf("SHOW DATABASES ran %d times, want 1", listed.Load())
+			}
+		})
+	}
+}
+
+func TestNotFoundError_CapsDatabaseList(t *testing.T) {
+	var available []string
+	for i := 0; i < maxListedDatabases+5; i++ {
+		available = append(available, "db")
+	}
+	err := error(&notFoundError{Kind: notFoundDatabase, Name: "x", Available: available, err: errors.New("HTTP 404")})
+	if !errors.Is(err, errNotFound) || !strings.HasSuffix(err.Error(), "… (5 more)") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
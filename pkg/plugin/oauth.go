@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// OAuth pass-through (oauthPassThru setting): Grafana forwards the signed-in
+// user's OAuth token with each request, and Arc gets it as Authorization
+// instead of the API key, so Arc authorizes every user as themselves. A
+// request Grafana forwarded no token with — an alert rule evaluation, a
+// user signed in without OAuth — falls back to the API key, and a query
+// that did says so in a warning notice. A query naming a credential still
+// runs with that credential's key.
+//
+// Answers the plugin caches (chunks, catalog, schemas) are kept per token
+// (cacheScope): what one user's token may see is never served to another.
+
+// oauthTokenKey carries the forwarded Authorization header.
+type oauthTokenKey struct{}
+
+// withOAuthToken returns ctx carrying the OAuth token Grafana forwarded in
+// headers, if any.
+func withOAuthToken(ctx context.Context, headers http.Header) context.Context {
+	token := headers.Get(backend.OAuthIdentityTokenHeaderName)
+	if token == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, oauthTokenKey{}, token)
+}
+
+// oauthTokenFrom returns the token withOAuthToken stored, or "".
+func oauthTokenFrom(ctx context.Context) string {
+	token, _ := ctx.Value(oauthTokenKey{}).(string)
+	return token
+}
+
+// passThruToken returns the token to send instead of the API key: ctx's
+// OAuth token when oauthPassThru is on and no credential was named.
+func (s *ArcInstanceSettings) passThruToken(ctx context.Context) string {
+	if !s.settings.OAuthPassThru || s.credential != "" {
+		return ""
+	}
+	return oauthTokenFrom(ctx)
+}
+
+// cacheScope names whose view of Arc a cached answer is: the query's
+// credential, the hashed pass-through token, or "" for the API key.
+func (s *ArcInstanceSettings) cacheScope(ctx context.Context) string {
+	if token := s.passThruToken(ctx); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "oauth:" + hex.EncodeToString(sum[:])
+	}
+	return s.credential
+}
+
+// scopedKey returns the cache key key under ctx's cacheScope.
+func (s *ArcInstanceSettings) scopedKey(ctx context.Context, key string) string {
+	if scope := s.cacheScope(ctx); scope != "" {
+		return key + "\x00" + scope
+	}
+	return key
+}
+
+// missingTokenNotice is the warning for a pass-through query that ran
+// without a token, or nil when it had one (or pass-through is off).
+func (s *ArcInstanceSettings) missingTokenNotice(ctx context.Context) *data.Notice {
+	if !s.settings.OAuthPassThru || s.credential != "" || oauthTokenFrom(ctx) != "" {
+		return nil
+	}
+	text := "OAuth pass-through is on, but Grafana forwarded no OAuth token for this request; it ran with the datasource's API key."
+	if s.apiKey == "" {
+		text = "OAuth pass-through is on, but Grafana forwarded no OAuth token for this request; it ran unauthenticated."
+	}
+	return &data.Notice{Severity: data.NoticeSeverityWarning, Text: text}
+}
@@ -0,0 +1,160 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// TestOAuthPassThru: with oauthPassThru the forwarded token replaces the
+// API key; without a token the key goes out and the panel is warned.
+func TestOAuthPassThru(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		last http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		last = r.Header.Clone()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name       string
+		extra      map[string]any
+		token      string
+		wantHeader string
+		wantValue  string
+		wantNotice bool
+	}{
+		{"token", map[string]any{"oauthPassThru": true}, "Bearer user-token", "Authorization", "Bearer user-token", false},
+		{"token over custom header", map[string]any{"oauthPassThru": true, "authHeaderName": "X-API-Key"}, "Bearer user-token", "Authorization", "Bearer user-token", false},
+		{"no token", map[string]any{"oauthPassThru": true}, "", "Authorization", "Bearer k", true},
+		{"off", nil, "Bearer user-token", "Authorization", "Bearer k", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			extra := map[string]any{"useArrow": false}
+			for k, v := range c.extra {
+				extra[k] = v
+			}
+			req := &backend.QueryDataRequest{
+				PluginContext: testPluginContext(t, srv.URL, extra),
+				Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"SELECT 1","format":"table"}`)}},
+			}
+			if c.token != "" {
+				req.SetHTTPHeader(backend.OAuthIdentityTokenHeaderName, c.token)
+			}
+			resp, err := NewArcDatasource().QueryData(t.Context(), req)
+			if err != nil || resp.Responses["A"].Error != nil {
+				t.Fatalf("QueryData: %v %v", err, resp.Responses["A"].Error)
+			}
+
+			mu.Lock()
+			h := last
+			mu.Unlock()
+			if got := h.Get(c.wantHeader); got != c.wantValue {
+				t.Errorf("%s = %q, want %q", c.wantHeader, got, c.wantValue)
+			}
+			if got := h.Get("X-Api-Key"); got != "" {
+				t.Errorf("API key sent alongside the token: X-Api-Key = %q", got)
+			}
+
+			var notices []string
+			for _, frame := range resp.Responses["A"].Frames {
+				if frame.Meta != nil {
+					for _, n := range frame.Meta.Notices {
+						notices = append(notices, n.Text)
+					}
+				}
+			}
+			gotNotice := strings.Contains(strings.Join(notices, "\n"), "no OAuth token")
+			if gotNotice != c.wantNotice {
+				t.Errorf("notices = %q, want a missing-token warning: %v", notices, c.wantNotice)
+			}
+		})
+	}
+}
+
+// TestCacheScope: under pass-through each token caches apart from the API
+// key and from every other token; a named credential keeps its own scope.
+func TestCacheScope(t *testing.T) {
+	s := &ArcInstanceSettings{settings: ArcDataSourceSettings{OAuthPassThru: true}}
+	alice := withOAuthToken(t.Context(), http.Header{"Authorization": {"Bearer alice"}})
+	bob := withOAuthToken(t.Context(), http.Header{"Authorization": {"Bearer bob"}})
+
+	if s.cacheScope(t.Context()) != "" {
+		t.Errorf("no token: scope = %q, want the API key's", s.cacheScope(t.Context()))
+	}
+	a, b := s.cacheScope(alice), s.cacheScope(bob)
+	if a == "" || b == "" || a == b {
+		t.Errorf("token scopes = %q, %q; want two distinct ones", a, b)
+	}
+	if strings.Contains(a, "alice") {
+		t.Errorf("scope holds the token: %q", a)
+	}
+
+	scoped := *s
+	scoped.credential = "admin"
+	if got := scoped.cacheScope(alice); got != "admin" {
+		t.Errorf("credential scope = %q, want admin", got)
+	}
+	s.settings.OAuthPassThru = false
+	if got := s.cacheScope(alice); got != "" {
+		t.Errorf("pass-through off: scope = %q, want the API key's", got)
+	}
+}
+
+// TestCheckHealth_OAuthPassThru: the check says what it validated and that
+// other users' tokens wait for query time.
+func TestCheckHealth_OAuthPassThru(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["name"],"data":[["default"]]}`))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name, token, wantAuth, wantCheckedWith string
+	}{
+		{"with token", "Bearer admin-token", "Bearer admin-token", "oauthToken"},
+		{"without token", "", "Bearer k", "apiKey"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req := &backend.CheckHealthRequest{PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "oauthPassThru": true})}
+			if c.token != "" {
+				req.SetHTTPHeader(backend.OAuthIdentityTokenHeaderName, c.token)
+			}
+			res, err := NewArcDatasource().CheckHealth(t.Context(), req)
+			if err != nil || res.Status != backend.HealthStatusOk {
+				t.Fatalf("CheckHealth: %v %+v", err, res)
+			}
+			if auth != c.wantAuth {
+				t.Errorf("Authorization = %q, want %q", auth, c.wantAuth)
+			}
+			if !strings.Contains(res.Message, "validated at query time") {
+				t.Errorf("message = %q, want the query-time note", res.Message)
+			}
+			var details struct {
+				OAuthPassThru struct {
+					CheckedWith string `json:"checkedWith"`
+				} `json:"oauthPassThru"`
+			}
+			if err := json.Unmarshal(res.JSONDetails, &details); err != nil {
+				t.Fatal(err)
+			}
+			if details.OAuthPassThru.CheckedWith != c.wantCheckedWith {
+				t.Errorf("checkedWith = %q, want %q", details.OAuthPassThru.CheckedWith, c.wantCheckedWith)
+			}
+		})
+	}
+}
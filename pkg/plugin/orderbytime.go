@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ORDER BY time (orderByTime query option). Arc returns rows in storage
+// order unless asked otherwise, and a time series that arrives sorted skips
+// the re-sort in ensureAscendingTimes. orderByTimeSQL appends
+// `ORDER BY <time column> ASC` to a time-series query that has no ORDER BY
+// of its own:
+//
+//   - the time column is resolved from the query rather than assumed: the
+//     select-list item holding $__timeGroup, else the column given to
+//     $__timeFilter, else a selected column named time;
+//   - the clause goes before the query's own top-level LIMIT/OFFSET, and
+//     any LIMIT the plugin adds later (appendLimit) lands after it;
+//   - ORDER BY, LIMIT and the time macros inside subqueries, string literals
+//     and comments don't count, and the clause only ever goes at the top
+//     level, never inside parentheses.
+//
+// Table formats, meta statements (SHOW, DESCRIBE, ...), CTEs (WITH), UNIONs
+// and multi-statement queries are left alone, as is any query whose time
+// column can't be resolved. A CTE's output column can shadow or rename the
+// time column the macros name, so WITH queries aren't guessed at.
+
+var (
+	timeGroupItemRe = regexp.MustCompile(`\$__timeGroup(?:Alias)?\(`)
+	timeFilterArgRe = regexp.MustCompile(`\$__timeFilter\(\s*([^,)]+?)\s*\)`)
+	outerLimitRe    = regexp.MustCompile(`(?i)\b(?:LIMIT|OFFSET|FETCH)\b`)
+)
+
+// orderByTimeSQL adds ORDER BY <time column> ASC to sql (see above). The
+// error says why a query was left alone, for the debug log.
+func orderByTimeSQL(sql string, s strippedSQL) (string, error) {
+	switch head := strings.Fields(s.upper); {
+	case len(head) > 0 && head[0] == "WITH":
+		return "", errors.New("CTE")
+	case len(head) == 0 || (head[0] != "SELECT" && !strings.HasPrefix(head[0], "(")):
+		return "", errors.New("not a SELECT")
+	case containsMultipleStatements(s):
+		return "", errors.New("multiple statements")
+	case containsUnion(s):
+		return "", errors.New("UNION")
+	}
+
+	masked := maskLiteralsAndComments(sql)
+	outer := blankNested(masked)
+	if outerOrderByRe.MatchString(outer) {
+		return "", errors.New("query is already ordered")
+	}
+	timeCol, err := resolveTimeColumn(masked, outer)
+	if err != nil {
+		return "", err
+	}
+
+	body := strings.TrimRight(sql, " \t\r\n;")
+	clause := "ORDER BY " + timeCol + " ASC"
+	// The outer SELECT's own LIMIT: the first top-level LIMIT/OFFSET/FETCH
+	// after it (a CTE's is inside parentheses, blanked).
+	sel := outerSelectRe.FindStringIndex(outer)
+	if loc := outerLimitRe.FindStringIndex(outer[sel[1]:]); loc != nil {
+		at := sel[1] + loc[0]
+		return strings.TrimRight(body[:at], " \t\r\n") + "\n" + clause + "\n" + body[at:], nil
+	}
+	return body + "\n" + clause, nil
+}
+
+// resolveTimeColumn names the outer query's time column for ORDER BY (see
+// above). masked is the query with literals and comments blanked, outer its
+// blankNested view.
+func resolveTimeColumn(masked, outer string) (string, error) {
+	sel := outerSelectRe.FindStringIndex(outer)
+	if sel == nil {
+		return "", errors.New("no SELECT")
+	}
+	from := outerFromRe.FindStringIndex(outer[sel[1]:])
+	if from == nil {
+		return "", errors.New("no FROM")
+	}
+	listEnd := sel[1] + from[0]
+	items, itemsErr := selectItems(masked[sel[1]:listEnd], outer[sel[1]:listEnd])
+
+	for _, item := range items {
+		if timeGroupItemRe.MatchString(item.expr) {
+			if item.name == "" {
+				return "", errors.New("$__timeGroup has no output name")
+			}
+			return item.name, nil
+		}
+	}
+	grouped := groupByRe.MatchString(outer[listEnd:])
+	if m := timeFilterArgRe.FindStringSubmatch(masked[listEnd:]); m != nil {
+		col := m[1]
+		if bare := bareColumnRe.FindStringSubmatch(col); bare != nil {
+			col = bare[1]
+		}
+		for _, item := range items {
+			if strings.EqualFold(item.name, col) {
+				return item.name, nil
+			}
+		}
+		// SELECT * (no items) selects the filter column too — unless the
+		// query aggregates, when it may not be an output column at all.
+		if itemsErr != nil && !grouped {
+			return col, nil
+		}
+	}
+	for _, item := range items {
+		if strings.EqualFold(strings.Trim(item.name, `"`), "time") {
+			return item.name, nil
+		}
+	}
+	return "", errors.New("no time column could be resolved")
+}
+
+// maskLiteralsAndComments returns sql with the contents of single-quoted
+// literals and comments replaced by spaces: offsets into the result are
+// offsets into sql, which stripStringLiteralsAndComments doesn't keep.
+func maskLiteralsAndComments(sql string) string {
+	out := []byte(sql)
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+	for i := 0; i < len(sql); {
+		switch {
+		case sql[i] == '\'':
+			end := quotedEnd(sql, i, '\'')
+			blank(i+1, max(i+1, end-1))
+			i = end
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			blank(i, i+end)
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := blockCommentEnd(sql, i)
+			blank(i, end)
+			i = end
+		default:
+			i++
+		}
+	}
+	return string(out)
+}
+
+// OptimizeTimeSeriesQuery adds ORDER BY <time column> ASC to a time-series
+// query that has none (see orderByTimeSQL); queries it can't handle are
+// returned unchanged.
+func OptimizeTimeSeriesQuery(sql string) string {
+	ordered, err := orderByTimeSQL(sql, newStrippedSQL(sql))
+	if err != nil {
+		return sql
+	}
+	return ordered
+}
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestOrderByTimeSQL(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+		ok             bool
+	}{
+		{"timeGroup alias", "SELECT $__timeGroup(ts, '1m') AS bucket, avg(v) FROM cpu GROUP BY 1", "SELECT $__timeGroup(ts, '1m') AS bucket, avg(v) FROM cpu GROUP BY 1\nORDER BY bucket ASC", true},
+		{"timeFilter column", "SELECT ts, v FROM cpu WHERE $__timeFilter(ts)", "SELECT ts, v FROM cpu WHERE $__timeFilter(ts)\nORDER BY ts ASC", true},
+		{"select star", "SELECT * FROM cpu WHERE $__timeFilter(ts);", "SELECT * FROM cpu WHERE $__timeFilter(ts)\nORDER BY ts ASC", true},
+		{"column named time", "SELECT time, v FROM cpu", "SELECT time, v FROM cpu\nORDER BY time ASC", true},
+		{"before own LIMIT", "SELECT time, v FROM cpu LIMIT 10", "SELECT time, v FROM cpu\nORDER BY time ASC\nLIMIT 10", true},
+		{"lifetime is not time", "SELECT lifetime, runtime FROM jobs", "", false},
+		{"already ordered", "SELECT time, v FROM cpu ORDER BY v DESC", "", false},
+		{"ORDER BY in a comment", "SELECT time, v FROM cpu -- ORDER BY v", "SELECT time, v FROM cpu -- ORDER BY v\nORDER BY time ASC", true},
+		{"time in a literal", "SELECT value FROM cpu WHERE name = 'downtime'", "", false},
+		{"time in an escaped literal", "SELECT value FROM cpu WHERE note = 'it''s time'", "", false},
+		{"time in a line comment", "SELECT value FROM cpu -- time based", "", false},
+		{"time in a block comment", "SELECT value /* time */ FROM cpu", "", false},
+		{"timeFilter in a literal", "SELECT v FROM cpu WHERE msg = 'see $__timeFilter(ts)'", "", false},
+		{"LIMIT in an escaped literal", "SELECT time, v FROM cpu WHERE s = 'it''s -- LIMIT 5' /* LIMIT 6 */ LIMIT 3", "SELECT time, v FROM cpu WHERE s = 'it''s -- LIMIT 5' /* LIMIT 6 */\nORDER BY time ASC\nLIMIT 3", true},
+		{"aggregate over star", "SELECT * FROM cpu WHERE $__timeFilter(ts) GROUP BY host", "", false},
+		{"UNION", "SELECT time FROM a UNION ALL SELECT time FROM b", "", false},
+		{"UNION ALL in a subquery", "SELECT time, v FROM (SELECT time, v FROM a UNION ALL SELECT time, v FROM b) u", "", false},
+		{"CTE with its own LIMIT", "WITH x AS (SELECT time, v FROM cpu LIMIT 100) SELECT time, v FROM x", "", false},
+		{"lowercase CTE", "with x as (select time, v from cpu) select time, v from x limit 10", "", false},
+		{"subquery in FROM with its own LIMIT", "SELECT time, v FROM (SELECT time, v FROM cpu ORDER BY v LIMIT 100) s", "SELECT time, v FROM (SELECT time, v FROM cpu ORDER BY v LIMIT 100) s\nORDER BY time ASC", true},
+		{"subquery in FROM and outer LIMIT", "SELECT time, v FROM (SELECT time, v FROM cpu LIMIT 100) s LIMIT 10", "SELECT time, v FROM (SELECT time, v FROM cpu LIMIT 100) s\nORDER BY time ASC\nLIMIT 10", true},
+		{"subquery in WHERE", "SELECT time, v FROM cpu WHERE host IN (SELECT host FROM hosts ORDER BY host LIMIT 3)", "SELECT time, v FROM cpu WHERE host IN (SELECT host FROM hosts ORDER BY host LIMIT 3)\nORDER BY time ASC", true},
+		{"SHOW", "SHOW TABLES", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := orderByTimeSQL(c.in, newStrippedSQL(c.in))
+			if (err == nil) != c.ok {
+				t.Fatalf("orderByTimeSQL(%q) error = %v", c.in, err)
+			}
+			if c.ok && got != c.want {
+				t.Errorf("orderByTimeSQL(%q) =\n%q\nwant\n%q", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+// TestQuery_OrderByTime checks the SQL Arc receives with orderByTime on.
+func TestQuery_OrderByTime(t *testing.T) {
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sent = body.SQL
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"n"}, "data": []interface{}{[]interface{}{1}}})
+	}))
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+
+	for _, c := range []struct {
+		name, sql, format, want string
+		rowLimit                int64
+	}{
+		{"already ordered", "SELECT time, v FROM cpu ORDER BY time DESC", "time_series", "SELECT time, v FROM cpu ORDER BY time DESC", 0},
+		{"unordered with LIMIT", "SELECT time, v FROM cpu LIMIT 100", "time_series", "SELECT time, v FROM cpu\nORDER BY time ASC\nLIMIT 100", 0},
+		{"plugin LIMIT after ORDER BY", "SELECT time, v FROM cpu", "time_series", "SELECT time, v FROM cpu\nORDER BY time ASC\nLIMIT 50", 50},
+		{"CTE", "WITH w AS (SELECT time, v FROM cpu ORDER BY v LIMIT 5) SELECT time, v FROM w", "time_series", "WITH w AS (SELECT time, v FROM cpu ORDER BY v LIMIT 5) SELECT time, v FROM w", 0},
+		{"raw table query", "SELECT time, v FROM cpu", "table", "SELECT time, v FROM cpu", 0},
+		{"meta query", "SHOW TABLES", "time_series", "SHOW TABLES", 0},
+		{"custom time column", "SELECT ts, v FROM cpu WHERE ts > now() - INTERVAL 1 HOUR AND $__timeFilter(ts)", "time_series", "SELECT ts, v FROM cpu WHERE ts > now() - INTERVAL 1 HOUR AND ts >= '", 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			sent = ""
+			q, _ := json.Marshal(map[string]interface{}{"sql": c.sql, "format": c.format, "orderByTime": true, "rowLimit": c.rowLimit})
+			_ = NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+				JSON:      q,
+			})
+			if c.name == "custom time column" {
+				if !strings.HasPrefix(sent, c.want) || !strings.HasSuffix(sent, "\nORDER BY ts ASC") {
+					t.Errorf("Arc received %q", sent)
+				}
+				return
+			}
+			if sent != c.want {
+				t.Errorf("Arc received %q, want %q", sent, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Partial results (allowPartialResults query flag): a split query normally
+// fails as a whole when one chunk does. With the flag, a failing chunk — a
+// historical partition Arc can't read right now, say — leaves a gap: the
+// chunks that succeeded are merged as usual, the panel gets a warning
+// naming the failed time ranges, and the frame meta records failedChunks
+// and totalChunks. When every chunk fails the query fails with the first
+// chunk's error, as without the flag. Leaving chunks out is a modification
+// (modDroppedChunks), so strict mode fails the query instead.
+
+// maxListedChunks caps the failed ranges a partial result notice lists.
+const maxListedChunks = 5
+
+// partialResultNotice returns the indexes of the chunks that failed (errs,
+// by chunk) and the warning for a result without them. Each failure is
+// logged in full; the notice names the time ranges only.
+func partialResultNotice(refID string, chunks []backend.TimeRange, errs []error) ([]int, data.Notice) {
+	var (
+		failed []int
+		ranges []string
+	)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed = append(failed, i)
+		log.DefaultLogger.Warn("Split chunk failed, left out of a partial result", "refId", refID, "error", err)
+		if len(ranges) < maxListedChunks {
+			ranges = append(ranges, chunks[i].From.Format("2006-01-02 15:04")+" to "+chunks[i].To.Format("2006-01-02 15:04"))
+		}
+	}
+	if more := len(failed) - len(ranges); more > 0 {
+		ranges = append(ranges, fmt.Sprintf("%d more", more))
+	}
+	return failed, data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text: fmt.Sprintf("Partial result: %d of %d chunks failed and their time ranges are missing (%s). See the server log for the errors.",
+			len(failed), len(chunks), strings.Join(ranges, ", ")),
+	}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// TestSplitQuery_PartialResults: with allowPartialResults a failed chunk
+// leaves a gap and a notice instead of failing the query.
+func TestSplitQuery_PartialResults(t *testing.T) {
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	// failing lists the chunk start hours Arc can't answer.
+	var failing map[string]bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		for hour := range failing {
+			if strings.Contains(body.SQL, ">= '2026-03-08T"+hour) {
+				http.Error(w, "IO Error: partition unavailable", http.StatusInternalServerError)
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"columns":["time","v"],"data":[["2026-03-08T00:30:00Z",1]]}`))
+	}))
+	defer srv.Close()
+
+	run := func(t *testing.T, extra map[string]any, partial bool) backend.DataResponse {
+		t.Helper()
+		if extra == nil {
+			extra = map[string]any{}
+		}
+		extra["useArrow"] = false
+		extra["retryStatusCodes"] = []int{}
+		q := `{"sql":"SELECT time, v FROM t WHERE $__timeFilter(time)","format":"table","splitDuration":"1h"`
+		if partial {
+			q += `,"allowPartialResults":true`
+		}
+		resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: testPluginContext(t, srv.URL, extra),
+			Queries: []backend.DataQuery{{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from, To: from.Add(3 * time.Hour)},
+				JSON:      []byte(q + "}"),
+			}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		return resp.Responses["A"]
+	}
+
+	t.Run("one chunk fails", func(t *testing.T) {
+		failing = map[string]bool{"01": true}
+		r := run(t, nil, true)
+		if r.Error != nil {
+			t.Fatalf("query error: %v", r.Error)
+		}
+		frame := r.Frames[0]
+		if frame.Rows() != 2 {
+			t.Errorf("merged %d rows, want the 2 chunks that answered", frame.Rows())
+		}
+		custom := frame.Meta.Custom.(map[string]interface{})
+		if custom["failedChunks"] != 1 || custom["totalChunks"] != 3 {
+			t.Errorf("meta custom = %v", custom)
+		}
+		var notice string
+		for _, text := range noticeTexts(frame) {
+			if strings.HasPrefix(text, "Partial result") {
+				notice = text
+			}
+		}
+		if !strings.Contains(notice, "1 of 3 chunks") || !strings.Contains(notice, "2026-03-08 01:00 to 2026-03-08 02:00") {
+			t.Errorf("notice = %q", notice)
+		}
+	})
+
+	t.Run("flag off", func(t *testing.T) {
+		failing = map[string]bool{"01": true}
+		if r := run(t, nil, false); r.Error == nil {
+			t.Errorf("a failed chunk didn't fail the query: %d frames", len(r.Frames))
+		}
+	})
+
+	t.Run("all chunks fail", func(t *testing.T) {
+		failing = map[string]bool{"00": true, "01": true, "02": true}
+		normal := run(t, nil, false)
+		r := run(t, nil, true)
+		if r.Error == nil || normal.Error == nil || r.Error.Error() != normal.Error.Error() || r.Status != normal.Status {
+			t.Errorf("error = %v (%d), want the query's normal error %v (%d)", r.Error, r.Status, normal.Error, normal.Status)
+		}
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		failing = map[string]bool{"01": true}
+		if r := run(t, map[string]any{"strictMode": true}, true); r.Error == nil || !strings.Contains(r.Error.Error(), "drop split chunks") {
+			t.Errorf("error = %v, want strict mode's", r.Error)
+		}
+	})
+
+	t.Run("nothing fails", func(t *testing.T) {
+		failing = nil
+		r := run(t, nil, true)
+		if r.Error != nil {
+			t.Fatalf("query error: %v", r.Error)
+		}
+		if custom := r.Frames[0].Meta.Custom.(map[string]interface{}); custom["failedChunks"] != 0 || custom["totalChunks"] != 3 {
+			t.Errorf("meta custom = %v", custom)
+		}
+	})
+}
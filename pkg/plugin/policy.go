@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Strict mode (strictMode setting). On their way to Grafana, results can be
+// adjusted: values the converter can't parse become null, numeric epoch
+// timestamps get a unit guessed from their magnitude, integers past 2^53
+// are rounded into float64 or turned into text, interval months count as
+// 30 days, long text values are cut, rows and series are cut at a cap, duplicate rows collapse in the
+// long-to-wide conversion, and split chunks whose schema disagrees (or, with
+// allowPartialResults, that failed) are dropped.
+//
+// Every one of those code paths consults the instance's dataPolicy first.
+// Normally the modification goes ahead, with a notice where the panel
+// already showed one; in strict mode the query fails instead, naming the
+// modification that was about to happen. Decoders don't see the settings,
+// so they record what they did on the frame (arcclient.Adjustments),
+// queryArrow and queryJSON carry the record over (decoderModifications) and
+// queryFrames reviews it before anything else sees the frame.
+
+// Modification kinds, phrased as what the plugin would do.
+const (
+	modConversion      = "null values that could not be converted"
+	modEpochUnit       = "guess the unit of numeric timestamps"
+	modIntegerRounding = "round integers into float64"
+	modUint64AsText    = "show unsigned integers past 2^53 as text"
+	modIntervalMonths  = "count interval months as 30 days"
+	modCellTruncated   = "truncate long text values"
+	modTruncation      = "truncate the result"
+	modSeriesCap       = "drop or merge series"
+	modDuplicateRows   = "collapse duplicate rows"
+	modDroppedChunks   = "drop split chunks"
+)
+
+// errStrictMode is returned when strict mode refuses a modification. The
+// message names the modification and only quotes counts and column names.
+var errStrictMode = errors.New("strict mode")
+
+// modificationsMetaKey is the FrameMeta.Custom key holding the
+// []modification a decoder recorded on a frame.
+const modificationsMetaKey = "modifications"
+
+// modification is one change to a result. Pipeline stages fill in Detail;
+// decoders record Column and Count, and Detail is derived (String).
+type modification struct {
+	Kind   string `json:"kind"`
+	Column string `json:"column,omitempty"`
+	Count  int    `json:"count,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// decoderModificationDetails phrase the decoder-recorded kinds.
+var decoderModificationDetails = map[string]string{
+	modEpochUnit:       "column '%s': %d numeric values read as epoch timestamps, unit inferred from their magnitude",
+	modIntegerRounding: "column '%s': %d integers beyond ±2^53 lose precision as float64",
+	modUint64AsText:    "column '%s': %d unsigned integers beyond 2^53 can't be exact as numbers, so the column is shown as text",
+	modIntervalMonths:  "column '%s': %d intervals have a month part, converted to seconds at 30 days per month",
+	modCellTruncated:   "column '%s': %d text values longer than the datasource's maxCellBytes limit were truncated",
+}
+
+func (m modification) String() string {
+	if m.Detail != "" {
+		return m.Detail
+	}
+	return fmt.Sprintf(decoderModificationDetails[m.Kind], m.Column, m.Count)
+}
+
+// dataPolicy decides what happens to a modification; the zero value lets
+// everything through.
+type dataPolicy struct {
+	strict bool
+}
+
+// allow is called before m is made. In strict mode it returns the error
+// that fails the query. Otherwise it returns nil and, when frame is
+// non-nil, attaches m as a warning notice there — pass nil for
+// modifications that are silent outside strict mode.
+func (p dataPolicy) allow(frame *data.Frame, m modification) error {
+	if p.strict {
+		return fmt.Errorf("%w: the plugin would %s (%s). Disable \"Strict Mode\" in the datasource settings to allow it", errStrictMode, m.Kind, m)
+	}
+	if frame != nil {
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: m.String()})
+	}
+	return nil
+}
+
+// review applies the policy to the modifications decoders recorded on
+// frames.
+func (p dataPolicy) review(frames data.Frames) error {
+	for _, frame := range frames {
+		for _, m := range frameModifications(frame) {
+			if err := p.allow(nil, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// adjustmentKinds maps the decoders' adjustment kinds to modification kinds.
+var adjustmentKinds = map[string]string{
+	arcclient.AdjustEpochUnit:       modEpochUnit,
+	arcclient.AdjustIntegerRounding: modIntegerRounding,
+	arcclient.AdjustUint64AsText:    modUint64AsText,
+	arcclient.AdjustIntervalMonths:  modIntervalMonths,
+	arcclient.AdjustCellTruncated:   modCellTruncated,
+}
+
+// decoderModifications returns the adjustments a decoder recorded on frame
+// as modifications.
+func decoderModifications(frame *data.Frame) []modification {
+	var mods []modification
+	for _, a := range arcclient.Adjustments(frame) {
+		mods = append(mods, modification{Kind: adjustmentKinds[a.Kind], Column: a.Column, Count: a.Count})
+	}
+	return mods
+}
+
+// frameModifications returns the modifications recorded on frame.
+func frameModifications(frame *data.Frame) []modification {
+	if frame == nil || frame.Meta == nil {
+		return nil
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	mods, _ := custom[modificationsMetaKey].([]modification)
+	return mods
+}
+
+// countLongDuplicates returns how many rows of a long frame share their
+// time and label values with an earlier row: LongToWide keeps only the
+// last of them.
+func countLongDuplicates(frame *data.Frame, schema data.TimeSeriesSchema) int {
+	rows, err := frame.RowLen()
+	if err != nil {
+		return 0
+	}
+	seen := make(map[string]struct{}, rows)
+	dups := 0
+	for i := 0; i < rows; i++ {
+		key := cellKey(frame.Fields[schema.TimeIndex], i)
+		for _, idx := range schema.FactorIndices {
+			key += "\x00" + cellKey(frame.Fields[idx], i)
+		}
+		if _, ok := seen[key]; ok {
+			dups++
+			continue
+		}
+		seen[key] = struct{}{}
+	}
+	return dups
+}
+
+// cellKey renders a cell for countLongDuplicates, nulls distinct from any
+// value.
+func cellKey(f *data.Field, i int) string {
+	v, ok := f.ConcreteAt(i)
+	if !ok {
+		return "\x01"
+	}
+	return fmt.Sprint(v)
+}
+
+// reviewLongToWide applies the policy to the duplicate rows shapeFrames'
+// long-to-wide conversion would collapse. That collapse is silent outside
+// strict mode, so the counting pass only runs in it.
+func (p dataPolicy) reviewLongToWide(frame *data.Frame, qm ArcQuery) error {
+	if !p.strict || frame == nil || len(frame.Fields) == 0 {
+		return nil
+	}
+	switch qm.Format {
+	case "numeric_table":
+		return nil
+	case "table":
+		if qm.TableLayout != tableLayoutWide {
+			return nil
+		}
+	}
+	if layout, ok := columnRoleLayout(frame); ok && qm.Format != "table" {
+		// Only a pivot collapses rows, and its labels are the dimensions.
+		if !layout.pivot {
+			return nil
+		}
+		frame = layout.frame
+	}
+	schema := frame.TimeSeriesSchema()
+	if schema.Type != data.TimeSeriesTypeLong {
+		return nil
+	}
+	if n := countLongDuplicates(frame, schema); n > 0 {
+		return p.allow(nil, modification{Kind: modDuplicateRows,
+			Detail: fmt.Sprintf("%d rows repeat the time and labels of an earlier row; the long-to-wide conversion keeps only the last of them", n)})
+	}
+	return nil
+}
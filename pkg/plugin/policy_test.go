@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestDataPolicy_Allow(t *testing.T) {
+	m := modification{Kind: modTruncation, Detail: "Result truncated at 10 rows"}
+
+	frame := data.NewFrame("")
+	if err := (dataPolicy{}).allow(frame, m); err != nil {
+		t.Fatalf("default policy refused: %v", err)
+	}
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 || frame.Meta.Notices[0].Text != m.Detail {
+		t.Errorf("expected the modification as a notice, got %+v", frame.Meta)
+	}
+
+	err := dataPolicy{strict: true}.allow(frame, m)
+	if !errors.Is(err, errStrictMode) || !strings.Contains(err.Error(), "would truncate the result") {
+		t.Errorf("strict policy: got %v", err)
+	}
+	if msg := sanitizeUserError("A", err); !strings.Contains(msg, "Strict Mode") {
+		t.Errorf("strict mode error should reach the user verbatim, got %q", msg)
+	}
+}
+
+// strictInstance returns a test instance against url, in strict mode when
+// strict is set.
+func strictInstance(t *testing.T, url string, strict, useArrow bool) *ArcInstanceSettings {
+	t.Helper()
+	inst := newTestInstance(t, url)
+	inst.policy = dataPolicy{strict: strict}
+	inst.settings.UseArrow = &useArrow
+	return inst
+}
+
+// TestQueryFrames_StrictModeRefusesDecoderModifications checks the
+// modifications the decoders make on their own — rounding an int64 past
+// 2^53, guessing an epoch unit — are recorded on the frame and fail the
+// query in strict mode only.
+func TestQueryFrames_StrictModeRefusesDecoderModifications(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 1<<53 + 1}, nil)
+	})
+	arrowSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(stream)
+	}))
+	defer arrowSrv.Close()
+	jsonSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"columns": []string{"time", "value"},
+			"data":    []interface{}{[]interface{}{1771416000000, 1.5}},
+		})
+	}))
+	defer jsonSrv.Close()
+
+	for _, c := range []struct {
+		name     string
+		url      string
+		useArrow bool
+		want     string
+	}{
+		{"arrow int64 rounding", arrowSrv.URL, true, "round integers into float64"},
+		{"json epoch unit", jsonSrv.URL, false, "guess the unit of numeric timestamps"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			frames, err := strictInstance(t, c.url, false, c.useArrow).queryFrames(t.Context(), "SELECT 1")
+			if err != nil {
+				t.Fatalf("default policy: %v", err)
+			}
+			if mods := frameModifications(frames[0]); len(mods) != 1 || mods[0].Count != 1 {
+				t.Errorf("expected one recorded modification, got %+v", mods)
+			}
+
+			_, err = strictInstance(t, c.url, true, c.useArrow).queryFrames(t.Context(), "SELECT 1")
+			if !errors.Is(err, errStrictMode) || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("strict mode: got %v", err)
+			}
+		})
+	}
+}
+
+// TestQuery_StrictModeRefusesPipelineModifications checks truncation, the
+// series cap and the long-to-wide dedup fail a strict query, and that the
+// default policy still lets them through with their usual notices.
+func TestQuery_StrictModeRefusesPipelineModifications(t *testing.T) {
+	// Hosts a and b, with a's row repeated when the SQL asks for duplicates.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		rows := []interface{}{
+			[]interface{}{"2026-02-18T12:00:00Z", "a", 1.0},
+			[]interface{}{"2026-02-18T12:00:00Z", "b", 3.0},
+		}
+		if strings.Contains(body.SQL, "dups") {
+			rows = append(rows, []interface{}{"2026-02-18T12:00:00Z", "a", 2.0})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"time", "host", "value"}, "data": rows})
+	}))
+	defer srv.Close()
+
+	to := time.Date(2026, 2, 18, 13, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"row limit", `{"sql":"SELECT time, host, value FROM cpu","format":"table","rowLimit":2}`, "would truncate the result"},
+		{"series cap", `{"sql":"SELECT time, host, value FROM cpu","format":"time_series","maxSeries":1}`, "would drop or merge series"},
+		{"duplicate rows", `{"sql":"SELECT time, host, value FROM dups","format":"time_series"}`, "would collapse duplicate rows"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			q := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: to.Add(-time.Hour), To: to}, JSON: []byte(c.query)}
+
+			resp := NewArcDatasource().query(t.Context(), strictInstance(t, srv.URL, false, false), q)
+			if resp.Error != nil {
+				t.Fatalf("default policy: %v", resp.Error)
+			}
+
+			resp = NewArcDatasource().query(t.Context(), strictInstance(t, srv.URL, true, false), q)
+			if resp.Error == nil || !strings.Contains(resp.Error.Error(), c.want) {
+				t.Fatalf("strict mode: expected %q, got %v", c.want, resp.Error)
+			}
+			if len(resp.Frames) != 1 || resp.Frames[0].RefID != "A" {
+				t.Errorf("strict mode error should keep the RefID frame, got %+v", resp.Frames)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
+)
+
+// socksServer is a minimal SOCKS5 proxy (RFC 1928, username/password auth)
+// standing in for the PDC agent: it connects to the hosts in routes, which
+// nothing else can resolve, and records the usernames it was given.
+type socksServer struct {
+	ln     net.Listener
+	routes map[string]string // host → address dialed for it
+
+	mu    sync.Mutex
+	users []string
+}
+
+func newSocksServer(t *testing.T, routes map[string]string) *socksServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{ln: ln, routes: routes}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil
+		}
+		return b
+	}
+	// Greeting: pick username/password.
+	head := read(2)
+	if head == nil || read(int(head[1])) == nil {
+		return
+	}
+	_, _ = conn.Write([]byte{5, 2})
+	// Username/password.
+	ulen := read(2)
+	if ulen == nil {
+		return
+	}
+	user := read(int(ulen[1]))
+	plen := read(1)
+	if user == nil || plen == nil || read(int(plen[0])) == nil {
+		return
+	}
+	s.mu.Lock()
+	s.users = append(s.users, string(user))
+	s.mu.Unlock()
+	_, _ = conn.Write([]byte{1, 0})
+	// CONNECT request.
+	req := read(4)
+	if req == nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		if n := read(1); n != nil {
+			host = string(read(int(n[0])))
+		}
+	case 4:
+		host = net.IP(read(16)).String()
+	}
+	target, ok := s.routes[host]
+	if !ok || read(2) == nil { // the port: routes name the whole address
+		_, _ = conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0}) // host unreachable
+		return
+	}
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go func() { _, _ = io.Copy(upstream, conn) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+// TestSecureSocksProxy: a datasource with enableSecureSocksProxy reaches an
+// Arc only routable through the proxy (the PDC agent), authenticating as
+// the datasource; without it the host doesn't resolve.
+func TestSecureSocksProxy(t *testing.T) {
+	arc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["name"],"data":[["default"]]}`))
+	}))
+	defer arc.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(arc.URL, "http://"))
+	socks := newSocksServer(t, map[string]string{"arc.pdc.invalid": arc.Listener.Addr().String()})
+	arcURL := "http://arc.pdc.invalid:" + port
+
+	ctx := backend.WithGrafanaConfig(t.Context(), backend.NewGrafanaCfg(map[string]string{
+		proxy.PluginSecureSocksProxyEnabled:       "true",
+		proxy.PluginSecureSocksProxyProxyAddress:  socks.ln.Addr().String(),
+		proxy.PluginSecureSocksProxyAllowInsecure: "true",
+	}))
+
+	pctx := testPluginContext(t, arcURL, map[string]any{"useArrow": false, "enableSecureSocksProxy": true})
+	res, err := NewArcDatasource().CheckHealth(ctx, &backend.CheckHealthRequest{PluginContext: pctx})
+	if err != nil || res.Status != backend.HealthStatusOk {
+		t.Fatalf("CheckHealth through the proxy: %v %+v", err, res)
+	}
+	socks.mu.Lock()
+	users := socks.users
+	socks.mu.Unlock()
+	if len(users) == 0 || users[0] != "arc-test" {
+		t.Errorf("proxy usernames = %q, want the datasource UID", users)
+	}
+
+	pctx = testPluginContext(t, arcURL, map[string]any{"useArrow": false, "retryStatusCodes": []int{}})
+	res, err = NewArcDatasource().CheckHealth(ctx, &backend.CheckHealthRequest{PluginContext: pctx})
+	if err != nil || res.Status != backend.HealthStatusError {
+		t.Errorf("CheckHealth without the proxy = %+v, %v; want a failure", res, err)
+	}
+}
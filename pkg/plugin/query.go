@@ -2,59 +2,23 @@ package plugin
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
 	"time"
-	"unicode/utf8"
 
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
-// parseArcError extracts a human-readable error from Arc's JSON error
-// response. Arc returns errors as `{"error": "message"}` or plain text. Body
-// is truncated to maxErrorBodyBytes, backing off to the previous rune boundary
-// so the result is always valid UTF-8 even if the body byte-cap fell inside a
-// multi-byte sequence (L8 fix).
-func parseArcError(statusCode int, body []byte) string {
-	var parsed struct {
-		Error string `json:"error"`
-	}
-	if json.Unmarshal(body, &parsed) == nil && parsed.Error != "" {
-		return fmt.Sprintf("Arc error (HTTP %d): %s", statusCode, truncateForLog(parsed.Error))
-	}
-	text := strings.TrimSpace(string(body))
-	text = truncateForLog(text)
-	if text == "" {
-		return fmt.Sprintf("Arc returned HTTP %d with no error message", statusCode)
-	}
-	return fmt.Sprintf("Arc error (HTTP %d): %s", statusCode, text)
-}
-
-const maxErrorBodyBytes = 500
-
-// truncateForLog caps s at maxErrorBodyBytes, backing off to the last
-// complete UTF-8 rune boundary so the returned string is always valid UTF-8.
-func truncateForLog(s string) string {
-	if len(s) <= maxErrorBodyBytes {
-		return s
-	}
-	cut := s[:maxErrorBodyBytes]
-	// Drop any trailing partial rune.
-	for len(cut) > 0 {
-		r, size := utf8.DecodeLastRuneInString(cut)
-		if r != utf8.RuneError || size > 1 {
-			break
-		}
-		cut = cut[:len(cut)-1]
-	}
-	return cut + "..."
-}
+// arcStatusError is a non-200 answer from Arc. StatusCode lets callers
+// branch on the status via errors.As (e.g. the Arrow endpoint probe telling
+// "endpoint missing" from "Arc is down"); Body feeds classifyArcError.
+type arcStatusError = arcclient.StatusError
 
 // formatRequestError converts Go HTTP client errors into user-friendly
 // messages while preserving the original error chain for programmatic
@@ -100,689 +64,151 @@ func formatRequestError(err error) error {
 }
 
 // queryJSON executes a query using Arc's JSON endpoint (fallback path used
-// when the user has disabled Arrow). Returns a decoded Grafana DataFrame.
-func queryJSON(ctx context.Context, settings *ArcInstanceSettings, sql string) (*data.Frame, error) {
+// when the user has disabled Arrow). Returns one decoded Grafana DataFrame
+// per result set — a single frame unless Arc answered with the multi-result
+// shape (see arcclient.JSONResultSets).
+func queryJSON(ctx context.Context, settings *ArcInstanceSettings, sql string) (data.Frames, error) {
 	start := time.Now()
-	body, err := settings.doRequest(ctx, "/api/v1/query", map[string]any{"sql": sql})
+	ctx, warnings := withWarningSink(ctx)
+	ctx, retries := withRetryCounter(ctx)
+	body, err := settings.doRequest(ctx, arcclient.QueryPath, jsonMediaType, map[string]any{"sql": sql})
 	if err != nil {
 		return nil, err
 	}
 	defer body.Close()
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode Arc JSON response: %w", err)
-	}
-
-	duration := time.Since(start)
-	log.DefaultLogger.Debug("JSON query completed", "duration_ms", duration.Milliseconds())
-
-	frame, err := JSONToDataFrame(result)
+	body, capture := settings.captures.track(body)
+	frames, err := decodeJSONFrames(settings, body, sql, start, settings.jsonOptions())
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert response to DataFrame: %w", err)
+		settings.captures.save(ctx, capture, "json", settings.settings.Database, sql, err)
+		return nil, err
 	}
-
-	frame.Meta = &data.FrameMeta{
-		ExecutedQueryString: sql,
-		Custom: map[string]interface{}{
-			"executionTime": duration.Milliseconds(),
-		},
+	for _, frame := range frames {
+		attachArcWarnings(frame, warnings.arcWarnings(), 0)
+		recordRetries(frame, retries.Load())
 	}
-
-	return frame, nil
+	return frames, nil
 }
 
-// JSONToDataFrame converts Arc JSON response to Grafana DataFrame
-func JSONToDataFrame(result map[string]interface{}) (*data.Frame, error) {
-	// Extract column names from Arc response
-	// Arc returns: {"columns": ["col1", "col2", ...], "data": [[row1], [row2], ...], "rows": N}
-	columnsInterface, ok := result["columns"]
-	if !ok {
-		return nil, fmt.Errorf("missing 'columns' field in response")
-	}
-
-	columnsSlice, ok := columnsInterface.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid columns format")
-	}
-
-	columnNames := make([]string, len(columnsSlice))
-	for i, col := range columnsSlice {
-		name, ok := col.(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid column name at index %d: expected string, got %T", i, col)
-		}
-		columnNames[i] = name
-	}
-
-	// Extract data from Arc response
-	dataInterface, ok := result["data"]
-	if !ok {
-		return nil, fmt.Errorf("missing 'data' field in response")
+// decodeJSONFrames decodes a JSON response body into frames for queryJSON.
+func decodeJSONFrames(settings *ArcInstanceSettings, body io.Reader, sql string, start time.Time, opts arcclient.JSONOptions) (data.Frames, error) {
+	// Rows are decoded as they stream in, straight into columns (see
+	// arcclient.ReadJSONResultSets).
+	results, err := arcclient.ReadJSONResultSets(body)
+	var respErr *arcclient.ResponseError
+	if errors.As(err, &respErr) {
+		return nil, err // Arc's own error, see queryErrorResponse
 	}
-
-	// Convert to slices
-	dataRows, ok := dataInterface.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid data format")
-	}
-
-	if len(dataRows) == 0 {
-		return data.NewFrame(""), nil
-	}
-
-	// Get number of columns from first row
-	firstRow, ok := dataRows[0].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid row format")
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Arc JSON response: %w", err)
 	}
 
-	numCols := len(firstRow)
-	numRows := len(dataRows)
-
-	log.DefaultLogger.Debug("Parsing JSON response",
-		"numColumns", numCols,
-		"numRows", numRows,
-		"columns", columnNames,
-	)
-
-	// Create fields for each column
-
-	fields := make([]*data.Field, numCols)
-
-	for colIdx := 0; colIdx < numCols; colIdx++ {
-		colName := columnNames[colIdx]
-
-		// Infer type from first non-null value
-		var fieldType data.FieldType
-		var sample interface{}
+	duration := time.Since(start)
+	log.DefaultLogger.Debug("JSON query completed", "duration_ms", duration.Milliseconds())
 
-		for rowIdx := 0; rowIdx < numRows; rowIdx++ {
-			row, ok := dataRows[rowIdx].([]interface{})
-			if !ok {
-				return nil, fmt.Errorf("invalid row at index %d: expected array, got %T", rowIdx, dataRows[rowIdx])
-			}
-			if colIdx >= len(row) {
-				return nil, fmt.Errorf("row %d has %d columns, expected at least %d", rowIdx, len(row), colIdx+1)
-			}
-			if row[colIdx] != nil {
-				sample = row[colIdx]
-				break
+	frames := make(data.Frames, 0, len(results))
+	for i, r := range results {
+		frame, failures, err := r.Frame(opts)
+		results[i] = nil // its cells are in the frame now
+		if err != nil {
+			if len(results) > 1 {
+				err = fmt.Errorf("result %d: %w", i+1, err)
 			}
+			return nil, fmt.Errorf("failed to convert response to DataFrame: %w", err)
 		}
-
-		// Determine field type
-		switch v := sample.(type) {
-		case float64:
-			fieldType = data.FieldTypeNullableFloat64
-		case string:
-			// Check if it's a timestamp (try multiple formats)
-			// Arc sends: "2025-10-28T16:03:25.431000"
-			if colName == "time" || colName == "timestamp" || colName == "_time" {
-				fieldType = data.FieldTypeNullableTime
-			} else if _, err := time.Parse(time.RFC3339, v); err == nil {
-				fieldType = data.FieldTypeNullableTime
-			} else if _, err := time.Parse("2006-01-02T15:04:05.000000", v); err == nil {
-				fieldType = data.FieldTypeNullableTime
-			} else {
-				fieldType = data.FieldTypeNullableString
-			}
-		case bool:
-			fieldType = data.FieldTypeNullableBool
-		default:
-			fieldType = data.FieldTypeNullableString
+		if len(failures) > 0 && settings.settings.FailOnConversionErrors {
+			return nil, fmt.Errorf("%w: %s", errDataConversion, failures[0])
 		}
-
-		// Create field based on type
-		switch fieldType {
-		case data.FieldTypeNullableFloat64:
-			values := make([]*float64, numRows)
-			var typeMismatches int
-			for rowIdx := 0; rowIdx < numRows; rowIdx++ {
-				row, ok := dataRows[rowIdx].([]interface{})
-				if !ok || colIdx >= len(row) || row[colIdx] == nil {
-					continue
-				}
-				v, ok := row[colIdx].(float64)
-				if !ok {
-					typeMismatches++
-					continue
-				}
-				val := v
-				values[rowIdx] = &val
+		if len(failures) > 0 {
+			if err := settings.policy.allow(nil, modification{Kind: modConversion, Detail: failures[0].String()}); err != nil {
+				return nil, err
 			}
-			if typeMismatches > 0 {
-				log.DefaultLogger.Warn("numeric column had non-float64 rows",
-					"col", colName, "mismatches", typeMismatches, "total", numRows)
-			}
-			fields[colIdx] = data.NewField(colName, nil, values)
-
-		case data.FieldTypeNullableTime:
-			// Detect the string format once on the first sample so we don't
-			// retry up to three time.Parse layouts per row on big result sets.
-			detectedLayout := ""
-			if sampleStr, ok := sample.(string); ok {
-				for _, layout := range timestampLayouts {
-					if _, err := time.Parse(layout, sampleStr); err == nil {
-						detectedLayout = layout
-						break
-					}
-				}
-			}
-			values := make([]*time.Time, numRows)
-			var parseFailures int
-			for rowIdx := 0; rowIdx < numRows; rowIdx++ {
-				row, ok := dataRows[rowIdx].([]interface{})
-				if !ok || colIdx >= len(row) || row[colIdx] == nil {
-					continue
-				}
-				t, ok := parseJSONTimestamp(row[colIdx], detectedLayout)
-				if !ok {
-					parseFailures++
-					continue
-				}
-				timeCopy := t
-				values[rowIdx] = &timeCopy
-			}
-			if parseFailures > 0 {
-				// Summary log (one line per column) instead of one-line-per-row
-				// spam. A 100k-row response with a corrupted column previously
-				// emitted 100k warn lines.
-				log.DefaultLogger.Warn("timestamp column had unparseable rows",
-					"col", colName, "failures", parseFailures, "total", numRows)
-			}
-			fields[colIdx] = data.NewField(colName, nil, values)
-
-		case data.FieldTypeNullableString:
-			values := make([]*string, numRows)
-			for rowIdx := 0; rowIdx < numRows; rowIdx++ {
-				row, ok := dataRows[rowIdx].([]interface{})
-				if !ok || colIdx >= len(row) || row[colIdx] == nil {
-					continue
-				}
-				// Type-assert before falling back to Sprintf — the inferred
-				// column type is string, so the common case avoids reflection.
-				if s, ok := row[colIdx].(string); ok {
-					strCopy := s
-					values[rowIdx] = &strCopy
-					continue
-				}
-				str := fmt.Sprintf("%v", row[colIdx])
-				values[rowIdx] = &str
-			}
-			fields[colIdx] = data.NewField(colName, nil, values)
-
-		case data.FieldTypeNullableBool:
-			values := make([]*bool, numRows)
-			var typeMismatches int
-			for rowIdx := 0; rowIdx < numRows; rowIdx++ {
-				row, ok := dataRows[rowIdx].([]interface{})
-				if !ok || colIdx >= len(row) || row[colIdx] == nil {
-					continue
-				}
-				v, ok := row[colIdx].(bool)
-				if !ok {
-					typeMismatches++
-					continue
-				}
-				val := v
-				values[rowIdx] = &val
-			}
-			if typeMismatches > 0 {
-				log.DefaultLogger.Warn("boolean column had non-bool rows",
-					"col", colName, "mismatches", typeMismatches, "total", numRows)
-			}
-			fields[colIdx] = data.NewField(colName, nil, values)
 		}
-	}
 
-	frame := data.NewFrame("", fields...)
-
-	// Identify which fields are labels (string fields that are not "time")
-	// This helps Grafana understand wide vs long format for time series
-	for _, field := range frame.Fields {
-		if field.Type() == data.FieldTypeNullableString && field.Name != "time" && field.Name != "timestamp" {
-			// Mark string fields (except time) as labels
-			if field.Labels == nil {
-				field.Labels = data.Labels{}
-			}
-		}
+		arcclient.EpochTimeFields(frame, settings.timeColumns)
+		mods := decoderModifications(frame)
+		frame.Meta = resultMeta(frame, sql, duration, mods)
+		attachConversionFailures(frame, failures)
+		noticeTruncatedCells(frame, mods)
+		settings.logResult(frame)
+		frames = append(frames, frame)
 	}
 
-	log.DefaultLogger.Debug("Created frame from JSON",
-		"fields", len(frame.Fields),
-		"rows", frame.Rows(),
-		"fieldNames", func() []string {
-			names := make([]string, len(frame.Fields))
-			for i, f := range frame.Fields {
-				names[i] = f.Name
-			}
-			return names
-		}(),
-	)
-
-	// Log first row for debugging
-	if frame.Rows() > 0 {
-		firstRow := make([]interface{}, len(frame.Fields))
-		for i, field := range frame.Fields {
-			firstRow[i] = field.At(0)
-		}
-		log.DefaultLogger.Debug("First row of data", "values", firstRow)
-	}
-
-	return frame, nil
-}
-
-// calculateInterval picks an appropriate aggregation interval for the given duration.
-func calculateInterval(duration time.Duration) string {
-	switch {
-	case duration > 7*24*time.Hour:
-		return "1 hour"
-	case duration > 24*time.Hour:
-		return "10 minutes"
-	case duration > 6*time.Hour:
-		return "1 minute"
-	default:
-		return "10 seconds"
-	}
+	return frames, nil
 }
 
-// replaceMacroOccurrences walks `sql` once and rewrites every occurrence of
-// `macro` that lives outside string literals and comments. For each in-scope
-// occurrence the inner argument (between the macro's opening paren and the
-// matching closing paren, respecting nested parens) is passed to `rewrite`.
-// If rewrite returns ok=false the original macro text is preserved verbatim.
-//
-// The single-pass approach (O(N) over `sql`, with `strings.Builder` output)
-// replaces the previous repeated slice-splice loop that was O(N·L) per
-// macro. The literal-and-comment awareness also fixes the C4 issue where
-// `WHERE message = 'count of $__timeFilter(time)'` would have its literal
-// content rewritten.
-func replaceMacroOccurrences(sql, macro string, rewrite func(arg string) (string, bool)) string {
-	var out strings.Builder
-	out.Grow(len(sql))
-	i := 0
-	for i < len(sql) {
-		// Skip over '...' string literals (preserve verbatim).
-		if sql[i] == '\'' {
-			out.WriteByte(sql[i])
-			i++
-			for i < len(sql) {
-				out.WriteByte(sql[i])
-				if sql[i] == '\'' {
-					// Escaped quote ''
-					if i+1 < len(sql) && sql[i+1] == '\'' {
-						out.WriteByte(sql[i+1])
-						i += 2
-						continue
-					}
-					i++
-					break
-				}
-				i++
-			}
-			continue
-		}
-		// Skip over -- line comments.
-		if sql[i] == '-' && i+1 < len(sql) && sql[i+1] == '-' {
-			end := strings.IndexByte(sql[i:], '\n')
-			if end < 0 {
-				out.WriteString(sql[i:])
-				return out.String()
-			}
-			out.WriteString(sql[i : i+end])
-			i += end
-			continue
-		}
-		// Skip over /* block comments */.
-		if sql[i] == '/' && i+1 < len(sql) && sql[i+1] == '*' {
-			end := strings.Index(sql[i+2:], "*/")
-			if end < 0 {
-				out.WriteString(sql[i:])
-				return out.String()
-			}
-			out.WriteString(sql[i : i+2+end+2])
-			i += 2 + end + 2
-			continue
-		}
-		// Macro at this position?
-		if i+len(macro) <= len(sql) && sql[i:i+len(macro)] == macro {
-			closeIdx := findMatchingParen(sql, i+len(macro)-1)
-			if closeIdx < 0 {
-				// Unmatched paren — leave the rest of the SQL untouched.
-				out.WriteString(sql[i:])
-				return out.String()
-			}
-			arg := sql[i+len(macro) : closeIdx]
-			if rewritten, ok := rewrite(arg); ok {
-				out.WriteString(rewritten)
-			} else {
-				// Caller declined the rewrite — preserve the original macro
-				// text so Arc surfaces a clear error rather than producing
-				// silently-mangled SQL.
-				out.WriteString(sql[i : closeIdx+1])
-			}
-			i = closeIdx + 1
-			continue
-		}
-		out.WriteByte(sql[i])
-		i++
+// resultMeta is the Meta of a frame decoded from Arc's answer to sql: the
+// query, how long Arc took, what the decoder modified (mods) and the
+// column roles Arc sent. It replaces the decoder's own Meta.
+func resultMeta(frame *data.Frame, sql string, took time.Duration, mods []modification) *data.FrameMeta {
+	custom := map[string]interface{}{
+		"executionTime": took.Milliseconds(),
 	}
-	return out.String()
-}
-
-// replaceLiteralAwareTokens replaces every occurrence of `token` (a fixed
-// string with no argument list, e.g. "$__interval" or "$__timeFrom()") with
-// `replacement` — skipping occurrences inside string literals and SQL
-// comments. This is the zero-arg sibling of `replaceMacroOccurrences` and
-// fixes R2-CR5: the previous `strings.ReplaceAll` rewrote macros inside
-// string literals (`WHERE msg = 'see $__timeFrom()'` mangled the literal).
-func replaceLiteralAwareTokens(sql, token, replacement string) string {
-	if !strings.Contains(sql, token) {
-		return sql
+	if len(mods) > 0 {
+		custom[modificationsMetaKey] = mods
 	}
-	var out strings.Builder
-	out.Grow(len(sql))
-	i := 0
-	for i < len(sql) {
-		// Skip '...' string literals (preserve verbatim, including any tokens inside).
-		if sql[i] == '\'' {
-			out.WriteByte(sql[i])
-			i++
-			for i < len(sql) {
-				out.WriteByte(sql[i])
-				if sql[i] == '\'' {
-					if i+1 < len(sql) && sql[i+1] == '\'' {
-						out.WriteByte(sql[i+1])
-						i += 2
-						continue
-					}
-					i++
-					break
-				}
-				i++
-			}
-			continue
-		}
-		// Skip -- line comments.
-		if sql[i] == '-' && i+1 < len(sql) && sql[i+1] == '-' {
-			end := strings.IndexByte(sql[i:], '\n')
-			if end < 0 {
-				out.WriteString(sql[i:])
-				return out.String()
-			}
-			out.WriteString(sql[i : i+end])
-			i += end
-			continue
-		}
-		// Skip /* block comments */.
-		if sql[i] == '/' && i+1 < len(sql) && sql[i+1] == '*' {
-			end := strings.Index(sql[i+2:], "*/")
-			if end < 0 {
-				out.WriteString(sql[i:])
-				return out.String()
-			}
-			out.WriteString(sql[i : i+2+end+2])
-			i += 2 + end + 2
-			continue
-		}
-		// Token match?
-		if i+len(token) <= len(sql) && sql[i:i+len(token)] == token {
-			out.WriteString(replacement)
-			i += len(token)
-			continue
-		}
-		out.WriteByte(sql[i])
-		i++
+	if roles := arcclient.ColumnRoles(frame); roles != nil {
+		custom[arcclient.ColumnRolesMetaKey] = roles
 	}
-	return out.String()
+	return &data.FrameMeta{ExecutedQueryString: sql, Custom: custom}
 }
 
-// findMatchingParen scans forward from `openIdx` (which must point at '(')
-// and returns the index of the matching ')', respecting nested parens and
-// string literals inside the arg. Returns -1 if no match is found.
-func findMatchingParen(sql string, openIdx int) int {
-	if openIdx >= len(sql) || sql[openIdx] != '(' {
-		return -1
-	}
-	depth := 1
-	i := openIdx + 1
-	for i < len(sql) {
-		c := sql[i]
-		switch c {
-		case '\'':
-			// Skip string literal.
-			i++
-			for i < len(sql) {
-				if sql[i] == '\'' {
-					if i+1 < len(sql) && sql[i+1] == '\'' {
-						i += 2
-						continue
-					}
-					i++
-					break
-				}
-				i++
-			}
-		case '(':
-			depth++
-			i++
-		case ')':
-			depth--
-			if depth == 0 {
-				return i
+// errDataConversion is returned when the converter had to null out values and
+// the datasource is configured to fail instead (FailOnConversionErrors). The
+// wrapped message names the column and the first bad value; it only contains
+// data the query itself returned, so it is safe to show to the user.
+var errDataConversion = errors.New("data conversion failed")
+
+// mergeConversionFailures sums the failures of several chunk frames per
+// (column, kind), keeping the earliest chunk's bad-value sample, so a split
+// query reports one notice per column rather than one per chunk.
+func mergeConversionFailures(frames []*data.Frame) []conversionFailure {
+	var merged []conversionFailure
+	index := map[string]int{}
+	for _, frame := range frames {
+		for _, f := range frameConversionFailures(frame) {
+			key := f.Column + "\x00" + f.Kind
+			if i, ok := index[key]; ok {
+				merged[i].Count += f.Count
+				continue
 			}
-			i++
-		default:
-			i++
+			index[key] = len(merged)
+			merged = append(merged, f)
 		}
 	}
-	return -1
+	return merged
 }
 
-// expandTimeFilter replaces $__timeFilter(column) with column >= 'from' AND column < 'to'.
-// Column arguments are validated against columnNameRe — anything else is left
-// un-expanded so Arc surfaces a clear error rather than the macro silently
-// injecting attacker-controlled SQL. Macros inside string literals or comments
-// are not expanded.
-func expandTimeFilter(sql string, from, to time.Time) string {
-	fromStr := from.Format(time.RFC3339)
-	toStr := to.Format(time.RFC3339)
-	return replaceMacroOccurrences(sql, "$__timeFilter(", func(arg string) (string, bool) {
-		column := strings.TrimSpace(arg)
-		if column == "" {
-			log.DefaultLogger.Warn("$__timeFilter macro has empty column argument, defaulting to 'time'")
-			column = "time"
-		}
-		if err := validateColumnArg(column); err != nil {
-			log.DefaultLogger.Warn("$__timeFilter rejected unsafe column argument", "column", column, "error", err.Error())
-			return "", false
-		}
-		return fmt.Sprintf("%s >= '%s' AND %s < '%s'", column, fromStr, column, toStr), true
-	})
+// JSONToDataFrame converts Arc JSON response to Grafana DataFrame. Values that
+// can't be represented in their column's inferred type are nulled out and
+// reported as warning notices (see attachConversionFailures).
+func JSONToDataFrame(result map[string]interface{}) (*data.Frame, error) {
+	frame, failures, err := jsonToDataFrame(result)
+	if err != nil {
+		return nil, err
+	}
+	attachConversionFailures(frame, failures)
+	return frame, nil
 }
 
 // ApplyMacros replaces Grafana macros in SQL query
 func ApplyMacros(sql string, timeRange backend.TimeRange) string {
-	return applyMacrosWith(sql, timeRange.From, timeRange.To, timeRange.To.Sub(timeRange.From))
+	return applyMacrosWith(sql, timeRange, backend.DataQuery{TimeRange: timeRange}, time.Time{})
 }
 
 // ApplyMacrosWithSplit replaces macros using the chunk's time range for
 // `$__timeFilter`/`$__timeFrom`/`$__timeTo`, but the ORIGINAL range for
-// `$__interval` so bucket sizes stay consistent across chunks.
+// `$__interval` so bucket sizes stay consistent across chunks. The
+// previous-period macros get the chunk shifted back by the original range
+// length (see applyMacrosWith).
+//
+// The rule for the bare bounds: `$__timeFrom()`/`$__timeTo()` are the range
+// this execution filters on, so they follow the chunk wherever they appear —
+// WHERE, a JOIN condition, a CASE — exactly like `$__timeFilter`. A query
+// that needs the dashboard's full range (a label, a "% of range elapsed"
+// column) uses `$__rangeFrom()`/`$__rangeTo()`, which are never split.
+// Filtering on the range macros defeats splitting: every chunk would read
+// the whole range.
 func ApplyMacrosWithSplit(sql string, chunk backend.TimeRange, originalRange backend.TimeRange) string {
-	return applyMacrosWith(sql, chunk.From, chunk.To, originalRange.To.Sub(originalRange.From))
-}
-
-// applyMacrosWith routes EVERY macro through literal-and-comment-aware
-// walkers (R2-CR5): the previous implementation used `strings.ReplaceAll`
-// for `$__timeFrom()`, `$__timeTo()`, and `$__interval`, which rewrote macro
-// text inside string literals (`WHERE msg = 'see $__timeFrom()'` mangled the
-// literal). All five Grafana macros now share the same safety.
-func applyMacrosWith(sql string, filterFrom, filterTo time.Time, intervalDuration time.Duration) string {
-	sql = expandTimeFilter(sql, filterFrom, filterTo)
-	sql = replaceLiteralAwareTokens(sql, "$__timeFrom()", fmt.Sprintf("'%s'", filterFrom.Format(time.RFC3339)))
-	sql = replaceLiteralAwareTokens(sql, "$__timeTo()", fmt.Sprintf("'%s'", filterTo.Format(time.RFC3339)))
-	sql = replaceLiteralAwareTokens(sql, "$__interval", calculateInterval(intervalDuration))
-	// $__timeGroup(column, interval) -> epoch-based bucketing
-	// DuckDB's date_trunc/time_bucket retains nanosecond residuals on TIMESTAMP_NS columns,
-	// causing GROUP BY to produce per-second rows. Epoch math avoids this.
-	sql = expandTimeGroup(sql)
-	return sql
-}
-
-// timestampLayouts is the ordered list of Go time layouts the JSON decoder
-// will try when inferring a timestamp column's string format. The first
-// matching layout for the first non-null sample is cached and used for
-// every subsequent row — eliminating up to 3 time.Parse attempts per row.
-var timestampLayouts = []string{
-	time.RFC3339,
-	"2006-01-02T15:04:05.000000", // Arc-emitted microsecond precision
-	"2006-01-02T15:04:05",        // No timezone
-}
-
-// parseJSONTimestamp converts a JSON-decoded value to time.Time using the
-// detectedLayout for strings (or trying every layout if detection failed for
-// this column). Numeric values are interpreted as seconds when small and
-// milliseconds when large — the 1e12 threshold sits at year 2001 in seconds
-// and would be year 33000 in milliseconds.
-func parseJSONTimestamp(v interface{}, detectedLayout string) (time.Time, bool) {
-	switch x := v.(type) {
-	case string:
-		if detectedLayout != "" {
-			if t, err := time.Parse(detectedLayout, x); err == nil {
-				return t, true
-			}
-		}
-		// Fallback path when detection didn't latch (mixed-format column).
-		for _, layout := range timestampLayouts {
-			if t, err := time.Parse(layout, x); err == nil {
-				return t, true
-			}
-		}
-		return time.Time{}, false
-	case float64:
-		if x > 1e12 {
-			return time.Unix(0, int64(x)*int64(time.Millisecond)), true
-		}
-		return time.Unix(int64(x), 0), true
-	case int64:
-		if x > 1e12 {
-			return time.Unix(0, x*int64(time.Millisecond)), true
-		}
-		return time.Unix(x, 0), true
-	default:
-		return time.Time{}, false
-	}
-}
-
-// intervalSecondsTable maps DuckDB-compatible interval strings to seconds.
-// Package-level so the lookup is O(1) per macro call instead of a 13-arm
-// switch. Both short and long forms are accepted ("1m" and "1 minute").
-var intervalSecondsTable = map[string]int{
-	"1s": 1, "1 second": 1,
-	"5s": 5, "5 seconds": 5,
-	"10s": 10, "10 seconds": 10,
-	"30s": 30, "30 seconds": 30,
-	"1m": 60, "1 minute": 60,
-	"5m": 300, "5 minutes": 300,
-	"10m": 600, "10 minutes": 600,
-	"15m": 900, "15 minutes": 900,
-	"30m": 1800, "30 minutes": 1800,
-	"1h": 3600, "1 hour": 3600,
-	"6h": 21600, "6 hours": 21600,
-	"12h": 43200, "12 hours": 43200,
-	"1d": 86400, "1 day": 86400,
-}
-
-// intervalToSeconds converts a DuckDB interval string to seconds. Returns
-// (seconds, true) on a hit and (0, false) on an unknown interval — caller
-// is responsible for deciding fallback behavior. Before this signature the
-// function silently defaulted unknown input to 3600s, masking typos like
-// '1minutes' as a one-hour bucket.
-func intervalToSeconds(interval string) (int, bool) {
-	if secs, ok := intervalSecondsTable[strings.TrimSpace(interval)]; ok {
-		return secs, true
-	}
-	return 0, false
-}
-
-// expandTimeGroup replaces $__timeGroup(column, interval) with epoch-based bucketing SQL.
-// DuckDB's date_trunc/time_bucket retains nanosecond residuals on TIMESTAMP_NS columns,
-// causing GROUP BY to produce per-second rows. Epoch math avoids this.
-// Column argument is validated against columnNameRe; unknown intervals and
-// arg-count mismatches are rejected (macro left un-expanded so Arc surfaces a
-// clear error) rather than silently defaulting.
-func expandTimeGroup(sql string) string {
-	return replaceMacroOccurrences(sql, "$__timeGroup(", func(arg string) (string, bool) {
-		parts := strings.Split(arg, ",")
-		if len(parts) < 2 {
-			log.DefaultLogger.Warn("$__timeGroup requires two arguments: $__timeGroup(column, interval)", "found", arg)
-			return "", false
-		}
-		if len(parts) > 2 {
-			// Extra args silently ignored before; now warn loudly.
-			log.DefaultLogger.Warn("$__timeGroup ignored extra arguments — expected $__timeGroup(column, interval)",
-				"found", arg, "extra_count", len(parts)-2)
-			return "", false
-		}
-		column := strings.TrimSpace(parts[0])
-		if err := validateColumnArg(column); err != nil {
-			log.DefaultLogger.Warn("$__timeGroup rejected unsafe column argument", "column", column, "error", err.Error())
-			return "", false
-		}
-		interval := strings.Trim(strings.TrimSpace(parts[1]), "'\"")
-		secs, ok := intervalToSeconds(interval)
-		if !ok {
-			log.DefaultLogger.Warn("$__timeGroup rejected unknown interval — expected '1s', '10s', '1m', '5m', '1h', '1d', etc.",
-				"interval", interval)
-			return "", false
-		}
-		// Use epoch_ns() (BIGINT) with // (integer division) instead of epoch() (DOUBLE)
-		// to avoid floating-point precision loss that causes timestamps near hour
-		// boundaries (e.g. 05:59:59.999) to round up to the next bucket (06:00:00).
-		// DuckDB's / operator returns DOUBLE; // returns BIGINT.
-		return fmt.Sprintf("to_timestamp((epoch_ns(%s) // 1000000000 // %d) * %d)", column, secs, secs), true
-	})
-}
-
-// OptimizeTimeSeriesQuery adds ORDER BY time ASC if missing for better performance
-// This eliminates the need for in-memory sorting, reducing query overhead significantly
-// Inserts ORDER BY before LIMIT/OFFSET clauses to maintain valid SQL syntax
-func OptimizeTimeSeriesQuery(sql string) string {
-	sqlLower := strings.ToLower(strings.TrimSpace(sql))
-
-	// Check if ORDER BY is already present
-	if strings.Contains(sqlLower, "order by") {
-		return sql
-	}
-
-	// Check if this looks like a time series query (contains 'time' column)
-	if !strings.Contains(sqlLower, "time") {
-		return sql
-	}
-
-	// Find LIMIT or OFFSET clause position
-	sql = strings.TrimRight(sql, " \t\n\r;")
-
-	// Find the position where we should insert ORDER BY
-	// ORDER BY must come before LIMIT/OFFSET
-	limitPos := strings.LastIndex(sqlLower, " limit ")
-	offsetPos := strings.LastIndex(sqlLower, " offset ")
-
-	insertPos := len(sql) // Default: end of query
-
-	if limitPos != -1 && (offsetPos == -1 || limitPos < offsetPos) {
-		insertPos = limitPos
-	} else if offsetPos != -1 {
-		insertPos = offsetPos
-	}
-
-	// Insert ORDER BY at the correct position
-	if insertPos < len(sql) {
-		return sql[:insertPos] + " ORDER BY time ASC" + sql[insertPos:]
-	}
-
-	// No LIMIT/OFFSET, add at end
-	return sql + " ORDER BY time ASC"
+	return applyMacrosWith(sql, chunk, backend.DataQuery{TimeRange: originalRange}, time.Time{})
 }
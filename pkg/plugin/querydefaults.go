@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Query defaults: the datasource's queryDefaults setting supplies values
+// for ArcQuery fields a query doesn't set, so an admin can turn on, say,
+// orderByTime or a rowLimit for every panel without editing each one. The
+// defaults are merged under the query's own JSON before it is decoded: a
+// key the query sends wins even when its value is a zero value (false, 0,
+// ""), and only a key that is absent, or null, takes the default. Keys
+// match case-insensitively, as encoding/json matches them to fields.
+//
+// The defaults a query took are recorded as the "queryDefaults" decision.
+// A format default also applies in Explore, where it takes the place of
+// exploreDefaults' table format for queries that don't send one.
+
+// decisionQueryDefaults names the decision listing the defaults a query took.
+const decisionQueryDefaults = "queryDefaults"
+
+// queryDefaultsExcluded are ArcQuery keys that are the query itself, say
+// where it came from or what it fills, or come from the dashboard, not
+// options, and so can't be defaulted.
+var queryDefaultsExcluded = []string{"refId", "sql", "rawSql", "app", "variableQuery", "adhocFilters"}
+
+// parseQueryDefaults validates the queryDefaults setting: every key must be
+// an ArcQuery field other than queryDefaultsExcluded, and every value must
+// decode into it.
+func parseQueryDefaults(setting map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	if len(setting) == 0 {
+		return nil, nil
+	}
+	known := arcQueryKeys()
+	keys := make([]string, 0, len(setting))
+	for k := range setting {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	defaults := make(map[string]json.RawMessage, len(setting))
+	for _, k := range keys {
+		field, ok := known[strings.ToLower(k)]
+		if !ok {
+			return nil, fmt.Errorf("invalid queryDefaults: %q is not a query option", k)
+		}
+		if slices.Contains(queryDefaultsExcluded, field) {
+			return nil, fmt.Errorf("invalid queryDefaults: %q can't have a default", k)
+		}
+		if _, dup := defaults[field]; dup {
+			return nil, fmt.Errorf("invalid queryDefaults: %q is set twice", field)
+		}
+		var probe ArcQuery
+		if err := json.Unmarshal(fmt.Appendf(nil, "{%q:%s}", field, setting[k]), &probe); err != nil {
+			return nil, fmt.Errorf("invalid queryDefaults: %q has a value of the wrong type", k)
+		}
+		defaults[field] = setting[k]
+	}
+	return defaults, nil
+}
+
+// arcQueryKeys maps the lowercased JSON key of every ArcQuery field to the
+// key as spelled.
+func arcQueryKeys() map[string]string {
+	t := reflect.TypeFor[ArcQuery]()
+	keys := make(map[string]string, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[strings.ToLower(name)] = name
+		}
+	}
+	return keys
+}
+
+// mergeQueryDefaults returns raw, a query's JSON object, with each of
+// defaults the query doesn't set added, and the defaults it added. raw
+// comes back as is when nothing was added.
+func mergeQueryDefaults(raw json.RawMessage, defaults map[string]json.RawMessage) (json.RawMessage, map[string]json.RawMessage, error) {
+	if len(defaults) == 0 {
+		return raw, nil, nil
+	}
+	var query map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &query); err != nil {
+		return nil, nil, err
+	}
+	set := make(map[string]bool, len(query))
+	for k, v := range query {
+		if string(v) != "null" {
+			set[strings.ToLower(k)] = true
+		}
+	}
+	var applied map[string]json.RawMessage
+	for k, v := range defaults {
+		if set[strings.ToLower(k)] {
+			continue
+		}
+		if query == nil {
+			query = map[string]json.RawMessage{}
+		}
+		// A null under a differently cased key would otherwise decode
+		// after the default and clear it again.
+		for qk := range query {
+			if strings.EqualFold(qk, k) {
+				delete(query, qk)
+			}
+		}
+		query[k] = v
+		if applied == nil {
+			applied = map[string]json.RawMessage{}
+		}
+		applied[k] = v
+	}
+	if applied == nil {
+		return raw, nil, nil
+	}
+	merged, err := json.Marshal(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, applied, nil
+}
+
+// recordQueryDefaults records the defaults a query took as a decision.
+func recordQueryDefaults(ctx context.Context, applied map[string]json.RawMessage) {
+	if len(applied) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(applied))
+	inputs := make(map[string]any, len(applied))
+	for k, v := range applied {
+		keys = append(keys, k)
+		inputs[k] = v
+	}
+	slices.Sort(keys)
+	recordDecision(ctx, decision{
+		Name:    decisionQueryDefaults,
+		Outcome: strings.Join(keys, ", "),
+		Reason:  "not set by the query; taken from the datasource's queryDefaults",
+		Inputs:  inputs,
+	})
+}
@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestMergeQueryDefaults(t *testing.T) {
+	defaults := map[string]json.RawMessage{
+		"orderByTime": json.RawMessage(`true`),
+		"rowLimit":    json.RawMessage(`500`),
+		"format":      json.RawMessage(`"table"`),
+	}
+	cases := []struct {
+		name    string
+		query   string
+		want    ArcQuery
+		applied []string
+	}{
+		{
+			name:    "absent keys take the defaults",
+			query:   `{"sql":"SELECT 1"}`,
+			want:    ArcQuery{SQL: "SELECT 1", OrderByTime: true, RowLimit: 500, Format: "table"},
+			applied: []string{"format", "orderByTime", "rowLimit"},
+		},
+		{
+			name:    "set keys win",
+			query:   `{"sql":"SELECT 1","rowLimit":10,"format":"time_series"}`,
+			want:    ArcQuery{SQL: "SELECT 1", OrderByTime: true, RowLimit: 10, Format: "time_series"},
+			applied: []string{"orderByTime"},
+		},
+		{
+			name:    "explicit zero values win",
+			query:   `{"sql":"SELECT 1","orderByTime":false,"rowLimit":0,"format":""}`,
+			want:    ArcQuery{SQL: "SELECT 1"},
+			applied: nil,
+		},
+		{
+			name:    "null takes the default",
+			query:   `{"sql":"SELECT 1","rowLimit":null,"orderByTime":false,"format":"table"}`,
+			want:    ArcQuery{SQL: "SELECT 1", RowLimit: 500, Format: "table"},
+			applied: []string{"rowLimit"},
+		},
+		{
+			name:    "keys match case-insensitively",
+			query:   `{"sql":"SELECT 1","OrderByTime":false,"ROWLIMIT":7,"Format":null}`,
+			want:    ArcQuery{SQL: "SELECT 1", RowLimit: 7, Format: "table"},
+			applied: []string{"format"},
+		},
+		{
+			name:    "empty query",
+			query:   `{}`,
+			want:    ArcQuery{OrderByTime: true, RowLimit: 500, Format: "table"},
+			applied: []string{"format", "orderByTime", "rowLimit"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			merged, applied, err := mergeQueryDefaults(json.RawMessage(c.query), defaults)
+			if err != nil {
+				t.Fatalf("merge: %v", err)
+			}
+			var got ArcQuery
+			if err := json.Unmarshal(merged, &got); err != nil {
+				t.Fatalf("decode %s: %v", merged, err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("query = %+v, want %+v", got, c.want)
+			}
+			var keys []string
+			for k := range applied {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			if !reflect.DeepEqual(keys, c.applied) {
+				t.Errorf("applied %q, want %q", keys, c.applied)
+			}
+			if len(applied) == 0 && string(merged) != c.query {
+				t.Errorf("merged = %s, want the query unchanged", merged)
+			}
+		})
+	}
+
+	if merged, applied, err := mergeQueryDefaults(json.RawMessage(`{"sql":"SELECT 1"}`), nil); string(merged) != `{"sql":"SELECT 1"}` || applied != nil || err != nil {
+		t.Errorf("no defaults: merged %s, applied %v, err %v", merged, applied, err)
+	}
+	if _, _, err := mergeQueryDefaults(json.RawMessage(`[1]`), defaults); err == nil {
+		t.Error("a query that isn't an object was merged")
+	}
+}
+
+func TestParseQueryDefaults(t *testing.T) {
+	got, err := parseQueryDefaults(map[string]json.RawMessage{
+		"orderByTime":   json.RawMessage(`true`),
+		"SplitDuration": json.RawMessage(`"6h"`),
+	})
+	want := map[string]json.RawMessage{"orderByTime": json.RawMessage(`true`), "splitDuration": json.RawMessage(`"6h"`)}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseQueryDefaults = %s, %v; want %s", got, err, want)
+	}
+	if got, err := parseQueryDefaults(nil); got != nil || err != nil {
+		t.Errorf("parseQueryDefaults(nil) = %v, %v", got, err)
+	}
+
+	cases := []struct {
+		name    string
+		setting map[string]json.RawMessage
+		msg     string
+	}{
+		{"unknown key", map[string]json.RawMessage{"fill": json.RawMessage(`"null"`)}, `"fill" is not a query option`},
+		{"the SQL", map[string]json.RawMessage{"sql": json.RawMessage(`"SELECT 1"`)}, `"sql" can't have a default`},
+		{"the origin", map[string]json.RawMessage{"App": json.RawMessage(`"explore"`)}, `"App" can't have a default`},
+		{"wrong type", map[string]json.RawMessage{"rowLimit": json.RawMessage(`"many"`)}, `"rowLimit" has a value of the wrong type`},
+		{"set twice", map[string]json.RawMessage{"rowLimit": json.RawMessage(`1`), "RowLimit": json.RawMessage(`2`)}, `"rowLimit" is set twice`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := parseQueryDefaults(c.setting); err == nil || !strings.Contains(err.Error(), c.msg) {
+				t.Errorf("err = %v, want %q", err, c.msg)
+			}
+		})
+	}
+}
+
+func TestQuery_QueryDefaults(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = body.SQL
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns": ["host", "v"], "data": [["a", 1]]}`))
+	}))
+	defer srv.Close()
+
+	pctx := testPluginContext(t, srv.URL, map[string]any{
+		"useArrow":      false,
+		"queryDefaults": map[string]any{"rowLimit": 25, "format": "table"},
+	})
+	run := func(t *testing.T, query string) (string, backend.DataResponse) {
+		t.Helper()
+		res, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: pctx,
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(query)}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		resp := res.Responses["A"]
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return sent, resp
+	}
+
+	sql, resp := run(t, `{"sql":"SELECT host, v FROM t"}`)
+	if !strings.HasSuffix(sql, "LIMIT 25") {
+		t.Errorf("sent %q, want the default rowLimit", sql)
+	}
+	d, ok := frameDecisions(t, resp.Frames[0])[decisionQueryDefaults]
+	if !ok || d.Outcome != "format, rowLimit" {
+		t.Fatalf("queryDefaults decision = %+v", d)
+	}
+	if in, _ := json.Marshal(d.Inputs); string(in) != `{"format":"table","rowLimit":25}` {
+		t.Errorf("decision inputs = %s", in)
+	}
+
+	sql, resp = run(t, `{"sql":"SELECT host, v FROM t","rowLimit":0,"format":"table"}`)
+	if strings.Contains(sql, "LIMIT") {
+		t.Errorf("sent %q, want the query's rowLimit 0 to win", sql)
+	}
+	if custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{}); custom != nil {
+		if list, _ := custom[decisionsMetaKey].([]decision); list != nil {
+			for _, d := range list {
+				if d.Name == decisionQueryDefaults {
+					t.Errorf("queryDefaults decision recorded with no defaults taken: %+v", d)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// newResourceHandler builds the CallResource router. Every route resolves
+// the cached instance from the request's PluginContext, so resource calls
+// share the same HTTP client, concurrency semaphore and caches as QueryData.
+func (d *ArcDatasource) newResourceHandler() backend.CallResourceHandler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/schema", d.handleSchema)
+	mux.HandleFunc("/audit", d.handleAudit)
+	mux.HandleFunc("/version", d.handleVersion)
+	mux.HandleFunc("/split-ladder", d.handleSplitLadder)
+	mux.HandleFunc("/debug/last-failure", d.handleLastFailure)
+	mux.HandleFunc("/debug/slow-plans", d.handleSlowPlans)
+	mux.HandleFunc("/bench", d.handleBench)
+	mux.HandleFunc("/settings/effective", d.handleEffectiveSettings)
+	mux.HandleFunc("/databases", d.handleDatabases)
+	mux.HandleFunc("/tables", d.handleTables)
+	mux.HandleFunc("/columns", d.handleColumns)
+	mux.HandleFunc("/tag-keys", d.handleTagKeys)
+	mux.HandleFunc("/tag-values", d.handleTagValues)
+	return httpadapter.New(mux)
+}
+
+// CallResource routes plugin resource requests (`/api/datasources/uid/<uid>/resources/*`).
+// Every Arc request made while serving one is classified as resource traffic
+// and carries the caller's identity (see withCallerIdentity).
+func (d *ArcDatasource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	ctx = withCallerIdentity(withRequestClass(ctx, requestClassResource), req.PluginContext)
+	ctx = withOAuthToken(ctx, req.GetHTTPHeaders())
+	return d.resourceHandler.CallResource(ctx, req, sender)
+}
+
+// resourceInstance resolves the instance for a resource request.
+func (d *ArcDatasource) resourceInstance(r *http.Request) (*ArcInstanceSettings, error) {
+	return d.getInstance(r.Context(), httpadapter.PluginConfigFromContext(r.Context()))
+}
+
+// writeResourceJSON writes v as the JSON response body with the given status.
+func writeResourceJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeResourceError writes `{"error": msg}` — the same envelope Arc uses,
+// so frontend code can share one error parser. msg must already be safe to
+// show to the caller (see sanitizeUserError).
+func writeResourceError(w http.ResponseWriter, status int, msg string) {
+	writeResourceJSON(w, status, map[string]string{"error": msg})
+}
+
+// schemaRequest is the POST /schema body: a regular query model plus an
+// optional time range for macro expansion (defaults to the last hour — the
+// range doesn't change the result shape, it only has to produce valid SQL).
+type schemaRequest struct {
+	ArcQuery
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// schemaColumn is one column of a POST /schema answer. Type marshals as the
+// SDK's item type string (e.g. "*float64", "*time.Time"). NativeType and
+// Description are only filled for cached DESCRIBE answers (see
+// describeTable), which leave Type unset.
+type schemaColumn struct {
+	Name        string         `json:"name"`
+	Type        data.FieldType `json:"type"`
+	NativeType  string         `json:"nativeType,omitempty"`
+	Description string         `json:"description,omitempty"`
+}
+
+// schemaResponse is the POST /schema answer.
+type schemaResponse struct {
+	Columns []schemaColumn `json:"columns"`
+	Cached  bool           `json:"cached"`
+}
+
+// handleSchema answers "what columns and Grafana field types would this
+// query return?" without executing it over the full range. The macro-expanded
+// SQL is wrapped in `LIMIT 0` and decoded through the Arrow path, so the
+// types come from the same createEmptyField mapping a real query uses
+// (including the int64 → float64 promotion). Arrow is used even when the
+// datasource is configured for JSON: the JSON path infers types from row
+// values and has nothing to infer from on a zero-row result.
+func (d *ArcDatasource) handleSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("schema", err))
+		return
+	}
+
+	var req schemaRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeResourceError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.SQL == "" {
+		req.SQL = req.RawSQL
+	}
+	if strings.TrimSpace(req.SQL) == "" {
+		writeResourceError(w, http.StatusBadRequest, "sql is required")
+		return
+	}
+	settings, err = settings.withDatabaseOverride("schema", req.Database)
+	if err != nil {
+		if errors.Is(err, errDatabaseOverrideDisabled) {
+			writeResourceError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeResourceError(w, http.StatusBadRequest, sanitizeUserError("schema", err))
+		return
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	if req.SQL, err = settings.expandSnippets(req.SQL, user); err != nil {
+		writeResourceError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := settings.checkRestrictions("schema", user, req.SQL); err != nil {
+		writeResourceError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	key := settings.scopedKey(r.Context(), schemaFingerprint(settings.settings.Database, req.SQL))
+	if cols, ok := settings.schemaCache.get(key); ok {
+		writeResourceJSON(w, http.StatusOK, schemaResponse{Columns: cols, Cached: true})
+		return
+	}
+
+	cols, err := settings.probeSchema(r.Context(), req)
+	if err != nil {
+		writeResourceError(w, http.StatusBadGateway, sanitizeUserError("schema", err))
+		return
+	}
+	writeResourceJSON(w, http.StatusOK, schemaResponse{Columns: cols})
+}
+
+// probeSchema runs req's SQL — snippets already expanded — as a `LIMIT 0`
+// query over req's time range and caches the columns it returns.
+func (s *ArcInstanceSettings) probeSchema(ctx context.Context, req schemaRequest) ([]schemaColumn, error) {
+	tr := backend.TimeRange{From: req.From, To: req.To}
+	if tr.From.IsZero() || tr.To.IsZero() {
+		tr.To = time.Now()
+		tr.From = tr.To.Add(-time.Hour)
+	}
+	frame, err := queryArrow(ctx, s, wrapLimitZero(ApplyMacros(req.SQL, tr)))
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]schemaColumn, len(frame.Fields))
+	for i, f := range frame.Fields {
+		cols[i] = schemaColumn{Name: f.Name, Type: f.Type()}
+	}
+	s.schemaCache.put(s.scopedKey(ctx, schemaFingerprint(s.settings.Database, req.SQL)), cols)
+	return cols, nil
+}
+
+// handleVersion reports the Arc server version this instance detected (or
+// was configured with). `?refresh=true` re-probes instead of answering from
+// the cache, e.g. after an Arc upgrade.
+func (d *ArcDatasource) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("version", err))
+		return
+	}
+	refresh := r.URL.Query().Get("refresh") == "true"
+	writeResourceJSON(w, http.StatusOK, settings.arcVersion(r.Context(), refresh))
+}
+
+// handleLastFailure downloads the newest failure capture (see
+// captureStore): the raw response body as an attachment, or with
+// `?info=true` the metadata of every stored capture. Captures hold query
+// results, so only org admins may read them.
+func (d *ArcDatasource) handleLastFailure(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	if user == nil || !strings.EqualFold(user.Role, "Admin") {
+		writeResourceError(w, http.StatusForbidden, "failure captures are only available to admins")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("last-failure", err))
+		return
+	}
+	if settings.captures == nil {
+		writeResourceError(w, http.StatusNotFound, "failure capture is off: enable captureFailures in the datasource settings")
+		return
+	}
+
+	if r.URL.Query().Get("info") == "true" {
+		captures, err := settings.captures.list()
+		if err != nil {
+			writeResourceError(w, http.StatusInternalServerError, "failed to list captures")
+			return
+		}
+		writeResourceJSON(w, http.StatusOK, map[string]any{"captures": captures})
+		return
+	}
+	meta, body, err := settings.captures.latest()
+	if errors.Is(err, os.ErrNotExist) {
+		writeResourceError(w, http.StatusNotFound, "no failed query has been captured")
+		return
+	}
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, "failed to read capture")
+		return
+	}
+	contentType := jsonMediaType
+	if meta.Protocol == "arrow" {
+		contentType = arrowStreamMediaType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="arc-failure-`+meta.File+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+// handleSlowPlans lists the plans captured for slow queries (see
+// planStore), newest first. Plans name tables and columns, so like failure
+// captures they are only for org admins.
+func (d *ArcDatasource) handleSlowPlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	if user == nil || !strings.EqualFold(user.Role, "Admin") {
+		writeResourceError(w, http.StatusForbidden, "slow query plans are only available to admins")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("slow-plans", err))
+		return
+	}
+	if settings.slowPlans == nil {
+		writeResourceError(w, http.StatusNotFound, "slow query plan capture is off: set slowQueryThreshold and enable captureSlowQueryPlans in the datasource settings")
+		return
+	}
+	writeResourceJSON(w, http.StatusOK, map[string]any{"plans": settings.slowPlans.list()})
+}
+
+// wrapLimitZero turns a query into a zero-row probe with the same result
+// schema. Trailing semicolons are dropped (they'd terminate the subquery) and
+// the closing paren goes on its own line so a trailing `-- comment` in the
+// user's SQL can't swallow it.
+func wrapLimitZero(sql string) string {
+	sql = strings.TrimRight(sql, " \t\r\n;")
+	return "SELECT * FROM (\n" + sql + "\n) AS _arc_schema LIMIT 0"
+}
+
+// schemaFingerprint keys the schema cache. The raw (pre-macro) SQL is used
+// because the time range never changes a query's result shape.
+func schemaFingerprint(database, sql string) string {
+	sum := sha256.Sum256([]byte(database + "\x00" + sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// DefaultSchemaCacheTTL bounds how long a POST /schema answer is reused.
+// Short on purpose: table schemas do change (ALTER, new ingest columns) and
+// the endpoint exists for bulk dashboard migration, where repeat lookups of
+// the same query cluster within seconds of each other.
+const DefaultSchemaCacheTTL = time.Minute
+
+// schemaCacheMaxEntries caps the schema cache so a migration script walking
+// thousands of distinct queries can't grow it without bound.
+const schemaCacheMaxEntries = 256
+
+type schemaCacheEntry struct {
+	cols    []schemaColumn
+	expires time.Time
+}
+
+// schemaCache is a small TTL cache of POST /schema answers, one per
+// datasource instance so editing the datasource drops it.
+type schemaCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]schemaCacheEntry
+}
+
+func newSchemaCache(ttl time.Duration) *schemaCache {
+	return &schemaCache{ttl: ttl, entries: make(map[string]schemaCacheEntry)}
+}
+
+func (c *schemaCache) get(key string) ([]schemaColumn, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.cols, true
+}
+
+// put stores cols under key for the cache's TTL.
+func (c *schemaCache) put(key string, cols []schemaColumn) {
+	c.putFor(key, cols, c.ttl)
+}
+
+// putFor stores cols under key for ttl. When the cache is full, expired entries are
+// swept first; if it is still full an arbitrary entry is evicted — the cache
+// is an optimization, so exact LRU bookkeeping isn't worth its cost.
+func (c *schemaCache) putFor(key string, cols []schemaColumn, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= schemaCacheMaxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < schemaCacheMaxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = schemaCacheEntry{cols: cols, expires: now.Add(ttl)}
+}
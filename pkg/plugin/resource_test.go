@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// testPluginContext returns a PluginContext whose instance settings point at
+// url, for exercising handlers that resolve the instance through the SDK's
+// InstanceManager (CallResource, QueryData, CheckHealth).
+func testPluginContext(t *testing.T, url string, extra map[string]any) backend.PluginContext {
+	t.Helper()
+	settings := map[string]any{"url": url}
+	for k, v := range extra {
+		settings[k] = v
+	}
+	jsonData, _ := jsonMarshal(settings)
+	return backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			UID:                     "arc-test",
+			JSONData:                jsonData,
+			DecryptedSecureJSONData: map[string]string{"apiKey": "k"},
+			Updated:                 time.Now(),
+		},
+	}
+}
+
+// resourceRecorder captures the response a CallResource handler sends.
+type resourceRecorder struct {
+	resp *backend.CallResourceResponse
+}
+
+func (r *resourceRecorder) Send(resp *backend.CallResourceResponse) error {
+	r.resp = resp
+	return nil
+}
+
+// callResource drives d.CallResource and returns the status and body.
+func callResource(t *testing.T, d *ArcDatasource, pluginCtx backend.PluginContext, method, path string, body any) (int, []byte) {
+	t.Helper()
+	var raw []byte
+	if body != nil {
+		raw, _ = json.Marshal(body)
+	}
+	rec := &resourceRecorder{}
+	// Grafana sends the route in Path and the full URL (with query) in URL.
+	route, _, _ := strings.Cut(path, "?")
+	err := d.CallResource(t.Context(), &backend.CallResourceRequest{
+		PluginContext: pluginCtx,
+		Method:        method,
+		Path:          route,
+		URL:           path,
+		Body:          raw,
+	}, rec)
+	if err != nil {
+		t.Fatalf("CallResource: %v", err)
+	}
+	if rec.resp == nil {
+		t.Fatal("CallResource sent no response")
+	}
+	return rec.resp.Status, rec.resp.Body
+}
+
+// schemaOnlyArrowStream encodes an Arrow IPC stream that carries a schema and
+// no record batches — what Arc returns for a zero-row result.
+func schemaOnlyArrowStream(t *testing.T, schema *arrow.Schema) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(memory.NewGoAllocator()))
+	if err := w.Close(); err != nil {
+		t.Fatalf("ipc close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandleSchema_ReturnsMappedTypesAndCaches(t *testing.T) {
+	stream := schemaOnlyArrowStream(t, arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}, Nullable: true},
+		{Name: "count", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil))
+
+	var calls atomic.Int32
+	var gotSQL atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		gotSQL.Store(body.SQL)
+		_, _ = w.Write(stream)
+	}))
+	defer srv.Close()
+
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, nil)
+	req := map[string]any{"sql": "SELECT * FROM cpu WHERE $__timeFilter(time);"}
+
+	status, body := callResource(t, d, pctx, http.MethodPost, "/schema", req)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, body)
+	}
+	var resp struct {
+		Columns []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"columns"`
+		Cached bool `json:"cached"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []struct{ name, typ string }{
+		{"time", "*time.Time"},
+		{"count", "*float64"}, // int64 promotion, same as a real query
+		{"host", "*string"},
+	}
+	if len(resp.Columns) != len(want) {
+		t.Fatalf("expected %d columns, got %+v", len(want), resp.Columns)
+	}
+	for i, w := range want {
+		if resp.Columns[i].Name != w.name || resp.Columns[i].Type != w.typ {
+			t.Errorf("column %d: got %+v, want %s %s", i, resp.Columns[i], w.name, w.typ)
+		}
+	}
+	sql := gotSQL.Load().(string)
+	if !strings.HasSuffix(sql, "LIMIT 0") || strings.Contains(sql, "$__timeFilter") || strings.Contains(sql, ";") {
+		t.Errorf("expected macro-expanded LIMIT 0 probe, got %q", sql)
+	}
+
+	// Second identical request is answered from cache.
+	status, body = callResource(t, d, pctx, http.MethodPost, "/schema", req)
+	if status != http.StatusOK || !strings.Contains(string(body), `"cached":true`) {
+		t.Fatalf("expected cached answer, got %d %s", status, body)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 Arc request, got %d", calls.Load())
+	}
+}
+
+func TestHandleSchema_RejectsBadRequests(t *testing.T) {
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, "http://127.0.0.1:1", nil)
+
+	if status, _ := callResource(t, d, pctx, http.MethodGet, "/schema", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET: expected 405, got %d", status)
+	}
+	if status, _ := callResource(t, d, pctx, http.MethodPost, "/schema", map[string]any{"sql": " "}); status != http.StatusBadRequest {
+		t.Errorf("empty sql: expected 400, got %d", status)
+	}
+	status, body := callResource(t, d, pctx, http.MethodPost, "/schema", map[string]any{"sql": "SELECT 1", "database": "other"})
+	if status != http.StatusBadRequest || !strings.Contains(string(body), "Allow Database Override") {
+		t.Errorf("database override: expected 400 with guard message, got %d %s", status, body)
+	}
+}
+
+func TestWrapLimitZero(t *testing.T) {
+	got := wrapLimitZero("SELECT * FROM t -- trailing comment\n;  ")
+	want := "SELECT * FROM (\nSELECT * FROM t -- trailing comment\n) AS _arc_schema LIMIT 0"
+	if got != want {
+		t.Errorf("wrapLimitZero = %q, want %q", got, want)
+	}
+}
+
+func TestSchemaCache_Expires(t *testing.T) {
+	c := newSchemaCache(10 * time.Millisecond)
+	c.put("k", []schemaColumn{{Name: "a"}})
+	if _, ok := c.get("k"); !ok {
+		t.Fatal("expected fresh entry")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.get("k"); ok {
+		t.Error("expected entry to expire")
+	}
+}
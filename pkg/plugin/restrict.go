@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Role restrictions (roleRestrictions setting): an admin can limit the
+// tables a Grafana org role may query, e.g. viewers to a handful of
+// dashboard tables while editors query anything. The frontend can't enforce
+// this — a viewer can send any SQL to /api/ds/query — so the backend reads
+// the tables from the SQL (scanTableRefs) and rejects the query before it
+// reaches Arc.
+//
+// The scan is regex-based. When it can't account for every table a query
+// reads (table functions, file paths, non-SELECT statements), a strict role
+// rejects the query and a non-strict one runs it with a warning in the log.
+// Roles without an entry, and requests without a user (alerting), are not
+// restricted.
+
+// errQueryRestricted is returned when a query reads a table its user's role
+// may not query. The message names the table and role and is user-facing.
+var errQueryRestricted = errors.New("query not allowed")
+
+// RoleRestriction is the roleRestrictions entry for one org role.
+type RoleRestriction struct {
+	Tables []string `json:"tables"` // allowed tables as path.Match globs: "cpu" or "cpu_*" in the queried database, "prod.cpu" or "*.cpu" qualified
+	Strict *bool    `json:"strict"` // reject queries whose tables can't all be determined; nil = strict for every role but Admin
+}
+
+// roleRestriction is a validated RoleRestriction with lowercased patterns.
+type roleRestriction struct {
+	patterns []string
+	strict   bool
+}
+
+// parseRoleRestrictions validates the roleRestrictions setting and keys it
+// by lowercased role name.
+func parseRoleRestrictions(cfg map[string]RoleRestriction) (map[string]roleRestriction, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]roleRestriction, len(cfg))
+	for role, rc := range cfg {
+		key := strings.ToLower(strings.TrimSpace(role))
+		if key == "" {
+			return nil, errors.New("invalid roleRestrictions: empty role name")
+		}
+		r := roleRestriction{strict: key != "admin"}
+		if rc.Strict != nil {
+			r.strict = *rc.Strict
+		}
+		for _, p := range rc.Tables {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if _, err := path.Match(p, ""); err != nil || p == "" || strings.Count(p, ".") > 1 {
+				return nil, fmt.Errorf("invalid roleRestrictions pattern %q for role %s: use table or database.table, with * and ? wildcards", p, role)
+			}
+			r.patterns = append(r.patterns, p)
+		}
+		out[key] = r
+	}
+	return out, nil
+}
+
+// allows reports whether the table key (database.table, lowercased) matches
+// one of the patterns; a pattern without a database is in database db.
+func (r roleRestriction) allows(db, key string) bool {
+	for _, p := range r.patterns {
+		if !strings.Contains(p, ".") {
+			p = db + "." + p
+		}
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// literalFromRe finds FROM over a string literal (`FROM 'x.parquet'`),
+	// which stripping leaves as a FROM followed by whatever came next.
+	literalFromRe = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+'[^']*'?`)
+	namePartRe    = regexp.MustCompile(`"[^"]+"|[^."]+`)
+)
+
+type requestUserKey struct{}
+
+// withRequestUser returns ctx carrying the Grafana user a request runs as,
+// for checkRestrictions deeper in the query path.
+func withRequestUser(ctx context.Context, user *backend.User) context.Context {
+	return context.WithValue(ctx, requestUserKey{}, user)
+}
+
+// requestUserFrom returns the user withRequestUser stored, or nil.
+func requestUserFrom(ctx context.Context) *backend.User {
+	user, _ := ctx.Value(requestUserKey{}).(*backend.User)
+	return user
+}
+
+// allowsTable reports whether user's role may query table, unqualified, in
+// the database of s. The catalog resources filter and guard with it.
+func (s *ArcInstanceSettings) allowsTable(user *backend.User, table string) bool {
+	if user == nil || len(s.restrictions) == 0 {
+		return true
+	}
+	r, ok := s.restrictions[strings.ToLower(user.Role)]
+	if !ok {
+		return true
+	}
+	db := strings.ToLower(s.settings.Database)
+	return r.allows(db, db+"."+strings.ToLower(table))
+}
+
+// checkRestrictions returns an errQueryRestricted error when user's role
+// may not run sql against the database of s (after any per-query override).
+func (s *ArcInstanceSettings) checkRestrictions(refID string, user *backend.User, sql string) error {
+	if user == nil || len(s.restrictions) == 0 {
+		return nil
+	}
+	r, ok := s.restrictions[strings.ToLower(user.Role)]
+	if !ok {
+		return nil
+	}
+	db := strings.ToLower(s.settings.Database)
+
+	stripped := newStrippedSQL(sql)
+	scan := scanTableRefs(stripped)
+	// offending is what an explanation frame quotes for incomplete.
+	incomplete, offending := scan.incomplete, scan.incomplete
+	switch first := strings.Fields(strings.ReplaceAll(stripped.upper, "(", " ( ")); {
+	case len(first) == 0:
+		return nil
+	case first[0] != "SELECT" && first[0] != "WITH" && first[0] != "FROM" && first[0] != "VALUES" && first[0] != "(":
+		incomplete, offending = first[0]+" statement", first[0]
+	case containsMultipleStatements(stripped):
+		incomplete, offending = "multiple statements", "multiple statements"
+	case literalFromRe.MatchString(sql):
+		incomplete, offending = "a FROM over a file path or string", literalFromRe.FindString(sql)
+	}
+
+	for _, ref := range scan.refs {
+		if ref.cte {
+			continue
+		}
+		parts := namePartRe.FindAllString(ref.name, -1)
+		for i, part := range parts {
+			if strings.HasPrefix(part, `"`) && strings.ContainsAny(part, "./:") {
+				incomplete, offending = "a file path as table name", ref.name
+			}
+			parts[i] = strings.ToLower(strings.Trim(part, `"`))
+		}
+		switch len(parts) {
+		case 1:
+			parts = []string{db, parts[0]}
+		case 2:
+		default:
+			incomplete, offending = "a catalog-qualified table name", ref.name
+			continue
+		}
+		if !r.allows(db, strings.Join(parts, ".")) {
+			log.DefaultLogger.Warn("Query rejected by role restrictions", "refId", refID, "role", user.Role, "table", ref.name)
+			return &blockedQueryError{
+				policy:    policyRoleRestrictions,
+				offending: ref.name,
+				hint:      fmt.Sprintf("Query only the tables the %s role may read, or ask an admin to allow %s in the datasource's role restrictions.", user.Role, ref.name),
+				err:       fmt.Errorf("%w: table %s is not allowed for the %s role", errQueryRestricted, ref.name, user.Role),
+			}
+		}
+	}
+
+	if incomplete != "" {
+		if r.strict {
+			log.DefaultLogger.Warn("Query rejected by role restrictions: tables undetermined", "refId", refID, "role", user.Role, "reason", incomplete)
+			return &blockedQueryError{
+				policy:    policyRoleRestrictions,
+				offending: offending,
+				hint:      fmt.Sprintf("Rewrite the query as a single SELECT over named tables, or ask an admin to make the %s role's restriction non-strict.", user.Role),
+				err:       fmt.Errorf("%w: the %s role may only run queries whose tables can be checked, and this one contains %s", errQueryRestricted, user.Role, incomplete),
+			}
+		}
+		log.DefaultLogger.Warn("Allowing query with undetermined tables: role restriction is not strict", "refId", refID, "role", user.Role, "reason", incomplete)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func restrictedInstance(t *testing.T, cfg map[string]RoleRestriction) *ArcInstanceSettings {
+	t.Helper()
+	inst := newTestInstance(t, "http://127.0.0.1:1")
+	inst.settings.Database = "prod"
+	restrictions, err := parseRoleRestrictions(cfg)
+	if err != nil {
+		t.Fatalf("parseRoleRestrictions: %v", err)
+	}
+	inst.restrictions = restrictions
+	return inst
+}
+
+func TestCheckRestrictions(t *testing.T) {
+	lenient := false
+	inst := restrictedInstance(t, map[string]RoleRestriction{
+		"Viewer": {Tables: []string{"cpu", "mem_*", "shared.*"}},
+		"Admin":  {Tables: []string{"cpu"}},
+		"Editor": {Tables: []string{"cpu"}, Strict: &lenient},
+	})
+	viewer := &backend.User{Login: "v", Role: "Viewer"}
+	admin := &backend.User{Login: "a", Role: "Admin"}
+	editor := &backend.User{Login: "e", Role: "Editor"}
+
+	cases := []struct {
+		name    string
+		user    *backend.User
+		sql     string
+		blocked string // substring of the error; "" = allowed
+	}{
+		{"allowed table", viewer, "SELECT time, usage FROM cpu WHERE $__timeFilter(time)", ""},
+		{"glob", viewer, "SELECT * FROM mem_used", ""},
+		{"qualified in the datasource database", viewer, `SELECT * FROM "prod"."CPU"`, ""},
+		{"other database by pattern", viewer, "SELECT * FROM shared.hosts", ""},
+		{"CTE and subquery", viewer, "WITH c AS (SELECT * FROM cpu) SELECT * FROM (SELECT * FROM c) t JOIN mem_free m ON true", ""},
+		{"no table", viewer, "SELECT 1", ""},
+		{"blocked table named", viewer, "SELECT * FROM cpu JOIN secrets s ON s.host = cpu.host", "table secrets is not allowed for the Viewer role"},
+		{"same table in another database", viewer, "SELECT * FROM other.cpu", "table other.cpu"},
+		{"blocked in subquery", viewer, "SELECT * FROM cpu WHERE host IN (SELECT host FROM secrets)", "table secrets"},
+		{"CTE shadowing a table", viewer, "WITH secrets AS (SELECT * FROM secrets) SELECT * FROM secrets", "table secrets"},
+		{"role names are case-insensitive", &backend.User{Role: "viewer"}, "SELECT * FROM secrets", "table secrets"},
+		{"table function fails closed", viewer, "SELECT * FROM read_parquet('/data/*.parquet')", "read_parquet"},
+		{"file path fails closed", viewer, "SELECT * FROM '/data/secrets.parquet' cpu", "file path"},
+		{"comma join fails closed", viewer, "SELECT * FROM cpu, secrets", "comma-separated"},
+		{"FROM-first subquery fails closed", viewer, "SELECT * FROM cpu WHERE host IN (FROM secrets)", "FROM-first"},
+		{"non-SELECT fails closed", viewer, "DESCRIBE secrets", "DESCRIBE statement"},
+		{"multiple statements fail closed", viewer, "SELECT * FROM cpu; SELECT 1", "multiple statements"},
+		{"admin is lenient by default", admin, "SELECT * FROM read_parquet('/data/*.parquet')", ""},
+		{"lenient role still blocks named tables", editor, "SELECT * FROM secrets", "table secrets"},
+		{"unlisted role", &backend.User{Role: "None"}, "SELECT * FROM secrets", ""},
+		{"no user (alerting)", nil, "SELECT * FROM secrets", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := inst.checkRestrictions("A", c.user, c.sql)
+			if c.blocked == "" {
+				if err != nil {
+					t.Fatalf("expected allowed, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errQueryRestricted) || !strings.Contains(err.Error(), c.blocked) {
+				t.Fatalf("expected errQueryRestricted mentioning %q, got %v", c.blocked, err)
+			}
+		})
+	}
+}
+
+func TestParseRoleRestrictions_RejectsBadPatterns(t *testing.T) {
+	for _, p := range []string{"", "[", "a.b.c"} {
+		if _, err := parseRoleRestrictions(map[string]RoleRestriction{"Viewer": {Tables: []string{p}}}); err == nil {
+			t.Errorf("pattern %q should be rejected", p)
+		}
+	}
+}
+
+// TestRoleRestrictions_EndToEnd checks QueryData and /schema read the role
+// from the request and reject a blocked query before it reaches Arc.
+func TestRoleRestrictions_EndToEnd(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["n"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{
+		"useArrow":         false,
+		"roleRestrictions": map[string]any{"Viewer": map[string]any{"tables": []string{"cpu"}}},
+	})
+	pctx.User = &backend.User{Login: "v", Role: "Viewer"}
+
+	resp, err := d.QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: pctx,
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"sql":"SELECT count(*) AS n FROM cpu","format":"table"}`)},
+			{RefID: "B", JSON: []byte(`{"sql":"SELECT count(*) AS n FROM secrets","format":"table"}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	if r := resp.Responses["A"]; r.Error != nil {
+		t.Errorf("allowed query failed: %v", r.Error)
+	}
+	if r := resp.Responses["B"]; r.Error == nil || r.Status != backend.StatusForbidden || !strings.Contains(r.Error.Error(), "secrets") {
+		t.Errorf("expected a 403 naming the table, got %d %v", r.Status, r.Error)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected only the allowed query to reach Arc, got %d requests", n)
+	}
+
+	status, body := callResource(t, d, pctx, http.MethodPost, "/schema", map[string]any{"sql": "SELECT * FROM secrets"})
+	var envelope struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &envelope)
+	if status != http.StatusForbidden || !strings.Contains(envelope.Error, "secrets") {
+		t.Errorf("/schema: expected 403 naming the table, got %d %s", status, body)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("/schema must not reach Arc for a blocked query, got %d requests", n)
+	}
+}
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Retries (retryStatusCodes and maxRetries settings): a request Arc — or a
+// gateway in front of it — answers with a retryable status is sent again,
+// up to maxRetries more times, and so is one that fails on the network
+// before any answer: a reset, refused or dropped connection
+// (retryableRequestError). Arc queries only read, so sending one twice is
+// safe. Only the HTTP exchange is retried: once a 200 body is handed to a
+// decoder, a failure mid-stream is not, since the body may already be
+// partly consumed. A request that timed out isn't retried either: it would
+// take the whole timeout again.
+//
+// The first retry waits about retryBackoff, each later one about twice the
+// previous, with jitter so chunks failed by the same blip don't come back
+// in step; a Retry-After header (seconds or an HTTP date) overrides the
+// wait. Either way the wait is capped at maxRetryDelay and ends early when
+// the query is canceled.
+//
+// A split query's chunks each make their own request, so a transient
+// failure costs one chunk its retries while the others keep their results;
+// the query fails only when a chunk runs out of retries. The retries a
+// response took are counted on the context (withRetryCounter), recorded in
+// its frame's meta under "retries" and summed across a split query's chunks,
+// whose meta also lists the chunks that took any under "chunkRetries".
+
+// retriesMetaKey is the FrameMeta.Custom key holding a response's retry
+// count.
+const retriesMetaKey = "retries"
+
+// defaultRetryStatusCodes is the retryable set when retryStatusCodes is
+// unset: rate limiting and the gateway errors of an Arc restart.
+var defaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// chunkRetriesMetaKey is the FrameMeta.Custom key listing the chunks of a
+// split query that were retried (chunkRetry).
+const chunkRetriesMetaKey = "chunkRetries"
+
+const (
+	defaultMaxRetries   = 2
+	defaultRetryBackoff = 250 * time.Millisecond
+	maxRetryDelay       = 5 * time.Second
+)
+
+// resolveRetryStatusCodes validates the retryStatusCodes setting and returns
+// the effective set, sorted: the default when unset, none when empty. Only
+// 4xx and 5xx statuses can be retried.
+func resolveRetryStatusCodes(codes []int) ([]int, error) {
+	if codes == nil {
+		return defaultRetryStatusCodes, nil
+	}
+	resolved := make([]int, 0, len(codes))
+	for _, code := range codes {
+		if code < 400 || code > 599 {
+			return nil, fmt.Errorf("retryStatusCodes: %d is not a 4xx or 5xx status", code)
+		}
+		if !slices.Contains(resolved, code) {
+			resolved = append(resolved, code)
+		}
+	}
+	slices.Sort(resolved)
+	return resolved, nil
+}
+
+// resolveMaxRetries maps the maxRetries setting to the retries a request
+// gets: 0 is the default, negative none, and MaxRetriesCap the most.
+func resolveMaxRetries(n int) int {
+	switch {
+	case n == 0:
+		return defaultMaxRetries
+	case n < 0:
+		return 0
+	}
+	return min(n, MaxRetriesCap)
+}
+
+// retryDelay is the wait before retry number attempt (0-based): the
+// Retry-After of the answer being retried, if it has one (header is nil
+// for a network failure), else the doubling backoff with jitter, between
+// half and all of it; capped at maxRetryDelay.
+func retryDelay(backoff time.Duration, attempt int, header http.Header) time.Duration {
+	if after := header.Get("Retry-After"); after != "" {
+		if secs, err := strconv.Atoi(after); err == nil && secs >= 0 {
+			return min(time.Duration(secs)*time.Second, maxRetryDelay)
+		}
+		if at, err := http.ParseTime(after); err == nil {
+			return min(max(time.Until(at), 0), maxRetryDelay)
+		}
+	}
+	delay := min(backoff<<attempt, maxRetryDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// shouldRetry reports whether an answer with status gets retry number
+// attempt.
+func (s *ArcInstanceSettings) shouldRetry(status, attempt int) bool {
+	return attempt < s.maxRetries && slices.Contains(s.retryStatusCodes, status)
+}
+
+// retryableRequestError reports whether err, from sending a request, is a
+// connection failing before Arc answered — worth sending again — rather
+// than a timeout, a cancellation or something a retry won't fix (DNS,
+// TLS, a bad URL).
+func retryableRequestError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// chunkRetry is a retried chunk in a split query's chunkRetries meta.
+type chunkRetry struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Retries int64     `json:"retries"`
+}
+
+// discardBody drains a little of a response that won't be used, so the
+// connection can be reused, and closes it.
+func discardBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 16*1024))
+	_ = resp.Body.Close()
+}
+
+// sleepContext waits for d or until ctx is done, returning ctx's error then.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type retryCounterKey struct{}
+
+// withRetryCounter returns ctx carrying a fresh count of the retries
+// doRequest makes under it.
+func withRetryCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	n := &atomic.Int64{}
+	return context.WithValue(ctx, retryCounterKey{}, n), n
+}
+
+// countRetry adds one to the counter on ctx, if any.
+func countRetry(ctx context.Context) {
+	if n, _ := ctx.Value(retryCounterKey{}).(*atomic.Int64); n != nil {
+		n.Add(1)
+	}
+}
+
+// recordRetries stores n under retriesMetaKey in frame's meta; a no-op for
+// zero.
+func recordRetries(frame *data.Frame, n int64) {
+	if n == 0 {
+		return
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		custom = map[string]interface{}{}
+		frame.Meta.Custom = custom
+	}
+	custom[retriesMetaKey] = n
+}
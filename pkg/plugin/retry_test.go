@@ -0,0 +1,368 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestResolveRetryStatusCodes(t *testing.T) {
+	cases := []struct {
+		codes   []int
+		want    []int
+		wantErr bool
+	}{
+		{codes: nil, want: defaultRetryStatusCodes},
+		{codes: []int{}, want: []int{}},
+		{codes: []int{520, 429, 499, 429}, want: []int{429, 499, 520}},
+		{codes: []int{429, 200}, wantErr: true},
+		{codes: []int{302}, wantErr: true},
+		{codes: []int{600}, wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := resolveRetryStatusCodes(c.codes)
+		if (err != nil) != c.wantErr {
+			t.Errorf("resolveRetryStatusCodes(%v) error = %v, wantErr %v", c.codes, err, c.wantErr)
+			continue
+		}
+		if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("resolveRetryStatusCodes(%v) = %v, want %v", c.codes, got, c.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	none := http.Header{}
+	for range 100 {
+		if d := retryDelay(250*time.Millisecond, 0, none); d < 125*time.Millisecond || d > 250*time.Millisecond {
+			t.Fatalf("first retry waits %s, want 125ms to 250ms", d)
+		}
+		if d := retryDelay(250*time.Millisecond, 2, nil); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("third retry waits %s, want 500ms to 1s", d)
+		}
+		if d := retryDelay(time.Second, 10, none); d > maxRetryDelay {
+			t.Fatalf("eleventh retry waits %s, past the %s cap", d, maxRetryDelay)
+		}
+	}
+	if d := retryDelay(250*time.Millisecond, 0, http.Header{"Retry-After": {"2"}}); d != 2*time.Second {
+		t.Errorf("Retry-After: 2 waits %s", d)
+	}
+	if d := retryDelay(250*time.Millisecond, 0, http.Header{"Retry-After": {"3600"}}); d != maxRetryDelay {
+		t.Errorf("Retry-After: 3600 waits %s, want the %s cap", d, maxRetryDelay)
+	}
+	date := time.Now().Add(3 * time.Second).UTC().Format(http.TimeFormat)
+	if d := retryDelay(250*time.Millisecond, 0, http.Header{"Retry-After": {date}}); d < time.Second || d > 3*time.Second {
+		t.Errorf("Retry-After: %s waits %s, want about 3s", date, d)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if d := retryDelay(250*time.Millisecond, 0, http.Header{"Retry-After": {past}}); d != 0 {
+		t.Errorf("Retry-After in the past waits %s", d)
+	}
+}
+
+func TestResolveMaxRetries(t *testing.T) {
+	for in, want := range map[int]int{0: defaultMaxRetries, -1: 0, 5: 5, 100: MaxRetriesCap} {
+		if got := resolveMaxRetries(in); got != want {
+			t.Errorf("resolveMaxRetries(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestRetryableRequestError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection reset", &url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"connection refused", &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		{"closed before answering", &url.Error{Op: "Post", Err: io.EOF}, true},
+		{"client timeout", &url.Error{Op: "Post", Err: timeoutError{}}, false},
+		{"canceled", &url.Error{Op: "Post", Err: context.Canceled}, false},
+		{"deadline", &url.Error{Op: "Post", Err: context.DeadlineExceeded}, false},
+		{"unknown host", &url.Error{Op: "Post", Err: &net.DNSError{Err: "no such host", Name: "arc.invalid", IsNotFound: true}}, false},
+	}
+	for _, c := range cases {
+		if got := retryableRequestError(c.err); got != c.want {
+			t.Errorf("%s: retryableRequestError = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TestDoRequest_RetriesDroppedConnections drops the first connections
+// without answering and checks the request is sent again, up to
+// maxRetries.
+func TestDoRequest_RetriesDroppedConnections(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		maxRetries int
+		drops      int32
+		wantHits   int32
+		wantErr    bool
+	}{
+		{name: "default retries", drops: 2, wantHits: 3},
+		{name: "default gives up", drops: 3, wantHits: 3, wantErr: true},
+		{name: "more retries", maxRetries: 4, drops: 4, wantHits: 5},
+		{name: "retries off", maxRetries: -1, drops: 1, wantHits: 1, wantErr: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if hits.Add(1) <= c.drops {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err == nil {
+						_ = conn.Close()
+					}
+					return
+				}
+				_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+			}))
+			defer srv.Close()
+
+			inst := newRetryInstance(t, srv.URL, nil)
+			inst.maxRetries = resolveMaxRetries(c.maxRetries)
+			frames, err := queryJSON(t.Context(), inst, "SELECT 1")
+			if (err != nil) != c.wantErr {
+				t.Fatalf("query error = %v, wantErr %v", err, c.wantErr)
+			}
+			if got := hits.Load(); got != c.wantHits {
+				t.Errorf("requests = %d, want %d", got, c.wantHits)
+			}
+			if err == nil {
+				custom, _ := frames[0].Meta.Custom.(map[string]interface{})
+				if got, _ := custom[retriesMetaKey].(int64); got != int64(c.wantHits-1) {
+					t.Errorf("retries = %v, want %d", custom[retriesMetaKey], c.wantHits-1)
+				}
+			}
+		})
+	}
+}
+
+// scriptedServer answers the nth request with statuses[n], then 200.
+func scriptedServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(hits.Add(1)) - 1
+		if n < len(statuses) {
+			w.WriteHeader(statuses[n])
+			_, _ = w.Write([]byte(`{"error":"try again"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+// newRetryInstance is newTestInstance with the retryStatusCodes setting.
+func newRetryInstance(t *testing.T, url string, codes []int) *ArcInstanceSettings {
+	t.Helper()
+	jsonData, _ := json.Marshal(map[string]any{"url": url, "retryStatusCodes": codes})
+	inst, err := newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: map[string]string{"apiKey": "k"},
+	})
+	if err != nil {
+		t.Fatalf("newArcInstance: %v", err)
+	}
+	settings := inst.(*ArcInstanceSettings)
+	settings.retryBackoff = time.Millisecond
+	return settings
+}
+
+func TestDoRequest_RetriesConfiguredStatuses(t *testing.T) {
+	cases := []struct {
+		name       string
+		codes      []int
+		statuses   []int
+		wantHits   int32
+		wantStatus int // 0 = success
+	}{
+		{name: "default set retries 503", statuses: []int{503, 503}, wantHits: 3},
+		{name: "default set gives up after maxRetries", statuses: []int{503, 503, 503, 503}, wantHits: 3, wantStatus: 503},
+		{name: "default set doesn't retry 520", statuses: []int{520}, wantHits: 1, wantStatus: 520},
+		{name: "custom set retries 499 and 520", codes: []int{499, 520}, statuses: []int{499, 520}, wantHits: 3},
+		{name: "custom set without 429", codes: []int{502, 503}, statuses: []int{429}, wantHits: 1, wantStatus: 429},
+		{name: "empty set disables retries", codes: []int{}, statuses: []int{503}, wantHits: 1, wantStatus: 503},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv, hits := scriptedServer(t, c.statuses...)
+			_, err := queryJSON(t.Context(), newRetryInstance(t, srv.URL, c.codes), "SELECT 1")
+			var statusErr *arcStatusError
+			switch {
+			case c.wantStatus == 0 && err != nil:
+				t.Fatalf("query: %v", err)
+			case c.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != c.wantStatus):
+				t.Fatalf("expected status %d, got %v", c.wantStatus, err)
+			}
+			if got := hits.Load(); got != c.wantHits {
+				t.Errorf("requests = %d, want %d", got, c.wantHits)
+			}
+		})
+	}
+}
+
+func TestDoRequest_RetryWaitEndsWithQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := queryJSON(ctx, newRetryInstance(t, srv.URL, nil), "SELECT 1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the query's deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled retry wait took %s", elapsed)
+	}
+}
+
+func TestNewArcInstance_RejectsInvalidRetryStatusCodes(t *testing.T) {
+	jsonData, _ := json.Marshal(map[string]any{"url": "https://arc.example.com", "retryStatusCodes": []int{503, 204}})
+	_, err := newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: map[string]string{"apiKey": "k"},
+	})
+	if err == nil {
+		t.Fatal("expected 204 to be rejected")
+	}
+}
+
+func TestCheckHealth_ReportsRetryStatusCodes(t *testing.T) {
+	srv := arrowOKServer(t)
+	defer srv.Close()
+
+	pctx := testPluginContext(t, srv.URL, map[string]any{"retryStatusCodes": []int{520, 429}})
+	res, err := NewArcDatasource().CheckHealth(t.Context(), &backend.CheckHealthRequest{PluginContext: pctx})
+	if err != nil || res.Status != backend.HealthStatusOk {
+		t.Fatalf("CheckHealth: %v %+v", err, res)
+	}
+	var details struct {
+		RetryStatusCodes []int `json:"retryStatusCodes"`
+	}
+	if err := json.Unmarshal(res.JSONDetails, &details); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(details.RetryStatusCodes, []int{429, 520}) {
+		t.Errorf("retryStatusCodes = %v, want [429 520]", details.RetryStatusCodes)
+	}
+}
+
+// TestSplitQuery_RetriesOnlyTheFailedChunk splits a 4h query into 1h chunks
+// against a server that answers the 02:00 chunk with 503s, and checks only
+// that chunk is sent again and its retries are summed in the merged meta.
+func TestSplitQuery_RetriesOnlyTheFailedChunk(t *testing.T) {
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	const failing = ">= '2026-03-08T02:00:00Z'"
+
+	cases := []struct {
+		name        string
+		failures    int
+		wantHits    int
+		wantRetries int64
+		wantErr     bool
+	}{
+		{name: "transient failure", failures: 2, wantHits: 3, wantRetries: 2},
+		{name: "retries exhausted", failures: 3, wantHits: 3, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var mu sync.Mutex
+			hits := map[string]int{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					SQL string `json:"sql"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				mu.Lock()
+				hits[body.SQL]++
+				n := hits[body.SQL]
+				mu.Unlock()
+				if strings.Contains(body.SQL, failing) && n <= c.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"columns": []string{"time", "v"},
+					"data":    []interface{}{[]interface{}{"2026-03-08T01:00:00Z", 1}},
+				})
+			}))
+			defer srv.Close()
+
+			inst := newTestInstance(t, srv.URL)
+			useJSON := false
+			inst.settings.UseArrow = &useJSON
+			q, _ := json.Marshal(map[string]interface{}{
+				"sql":           "SELECT time, v FROM cpu WHERE $__timeFilter(time)",
+				"format":        "table",
+				"splitDuration": "1h",
+			})
+			resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from, To: from.Add(4 * time.Hour)},
+				JSON:      q,
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(hits) != 4 {
+				t.Fatalf("distinct chunk requests = %d, want 4", len(hits))
+			}
+			for sql, n := range hits {
+				want := 1
+				if strings.Contains(sql, failing) {
+					want = c.wantHits
+				}
+				if n != want {
+					t.Errorf("%d requests for %q, want %d", n, sql, want)
+				}
+			}
+
+			if c.wantErr {
+				if resp.Error == nil {
+					t.Fatal("expected the query to fail with the 02:00 chunk")
+				}
+				return
+			}
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			custom, _ := resp.Frames[0].Meta.Custom.(map[string]interface{})
+			if got, _ := custom[retriesMetaKey].(int64); got != c.wantRetries {
+				t.Errorf("retries = %v, want %d", custom[retriesMetaKey], c.wantRetries)
+			}
+			want := []chunkRetry{{From: from.Add(2 * time.Hour), To: from.Add(3 * time.Hour), Retries: c.wantRetries}}
+			if got, _ := custom[chunkRetriesMetaKey].([]chunkRetry); !reflect.DeepEqual(got, want) {
+				t.Errorf("chunkRetries = %v, want %v", custom[chunkRetriesMetaKey], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+)
+
+// Column roles. When Arc annotates a result's columns (arcclient.ColumnRoles),
+// a time series query is shaped by the roles instead of by field types: the
+// timestamp column is the time field even when it isn't the first time
+// column, dimensions become labels whatever their type, measures stay values
+// even when they are text, and a result without a timestamp column, or
+// without a measure, is a table. Columns Arc left without a role are
+// classified as before: strings and bools are labels, the rest values.
+//
+// A timestamp column that didn't decode as time (an epoch number, say)
+// can't be the time field, so such a frame is shaped by the heuristics. So
+// is every table-format query: the roles only replace the guessing the
+// time series format does.
+
+// roleLayout is a frame rearranged by its column roles: the time field
+// first, then the dimensions as label fields, then the measures.
+type roleLayout struct {
+	frame *data.Frame
+	table bool // no timestamp or no measure column: not a time series
+	dims  int
+	pivot bool // dimensions and only numeric measures: LongToWide applies as is
+}
+
+// columnRoleLayout lays frame out by its column roles; ok is false when
+// the frame has none, or its timestamp column isn't a time field.
+func columnRoleLayout(frame *data.Frame) (layout roleLayout, ok bool) {
+	roles := arcclient.ColumnRoles(frame)
+	if len(roles) == 0 {
+		return roleLayout{}, false
+	}
+	timeIdx := -1
+	for i, f := range frame.Fields {
+		if roles[f.Name] != arcclient.RoleTimestamp || timeIdx >= 0 {
+			continue
+		}
+		if f.Type().NonNullableType() != data.FieldTypeTime {
+			log.DefaultLogger.Debug("Ignoring column roles: the timestamp column isn't a time field",
+				"column", f.Name, "type", f.Type().ItemTypeString())
+			return roleLayout{}, false
+		}
+		timeIdx = i
+	}
+	if timeIdx < 0 {
+		return roleLayout{frame: frame, table: true}, true
+	}
+
+	var dims, values []*data.Field
+	numeric := true
+	for i, f := range frame.Fields {
+		if i == timeIdx {
+			continue
+		}
+		role, annotated := roles[f.Name]
+		if !annotated {
+			role = heuristicRole(f)
+		}
+		if role == arcclient.RoleDimension {
+			dims = append(dims, labelField(f))
+			continue
+		}
+		if !annotated {
+			f = nullStringAsValue(f)
+		}
+		values = append(values, f)
+		numeric = numeric && f.Type().Numeric()
+	}
+	if len(values) == 0 {
+		return roleLayout{frame: frame, table: true}, true
+	}
+
+	fields := make([]*data.Field, 0, len(frame.Fields))
+	fields = append(append(append(fields, frame.Fields[timeIdx]), dims...), values...)
+	out := data.NewFrame(frame.Name, fields...)
+	out.RefID, out.Meta = frame.RefID, frame.Meta
+	return roleLayout{frame: out, dims: len(dims), pivot: len(dims) > 0 && numeric}, true
+}
+
+// heuristicRole is the role shapeFrames' type heuristics give a column Arc
+// didn't annotate: text and bools with a value name series.
+func heuristicRole(f *data.Field) arcclient.ColumnRole {
+	switch f.Type().NonNullableType() {
+	case data.FieldTypeString:
+		if hasValue(f) {
+			return arcclient.RoleDimension
+		}
+	case data.FieldTypeBool:
+		return arcclient.RoleDimension
+	}
+	return arcclient.RoleMeasure
+}
+
+// labelField returns f as a field LongToWide takes labels from: f itself
+// when it holds text or bools, else a string field of its values.
+func labelField(f *data.Field) *data.Field {
+	switch f.Type().NonNullableType() {
+	case data.FieldTypeString, data.FieldTypeBool:
+		return f
+	}
+	values := make([]*string, f.Len())
+	for i := range values {
+		if s, ok := fieldString(f, i); ok {
+			values[i] = &s
+		}
+	}
+	label := data.NewField(f.Name, f.Labels, values)
+	label.Config = f.Config
+	return label
+}
+
+// fieldString returns f's value at i as text, times in RFC 3339; ok is
+// false for a null.
+func fieldString(f *data.Field, i int) (string, bool) {
+	v, ok := f.ConcreteAt(i)
+	if !ok {
+		return "", false
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano), true
+	}
+	return fmt.Sprint(v), true
+}
+
+// shapeByRoles is shapeFrames' time series conversion for a frame laid out
+// by its column roles.
+func shapeByRoles(layout roleLayout) data.Frames {
+	frame := layout.frame
+	switch {
+	case layout.table:
+		frame.Meta.Type = data.FrameTypeTable
+		frame.Meta.PreferredVisualization = data.VisTypeTable
+	case layout.dims == 0:
+		frame.Meta.Type = data.FrameTypeTimeSeriesWide
+	case !layout.pivot:
+		// LongToWide would take text or bool measures for labels, so the
+		// series stay long; Grafana's panels accept that too.
+		frame = ensureAscendingTimes(frame, 0)
+		frame.Meta.Type = data.FrameTypeTimeSeriesLong
+	default:
+		long := ensureAscendingTimes(frame, 0)
+		wide, err := data.LongToWide(long, nil)
+		if err != nil {
+			log.DefaultLogger.Warn("LongToWide conversion failed, returning long format", "error", err)
+			long.Meta.Type = data.FrameTypeTimeSeriesLong
+			noticeShapeFallback(long, "wide", err)
+			return data.Frames{long}
+		}
+		if wide.Meta == nil {
+			wide.Meta = &data.FrameMeta{}
+		}
+		wide.Meta.Type = data.FrameTypeTimeSeriesWide
+		wide.Meta.PreferredVisualization = data.VisTypeGraph
+		frame = wide
+	}
+	return data.Frames{frame}
+}
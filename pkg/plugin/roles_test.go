@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+)
+
+// rolesFrame decodes a JSON answer with columns, rows and, unless meta is
+// empty, a columnMeta array.
+func rolesFrame(t *testing.T, columns, meta, rows string) *data.Frame {
+	t.Helper()
+	body := `{"columns": ` + columns + `, "data": ` + rows
+	if meta != "" {
+		body += `, "columnMeta": ` + meta
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(body+"}"), &result); err != nil {
+		t.Fatal(err)
+	}
+	frame, _, err := arcclient.FrameFromJSON(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	return frame
+}
+
+// seriesShape describes a shaped frame for comparison: its type, then each
+// field as name{labels}:type.
+func seriesShape(frame *data.Frame) string {
+	parts := []string{string(frame.Meta.Type)}
+	for _, f := range frame.Fields {
+		name := f.Name
+		if len(f.Labels) > 0 {
+			name += "{" + f.Labels.String() + "}"
+		}
+		parts = append(parts, name+":"+f.Type().ItemTypeString())
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestShapeFrames_ColumnRoles(t *testing.T) {
+	const rows = `[["2026-01-01T00:00:00Z", "2025-06-01T00:00:00Z", "a", 7, "ok", 1.5],
+		["2026-01-01T00:01:00Z", "2025-06-01T00:00:00Z", "b", 8, "down", 2.5]]`
+	const columns = `["created", "time", "host", "host_id", "state", "value"]`
+	cases := []struct {
+		name    string
+		meta    string
+		columns string
+		rows    string
+		want    string
+	}{
+		{
+			// created comes first, so the heuristics take it for the time.
+			name: "no metadata: heuristics",
+			want: "timeseries-wide created:time.Time host_id{host=a, state=ok}:*float64 host_id{host=b, state=down}:*float64 time{host=a, state=ok}:*time.Time time{host=b, state=down}:*time.Time value{host=a, state=ok}:*float64 value{host=b, state=down}:*float64",
+		},
+		{
+			name: "metadata picks the time field and the labels",
+			meta: `[{"name": "created", "role": "measure"}, {"name": "time", "role": "timestamp"}, {"name": "host", "role": "dimension"},
+				{"name": "host_id", "role": "dimension"}, {"name": "state", "role": "dimension"}, {"name": "value", "role": "measure"}]`,
+			want: "timeseries-long time:*time.Time host:*string host_id:*string state:*string created:*time.Time value:*float64",
+		},
+		{
+			name:    "a numeric dimension is a label",
+			columns: `["time", "host_id", "value"]`,
+			rows:    `[["2026-01-01T00:00:00Z", 7, 1.5], ["2026-01-01T00:00:00Z", 8, 2.5]]`,
+			meta:    `["timestamp", "dimension", "measure"]`,
+			want:    "timeseries-wide time:time.Time value{host_id=7}:*float64 value{host_id=8}:*float64",
+		},
+		{
+			name:    "a text measure is a value",
+			columns: `["time", "state", "value"]`,
+			rows:    `[["2026-01-01T00:00:00Z", "ok", 1.5]]`,
+			meta:    `["timestamp", "measure", "measure"]`,
+			want:    "timeseries-wide time:*time.Time state:*string value:*float64",
+		},
+		{
+			name:    "unannotated columns keep the heuristics",
+			columns: `["time", "host", "value"]`,
+			rows:    `[["2026-01-01T00:00:00Z", "a", 1.5]]`,
+			meta:    `[{"name": "time", "role": "timestamp"}]`,
+			want:    "timeseries-wide time:time.Time value{host=a}:*float64",
+		},
+		{
+			name:    "no timestamp column is a table",
+			columns: `["time", "host", "value"]`,
+			rows:    `[["2026-01-01T00:00:00Z", "a", 1.5]]`,
+			meta:    `["dimension", "dimension", "measure"]`,
+			want:    "table time:*time.Time host:*string value:*float64",
+		},
+		{
+			name:    "a timestamp that isn't a time field falls back",
+			columns: `["ts", "time", "host", "value"]`,
+			rows:    `[[1767225600, "2026-01-01T00:00:00Z", "a", 1.5]]`,
+			meta:    `["timestamp", "measure", "dimension", "measure"]`,
+			want:    "timeseries-wide time:time.Time ts{host=a}:*float64 value{host=a}:*float64",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cols, rs := columns, rows
+			if c.columns != "" {
+				cols, rs = c.columns, c.rows
+			}
+			frames := shapeFrames(rolesFrame(t, cols, c.meta, rs), ArcQuery{Format: "time_series"})
+			if len(frames) != 1 {
+				t.Fatalf("got %d frames", len(frames))
+			}
+			if got := seriesShape(frames[0]); got != c.want {
+				t.Errorf("shape:\n got %s\nwant %s", got, c.want)
+			}
+		})
+	}
+}
+
+// TestShapeFrames_ColumnRolesTableFormat: an explicit table format is
+// left alone; roles only replace the time series guessing.
+func TestShapeFrames_ColumnRolesTableFormat(t *testing.T) {
+	frame := rolesFrame(t, `["host", "time", "value"]`, `["dimension", "timestamp", "measure"]`, `[["a", "2026-01-01T00:00:00Z", 1.5]]`)
+	frames := shapeFrames(frame, ArcQuery{Format: "table"})
+	if got, want := seriesShape(frames[0]), "table host:*string time:*time.Time value:*float64"; got != want {
+		t.Errorf("shape = %s, want %s", got, want)
+	}
+}
+
+// TestReviewLongToWide_ColumnRoles: strict mode counts the rows a pivot
+// collapses by the dimensions Arc names, not by the text columns.
+func TestReviewLongToWide_ColumnRoles(t *testing.T) {
+	const rows = `[["2026-01-01T00:00:00Z", "a", 1, 1.5], ["2026-01-01T00:00:00Z", "a", 2, 2.5]]`
+	strict := dataPolicy{strict: true}
+	qm := ArcQuery{Format: "time_series"}
+
+	plain := rolesFrame(t, `["time", "host", "host_id", "value"]`, "", rows)
+	if err := strict.reviewLongToWide(plain, qm); !errors.Is(err, errStrictMode) {
+		t.Errorf("heuristics: err = %v, want the duplicate host rows refused", err)
+	}
+	annotated := rolesFrame(t, `["time", "host", "host_id", "value"]`, `["timestamp", "dimension", "dimension", "measure"]`, rows)
+	if err := strict.reviewLongToWide(annotated, qm); err != nil {
+		t.Errorf("roles: err = %v, want none: host_id tells the rows apart", err)
+	}
+}
+
+func TestQuery_ColumnRoles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns": ["sensor", "time", "reading"],
+			"columnMeta": [{"name": "sensor", "role": "dimension"}, {"name": "time", "role": "timestamp"}, {"name": "reading", "role": "measure"}],
+			"data": [[3, "2026-01-01T00:01:00Z", 2.5], [3, "2026-01-01T00:00:00Z", 1.5], [4, "2026-01-01T00:00:00Z", 9]]}`))
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: testPluginContext(t, srv.URL, map[string]any{"useArrow": false}),
+		Queries: []backend.DataQuery{{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)},
+			JSON:      []byte(`{"sql": "SELECT sensor, time, reading FROM t", "format": "time_series"}`),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	r := resp.Responses["A"]
+	if r.Error != nil || len(r.Frames) != 1 {
+		t.Fatalf("response: %v, %d frames", r.Error, len(r.Frames))
+	}
+	want := "timeseries-wide time:time.Time reading{sensor=3}:*float64 reading{sensor=4}:*float64"
+	if got := seriesShape(r.Frames[0]); got != want {
+		t.Errorf("shape:\n got %s\nwant %s", got, want)
+	}
+	if r.Frames[0].Rows() != 2 {
+		t.Errorf("rows = %d, want 2", r.Frames[0].Rows())
+	}
+}
@@ -0,0 +1,229 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Row limits. Several settings can put a LIMIT on a query; resolveRowLimit
+// is the one place that decides which applies, in this order:
+//
+//  1. the query's own LIMIT — nothing is appended, whatever else is set (a
+//     LIMIT inside a subquery or CTE doesn't count, see
+//     containsTopLevelLIMIT);
+//  2. the per-query rowLimit;
+//  3. the datasource's maxRows;
+//  4. the time-series row cap (TimeSeriesRowCap, or derived from
+//     maxDataPoints — see timeSeriesRowCap);
+//  5. for the queries 4 doesn't cover, the raw row cap (rawRowCap).
+//
+// A query from Explore (see exploreDefaults) gets the exploreMaxRows
+// preview cap in place of 3 to 5.
+//
+// maxDataPoints ≤ 0 means "no limit derived from the panel": exports and
+// report tooling that ask for everything get everything unless a rowLimit
+// or maxRows says otherwise. $__interval uses maxDataPoints only to coarsen
+// the panel interval (arcclient.ResolveInterval), and ≤ 0 leaves it as is.
+
+// Row limit sources, in precedence order after the query's own LIMIT.
+const (
+	rowLimitSourceQuery      = "rowLimit"
+	rowLimitSourceExplore    = "exploreMaxRows"
+	rowLimitSourceMaxRows    = "maxRows"
+	rowLimitSourceTimeSeries = "timeSeriesRowCap"
+	rowLimitSourceRaw        = "rawRowCap"
+)
+
+// rowLimit is a resolved row limit: Limit rows (0 = none) and the setting
+// it came from.
+type rowLimit struct {
+	Limit  int64
+	Source string
+}
+
+// resolveRowLimit returns the row limit for qm (see above). maxDataPoints
+// is the request's value, falling back to qm's when zero.
+func (s *ArcInstanceSettings) resolveRowLimit(qm ArcQuery, stripped strippedSQL, maxDataPoints int64) rowLimit {
+	switch {
+	case containsTopLevelLIMIT(stripped):
+		return rowLimit{}
+	case qm.RowLimit > 0:
+		return rowLimit{Limit: qm.RowLimit, Source: rowLimitSourceQuery}
+	case qm.fromExplore() && s.exploreMaxRows > 0:
+		return rowLimit{Limit: s.exploreMaxRows, Source: rowLimitSourceExplore}
+	case qm.fromExplore():
+		return rowLimit{}
+	case s.settings.MaxRows > 0:
+		return rowLimit{Limit: s.settings.MaxRows, Source: rowLimitSourceMaxRows}
+	}
+	if tsCap := s.timeSeriesRowCap(qm, stripped, maxDataPoints); tsCap > 0 {
+		return rowLimit{Limit: tsCap, Source: rowLimitSourceTimeSeries}
+	}
+	if rawCap := s.rawRowCap(qm, stripped, maxDataPoints); rawCap > 0 {
+		return rowLimit{Limit: rawCap, Source: rowLimitSourceRaw}
+	}
+	return rowLimit{}
+}
+
+// DefaultRawRowCap is the rawRowCap used when the setting is unset.
+const DefaultRawRowCap = 1000000
+
+// resolveRawRowCap resolves the rawRowCap setting: 0 is DefaultRawRowCap,
+// negative turns the cap off (0 here).
+func resolveRawRowCap(n int64) int64 {
+	switch {
+	case n == 0:
+		return DefaultRawRowCap
+	case n < 0:
+		return 0
+	}
+	return n
+}
+
+// rawRowCap returns the LIMIT for a table or raw (no $__timeGroup) query —
+// the ones timeSeriesRowCap reads as "I want the rows" — or 0 when none
+// applies. It is maxDataPoints × the estimated series count, at most the
+// RawRowCap setting (DefaultRawRowCap when unset, off when negative). Like
+// the time-series cap, it derives nothing when maxDataPoints ≤ 0.
+func (s *ArcInstanceSettings) rawRowCap(qm ArcQuery, stripped strippedSQL, maxDataPoints int64) int64 {
+	configured := resolveRawRowCap(s.settings.RawRowCap)
+	if configured <= 0 || containsTopLevelLIMIT(stripped) {
+		return 0
+	}
+	table := qm.Format == "table" || qm.Format == "numeric_table"
+	if !table && strings.Contains(stripped.stripped, "$__timeGroup") {
+		return 0
+	}
+	if maxDataPoints == 0 {
+		maxDataPoints = qm.MaxDataPoints
+	}
+	derived := saturatingMul(maxDataPoints, estimateSeriesFactor(stripped))
+	if derived <= 0 {
+		return 0
+	}
+	return min(derived, configured)
+}
+
+// budget reports whether l is a budget for the whole query, derived from
+// maxDataPoints, rather than a row count the user asked for.
+func (l rowLimit) budget() bool {
+	return l.Source == rowLimitSourceTimeSeries || l.Source == rowLimitSourceRaw
+}
+
+// chunkLimit is the LIMIT for each of n split chunks. The time-series and
+// raw caps are budgets for the whole query, so each chunk gets an even
+// share and N chunks can't return N×cap rows. rowLimit, maxRows and
+// exploreMaxRows promise up to Limit rows, so each chunk may return all of
+// them and the merged result is cut back to Limit (truncateRows).
+func (l rowLimit) chunkLimit(n int) int64 {
+	if l.Limit <= 0 || n <= 0 {
+		return 0
+	}
+	if l.budget() {
+		return (l.Limit + int64(n) - 1) / int64(n)
+	}
+	return l.Limit
+}
+
+// modification describes a result the limit cut short, for the instance's
+// dataPolicy; detail describes the LIMIT that was sent ("500 rows", "50
+// rows per chunk across 10 chunks").
+func (l rowLimit) modification(detail string) modification {
+	m := modification{Kind: modTruncation}
+	if l.Source == rowLimitSourceTimeSeries {
+		m.Detail = rowCapDetail(detail)
+		return m
+	}
+	setting := "the query's Row Limit"
+	switch l.Source {
+	case rowLimitSourceMaxRows:
+		setting = "the datasource's Max Rows setting"
+	case rowLimitSourceExplore:
+		setting = "the datasource's Explore Max Rows setting"
+	case rowLimitSourceRaw:
+		setting = "the datasource's Raw Row Cap (the panel's max data points × the estimated series)"
+	}
+	m.Detail = fmt.Sprintf("Result truncated at %d rows by %s (%s). Add an explicit LIMIT to the query to override it.", l.Limit, setting, detail)
+	return m
+}
+
+// rowLimitDecision describes l, as resolveRowLimit returned it for qm, for
+// the decisions meta (see decisions.go).
+func (s *ArcInstanceSettings) rowLimitDecision(qm ArcQuery, stripped strippedSQL, maxDataPoints int64, l rowLimit) decision {
+	if maxDataPoints == 0 {
+		maxDataPoints = qm.MaxDataPoints
+	}
+	d := decision{
+		Name:    decisionRowLimit,
+		Outcome: "none",
+		Inputs: map[string]any{
+			"maxDataPoints":    maxDataPoints,
+			"rowLimit":         qm.RowLimit,
+			"maxRows":          s.settings.MaxRows,
+			"exploreMaxRows":   s.exploreMaxRows,
+			"timeSeriesRowCap": s.settings.TimeSeriesRowCap,
+			"rawRowCap":        s.settings.RawRowCap,
+		},
+	}
+	if l.Limit > 0 {
+		d.Outcome = fmt.Sprintf("LIMIT %d", l.Limit)
+	}
+	// A table or raw query, which only the raw row cap covers.
+	raw := qm.Format == "table" || qm.Format == "numeric_table" || !strings.Contains(stripped.stripped, "$__timeGroup")
+	switch {
+	case containsTopLevelLIMIT(stripped):
+		d.Reason = "the query has its own LIMIT"
+	case l.Source == rowLimitSourceQuery:
+		d.Reason = "the query's rowLimit"
+	case l.Source == rowLimitSourceExplore:
+		d.Reason = "the datasource's exploreMaxRows: an Explore preview"
+	case qm.fromExplore():
+		d.Reason = "Explore previews aren't capped (exploreMaxRows is negative)"
+	case l.Source == rowLimitSourceMaxRows:
+		d.Reason = "the datasource's maxRows"
+	case l.Source == rowLimitSourceTimeSeries && s.settings.TimeSeriesRowCap > 0:
+		d.Reason = "the datasource's timeSeriesRowCap"
+	case l.Source == rowLimitSourceTimeSeries:
+		d.Reason = fmt.Sprintf("time-series row cap: maxDataPoints %d × %d rows per point × %d estimated series",
+			maxDataPoints, DefaultTimeSeriesRowsPerPoint, estimateSeriesFactor(stripped))
+	case l.Source == rowLimitSourceRaw:
+		d.Reason = fmt.Sprintf("raw row cap: maxDataPoints %d × %d estimated series, at most the datasource's rawRowCap %d",
+			maxDataPoints, estimateSeriesFactor(stripped), resolveRawRowCap(s.settings.RawRowCap))
+	case raw && resolveRawRowCap(s.settings.RawRowCap) == 0:
+		d.Reason = "the raw row cap is disabled"
+	case raw:
+		d.Reason = "maxDataPoints is 0 or too large to size the raw row cap from"
+	case s.settings.TimeSeriesRowCap < 0:
+		d.Reason = "the time-series row cap is disabled"
+	default:
+		d.Reason = "maxDataPoints is 0 or too large to size the time-series row cap from"
+	}
+	return d
+}
+
+// truncateRows cuts frame down to its first n rows.
+func truncateRows(frame *data.Frame, n int64) {
+	for i := int64(frame.Rows()) - 1; i >= n; i-- {
+		frame.DeleteRow(int(i))
+	}
+}
+
+// saturatingMul multiplies positive factors, returning 0 (no limit) when
+// the product would overflow int64: a maxDataPoints large enough to get
+// there is a request for everything.
+func saturatingMul(factors ...int64) int64 {
+	product := int64(1)
+	for _, f := range factors {
+		if f <= 0 {
+			return 0
+		}
+		if product > math.MaxInt64/f {
+			return 0
+		}
+		product *= f
+	}
+	return product
+}
@@ -0,0 +1,232 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// TestResolveRowLimit pins the precedence matrix: the query's own LIMIT >
+// rowLimit > maxRows > the time-series cap > the raw row cap, with
+// maxDataPoints ≤ 0 deriving no cap.
+func TestResolveRowLimit(t *testing.T) {
+	bucketed := "SELECT $__timeGroup(time, '1m') AS time, value FROM cpu WHERE $__timeFilter(time)"
+	raw := "SELECT time, value FROM cpu WHERE $__timeFilter(time)"
+	cases := []struct {
+		name     string
+		sql      string
+		rowLimit int64
+		maxRows  int64
+		tsCap    int64
+		mdp      int64
+		want     rowLimit
+	}{
+		{"query LIMIT beats everything", bucketed + " LIMIT 5", 10, 20, 30, 500, rowLimit{}},
+		{"rowLimit beats maxRows", bucketed, 10, 20, 30, 500, rowLimit{10, rowLimitSourceQuery}},
+		{"rowLimit above maxRows still wins", bucketed, 50, 20, 0, 500, rowLimit{50, rowLimitSourceQuery}},
+		{"maxRows beats the time-series cap", bucketed, 0, 20, 30, 500, rowLimit{20, rowLimitSourceMaxRows}},
+		{"maxRows applies to raw queries", raw, 0, 20, 0, 500, rowLimit{20, rowLimitSourceMaxRows}},
+		{"configured time-series cap", bucketed, 0, 0, 30, 500, rowLimit{30, rowLimitSourceTimeSeries}},
+		{"derived from maxDataPoints", bucketed, 0, 0, 0, 500, rowLimit{5000, rowLimitSourceTimeSeries}},
+		{"maxDataPoints 0: nothing derived", bucketed, 0, 0, 0, 0, rowLimit{}},
+		{"maxDataPoints negative: nothing derived", bucketed, 0, 0, 0, -1, rowLimit{}},
+		{"maxDataPoints 0 still honors maxRows", bucketed, 0, 20, 0, 0, rowLimit{20, rowLimitSourceMaxRows}},
+		{"huge maxDataPoints: no cap instead of overflow", bucketed, 0, 0, 0, math.MaxInt64 / 2, rowLimit{}},
+		{"raw query: the raw row cap", raw, 0, 0, 0, 500, rowLimit{500, rowLimitSourceRaw}},
+		{"raw query, maxDataPoints 0: nothing derived", raw, 0, 0, 0, 0, rowLimit{}},
+		{"subquery LIMIT doesn't count", "SELECT * FROM (" + raw + " LIMIT 5) s", 0, 20, 0, 500, rowLimit{20, rowLimitSourceMaxRows}},
+		{"CTE LIMIT doesn't count", "WITH b AS (" + bucketed + " LIMIT 5) SELECT * FROM b", 0, 0, 30, 500, rowLimit{30, rowLimitSourceTimeSeries}},
+		{"LIMIT after a newline counts", bucketed + "\nLIMIT\n5", 10, 20, 30, 500, rowLimit{}},
+	}
+	inst := newTestInstance(t, "http://127.0.0.1:1")
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inst.settings.MaxRows, inst.settings.TimeSeriesRowCap = c.maxRows, c.tsCap
+			qm := ArcQuery{SQL: c.sql, RowLimit: c.rowLimit}
+			if got := inst.resolveRowLimit(qm, newStrippedSQL(c.sql), c.mdp); got != c.want {
+				t.Errorf("resolveRowLimit = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRowLimit_ChunkLimit(t *testing.T) {
+	for _, c := range []struct {
+		limit rowLimit
+		n     int
+		want  int64
+	}{
+		{rowLimit{100, rowLimitSourceTimeSeries}, 3, 34},
+		{rowLimit{100, rowLimitSourceQuery}, 3, 100},
+		{rowLimit{100, rowLimitSourceMaxRows}, 3, 100},
+		{rowLimit{}, 3, 0},
+	} {
+		if got := c.limit.chunkLimit(c.n); got != c.want {
+			t.Errorf("%+v.chunkLimit(%d) = %d, want %d", c.limit, c.n, got, c.want)
+		}
+	}
+}
+
+// TestQuery_RowLimitSplitTruncates checks a split query under rowLimit sends
+// the full limit to every chunk and returns exactly rowLimit rows with a
+// notice naming the setting.
+func TestQuery_RowLimitSplitTruncates(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.SQL)
+		mu.Unlock()
+		rows := make([]interface{}, 4)
+		for i := range rows {
+			rows[i] = []interface{}{fmt.Sprintf("2025-01-01T00:0%d:00Z", i), float64(i)}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"time", "value"}, "data": rows})
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	inst.settings.MaxRows = 1000
+
+	now := time.Now()
+	resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: now.Add(-3 * time.Hour), To: now},
+		JSON:      []byte(`{"sql":"SELECT time, value FROM cpu WHERE $__timeFilter(time)","format":"table","splitDuration":"1h","rowLimit":6}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("query: %v", resp.Error)
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected a split query, got %d requests", len(seen))
+	}
+	for _, sql := range seen {
+		if !strings.HasSuffix(sql, "\nLIMIT 6") {
+			t.Errorf("every chunk should get the full rowLimit, got %q", sql)
+		}
+	}
+	frame := resp.Frames[0]
+	if frame.Rows() != 6 {
+		t.Errorf("expected the merged result cut to 6 rows, got %d", frame.Rows())
+	}
+	if notices := frame.Meta.Notices; len(notices) != 1 || !strings.Contains(notices[0].Text, "Row Limit") {
+		t.Errorf("expected one Row Limit notice, got %+v", notices)
+	}
+}
+
+// TestRawRowCap: table and raw queries get maxDataPoints × the estimated
+// series, at most rawRowCap (DefaultRawRowCap when unset), unless the
+// setting is off, maxDataPoints is ≤ 0 or the query has a LIMIT of its own.
+func TestRawRowCap(t *testing.T) {
+	raw := "SELECT * FROM big WHERE $__timeFilter(time)"
+	bucketed := "SELECT $__timeGroup(time, '1m') AS time, avg(v) FROM big WHERE $__timeFilter(time) GROUP BY 1"
+	grouped := "SELECT host, count(*) FROM big WHERE $__timeFilter(time) GROUP BY 1, host"
+	cases := []struct {
+		name   string
+		sql    string
+		format string
+		rawCap int64
+		mdp    int64
+		want   rowLimit
+	}{
+		{"off", raw, "table", -1, 500, rowLimit{}},
+		{"default setting", raw, "table", 0, 500, rowLimit{500, rowLimitSourceRaw}},
+		{"capped by the default", raw, "table", 0, DefaultRawRowCap + 1, rowLimit{DefaultRawRowCap, rowLimitSourceRaw}},
+		{"table query", raw, "table", 100000, 500, rowLimit{500, rowLimitSourceRaw}},
+		{"raw time series", raw, "time_series", 100000, 500, rowLimit{500, rowLimitSourceRaw}},
+		{"series factor", grouped, "table", 100000, 500, rowLimit{5000, rowLimitSourceRaw}},
+		{"capped by the setting", grouped, "table", 2000, 500, rowLimit{2000, rowLimitSourceRaw}},
+		{"maxDataPoints 0: nothing derived", raw, "table", 2000, 0, rowLimit{}},
+		{"maxDataPoints negative: nothing derived", raw, "table", 2000, -1, rowLimit{}},
+		{"own LIMIT", raw + " LIMIT 10", "table", 2000, 500, rowLimit{}},
+		{"OFFSET without LIMIT", raw + " OFFSET 20", "table", 2000, 500, rowLimit{500, rowLimitSourceRaw}},
+		{"bucketed time series: the time-series cap", bucketed, "time_series", 2000, 500, rowLimit{5000, rowLimitSourceTimeSeries}},
+		{"bucketed table", bucketed, "table", 2000, 500, rowLimit{500, rowLimitSourceRaw}},
+	}
+	inst := newTestInstance(t, "http://127.0.0.1:1")
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inst.settings.RawRowCap = c.rawCap
+			qm := ArcQuery{SQL: c.sql, Format: c.format}
+			if got := inst.resolveRowLimit(qm, newStrippedSQL(c.sql), c.mdp); got != c.want {
+				t.Errorf("resolveRowLimit = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+// TestQuery_RawRowCap checks the LIMIT sent for a table query without one,
+// after an OFFSET, and the notice when the result fills it.
+func TestQuery_RawRowCap(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = body.SQL
+		mu.Unlock()
+		rows := make([]interface{}, 3)
+		for i := range rows {
+			rows[i] = []interface{}{fmt.Sprintf("h%d", i), float64(i)}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"columns": []string{"host", "value"}, "data": rows})
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	useJSON := false
+	inst.settings.UseArrow = &useJSON
+	inst.settings.RawRowCap = 3
+	run := func(sql string) backend.DataResponse {
+		t.Helper()
+		resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+			RefID:         "A",
+			MaxDataPoints: 1000,
+			JSON:          []byte(`{"sql":"` + sql + `","format":"table"}`),
+		})
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		return resp
+	}
+
+	resp := run("SELECT host, value FROM big")
+	if !strings.HasSuffix(sent, "\nLIMIT 3") {
+		t.Errorf("sent %q, want LIMIT 3", sent)
+	}
+	if notices := resp.Frames[0].Meta.Notices; len(notices) != 1 || !strings.Contains(notices[0].Text, "Raw Row Cap") {
+		t.Errorf("expected one Raw Row Cap notice, got %+v", notices)
+	}
+
+	run("SELECT host, value FROM big ORDER BY host OFFSET 10")
+	if !strings.HasSuffix(sent, "OFFSET 10\nLIMIT 3") {
+		t.Errorf("sent %q, want LIMIT 3 after the OFFSET", sent)
+	}
+
+	resp = run("SELECT host, value FROM big LIMIT 3")
+	if strings.Count(sent, "LIMIT") != 1 {
+		t.Errorf("sent %q, want the query's own LIMIT only", sent)
+	}
+	if notices := resp.Frames[0].Meta.Notices; len(notices) != 0 {
+		t.Errorf("own LIMIT got notices %+v", notices)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
 
@@ -31,9 +33,14 @@ const MaxResponseMBCap = 8192
 // Higher values risk file-descriptor pressure and TLS-handshake storms against Arc.
 const MaxConcurrencyCap = 32
 
-// columnNameRe matches a SQL column or qualified column reference (table.col).
-// Used to validate macro arguments before interpolating them into SQL.
-var columnNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+// MaxSplitChunksCap is the upper bound on `MaxSplitChunks`: each chunk is an
+// HTTP request to Arc, and a split query past this many is a scan, not a
+// dashboard query.
+const MaxSplitChunksCap = 10000
+
+// MaxRetriesCap is the upper bound on `MaxRetries`: past a few retries a
+// failing Arc is down, not flaky, and the panel should say so.
+const MaxRetriesCap = 10
 
 // databaseNameRe matches a permitted Arc database name. Conservative on purpose —
 // the name flows into an HTTP header and into SQL identifier contexts.
@@ -43,24 +50,59 @@ var databaseNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
 // a private, loopback, or link-local address. Surfaces in errors.Is for callers.
 var errBlockedAddr = errors.New("destination address is not permitted")
 
-// validateColumnArg returns an error if name doesn't look like a safe SQL column
-// reference. Used by macro expanders before interpolating column arguments.
-func validateColumnArg(name string) error {
-	if !columnNameRe.MatchString(name) {
-		return fmt.Errorf("invalid column argument %q: must match %s", name, columnNameRe.String())
-	}
-	return nil
-}
+// errInvalidHeaderValue is returned for a setting or query field that would
+// reach a request header with a character that could split or smuggle
+// headers. The message names the field and the offending character (never
+// the whole value), so it is shown to the user verbatim.
+var errInvalidHeaderValue = errors.New("invalid header value")
 
 // validateDatabaseName returns an error if name contains characters that could
 // pollute the X-Arc-Database header or be misinterpreted as a SQL identifier.
 func validateDatabaseName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: database name is empty", errInvalidHeaderValue)
+	}
 	if !databaseNameRe.MatchString(name) {
-		return fmt.Errorf("invalid database name %q: must match %s", name, databaseNameRe.String())
+		i, r := firstRuneOutside(name, func(r rune) bool {
+			return r == '_' || r == '-' || (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')
+		})
+		return fmt.Errorf("%w: database name contains %s at byte %d (allowed: letters, digits, '_' and '-')",
+			errInvalidHeaderValue, describeRune(r), i)
+	}
+	return nil
+}
+
+// validateHeaderValue returns an error if value, bound for header, holds
+// anything but printable ASCII. Go's transport already refuses CR/LF, but
+// rejecting here fails before the request is built, with a message naming
+// the setting instead of an opaque transport error — and also refuses the
+// non-ASCII bytes proxies disagree about.
+func validateHeaderValue(header, value string) error {
+	if i, r := firstRuneOutside(value, func(r rune) bool { return r >= ' ' && r <= '~' }); i >= 0 {
+		return fmt.Errorf("%w: %s contains %s at byte %d (only printable ASCII is allowed)",
+			errInvalidHeaderValue, header, describeRune(r), i)
 	}
 	return nil
 }
 
+// firstRuneOutside returns the byte offset and rune of the first rune in s
+// that allowed rejects, or -1 when every rune is allowed. Invalid UTF-8
+// reads as utf8.RuneError.
+func firstRuneOutside(s string, allowed func(rune) bool) (int, rune) {
+	for i, r := range s {
+		if !allowed(r) {
+			return i, r
+		}
+	}
+	return -1, 0
+}
+
+// describeRune names r for an error message: quoted and escaped, plus its
+// code point, e.g. '\r' (U+000D).
+func describeRune(r rune) string {
+	return fmt.Sprintf("%q (U+%04X)", r, r)
+}
+
 // validateURL rejects URLs whose scheme is not http/https. Hostname-level
 // blocking happens at dial time via safeDialContext.
 func validateURL(raw string) error {
@@ -78,6 +120,30 @@ func validateURL(raw string) error {
 	return nil
 }
 
+// errInvalidURL marks a configured Arc URL validateArcURL rejected, so
+// CheckHealth can say the URL is the problem rather than the connection.
+var errInvalidURL = errors.New("invalid Arc URL")
+
+// validateArcURL is validateURL for the configured Arc URL, which request
+// paths are appended to: anything after the path — a query string, a
+// fragment, whitespace left from a paste — would end up in the middle of
+// every request URL.
+func validateArcURL(raw string) error {
+	if err := validateURL(raw); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidURL, err)
+	}
+	u, _ := url.Parse(raw)
+	switch {
+	case strings.ContainsAny(raw, " \t\r\n"):
+		return fmt.Errorf("%w: URL contains whitespace", errInvalidURL)
+	case u.RawQuery != "" || u.ForceQuery:
+		return fmt.Errorf("%w: URL must not have a query string", errInvalidURL)
+	case u.Fragment != "" || strings.Contains(raw, "#"):
+		return fmt.Errorf("%w: URL must not have a fragment", errInvalidURL)
+	}
+	return nil
+}
+
 // dialPolicy carries the two independent permissions the SSRF dialer respects:
 // loopback-only (for `http://localhost:8000` dev setups) and full private
 // access (the user-opt-in `AllowPrivateIPs` flag for corporate-intranet Arc
@@ -208,9 +274,20 @@ func isLoopbackURL(raw string) bool {
 //   - validates redirects against the same blocklist,
 //   - applies a request-level timeout.
 //
+// It is built by the SDK's httpclient from opts, the datasource's
+// HTTPClientOptions, so Grafana's side of the connection applies as for
+// any datasource: TLS settings, custom headers, forwarded cookies and
+// OAuth headers (ForwardHTTPHeaders), tracing, and the secure socks proxy
+// (Private Datacenter Connect). With the secure socks proxy enabled the SDK
+// replaces the dialer below with the proxy's: Arc is then reached from the
+// PDC agent's network, which is private by design, and the blocklist
+// doesn't apply. Environment proxies (HTTP_PROXY) stay unused, as before —
+// the blocklist would check the proxy's address instead of Arc's.
+//
 // One client is created per datasource instance (in newArcInstance) and
 // reused across every request — sharing the transport's connection pool and
-// TLS session cache. The policy carries TWO independent flags:
+// TLS session cache, with room in the pool for a dashboard's worth of
+// parallel requests to the one host. The policy carries TWO independent flags:
 //   - allowLoopback: configured URL is loopback (`localhost`/`127.0.0.1`)
 //     → loopback IPs are permitted on dial; RFC1918 stays blocked.
 //   - allowPrivate: admin opted in via AllowPrivateIPs (corporate intranet)
@@ -220,28 +297,44 @@ func isLoopbackURL(raw string) bool {
 // regardless. Previously these two were collapsed into one bool, which meant
 // a loopback URL would also open RFC1918 redirects (gemini round 5 finding
 // 3244943519).
-func newHTTPClient(timeout time.Duration, policy dialPolicy) *http.Client {
-	transport := &http.Transport{
-		DialContext:           safeDialContext(policy),
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		ForceAttemptHTTP2:     true,
+//
+// authHeader is the header the API key is sent in. Go drops Authorization
+// from a redirect to another host by itself, but not a custom header such
+// as X-API-Key, so CheckRedirect drops that one too.
+func newHTTPClient(opts httpclient.Options, timeout time.Duration, policy dialPolicy, authHeader string) (*http.Client, error) {
+	timeouts := httpclient.DefaultTimeoutOptions
+	if opts.Timeouts != nil {
+		timeouts = *opts.Timeouts
 	}
-	return &http.Client{
-		Timeout:   timeout,
-		Transport: transport,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+	timeouts.Timeout = timeout
+	timeouts.MaxIdleConnsPerHost = 100 // every request goes to the one Arc host; the default of 2 redials after each burst of chunks and panels
+	opts.Timeouts = &timeouts
+	opts.ForwardHTTPHeaders = true
+	opts.ConfigureTransport = func(_ httpclient.Options, transport *http.Transport) {
+		transport.DialContext = safeDialContext(policy)
+		transport.Proxy = nil
+		transport.ForceAttemptHTTP2 = true
+	}
+	opts.ConfigureClient = func(_ httpclient.Options, client *http.Client) {
+		client.Timeout = timeout
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 			if len(via) >= 10 {
 				return errors.New("stopped after 10 redirects")
 			}
 			if err := validateURL(req.URL.String()); err != nil {
 				return err
 			}
+			if req.URL.Host != via[0].URL.Host {
+				req.Header.Del(authHeader)
+			}
 			return nil
-		},
+		}
 	}
+	client, err := httpclient.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	return client, nil
 }
 
 // sanitizeUserError takes an internal error (which may contain server-side
@@ -265,9 +358,32 @@ func sanitizeUserError(refID string, err error) string {
 	// Typed-error matching first (preferred). String contains is a fallback
 	// for paths that don't have a typed sentinel yet.
 	var maxBytesErr *http.MaxBytesError
+	var cutoffErr *upstreamCutoffError
+	var respErr *arcclient.ResponseError
 	switch {
+	case errors.As(err, &cutoffErr):
+		return "Query failed: " + cutoffErr.hint() + "."
 	case errors.Is(err, errBlockedAddr):
 		return "Arc URL resolves to a blocked address (private/loopback). Update the datasource URL or enable 'Allow Private IPs'."
+	case errors.Is(err, errStreamStalled):
+		return "Arc stopped sending data mid-response (stream stalled). The query may be overloading Arc — try narrowing the time range or enabling query splitting."
+	case errors.Is(err, errMultiResultSplit):
+		return errMultiResultSplit.Error()
+	case errors.Is(err, errFeatureUnsupported), errors.Is(err, errTooManySeries), errors.Is(err, errUnexpectedContentType),
+		errors.Is(err, errNoFixture), errors.Is(err, errInvalidHeaderValue), errors.Is(err, errStrictMode),
+		errors.Is(err, errNotFound):
+		return msg
+	case errors.As(err, &respErr):
+		// DuckDB's message about the query is what its author needs to fix
+		// it; anything else Arc reported stays in the server log.
+		if respErr.SQLError() {
+			return respErr.Error()
+		}
+		return "Arc query failed (see server logs for detail)"
+	case errors.Is(err, errDataConversion):
+		// The wrapped detail quotes only the query's own data (column name,
+		// count, first bad value) — see errDataConversion.
+		return err.Error() + ". Disable \"Fail on Conversion Errors\" in the datasource settings to null these values instead."
 	case errors.As(err, &maxBytesErr):
 		// R2-CR7: the previous "exceeded the configured size limit" message
 		// didn't tell the user how to fix it. The cap is now per-datasource
@@ -2,11 +2,16 @@ package plugin
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
 
 func TestValidateColumnArg(t *testing.T) {
@@ -52,6 +57,7 @@ func TestValidateDatabaseName(t *testing.T) {
 		{"dot", "prod.db", true},
 		{"slash", "prod/db", true},
 		{"quote", "prod'db", true},
+		{"non-ascii", "prodé", true},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			err := validateDatabaseName(tc.input)
@@ -324,3 +330,97 @@ func TestIsLoopbackURL(t *testing.T) {
 		})
 	}
 }
+
+// headerInjectionCases are values that must never reach a request header:
+// CRLF/LF header splitting, a NUL, and non-ASCII bytes proxies disagree on.
+var headerInjectionCases = []struct {
+	name, value, char string
+}{
+	{"crlf", "prod\r\nX-Injected: 1", `'\r' (U+000D)`},
+	{"lf", "prod\nX-Injected: 1", `'\n' (U+000A)`},
+	{"nul", "prod\x00", `'\x00' (U+0000)`},
+	{"non-ascii", "prodé", `'é' (U+00E9)`},
+}
+
+// TestHeaderInjection walks every path that puts a settings or query-model
+// value into a request header — datasource database, API key, per-query
+// database override, the /schema override and doRequest itself — and checks
+// each rejects the value before any request is sent, naming the character.
+func TestHeaderInjection(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["n"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	for _, tc := range headerInjectionCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hits.Store(0)
+			checkErr := func(path string, err error) {
+				t.Helper()
+				if !errors.Is(err, errInvalidHeaderValue) {
+					t.Fatalf("%s: expected errInvalidHeaderValue, got %v", path, err)
+				}
+				if msg := sanitizeUserError("A", err); !strings.Contains(msg, tc.char) {
+					t.Errorf("%s: user message %q should name %s", path, msg, tc.char)
+				}
+			}
+
+			jsonData, _ := jsonMarshal(map[string]any{"url": "https://arc.example.com", "database": tc.value})
+			_, err := newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+				JSONData:                jsonData,
+				DecryptedSecureJSONData: map[string]string{"apiKey": "k"},
+			})
+			checkErr("datasource database", err)
+
+			jsonData, _ = jsonMarshal(map[string]any{"url": "https://arc.example.com"})
+			_, err = newArcInstance(t.Context(), backend.DataSourceInstanceSettings{
+				JSONData:                jsonData,
+				DecryptedSecureJSONData: map[string]string{"apiKey": "k" + tc.value},
+			})
+			checkErr("API key", err)
+
+			inst := newTestInstance(t, srv.URL)
+			inst.settings.AllowDatabaseOverride = true
+			q, _ := jsonMarshal(map[string]any{"sql": "SELECT 1", "database": tc.value})
+			resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{RefID: "A", JSON: q})
+			if resp.Status != backend.StatusBadRequest || resp.Error == nil || !strings.Contains(resp.Error.Error(), tc.char) {
+				t.Errorf("query override: status=%v error=%v, want 400 naming %s", resp.Status, resp.Error, tc.char)
+			}
+
+			d := NewArcDatasource()
+			status, body := callResource(t, d, testPluginContext(t, srv.URL, map[string]any{"allowDatabaseOverride": true}),
+				http.MethodPost, "/schema", map[string]any{"sql": "SELECT 1", "database": tc.value})
+			var envelope struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(body, &envelope)
+			if status != http.StatusBadRequest || !strings.Contains(envelope.Error, tc.char) {
+				t.Errorf("/schema override: status=%d body=%s, want 400 naming %s", status, body, tc.char)
+			}
+
+			bypass := newTestInstance(t, srv.URL)
+			bypass.settings.Database = tc.value
+			_, err = bypass.doRequest(t.Context(), "/api/v1/query", jsonMediaType, map[string]string{"sql": "SELECT 1"})
+			checkErr("doRequest", err)
+
+			if n := hits.Load(); n != 0 {
+				t.Errorf("%d request(s) reached Arc with an injected header value", n)
+			}
+		})
+	}
+}
+
+func TestValidateHeaderValue(t *testing.T) {
+	if err := validateHeaderValue("API key", "arc_0123-ABC.xyz~ +/="); err != nil {
+		t.Errorf("printable ASCII rejected: %v", err)
+	}
+	for _, tc := range headerInjectionCases {
+		err := validateHeaderValue("API key", tc.value)
+		if err == nil || !strings.Contains(err.Error(), "API key contains "+tc.char) {
+			t.Errorf("%s: got %v, want an error naming %s", tc.name, err, tc.char)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Overflow actions for ArcQuery.MaxSeries.
+const (
+	overflowTruncate       = "truncate"
+	overflowError          = "error"
+	overflowAggregateOther = "aggregateOther"
+)
+
+// otherSeriesName names the series overflowAggregateOther folds the excess
+// into.
+const otherSeriesName = "Other"
+
+// errTooManySeries is returned by applySeriesCap with overflowAction
+// "error". The wrapped message only carries counts, so it is shown to the
+// user verbatim.
+var errTooManySeries = errors.New("too many series")
+
+// errInvalidSeriesCap rejects a negative maxSeries or an unknown
+// overflowAction up front rather than silently truncating.
+var errInvalidSeriesCap = errors.New("invalid series cap")
+
+// validateSeriesCap checks the query's series-cap options.
+func validateSeriesCap(qm ArcQuery) error {
+	if qm.MaxSeries < 0 {
+		return fmt.Errorf("%w: maxSeries must be >= 0, got %d", errInvalidSeriesCap, qm.MaxSeries)
+	}
+	switch qm.OverflowAction {
+	case "", overflowTruncate, overflowError, overflowAggregateOther:
+		return nil
+	}
+	return fmt.Errorf("%w: overflowAction %q (expected %q, %q or %q)",
+		errInvalidSeriesCap, qm.OverflowAction, overflowError, overflowTruncate, overflowAggregateOther)
+}
+
+// applySeriesCap enforces the per-query maxSeries limit on the final,
+// prepared frames — after long-to-wide conversion, so it counts what the
+// browser would actually render. It exists for shared dashboards where a
+// viewer can flip a variable and turn 10 series into 50,000.
+//
+// A series is a value field of a wide time-series frame (every non-time
+// field). Table and numeric_table results are row-shaped — more rows, not
+// more fields — and pass through untouched; the row caps cover those.
+//
+// Series are kept in their existing field order, which is deterministic
+// since ensureAscendingTimes became stable, so "the first N" names the same
+// series on every refresh. With overflowAggregateOther the first N-1 are
+// kept and the rest are summed into one "Other" series, keeping the total
+// at N. Either way the policy is consulted first (see dataPolicy), and the
+// cap is recorded as a decision on ctx (see decisions.go).
+func applySeriesCap(ctx context.Context, frames data.Frames, qm ArcQuery, policy dataPolicy) (data.Frames, error) {
+	if qm.MaxSeries <= 0 {
+		return frames, nil
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil || frame.Meta.Type != data.FrameTypeTimeSeriesWide {
+			continue
+		}
+		var timeFields, series []*data.Field
+		for _, f := range frame.Fields {
+			if f.Type().Time() {
+				timeFields = append(timeFields, f)
+			} else {
+				series = append(series, f)
+			}
+		}
+		if len(series) <= qm.MaxSeries {
+			continue
+		}
+
+		var kept []*data.Field
+		var notice string
+		action := qm.OverflowAction
+		if action == "" {
+			action = overflowTruncate
+		}
+		capped := decision{
+			Name:   decisionSeriesCap,
+			Reason: fmt.Sprintf("%d series exceed maxSeries %d", len(series), qm.MaxSeries),
+			Inputs: map[string]any{"maxSeries": qm.MaxSeries, "series": len(series), "overflowAction": action},
+		}
+		switch qm.OverflowAction {
+		case overflowError:
+			capped.Outcome = "error"
+			recordDecision(ctx, capped)
+			return nil, fmt.Errorf("%w: the query returned %d series, more than maxSeries (%d). Narrow the query or template variables, or raise maxSeries",
+				errTooManySeries, len(series), qm.MaxSeries)
+		case overflowAggregateOther:
+			kept = append(series[:qm.MaxSeries-1:qm.MaxSeries-1], sumSeries(series[qm.MaxSeries-1:], frame.Rows()))
+			notice = fmt.Sprintf("Showing %d of %d series; the remaining %d are summed into %q (maxSeries = %d).",
+				qm.MaxSeries-1, len(series), len(series)-qm.MaxSeries+1, otherSeriesName, qm.MaxSeries)
+			capped.Outcome = fmt.Sprintf("kept %d series, summed %d into %q", qm.MaxSeries-1, len(series)-qm.MaxSeries+1, otherSeriesName)
+		default:
+			kept = series[:qm.MaxSeries]
+			notice = fmt.Sprintf("Showing the first %d of %d series; %d dropped (maxSeries = %d).",
+				qm.MaxSeries, len(series), len(series)-qm.MaxSeries, qm.MaxSeries)
+			capped.Outcome = fmt.Sprintf("kept the first %d series, dropped %d", qm.MaxSeries, len(series)-qm.MaxSeries)
+		}
+		recordDecision(ctx, capped)
+		if err := policy.allow(frame, modification{Kind: modSeriesCap, Detail: notice}); err != nil {
+			return nil, err
+		}
+		frame.Fields = append(timeFields, kept...)
+	}
+	return frames, nil
+}
+
+// sumSeries adds the numeric fields row by row into one nullable float64
+// field. Null/NaN cells are skipped; a row where every input is null stays
+// null. Non-numeric fields can't be summed and are dropped.
+func sumSeries(fields []*data.Field, rows int) *data.Field {
+	values := make([]*float64, rows)
+	for _, f := range fields {
+		if !f.Type().Numeric() {
+			continue
+		}
+		for i := 0; i < rows; i++ {
+			v, err := f.FloatAt(i)
+			if err != nil || math.IsNaN(v) {
+				continue
+			}
+			if values[i] == nil {
+				values[i] = new(float64)
+			}
+			*values[i] += v
+		}
+	}
+	return data.NewField(otherSeriesName, nil, values)
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// wideSeriesFrame builds a wide time-series frame with two rows and one
+// float64 series per name, series i holding values (i, i*10).
+func wideSeriesFrame(names ...string) data.Frames {
+	t0 := time.Unix(0, 0)
+	fields := []*data.Field{data.NewField("time", nil, []time.Time{t0, t0.Add(time.Minute)})}
+	for i, name := range names {
+		a, b := float64(i+1), float64((i+1)*10)
+		fields = append(fields, data.NewField(name, data.Labels{"host": name}, []*float64{&a, &b}))
+	}
+	frame := data.NewFrame("A", fields...)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesWide}
+	return data.Frames{frame}
+}
+
+func fieldNames(frame *data.Frame) []string {
+	names := make([]string, len(frame.Fields))
+	for i, f := range frame.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func TestApplySeriesCap_Truncate(t *testing.T) {
+	frames, err := applySeriesCap(t.Context(), wideSeriesFrame("a", "b", "c", "d"), ArcQuery{MaxSeries: 2}, dataPolicy{})
+	if err != nil {
+		t.Fatalf("applySeriesCap: %v", err)
+	}
+	if got := fieldNames(frames[0]); len(got) != 3 || got[1] != "a" || got[2] != "b" {
+		t.Errorf("expected time + first two series, got %v", got)
+	}
+	if n := frames[0].Meta.Notices; len(n) != 1 || n[0].Text != "Showing the first 2 of 4 series; 2 dropped (maxSeries = 2)." {
+		t.Errorf("unexpected notices: %+v", n)
+	}
+}
+
+func TestApplySeriesCap_AggregateOther(t *testing.T) {
+	frames, err := applySeriesCap(t.Context(), wideSeriesFrame("a", "b", "c", "d"), ArcQuery{MaxSeries: 2, OverflowAction: overflowAggregateOther}, dataPolicy{})
+	if err != nil {
+		t.Fatalf("applySeriesCap: %v", err)
+	}
+	got := fieldNames(frames[0])
+	if len(got) != 3 || got[1] != "a" || got[2] != otherSeriesName {
+		t.Fatalf("expected time, a, Other; got %v", got)
+	}
+	other := frames[0].Fields[2]
+	// b+c+d = 2+3+4 and 20+30+40.
+	if v, _ := other.FloatAt(0); v != 9 {
+		t.Errorf("Other row 0 = %v, want 9", v)
+	}
+	if v, _ := other.FloatAt(1); v != 90 {
+		t.Errorf("Other row 1 = %v, want 90", v)
+	}
+}
+
+func TestApplySeriesCap_ErrorAndPassThrough(t *testing.T) {
+	_, err := applySeriesCap(t.Context(), wideSeriesFrame("a", "b", "c"), ArcQuery{MaxSeries: 2, OverflowAction: overflowError}, dataPolicy{})
+	if !errors.Is(err, errTooManySeries) {
+		t.Errorf("expected errTooManySeries, got %v", err)
+	}
+
+	// Under the cap, unlimited, and non-wide frames are untouched.
+	for _, c := range []struct {
+		name   string
+		frames data.Frames
+		qm     ArcQuery
+	}{
+		{"under-cap", wideSeriesFrame("a", "b"), ArcQuery{MaxSeries: 2, OverflowAction: overflowError}},
+		{"unlimited", wideSeriesFrame("a", "b", "c"), ArcQuery{OverflowAction: overflowError}},
+		{"table", func() data.Frames {
+			f := wideSeriesFrame("a", "b", "c")
+			f[0].Meta.Type = data.FrameTypeTable
+			return f
+		}(), ArcQuery{MaxSeries: 1, OverflowAction: overflowError}},
+	} {
+		before := len(c.frames[0].Fields)
+		frames, err := applySeriesCap(t.Context(), c.frames, c.qm, dataPolicy{})
+		if err != nil || len(frames[0].Fields) != before {
+			t.Errorf("%s: expected pass-through, got err=%v fields=%d", c.name, err, len(frames[0].Fields))
+		}
+	}
+}
+
+func TestValidateSeriesCap(t *testing.T) {
+	for _, qm := range []ArcQuery{{MaxSeries: -1}, {MaxSeries: 5, OverflowAction: "drop"}} {
+		if err := validateSeriesCap(qm); !errors.Is(err, errInvalidSeriesCap) {
+			t.Errorf("validateSeriesCap(%+v) = %v, want errInvalidSeriesCap", qm, err)
+		}
+	}
+	if err := validateSeriesCap(ArcQuery{MaxSeries: 5, OverflowAction: overflowAggregateOther}); err != nil {
+		t.Errorf("valid options rejected: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+)
+
+// Settings schema. JSONData carries a schemaVersion (absent = 0); when a
+// release renames or restructures a setting it appends a settingsMigration
+// that upgrades the previous shape, which moves the current version up by
+// one. newArcInstance runs the pending migrations on the stored JSONData in
+// memory before decoding it, so a datasource saved by an older release
+// keeps working without being edited; the stored JSONData is left as it is
+// until someone saves the datasource. The config editor must then write
+// the new shape and stamp the new schemaVersion along with it.
+//
+// Which migrations ran is logged once per instance (an instance lives for
+// one settings revision) and admins can read the settings the plugin ended
+// up with from GET /settings/effective (see handleEffectiveSettings).
+
+// settingsMigration upgrades JSONData from one schema version to the next.
+type settingsMigration struct {
+	name    string // for the log and /settings/effective, e.g. "split timeout into connect and read timeouts"
+	migrate func(jsonData map[string]any) error
+}
+
+// settingsMigrations[i] upgrades schema version i to i+1, so the current
+// schemaVersion is len(settingsMigrations). None yet: version 0 is the
+// shape every release so far has written.
+var settingsMigrations []settingsMigration
+
+// migrateSettings upgrades jsonData to the last version migrations know,
+// returning the migrated JSONData and the names of the migrations it ran.
+// JSONData already at that version comes back unchanged; JSONData from a
+// newer release is an error rather than being read in a shape this release
+// doesn't understand.
+func migrateSettings(jsonData []byte, migrations []settingsMigration) ([]byte, []string, error) {
+	if len(jsonData) == 0 {
+		return jsonData, nil, nil
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(jsonData, &raw); err != nil || raw == nil {
+		// Not an object: decoding the settings reports it.
+		return jsonData, nil, nil
+	}
+	version, err := settingsSchemaVersion(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case version > len(migrations):
+		return nil, nil, fmt.Errorf("settings schemaVersion %d is newer than this plugin version supports (%d): upgrade the plugin", version, len(migrations))
+	case version == len(migrations):
+		return jsonData, nil, nil
+	}
+	var applied []string
+	for i := version; i < len(migrations); i++ {
+		if err := migrations[i].migrate(raw); err != nil {
+			return nil, nil, fmt.Errorf("migrating settings from schemaVersion %d (%s): %w", i, migrations[i].name, err)
+		}
+		applied = append(applied, migrations[i].name)
+	}
+	raw["schemaVersion"] = len(migrations)
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("migrating settings: %w", err)
+	}
+	return migrated, applied, nil
+}
+
+// settingsSchemaVersion reads JSONData's schemaVersion: 0 when absent.
+func settingsSchemaVersion(raw map[string]any) (int, error) {
+	v, ok := raw["schemaVersion"]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != float64(int(n)) {
+		return 0, fmt.Errorf("invalid settings schemaVersion %v: expected a non-negative integer", v)
+	}
+	return int(n), nil
+}
+
+// effectiveSettings is the answer of GET /settings/effective.
+type effectiveSettings struct {
+	SchemaVersion int                   `json:"schemaVersion"`
+	Migrations    []string              `json:"migrations"` // applied to the stored JSONData, oldest first
+	Settings      ArcDataSourceSettings `json:"settings"`   // after migrations and defaults, secrets masked
+	Secrets       map[string]string     `json:"secrets"`    // secure field → "configured" (with the names, for credentials)
+}
+
+// effective returns s's settings as the plugin uses them, with the URL's
+// credentials and anything secret-looking in snippets masked. The API key
+// and named credentials are only reported as configured.
+func (s *ArcInstanceSettings) effective() effectiveSettings {
+	settings := s.settings
+	if u, err := url.Parse(settings.URL); err == nil && u.User != nil {
+		settings.URL = u.Redacted()
+	}
+	if len(settings.Snippets) > 0 {
+		masked := make(map[string]string, len(settings.Snippets))
+		for name, sql := range settings.Snippets {
+			masked[name] = scrubSecrets(sql)
+		}
+		settings.Snippets = masked
+	}
+	migrations := s.migrations
+	if migrations == nil {
+		migrations = []string{}
+	}
+	secrets := map[string]string{"apiKey": "configured"}
+	if s.apiKey == "" {
+		secrets["apiKey"] = "not set"
+	}
+	if len(s.credentials) > 0 {
+		secrets["credentials"] = "configured: " + strings.Join(s.credentialNames(), ", ")
+	}
+	return effectiveSettings{
+		SchemaVersion: len(settingsMigrations),
+		Migrations:    migrations,
+		Settings:      settings,
+		Secrets:       secrets,
+	}
+}
+
+// handleEffectiveSettings answers GET /settings/effective with the
+// instance's effective settings (see effective), for admins checking what
+// the plugin sees after migrations and defaults.
+func (d *ArcDatasource) handleEffectiveSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	user := httpadapter.PluginConfigFromContext(r.Context()).User
+	if user == nil || !strings.EqualFold(user.Role, "Admin") {
+		writeResourceError(w, http.StatusForbidden, "effective settings are only available to admins")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("settings", err))
+		return
+	}
+	writeResourceJSON(w, http.StatusOK, settings.effective())
+}
@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Slow queries (slowQueryThreshold setting): a statement Arc takes longer
+// than the threshold to answer is logged as "Slow Arc query" with its
+// duration and SQL (redacted, see redactSQL).
+//
+// With captureSlowQueryPlans the plugin also asks Arc for the statement's
+// plan: `EXPLAIN <sql>` runs in the background through the same instance —
+// API key, database override and all — after the query has answered, so
+// the panel never waits for it. Captures are rate-limited to one per
+// slowPlanInterval per datasource, and only single SELECT/WITH statements
+// are explained: meta statements (SHOW, DESCRIBE, SET, ...) and
+// multi-statement queries aren't. The newest slowPlanKeep plans stay in
+// memory; the log line names the capture id and admins read the plans
+// through GET /debug/slow-plans (see handleSlowPlans).
+
+// slowPlanKeep is how many captured plans each datasource keeps.
+const slowPlanKeep = 20
+
+// slowPlanInterval is the minimum time between two plan captures.
+const slowPlanInterval = 10 * time.Second
+
+// slowPlanTimeout bounds one EXPLAIN.
+const slowPlanTimeout = 30 * time.Second
+
+// maxPlanBytes caps the plan text kept per capture.
+const maxPlanBytes = 64 << 10
+
+// slowPlan is one captured plan.
+type slowPlan struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	DurationMS int64     `json:"durationMs"` // how long the slow query took
+	Database   string    `json:"database"`
+	SQL        string    `json:"sql"` // as sent, secrets scrubbed and redactColumns masked
+	Plan       string    `json:"plan,omitempty"`
+	Error      string    `json:"error,omitempty"` // why EXPLAIN failed
+}
+
+// planStore is the ring of captured plans for one datasource. A nil store
+// (capture off) ignores every call.
+type planStore struct {
+	mu       sync.Mutex
+	plans    []slowPlan // oldest first, at most slowPlanKeep
+	seq      int
+	last     time.Time // when the last capture started
+	inFlight bool
+	now      func() time.Time // tests
+}
+
+// newPlanStore returns the store, or nil when capture is off.
+func newPlanStore(enabled bool) *planStore {
+	if !enabled {
+		return nil
+	}
+	return &planStore{now: time.Now}
+}
+
+// reserve claims the next capture id, or "" when the rate limit or an
+// EXPLAIN still running says to skip this one.
+func (p *planStore) reserve() string {
+	if p == nil {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if p.inFlight || (!p.last.IsZero() && now.Sub(p.last) < slowPlanInterval) {
+		return ""
+	}
+	p.seq++
+	p.last, p.inFlight = now, true
+	return fmt.Sprintf("plan-%d", p.seq)
+}
+
+// add stores a finished capture, dropping the oldest past slowPlanKeep.
+func (p *planStore) add(plan slowPlan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight = false
+	p.plans = append(p.plans, plan)
+	if len(p.plans) > slowPlanKeep {
+		p.plans = p.plans[len(p.plans)-slowPlanKeep:]
+	}
+}
+
+// list returns the captured plans, newest first.
+func (p *planStore) list() []slowPlan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]slowPlan, len(p.plans))
+	for i, plan := range p.plans {
+		out[len(out)-1-i] = plan
+	}
+	return out
+}
+
+// parseSlowQueryThreshold resolves the slowQueryThreshold setting; empty
+// is off (0).
+func parseSlowQueryThreshold(setting string) (time.Duration, error) {
+	if setting == "" {
+		return 0, nil
+	}
+	threshold, err := time.ParseDuration(setting)
+	if err != nil || threshold <= 0 {
+		return 0, fmt.Errorf("invalid slowQueryThreshold %q: use a positive duration such as 5s or 1m", setting)
+	}
+	return threshold, nil
+}
+
+// noteSlowQuery logs sql, which Arc took elapsed to answer, when that is
+// past the threshold, and starts a plan capture for it when one is due.
+func (s *ArcInstanceSettings) noteSlowQuery(ctx context.Context, sql string, elapsed time.Duration) {
+	if s.slowThreshold <= 0 || elapsed <= s.slowThreshold {
+		return
+	}
+	var id string
+	if s.fixtures == nil && explainable(sql) {
+		id = s.slowPlans.reserve()
+	}
+	log.DefaultLogger.Warn("Slow Arc query",
+		"duration_ms", elapsed.Milliseconds(),
+		"threshold_ms", s.slowThreshold.Milliseconds(),
+		"database", s.settings.Database,
+		"sql", s.redactSQL(sql),
+		"planCapture", id,
+	)
+	if id == "" {
+		return
+	}
+	// The query's own context ends with the request; the capture keeps its
+	// values (request class aside) but not its deadline.
+	pctx, cancel := context.WithTimeout(withRequestClass(context.WithoutCancel(ctx), requestClassPlan), slowPlanTimeout)
+	go func() {
+		defer cancel()
+		s.capturePlan(pctx, id, sql, elapsed)
+	}()
+}
+
+// capturePlan runs EXPLAIN for sql and stores the result under id.
+func (s *ArcInstanceSettings) capturePlan(ctx context.Context, id, sql string, elapsed time.Duration) {
+	plan := slowPlan{
+		ID:         id,
+		Time:       time.Now().UTC(),
+		DurationMS: elapsed.Milliseconds(),
+		Database:   s.settings.Database,
+		SQL:        s.redactSQL(scrubSecrets(sql)),
+	}
+	frames, err := s.queryProtocolFrames(ctx, "EXPLAIN "+strings.TrimRight(sql, " \t\r\n;"))
+	if err != nil {
+		plan.Error = scrubSecrets(err.Error())
+	} else {
+		plan.Plan = planText(frames)
+	}
+	s.slowPlans.add(plan)
+	log.DefaultLogger.Debug("Captured slow query plan", "planCapture", id, "bytes", len(plan.Plan), "error", plan.Error)
+}
+
+// explainable reports whether sql is a single SELECT (or WITH) statement.
+func explainable(sql string) bool {
+	s := newStrippedSQL(sql)
+	head := strings.Fields(s.upper)
+	if len(head) == 0 || containsMultipleStatements(s) {
+		return false
+	}
+	return head[0] == "SELECT" || head[0] == "WITH" || strings.HasPrefix(head[0], "(")
+}
+
+// planText renders EXPLAIN's answer — rows of (explain_key, explain_value)
+// from DuckDB — as text: each row's values on their own lines, capped at
+// maxPlanBytes.
+func planText(frames data.Frames) string {
+	var b strings.Builder
+	for _, frame := range frames {
+		for i := 0; i < frame.Rows(); i++ {
+			for _, f := range frame.Fields {
+				if v, ok := f.ConcreteAt(i); ok {
+					b.WriteString(fmt.Sprint(v))
+					b.WriteByte('\n')
+				}
+			}
+		}
+	}
+	text, _ := arcclient.TruncateCell(b.String(), maxPlanBytes)
+	return text
+}
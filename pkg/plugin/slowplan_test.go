@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseSlowQueryThreshold(t *testing.T) {
+	if got, err := parseSlowQueryThreshold(""); got != 0 || err != nil {
+		t.Errorf(`parseSlowQueryThreshold("") = %v, %v`, got, err)
+	}
+	if got, err := parseSlowQueryThreshold("2s"); got != 2*time.Second || err != nil {
+		t.Errorf(`parseSlowQueryThreshold("2s") = %v, %v`, got, err)
+	}
+	for _, bad := range []string{"soon", "0s", "-1s"} {
+		if _, err := parseSlowQueryThreshold(bad); err == nil {
+			t.Errorf("parseSlowQueryThreshold(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestExplainable(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"SELECT * FROM t":                         true,
+		"  with x AS (SELECT 1) SELECT * FROM x;": true,
+		"/* dashboard */ SELECT 1":                true,
+		"(SELECT 1) UNION (SELECT 2)":             true,
+		"SHOW TABLES":                             false,
+		"DESCRIBE t":                              false,
+		"EXPLAIN SELECT 1":                        false,
+		"SET threads = 4; SELECT 1":               false,
+		"SELECT 1; SELECT 2":                      false,
+		"":                                        false,
+	} {
+		if got := explainable(sql); got != want {
+			t.Errorf("explainable(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
+
+func TestPlanStore_RateLimitAndRing(t *testing.T) {
+	now := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	store := newPlanStore(true)
+	store.now = func() time.Time { return now }
+
+	id := store.reserve()
+	if id != "plan-1" {
+		t.Fatalf("first reserve = %q", id)
+	}
+	now = now.Add(time.Hour)
+	if got := store.reserve(); got != "" {
+		t.Errorf("reserve with a capture in flight = %q", got)
+	}
+	store.add(slowPlan{ID: id})
+	if got := store.reserve(); got != "plan-2" {
+		t.Errorf("reserve after the capture finished = %q", got)
+	}
+	store.add(slowPlan{ID: "plan-2"})
+	now = now.Add(slowPlanInterval / 2)
+	if got := store.reserve(); got != "" {
+		t.Errorf("reserve within slowPlanInterval = %q", got)
+	}
+
+	for i := 0; i < slowPlanKeep; i++ {
+		store.add(slowPlan{ID: "filler"})
+	}
+	store.add(slowPlan{ID: "newest"})
+	plans := store.list()
+	if len(plans) != slowPlanKeep || plans[0].ID != "newest" {
+		t.Errorf("kept %d plans, newest %q", len(plans), plans[0].ID)
+	}
+
+	if (*planStore)(nil).reserve() != "" || newPlanStore(false) != nil {
+		t.Error("a disabled store captured")
+	}
+}
+
+// TestSlowQuery_CapturesPlan: a slow query is logged with a capture id and
+// EXPLAINed with the original query's API key and database; the plan is
+// listed by /debug/slow-plans for admins only.
+func TestSlowQuery_CapturesPlan(t *testing.T) {
+	type sent struct{ sql, auth, database string }
+	var (
+		mu   sync.Mutex
+		seen []sent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, sent{body.SQL, r.Header.Get("Authorization"), r.Header.Get("X-Arc-Database")})
+		mu.Unlock()
+		if strings.HasPrefix(body.SQL, "EXPLAIN ") {
+			_, _ = w.Write([]byte(`{"columns":["explain_key","explain_value"],"data":[["physical_plan","SEQ_SCAN cpu"]]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	defer srv.Close()
+
+	rec := recordLogs(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{
+		"useArrow":              false,
+		"allowDatabaseOverride": true,
+		"slowQueryThreshold":    "1ns",
+		"captureSlowQueryPlans": true,
+	})
+	query := func(sql string) {
+		t.Helper()
+		resp, err := d.QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: pctx,
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"` + sql + `","format":"table","database":"tenant2"}`)}},
+		})
+		if err != nil {
+			t.Fatalf("QueryData: %v", err)
+		}
+		if r := resp.Responses["A"]; r.Error != nil {
+			t.Fatalf("query error: %v", r.Error)
+		}
+	}
+	query("SELECT v FROM cpu;")
+
+	id := rec.field(t, "Slow Arc query", "planCapture")
+	if id != "plan-1" {
+		t.Fatalf("planCapture = %v", id)
+	}
+
+	admin := pctx
+	admin.User = &backend.User{Login: "admin", Role: "Admin"}
+	var listed struct {
+		Plans []slowPlan `json:"plans"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(listed.Plans) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no plan captured")
+		}
+		time.Sleep(5 * time.Millisecond)
+		status, body := callResource(t, d, admin, http.MethodGet, "/debug/slow-plans", nil)
+		if status != http.StatusOK {
+			t.Fatalf("slow-plans: status %d, %s", status, body)
+		}
+		if err := json.Unmarshal(body, &listed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plan := listed.Plans[0]
+	if plan.ID != "plan-1" || plan.Database != "tenant2" || !strings.Contains(plan.Plan, "SEQ_SCAN cpu") || plan.Error != "" {
+		t.Errorf("plan = %+v", plan)
+	}
+
+	// Rate-limited: a second slow query right away isn't explained.
+	query("SELECT v FROM cpu")
+	mu.Lock()
+	var explains []sent
+	for _, s := range seen {
+		if strings.HasPrefix(s.sql, "EXPLAIN") {
+			explains = append(explains, s)
+		}
+	}
+	mu.Unlock()
+	if len(explains) != 1 {
+		t.Fatalf("sent %d EXPLAINs, want 1", len(explains))
+	}
+	if want := (sent{"EXPLAIN SELECT v FROM cpu", "Bearer k", "tenant2"}); explains[0] != want {
+		t.Errorf("EXPLAIN sent as %+v, want %+v", explains[0], want)
+	}
+
+	viewer := pctx
+	viewer.User = &backend.User{Login: "viewer", Role: "Viewer"}
+	if status, _ := callResource(t, d, viewer, http.MethodGet, "/debug/slow-plans", nil); status != http.StatusForbidden {
+		t.Errorf("viewer: status %d, want 403", status)
+	}
+	off := testPluginContext(t, srv.URL, map[string]any{"slowQueryThreshold": "1s"})
+	off.DataSourceInstanceSettings.UID = "arc-off"
+	off.User = admin.User
+	if status, _ := callResource(t, d, off, http.MethodGet, "/debug/slow-plans", nil); status != http.StatusNotFound {
+		t.Errorf("capture off: status %d, want 404", status)
+	}
+}
+
+func TestSlowQuery_MetaStatementsNotExplained(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to Arc")
+	}))
+	defer srv.Close()
+
+	inst := newTestInstance(t, srv.URL)
+	rec := recordLogs(t)
+	inst.slowThreshold = time.Second
+	inst.slowPlans = newPlanStore(true)
+	inst.noteSlowQuery(t.Context(), "SELECT 1", time.Millisecond)
+	if len(rec.entries) != 0 {
+		t.Errorf("a fast query was logged: %v", rec.entries)
+	}
+	inst.noteSlowQuery(t.Context(), "SHOW TABLES", 2*time.Second)
+	if id := rec.field(t, "Slow Arc query", "planCapture"); id != "" {
+		t.Errorf("SHOW TABLES got plan capture %v", id)
+	}
+	if got := inst.slowPlans.reserve(); got != "plan-1" {
+		t.Errorf("SHOW TABLES used up a capture: next id %q", got)
+	}
+}
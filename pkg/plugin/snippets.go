@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// SQL snippets (snippets setting): named SQL fragments an admin defines once
+// and panels reference as $__snippet(name), for the tenant-scoping and
+// soft-delete filters otherwise pasted into every query. Expansion runs
+// before every other macro and before role restrictions are checked, so
+// the rest of the pipeline — and ExecutedQueryString in the query
+// inspector — sees the expanded SQL.
+//
+// Snippets don't nest: a snippet body can't reference another snippet, and
+// expansion is a single pass. A body may use ${__user.login} and
+// ${__user.email}, replaced by the requesting user's values as quoted SQL
+// literals, but only with forwardUserIdentity on — otherwise a snippet
+// couldn't tell whose identity it is scoping to.
+
+// snippetMacro is the macro a query uses to reference a snippet.
+const snippetMacro = "$__snippet("
+
+// errSnippet is returned for a $__snippet reference that can't be expanded.
+// The message is user-facing.
+var errSnippet = errors.New("invalid $__snippet")
+
+var (
+	snippetNameRe         = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+	identityPlaceholderRe = regexp.MustCompile(`\$\{__user\.([^}]*)\}`)
+	snippetIdentityValues = map[string]func(*backend.User) string{
+		"login": func(u *backend.User) string { return u.Login },
+		"email": func(u *backend.User) string { return u.Email },
+	}
+)
+
+// validateSnippets checks the snippets setting: names are identifiers,
+// bodies don't reference other snippets, and identity placeholders are
+// known, outside string literals, and only used with forwardIdentity.
+func validateSnippets(snippets map[string]string, forwardIdentity bool) error {
+	for name, body := range snippets {
+		if !snippetNameRe.MatchString(name) {
+			return fmt.Errorf("invalid snippet name %q: use letters, digits and '_'", name)
+		}
+		if strings.TrimSpace(body) == "" {
+			return fmt.Errorf("snippet %s is empty", name)
+		}
+		if strings.Contains(body, snippetMacro) {
+			return fmt.Errorf("snippet %s references another snippet; snippets can't be nested", name)
+		}
+		placeholders := identityPlaceholderRe.FindAllStringSubmatch(body, -1)
+		if len(placeholders) == 0 {
+			continue
+		}
+		if !forwardIdentity {
+			return fmt.Errorf("snippet %s uses %s, which needs 'Forward User Identity' enabled", name, placeholders[0][0])
+		}
+		for _, p := range placeholders {
+			if snippetIdentityValues[p[1]] == nil {
+				return fmt.Errorf("snippet %s uses unknown placeholder %s (supported: ${__user.login}, ${__user.email})", name, p[0])
+			}
+		}
+		if len(identityPlaceholderRe.FindAllString(stripStringLiteralsAndComments(body), -1)) != len(placeholders) {
+			return fmt.Errorf("snippet %s quotes an identity placeholder; write it unquoted, it expands to a string literal", name)
+		}
+	}
+	return nil
+}
+
+// expandSnippets replaces every $__snippet(name) in sql outside string
+// literals and comments with the named snippet, identity placeholders
+// filled in for user.
+func (s *ArcInstanceSettings) expandSnippets(sql string, user *backend.User) (string, error) {
+	if !strings.Contains(sql, snippetMacro) {
+		return sql, nil
+	}
+	var firstErr error
+	expanded := replaceMacroOccurrences(sql, snippetMacro, func(arg string) (string, bool) {
+		name := strings.TrimSpace(arg)
+		body, ok := s.settings.Snippets[name]
+		if strings.Contains(body, "--") {
+			body += "\n" // a trailing -- comment must not swallow the rest of the line
+		}
+		switch {
+		case !ok:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%w: no snippet named %q is defined in the datasource settings", errSnippet, name)
+			}
+			return "", false
+		case !identityPlaceholderRe.MatchString(body):
+			return body, true
+		case user == nil:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%w: snippet %s needs the requesting user, and this request has none (e.g. an alert rule)", errSnippet, name)
+			}
+			return "", false
+		}
+		for field, value := range snippetIdentityValues {
+			body = replaceLiteralAwareTokens(body, "${__user."+field+"}", quoteSQLString(value(user)))
+		}
+		return body, true
+	})
+	return expanded, firstErr
+}
+
+// quoteSQLString renders v as a single-quoted SQL string literal.
+func quoteSQLString(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestExpandSnippets(t *testing.T) {
+	inst := newTestInstance(t, "http://127.0.0.1:1")
+	inst.settings.Snippets = map[string]string{
+		"live":   "deleted = false",
+		"scoped": "tenant_id = ${__user.login} AND owner <> ${__user.email}",
+		"noted":  "deleted = false -- soft delete",
+	}
+	alice := &backend.User{Login: "alice", Email: "o'brien@example.com"}
+
+	cases := []struct {
+		name, sql, want string
+		user            *backend.User
+	}{
+		{
+			"plain",
+			"SELECT * FROM t WHERE $__snippet(live) AND $__timeFilter(time)",
+			"SELECT * FROM t WHERE deleted = false AND $__timeFilter(time)",
+			nil,
+		},
+		{
+			"identity quoted as literals",
+			"SELECT * FROM t WHERE $__snippet( scoped )",
+			"SELECT * FROM t WHERE tenant_id = 'alice' AND owner <> 'o''brien@example.com'",
+			alice,
+		},
+		{
+			"literals and comments untouched",
+			"SELECT '$__snippet(live)' AS s FROM t -- $__snippet(nope)\nWHERE $__snippet(live)",
+			"SELECT '$__snippet(live)' AS s FROM t -- $__snippet(nope)\nWHERE deleted = false",
+			nil,
+		},
+		{
+			"trailing comment ends its line",
+			"SELECT * FROM t WHERE $__snippet(noted) AND x = 1",
+			"SELECT * FROM t WHERE deleted = false -- soft delete\n AND x = 1",
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := inst.expandSnippets(c.sql, c.user)
+			if err != nil {
+				t.Fatalf("expandSnippets: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+
+	for _, c := range []struct{ sql, wantErr string }{
+		{"SELECT * FROM t WHERE $__snippet(missing)", `no snippet named "missing"`},
+		{"SELECT * FROM t WHERE $__snippet(scoped)", "needs the requesting user"},
+	} {
+		if _, err := inst.expandSnippets(c.sql, nil); !errors.Is(err, errSnippet) || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("%q: expected errSnippet containing %q, got %v", c.sql, c.wantErr, err)
+		}
+	}
+}
+
+func TestValidateSnippets(t *testing.T) {
+	cases := []struct {
+		name     string
+		snippets map[string]string
+		forward  bool
+		wantErr  string
+	}{
+		{"ok", map[string]string{"live": "deleted = false"}, false, ""},
+		{"identity with forwarding", map[string]string{"scoped": "tenant = ${__user.login}"}, true, ""},
+		{"identity without forwarding", map[string]string{"scoped": "tenant = ${__user.login}"}, false, "Forward User Identity"},
+		{"unknown placeholder", map[string]string{"scoped": "tenant = ${__user.orgRole}"}, true, "unknown placeholder"},
+		{"quoted placeholder", map[string]string{"scoped": "tenant = '${__user.login}'"}, true, "quotes an identity placeholder"},
+		{"nested", map[string]string{"a": "x = 1", "b": "$__snippet(a) AND y = 2"}, false, "can't be nested"},
+		{"bad name", map[string]string{"my snippet": "x = 1"}, false, "invalid snippet name"},
+		{"empty", map[string]string{"blank": "  "}, false, "is empty"},
+	}
+	for _, c := range cases {
+		err := validateSnippets(c.snippets, c.forward)
+		if c.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)) {
+			t.Errorf("%s: expected error containing %q, got %v", c.name, c.wantErr, err)
+		}
+	}
+}
+
+// TestQueryData_Snippets checks the expanded SQL is what reaches Arc and
+// what the query inspector shows, with the requesting user filled in.
+func TestQueryData_Snippets(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.SQL)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["time","n"],"data":[["2025-01-01T00:00:00Z",1]]}`))
+	}))
+	defer srv.Close()
+
+	pctx := testPluginContext(t, srv.URL, map[string]any{
+		"useArrow":            false,
+		"forwardUserIdentity": true,
+		"snippets":            map[string]string{"scoped": "tenant_id = ${__user.login}"},
+	})
+	pctx.User = &backend.User{Login: "alice"}
+	now := time.Now()
+	resp, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+		PluginContext: pctx,
+		Queries: []backend.DataQuery{{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+			JSON:      []byte(`{"sql":"SELECT time, n FROM t WHERE $__snippet(scoped) AND $__timeFilter(time)","format":"table"}`),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("QueryData: %v", err)
+	}
+	r := resp.Responses["A"]
+	if r.Error != nil {
+		t.Fatalf("query: %v", r.Error)
+	}
+	if len(seen) != 1 || !strings.Contains(seen[0], "WHERE tenant_id = 'alice' AND time >=") {
+		t.Fatalf("unexpected SQL sent: %q", seen)
+	}
+	if got := r.Frames[0].Meta.ExecutedQueryString; !strings.Contains(got, "tenant_id = 'alice'") {
+		t.Errorf("ExecutedQueryString should show the expanded snippet, got %q", got)
+	}
+}
+
+func TestNewArcInstance_RejectsIdentitySnippetWithoutForwarding(t *testing.T) {
+	pctx := testPluginContext(t, "http://127.0.0.1:1", map[string]any{
+		"snippets": map[string]string{"scoped": "tenant_id = ${__user.login}"},
+	})
+	_, err := newArcInstance(t.Context(), *pctx.DataSourceInstanceSettings)
+	if err == nil || !strings.Contains(err.Error(), "Forward User Identity") {
+		t.Fatalf("expected the identity snippet to be rejected, got %v", err)
+	}
+}
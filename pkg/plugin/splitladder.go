@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Split preview (GET /split-ladder): what a splitDuration resolves to for a
+// time range, answered by the same code QueryData splits with, so the query
+// editor can show "auto (1d chunks for this range)" as the time picker
+// changes without a TypeScript copy of the ladder. Parameters: from and to
+// (epoch milliseconds or RFC3339, default the last hour) and splitDuration
+// (default auto). The answer also lists autoSplitLadder, minSplitDuration
+// and the datasource's maxSplitChunks. It previews the setting only: the
+// checks that run a query unsplit for its shape (no $__timeFilter, a LIMIT,
+// ...) need the SQL and are left to the query's split decision.
+
+// splitLadderStep is an autoSplitLadder rung in a split preview.
+type splitLadderStep struct {
+	UnderMs int64  `json:"underMs"` // 0 on the last rung, which takes every longer range
+	Under   string `json:"under,omitempty"`
+	ChunkMs int64  `json:"chunkMs"` // 0 = no split
+	Chunk   string `json:"chunk,omitempty"`
+}
+
+// splitPreview is the GET /split-ladder answer. Warning is the notice a
+// query with this splitDuration would carry (splitDurationNotice);
+// RequestedChunk is set when maxSplitChunks made Chunk larger.
+type splitPreview struct {
+	SplitDuration      string            `json:"splitDuration"`
+	From               time.Time         `json:"from"`
+	To                 time.Time         `json:"to"`
+	RangeMs            int64             `json:"rangeMs"`
+	Split              bool              `json:"split"`
+	ChunkMs            int64             `json:"chunkMs"`
+	Chunk              string            `json:"chunk,omitempty"`
+	RequestedChunk     string            `json:"requestedChunk,omitempty"`
+	Chunks             int               `json:"chunks"`
+	Reason             string            `json:"reason"`
+	Warning            string            `json:"warning,omitempty"`
+	MinSplitDurationMs int64             `json:"minSplitDurationMs"`
+	MaxSplitChunks     int               `json:"maxSplitChunks"`
+	Ladder             []splitLadderStep `json:"ladder"`
+}
+
+// handleSplitLadder previews a splitDuration for a time range.
+func (d *ArcDatasource) handleSplitLadder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResourceError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	settings, err := d.resourceInstance(r)
+	if err != nil {
+		writeResourceError(w, http.StatusInternalServerError, sanitizeUserError("split-ladder", err))
+		return
+	}
+	params := r.URL.Query()
+	to, err := parseRangeParam("to", params.Get("to"), time.Now())
+	if err != nil {
+		writeResourceError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, err := parseRangeParam("from", params.Get("from"), to.Add(-time.Hour))
+	if err != nil {
+		writeResourceError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !from.Before(to) {
+		writeResourceError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	setting := params.Get("splitDuration")
+	if setting == "" {
+		setting = "auto"
+	}
+	writeResourceJSON(w, http.StatusOK, previewSplit(setting, backend.TimeRange{From: from, To: to}, settings.settings.MaxSplitChunks))
+}
+
+// previewSplit resolves setting for tr the way query does.
+func previewSplit(setting string, tr backend.TimeRange, maxChunks int) splitPreview {
+	p := splitPreview{
+		SplitDuration:      setting,
+		From:               tr.From,
+		To:                 tr.To,
+		RangeMs:            tr.To.Sub(tr.From).Milliseconds(),
+		Reason:             splitSettingReason(setting, tr),
+		MinSplitDurationMs: minSplitDuration.Milliseconds(),
+		MaxSplitChunks:     maxChunks,
+		Ladder:             make([]splitLadderStep, len(autoSplitLadder)),
+	}
+	if err := splitDurationProblem(setting); err != nil {
+		p.Warning = splitDurationNotice(err)
+	}
+	if requested, ok := parseSplitDuration(setting, tr); ok {
+		chunk := capChunkSize(tr.From, tr.To, requested, time.Time{}, maxChunks)
+		p.Split, p.ChunkMs, p.Chunk = true, chunk.Milliseconds(), formatSpan(chunk)
+		p.Chunks = len(splitTimeRange(tr.From, tr.To, chunk, maxChunks))
+		if chunk != requested {
+			p.RequestedChunk = formatSpan(requested)
+		}
+	}
+	for i, step := range autoSplitLadder {
+		p.Ladder[i] = splitLadderStep{UnderMs: step.Under.Milliseconds(), ChunkMs: step.Chunk.Milliseconds()}
+		if step.Under > 0 {
+			p.Ladder[i].Under = formatSpan(step.Under)
+		}
+		if step.Chunk > 0 {
+			p.Ladder[i].Chunk = formatSpan(step.Chunk)
+		}
+	}
+	return p
+}
+
+// parseRangeParam reads a time range bound given as epoch milliseconds (as
+// Grafana's time picker has them) or RFC3339; empty is def.
+func parseRangeParam(name, v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: use epoch milliseconds or RFC3339", name)
+	}
+	return t, nil
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestHandleSplitLadder pins the GET /split-ladder response schema the
+// query editor reads.
+func TestHandleSplitLadder(t *testing.T) {
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, "http://arc.invalid", nil)
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	ms := func(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) }
+
+	get := func(t *testing.T, query string) map[string]any {
+		t.Helper()
+		status, body := callResource(t, d, pctx, http.MethodGet, "/split-ladder?"+query, nil)
+		if status != http.StatusOK {
+			t.Fatalf("status %d: %s", status, body)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+	keys := func(m map[string]any) []string {
+		var out []string
+		for k := range m {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	t.Run("schema", func(t *testing.T) {
+		got := get(t, "from="+ms(from)+"&to="+ms(from.Add(48*time.Hour)))
+		want := []string{"chunk", "chunkMs", "chunks", "from", "ladder", "maxSplitChunks", "minSplitDurationMs", "rangeMs", "reason", "split", "splitDuration", "to"}
+		if k := keys(got); !slices.Equal(k, want) {
+			t.Errorf("keys = %v, want %v", k, want)
+		}
+		for k, v := range map[string]any{
+			"splitDuration":      "auto",
+			"from":               "2026-03-08T00:00:00Z",
+			"to":                 "2026-03-10T00:00:00Z",
+			"rangeMs":            float64(48 * time.Hour / time.Millisecond),
+			"split":              true,
+			"chunk":              "6h",
+			"chunkMs":            float64(6 * time.Hour / time.Millisecond),
+			"chunks":             float64(8),
+			"reason":             "auto: range 2d is under 7d",
+			"minSplitDurationMs": float64(5 * time.Minute / time.Millisecond),
+			"maxSplitChunks":     float64(DefaultMaxSplitChunks),
+		} {
+			if got[k] != v {
+				t.Errorf("%s = %v, want %v", k, got[k], v)
+			}
+		}
+		ladder, _ := got["ladder"].([]any)
+		if len(ladder) != len(autoSplitLadder) {
+			t.Fatalf("ladder = %v", got["ladder"])
+		}
+		first, last := ladder[0].(map[string]any), ladder[len(ladder)-1].(map[string]any)
+		if k := keys(first); !slices.Equal(k, []string{"chunkMs", "under", "underMs"}) {
+			t.Errorf("first rung keys = %v", k)
+		}
+		if first["under"] != "3h" || first["chunkMs"] != float64(0) {
+			t.Errorf("first rung = %v", first)
+		}
+		if k := keys(last); !slices.Equal(k, []string{"chunk", "chunkMs", "underMs"}) {
+			t.Errorf("last rung keys = %v", k)
+		}
+		if last["chunk"] != "7d" || last["underMs"] != float64(0) {
+			t.Errorf("last rung = %v", last)
+		}
+	})
+
+	for _, c := range []struct {
+		name, query string
+		split       bool
+		chunk       string
+		chunks      float64
+		reason      string
+		warning     any
+	}{
+		{"short auto range", "from=2026-03-08T00:00:00Z&to=2026-03-08T01:00:00Z", false, "", 0, "auto: range 1h is under 3h", nil},
+		{"explicit", "from=2026-03-08T00:00:00Z&to=2026-03-08T06:00:00Z&splitDuration=90m", true, "1h30m", 4, "splitDuration is 90m", nil},
+		{"off", "from=2026-03-08T00:00:00Z&to=2026-03-10T00:00:00Z&splitDuration=off", false, "", 0, "splitDuration is off", nil},
+		{"rejected", "from=2026-03-08T00:00:00Z&to=2026-03-10T00:00:00Z&splitDuration=abc", false, "", 0,
+			`unknown splitDuration "abc": use auto, off or a duration such as 30m, 2h, 12h30m or 14d`,
+			`Query not split: unknown splitDuration "abc": use auto, off or a duration such as 30m, 2h, 12h30m or 14d.`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got := get(t, c.query)
+			if got["split"] != c.split || got["chunks"] != c.chunks || got["reason"] != c.reason || got["warning"] != c.warning {
+				t.Errorf("got %v", got)
+			}
+			if chunk, _ := got["chunk"].(string); chunk != c.chunk {
+				t.Errorf("chunk = %q, want %q", chunk, c.chunk)
+			}
+		})
+	}
+
+	t.Run("capped by maxSplitChunks", func(t *testing.T) {
+		capped := NewArcDatasource()
+		pctx := testPluginContext(t, "http://arc.invalid", map[string]any{"maxSplitChunks": 10})
+		status, body := callResource(t, capped, pctx, http.MethodGet, "/split-ladder?from=2026-03-08T00:00:00Z&to=2026-03-10T00:00:00Z&splitDuration=1h", nil)
+		if status != http.StatusOK {
+			t.Fatalf("status %d: %s", status, body)
+		}
+		var got splitPreview
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if got.MaxSplitChunks != 10 || got.RequestedChunk != "1h" || got.Chunks > 10 || got.ChunkMs%time.Hour.Milliseconds() != 0 {
+			t.Errorf("got %+v, want at most 10 chunks of a multiple of the requested 1h", got)
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		for _, c := range []struct {
+			method, query string
+			status        int
+		}{
+			{http.MethodPost, "", http.StatusMethodNotAllowed},
+			{http.MethodGet, "from=yesterday", http.StatusBadRequest},
+			{http.MethodGet, "from=" + ms(from) + "&to=" + ms(from), http.StatusBadRequest},
+		} {
+			if status, body := callResource(t, d, pctx, c.method, "/split-ladder?"+c.query, nil); status != c.status {
+				t.Errorf("%s ?%s: status %d (%s), want %d", c.method, c.query, status, body, c.status)
+			}
+		}
+	})
+}
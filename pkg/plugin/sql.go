@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -129,6 +130,14 @@ func containsLIMIT(s strippedSQL) bool {
 	return limitRe.MatchString(s.stripped)
 }
 
+// containsTopLevelLIMIT reports whether the outer statement has a LIMIT
+// clause, i.e. one outside all parentheses. A LIMIT in a subquery or CTE
+// doesn't bound the result, so the row limits still apply to such a query
+// (see resolveRowLimit); the splitting heuristics keep containsLIMIT.
+func containsTopLevelLIMIT(s strippedSQL) bool {
+	return limitRe.MatchString(blankNested(s.stripped))
+}
+
 // containsUnion reports whether the SQL contains a UNION operator. Macro
 // expansion in multi-statement queries produces mangled SQL when split, so
 // we conservatively skip splitting on UNION.
@@ -136,6 +145,14 @@ func containsUnion(s strippedSQL) bool {
 	return unionRe.MatchString(s.stripped)
 }
 
+// containsMultipleStatements reports whether the SQL holds more than one
+// statement, i.e. a `;` with anything but whitespace after it. Arc answers
+// those with one result set per statement, which chunk merging can't
+// represent, so splitting is skipped.
+func containsMultipleStatements(s strippedSQL) bool {
+	return strings.Contains(strings.TrimRight(s.stripped, " \t\r\n;"), ";")
+}
+
 // hasTimeFilterMacro reports whether the SQL uses one of the time macros in
 // a position where the macro engine would expand it (i.e. outside string
 // literals and comments). A commented-out macro shouldn't keep splitting
@@ -226,3 +243,214 @@ func containsAggregationWithoutTimeGroup(s strippedSQL) bool {
 	}
 	return false
 }
+
+// appendLimit adds a trailing `LIMIT n` to sql. Trailing semicolons are
+// dropped (the LIMIT would land after the statement terminator) and the
+// clause goes on its own line so a trailing `-- comment` can't swallow it.
+// Callers must have checked containsTopLevelLIMIT first: a second
+// top-level LIMIT is a syntax error.
+func appendLimit(sql string, n int64) string {
+	sql = strings.TrimRight(sql, " \t\r\n;")
+	return sql + "\nLIMIT " + strconv.FormatInt(n, 10)
+}
+
+// groupByEndRe matches the clause keywords that can follow a GROUP BY list.
+var groupByEndRe = regexp.MustCompile(`(?i)\b(HAVING|QUALIFY|WINDOW|ORDER\s+BY|LIMIT|UNION)\b`)
+
+// maxSeriesFactor caps estimateSeriesFactor so a wide GROUP BY doesn't
+// inflate the time-series row cap into "no cap at all".
+const maxSeriesFactor = 1000
+
+// estimateSeriesFactor guesses how many series a time-bucketed query
+// returns per bucket, for sizing the time-series row cap. Each GROUP BY key
+// besides the time bucket is assumed to contribute ~10 series; no GROUP BY
+// (the "forgot to aggregate" case the cap exists for) or a time-only
+// GROUP BY is a single series. Only the last GROUP BY is inspected, which
+// is the outer query's for the usual `SELECT ... FROM (subquery) GROUP BY`
+// shape. Deliberately rough — it sizes a safety net, not a plan.
+func estimateSeriesFactor(s strippedSQL) int64 {
+	locs := groupByRe.FindAllStringIndex(s.stripped, -1)
+	if len(locs) == 0 {
+		return 1
+	}
+	list := s.stripped[locs[len(locs)-1][1]:]
+	if loc := groupByEndRe.FindStringIndex(list); loc != nil {
+		list = list[:loc[0]]
+	}
+	keys, depth := 1, 0
+	for _, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				keys++
+			}
+		}
+		if depth < 0 || c == ';' {
+			break // closed an enclosing subquery or ended the statement
+		}
+	}
+	factor := int64(1)
+	for i := 1; i < keys && factor < maxSeriesFactor; i++ {
+		factor *= 10
+	}
+	return min(factor, maxSeriesFactor)
+}
+
+// fromJoinRe matches the keywords that introduce a table reference.
+var fromJoinRe = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\b`)
+
+// tableNameRe matches a plain or double-quoted identifier, optionally dotted
+// (`db.cpu`, `"my db"."cpu"`), at the start of its input.
+var tableNameRe = regexp.MustCompile(`^\s*((?:"[^"]+"|[A-Za-z_][\w$]*)(?:\s*\.\s*(?:"[^"]+"|[A-Za-z_][\w$]*))*)`)
+
+// tableAliasRe matches the alias that may follow a table name.
+var tableAliasRe = regexp.MustCompile(`(?i)^\s*(?:AS\s+)?("[^"]+"|[A-Za-z_][\w$]*)`)
+
+// cteNameRe matches a CTE definition (`name AS (`), so references to the
+// CTE aren't mistaken for tables.
+var cteNameRe = regexp.MustCompile(`(?i)(?:\bWITH(?:\s+RECURSIVE)?|,)\s*("[^"]+"|[A-Za-z_][\w$]*)\s+AS\s*\(`)
+
+// qualifiedNameSpaceRe matches the whitespace tableNameRe tolerates around
+// the dots of a qualified name.
+var qualifiedNameSpaceRe = regexp.MustCompile(`\s*\.\s*`)
+
+// fromClauseKeywords are the words that can follow a FROM item, so they are
+// never its alias — and never a table name: `FROM WHERE` is what a FROM
+// over a string literal (`FROM 'file.parquet'`) looks like once stripped.
+var fromClauseKeywords = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "LIMIT": true, "OFFSET": true, "FETCH": true,
+	"HAVING": true, "QUALIFY": true, "WINDOW": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true, "CROSS": true,
+	"NATURAL": true, "POSITIONAL": true, "ASOF": true, "ANTI": true, "SEMI": true, "LATERAL": true,
+	"ON": true, "USING": true, "SAMPLE": true, "TABLESAMPLE": true, "PIVOT": true, "UNPIVOT": true,
+	"SELECT": true, "FROM": true, "VALUES": true,
+}
+
+// tableRef is one table reference found by scanTableRefs.
+type tableRef struct {
+	name string // as written, whitespace around dots removed
+	cte  bool   // names a CTE defined earlier in the statement
+}
+
+// tableScan is what scanTableRefs could read from a query's FROM and JOIN
+// clauses. incomplete is non-empty when some FROM item isn't a plain table
+// — a table function, a comma-separated FROM list, a FROM over a string
+// literal — so refs may not be every table the query reads.
+type tableScan struct {
+	refs       []tableRef
+	incomplete string
+}
+
+// scanTableRefs walks the FROM and JOIN clauses of a query (including
+// subqueries). Regex-based, so it reads the common shapes and reports the
+// rest as incomplete rather than guessing.
+func scanTableRefs(s strippedSQL) tableScan {
+	var scan tableScan
+	markIncomplete := func(reason string) {
+		if scan.incomplete == "" {
+			scan.incomplete = reason
+		}
+	}
+
+	// A reference names a CTE only after the CTE's definition has closed;
+	// inside its own body (`WITH cpu AS (SELECT * FROM cpu)`) the same name
+	// is the real table.
+	cteEnds := map[string]int{}
+	for _, m := range cteNameRe.FindAllStringSubmatchIndex(s.stripped, -1) {
+		name := strings.ToLower(s.stripped[m[2]:m[3]])
+		if end := findMatchingParen(s.stripped, m[1]-1); end >= 0 {
+			cteEnds[name] = end
+		}
+	}
+
+	for _, kw := range fromJoinRe.FindAllStringIndex(s.stripped, -1) {
+		if !inSelectScope(s.upper, kw[0]) {
+			if strings.HasSuffix(strings.TrimRight(s.stripped[:kw[0]], " \t\r\n"), "(") {
+				markIncomplete("a FROM-first subquery") // (FROM cpu): DuckDB's SELECT-less form
+			}
+			continue // EXTRACT(hour FROM time), TRIM(BOTH FROM x), ...
+		}
+		rest := s.stripped[kw[1]:]
+		if trimmed := strings.TrimLeft(rest, " \t\r\n"); strings.HasPrefix(trimmed, "(") {
+			inner := strings.ToUpper(strings.TrimLeft(trimmed[1:], " \t\r\n("))
+			if !strings.HasPrefix(inner, "SELECT") && !strings.HasPrefix(inner, "WITH") &&
+				!strings.HasPrefix(inner, "VALUES") && !strings.HasPrefix(inner, "FROM") {
+				markIncomplete("a parenthesized FROM item")
+			}
+			continue // subquery: its own FROM is scanned on its own
+		}
+		m := tableNameRe.FindStringSubmatchIndex(rest)
+		if m == nil || fromClauseKeywords[strings.ToUpper(rest[m[2]:m[3]])] {
+			markIncomplete("a FROM item that isn't a table name")
+			continue
+		}
+		name := qualifiedNameSpaceRe.ReplaceAllString(rest[m[2]:m[3]], ".")
+		after := rest[m[1]:]
+		if strings.HasPrefix(strings.TrimLeft(after, " \t\r\n"), "(") {
+			markIncomplete("table function " + name + "()")
+			continue
+		}
+		if a := tableAliasRe.FindStringSubmatchIndex(after); a != nil && !fromClauseKeywords[strings.ToUpper(after[a[2]:a[3]])] {
+			after = strings.TrimLeft(after[a[1]:], " \t\r\n")
+			if strings.HasPrefix(after, "(") { // column aliases: t(a, b)
+				if end := findMatchingParen(after, 0); end >= 0 {
+					after = after[end+1:]
+				}
+			}
+		}
+		if strings.HasPrefix(strings.TrimLeft(after, " \t\r\n"), ",") {
+			markIncomplete("a comma-separated FROM list")
+		}
+		end, isCTE := cteEnds[strings.ToLower(name)]
+		scan.refs = append(scan.refs, tableRef{name: name, cte: isCTE && end < kw[0]})
+	}
+	return scan
+}
+
+// maxReferencedTables caps referencedTables; a query joining more tables
+// than this gets metadata from the first few only.
+const maxReferencedTables = 4
+
+// referencedTables returns the distinct tables a query reads from, in order
+// of appearance. Best-effort: table functions (`read_parquet(...)`) are
+// skipped, and anything the scan can't make sense of is simply absent.
+func referencedTables(s strippedSQL) []string {
+	var tables []string
+	seen := map[string]bool{}
+	for _, ref := range scanTableRefs(s).refs {
+		if len(tables) == maxReferencedTables {
+			break
+		}
+		key := strings.ToLower(ref.name)
+		if ref.cte || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tables = append(tables, ref.name)
+	}
+	return tables
+}
+
+// inSelectScope reports whether position i of upper sits in a SELECT
+// statement's own scope rather than inside a function call's parentheses:
+// the innermost unclosed `(` before i must open a subquery, or there must be
+// none.
+func inSelectScope(upper string, i int) bool {
+	depth := 0
+	for j := i - 1; j >= 0; j-- {
+		switch upper[j] {
+		case ')':
+			depth++
+		case '(':
+			if depth == 0 {
+				return strings.Contains(upper[j:i], "SELECT")
+			}
+			depth--
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Per-query contexts. Each query of a request runs under its own context,
+// derived from the request's, so it can end without the rest of the batch:
+//
+//   - queryTimeout bounds a whole query — every chunk, retry and fallback —
+//     however long its time range, where timeout bounds one Arc request.
+//   - A superseded query is cancelled. When a panel's query is re-issued
+//     while the previous run is still going (the user edits the panel or
+//     changes the range, and Grafana sends the batch again), the older run
+//     would only produce a result nobody waits for while holding
+//     concurrency slots the new one needs. Runs are keyed by org, user,
+//     dashboard, panel and refId (supersedeKey); a new run cancels the one
+//     registered under its key on the same instance. Queries without a
+//     dashboard and panel (Explore, resource calls), without a user, or
+//     from alert rules are never superseded. cancelSuperseded (on
+//     by default) turns this off.
+
+// errSuperseded is the cancellation cause of a query replaced by a newer
+// run of the same panel query.
+var errSuperseded = errors.New("superseded by a newer run of the same panel query")
+
+// errQueryTimeout is the cancellation cause of a query past queryTimeout.
+var errQueryTimeout = errors.New("query timeout")
+
+// supersedeKey identifies a panel query across requests.
+type supersedeKey struct {
+	orgID     int64
+	user      string
+	dashboard string
+	panel     string
+	refID     string
+}
+
+// inflightRun is a registered query run.
+type inflightRun struct {
+	cancel context.CancelCauseFunc
+}
+
+// inflightQueries tracks the running panel queries of an instance.
+type inflightQueries struct {
+	mu   sync.Mutex
+	runs map[supersedeKey]*inflightRun
+}
+
+func newInflightQueries() *inflightQueries {
+	return &inflightQueries{runs: map[supersedeKey]*inflightRun{}}
+}
+
+// register records a run under key, cancelling the run it replaces, and
+// returns the function that removes it again. An older run finishing late
+// leaves the newer run's entry alone.
+func (q *inflightQueries) register(key supersedeKey, cancel context.CancelCauseFunc) func() {
+	run := &inflightRun{cancel: cancel}
+	q.mu.Lock()
+	prev := q.runs[key]
+	q.runs[key] = run
+	q.mu.Unlock()
+	if prev != nil {
+		prev.cancel(errSuperseded)
+	}
+	return func() {
+		q.mu.Lock()
+		if q.runs[key] == run {
+			delete(q.runs, key)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// size returns the number of registered runs.
+func (q *inflightQueries) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.runs)
+}
+
+// cancelSuperseded reports whether a newer run of a panel query cancels the
+// older one (CancelSuperseded, default on).
+func (s *ArcInstanceSettings) cancelSuperseded() bool {
+	return s.settings.CancelSuperseded == nil || *s.settings.CancelSuperseded
+}
+
+// parseQueryTimeout resolves the queryTimeout setting; empty is none (0).
+func parseQueryTimeout(setting string) (time.Duration, error) {
+	if setting == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(setting)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid queryTimeout %q: use a positive duration such as 30s or 5m", setting)
+	}
+	return timeout, nil
+}
+
+// runQuery runs q under its own context (see above) and answers a query
+// cut short by queryTimeout or by a newer run with an error saying so.
+func (d *ArcDatasource) runQuery(ctx context.Context, settings *ArcInstanceSettings, q backend.DataQuery) backend.DataResponse {
+	qctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if settings.queryTimeout > 0 {
+		var stop context.CancelFunc
+		qctx, stop = context.WithTimeoutCause(qctx, settings.queryTimeout, errQueryTimeout)
+		defer stop()
+	}
+	origin, user := requestOriginFrom(ctx), requestUserFrom(ctx)
+	if settings.cancelSuperseded() && origin.Dashboard != "" && origin.Panel != "" && !origin.Alert && user != nil && user.Login != "" {
+		key := supersedeKey{orgID: origin.OrgID, user: user.Login, dashboard: origin.Dashboard, panel: origin.Panel, refID: q.RefID}
+		defer settings.inflight.register(key, cancel)()
+	}
+
+	resp := d.queryWithRecover(qctx, settings, q)
+	if resp.Error == nil || ctx.Err() != nil {
+		return resp
+	}
+	switch cause := context.Cause(qctx); {
+	case errors.Is(cause, errSuperseded):
+		log.DefaultLogger.Debug("Query cancelled: superseded by a newer run", "refId", q.RefID, "dashboard", origin.Dashboard, "panel", origin.Panel)
+		return backend.ErrDataResponse(backend.StatusTimeout, "Query cancelled: a newer run of this panel query replaced it.")
+	case errors.Is(cause, errQueryTimeout):
+		log.DefaultLogger.Warn("Query cancelled: queryTimeout reached", "refId", q.RefID, "timeout", settings.queryTimeout)
+		return backend.ErrDataResponse(backend.StatusTimeout, fmt.Sprintf("Query timed out after %s (the datasource's query timeout). Try reducing the time range.", settings.queryTimeout))
+	}
+	return resp
+}
@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// supersedeServer answers `SELECT 'slow'` once release is closed or the
+// request is cancelled, and everything else at once. started receives each
+// slow request's arrival.
+func supersedeServer(t *testing.T) (srv *httptest.Server, started chan struct{}, release chan struct{}) {
+	started, release = make(chan struct{}, 8), make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if strings.Contains(body.SQL, "'slow'") {
+			started <- struct{}{}
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"columns":["v"],"data":[[1]]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, started, release
+}
+
+// panelQuery runs sql as refId A of panel 4 on dashboard d1, for user.
+func panelQuery(t *testing.T, d *ArcDatasource, pctx backend.PluginContext, user, panel, sql string) backend.DataResponse {
+	t.Helper()
+	pctx.User = &backend.User{Login: user, Role: "Viewer"}
+	req := &backend.QueryDataRequest{
+		PluginContext: pctx,
+		Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{"sql":"` + sql + `","format":"table"}`)}},
+	}
+	req.SetHTTPHeader("X-Dashboard-Uid", "d1")
+	req.SetHTTPHeader("X-Panel-Id", panel)
+	resp, err := d.QueryData(t.Context(), req)
+	if err != nil {
+		t.Errorf("QueryData: %v", err)
+		return backend.DataResponse{}
+	}
+	return resp.Responses["A"]
+}
+
+// TestRunQuery_SupersededRunIsCancelled: a newer run of the same panel
+// query cancels the one still waiting on Arc; other panels and other users
+// are left alone.
+func TestRunQuery_SupersededRunIsCancelled(t *testing.T) {
+	srv, started, release := supersedeServer(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false})
+
+	older := make(chan backend.DataResponse, 1)
+	go func() { older <- panelQuery(t, d, pctx, "alice", "4", "SELECT 'slow'") }()
+	<-started
+	other := make(chan backend.DataResponse, 2)
+	go func() { other <- panelQuery(t, d, pctx, "alice", "5", "SELECT 'slow'") }()
+	go func() { other <- panelQuery(t, d, pctx, "bob", "4", "SELECT 'slow'") }()
+	<-started
+	<-started
+
+	if r := panelQuery(t, d, pctx, "alice", "4", "SELECT 1"); r.Error != nil {
+		t.Fatalf("newer run: %v", r.Error)
+	}
+	select {
+	case r := <-older:
+		if r.Error == nil || r.Status != backend.StatusTimeout || !strings.Contains(r.Error.Error(), "newer run") {
+			t.Errorf("older run: status %d, error %v", r.Status, r.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("older run wasn't cancelled")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if r := <-other; r.Error != nil {
+			t.Errorf("unrelated run failed: %v", r.Error)
+		}
+	}
+	settings, _ := d.getInstance(t.Context(), pctx)
+	if n := settings.inflight.size(); n != 0 {
+		t.Errorf("%d runs still registered", n)
+	}
+}
+
+func TestRunQuery_CancelSupersededOff(t *testing.T) {
+	srv, started, release := supersedeServer(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "cancelSuperseded": false})
+
+	older := make(chan backend.DataResponse, 1)
+	go func() { older <- panelQuery(t, d, pctx, "alice", "4", "SELECT 'slow'") }()
+	<-started
+	if r := panelQuery(t, d, pctx, "alice", "4", "SELECT 1"); r.Error != nil {
+		t.Fatalf("newer run: %v", r.Error)
+	}
+	close(release)
+	if r := <-older; r.Error != nil {
+		t.Errorf("older run: %v", r.Error)
+	}
+}
+
+func TestRunQuery_QueryTimeout(t *testing.T) {
+	srv, _, _ := supersedeServer(t)
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false, "queryTimeout": "50ms"})
+
+	r := panelQuery(t, d, pctx, "alice", "4", "SELECT 'slow'")
+	if r.Error == nil || r.Status != backend.StatusTimeout || !strings.Contains(r.Error.Error(), "timed out after 50ms") {
+		t.Errorf("status %d, error %v", r.Status, r.Error)
+	}
+	if r := panelQuery(t, d, pctx, "alice", "4", "SELECT 1"); r.Error != nil {
+		t.Errorf("fast query: %v", r.Error)
+	}
+
+	for _, bad := range []string{"soon", "0s", "-1m"} {
+		pctx := testPluginContext(t, srv.URL, map[string]any{"queryTimeout": bad})
+		pctx.DataSourceInstanceSettings.UID = "arc-" + bad
+		if _, err := d.getInstance(t.Context(), pctx); err == nil || !strings.Contains(err.Error(), "queryTimeout") {
+			t.Errorf("queryTimeout %q: %v", bad, err)
+		}
+	}
+}
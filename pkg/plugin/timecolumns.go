@@ -0,0 +1,40 @@
+package plugin
+
+import "strings"
+
+// Time columns. Without the column types Arc may leave out, the JSON
+// decoder takes a column for time when its values look like timestamps or
+// when it is named like one, so a table whose time column is called ts or
+// event_time and holds epochs comes back numeric, and the panel says "no
+// time field". The timeColumnNames setting lists the names that are time
+// columns (comma-separated, empty = arcclient.DefaultTimeColumns), and a
+// query's timeColumnNames replaces the list for that query. The same names
+// decide which integer columns are epochs, over either protocol: both
+// decoders pass their frame through arcclient.EpochTimeFields, so an
+// epoch_ns(time) AS time column is a time field on Arrow too.
+
+// parseTimeColumnNames splits a timeColumnNames value into names, nil
+// (the defaults) when it names none.
+func parseTimeColumnNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// withTimeColumns returns settings whose JSON decoder takes the columns
+// named in names (a query's timeColumnNames) for time; settings unchanged
+// when names lists none. The shallow copy keeps the shared client,
+// semaphore and caches, as in withQueryProtocol.
+func (s *ArcInstanceSettings) withTimeColumns(names string) *ArcInstanceSettings {
+	columns := parseTimeColumnNames(names)
+	if columns == nil {
+		return s
+	}
+	scoped := *s
+	scoped.timeColumns = columns
+	return &scoped
+}
@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestParseTimeColumnNames(t *testing.T) {
+	for in, want := range map[string][]string{
+		"":                        nil,
+		" , ":                     nil,
+		"ts":                      {"ts"},
+		" created_at, event_time": {"created_at", "event_time"},
+	} {
+		if got := parseTimeColumnNames(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseTimeColumnNames(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestQuery_JSONTimeColumnNames: a created_at column of epoch
+// milliseconds is a number to the default names, the time field once the
+// datasource's timeColumnNames lists it, and a number again for a query
+// whose own timeColumnNames doesn't.
+func TestQuery_JSONTimeColumnNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns":["created_at","orders"],"data":[[1771408800000,3],[1771408860000,5]]}`))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name      string
+		setting   string
+		query     string
+		wantTime  bool
+		wantFirst time.Time
+	}{
+		{name: "default names"},
+		{name: "datasource setting", setting: "ts, created_at", wantTime: true, wantFirst: time.UnixMilli(1771408800000)},
+		{name: "query override", setting: "created_at", query: "event_time"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			inst := newTestInstance(t, srv.URL)
+			useJSON := false
+			inst.settings.UseArrow = &useJSON
+			inst.timeColumns = parseTimeColumnNames(c.setting)
+
+			qm, _ := jsonMarshal(map[string]any{"sql": "SELECT created_at, orders FROM orders", "format": "table", "timeColumnNames": c.query})
+			resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{RefID: "A", JSON: qm})
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			f := resp.Frames[0].Fields[0]
+			if got := f.Type() == data.FieldTypeNullableTime; got != c.wantTime {
+				t.Fatalf("created_at typed %s, want time %v", f.Type(), c.wantTime)
+			}
+			if c.wantTime {
+				if got, _ := f.ConcreteAt(0); !got.(time.Time).Equal(c.wantFirst) {
+					t.Errorf("created_at[0] = %v, want %v", got, c.wantFirst)
+				}
+			}
+		})
+	}
+}
+
+// TestQuery_EpochNanosTimeColumn: epoch_ns(time) AS time comes back as a
+// BIGINT, a float64 field from Arrow and a declared BIGINT over JSON. Both
+// protocols turn it into the time field, and the series are graphed.
+func TestQuery_EpochNanosTimeColumn(t *testing.T) {
+	t1, t2 := time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC), time.Date(2026, 2, 18, 10, 1, 0, 0, time.UTC)
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.Int64Builder).AppendValues([]int64{t1.UnixNano(), t1.UnixNano(), t2.UnixNano(), t2.UnixNano()}, nil)
+		b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b", "a", "b"}, nil)
+		b.Field(2).(*array.Float64Builder).AppendValues([]float64{1, 2, 3, 4}, nil)
+	})
+	body := fmt.Sprintf(`{"columns":["time","host","value"],"types":["BIGINT","VARCHAR","DOUBLE"],"data":[[%d,"a",1],[%d,"b",2],[%d,"a",3],[%d,"b",4]]}`,
+		t1.UnixNano(), t1.UnixNano(), t2.UnixNano(), t2.UnixNano())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/query/arrow" {
+			_, _ = w.Write(stream)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	for _, arrowOn := range []bool{true, false} {
+		t.Run(fmt.Sprintf("arrow=%v", arrowOn), func(t *testing.T) {
+			inst := newTestInstance(t, srv.URL)
+			inst.settings.UseArrow = &arrowOn
+			resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+				RefID: "A",
+				JSON:  []byte(`{"sql":"SELECT epoch_ns(time) AS time, host, value FROM cpu","format":"time_series"}`),
+			})
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			frame := resp.Frames[0]
+			if frame.Meta.Type != data.FrameTypeTimeSeriesWide || len(frame.Fields) != 3 {
+				t.Fatalf("frame = %s with %d fields, want the wide series a and b", frame.Meta.Type, len(frame.Fields))
+			}
+			for i, want := range []time.Time{t1, t2} {
+				if got, _ := frame.Fields[0].ConcreteAt(i); !got.(time.Time).Equal(want) {
+					t.Errorf("time[%d] = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Variable queries: a query sent with queryType "variable", with
+// variableQuery set, or under the frontend's metricFindQuery refId fills a
+// dashboard variable. It runs as an unsplit table query — macros still
+// expand over the dashboard range — and its result comes back as one frame
+// of two string fields: __value, the variable's values, and __text, what
+// the picker shows. The values are the first string column (the first
+// column when none is text) and the text the column after it, or the value
+// itself; columns named __value and __text are used as such wherever they
+// are. Rows without a value are left out.
+
+// queryTypeVariable is the DataQuery.QueryType of a variable query.
+const queryTypeVariable = "variable"
+
+// Field names of a variable query's frame, as Grafana's variable support
+// reads them.
+const (
+	variableValueField = "__value"
+	variableTextField  = "__text"
+)
+
+// isVariableQuery reports whether query fills a dashboard variable.
+func isVariableQuery(query backend.DataQuery, qm ArcQuery) bool {
+	return query.QueryType == queryTypeVariable || qm.VariableQuery || query.RefID == metricFindQueryRefID
+}
+
+// variableDefaults turns qm into a variable query: a table, never split,
+// without the last-value rewrite or Explore's defaults.
+func variableDefaults(qm ArcQuery) ArcQuery {
+	qm.VariableQuery = true
+	qm.Format = "table"
+	qm.TableLayout = ""
+	qm.SplitDuration = "off"
+	qm.LastValueOptimization = false
+	qm.App = ""
+	return qm
+}
+
+// variableFrames returns frames' rows as the single frame of a variable
+// query (see above). The frame keeps the first frame's RefID and meta, so
+// notices and decisions attached to the result carry over.
+func variableFrames(frames data.Frames) data.Frames {
+	values, texts := []string{}, []string{}
+	for _, frame := range frames {
+		valueField, textField := variableFields(frame)
+		if valueField == nil {
+			continue
+		}
+		for i := range valueField.Len() {
+			value, ok := fieldString(valueField, i)
+			if !ok {
+				continue
+			}
+			text := value
+			if textField != nil {
+				if t, ok := fieldString(textField, i); ok {
+					text = t
+				}
+			}
+			values, texts = append(values, value), append(texts, text)
+		}
+	}
+	out := data.NewFrame("", data.NewField(variableTextField, nil, texts), data.NewField(variableValueField, nil, values))
+	if len(frames) > 0 {
+		out.Name, out.RefID, out.Meta = frames[0].Name, frames[0].RefID, frames[0].Meta
+	}
+	if out.Meta == nil {
+		out.Meta = &data.FrameMeta{}
+	}
+	out.Meta.Type = data.FrameTypeTable
+	return data.Frames{out}
+}
+
+// variableFields picks frame's value and text fields; value is nil when
+// frame has no fields, text when it has no column for it.
+func variableFields(frame *data.Frame) (value, text *data.Field) {
+	for _, f := range frame.Fields {
+		switch {
+		case strings.EqualFold(f.Name, variableValueField):
+			value = f
+		case strings.EqualFold(f.Name, variableTextField):
+			text = f
+		}
+	}
+	if value != nil || text != nil {
+		if value == nil {
+			value = text
+		}
+		return value, text
+	}
+	if len(frame.Fields) == 0 {
+		return nil, nil
+	}
+	idx := 0
+	for i, f := range frame.Fields {
+		if f.Type().NonNullableType() == data.FieldTypeString {
+			idx = i
+			break
+		}
+	}
+	if idx+1 < len(frame.Fields) {
+		text = frame.Fields[idx+1]
+	}
+	return frame.Fields[idx], text
+}
@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// variableValues reads a variable frame back as value=text pairs.
+func variableValues(t *testing.T, frames data.Frames) []string {
+	t.Helper()
+	if len(frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(frames))
+	}
+	frame := frames[0]
+	if len(frame.Fields) != 2 || frame.Fields[0].Name != variableTextField || frame.Fields[1].Name != variableValueField {
+		t.Fatalf("fields = %v, want __text and __value", frame.Fields)
+	}
+	pairs := []string{}
+	for i := range frame.Rows() {
+		pairs = append(pairs, frame.Fields[1].At(i).(string)+"="+frame.Fields[0].At(i).(string))
+	}
+	return pairs
+}
+
+func TestVariableFrames(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(f float64) *float64 { return &f }
+	cases := []struct {
+		name   string
+		frames data.Frames
+		want   []string
+	}{
+		{
+			name:   "one column",
+			frames: data.Frames{data.NewFrame("", data.NewField("host", nil, []*string{str("a"), nil, str("b")}))},
+			want:   []string{"a=a", "b=b"},
+		},
+		{
+			name: "value and text",
+			frames: data.Frames{data.NewFrame("",
+				data.NewField("host", nil, []*string{str("a"), str("b")}),
+				data.NewField("label", nil, []*string{str("Host A"), nil}))},
+			want: []string{"a=Host A", "b=b"},
+		},
+		{
+			name: "first string column",
+			frames: data.Frames{data.NewFrame("",
+				data.NewField("id", nil, []*float64{num(1), num(2)}),
+				data.NewField("host", nil, []*string{str("a"), str("b")}))},
+			want: []string{"a=a", "b=b"},
+		},
+		{
+			name:   "no string column",
+			frames: data.Frames{data.NewFrame("", data.NewField("id", nil, []*float64{num(1), num(2.5)}))},
+			want:   []string{"1=1", "2.5=2.5"},
+		},
+		{
+			name: "named columns",
+			frames: data.Frames{data.NewFrame("",
+				data.NewField("__TEXT", nil, []*string{str("Host A")}),
+				data.NewField("other", nil, []*string{str("x")}),
+				data.NewField("__value", nil, []*float64{num(7)}))},
+			want: []string{"7=Host A"},
+		},
+		{
+			name:   "text only",
+			frames: data.Frames{data.NewFrame("", data.NewField("__text", nil, []*string{str("a")}))},
+			want:   []string{"a=a"},
+		},
+		{
+			name: "every frame",
+			frames: data.Frames{
+				data.NewFrame("", data.NewField("host", nil, []*string{str("a")})),
+				data.NewFrame(""),
+				data.NewFrame("", data.NewField("host", nil, []*string{str("b")})),
+			},
+			want: []string{"a=a", "b=b"},
+		},
+		{
+			name: "no frames",
+			want: []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := variableValues(t, variableFrames(c.frames)); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("values = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestQuery_VariableQuery(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = append(sent, body.SQL)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"columns": ["host"], "data": [["server-a"], ["server-b"], [null]]}`))
+	}))
+	defer srv.Close()
+	pctx := testPluginContext(t, srv.URL, map[string]any{"useArrow": false})
+
+	// A week would be split by default; a variable query runs once.
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	const sql = "SELECT DISTINCT host FROM cpu WHERE $__timeFilter(time)"
+	cases := []struct {
+		name  string
+		query backend.DataQuery
+	}{
+		{"query type", backend.DataQuery{RefID: "A", QueryType: queryTypeVariable, JSON: []byte(`{"sql":"` + sql + `","format":"time_series"}`)}},
+		{"flag", backend.DataQuery{RefID: "A", JSON: []byte(`{"sql":"` + sql + `","variableQuery":true}`)}},
+		{"metricFindQuery refId", backend.DataQuery{RefID: metricFindQueryRefID, JSON: []byte(`{"sql":"` + sql + `","format":"table"}`)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mu.Lock()
+			sent = nil
+			mu.Unlock()
+			c.query.TimeRange = backend.TimeRange{From: from, To: from.Add(7 * 24 * time.Hour)}
+			res, err := NewArcDatasource().QueryData(t.Context(), &backend.QueryDataRequest{
+				PluginContext: pctx,
+				Queries:       []backend.DataQuery{c.query},
+			})
+			if err != nil {
+				t.Fatalf("QueryData: %v", err)
+			}
+			resp := res.Responses[c.query.RefID]
+			if resp.Error != nil {
+				t.Fatalf("query: %v", resp.Error)
+			}
+			if got, want := variableValues(t, resp.Frames), []string{"server-a=server-a", "server-b=server-b"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("values = %q, want %q", got, want)
+			}
+			if resp.Frames[0].Fields[1].Type() != data.FieldTypeString {
+				t.Errorf("__value type = %s, want string", resp.Frames[0].Fields[1].Type())
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(sent) != 1 {
+				t.Fatalf("sent %d requests, want 1: %q", len(sent), sent)
+			}
+			if strings.Contains(sent[0], "$__") || !strings.Contains(sent[0], "2026-03-01T00:00:00") || !strings.Contains(sent[0], "2026-03-08T00:00:00") {
+				t.Errorf("sent %q, want the time filter expanded over the dashboard range", sent[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// arcVersion is a parsed Arc server version. Only major.minor.patch take
+// part in comparisons; pre-release and build suffixes ("-rc1", "+abc") are
+// kept in raw for display but otherwise ignored — a 1.6.0-rc1 server is
+// treated as 1.6.0, which is what people running release candidates expect.
+type arcVersion struct {
+	major, minor, patch int
+	raw                 string
+}
+
+// parseArcVersion accepts "1.4.2", "v1.4.2", "1.6" and "1.6.0-rc1+build".
+func parseArcVersion(s string) (arcVersion, error) {
+	raw := strings.TrimSpace(s)
+	core := strings.TrimPrefix(strings.TrimPrefix(raw, "v"), "V")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	parts := strings.Split(core, ".")
+	if core == "" || len(parts) > 3 {
+		return arcVersion{}, fmt.Errorf("invalid Arc version %q", s)
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return arcVersion{}, fmt.Errorf("invalid Arc version %q", s)
+		}
+		nums[i] = n
+	}
+	return arcVersion{major: nums[0], minor: nums[1], patch: nums[2], raw: strings.TrimPrefix(raw, "v")}, nil
+}
+
+// mustParseArcVersion is parseArcVersion for package-level feature tables.
+func mustParseArcVersion(s string) arcVersion {
+	v, err := parseArcVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (v arcVersion) String() string {
+	if v.raw != "" {
+		return v.raw
+	}
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// atLeast reports whether v >= want, comparing major.minor.patch only.
+func (v arcVersion) atLeast(want arcVersion) bool {
+	if v.major != want.major {
+		return v.major > want.major
+	}
+	if v.minor != want.minor {
+		return v.minor > want.minor
+	}
+	return v.patch >= want.patch
+}
+
+// arcFeature is an optional behavior that needs a minimum Arc version.
+// Features declare their entry here and call requireFeature before using
+// the server-side capability, so an old server produces a clear error
+// rather than an opaque SQL or decode failure.
+type arcFeature struct {
+	name       string // user-facing, plural: "async queries"
+	minVersion arcVersion
+}
+
+var featureAsyncQueries = arcFeature{name: "async queries", minVersion: mustParseArcVersion("1.6")}
+
+// errFeatureUnsupported is returned by requireFeature. The wrapped message
+// names the feature and both versions — nothing sensitive — so it is shown
+// to the user verbatim.
+var errFeatureUnsupported = errors.New("feature not supported by this Arc server")
+
+// arcVersionPath is the endpoint probed for the server version. Arc's health
+// endpoint reports it as `{"version": "..."}` and needs no SQL execution, so
+// probing it is cheap on a loaded server.
+const arcVersionPath = "/health"
+
+// versionProbeTimeout bounds a version probe independently of the query
+// timeout — it's a single small GET, and callers (CheckHealth, feature
+// checks) shouldn't wait the full query timeout on an unresponsive proxy.
+const versionProbeTimeout = 5 * time.Second
+
+// versionSource says where an instance's Arc version came from.
+type versionSource string
+
+const (
+	versionSourceDetected versionSource = "detected"
+	versionSourceOverride versionSource = "override"
+)
+
+// versionInfo is the cached result of version detection, also the body of
+// the GET /version resource.
+type versionInfo struct {
+	Version    string        `json:"version,omitempty"`
+	Source     versionSource `json:"source,omitempty"`
+	Error      string        `json:"error,omitempty"` // why detection failed (already user-safe)
+	DetectedAt time.Time     `json:"detectedAt,omitzero"`
+
+	parsed arcVersion
+	ok     bool
+}
+
+// arcVersionCache holds an instance's detected Arc version. Detection is
+// lazy — the first CheckHealth, feature check or GET /version probes, and
+// the answer is reused for the lifetime of the instance (i.e. until the
+// datasource is edited) or until a forced refresh. Probing eagerly in
+// newArcInstance would put an extra round trip on the first query's
+// critical path, and probing per query is what this cache exists to avoid.
+// Failed probes are cached too (for failedVersionProbeTTL) so a server
+// without the endpoint isn't hammered by every feature check.
+type arcVersionCache struct {
+	mu   sync.Mutex
+	info *versionInfo
+}
+
+// failedVersionProbeTTL is how long a failed detection is reused before the
+// next caller probes again.
+const failedVersionProbeTTL = time.Minute
+
+// arcVersion returns the Arc server version, probing on first use. A
+// configured ArcVersion override wins and never probes — it exists for
+// proxies that hide or rewrite the health endpoint. refresh forces a new
+// probe (ignored with an override).
+func (s *ArcInstanceSettings) arcVersion(ctx context.Context, refresh bool) versionInfo {
+	if s.settings.ArcVersion != "" {
+		// Validated in newArcInstance.
+		v, _ := parseArcVersion(s.settings.ArcVersion)
+		return versionInfo{Version: v.String(), Source: versionSourceOverride, parsed: v, ok: true}
+	}
+
+	c := s.versionCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !refresh && c.info != nil && (c.info.ok || time.Since(c.info.DetectedAt) < failedVersionProbeTTL) {
+		return *c.info
+	}
+	info := versionInfo{DetectedAt: time.Now()}
+	v, err := s.probeArcVersion(ctx)
+	if err != nil {
+		info.Error = sanitizeUserError("version", err)
+	} else {
+		info.Version, info.Source, info.parsed, info.ok = v.String(), versionSourceDetected, v, true
+	}
+	c.info = &info
+	return info
+}
+
+// probeArcVersion fetches and parses the version from arcVersionPath. The
+// probe is housekeeping traffic, so it is classified as health: it skips
+// the query limiter and stays out of the query metrics.
+func (s *ArcInstanceSettings) probeArcVersion(ctx context.Context) (arcVersion, error) {
+	ctx, cancel := context.WithTimeout(withRequestClass(ctx, requestClassHealth), versionProbeTimeout)
+	defer cancel()
+	body, err := s.doRequest(ctx, arcVersionPath, jsonMediaType, nil)
+	if err != nil {
+		return arcVersion{}, err
+	}
+	defer body.Close()
+
+	var health struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(io.LimitReader(body, 64*1024)).Decode(&health); err != nil {
+		return arcVersion{}, fmt.Errorf("failed to decode Arc health response: %w", err)
+	}
+	if health.Version == "" {
+		return arcVersion{}, errors.New("Arc health response did not include a version")
+	}
+	return parseArcVersion(health.Version)
+}
+
+// requireFeature returns nil when the Arc server supports f, otherwise an
+// errFeatureUnsupported naming the required and detected versions. An
+// undetectable version fails closed — silently attempting a feature the
+// server may not have is exactly the opaque failure this gate replaces —
+// and the message points at the override setting.
+func (s *ArcInstanceSettings) requireFeature(ctx context.Context, f arcFeature) error {
+	info := s.arcVersion(ctx, false)
+	if !info.ok {
+		return fmt.Errorf("%w: %s require Arc ≥ %s, but the server version could not be detected; set \"Arc Version\" in the datasource settings if a proxy hides it",
+			errFeatureUnsupported, f.name, f.minVersion)
+	}
+	if !info.parsed.atLeast(f.minVersion) {
+		return fmt.Errorf("%w: %s require Arc ≥ %s, detected %s", errFeatureUnsupported, f.name, f.minVersion, info.parsed)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseArcVersion(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		want    [3]int
+		wantErr bool
+	}{
+		{"1.4.2", [3]int{1, 4, 2}, false},
+		{"v1.6", [3]int{1, 6, 0}, false},
+		{" 2.0.1-rc1+abc ", [3]int{2, 0, 1}, false},
+		{"", [3]int{}, true},
+		{"1.x", [3]int{}, true},
+		{"1.2.3.4", [3]int{}, true},
+	} {
+		v, err := parseArcVersion(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseArcVersion(%q) err = %v, wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if !c.wantErr && [3]int{v.major, v.minor, v.patch} != c.want {
+			t.Errorf("parseArcVersion(%q) = %d.%d.%d, want %v", c.in, v.major, v.minor, v.patch, c.want)
+		}
+	}
+}
+
+func TestArcVersion_AtLeast(t *testing.T) {
+	v16 := mustParseArcVersion("1.6")
+	for in, want := range map[string]bool{"1.5.9": false, "1.6.0": true, "1.6.0-rc1": true, "1.10.0": true, "2.0": true, "0.9": false} {
+		if got := mustParseArcVersion(in).atLeast(v16); got != want {
+			t.Errorf("%s.atLeast(1.6) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+// versionServer answers Arc's health endpoint with the given version and
+// counts probes.
+func versionServer(t *testing.T, version string, probes *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != arcVersionPath {
+			http.NotFound(w, r)
+			return
+		}
+		probes.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "version": version})
+	}))
+}
+
+// TestRequireFeature_ClearErrorOnOldServer locks in the gating contract: the
+// version is probed once and cached, and an old server yields a message
+// naming both versions that survives sanitizeUserError.
+func TestRequireFeature_ClearErrorOnOldServer(t *testing.T) {
+	var probes atomic.Int32
+	srv := versionServer(t, "1.4.2", &probes)
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+
+	err := inst.requireFeature(t.Context(), featureAsyncQueries)
+	if !errors.Is(err, errFeatureUnsupported) {
+		t.Fatalf("expected errFeatureUnsupported, got %v", err)
+	}
+	want := "async queries require Arc ≥ 1.6, detected 1.4.2"
+	if msg := sanitizeUserError("A", err); !strings.Contains(msg, want) {
+		t.Errorf("user message %q missing %q", msg, want)
+	}
+	_ = inst.requireFeature(t.Context(), featureAsyncQueries)
+	if probes.Load() != 1 {
+		t.Errorf("expected the version to be probed once and cached, got %d probes", probes.Load())
+	}
+}
+
+func TestRequireFeature_OverrideSkipsProbe(t *testing.T) {
+	var probes atomic.Int32
+	srv := versionServer(t, "1.4.2", &probes)
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+	inst.settings.ArcVersion = "1.7.0"
+
+	if err := inst.requireFeature(t.Context(), featureAsyncQueries); err != nil {
+		t.Errorf("override 1.7.0 should satisfy async queries: %v", err)
+	}
+	if probes.Load() != 0 {
+		t.Errorf("override must not probe, got %d probes", probes.Load())
+	}
+}
+
+func TestRequireFeature_UndetectableFailsClosed(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	inst := newTestInstance(t, srv.URL)
+
+	err := inst.requireFeature(t.Context(), featureAsyncQueries)
+	if !errors.Is(err, errFeatureUnsupported) || !strings.Contains(err.Error(), "Arc Version") {
+		t.Errorf("expected fail-closed error pointing at the override, got %v", err)
+	}
+}
+
+func TestHandleVersion_ReportsAndRefreshes(t *testing.T) {
+	var probes atomic.Int32
+	srv := versionServer(t, "1.6.3", &probes)
+	defer srv.Close()
+	d := NewArcDatasource()
+	pctx := testPluginContext(t, srv.URL, nil)
+
+	status, body := callResource(t, d, pctx, http.MethodGet, "/version", nil)
+	if status != http.StatusOK || !strings.Contains(string(body), `"version":"1.6.3"`) || !strings.Contains(string(body), `"source":"detected"`) {
+		t.Fatalf("unexpected /version answer: %d %s", status, body)
+	}
+	callResource(t, d, pctx, http.MethodGet, "/version", nil)
+	callResource(t, d, pctx, http.MethodGet, "/version?refresh=true", nil)
+	if probes.Load() != 2 {
+		t.Errorf("expected 2 probes (initial + refresh), got %d", probes.Load())
+	}
+}
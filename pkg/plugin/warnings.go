@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Arc warnings: Arc flags a result it answered with reservations ("approximate
+// result", "stale replica") in X-Arc-Warning response headers, repeated once
+// per warning. Each becomes a warning notice on the frames decoded from that
+// response and is listed under Meta.Custom["arcWarnings"]. A split query
+// reports each distinct warning once, with how many chunks raised it.
+//
+// doRequest only sees headers and the decoders only see bodies, so queryArrow
+// and queryJSON put a warningSink on the context and doRequest fills it.
+
+// arcWarningHeader is the response header carrying one warning.
+const arcWarningHeader = "X-Arc-Warning"
+
+// arcWarningsMetaKey is the FrameMeta.Custom key holding the []arcWarning.
+const arcWarningsMetaKey = "arcWarnings"
+
+// Limits on what a response can put in front of the user.
+const (
+	maxArcWarnings   = 20
+	maxArcWarningLen = 256
+)
+
+// arcWarning is one distinct warning. Chunks is how many chunks of a split
+// query raised it, 0 for an unsplit query.
+type arcWarning struct {
+	Warning string `json:"warning"`
+	Chunks  int    `json:"chunks,omitempty"`
+}
+
+// warningSink collects the warnings of the response doRequest receives under
+// its context.
+type warningSink struct {
+	warnings []string
+}
+
+type warningSinkKey struct{}
+
+// withWarningSink returns ctx carrying a fresh sink.
+func withWarningSink(ctx context.Context) (context.Context, *warningSink) {
+	s := &warningSink{}
+	return context.WithValue(ctx, warningSinkKey{}, s), s
+}
+
+// collectArcWarnings adds the warnings in header to the sink on ctx, if any:
+// trimmed, truncated, without blanks and duplicates.
+func collectArcWarnings(ctx context.Context, header http.Header) {
+	s, _ := ctx.Value(warningSinkKey{}).(*warningSink)
+	if s == nil {
+		return
+	}
+	for _, w := range header.Values(arcWarningHeader) {
+		w = strings.TrimSpace(w)
+		if utf8.RuneCountInString(w) > maxArcWarningLen {
+			w = string([]rune(w)[:maxArcWarningLen]) + "..."
+		}
+		if w == "" || slices.Contains(s.warnings, w) || len(s.warnings) == maxArcWarnings {
+			continue
+		}
+		s.warnings = append(s.warnings, w)
+	}
+}
+
+// attachArcWarnings records warnings on frame as notices and under
+// arcWarningsMetaKey. chunks is the split query's chunk count, 0 when unsplit.
+func attachArcWarnings(frame *data.Frame, warnings []arcWarning, chunks int) {
+	if len(warnings) == 0 {
+		return
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		custom = map[string]interface{}{}
+		frame.Meta.Custom = custom
+	}
+	custom[arcWarningsMetaKey] = warnings
+	for _, w := range warnings {
+		text := "Arc: " + w.Warning
+		if w.Chunks > 0 {
+			text += fmt.Sprintf(" (%d of %d chunks)", w.Chunks, chunks)
+		}
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: text})
+	}
+}
+
+// arcWarnings returns the sink's warnings for attachArcWarnings.
+func (s *warningSink) arcWarnings() []arcWarning {
+	if len(s.warnings) == 0 {
+		return nil
+	}
+	out := make([]arcWarning, len(s.warnings))
+	for i, w := range s.warnings {
+		out[i] = arcWarning{Warning: w}
+	}
+	return out
+}
+
+// frameArcWarnings returns the warnings attachArcWarnings recorded on frame.
+func frameArcWarnings(frame *data.Frame) []arcWarning {
+	if frame == nil || frame.Meta == nil {
+		return nil
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	warnings, _ := custom[arcWarningsMetaKey].([]arcWarning)
+	return warnings
+}
+
+// mergeArcWarnings deduplicates the warnings of several chunk frames,
+// counting the chunks that raised each, in first-seen order.
+func mergeArcWarnings(frames []*data.Frame) []arcWarning {
+	var merged []arcWarning
+	index := map[string]int{}
+	for _, frame := range frames {
+		for _, w := range frameArcWarnings(frame) {
+			if i, ok := index[w.Warning]; ok {
+				merged[i].Chunks++
+				continue
+			}
+			index[w.Warning] = len(merged)
+			merged = append(merged, arcWarning{Warning: w.Warning, Chunks: 1})
+		}
+	}
+	return merged
+}
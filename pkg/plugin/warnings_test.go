@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/basekick-labs/grafana-arc-datasource/pkg/arcclient/arcclienttest"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestCollectArcWarnings(t *testing.T) {
+	header := http.Header{}
+	for _, w := range []string{"approximate result", "  stale replica ", "", "approximate result", strings.Repeat("x", 300)} {
+		header.Add(arcWarningHeader, w)
+	}
+	ctx, sink := withWarningSink(t.Context())
+	collectArcWarnings(ctx, header)
+
+	want := []string{"approximate result", "stale replica", strings.Repeat("x", maxArcWarningLen) + "..."}
+	if !reflect.DeepEqual(sink.warnings, want) {
+		t.Errorf("warnings = %q, want %q", sink.warnings, want)
+	}
+
+	// No sink on the context: nothing to do.
+	collectArcWarnings(t.Context(), header)
+}
+
+// noticeTexts returns the text of frame's notices.
+func noticeTexts(frame *data.Frame) []string {
+	if frame.Meta == nil {
+		return nil
+	}
+	var texts []string
+	for _, n := range frame.Meta.Notices {
+		texts = append(texts, n.Text)
+	}
+	return texts
+}
+
+func TestQuery_ArcWarnings(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}},
+		{Name: "v", Type: arrow.PrimitiveTypes.Float64},
+	}, nil)
+	stream := arcclienttest.ArrowStream(t, schema, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(time.Date(2026, 3, 8, 1, 0, 0, 0, time.UTC).UnixNano()))
+		b.Field(1).(*array.Float64Builder).Append(1)
+	})
+	var requests atomic.Int32
+	var warn func(n int32) []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, text := range warn(requests.Add(1)) {
+			w.Header().Add(arcWarningHeader, text)
+		}
+		if strings.HasSuffix(r.URL.Path, "/arrow") {
+			w.Header().Set("Content-Type", arrowStreamMediaType)
+			_, _ = w.Write(stream)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"columns": []string{"time", "v"},
+			"data":    []interface{}{[]interface{}{"2026-03-08T01:00:00Z", 1}},
+		})
+	}))
+	defer srv.Close()
+
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	run := func(t *testing.T, arrowProtocol bool, split string) *data.Frame {
+		t.Helper()
+		requests.Store(0)
+		inst := newTestInstance(t, srv.URL)
+		inst.settings.UseArrow = &arrowProtocol
+		q, _ := json.Marshal(map[string]interface{}{
+			"sql":           "SELECT time, v FROM cpu WHERE $__timeFilter(time)",
+			"format":        "table",
+			"splitDuration": split,
+		})
+		resp := NewArcDatasource().query(t.Context(), inst, backend.DataQuery{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: from, To: from.Add(4 * time.Hour)},
+			JSON:      q,
+		})
+		if resp.Error != nil {
+			t.Fatalf("query: %v", resp.Error)
+		}
+		return resp.Frames[0]
+	}
+
+	for _, arrowProtocol := range []bool{true, false} {
+		name := map[bool]string{true: "arrow", false: "json"}[arrowProtocol]
+
+		t.Run(name+" repeated headers", func(t *testing.T) {
+			warn = func(int32) []string { return []string{"approximate result", "stale replica", "approximate result"} }
+			frame := run(t, arrowProtocol, "off")
+			want := []arcWarning{{Warning: "approximate result"}, {Warning: "stale replica"}}
+			if got := frameArcWarnings(frame); !reflect.DeepEqual(got, want) {
+				t.Errorf("arcWarnings = %+v, want %+v", got, want)
+			}
+			if got := noticeTexts(frame); !reflect.DeepEqual(got, []string{"Arc: approximate result", "Arc: stale replica"}) {
+				t.Errorf("notices = %q", got)
+			}
+		})
+
+		t.Run(name+" no headers", func(t *testing.T) {
+			warn = func(int32) []string { return nil }
+			frame := run(t, arrowProtocol, "off")
+			if got := frameArcWarnings(frame); got != nil {
+				t.Errorf("arcWarnings = %+v, want none", got)
+			}
+			if got := noticeTexts(frame); len(got) != 0 {
+				t.Errorf("notices = %q, want none", got)
+			}
+		})
+	}
+
+	t.Run("split chunks", func(t *testing.T) {
+		// Four 1h chunks; every chunk is approximate, two hit a stale replica.
+		warn = func(n int32) []string {
+			if n%2 == 0 {
+				return []string{"approximate result", "stale replica"}
+			}
+			return []string{"approximate result"}
+		}
+		frame := run(t, false, "1h")
+		want := []arcWarning{{Warning: "approximate result", Chunks: 4}, {Warning: "stale replica", Chunks: 2}}
+		if got := frameArcWarnings(frame); !reflect.DeepEqual(got, want) {
+			t.Errorf("arcWarnings = %+v, want %+v", got, want)
+		}
+		if got := noticeTexts(frame); !reflect.DeepEqual(got, []string{"Arc: approximate result (4 of 4 chunks)", "Arc: stale replica (2 of 4 chunks)"}) {
+			t.Errorf("notices = %q", got)
+		}
+	})
+}
@@ -1,6 +1,7 @@
-import React, { ChangeEvent } from 'react';
-import { InlineField, Input, SecretInput, Switch, useStyles2 } from '@grafana/ui';
+import React, { ChangeEvent, FocusEvent } from 'react';
+import { InlineField, Input, RadioButtonGroup, SecretInput, SecureSocksProxySettings, Switch, useStyles2 } from '@grafana/ui';
 import { DataSourcePluginOptionsEditorProps, GrafanaTheme2 } from '@grafana/data';
+import { config } from '@grafana/runtime';
 import { css } from '@emotion/css';
 import { ArcDataSourceOptions, ArcSecureJsonData } from './types';
 
@@ -12,6 +13,12 @@ interface Props extends DataSourcePluginOptionsEditorProps<ArcDataSourceOptions,
 const LABEL_WIDTH = 26;
 const INPUT_WIDTH = 40;
 
+const NORMALIZE_UNICODE_OPTIONS = [
+  { label: 'Spaces', value: 'spaces' as const },
+  { label: 'Spaces and quotes', value: 'quotes' as const },
+  { label: 'Off', value: 'off' as const },
+];
+
 export function ConfigEditor(props: Props) {
   const { onOptionsChange, options } = props;
   const { jsonData, secureJsonFields, secureJsonData } = options;
@@ -25,6 +32,10 @@ export function ConfigEditor(props: Props) {
     onOptionsChange({ ...options, jsonData: { ...jsonData, database: event.target.value } });
   };
 
+  const onArcVersionChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, arcVersion: event.target.value.trim() || undefined } });
+  };
+
   // Numeric handlers split into onChange / onBlur so the user can clear
   // an input and type a new value without `parseInt('') → NaN` snapping
   // the field back to the default mid-keystroke.
@@ -35,7 +46,7 @@ export function ConfigEditor(props: Props) {
   // onBlur: clamp to the field's minimum + apply the default if the
   //   user left the input empty or below 1. Persists the final value.
   const handleNumericChange =
-    (key: 'timeout' | 'maxConcurrency' | 'maxResponseMB') =>
+    (key: 'timeout' | 'maxConcurrency' | 'maxResponseMB' | 'timeSeriesRowCap' | 'rawRowCap' | 'maxRows' | 'exploreMaxRows' | 'chunkCacheMB' | 'maxCellBytes' | 'maxSplitChunks' | 'maxRetries') =>
     (event: ChangeEvent<HTMLInputElement>) => {
       const parsed = parseInt(event.target.value, 10);
       const next = isNaN(parsed) ? undefined : parsed;
@@ -57,11 +68,47 @@ export function ConfigEditor(props: Props) {
   const onMaxConcurrencyBlur = handleNumericBlur('maxConcurrency', 4);
   const onMaxResponseMBChange = handleNumericChange('maxResponseMB');
   const onMaxResponseMBBlur = handleNumericBlur('maxResponseMB', 1024);
+  // No blur handler: empty (auto), 0 (auto) and negative (off) are all valid.
+  const onTimeSeriesRowCapChange = handleNumericChange('timeSeriesRowCap');
+  const onRawRowCapChange = handleNumericChange('rawRowCap');
+  const onMaxRowsChange = handleNumericChange('maxRows');
+  const onExploreMaxRowsChange = handleNumericChange('exploreMaxRows');
+  const onChunkCacheMBChange = handleNumericChange('chunkCacheMB');
+  const onMaxCellBytesChange = handleNumericChange('maxCellBytes');
+  const onMaxSplitChunksChange = handleNumericChange('maxSplitChunks');
+  // No blur handler: empty (default), 0 (default) and negative (off) are all valid.
+  const onMaxRetriesChange = handleNumericChange('maxRetries');
+
+  const onTimeColumnNamesChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, timeColumnNames: event.target.value.trim() || undefined } });
+  };
+
+  const onChunkCacheHorizonChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, chunkCacheHorizon: event.target.value.trim() || undefined } });
+  };
 
   const onUseArrowChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...jsonData, useArrow: event.target.checked } });
   };
 
+  const onAuthHeaderNameChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, authHeaderName: event.target.value.trim() || undefined } });
+  };
+
+  // Not trimmed: the prefix's trailing space separates it from the key,
+  // and clearing the field means "send the raw key".
+  const onAuthHeaderPrefixChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, authHeaderPrefix: event.target.value } });
+  };
+
+  const onRequireAuthChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, requireAuth: event.target.checked } });
+  };
+
+  const onOAuthPassThruChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, oauthPassThru: event.target.checked } });
+  };
+
   const onAllowPrivateIPsChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, jsonData: { ...jsonData, allowPrivateIPs: event.target.checked } });
   };
@@ -70,11 +117,145 @@ export function ConfigEditor(props: Props) {
     onOptionsChange({ ...options, jsonData: { ...jsonData, allowDatabaseOverride: event.target.checked } });
   };
 
+  const onExplainBlockedQueriesChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, explainBlockedQueries: event.target.checked } });
+  };
+
+  const onFailOnConversionErrorsChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, failOnConversionErrors: event.target.checked } });
+  };
+
+  const onStrictModeChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, strictMode: event.target.checked } });
+  };
+
+  const onQueryAttributionChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, queryAttribution: event.target.checked } });
+  };
+
+  const onAttributionTemplateChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, attributionTemplate: event.target.value.trim() || undefined } });
+  };
+
+  const onForwardGrafanaUserChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, forwardGrafanaUser: event.target.checked } });
+  };
+
+  const onServiceIdentityChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, serviceIdentity: event.target.value.trim() || undefined } });
+  };
+
+  const onHideAttributionChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, hideAttribution: event.target.checked } });
+  };
+
+  const onNormalizeUnicodeChange = (value: 'spaces' | 'quotes' | 'off') => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, normalizeUnicode: value } });
+  };
+
+  const onCaptureFailuresChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, captureFailures: event.target.checked } });
+  };
+
+  const onSlowQueryThresholdChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, slowQueryThreshold: event.target.value.trim() || undefined } });
+  };
+
+  const onQueryTimeoutChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, queryTimeout: event.target.value.trim() || undefined } });
+  };
+
+  const onCatalogCacheTTLChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, catalogCacheTTL: event.target.value.trim() || undefined } });
+  };
+
+  const onAdhocTableChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, adhocTable: event.target.value.trim() || undefined } });
+  };
+
+  const onCancelSupersededChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, cancelSuperseded: event.target.checked } });
+  };
+
+  const onCaptureSlowQueryPlansChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, captureSlowQueryPlans: event.target.checked } });
+  };
+
+  // Parsed on blur, so typing "429, 5" isn't rewritten mid-list. Empty
+  // means the default set; "none" disables retries.
+  const onRetryStatusCodesBlur = (event: FocusEvent<HTMLInputElement>) => {
+    const text = event.target.value.trim();
+    let codes: number[] | undefined;
+    if (text.toLowerCase() === 'none') {
+      codes = [];
+    } else if (text !== '') {
+      codes = text
+        .split(/[\s,]+/)
+        .map((part) => parseInt(part, 10))
+        .filter((code) => !isNaN(code));
+    }
+    onOptionsChange({ ...options, jsonData: { ...jsonData, retryStatusCodes: codes } });
+  };
+
+  // Parsed on blur like the retry codes: comma- or space-separated names.
+  const onRedactColumnsBlur = (event: FocusEvent<HTMLInputElement>) => {
+    const columns = event.target.value
+      .split(/[\s,]+/)
+      .map((part) => part.trim())
+      .filter((part) => part !== '');
+    onOptionsChange({ ...options, jsonData: { ...jsonData, redactColumns: columns.length > 0 ? columns : undefined } });
+  };
+
+  // A JSON object of query options, parsed on blur; text that isn't one is
+  // left unsaved.
+  const onQueryDefaultsBlur = (event: FocusEvent<HTMLInputElement>) => {
+    const text = event.target.value.trim();
+    if (text === '') {
+      onOptionsChange({ ...options, jsonData: { ...jsonData, queryDefaults: undefined } });
+      return;
+    }
+    try {
+      const parsed = JSON.parse(text);
+      if (parsed !== null && typeof parsed === 'object' && !Array.isArray(parsed)) {
+        onOptionsChange({ ...options, jsonData: { ...jsonData, queryDefaults: parsed } });
+      }
+    } catch {
+      // Not JSON: keep the saved defaults.
+    }
+  };
+
+  const onExactUint64Change = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, exactUint64: event.target.checked } });
+  };
+
+  const onPreferNumericChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, preferNumeric: event.target.checked } });
+  };
+
+  const onAdaptiveExecutionChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, adaptiveExecution: event.target.checked } });
+  };
+
+  const onEnrichFieldMetadataChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, enrichFieldMetadata: event.target.checked } });
+  };
+
+  const onDurationUnitsFromNamesChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, durationUnitsFromNames: event.target.checked } });
+  };
+
+  const onFixtureModeChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, fixtureMode: event.target.value.trim() || undefined } });
+  };
+
+  const onFixtureRecordChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, jsonData: { ...jsonData, fixtureRecord: event.target.checked } });
+  };
+
   const onAPIKeyChange = (event: ChangeEvent<HTMLInputElement>) => {
-    // Spread existing secureJsonData rather than overwrite. Currently
-    // `apiKey` is the only secure field, but if another lands later the
-    // overwrite form would silently drop it on every keystroke in the API
-    // key input. `onResetAPIKey` below already uses this pattern.
+    // Spread existing secureJsonData rather than overwrite: the overwrite
+    // form would silently drop the named credentials on every keystroke in
+    // the API key input. `onResetAPIKey` below already uses this pattern.
     onOptionsChange({ ...options, secureJsonData: { ...secureJsonData, apiKey: event.target.value } });
   };
 
@@ -86,6 +267,18 @@ export function ConfigEditor(props: Props) {
     });
   };
 
+  const onCredentialsChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, secureJsonData: { ...secureJsonData, credentials: event.target.value } });
+  };
+
+  const onResetCredentials = () => {
+    onOptionsChange({
+      ...options,
+      secureJsonFields: { ...secureJsonFields, credentials: false },
+      secureJsonData: { ...secureJsonData, credentials: '' },
+    });
+  };
+
   return (
     <div className="gf-form-group">
       <h3 className="page-heading">Arc Connection</h3>
@@ -110,6 +303,62 @@ export function ConfigEditor(props: Props) {
         />
       </InlineField>
 
+      <InlineField
+        label="Require Auth"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Refuse to run without an API key. Turn off for an Arc running without authentication (dev, air-gapped): with no key set, requests are sent without an Authorization header."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.requireAuth ?? true} onChange={onRequireAuthChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Auth Header"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Header the API key is sent in, for gateways in front of Arc that expect e.g. X-API-Key. Empty = Authorization."
+      >
+        <Input
+          width={INPUT_WIDTH}
+          value={jsonData.authHeaderName ?? ''}
+          placeholder="Authorization"
+          onChange={onAuthHeaderNameChange}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Auth Header Prefix"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Put before the key in the auth header, trailing space included. Clear it to send the raw key (usual with X-API-Key)."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.authHeaderPrefix ?? 'Bearer '} onChange={onAuthHeaderPrefixChange} />
+      </InlineField>
+
+      <InlineField
+        label="Forward OAuth Identity"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Send the signed-in user's OAuth token to Arc as Authorization instead of the API key, so Arc authorizes each user. Requests without a token (alerting, users signed in without OAuth) use the API key; Save & Test can only check the token of the user running it."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.oauthPassThru ?? false} onChange={onOAuthPassThruChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Named Credentials"
+        labelWidth={LABEL_WIDTH}
+        tooltip='Extra Arc API keys a query can select by name, as JSON: {"admin": "<key>", "readonly": "<key>"}. Only Editors and Admins can run a query that names one.'
+      >
+        <SecretInput
+          width={INPUT_WIDTH}
+          isConfigured={secureJsonFields?.credentials || false}
+          value={secureJsonData?.credentials || ''}
+          placeholder='{"admin": "<key>"}'
+          onChange={onCredentialsChange}
+          onReset={onResetCredentials}
+        />
+      </InlineField>
+
       <InlineField
         label="Database"
         labelWidth={LABEL_WIDTH}
@@ -123,9 +372,14 @@ export function ConfigEditor(props: Props) {
         />
       </InlineField>
 
+      {/* Private Datacenter Connect: offered only when Grafana has a secure socks proxy configured. */}
+      {config.secureSocksDSProxyEnabled && (
+        <SecureSocksProxySettings options={options} onOptionsChange={onOptionsChange} />
+      )}
+
       <h3 className="page-heading">Advanced Settings</h3>
 
-      <InlineField label="Timeout" labelWidth={LABEL_WIDTH} tooltip="Query timeout in seconds">
+      <InlineField label="Timeout" labelWidth={LABEL_WIDTH} tooltip="Timeout of each request to Arc, in seconds. A split query makes one request per chunk; see Query Timeout for a bound on the whole query.">
         <Input
           width={INPUT_WIDTH}
           type="number"
@@ -136,10 +390,28 @@ export function ConfigEditor(props: Props) {
         />
       </InlineField>
 
+      <InlineField
+        label="Query Timeout"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Longest a whole query may take, including every chunk of a split query and every retry, e.g. 2m. The query fails with a timeout error past it. Empty means no limit beyond Grafana's own."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.queryTimeout ?? ''} placeholder="none" onChange={onQueryTimeoutChange} />
+      </InlineField>
+
+      <InlineField
+        label="Cancel Superseded"
+        labelWidth={LABEL_WIDTH}
+        tooltip="When a dashboard panel's query runs again while the previous run is still waiting on Arc, for example after the user edits the panel or changes the time range, cancel the previous run so it stops holding concurrency slots. Runs are matched by user, dashboard, panel and refId; Explore and alert rules are never cancelled."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.cancelSuperseded ?? true} onChange={onCancelSupersededChange} />
+        </div>
+      </InlineField>
+
       <InlineField
         label="Max Concurrency"
         labelWidth={LABEL_WIDTH}
-        tooltip="Maximum parallel chunks for query splitting. Each Grafana panel can spawn up to this many concurrent Arc requests. Lower values reduce Arc load in multi-user deployments."
+        tooltip="Maximum concurrent Arc requests for this datasource, shared by the queries of a dashboard refresh and the chunks of split queries. Lower values reduce Arc load in multi-user deployments."
       >
         <Input
           width={INPUT_WIDTH}
@@ -151,6 +423,20 @@ export function ConfigEditor(props: Props) {
         />
       </InlineField>
 
+      <InlineField
+        label="Max Split Chunks"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Most chunks a split query is cut into. A range that would take more runs in larger chunks instead, a multiple of the requested split duration, and the query says so in a notice. Empty uses 100; at most 10000."
+      >
+        <Input
+          width={INPUT_WIDTH}
+          type="number"
+          value={jsonData.maxSplitChunks ?? ''}
+          placeholder="100"
+          onChange={onMaxSplitChunksChange}
+        />
+      </InlineField>
+
       <InlineField
         label="Max Response MB"
         labelWidth={LABEL_WIDTH}
@@ -166,10 +452,153 @@ export function ConfigEditor(props: Props) {
         />
       </InlineField>
 
+      <InlineField
+        label="Time Series Row Cap"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Safety net for time-series queries using $__timeGroup without a LIMIT: a LIMIT is appended and the panel warns when it is hit. Empty = auto (max data points × 10 × estimated series), -1 = off. Raw and table queries are only capped by the Raw Row Cap."
+      >
+        <Input
+          width={INPUT_WIDTH}
+          type="number"
+          value={jsonData.timeSeriesRowCap ?? ''}
+          placeholder="auto"
+          onChange={onTimeSeriesRowCapChange}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Raw Row Cap"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Safety net for table and raw queries (no $__timeGroup) without a LIMIT, so an unbounded SELECT can't pull millions of rows: a LIMIT of max data points × estimated series, at most this many rows, is appended and the panel warns when it is hit. Nothing is appended when the panel sends no max data points. Empty or 0 = 1000000, -1 = off."
+      >
+        <Input width={INPUT_WIDTH} type="number" value={jsonData.rawRowCap ?? ''} placeholder="1000000" onChange={onRawRowCapChange} />
+      </InlineField>
+
+      <InlineField
+        label="Max Rows"
+        labelWidth={LABEL_WIDTH}
+        tooltip="LIMIT appended to every query that has no LIMIT and no per-query row limit of its own; the panel warns when it is hit. Takes precedence over the time-series row cap. Empty or 0 = none."
+      >
+        <Input width={INPUT_WIDTH} type="number" value={jsonData.maxRows ?? ''} placeholder="none" onChange={onMaxRowsChange} />
+      </InlineField>
+
+      <InlineField
+        label="Explore Max Rows"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Row preview cap for queries run from Explore, used instead of Max Rows and the time-series row cap. A LIMIT or row limit in the query still wins. Empty or 0 = 10000, -1 = none."
+      >
+        <Input width={INPUT_WIDTH} type="number" value={jsonData.exploreMaxRows ?? ''} placeholder="10000" onChange={onExploreMaxRowsChange} />
+      </InlineField>
+
+      <InlineField
+        label="Max Cell Bytes"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Text values longer than this many bytes are cut and end with an ellipsis, so one huge value (e.g. a JSON blob) can't stall the panel; the panel warns with the count per column. Empty or 0 = 1 MiB, -1 = never cut."
+      >
+        <Input width={INPUT_WIDTH} type="number" value={jsonData.maxCellBytes ?? ''} placeholder="1048576" onChange={onMaxCellBytesChange} />
+      </InlineField>
+
+      <InlineField
+        label="Time Column Names"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Comma-separated columns read as time in JSON results, whether they hold timestamps as text or epoch numbers, e.g. ts, created_at. Other columns are time when their text looks like a timestamp or a date. Empty = time, timestamp, _time. Queries can set their own list."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.timeColumnNames ?? ''} placeholder="time, timestamp, _time" onChange={onTimeColumnNamesChange} />
+      </InlineField>
+
+      <InlineField
+        label="Chunk Cache MB"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Cache the results of split-query chunks that lie entirely in the past, so a long-range dashboard refresh only fetches the recent chunks. Memory budget in MiB per datasource; empty or 0 disables the cache. Hits and misses appear in the query inspector's frame meta."
+      >
+        <Input
+          width={INPUT_WIDTH}
+          type="number"
+          value={jsonData.chunkCacheMB ?? ''}
+          placeholder="disabled"
+          onChange={onChunkCacheMBChange}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Chunk Cache Horizon"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Chunks ending more than this long ago are treated as final and cached, e.g. 10m or 1h. Raise it if Arc receives late or backfilled data."
+        disabled={!jsonData.chunkCacheMB}
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.chunkCacheHorizon ?? ''} placeholder="10m" onChange={onChunkCacheHorizonChange} />
+      </InlineField>
+
+      <InlineField
+        label="Catalog Cache TTL"
+        labelWidth={LABEL_WIDTH}
+        tooltip="How long the database, table and column lists used for autocomplete are reused before Arc is asked again, e.g. 60s or 5m. Lower it if tables are created often; 0 asks Arc on every lookup."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.catalogCacheTTL ?? ''} placeholder="60s" onChange={onCatalogCacheTTLChange} />
+      </InlineField>
+
+      <InlineField
+        label="Ad Hoc Table"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Table whose columns an ad hoc filters variable offers as keys, and whose distinct values it offers for each. Filters apply to every query: where $__adhocFilter is, or added to the WHERE clause."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.adhocTable ?? ''} placeholder="cpu" onChange={onAdhocTableChange} />
+      </InlineField>
+
+      <InlineField
+        label="Query Defaults"
+        labelWidth={LABEL_WIDTH}
+        tooltip='Default values for query options a query does not set, as a JSON object keyed like the query model, e.g. {"orderByTime": true, "rowLimit": 10000}. A value a query sets wins, even false or 0. The SQL itself cannot have a default. The query inspector lists the defaults a query took under decisions.'
+      >
+        <Input
+          width={INPUT_WIDTH}
+          key={JSON.stringify(jsonData.queryDefaults ?? {})}
+          defaultValue={jsonData.queryDefaults ? JSON.stringify(jsonData.queryDefaults) : ''}
+          placeholder='{"orderByTime": true}'
+          onBlur={onQueryDefaultsBlur}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Retry Status Codes"
+        labelWidth={LABEL_WIDTH}
+        tooltip="HTTP statuses from Arc (or a gateway in front of it) that are safe to retry, comma-separated. A request answered with one is sent again up to Max Retries more times, with backoff and honoring Retry-After. Empty uses 429, 502, 503, 504; 'none' disables retries. Only 4xx and 5xx statuses are allowed. Save & test shows the effective set."
+      >
+        <Input
+          width={INPUT_WIDTH}
+          key={(jsonData.retryStatusCodes ?? ['default']).join(',')}
+          defaultValue={jsonData.retryStatusCodes ? jsonData.retryStatusCodes.join(', ') || 'none' : ''}
+          placeholder="429, 502, 503, 504"
+          onBlur={onRetryStatusCodesBlur}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Max Retries"
+        labelWidth={LABEL_WIDTH}
+        tooltip="How many times a request is sent again after a retry status above or a dropped, reset or refused connection, waiting about 250ms, then twice as long each time, or what Retry-After asks. Each chunk of a split query retries on its own. Empty uses 2; a negative number turns retries off; at most 10."
+      >
+        <Input
+          width={INPUT_WIDTH}
+          type="number"
+          value={jsonData.maxRetries ?? ''}
+          placeholder="2"
+          onChange={onMaxRetriesChange}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Arc Version"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Leave empty to detect the Arc server version automatically. Set it (e.g. 1.6.0) only when a proxy hides Arc's health endpoint; features that need a newer Arc are gated on this version."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.arcVersion ?? ''} placeholder="auto-detect" onChange={onArcVersionChange} />
+      </InlineField>
+
       <InlineField
         label="Use Arrow Protocol"
         labelWidth={LABEL_WIDTH}
-        tooltip="Apache Arrow is a columnar binary format. 3–5x faster than JSON on the wire and on the plugin's decode hot path. Keep enabled unless debugging."
+        tooltip="Apache Arrow is a columnar binary format. 3–5x faster than JSON on the wire and on the plugin's decode hot path. Keep enabled unless debugging. Never toggled (e.g. provisioned without useArrow): Arrow is used when the server supports it, JSON otherwise — Save & test shows which."
       >
         <div className={styles.switchCell}>
           <Switch value={jsonData.useArrow ?? true} onChange={onUseArrowChange} />
@@ -195,6 +624,219 @@ export function ConfigEditor(props: Props) {
           <Switch value={jsonData.allowDatabaseOverride ?? false} onChange={onAllowDatabaseOverrideChange} />
         </div>
       </InlineField>
+
+      <InlineField
+        label="Explain Blocked Queries"
+        labelWidth={LABEL_WIDTH}
+        tooltip="When role restrictions or the database override guard refuse a query, return a one-row table next to the error naming the policy, the offending part of the query and how to fix it, so table panels and Explore show it. The frame is marked arcExplanation in its meta and is never returned to alert rules."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.explainBlockedQueries ?? false} onChange={onExplainBlockedQueriesChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Redact Columns"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Columns whose values the plugin's debug log shows as ***: in the first row of each result, and in string literals the query compares them with (email = '...', email IN (...)). Other result values are logged cut to 64 characters, for at most 20 columns."
+      >
+        <Input
+          width={INPUT_WIDTH}
+          key={(jsonData.redactColumns ?? []).join(',')}
+          defaultValue={(jsonData.redactColumns ?? []).join(', ')}
+          placeholder="email, ssn"
+          onBlur={onRedactColumnsBlur}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Fail on Conversion Errors"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Fail the query when values can't be converted to their column's type (e.g. unparseable timestamps). Off by default — such values become null and the panel shows a warning with the affected column and count."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.failOnConversionErrors ?? false} onChange={onFailOnConversionErrorsChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Strict Mode"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Fail the query instead of changing its result in any way: nulling values that can't be converted, guessing the unit of numeric timestamps, rounding integers beyond 2^53, counting interval months as 30 days, truncating rows or series, collapsing duplicate rows in the time-series conversion, or dropping split chunks with a different schema. The error names the change that was about to happen."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.strictMode ?? false} onChange={onStrictModeChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Exact Large Integers"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Unsigned 64-bit columns with a value beyond 2^53 can't be represented exactly as numbers in expressions or the browser. When on, such a column is shown as text with a notice; when off, its values are silently rounded. Arrow protocol only: JSON responses are already rounded when they arrive."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.exactUint64 ?? true} onChange={onExactUint64Change} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Prefer Numeric"
+        labelWidth={LABEL_WIDTH}
+        tooltip="With Exact Large Integers on: keep large unsigned integer columns numeric (rounded to float64) instead of text, and show a precision-loss notice. For panels that need numbers, such as graphs and thresholds."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.preferNumeric ?? false} onChange={onPreferNumericChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Capture Failures"
+        labelWidth={LABEL_WIDTH}
+        tooltip="When a response can't be converted to a frame, keep its raw body (first 8 MiB) in a temp file and log the path, so it can be attached to a bug report. The last 3 captures are kept; admins download the latest from /api/datasources/uid/<uid>/resources/debug/last-failure (add ?info=true for the failed queries, with secrets masked). Captures contain query results."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.captureFailures ?? false} onChange={onCaptureFailuresChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Slow Query Threshold"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Log a warning for queries Arc takes longer than this to answer, e.g. 5s or 1m, with their duration and SQL (Redact Columns applies). Empty disables it."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.slowQueryThreshold ?? ''} placeholder="off" onChange={onSlowQueryThresholdChange} />
+      </InlineField>
+
+      <InlineField
+        label="Capture Slow Query Plans"
+        labelWidth={LABEL_WIDTH}
+        tooltip="After a slow query, run EXPLAIN for it in the background with the same API key and database, at most once every 10 seconds and only for single SELECT statements. The slow-query log line names the capture; admins list the last 20 plans at /api/datasources/uid/<uid>/resources/debug/slow-plans."
+        disabled={!jsonData.slowQueryThreshold}
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.captureSlowQueryPlans ?? false} onChange={onCaptureSlowQueryPlansChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Normalize Pasted SQL"
+        labelWidth={LABEL_WIDTH}
+        tooltip="SQL pasted from wikis or chat often carries a byte order mark, non-breaking or zero-width spaces, or curly quotes, which Arc rejects with confusing syntax errors. Spaces: remove the BOM and fix spaces outside string literals. Spaces and quotes: also turn ‘curly’ quotes around a literal into straight ones. The panel shows a notice when the query was changed."
+      >
+        <RadioButtonGroup
+          options={NORMALIZE_UNICODE_OPTIONS}
+          value={jsonData.normalizeUnicode ?? 'spaces'}
+          onChange={onNormalizeUnicodeChange}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Query Attribution"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Prepend a comment like /* grafana dashboard=<uid> panel=<id> user=<login> refId=A */ to every query sent to Arc, so load can be attributed to dashboards in Arc's query log. Off by default: user logins end up in Arc's logs."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.queryAttribution ?? false} onChange={onQueryAttributionChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Attribution Template"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Text of the attribution comment. Placeholders: ${dashboard}, ${panel}, ${org}, ${user}, ${refId}. Values are reduced to letters, digits and ._-@: so they can't end the comment."
+        disabled={!jsonData.queryAttribution}
+      >
+        <Input
+          width={INPUT_WIDTH}
+          value={jsonData.attributionTemplate ?? ''}
+          placeholder="grafana dashboard=${dashboard} panel=${panel} user=${user} refId=${refId}"
+          onChange={onAttributionTemplateChange}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Hide Attribution"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Leave the attribution comment out of the executed SQL shown in the query inspector. Arc still receives it."
+        disabled={!jsonData.queryAttribution}
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.hideAttribution ?? false} onChange={onHideAttributionChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Forward Grafana User"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Send the Grafana user's login and org in X-Grafana-User and X-Grafana-Org-Id headers with every request to Arc, so Arc's audit log can attribute queries to users. Off by default: user logins end up in Arc's logs."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.forwardGrafanaUser ?? false} onChange={onForwardGrafanaUserChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Service Identity"
+        labelWidth={LABEL_WIDTH}
+        tooltip="X-Grafana-User sent for requests without a user, such as alert rule evaluations."
+        disabled={!jsonData.forwardGrafanaUser}
+      >
+        <Input
+          width={INPUT_WIDTH}
+          value={jsonData.serviceIdentity ?? ''}
+          placeholder="grafana"
+          onChange={onServiceIdentityChange}
+        />
+      </InlineField>
+
+      <InlineField
+        label="Adaptive Execution"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Estimate each query's row count with a cheap count(*) first, then pick JSON (≤ 10,000 rows) or Arrow, skip auto splitting below 500,000 rows, and drop the time-series row cap when the result fits. Only settings left on auto are changed; the decision is shown in the query inspector's frame meta. If the estimate fails the query runs as configured."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.adaptiveExecution ?? false} onChange={onAdaptiveExecutionChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Field Metadata"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Show column comments from Arc's DESCRIBE as field descriptions (on hover in tables) and record native column types in the frame meta. Tables are read from the query's FROM/JOIN clauses; DESCRIBE answers are cached for 10 minutes, and failures are ignored."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.enrichFieldMetadata ?? false} onChange={onEnrichFieldMetadataChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Duration Units"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Set the display unit of numeric columns named like request_duration_ms, latency_us or elapsed_seconds from their suffix. DURATION and INTERVAL columns always display as seconds."
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.durationUnitsFromNames ?? false} onChange={onDurationUnitsFromNamesChange} />
+        </div>
+      </InlineField>
+
+      <InlineField
+        label="Fixture Directory"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Test mode: answer queries from canned responses in this directory on the Grafana server (path or file:// URL) instead of Arc. A query without a fixture fails with the file name to add. Leave empty for normal operation."
+      >
+        <Input width={INPUT_WIDTH} value={jsonData.fixtureMode ?? ''} placeholder="disabled" onChange={onFixtureModeChange} />
+      </InlineField>
+
+      <InlineField
+        label="Record Fixtures"
+        labelWidth={LABEL_WIDTH}
+        tooltip="Query the live Arc and save every successful response into the fixture directory. Fixtures match the exact SQL sent, so record with an absolute time range."
+        disabled={!jsonData.fixtureMode}
+      >
+        <div className={styles.switchCell}>
+          <Switch value={jsonData.fixtureRecord ?? false} onChange={onFixtureRecordChange} />
+        </div>
+      </InlineField>
     </div>
   );
 }
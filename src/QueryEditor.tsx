@@ -1,6 +1,6 @@
-import React, { useEffect } from 'react';
+import React, { useEffect, useState } from 'react';
 import { GrafanaTheme2, QueryEditorProps, SelectableValue } from '@grafana/data';
-import { InlineField, Input, TextArea, RadioButtonGroup, Select, useStyles2 } from '@grafana/ui';
+import { InlineField, InlineSwitch, Input, TextArea, RadioButtonGroup, Select, useStyles2 } from '@grafana/ui';
 import { css } from '@emotion/css';
 import { ArcDataSource } from './datasource';
 import { ArcDataSourceOptions, ArcQuery } from './types';
@@ -10,6 +10,7 @@ type Props = QueryEditorProps<ArcDataSource, ArcQuery, ArcDataSourceOptions>;
 const FORMAT_OPTIONS = [
   { label: 'Time series', value: 'time_series' as const },
   { label: 'Table', value: 'table' as const },
+  { label: 'Numeric table', value: 'numeric_table' as const },
 ];
 
 const SPLIT_OPTIONS = [
@@ -23,8 +24,27 @@ const SPLIT_OPTIONS = [
   { label: '7 days', value: '7d' },
 ];
 
-export function QueryEditor({ query, onChange, onRunQuery }: Props) {
+const TABLE_LAYOUT_OPTIONS = [
+  { label: 'Long', value: 'long' as const },
+  { label: 'Wide', value: 'wide' as const },
+];
+
+const PROTOCOL_OPTIONS = [
+  { label: 'Datasource', value: '' },
+  { label: 'Arrow', value: 'arrow' },
+  { label: 'JSON', value: 'json' },
+  { label: 'Auto', value: 'auto' },
+];
+
+const OVERFLOW_OPTIONS = [
+  { label: 'Truncate', value: 'truncate' as const },
+  { label: 'Error', value: 'error' as const },
+  { label: 'Sum into "Other"', value: 'aggregateOther' as const },
+];
+
+export function QueryEditor({ query, onChange, onRunQuery, datasource, range }: Props) {
   const styles = useStyles2(getStyles);
+  const [splitHint, setSplitHint] = useState('');
 
   // One-time migration: dashboards copied from Postgres / MySQL / MSSQL /
   // ClickHouse use `rawSql`; Arc uses `sql`. Pull the old field over once
@@ -38,15 +58,51 @@ export function QueryEditor({ query, onChange, onRunQuery }: Props) {
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, []);
 
+  // The chunking for the current time range comes from the backend, which
+  // owns the auto ladder, and follows the time picker.
+  const from = range?.from.valueOf();
+  const to = range?.to.valueOf();
+  useEffect(() => {
+    if (!range) {
+      return;
+    }
+    let current = true;
+    datasource
+      .getSplitPreview(range, query.splitDuration)
+      .then(
+        (preview) => {
+          if (current) {
+            const capped = preview.requestedChunk ? ` (${preview.requestedChunk} would take over ${preview.maxSplitChunks})` : '';
+            setSplitHint(preview.warning ?? (preview.split ? `${preview.chunk} chunks for this range${capped}` : 'not split for this range'));
+          }
+        },
+        () => {
+          if (current) {
+            setSplitHint('');
+          }
+        }
+      );
+    return () => {
+      current = false;
+    };
+    // range is compared by its bounds: the object changes on every render.
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [datasource, query.splitDuration, from, to]);
+
   const onSQLChange = (event: React.ChangeEvent<HTMLTextAreaElement>) => {
     onChange({ ...query, sql: event.target.value });
   };
 
-  const onFormatChange = (value: 'time_series' | 'table') => {
+  const onFormatChange = (value: 'time_series' | 'table' | 'numeric_table') => {
     onChange({ ...query, format: value });
     onRunQuery();
   };
 
+  const onTableLayoutChange = (value: 'long' | 'wide') => {
+    onChange({ ...query, tableLayout: value });
+    onRunQuery();
+  };
+
   const onSplitChange = (option: SelectableValue<string>) => {
     onChange({ ...query, splitDuration: option?.value || 'auto' });
     onRunQuery();
@@ -56,6 +112,58 @@ export function QueryEditor({ query, onChange, onRunQuery }: Props) {
     onChange({ ...query, database: event.target.value });
   };
 
+  const onCredentialChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onChange({ ...query, credential: event.target.value.trim() || undefined });
+  };
+
+  const onProtocolChange = (option: SelectableValue<string>) => {
+    onChange({ ...query, protocol: (option?.value || undefined) as ArcQuery['protocol'] });
+    onRunQuery();
+  };
+
+  const onBucketOriginChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onChange({ ...query, bucketOrigin: event.target.value.trim() || undefined });
+  };
+
+  const onTimeColumnNamesChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onChange({ ...query, timeColumnNames: event.target.value.trim() || undefined });
+  };
+
+  const onLastValueChange = (event: React.FormEvent<HTMLInputElement>) => {
+    onChange({ ...query, lastValueOptimization: event.currentTarget.checked || undefined });
+    onRunQuery();
+  };
+
+  const onPartialResultsChange = (event: React.FormEvent<HTMLInputElement>) => {
+    onChange({ ...query, allowPartialResults: event.currentTarget.checked || undefined });
+    onRunQuery();
+  };
+
+  const onDedupeRowsChange = (event: React.FormEvent<HTMLInputElement>) => {
+    onChange({ ...query, dedupeRows: event.currentTarget.checked || undefined });
+    onRunQuery();
+  };
+
+  const onOrderByTimeChange = (event: React.FormEvent<HTMLInputElement>) => {
+    onChange({ ...query, orderByTime: event.currentTarget.checked || undefined });
+    onRunQuery();
+  };
+
+  const onMaxSeriesChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const parsed = parseInt(event.target.value, 10);
+    onChange({ ...query, maxSeries: isNaN(parsed) || parsed < 1 ? undefined : parsed });
+  };
+
+  const onRowLimitChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const parsed = parseInt(event.target.value, 10);
+    onChange({ ...query, rowLimit: isNaN(parsed) || parsed < 1 ? undefined : parsed });
+  };
+
+  const onOverflowActionChange = (option: SelectableValue<'truncate' | 'error' | 'aggregateOther'>) => {
+    onChange({ ...query, overflowAction: option?.value });
+    onRunQuery();
+  };
+
   return (
     <div className="gf-form-group">
       <div className={styles.toolbar}>
@@ -67,17 +175,46 @@ export function QueryEditor({ query, onChange, onRunQuery }: Props) {
           />
         </InlineField>
 
+        {query.format === 'table' ? (
+          <InlineField
+            label="Layout"
+            tooltip="Long: one row per time and series, labels as columns (tidy). Wide: one column per series."
+          >
+            <RadioButtonGroup
+              options={TABLE_LAYOUT_OPTIONS}
+              value={query.tableLayout || 'long'}
+              onChange={onTableLayoutChange}
+            />
+          </InlineField>
+        ) : null}
+
         <InlineField
           label="Splitting"
-          tooltip="Parallel time-range chunking for faster results. Applies to: time-bucketed ($__timeGroup) and raw queries. Auto-skipped for: GROUP BY, DISTINCT, COUNT/SUM/AVG without $__timeGroup, LIMIT, and no $__timeFilter."
+          tooltip="Parallel time-range chunking for faster results. Applies to: time-bucketed ($__timeGroup) and raw queries. Auto-skipped for: GROUP BY, DISTINCT, COUNT/SUM/AVG without $__timeGroup, LIMIT, and no $__timeFilter. Pick a chunk size or type one, e.g. 30m, 12h30m or 14d (at least 5m)."
         >
           <Select
             options={SPLIT_OPTIONS}
             value={query.splitDuration || 'auto'}
             onChange={onSplitChange}
+            allowCustomValue
             width={16}
           />
         </InlineField>
+        {splitHint ? <span className={styles.splitHint}>{splitHint}</span> : null}
+
+        <InlineField
+          label="Partial results"
+          tooltip="Split queries only: when some chunks fail, show the chunks that succeeded with a warning listing the missing time ranges, instead of failing the query."
+        >
+          <InlineSwitch value={query.allowPartialResults ?? false} onChange={onPartialResultsChange} />
+        </InlineField>
+
+        <InlineField
+          label="Dedupe rows"
+          tooltip="Split queries only: after merging the chunks, drop rows whose time and label columns repeat an earlier row, such as boundary rows a query's own BETWEEN filter reads in two chunks. The first chunk's row is kept."
+        >
+          <InlineSwitch value={query.dedupeRows ?? false} onChange={onDedupeRowsChange} />
+        </InlineField>
 
         <InlineField
           label="Database"
@@ -91,6 +228,105 @@ export function QueryEditor({ query, onChange, onRunQuery }: Props) {
             width={16}
           />
         </InlineField>
+
+        <InlineField
+          label="Credential"
+          tooltip="Run this query with one of the datasource's named credentials instead of its API key. Only Editors and Admins can run it; viewers of the dashboard get a permission error. Leave empty to use the API key."
+        >
+          <Input
+            value={query.credential || ''}
+            onChange={onCredentialChange}
+            onBlur={onRunQuery}
+            placeholder="API key"
+            width={16}
+          />
+        </InlineField>
+
+        <InlineField
+          label="Protocol"
+          tooltip="Fetch this query's results over Arrow or JSON instead of the datasource's Use Arrow setting, to work around a type one of them mishandles. Auto uses Arrow when the server supports it. The query inspector shows the protocol used under meta."
+        >
+          <Select options={PROTOCOL_OPTIONS} value={query.protocol || ''} onChange={onProtocolChange} width={16} />
+        </InlineField>
+
+        <InlineField
+          label="Bucket origin"
+          tooltip="Align $__timeGroup buckets to this instant instead of the Unix epoch (UTC days, Thursday weeks). Use 'startOfRange', an RFC3339 timestamp, e.g. 2026-01-05T00:00:00+01:00 for Monday weeks in Berlin, or a time zone such as Europe/Berlin: days then start at local midnight all year, 23 or 25 hours long over a DST change, weeks on Monday, and split chunks follow the same days."
+        >
+          <Input
+            value={query.bucketOrigin || ''}
+            onChange={onBucketOriginChange}
+            onBlur={onRunQuery}
+            placeholder="epoch"
+            width={24}
+          />
+        </InlineField>
+
+        <InlineField
+          label="Time columns"
+          tooltip="Comma-separated columns read as time in JSON results, text or epoch numbers, in place of the datasource's Time Column Names, e.g. event_time."
+        >
+          <Input
+            value={query.timeColumnNames || ''}
+            onChange={onTimeColumnNamesChange}
+            onBlur={onRunQuery}
+            placeholder="datasource's"
+            width={24}
+          />
+        </InlineField>
+
+        <InlineField
+          label="Last value only"
+          tooltip="For stat panels: fetch only the latest row per series instead of the whole range. Series come from the GROUP BY (or a single value column); queries the rewrite can't handle safely run in full."
+        >
+          <InlineSwitch value={query.lastValueOptimization ?? false} onChange={onLastValueChange} />
+        </InlineField>
+
+        <InlineField
+          label="Order by time"
+          tooltip="Time series only: append ORDER BY <time column> ASC when the query has none, placed before any LIMIT. The time column is the $__timeGroup alias, the $__timeFilter column or a column named time; queries where none is found, CTEs (WITH) and UNIONs run unchanged."
+        >
+          <InlineSwitch value={query.orderByTime ?? false} onChange={onOrderByTimeChange} />
+        </InlineField>
+
+        <InlineField
+          label="Row limit"
+          tooltip="LIMIT appended to this query unless the SQL has its own. Overrides the datasource's Max Rows and the time-series row cap. Empty = none."
+        >
+          <Input
+            type="number"
+            value={query.rowLimit ?? ''}
+            onChange={onRowLimitChange}
+            onBlur={onRunQuery}
+            placeholder="none"
+            width={12}
+          />
+        </InlineField>
+
+        <InlineField
+          label="Max series"
+          tooltip="Cap on the number of series returned to the panel, protecting browsers when a variable change explodes cardinality. Empty = unlimited."
+        >
+          <Input
+            type="number"
+            value={query.maxSeries ?? ''}
+            onChange={onMaxSeriesChange}
+            onBlur={onRunQuery}
+            placeholder="unlimited"
+            width={12}
+          />
+        </InlineField>
+
+        {query.maxSeries ? (
+          <InlineField label="Overflow" tooltip="What to do when the query returns more than Max series.">
+            <Select
+              options={OVERFLOW_OPTIONS}
+              value={query.overflowAction || 'truncate'}
+              onChange={onOverflowActionChange}
+              width={20}
+            />
+          </InlineField>
+        ) : null}
       </div>
 
       <div className={styles.sqlBlock}>
@@ -105,10 +341,10 @@ export function QueryEditor({ query, onChange, onRunQuery }: Props) {
         />
         <div className={styles.help}>
           <div className={styles.helpLine}>
-            <strong>Available Macros:</strong> $__timeFilter(column), $__timeFrom(), $__timeTo(), $__interval, $__timeGroup(column, interval)
+            <strong>Available Macros:</strong> $__timeFilter(column), $__timeFrom(), $__timeTo(), $__rangeFrom(), $__rangeTo(), $__timeFilterPrev(column), $__timeFromPrev(), $__timeToPrev(), $__interval, $__interval_ms, $__timeGroup(column, interval), $__in(column, values), $__quote(values), $__adhocFilter
           </div>
           <div className={styles.helpHint}>
-            $__timeGroup intervals: &apos;$__interval&apos; (auto), &apos;1 hour&apos;, &apos;10 minutes&apos;, &apos;1 minute&apos;, &apos;10 seconds&apos;, &apos;1 day&apos; — or short forms: &apos;1h&apos;, &apos;10m&apos;, &apos;1m&apos;, &apos;1d&apos;
+            $__timeGroup intervals: &apos;$__interval&apos; (the panel&apos;s interval), &apos;1 hour&apos;, &apos;10 minutes&apos;, &apos;1 minute&apos;, &apos;10 seconds&apos;, &apos;1 day&apos;, &apos;1 week&apos; — or short forms, combinable: &apos;15m&apos;, &apos;90s&apos;, &apos;2h30m&apos;, &apos;1d&apos;, &apos;1w&apos;, and sub-second: &apos;100ms&apos;, &apos;0.5s&apos;
           </div>
           <div className={styles.helpExample}>
             Example: SELECT $__timeGroup(time, &apos;$__interval&apos;) AS time, host, AVG(value) FROM metrics WHERE $__timeFilter(time) GROUP BY 1, host ORDER BY 1
@@ -139,6 +375,10 @@ const getStyles = (theme: GrafanaTheme2) => ({
     lineHeight: 1.5,
     marginTop: theme.spacing(1),
   }),
+  splitHint: css({
+    fontSize: '12px',
+    color: theme.colors.text.secondary,
+  }),
   help: css({
     marginTop: theme.spacing(1),
     fontSize: '12px',
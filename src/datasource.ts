@@ -1,16 +1,28 @@
 import {
+  AdHocVariableFilter,
+  DataFrame,
   DataQueryRequest,
+  TimeRange,
   DataQueryResponse,
   MetricFindValue,
   DataSourceInstanceSettings,
+  DataSourceGetTagKeysOptions,
+  DataSourceGetTagValuesOptions,
   CoreApp,
   ScopedVars,
   VariableWithMultiSupport,
   LegacyMetricFindQueryOptions,
 } from '@grafana/data';
 import { frameToMetricFindValue, DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime';
-import { ArcQuery, ArcDataSourceOptions, defaultQuery } from './types';
-import { lastValueFrom } from 'rxjs';
+import {
+  ArcQuery,
+  ArcDataSourceOptions,
+  ArcSplitPreview,
+  ArcCatalogColumn,
+  defaultExploreQuery,
+  defaultQuery,
+} from './types';
+import { lastValueFrom, Observable } from 'rxjs';
 
 /**
  * Shapes a `metricFindQuery` argument can arrive as. Grafana's
@@ -43,6 +55,7 @@ export class ArcDataSource extends DataSourceWithBackend<ArcQuery, ArcDataSource
 
     const target: ArcQuery = {
       refId: 'metricFindQuery',
+      queryType: 'variable',
       sql: sqlQuery,
       format: 'table',
     };
@@ -59,13 +72,14 @@ export class ArcDataSource extends DataSourceWithBackend<ArcQuery, ArcDataSource
 
   toMetricFindValue(rsp: DataQueryResponse): MetricFindValue[] {
     const data = rsp.data ?? [];
-    const values = data.map((d) => frameToMetricFindValue(d)).flat();
-    // Dedup by `.text` in a single linear pass via Set lookup — was
-    // O(N²) via findIndex inside filter (R1 M25). Order-preserving.
+    const values = data.map((d) => variableFrameValues(d) ?? frameToMetricFindValue(d)).flat();
+    // Dedup by value (`.text` when there is none) in a single linear pass
+    // via Set lookup — was O(N²) via findIndex inside filter (R1 M25).
+    // Order-preserving.
     const seen = new Set<string>();
     const out: MetricFindValue[] = [];
     for (const v of values) {
-      const key = String(v.text);
+      const key = String(v.value ?? v.text);
       if (seen.has(key)) {
         continue;
       }
@@ -75,8 +89,64 @@ export class ArcDataSource extends DataSourceWithBackend<ArcQuery, ArcDataSource
     return out;
   }
 
-  getDefaultQuery(_: CoreApp): Partial<ArcQuery> {
-    return defaultQuery;
+  getDefaultQuery(app: CoreApp): Partial<ArcQuery> {
+    return app === CoreApp.Explore ? defaultExploreQuery : defaultQuery;
+  }
+
+  /**
+   * Grafana doesn't tell the backend which app a request comes from, so
+   * queries run from Explore are stamped with `app: 'explore'` on the way
+   * out (the stored query is untouched). The backend gives them table-first
+   * defaults and the Explore row preview cap.
+   */
+  query(request: DataQueryRequest<ArcQuery>): Observable<DataQueryResponse> {
+    if (request.app !== CoreApp.Explore) {
+      return super.query(request);
+    }
+    return super.query({ ...request, targets: request.targets.map((target) => ({ ...target, app: CoreApp.Explore })) });
+  }
+
+  /**
+   * Resolves a splitDuration for a time range on the backend (GET
+   * /split-ladder), so the editor shows the chunking the query will use.
+   */
+  getSplitPreview(range: TimeRange, splitDuration?: string): Promise<ArcSplitPreview> {
+    return this.getResource('split-ladder', {
+      from: range.from.valueOf(),
+      to: range.to.valueOf(),
+      splitDuration: splitDuration || 'auto',
+    });
+  }
+
+  /**
+   * Catalog lookups for autocomplete (GET /databases, /tables, /columns).
+   * The backend caches answers for the datasource's catalogCacheTTL, so
+   * these are cheap to call as the user types. An empty database means the
+   * datasource's own; any other needs Allow Database Override.
+   */
+  getDatabases(): Promise<string[]> {
+    return this.getResource('databases');
+  }
+
+  getTables(database?: string): Promise<string[]> {
+    return this.getResource('tables', database ? { database } : {});
+  }
+
+  getColumns(table: string, database?: string): Promise<ArcCatalogColumn[]> {
+    return this.getResource('columns', database ? { database, table } : { table });
+  }
+
+  /**
+   * Keys and values for ad hoc filters (/tag-keys, /tag-values): the
+   * columns of the datasource's Ad Hoc Table and the distinct values of
+   * one of them. The backend applies the filters to every query.
+   */
+  getTagKeys(_options?: DataSourceGetTagKeysOptions): Promise<MetricFindValue[]> {
+    return this.getResource('tag-keys');
+  }
+
+  getTagValues(options: DataSourceGetTagValuesOptions): Promise<MetricFindValue[]> {
+    return this.getResource('tag-values', { key: options.key });
   }
 
   quoteLiteral(value: string) {
@@ -105,14 +175,37 @@ export class ArcDataSource extends DataSourceWithBackend<ArcQuery, ArcDataSource
     return value;
   };
 
-  applyTemplateVariables(query: ArcQuery, scopedVars: ScopedVars): ArcQuery {
+  applyTemplateVariables(query: ArcQuery, scopedVars: ScopedVars, filters?: AdHocVariableFilter[]): ArcQuery {
+    // $__interval and $__interval_ms are left to the backend, which expands
+    // them from the query's interval and max data points as SQL ('30 seconds')
+    // rather than Grafana's '30s'.
+    const vars = { ...scopedVars };
+    delete vars.__interval;
+    delete vars.__interval_ms;
+    // Dashboards that don't pass the filters still have them on the
+    // template service.
+    const adhocFilters = filters ?? getTemplateSrv().getAdhocFilters(this.name);
     return {
       ...query,
-      sql: getTemplateSrv().replace(query.sql, scopedVars, this.interpolateVariable),
+      sql: getTemplateSrv().replace(query.sql, vars, this.interpolateVariable),
+      ...(adhocFilters.length ? { adhocFilters } : {}),
     };
   }
 }
 
+/**
+ * Reads the `__text` / `__value` frame the backend answers variable queries
+ * with; undefined for any other frame, which frameToMetricFindValue reads.
+ */
+function variableFrameValues(frame: DataFrame): MetricFindValue[] | undefined {
+  const text = frame.fields.find((f) => f.name === '__text');
+  const value = frame.fields.find((f) => f.name === '__value');
+  if (!text || !value) {
+    return undefined;
+  }
+  return text.values.map((t, i) => ({ text: String(t), value: String(value.values[i]) }));
+}
+
 /**
  * Extracts SQL text from a `metricFindQuery` argument, handling every
  * variable-query shape Grafana datasources have used historically. Returns
@@ -1,4 +1,4 @@
-import { DataQuery, DataSourceJsonData } from '@grafana/data';
+import { AdHocVariableFilter, DataQuery, DataSourceJsonData } from '@grafana/data';
 
 /**
  * Arc datasource configuration options
@@ -7,8 +7,63 @@ export interface ArcDataSourceOptions extends DataSourceJsonData {
   url?: string;
   database?: string;
   timeout?: number;
+  /**
+   * Use Arc's Arrow endpoint. Unset = auto: the backend probes the Arrow
+   * endpoint once per datasource instance and falls back to JSON only when
+   * the server doesn't offer Arrow. Explicit true/false skips the probe.
+   */
   useArrow?: boolean;
+  /**
+   * Bound on a whole query, every chunk and retry included (Go duration such
+   * as 2m). Unset = none; timeout bounds each Arc request.
+   */
+  queryTimeout?: string;
+  /**
+   * Cancel a dashboard panel's query still waiting on Arc when the same
+   * user runs it again. Unset = on.
+   */
+  cancelSuperseded?: boolean;
   maxConcurrency?: number;
+  /**
+   * Most chunks a split query is cut into; past it the chunks grow to a
+   * multiple of the split duration. Default 100, at most 10000.
+   */
+  maxSplitChunks?: number;
+  /**
+   * How long the backend reuses database, table and column lists for
+   * autocomplete (Go duration). Unset = 60s; 0 asks Arc every time.
+   */
+  catalogCacheTTL?: string;
+  /**
+   * Values for ArcQuery options a query doesn't set, keyed like the query
+   * model. A key the query sends wins even when false, 0 or ''. sql,
+   * rawSql, refId, app, variableQuery and adhocFilters can't have defaults.
+   */
+  queryDefaults?: Partial<Omit<ArcQuery, 'sql' | 'rawSql' | 'refId' | 'app' | 'variableQuery' | 'adhocFilters'>>;
+  /**
+   * Table whose columns and values ad hoc filters offer (/tag-keys and
+   * /tag-values) when a request names none.
+   */
+  adhocTable?: string;
+  /**
+   * Refuse to run without an API key. Unset = true; false lets an Arc
+   * without authentication (dev, air-gapped) be queried with no key, in
+   * which case requests carry no Authorization header.
+   */
+  requireAuth?: boolean;
+  /** Header the API key is sent in. Unset = Authorization. */
+  authHeaderName?: string;
+  /**
+   * Put before the key in that header, space included. Unset = "Bearer ";
+   * "" sends the raw key (e.g. X-API-Key gateways).
+   */
+  authHeaderPrefix?: string;
+  /**
+   * Send the signed-in user's OAuth token (forwarded by Grafana) to Arc as
+   * Authorization instead of the API key, which is used only when no token
+   * was forwarded. Off by default; Grafana's own key, so Grafana forwards it.
+   */
+  oauthPassThru?: boolean;
   /**
    * Per-response body size cap in MiB. Default 1024 MiB. Defense-in-depth
    * against runaway queries that would OOM the plugin process. Raise this
@@ -31,6 +86,194 @@ export interface ArcDataSourceOptions extends DataSourceJsonData {
    * key's authorization scope matches the dashboard-editor's authorization.
    */
   allowDatabaseOverride?: boolean;
+  /**
+   * Fail the query when values can't be converted to their column's type
+   * (unparseable timestamps, strings in a numeric column, ...). By default
+   * such values become null and the panel shows a warning notice.
+   */
+  failOnConversionErrors?: boolean;
+  /**
+   * Fail the query instead of modifying its result in any way: nulling
+   * unconvertible values, guessing epoch units, rounding integers past 2^53,
+   * converting interval months, truncating rows or series, collapsing
+   * duplicate rows, or dropping split chunks.
+   */
+  strictMode?: boolean;
+  /**
+   * LIMIT safety net for time-series queries that use $__timeGroup but have
+   * no LIMIT of their own (e.g. a forgotten GROUP BY returning raw rows).
+   * Unset/0 = auto (maxDataPoints × 10 × estimated series count), negative =
+   * disabled, positive = fixed row cap. Raw and table queries are only capped
+   * by rawRowCap.
+   */
+  timeSeriesRowCap?: number;
+  /**
+   * LIMIT for table and raw (no $__timeGroup) queries without one of their
+   * own: maxDataPoints × estimated series count, at most this many rows,
+   * none when maxDataPoints ≤ 0. Unset/0 = 1000000, negative = off.
+   */
+  rawRowCap?: number;
+  /**
+   * LIMIT appended to every query without a LIMIT or rowLimit of its own.
+   * Takes precedence over the time-series row cap. Unset/0 = none.
+   */
+  maxRows?: number;
+  /**
+   * Row preview cap for queries run from Explore, in place of maxRows and the
+   * time-series row cap. Unset/0 = 10000, negative = none.
+   */
+  exploreMaxRows?: number;
+  /**
+   * Text values longer than this many bytes are truncated with an
+   * ellipsis. Unset/0 = 1 MiB, negative = off.
+   */
+  maxCellBytes?: number;
+  /**
+   * Comma-separated names of the columns the JSON decoder reads as time,
+   * epochs included (e.g. "ts, created_at"). Unset = time, timestamp, _time.
+   */
+  timeColumnNames?: string;
+  /**
+   * Arc server version to assume instead of detecting it from Arc's health
+   * endpoint. Only needed when a proxy hides or rewrites that endpoint;
+   * version-gated features fail with a clear error when the version is unknown.
+   */
+  arcVersion?: string;
+  /**
+   * Run a `SELECT count(*)` estimate before each query and let it choose the
+   * protocol (when useArrow is unset), auto splitting and the row cap. The
+   * decision is recorded in frame meta; a failed estimate changes nothing.
+   */
+  adaptiveExecution?: boolean;
+  /**
+   * Test mode: a local directory (or file:// URL) of canned Arc responses.
+   * When set, queries are answered from fixtures instead of Arc.
+   */
+  fixtureMode?: string;
+  /** With fixtureMode set, query the live Arc and record each response as a fixture. */
+  fixtureRecord?: boolean;
+  /**
+   * Copy column comments (as field descriptions) and native column types
+   * from Arc's DESCRIBE of the queried tables. DESCRIBE answers are cached.
+   */
+  enrichFieldMetadata?: boolean;
+  /**
+   * Set units on numeric columns whose name ends in a duration suffix
+   * (request_duration_ms → ms, latency_us → µs, elapsed_seconds → s).
+   */
+  durationUnitsFromNames?: boolean;
+  /**
+   * Named SQL fragments expanded from `$__snippet(name)` in queries, before
+   * any other macro. Set through provisioning.
+   */
+  snippets?: Record<string, string>;
+  /** Let snippets use `${__user.login}` / `${__user.email}` of the requesting user. */
+  forwardUserIdentity?: boolean;
+  /**
+   * Name the Grafana user (login) and org in X-Grafana-User and
+   * X-Grafana-Org-Id headers on every request to Arc, for its audit log.
+   */
+  forwardGrafanaUser?: boolean;
+  /** X-Grafana-User of requests without a user (alerting). Unset = grafana. */
+  serviceIdentity?: string;
+  /**
+   * Prepend a comment naming the dashboard, panel and user to every query
+   * sent to Arc, for attributing load in Arc's query log. Off by default.
+   */
+  queryAttribution?: boolean;
+  /**
+   * The comment's text, with ${dashboard}, ${panel}, ${org}, ${user} and
+   * ${refId} placeholders. Empty = "grafana dashboard=${dashboard}
+   * panel=${panel} user=${user} refId=${refId}".
+   */
+  attributionTemplate?: string;
+  /** Leave the attribution comment out of the query inspector's executed SQL. */
+  hideAttribution?: boolean;
+  /**
+   * Clean up characters pasted SQL picks up: 'spaces' (default) drops a BOM,
+   * replaces non-breaking spaces and drops zero-width characters outside
+   * literals; 'quotes' also straightens curly-quoted literals; 'off' sends
+   * the SQL as typed.
+   */
+  normalizeUnicode?: 'spaces' | 'quotes' | 'off';
+  /**
+   * Keep the raw response body (first 8 MiB, last 3 failures) when a query's
+   * result can't be converted, for bug reports. Admins download the latest
+   * through the datasource's `debug/last-failure` resource.
+   */
+  captureFailures?: boolean;
+  /**
+   * Log queries Arc takes longer than this to answer (Go duration such as
+   * 5s). Unset = off.
+   */
+  slowQueryThreshold?: string;
+  /**
+   * With slowQueryThreshold: EXPLAIN slow queries in the background (at most
+   * one every 10s). Admins list the plans through the datasource's
+   * `debug/slow-plans` resource.
+   */
+  captureSlowQueryPlans?: boolean;
+  /**
+   * Shape of these settings. Unset = 0; older shapes are migrated when the
+   * backend loads them. Admins see the result through the datasource's
+   * `settings/effective` resource.
+   */
+  schemaVersion?: number;
+  /**
+   * HTTP statuses a request is retried on (up to maxRetries times, with backoff).
+   * Unset = 429, 502, 503, 504; empty = no retries. 4xx and 5xx only.
+   */
+  retryStatusCodes?: number[];
+  /**
+   * Retries per request after a retryable status or a dropped connection.
+   * Unset or 0 = 2, negative = none, at most 10.
+   */
+  maxRetries?: number;
+  /**
+   * Show UINT64 columns holding a value beyond 2^53 as text, so every value
+   * is exact. Unset = on; false rounds them into float64 silently. Arrow
+   * protocol only.
+   */
+  exactUint64?: boolean;
+  /**
+   * With exactUint64: keep such columns float64 and show a precision-loss
+   * notice instead of converting them to text.
+   */
+  preferNumeric?: boolean;
+  /**
+   * When a guard (role restrictions, database override) refuses a query,
+   * also return a one-row explanation frame marked arcExplanation in its
+   * meta. Never returned for alerting.
+   */
+  explainBlockedQueries?: boolean;
+  /**
+   * Columns whose values the debug log shows as ***, in results and in the
+   * literals the query compares them with. Case-insensitive.
+   */
+  redactColumns?: string[];
+  /**
+   * In-memory cache for split-query chunks that end before the immutability
+   * horizon, in MiB. Unset/0 = disabled.
+   */
+  chunkCacheMB?: number;
+  /** Chunks ending more than this long ago are cached (Go duration, default 10m). */
+  chunkCacheHorizon?: string;
+  /**
+   * Per org role ("Viewer", "Editor", "Admin"), the tables its queries may
+   * read, enforced by the backend. Set through provisioning; roles without
+   * an entry are unrestricted.
+   */
+  roleRestrictions?: Record<string, ArcRoleRestriction>;
+}
+
+/**
+ * Tables one org role may query.
+ */
+export interface ArcRoleRestriction {
+  /** Allowed tables as globs: `cpu`, `mem_*` (datasource database) or `prod.*`. */
+  tables: string[];
+  /** Reject queries whose tables can't all be determined. Default: true, except for Admin. */
+  strict?: boolean;
 }
 
 /**
@@ -38,6 +281,43 @@ export interface ArcDataSourceOptions extends DataSourceJsonData {
  */
 export interface ArcSecureJsonData {
   apiKey?: string;
+  /**
+   * Named credentials: a JSON object of name to Arc API key, e.g.
+   * {"admin": "<key>"}. A query naming one runs with that key (Editors and
+   * Admins only).
+   */
+  credentials?: string;
+}
+
+/**
+ * GET /split-ladder answer: what a splitDuration resolves to for a time
+ * range, from the backend's own split logic.
+ */
+export interface ArcSplitPreview {
+  splitDuration: string;
+  from: string;
+  to: string;
+  rangeMs: number;
+  split: boolean;
+  chunk?: string; // e.g. '6h'; absent when the query isn't split
+  requestedChunk?: string; // set when maxSplitChunks grew chunk past the setting
+  chunkMs: number;
+  chunks: number;
+  reason: string;
+  warning?: string; // the notice a query with this splitDuration would carry
+  minSplitDurationMs: number;
+  maxSplitChunks: number;
+  ladder: Array<{ under?: string; underMs: number; chunk?: string; chunkMs: number }>;
+}
+
+/**
+ * One column of a GET /columns answer; type is Arc's own type name, e.g.
+ * DOUBLE or TIMESTAMP.
+ */
+export interface ArcCatalogColumn {
+  name: string;
+  type: string;
+  description?: string;
 }
 
 /**
@@ -45,11 +325,26 @@ export interface ArcSecureJsonData {
  */
 export interface ArcQuery extends DataQuery {
   sql: string;
-  format?: 'time_series' | 'table';
+  format?: 'time_series' | 'table' | 'numeric_table';
   rawQuery?: boolean;
   rawSql?: string; // Postgres/MySQL/MSSQL/ClickHouse compatibility
-  splitDuration?: string; // "off", "1h", "6h", "12h", "1d", "3d", "7d"
+  splitDuration?: string; // "auto" (default), "off", or a duration of at least 5m: "30m", "2h", "12h30m", "1d", "14d", "2w"
   database?: string; // Per-query database override (empty = use datasource default)
+  maxSeries?: number; // Cap on series returned to the panel (empty/0 = unlimited)
+  overflowAction?: 'truncate' | 'error' | 'aggregateOther'; // What to do past maxSeries (default truncate)
+  tableLayout?: 'long' | 'wide'; // Table format only: tidy rows with labels as columns (default) or one column per series
+  bucketOrigin?: string; // $__timeGroup alignment: empty = epoch, 'startOfRange', an RFC3339 timestamp, or a time zone such as 'Europe/Berlin' (local days across DST)
+  lastValueOptimization?: boolean; // Fetch only the latest row per series (stat panels); unrecognized shapes run in full
+  orderByTime?: boolean; // Time series only: append ORDER BY <time column> ASC when the query has no ORDER BY
+  rowLimit?: number; // LIMIT appended unless the SQL has its own (empty/0 = none); takes precedence over the datasource's maxRows
+  app?: string; // Set on outgoing requests only: 'explore' for queries run from Explore; never saved
+  credential?: string; // Named credential to run with instead of the datasource's API key (Editors and Admins only)
+  protocol?: 'arrow' | 'json' | 'auto'; // Protocol for this query in place of the datasource's Use Arrow setting (unset = the datasource's)
+  allowPartialResults?: boolean; // Split queries: show the chunks that succeeded, with a warning, when some fail
+  dedupeRows?: boolean; // Split queries: drop merged rows repeating the time and labels of an earlier row
+  variableQuery?: boolean; // Fill a dashboard variable: the backend answers one __value / __text frame (also set by queryType: 'variable')
+  timeColumnNames?: string; // Comma-separated columns decoded as time over JSON, in place of the datasource's Time Column Names (unset = the datasource's)
+  adhocFilters?: AdHocVariableFilter[]; // The dashboard's ad hoc filters, set on the way out: expanded from $__adhocFilter or added to the WHERE clause
 }
 
 /**
@@ -60,3 +355,11 @@ export const defaultQuery: Partial<ArcQuery> = {
   format: 'time_series',
   rawQuery: true,
 };
+
+/**
+ * Default values for a new query in Explore: tables first.
+ */
+export const defaultExploreQuery: Partial<ArcQuery> = {
+  ...defaultQuery,
+  format: 'table',
+};